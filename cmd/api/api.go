@@ -7,10 +7,14 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"go-commerce/internal/driver"
 	"go-commerce/internal/models"
+	"go-commerce/internal/money"
+
+	"github.com/go-chi/chi/v5"
 )
 
 const name = "card-pay-backend"
@@ -20,8 +24,9 @@ type config struct {
 	port   int
 	env    string
 	stripe struct {
-		secret string
-		key    string
+		secret        string
+		key           string
+		webhookSecret string
 	}
 	db struct {
 		dsn string
@@ -32,8 +37,18 @@ type config struct {
 		username string
 		password string
 	}
-	secretKey string
-	frontend  string
+	secretKey         string
+	frontend          string
+	baseCurrency      string
+	rollupInterval    time.Duration
+	authCheckInterval time.Duration
+	authWarnBefore    time.Duration
+	alertEmail        string
+	dunningInterval   time.Duration
+	dunningSchedule   []time.Duration
+	usageInterval     time.Duration
+	ledgerInterval    time.Duration
+	invoiceService    string
 }
 
 type application struct {
@@ -45,13 +60,19 @@ type application struct {
 }
 
 func (app *application) serve() error {
+	routes := app.routes()
+	if err := checkRoutesDocumented(routes.(chi.Routes)); err != nil {
+		return err
+	}
+
 	server := &http.Server{
 		Addr:              fmt.Sprintf(":%d", app.config.port),
-		Handler:           app.routes(),
+		Handler:           routes,
 		IdleTimeout:       30 * time.Second,
 		ReadTimeout:       10 * time.Second,
 		ReadHeaderTimeout: 5 * time.Second,
-		WriteTimeout:      5 * time.Second,
+		// long enough for the CSV and XLSX exports, which are streamed
+		WriteTimeout: 2 * time.Minute,
 	}
 
 	app.infoLog.Printf(fmt.Sprintf("Starting %s server in %s mode on port %d", name, app.config.env, app.config.port))
@@ -65,11 +86,32 @@ func main() {
 	flag.StringVar(&conf.env, "env", "development", "Application environment (default: development) {development|staging|production}")
 	flag.StringVar(&conf.secretKey, "secretkey", "qsdhytewnbc8rlopwe904hg7epqzas21", "Secret Key")
 	flag.StringVar(&conf.frontend, "frontend", "http://localhost:8000", "Frontend URL")
+	flag.StringVar(&conf.baseCurrency, "base-currency", "usd", "Currency reports are converted into")
+	flag.DurationVar(&conf.rollupInterval, "rollup-interval", 10*time.Minute, "How often the report rollups of today are refreshed")
+	flag.DurationVar(&conf.authCheckInterval, "auth-check-interval", time.Hour, "How often card authorizations are checked for expiry")
+	flag.DurationVar(&conf.authWarnBefore, "auth-warn-before", 24*time.Hour, "How long before a card authorization expires to warn about it")
+	flag.StringVar(&conf.alertEmail, "alert-email", "", "Where warnings about expiring card authorizations are emailed (default: only logged)")
+	flag.DurationVar(&conf.dunningInterval, "dunning-interval", time.Hour, "How often failed subscription renewals due a retry are retried")
+	flag.DurationVar(&conf.usageInterval, "usage-interval", 15*time.Minute, "How often the usage reported for metered subscriptions is pushed to the gateway")
+	flag.DurationVar(&conf.ledgerInterval, "ledger-interval", time.Minute, "How often new charges, refunds, fees, disputes and payouts are posted to the ledger")
+	flag.StringVar(&conf.invoiceService, "invoice-service", "http://localhost:5000", "URL of the invoice microservice, which issues credit notes for refunds")
+	dunningSchedule := flag.String("dunning-schedule", "72h,120h,168h", "Delays after a failed renewal at which it is retried and the customer reminded; the subscription is cancelled when the last retry fails")
 
 	flag.Parse()
 
+	conf.baseCurrency = strings.ToLower(conf.baseCurrency)
+	if !money.Known(conf.baseCurrency) {
+		log.Fatalf("unknown base currency %q", conf.baseCurrency)
+	}
+	schedule, err := parseSchedule(*dunningSchedule)
+	if err != nil {
+		log.Fatalf("invalid dunning schedule: %v", err)
+	}
+	conf.dunningSchedule = schedule
+
 	conf.stripe.key = os.Getenv("STRIPE_KEY")
 	conf.stripe.secret = os.Getenv("STRIPE_SECRET")
+	conf.stripe.webhookSecret = os.Getenv("STRIPE_WEBHOOK_SECRET")
 	conf.db.dsn = os.Getenv("DB_DSN")
 	conf.smtp.host = os.Getenv("SMTP_HOST")
 	conf.smtp.port, _ = strconv.Atoi(os.Getenv("SMTP_PORT"))
@@ -93,6 +135,12 @@ func main() {
 		DB:       models.DBWrapper{DB: conn},
 	}
 
+	go app.refreshRollups(conf.rollupInterval)
+	go app.warnExpiringAuthorizations(conf.authCheckInterval, conf.authWarnBefore)
+	go app.runDunning(conf.dunningInterval)
+	go app.reportUsage(conf.usageInterval)
+	go app.postLedger(conf.ledgerInterval)
+
 	if err := app.serve(); err != nil {
 		log.Fatalln(err)
 	}
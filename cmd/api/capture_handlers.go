@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-commerce/internal/apierror"
+	"go-commerce/internal/apispec"
+	"go-commerce/internal/models"
+	"go-commerce/internal/money"
+	"go-commerce/internal/validator"
+)
+
+// SetWidgetCaptureMethod sets whether a widget is charged at checkout or only authorized
+func (app *application) SetWidgetCaptureMethod(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	var payload apispec.WidgetCaptureMethod
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check("capture_method", payload.CaptureMethod, validator.Required, validator.In(models.CaptureAutomatic, models.CaptureManual))
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	if err := app.DB.SetWidgetCaptureMethod(id, payload.CaptureMethod); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	resp := apispec.Response{
+		Message: "capture method set to " + payload.CaptureMethod,
+	}
+	app.writeJSON(w, resp, http.StatusOK)
+}
+
+// authorizedSale gets the sale identified in the URL, which must hold a card
+// authorization that has not been captured or voided yet
+func (app *application) authorizedSale(r *http.Request) (models.Order, error) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	order, err := app.DB.GetSaleByID(id)
+	if err != nil {
+		return order, err
+	}
+	if order.Transaction.TransactionStatusID != models.TransactionAuthorized {
+		return order, apierror.Conflict("the payment of this sale is not an authorization waiting to be captured")
+	}
+	return order, nil
+}
+
+// CreateCapture captures all or part of the card authorization of the sale identified in
+// the URL. The rest of the authorization is released to the card holder.
+func (app *application) CreateCapture(w http.ResponseWriter, r *http.Request) {
+	order, err := app.authorizedSale(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	var payload apispec.CaptureRequest
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.CheckInt("amount", payload.Amount, validator.Min(0), validator.Max(order.Transaction.Amount))
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	payConf := app.payConfig()
+	pi, err := payConf.Capture(order.Transaction.PaymentIntent, payload.Amount)
+	if err != nil {
+		app.errorJSON(w, r, apierror.Gateway("could not capture payment", err))
+		return
+	}
+
+	captured := int(pi.AmountReceived)
+	if err := app.DB.CapturePayment(order, captured); err != nil {
+		app.errorJSON(w, r, apierror.Internal(err).WithMessage("payment has been captured but could not update in database"))
+		return
+	}
+
+	resp := apispec.Response{
+		Message: "captured " + money.New(int64(captured), order.Transaction.Currency).String(),
+	}
+	app.writeJSON(w, resp, http.StatusCreated)
+}
+
+// CreateVoid voids the card authorization of the sale identified in the URL and cancels
+// the sale
+func (app *application) CreateVoid(w http.ResponseWriter, r *http.Request) {
+	order, err := app.authorizedSale(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	payConf := app.payConfig()
+	if _, err := payConf.Void(order.Transaction.PaymentIntent); err != nil {
+		app.errorJSON(w, r, apierror.Gateway("could not void payment", err))
+		return
+	}
+
+	if err := app.DB.VoidPayment(order); err != nil {
+		app.errorJSON(w, r, apierror.Internal(err).WithMessage("payment has been voided but could not update in database"))
+		return
+	}
+
+	resp := apispec.Response{
+		Message: "Payment voided",
+	}
+	app.writeJSON(w, resp, http.StatusCreated)
+}
+
+// warnExpiringAuthorizations checks every interval for card authorizations that expire
+// within warnBefore and warns about each of them once: in the log and, when an alert
+// email is configured, by email, so the sale is captured before the money is released.
+func (app *application) warnExpiringAuthorizations(interval, warnBefore time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		auths, err := app.DB.GetExpiringAuthorizations(time.Now().Add(warnBefore))
+		if err != nil {
+			app.errorLog.Printf("checking expiring authorizations: %v", err)
+		}
+		for _, a := range auths {
+			app.infoLog.Printf("authorization of sale %d for %s expires at %s",
+				a.OrderID, money.New(int64(a.Amount), a.Currency), a.CaptureBefore.Format(time.RFC3339))
+
+			if app.config.alertEmail != "" {
+				data := struct {
+					Auth   models.ExpiringAuthorization
+					Amount string
+					Link   string
+				}{a, money.New(int64(a.Amount), a.Currency).String(), fmt.Sprintf("%s/admin/sales/%d", app.config.frontend, a.OrderID)}
+				subject := fmt.Sprintf("Capture sale %d before its authorization expires", a.OrderID)
+				if err := app.SendMail("info@widgets.com", app.config.alertEmail, subject, "capture_expiry", data); err != nil {
+					// warn again on the next check
+					continue
+				}
+			}
+			if err := app.DB.MarkExpiryWarned(a.TransactionID); err != nil {
+				app.errorLog.Println(err)
+			}
+		}
+
+		<-ticker.C
+	}
+}
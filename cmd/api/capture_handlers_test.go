@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-commerce/internal/dbtest"
+	"go-commerce/internal/models"
+)
+
+// expectSale makes the next statements find sale 5 in orderStatus, paid by transaction 3
+// of 1000 cents with payment intent pi_1 in txnStatus, taxed by taxLines
+func expectSale(db *dbtest.DB, orderStatus, txnStatus int, taxLines ...[]interface{}) {
+	now := time.Now()
+	db.Expect("from orders o left join widgets w").WithArgs(dbtest.Any, dbtest.Any, 5).Rows([]interface{}{
+		5, 1, 3, 4, orderStatus, 1, 1000, "", "", 0, "", 0, 0, "", 0, 0,
+		models.FulfillmentPending, "", "", "", now, now, 1, "Widget", 3, 1000, "usd",
+		"4242", 12, 2030, "pi_1", "", txnStatus, now.Add(time.Hour), 30, 0, 4, "Ada", "Lovelace", "ada@example.com",
+	})
+	if len(taxLines) == 0 {
+		db.Expect("from order_tax_lines").WithArgs(5).NoRows()
+	} else {
+		db.Expect("from order_tax_lines").WithArgs(5).Rows(taxLines...)
+	}
+	db.Expect("from order_items").WithArgs(5).NoRows()
+}
+
+func TestCreateCapture(t *testing.T) {
+	fakeStripe(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/payment_intents/pi_1/capture" {
+			t.Errorf("got request for %s", r.URL.Path)
+		}
+		r.ParseForm()
+		if got := r.PostForm.Get("amount_to_capture"); got != "700" {
+			t.Errorf("captured %q, want 700", got)
+		}
+		fmt.Fprint(w, `{"id": "pi_1", "object": "payment_intent", "status": "succeeded", "amount_received": 700}`)
+	})
+	app, db := newDBApp(t)
+	expectSale(db, models.OrderPending, models.TransactionAuthorized)
+	db.Expect("update transactions set amount = ?").WithArgs(700, models.TransactionCleared, dbtest.Any, 3)
+	db.Expect("update orders set status_id = ?").WithArgs(models.OrderCleared, dbtest.Any, 5)
+	db.Expect("set amount = amount * ? div ?").WithArgs(700, 1000, 700, 1000, 700, 1000, dbtest.Any, 5)
+	db.Expect("update order_tax_lines").WithArgs(700, 1000, 700, 1000, dbtest.Any, 5)
+
+	req := withID(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"amount": 700}`)), 5)
+	rec := httptest.NewRecorder()
+	app.CreateCapture(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCreateCaptureNeedsAuthorization(t *testing.T) {
+	fakeStripe(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("got request for %s", r.URL.Path)
+	})
+	app, db := newDBApp(t)
+	expectSale(db, models.OrderPending, models.TransactionCleared)
+
+	req := withID(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"amount": 700}`)), 5)
+	rec := httptest.NewRecorder()
+	app.CreateCapture(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("got status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCreateCaptureLimitsAmount(t *testing.T) {
+	fakeStripe(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("got request for %s", r.URL.Path)
+	})
+	app, db := newDBApp(t)
+	expectSale(db, models.OrderPending, models.TransactionAuthorized)
+
+	req := withID(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"amount": 1001}`)), 5)
+	rec := httptest.NewRecorder()
+	app.CreateCapture(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCreateVoid(t *testing.T) {
+	fakeStripe(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/payment_intents/pi_1/cancel" {
+			t.Errorf("got request for %s", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"id": "pi_1", "object": "payment_intent", "status": "canceled"}`)
+	})
+	app, db := newDBApp(t)
+	expectSale(db, models.OrderPending, models.TransactionAuthorized)
+	db.Expect("update transactions set amount = ?").WithArgs(1000, models.TransactionVoided, dbtest.Any, 3)
+	db.Expect("update orders set status_id = ?").WithArgs(models.OrderCancelled, dbtest.Any, 5)
+
+	rec := httptest.NewRecorder()
+	app.CreateVoid(rec, withID(httptest.NewRequest(http.MethodPost, "/", nil), 5))
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestValidateCaptureMethod(t *testing.T) {
+	app := newTestApp()
+	req := withID(httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"capture_method": "later"}`)), 1)
+	rec := httptest.NewRecorder()
+	app.SetWidgetCaptureMethod(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d: %s", rec.Code, rec.Body)
+	}
+}
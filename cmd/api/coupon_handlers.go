@@ -0,0 +1,198 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"go-commerce/internal/apierror"
+	"go-commerce/internal/apispec"
+	"go-commerce/internal/models"
+	"go-commerce/internal/money"
+	"go-commerce/internal/payment"
+	"go-commerce/internal/validator"
+)
+
+var couponCodeRX = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// redeemableCoupon returns the coupon with code if the buyer with email can use it on
+// widget in currency. Coupons that cannot be used fail validation on field.
+func (app *application) redeemableCoupon(field, code string, widget models.Widget, currency, email string) (models.Coupon, error) {
+	c, err := app.DB.CheckCoupon(code, widget.ID, currency, email)
+	return c, couponError(field, err)
+}
+
+// reserveCoupon is redeemableCoupon for a checkout about to be charged: it also holds a
+// redemption of the coupon, whose reservation ID it returns, until the order is saved
+// or the payment fails
+func (app *application) reserveCoupon(field, code string, widget models.Widget, currency, email string) (models.Coupon, int, error) {
+	c, id, err := app.DB.ReserveCoupon(code, widget.ID, currency, email)
+	return c, id, couponError(field, err)
+}
+
+// releaseCoupon gives back the redemption held by a coupon reservation, if any. Errors
+// are only logged, as the hold expires anyway.
+func (app *application) releaseCoupon(reservationID int) {
+	if reservationID == 0 {
+		return
+	}
+	if err := app.DB.ReleaseCouponReservation(reservationID); err != nil {
+		app.errorLog.Println(err)
+	}
+}
+
+// couponError turns the reasons a coupon cannot be used into validation errors on field
+func couponError(field string, err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return apierror.Validation(map[string]string{field: "is not a valid coupon code"})
+	case errors.Is(err, models.ErrCouponExpired),
+		errors.Is(err, models.ErrCouponNotForWidget),
+		errors.Is(err, models.ErrCouponCurrency),
+		errors.Is(err, models.ErrCouponUsedUp),
+		errors.Is(err, models.ErrCouponRedeemed):
+		return apierror.Validation(map[string]string{field: err.Error()})
+	}
+	return err
+}
+
+// stripeCoupon returns the gateway coupon for c, creating it the first time c is used
+// on a subscription
+func (app *application) stripeCoupon(c models.Coupon, payConf payment.Config) (string, error) {
+	if c.StripeCouponID != "" {
+		return c.StripeCouponID, nil
+	}
+
+	sc, err := payConf.CreateCoupon(c.Code, c.PercentOff, c.AmountOff, c.Duration, c.DurationInMonths)
+	if err != nil {
+		return "", err
+	}
+	if err := app.DB.SetCouponStripeID(c.ID, sc.ID); err != nil {
+		return "", err
+	}
+	return sc.ID, nil
+}
+
+// CreateCouponCheck checks a coupon code for a buyer and returns the discount it gives
+// on a product, so the storefront can show it before the card is charged
+func (app *application) CreateCouponCheck(w http.ResponseWriter, r *http.Request) {
+	var payload apispec.CouponCheckRequest
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check("code", payload.Code, validator.Required, validator.MaxLength(64))
+	v.CheckInt("product_id", payload.ProductID, validator.Positive)
+	v.Check("currency", payload.Currency, validator.Required, validator.Currency)
+	v.Check("email", payload.Email, validator.Optional(validator.Email))
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+	currency := strings.ToLower(payload.Currency)
+
+	widget, err := app.DB.GetWidget(payload.ProductID)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	price, err := widget.PriceIn(currency)
+	if err != nil {
+		app.errorJSON(w, r, apierror.Validation(map[string]string{
+			"currency": "this product is not sold in " + strings.ToUpper(currency),
+		}))
+		return
+	}
+
+	c, err := app.redeemableCoupon("code", payload.Code, widget, currency, payload.Email)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	resp := apispec.CouponCheck{
+		Code:             c.Code,
+		Currency:         currency,
+		Price:            price,
+		Discount:         c.Discount(price),
+		Duration:         c.Duration,
+		DurationInMonths: c.DurationInMonths,
+	}
+	app.writeJSON(w, resp, http.StatusOK)
+}
+
+// ListCoupons returns every coupon
+func (app *application) ListCoupons(w http.ResponseWriter, r *http.Request) {
+	coupons, err := app.DB.GetCoupons()
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, apispec.CouponList{Coupons: coupons}, http.StatusOK)
+}
+
+// CreateCoupon adds a coupon
+func (app *application) CreateCoupon(w http.ResponseWriter, r *http.Request) {
+	var c models.Coupon
+	if err := app.readJSON(w, r, &c); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	if c.Duration == "" {
+		c.Duration = models.CouponOnce
+	}
+
+	v := validator.New()
+	if validateCoupon(v, c); v.Valid() && c.WidgetID != 0 {
+		if _, err := app.DB.GetWidget(c.WidgetID); errors.Is(err, sql.ErrNoRows) {
+			v.AddError("widget_id", "does not exist")
+		} else if err != nil {
+			app.errorJSON(w, r, err)
+			return
+		}
+	}
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	_, err := app.DB.InsertCoupon(c)
+	if errors.Is(err, models.ErrDuplicateCoupon) {
+		app.errorJSON(w, r, apierror.Validation(map[string]string{"code": "is already in use"}))
+		return
+	} else if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	off := fmt.Sprintf("%d%%", c.PercentOff)
+	if c.PercentOff == 0 {
+		off = money.New(int64(c.AmountOff), c.Currency).String()
+	}
+	resp := apispec.Response{
+		Message: "Coupon " + strings.ToUpper(c.Code) + " for " + off + " off created",
+	}
+	app.writeJSON(w, resp, http.StatusCreated)
+}
+
+// DeleteCoupon deletes a coupon
+func (app *application) DeleteCoupon(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if err := app.DB.DeleteCoupon(id); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
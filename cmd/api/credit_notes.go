@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-commerce/internal/ledger"
+	"go-commerce/internal/models"
+	"go-commerce/internal/tax"
+)
+
+// creditNoteRequest is what the invoice microservice needs to issue a credit note for a
+// refund of an invoiced order
+type creditNoteRequest struct {
+	OrderID        int        `json:"order_id"`
+	Reference      string     `json:"reference"`
+	Amount         int        `json:"amount"`
+	Reason         string     `json:"reason"`
+	Description    string     `json:"description,omitempty"`
+	FirstName      string     `json:"first_name"`
+	LastName       string     `json:"last_name"`
+	Email          string     `json:"email"`
+	BillingAddress []string   `json:"billing_address,omitempty"`
+	TaxID          string     `json:"tax_id,omitempty"`
+	TaxLines       []tax.Line `json:"tax_lines,omitempty"`
+}
+
+// sendCreditNote asks the invoice microservice to issue and email a credit note for
+// amount refunded of an order, identified by reference, the ID of the refund. The taxes
+// of the order are given back in proportion. The microservice is called with
+// authorization, the bearer token of the admin who refunded. It runs in the background
+// once the refund has gone through, so errors are only logged.
+func (app *application) sendCreditNote(authorization string, orderID, amount int, reference, reason, description string) {
+	order, err := app.DB.GetSaleByID(orderID)
+	if err != nil {
+		app.errorLog.Println(err)
+		return
+	}
+
+	data := creditNoteRequest{
+		OrderID:     order.ID,
+		Reference:   reference,
+		Amount:      amount,
+		Reason:      reason,
+		Description: description,
+		FirstName:   order.Customer.FirstName,
+		LastName:    order.Customer.LastName,
+		Email:       order.Customer.Email,
+		TaxID:       order.TaxID,
+	}
+	if order.BillingAddress != nil {
+		data.BillingAddress = order.BillingAddress.Lines()
+	}
+	for _, l := range order.TaxLines {
+		l.Taxable = ledger.RefundTax(amount, order.Amount, l.Taxable)
+		l.Amount = ledger.RefundTax(amount, order.Amount, l.Amount)
+		data.TaxLines = append(data.TaxLines, l)
+	}
+
+	out, err := json.Marshal(data)
+	if err != nil {
+		app.errorLog.Println(err)
+		return
+	}
+	url := strings.TrimSuffix(app.config.invoiceService, "/") + "/credit-notes"
+	req, err := http.NewRequest("POST", url, bytes.NewReader(out))
+	if err != nil {
+		app.errorLog.Println(err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", authorization)
+
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		app.errorLog.Printf("could not issue a credit note for refund %s of order %d: %v", reference, order.ID, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		app.errorLog.Printf("could not issue a credit note for refund %s of order %d: %s: %s",
+			reference, order.ID, resp.Status, bytes.TrimSpace(body))
+		return
+	}
+	app.infoLog.Printf("credit note for refund %s of order %d: %s", reference, order.ID, bytes.TrimSpace(body))
+}
+
+// returnedItems describes the items of a return for its credit note, like "2 x Widget"
+func returnedItems(ret models.Return) string {
+	var items []string
+	for _, it := range ret.Items {
+		items = append(items, fmt.Sprintf("%d x %s", it.Quantity, it.WidgetName))
+	}
+	if len(items) == 0 {
+		return ""
+	}
+	return "Returned " + strings.Join(items, ", ")
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-commerce/internal/models"
+)
+
+func TestSendCreditNote(t *testing.T) {
+	var got creditNoteRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/credit-notes" {
+			t.Errorf("got request for %s", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer "+testToken {
+			t.Errorf("called with authorization %q, want the admin's token", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	app, db := newDBApp(t)
+	app.config.invoiceService = srv.URL + "/"
+	expectSale(db, models.OrderCleared, models.TransactionCleared,
+		[]interface{}{"GB", "VAT", "0.2", true, 833, 167},
+		[]interface{}{"GB-LND", "Levy", "0.01", false, 833, 8},
+	)
+
+	app.sendCreditNote("Bearer "+testToken, 5, 250, "re_1", "Return", "Returned 1 x Widget")
+
+	if got.OrderID != 5 || got.Reference != "re_1" || got.Amount != 250 || got.Email != "ada@example.com" {
+		t.Errorf("got %+v", got)
+	}
+	// a quarter of the order is refunded, so a quarter of each tax is given back
+	if len(got.TaxLines) != 2 || got.TaxLines[0].Taxable != 208 || got.TaxLines[0].Amount != 41 || got.TaxLines[1].Amount != 2 {
+		t.Errorf("got tax lines %+v", got.TaxLines)
+	}
+}
+
+func TestReturnedItems(t *testing.T) {
+	if got := returnedItems(models.Return{}); got != "" {
+		t.Errorf("got %q for a return without items", got)
+	}
+	ret := models.Return{Items: []*models.ReturnItem{{WidgetName: "Widget", Quantity: 2}, {WidgetName: "Gadget", Quantity: 1}}}
+	if got, want := returnedItems(ret), "Returned 2 x Widget, 1 x Gadget"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
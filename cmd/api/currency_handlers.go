@@ -0,0 +1,169 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"go-commerce/internal/apierror"
+	"go-commerce/internal/apispec"
+	"go-commerce/internal/models"
+	"go-commerce/internal/money"
+	"go-commerce/internal/validator"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ListCurrencies returns the currencies widgets can be priced in, with their minor units
+func (app *application) ListCurrencies(w http.ResponseWriter, r *http.Request) {
+	var currencies []apispec.Currency
+	for _, code := range money.Codes() {
+		c, _ := money.Lookup(code)
+		currencies = append(currencies, apispec.Currency{Code: code, Exponent: c.Exponent, Symbol: c.Symbol})
+	}
+
+	resp := apispec.CurrencyList{Base: app.config.baseCurrency, Currencies: currencies}
+	app.writeJSON(w, resp, http.StatusOK)
+}
+
+// readCurrencyParam reads the {currency} URL parameter as a lower case ISO 4217 code
+func (app *application) readCurrencyParam(r *http.Request) (string, error) {
+	currency := strings.ToLower(chi.URLParam(r, "currency"))
+	if !money.Known(currency) {
+		return "", apierror.BadRequest("invalid currency parameter")
+	}
+	return currency, nil
+}
+
+// SetWidgetPrice sets the price of a widget in the currency named in the URL
+func (app *application) SetWidgetPrice(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	currency, err := app.readCurrencyParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	var payload apispec.WidgetPrice
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.CheckInt("amount", payload.Amount, validator.Positive)
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	if err := app.DB.SetWidgetPrice(id, currency, payload.Amount); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	resp := apispec.Response{
+		Message: "price set to " + money.New(int64(payload.Amount), currency).String(),
+	}
+	app.writeJSON(w, resp, http.StatusOK)
+}
+
+// DeleteWidgetPrice stops selling a widget in the currency named in the URL
+func (app *application) DeleteWidgetPrice(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	currency, err := app.readCurrencyParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if err := app.DB.DeleteWidgetPrice(id, currency); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListFXRates returns the exchange rates into the base currency, or into the currency
+// given by the base query parameter
+func (app *application) ListFXRates(w http.ResponseWriter, r *http.Request) {
+	base := strings.ToLower(r.URL.Query().Get("base"))
+	if base == "" {
+		base = app.config.baseCurrency
+	}
+
+	v := validator.New()
+	v.Check("base", base, validator.Currency)
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	rates, err := app.DB.GetFXRates(base)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, apispec.FXRateList{Base: base, Rates: rates}, http.StatusOK)
+}
+
+// CreateFXRate stores an exchange rate. The base currency defaults to the configured one.
+func (app *application) CreateFXRate(w http.ResponseWriter, r *http.Request) {
+	var rate models.FXRate
+	if err := app.readJSON(w, r, &rate); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	if rate.BaseCurrency == "" {
+		rate.BaseCurrency = app.config.baseCurrency
+	}
+	rate.BaseCurrency = strings.ToLower(rate.BaseCurrency)
+	rate.Currency = strings.ToLower(rate.Currency)
+
+	v := validator.New()
+	v.Check("base_currency", rate.BaseCurrency, validator.Currency)
+	v.Check("currency", rate.Currency, validator.Required, validator.Currency)
+	if rate.Currency == rate.BaseCurrency {
+		v.AddError("currency", "must differ from the base currency")
+	}
+	v.Check("rate", rate.Rate, validator.Required)
+	if rate.Rate != "" {
+		parsed, err := money.ParseRate(rate.Rate)
+		if err != nil {
+			v.AddError("rate", "must be a positive decimal number")
+		} else {
+			rate.Rate = parsed.String()
+		}
+	}
+	v.Check("effective_on", rate.EffectiveOn, validator.Required)
+	if rate.EffectiveOn != "" {
+		if _, err := time.Parse("2006-01-02", rate.EffectiveOn); err != nil {
+			v.AddError("effective_on", "must be a date in the format YYYY-MM-DD")
+		}
+	}
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	if err := app.DB.SaveFXRate(rate); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	resp := apispec.Response{
+		Message: "1 " + strings.ToUpper(rate.Currency) + " = " + rate.Rate + " " + strings.ToUpper(rate.BaseCurrency) +
+			" from " + rate.EffectiveOn,
+	}
+	app.writeJSON(w, resp, http.StatusCreated)
+}
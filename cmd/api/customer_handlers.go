@@ -0,0 +1,385 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-commerce/internal/apierror"
+	"go-commerce/internal/apispec"
+	"go-commerce/internal/models"
+	"go-commerce/internal/payment"
+	"go-commerce/internal/validator"
+
+	"github.com/stripe/stripe-go/v72"
+)
+
+// maxCustomerResults is the most customers a search returns
+const maxCustomerResults = 20
+
+// ListCustomers searches customers by the q query parameter
+func (app *application) ListCustomers(w http.ResponseWriter, r *http.Request) {
+	customers, err := app.DB.SearchCustomers(r.URL.Query().Get("q"), maxCustomerResults)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, apispec.CustomerList{Customers: customers}, http.StatusOK)
+}
+
+// CreateCustomer creates a customer for the virtual terminal
+func (app *application) CreateCustomer(w http.ResponseWriter, r *http.Request) {
+	var payload apispec.NewCustomer
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check("first_name", payload.FirstName, validator.MaxLength(255))
+	v.Check("last_name", payload.LastName, validator.MaxLength(255))
+	v.Check("email", payload.Email, validator.Required, validator.Email)
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	id, err := app.SaveCustomer(strings.TrimSpace(payload.FirstName), strings.TrimSpace(payload.LastName), strings.TrimSpace(payload.Email))
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	customer, err := app.DB.GetCustomer(id)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, customer, http.StatusCreated)
+}
+
+// GetCustomer returns the customer identified in the URL with their saved cards
+func (app *application) GetCustomer(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	customer, err := app.DB.GetCustomer(id)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, customer, http.StatusOK)
+}
+
+// CreateSetupIntent starts collecting a card of the customer identified in the URL. The
+// customer is created with Stripe the first time one of their cards is saved.
+func (app *application) CreateSetupIntent(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	customer, err := app.DB.GetCustomer(id)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	payConf := app.payConfig()
+	if customer.StripeCustomerID == "" {
+		sc, err := payConf.NewCustomer(strings.TrimSpace(customer.FirstName+" "+customer.LastName), customer.Email)
+		if err != nil {
+			app.errorJSON(w, r, apierror.Gateway("could not create customer", err))
+			return
+		}
+		if err := app.DB.SetStripeCustomerID(customer.ID, sc.ID); err != nil {
+			app.errorJSON(w, r, err)
+			return
+		}
+		customer.StripeCustomerID = sc.ID
+	}
+
+	si, err := payConf.CreateSetupIntent(customer.StripeCustomerID)
+	if err != nil {
+		app.errorJSON(w, r, apierror.Gateway("could not create setup intent", err))
+		return
+	}
+
+	app.writeJSON(w, apispec.SetupIntent{ID: si.ID, ClientSecret: si.ClientSecret}, http.StatusCreated)
+}
+
+// CreatePaymentMethod saves the card of a confirmed setup intent of the customer
+// identified in the URL
+func (app *application) CreatePaymentMethod(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	var payload apispec.PaymentMethodRequest
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check("setup_intent", payload.SetupIntentID, validator.Required); !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	customer, err := app.DB.GetCustomer(id)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	payConf := app.payConfig()
+	si, err := payConf.GetSetupIntent(payload.SetupIntentID)
+	if err != nil {
+		app.errorJSON(w, r, apierror.Gateway("could not retrieve setup intent", err))
+		return
+	}
+	if si.Customer == nil || si.Customer.ID != customer.StripeCustomerID {
+		app.errorJSON(w, r, apierror.Conflict("the setup intent is not for this customer"))
+		return
+	}
+	if si.Status != stripe.SetupIntentStatusSucceeded || si.PaymentMethod == nil || si.PaymentMethod.Card == nil {
+		app.errorJSON(w, r, apierror.Conflict("the card has not been confirmed yet"))
+		return
+	}
+
+	card := si.PaymentMethod.Card
+	pmID, err := app.DB.SavePaymentMethod(models.PaymentMethod{
+		CustomerID:            customer.ID,
+		StripePaymentMethodID: si.PaymentMethod.ID,
+		Brand:                 string(card.Brand),
+		LastFour:              card.Last4,
+		ExpiryMonth:           int(card.ExpMonth),
+		ExpiryYear:            int(card.ExpYear),
+	})
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	pm, err := app.DB.GetPaymentMethod(pmID)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, pm, http.StatusCreated)
+}
+
+// DeletePaymentMethod removes the saved card identified in the URL from its customer
+func (app *application) DeletePaymentMethod(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	pm, err := app.DB.GetPaymentMethod(id)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	payConf := app.payConfig()
+	if err := payConf.DetachPaymentMethod(pm.StripePaymentMethodID); err != nil {
+		app.errorJSON(w, r, apierror.Gateway("could not remove card", err))
+		return
+	}
+
+	if err := app.DB.DeletePaymentMethod(pm.ID); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateCustomerCharge charges a saved card of the customer identified in the URL while
+// they are not present, and records the payment as an order
+func (app *application) CreateCustomerCharge(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	var payload apispec.OffSessionCharge
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	payload.Currency = strings.ToLower(payload.Currency)
+	v := validator.New()
+	v.CheckInt("payment_method_id", payload.PaymentMethodID, validator.Positive)
+	v.CheckInt("amount", payload.Amount, validator.Positive)
+	v.Check("currency", payload.Currency, validator.Required, validator.Currency)
+	v.Check("note", payload.Note, validator.MaxLength(1024))
+	validateOrderItems(v, payload.Items, payload.Amount)
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	customer, err := app.DB.GetCustomer(id)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	pm, err := app.DB.GetPaymentMethod(payload.PaymentMethodID)
+	if err == nil && pm.CustomerID != customer.ID {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		app.errorJSON(w, r, apierror.From(err).WithMessage("the card is not saved for this customer"))
+		return
+	}
+
+	items, err := app.orderItems(payload.Items)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	payConf := app.payConfig()
+	payConf.Currency = payload.Currency
+	pi, msg, err := payConf.ChargeOffSession(customer.StripeCustomerID, pm.StripePaymentMethodID, payload.Amount)
+	if err != nil {
+		app.errorJSON(w, r, app.paymentError(msg, err))
+		return
+	}
+	if err := payment.CheckPaymentIntent(pi); err != nil {
+		app.errorJSON(w, r, app.paymentIntentError(err))
+		return
+	}
+
+	resp := apispec.TerminalPayment{
+		FirstName:       customer.FirstName,
+		LastName:        customer.LastName,
+		Email:           customer.Email,
+		CustomerID:      customer.ID,
+		PaymentIntentID: pi.ID,
+		PaymentMethodID: pm.StripePaymentMethodID,
+		Amount:          payload.Amount,
+		Currency:        payload.Currency,
+		Items:           payload.Items,
+		Note:            payload.Note,
+		LastFour:        pm.LastFour,
+		ExpiryMonth:     pm.ExpiryMonth,
+		ExpiryYear:      pm.ExpiryYear,
+		BankReturnCode:  payment.ChargeID(pi),
+		Status:          string(pi.Status),
+	}
+
+	resp.OrderID, err = app.saveTerminalOrder(resp, items)
+	if err != nil {
+		app.errorJSON(w, r, apierror.Internal(err).WithMessage("card has been charged but the order could not be saved"))
+		return
+	}
+
+	app.writeJSON(w, resp, http.StatusCreated)
+}
+
+// orderItems turns the items of a terminal order into order items. Items of a widget
+// are described by the widget name unless they have a description.
+func (app *application) orderItems(items []apispec.OrderItemRequest) ([]models.OrderItem, error) {
+	var out []models.OrderItem
+	for i, it := range items {
+		description := strings.TrimSpace(it.Description)
+		if it.WidgetID != 0 && description == "" {
+			widget, err := app.DB.GetWidget(it.WidgetID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, apierror.Validation(map[string]string{fmt.Sprintf("items.%d.widget_id", i): "does not exist"})
+			}
+			if err != nil {
+				return nil, err
+			}
+			description = widget.Name
+		}
+		out = append(out, models.OrderItem{
+			WidgetID:    it.WidgetID,
+			Description: description,
+			Quantity:    it.Quantity,
+			UnitAmount:  it.UnitAmount,
+			Amount:      it.Quantity * it.UnitAmount,
+		})
+	}
+	return out, nil
+}
+
+// saveTerminalOrder records a terminal payment as an order of p.CustomerID and returns
+// the order ID. The order is pending unless the payment succeeded, and has a quantity
+// of one unless it has items.
+func (app *application) saveTerminalOrder(p apispec.TerminalPayment, items []models.OrderItem) (int, error) {
+	transactionStatus, orderStatus := models.TransactionPending, models.OrderPending
+	if p.Status == string(stripe.PaymentIntentStatusSucceeded) {
+		transactionStatus, orderStatus = models.TransactionCleared, models.OrderCleared
+	}
+
+	txnID, err := app.SaveTransaction(models.Transaction{
+		Amount:              p.Amount,
+		Currency:            p.Currency,
+		LastFour:            p.LastFour,
+		BankReturnCode:      p.BankReturnCode,
+		PaymentIntent:       p.PaymentIntentID,
+		PaymentMethod:       p.PaymentMethodID,
+		CardExpiryMonth:     p.ExpiryMonth,
+		CardExpiryYear:      p.ExpiryYear,
+		TransactionStatusID: transactionStatus,
+		CreatedAt:           time.Now(),
+		UpdatedAt:           time.Now(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	order := models.Order{
+		CustomerID:    p.CustomerID,
+		TransactionID: txnID,
+		StatusID:      orderStatus,
+		Amount:        p.Amount,
+		Note:          strings.TrimSpace(p.Note),
+		Items:         items,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	for _, it := range items {
+		order.Quantity += it.Quantity
+	}
+	if order.Quantity == 0 {
+		order.Quantity = 1
+	}
+
+	return app.SaveOrder(order)
+}
+
+// terminalCustomer returns the customer a terminal payment is for, creating one from the
+// name and email of the payment when it names no customer
+func (app *application) terminalCustomer(p apispec.TerminalPayment) (models.Customer, error) {
+	if p.CustomerID != 0 {
+		return app.DB.GetCustomer(p.CustomerID)
+	}
+
+	id, err := app.SaveCustomer(strings.TrimSpace(p.FirstName), strings.TrimSpace(p.LastName), strings.TrimSpace(p.Email))
+	if err != nil {
+		return models.Customer{}, err
+	}
+	return app.DB.GetCustomer(id)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go-commerce/internal/apispec"
+	"go-commerce/internal/dbtest"
+	"go-commerce/internal/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// withID adds the {id} URL parameter to r, as the router would
+func withID(r *http.Request, id int) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", fmt.Sprint(id))
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+// expectCustomer makes the next statements find customer 4, linked to cus_4, with no cards
+func expectCustomer(db *dbtest.DB) {
+	now := time.Now()
+	db.Expect("from customers where id = ?").WithArgs(4).Rows([]interface{}{4, "Ada", "Lovelace", "ada@example.com", "cus_4", now, now})
+	db.Expect("from payment_methods where customer_id = ?").WithArgs(4).NoRows()
+}
+
+func setupIntentJSON(customer, status string) string {
+	return fmt.Sprintf(`{"id": "seti_1", "object": "setup_intent", "customer": %q, "status": %q,
+		"payment_method": {"id": "pm_1", "object": "payment_method",
+			"card": {"brand": "visa", "last4": "4242", "exp_month": 12, "exp_year": 2030}}}`, customer, status)
+}
+
+func TestCreatePaymentMethod(t *testing.T) {
+	fakeStripe(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/setup_intents/seti_1" {
+			t.Errorf("got request for %s", r.URL.Path)
+		}
+		fmt.Fprint(w, setupIntentJSON("cus_4", "succeeded"))
+	})
+	app, db := newDBApp(t)
+	expectCustomer(db)
+	save := db.Expect("insert into payment_methods").Result(9, 1)
+	now := time.Now()
+	db.Expect("from payment_methods where id = ?").WithArgs(9).Rows([]interface{}{9, 4, "pm_1", "visa", "4242", 12, 2030, now, now})
+
+	req := withID(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"setup_intent": "seti_1"}`)), 4)
+	rec := httptest.NewRecorder()
+	app.CreatePaymentMethod(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	want := []interface{}{int64(4), "pm_1", "visa", "4242", int64(12), int64(2030)}
+	if !reflect.DeepEqual(save.Args[:6], want) {
+		t.Errorf("saved %v, want %v", save.Args[:6], want)
+	}
+}
+
+func TestCreatePaymentMethodChecksSetupIntent(t *testing.T) {
+	tests := []struct {
+		customer, status, message string
+	}{
+		{"cus_other", "succeeded", "the setup intent is not for this customer"},
+		{"cus_4", "requires_action", "the card has not been confirmed yet"},
+	}
+	for _, tt := range tests {
+		fakeStripe(t, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, setupIntentJSON(tt.customer, tt.status))
+		})
+		app, db := newDBApp(t)
+		expectCustomer(db)
+
+		req := withID(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"setup_intent": "seti_1"}`)), 4)
+		rec := httptest.NewRecorder()
+		app.CreatePaymentMethod(rec, req)
+
+		if rec.Code != http.StatusConflict {
+			t.Errorf("%s: got status %d", tt.message, rec.Code)
+		}
+		if e := decodeError(t, rec); e.Error.Message != tt.message {
+			t.Errorf("got %q, want %q", e.Error.Message, tt.message)
+		}
+	}
+}
+
+func TestCreateCustomerChargeNeedsOwnCard(t *testing.T) {
+	fakeStripe(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("charged the card of another customer: %s", r.URL.Path)
+	})
+	app, db := newDBApp(t)
+	expectCustomer(db)
+	now := time.Now()
+	db.Expect("from payment_methods where id = ?").WithArgs(9).Rows([]interface{}{9, 5, "pm_1", "visa", "4242", 12, 2030, now, now})
+
+	req := withID(httptest.NewRequest(http.MethodPost, "/",
+		strings.NewReader(`{"payment_method_id": 9, "amount": 1000, "currency": "usd"}`)), 4)
+	rec := httptest.NewRecorder()
+	app.CreateCustomerCharge(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	if e := decodeError(t, rec); e.Error.Message != "the card is not saved for this customer" {
+		t.Errorf("got %+v", e)
+	}
+}
+
+func TestOrderItems(t *testing.T) {
+	app := newTestApp()
+	items, err := app.orderItems([]apispec.OrderItemRequest{
+		{Description: " Installation ", Quantity: 2, UnitAmount: 1500},
+		{WidgetID: 3, Description: "Widget, gift wrapped", Quantity: 1, UnitAmount: 999},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.OrderItem{
+		{Description: "Installation", Quantity: 2, UnitAmount: 1500, Amount: 3000},
+		{WidgetID: 3, Description: "Widget, gift wrapped", Quantity: 1, UnitAmount: 999, Amount: 999},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("got %+v", items)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-commerce/internal/apierror"
+	"go-commerce/internal/apispec"
+	"go-commerce/internal/models"
+	"go-commerce/internal/payment"
+	"go-commerce/internal/validator"
+
+	"github.com/stripe/stripe-go/v72"
+)
+
+const (
+	// maxDisputeFile is the largest evidence file accepted, in bytes
+	maxDisputeFile = 4 << 20
+	// maxEvidenceText is the longest evidence text Stripe takes in a field
+	maxEvidenceText = 20000
+)
+
+// disputeFilePurposes are the evidence fields a file can be sent as
+var disputeFilePurposes = []string{
+	payment.EvidenceReceipt,
+	payment.EvidenceShippingDocumentation,
+	payment.EvidenceCustomerCommunication,
+	payment.EvidenceUncategorizedFile,
+}
+
+// payConfig returns the payment config of the API
+func (app *application) payConfig() payment.Config {
+	return payment.Config{
+		Secret: app.config.stripe.secret,
+		Key:    app.config.stripe.key,
+	}
+}
+
+// syncDispute creates or updates the dispute of a charge.dispute.* webhook event
+func (app *application) syncDispute(event stripe.Event) (string, error) {
+	var sd stripe.Dispute
+	if err := json.Unmarshal(event.Data.Raw, &sd); err != nil {
+		return "", apierror.BadRequest("the event does not hold a dispute")
+	}
+
+	if _, err := app.DB.SaveDispute(disputeFromStripe(&sd)); err != nil {
+		return "", err
+	}
+	app.infoLog.Printf("dispute %s is %s", sd.ID, sd.Status)
+
+	return "dispute synced", nil
+}
+
+// disputeFromStripe converts a Stripe dispute
+func disputeFromStripe(sd *stripe.Dispute) models.Dispute {
+	d := models.Dispute{
+		StripeDisputeID: sd.ID,
+		Amount:          int(sd.Amount),
+		Currency:        string(sd.Currency),
+		Reason:          string(sd.Reason),
+		Status:          string(sd.Status),
+		OpenedAt:        time.Unix(sd.Created, 0),
+	}
+	if sd.PaymentIntent != nil {
+		d.PaymentIntent = sd.PaymentIntent.ID
+	}
+	if sd.Charge != nil {
+		d.ChargeID = sd.Charge.ID
+	}
+	if sd.EvidenceDetails != nil && sd.EvidenceDetails.DueBy > 0 {
+		dueBy := time.Unix(sd.EvidenceDetails.DueBy, 0)
+		d.EvidenceDueBy = &dueBy
+	}
+	return d
+}
+
+// ListDisputes returns the disputes, optionally in one status
+func (app *application) ListDisputes(w http.ResponseWriter, r *http.Request) {
+	disputes, err := app.DB.GetDisputes(strings.ToLower(r.URL.Query().Get("status")))
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, apispec.DisputeList{Disputes: disputes}, http.StatusOK)
+}
+
+// GetDispute returns the dispute identified in the URL
+func (app *application) GetDispute(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	dispute, err := app.DB.GetDispute(id)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, dispute, http.StatusOK)
+}
+
+// openDispute returns the dispute identified in the URL if it still takes evidence
+func (app *application) openDispute(r *http.Request) (models.Dispute, error) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		return models.Dispute{}, err
+	}
+
+	dispute, err := app.DB.GetDispute(id)
+	if err != nil {
+		return dispute, err
+	}
+	if !dispute.NeedsResponse() {
+		return dispute, apierror.Conflict("this dispute no longer takes evidence")
+	}
+	return dispute, nil
+}
+
+// UpdateDisputeEvidence saves the evidence text of the dispute identified in the URL
+func (app *application) UpdateDisputeEvidence(w http.ResponseWriter, r *http.Request) {
+	dispute, err := app.openDispute(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	var payload apispec.DisputeEvidenceRequest
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check("product_description", payload.ProductDescription, validator.MaxLength(maxEvidenceText))
+	v.Check("uncategorized_text", payload.UncategorizedText, validator.MaxLength(maxEvidenceText))
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	err = app.DB.UpdateDisputeEvidence(dispute.ID, strings.TrimSpace(payload.ProductDescription), strings.TrimSpace(payload.UncategorizedText))
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	dispute, err = app.DB.GetDispute(dispute.ID)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, dispute, http.StatusOK)
+}
+
+// CreateDisputeFile uploads a file to Stripe as evidence for the dispute identified in
+// the URL
+func (app *application) CreateDisputeFile(w http.ResponseWriter, r *http.Request) {
+	dispute, err := app.openDispute(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	var payload apispec.DisputeFileUpload
+	// base64 takes four bytes for every three of the file
+	if err := app.readJSONLimit(w, r, &payload, maxDisputeFile/3*4+4096); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check("purpose", payload.Purpose, validator.Required, validator.In(disputeFilePurposes...))
+	v.Check("filename", payload.Filename, validator.Required, validator.MaxLength(255))
+	if len(payload.Content) == 0 {
+		v.AddError("content", "must be provided")
+	} else if len(payload.Content) > maxDisputeFile {
+		v.AddError("content", "must not be larger than 4MB")
+	}
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	payConf := app.payConfig()
+	uploaded, err := payConf.UploadDisputeFile(payload.Filename, bytes.NewReader(payload.Content))
+	if err != nil {
+		app.errorJSON(w, r, apierror.Gateway("could not upload file", err))
+		return
+	}
+
+	f := models.DisputeFile{
+		DisputeID:    dispute.ID,
+		Purpose:      payload.Purpose,
+		Filename:     payload.Filename,
+		Size:         len(payload.Content),
+		StripeFileID: uploaded.ID,
+		CreatedAt:    time.Now(),
+	}
+	f.ID, err = app.DB.SaveDisputeFile(f)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, f, http.StatusCreated)
+}
+
+// CreateDisputeSubmission submits the evidence of the dispute identified in the URL,
+// with the customer and the shipment of the disputed sale
+func (app *application) CreateDisputeSubmission(w http.ResponseWriter, r *http.Request) {
+	dispute, err := app.openDispute(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if dispute.ProductDescription == "" && dispute.UncategorizedText == "" && len(dispute.Files) == 0 {
+		app.errorJSON(w, r, apierror.Conflict("add evidence text or files before submitting"))
+		return
+	}
+
+	evidence := payment.DisputeEvidence{
+		ProductDescription: dispute.ProductDescription,
+		UncategorizedText:  dispute.UncategorizedText,
+		Files:              make(map[string]string),
+	}
+	for _, f := range dispute.Files {
+		evidence.Files[f.Purpose] = f.StripeFileID
+	}
+	if dispute.OrderID != 0 {
+		order, err := app.DB.GetSaleByID(dispute.OrderID)
+		if err != nil {
+			app.errorJSON(w, r, err)
+			return
+		}
+		evidence.CustomerName = strings.TrimSpace(order.Customer.FirstName + " " + order.Customer.LastName)
+		evidence.CustomerEmailAddress = order.Customer.Email
+		evidence.ShippingCarrier = order.Carrier
+		evidence.ShippingTrackingNumber = order.TrackingNumber
+	}
+
+	payConf := app.payConfig()
+	sd, err := payConf.SubmitDisputeEvidence(dispute.StripeDisputeID, evidence)
+	if err != nil {
+		app.errorJSON(w, r, apierror.Gateway("could not submit evidence", err))
+		return
+	}
+
+	if err := app.DB.MarkDisputeSubmitted(dispute.ID, string(sd.Status)); err != nil {
+		app.errorJSON(w, r, apierror.Internal(err).WithMessage("evidence has been submitted but could not update in database"))
+		return
+	}
+
+	dispute, err = app.DB.GetDispute(dispute.ID)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, dispute, http.StatusCreated)
+}
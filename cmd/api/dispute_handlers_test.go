@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v72"
+)
+
+func TestCreateStripeEventSyncsDisputes(t *testing.T) {
+	app, db := newDBApp(t)
+	app.config.stripe.webhookSecret = testWebhookSecret
+
+	db.Expect("where (t.payment_intent = ?").WithArgs("pi_1", "ch_1").Rows([]interface{}{3, 5})
+	save := db.Expect("insert into disputes").Result(1, 1)
+
+	rec := httptest.NewRecorder()
+	app.CreateStripeEvent(rec, stripeEvent(t, "charge.dispute.created", map[string]interface{}{
+		"id":               "dp_1",
+		"object":           "dispute",
+		"amount":           1500,
+		"currency":         "eur",
+		"reason":           "fraudulent",
+		"status":           "needs_response",
+		"created":          1760000000,
+		"payment_intent":   "pi_1",
+		"charge":           "ch_1",
+		"evidence_details": map[string]interface{}{"due_by": 1760600000},
+	}))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	want := []interface{}{"dp_1", "pi_1", int64(3), int64(5), int64(1500), "eur", "fraudulent", "needs_response"}
+	for i, arg := range want {
+		if save.Args[i] != arg {
+			t.Errorf("saved %v, want %v first", save.Args, want)
+			break
+		}
+	}
+	if dueBy, _ := save.Args[8].(time.Time); dueBy.Unix() != 1760600000 {
+		t.Errorf("saved evidence due by %v", save.Args[8])
+	}
+}
+
+func TestDisputeFromStripe(t *testing.T) {
+	d := disputeFromStripe(&stripe.Dispute{ID: "dp_2", Amount: 900, Currency: "usd", Status: "warning_needs_response"})
+	if d.PaymentIntent != "" || d.EvidenceDueBy != nil || d.Amount != 900 || d.Status != "warning_needs_response" {
+		t.Errorf("got %+v", d)
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-commerce/internal/apierror"
+	"go-commerce/internal/apispec"
+	"go-commerce/internal/encryption"
+	"go-commerce/internal/models"
+	"go-commerce/internal/money"
+	"go-commerce/internal/urlsigner"
+	"go-commerce/internal/validator"
+
+	"github.com/stripe/stripe-go/v72"
+)
+
+// parseSchedule parses a dunning schedule, the comma separated delays after a renewal
+// failed at which its invoice is retried, like "24h,72h,168h". The subscription is
+// cancelled when the last retry fails.
+func parseSchedule(s string) ([]time.Duration, error) {
+	var schedule []time.Duration
+	for _, part := range strings.Split(s, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		if d <= 0 || (len(schedule) > 0 && d <= schedule[len(schedule)-1]) {
+			return nil, fmt.Errorf("dunning schedule %q must be positive and increasing", s)
+		}
+		schedule = append(schedule, d)
+	}
+	return schedule, nil
+}
+
+// dunRenewal handles a renewal invoice of a subscription. An invoice that could not be
+// paid opens a dunning case and sends the first reminder; an invoice that was paid,
+// by a retry of the gateway or with a new card, recovers the subscription.
+func (app *application) dunRenewal(inv *stripe.Invoice, paid bool) (string, error) {
+	orderID, err := app.DB.GetSubscriptionOrderID(inv.Subscription.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "event ignored", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if paid {
+		c, err := app.DB.GetOpenDunningCase(orderID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "nothing to settle", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		err = app.DB.CloseDunning(orderID, models.DunningRecovered, models.SubscriptionEvent{
+			Kind:    models.EventPaymentRecovered,
+			Attempt: c.Attempt,
+			Note:    "invoice " + inv.ID + " paid",
+		})
+		if err != nil {
+			return "", err
+		}
+		return "subscription recovered", nil
+	}
+
+	next := time.Now().Add(app.config.dunningSchedule[0])
+	c := models.DunningCase{
+		OrderID:         orderID,
+		StripeInvoiceID: inv.ID,
+		AmountDue:       int(inv.AmountDue),
+		NextAttemptAt:   &next,
+	}
+	opened, err := app.DB.StartDunning(c)
+	if err != nil {
+		return "", err
+	}
+	if !opened {
+		return "dunning already started", nil
+	}
+
+	// the gateway waits for the webhook to answer; the mail server should not hold it up
+	go app.sendDunningEmail(orderID, c, false)
+
+	return "dunning started", nil
+}
+
+// runDunning retries every interval the unpaid renewal invoices whose next attempt is
+// due. A retry that pays the invoice recovers the subscription; a failed retry reminds
+// the customer, and cancels the subscription when it was the last in the schedule.
+func (app *application) runDunning(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cases, err := app.DB.GetDueDunningCases(time.Now())
+		if err != nil {
+			app.errorLog.Printf("checking dunning cases: %v", err)
+		}
+		for _, c := range cases {
+			if err := app.retryRenewal(c); err != nil {
+				app.errorLog.Printf("dunning case %d: %v", c.ID, err)
+			}
+		}
+
+		<-ticker.C
+	}
+}
+
+// retryRenewal makes the next attempt of a dunning case
+func (app *application) retryRenewal(c models.DunningCase) error {
+	attempt := c.Attempt + 1
+
+	payConf := app.payConfig()
+	inv, msg, err := payConf.RetryInvoice(c.StripeInvoiceID)
+	if err == nil && inv.Paid {
+		return app.DB.CloseDunning(c.OrderID, models.DunningRecovered, models.SubscriptionEvent{
+			Kind:    models.EventPaymentRecovered,
+			Attempt: attempt,
+			Note:    fmt.Sprintf("retry %d paid invoice %s", attempt, c.StripeInvoiceID),
+		})
+	}
+	reason := msg
+	switch {
+	case reason != "":
+	case err != nil:
+		reason = err.Error()
+	default:
+		reason = "the invoice is still unpaid"
+	}
+
+	if attempt >= len(app.config.dunningSchedule) {
+		order, err := app.DB.GetSubscriptionByID(c.OrderID)
+		if err != nil {
+			return err
+		}
+		if err := payConf.CancelSubscriptionNow(order.Transaction.PaymentIntent); err != nil {
+			// try again on the next run
+			return err
+		}
+		err = app.DB.CloseDunning(c.OrderID, models.DunningCancelled, models.SubscriptionEvent{
+			Kind:    models.EventCancelled,
+			Attempt: attempt,
+			Note:    "cancelled after the final retry failed: " + reason,
+		})
+		if err != nil {
+			return err
+		}
+		app.sendDunningEmail(c.OrderID, c, true)
+		return nil
+	}
+
+	c.Attempt = attempt
+	next := c.CreatedAt.Add(app.config.dunningSchedule[attempt])
+	c.NextAttemptAt = &next
+	err = app.DB.AdvanceDunning(c, models.SubscriptionEvent{
+		OrderID: c.OrderID,
+		Kind:    models.EventRetryFailed,
+		Attempt: attempt,
+		Note:    reason,
+	})
+	if err != nil {
+		return err
+	}
+	app.sendDunningEmail(c.OrderID, c, false)
+	return nil
+}
+
+// sendDunningEmail emails the customer of a past due subscription a reminder with a
+// signed link to update their card or, once it is cancelled, that it was cancelled.
+// Sent reminders are recorded on the timeline of the subscription; errors are only logged.
+func (app *application) sendDunningEmail(orderID int, c models.DunningCase, cancelled bool) {
+	order, err := app.DB.GetSubscriptionByID(orderID)
+	if err != nil {
+		app.errorLog.Println(err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/update-card?subscription=%d", app.config.frontend, order.ID)
+	signer := urlsigner.NewSigner([]byte(app.config.secretKey))
+
+	data := struct {
+		Order     models.Order
+		AmountDue string
+		NextRetry *time.Time
+		Link      string
+	}{order, money.New(int64(c.AmountDue), order.Transaction.Currency).String(), c.NextAttemptAt, signer.GenerateTokenFromString(link)}
+
+	tmpl, subject := "dunning_reminder", "Your payment for "+order.Widget.Name+" failed"
+	if cancelled {
+		tmpl, subject = "dunning_cancelled", "Your subscription to "+order.Widget.Name+" has been cancelled"
+	}
+
+	// SendMail logs its own errors
+	if err := app.SendMail("info@widgets.com", order.Customer.Email, subject, tmpl, data); err != nil {
+		return
+	}
+	if cancelled {
+		return
+	}
+
+	err = app.DB.AddSubscriptionEvent(models.SubscriptionEvent{
+		OrderID: order.ID,
+		Kind:    models.EventReminderSent,
+		Attempt: c.Attempt,
+		Note:    "reminder emailed to " + order.Customer.Email,
+	})
+	if err != nil {
+		app.errorLog.Println(err)
+	}
+}
+
+// ListSubscriptionEvents returns the timeline of the subscription identified in the URL
+// and its open dunning case, if any
+func (app *application) ListSubscriptionEvents(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if _, err := app.DB.GetSubscriptionByID(id); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	events, err := app.DB.GetSubscriptionEvents(id)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	resp := apispec.SubscriptionEventList{Events: events}
+	c, err := app.DB.GetOpenDunningCase(id)
+	switch {
+	case err == nil:
+		resp.Dunning = &c
+	case !errors.Is(err, sql.ErrNoRows):
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, resp, http.StatusOK)
+}
+
+// tokenSubscription gets the subscription of the encrypted token of a page the web app
+// only hands out from a signed link, like the card update page. page names the page in
+// errors.
+func (app *application) tokenSubscription(token, page string) (models.Order, error) {
+	encryptor := encryption.NewEncryptor([]byte(app.config.secretKey))
+	plain, err := encryptor.Decrypt(token)
+	if err != nil {
+		return models.Order{}, apierror.BadRequest("invalid " + page + " link")
+	}
+	id, err := strconv.Atoi(plain)
+	if err != nil {
+		return models.Order{}, apierror.BadRequest("invalid " + page + " link")
+	}
+
+	return app.DB.GetSubscriptionByID(id)
+}
+
+// cardUpdateSubscription gets the subscription of the encrypted token of a card update
+// page, which must not have been cancelled
+func (app *application) cardUpdateSubscription(token string) (models.Order, error) {
+	order, err := app.tokenSubscription(token, "card update")
+	if err != nil {
+		return order, err
+	}
+	if order.StatusID == models.OrderCancelled {
+		return order, apierror.Conflict("the subscription has been cancelled")
+	}
+	return order, nil
+}
+
+// CreateSubscriptionCardSetup starts collecting a new card for a subscription from its
+// card update page
+func (app *application) CreateSubscriptionCardSetup(w http.ResponseWriter, r *http.Request) {
+	var payload apispec.CardUpdateRequest
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check("token", payload.Token, validator.Required); !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	order, err := app.cardUpdateSubscription(payload.Token)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	payConf := app.payConfig()
+	s, err := payConf.GetSubscription(order.Transaction.PaymentIntent)
+	if err != nil {
+		app.errorJSON(w, r, apierror.Gateway("could not retrieve subscription", err))
+		return
+	}
+	si, err := payConf.CreateSetupIntent(s.Customer.ID)
+	if err != nil {
+		app.errorJSON(w, r, apierror.Gateway("could not create setup intent", err))
+		return
+	}
+
+	app.writeJSON(w, apispec.SetupIntent{ID: si.ID, ClientSecret: si.ClientSecret}, http.StatusCreated)
+}
+
+// CreateSubscriptionCard makes the card of a confirmed setup intent the card of a
+// subscription. A past due subscription is retried with it straight away.
+func (app *application) CreateSubscriptionCard(w http.ResponseWriter, r *http.Request) {
+	var payload apispec.CardUpdateRequest
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check("token", payload.Token, validator.Required)
+	v.Check("setup_intent", payload.SetupIntentID, validator.Required)
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	order, err := app.cardUpdateSubscription(payload.Token)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	payConf := app.payConfig()
+	s, err := payConf.GetSubscription(order.Transaction.PaymentIntent)
+	if err != nil {
+		app.errorJSON(w, r, apierror.Gateway("could not retrieve subscription", err))
+		return
+	}
+	si, err := payConf.GetSetupIntent(payload.SetupIntentID)
+	if err != nil {
+		app.errorJSON(w, r, apierror.Gateway("could not retrieve setup intent", err))
+		return
+	}
+	if si.Customer == nil || si.Customer.ID != s.Customer.ID {
+		app.errorJSON(w, r, apierror.Conflict("the setup intent is not for this subscription"))
+		return
+	}
+	if si.Status != stripe.SetupIntentStatusSucceeded || si.PaymentMethod == nil || si.PaymentMethod.Card == nil {
+		app.errorJSON(w, r, apierror.Conflict("the card has not been confirmed yet"))
+		return
+	}
+
+	if err := payConf.SetSubscriptionCard(s.ID, s.Customer.ID, si.PaymentMethod.ID); err != nil {
+		app.errorJSON(w, r, apierror.Gateway("could not update the card of the subscription", err))
+		return
+	}
+	card := si.PaymentMethod.Card
+	err = app.DB.AddSubscriptionEvent(models.SubscriptionEvent{
+		OrderID: order.ID,
+		Kind:    models.EventCardUpdated,
+		Note:    fmt.Sprintf("%s ending in %s", card.Brand, card.Last4),
+	})
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	resp := apispec.Response{Message: "Your card has been updated"}
+	if order.StatusID != models.OrderPastDue {
+		app.writeJSON(w, resp, http.StatusCreated)
+		return
+	}
+
+	c, err := app.DB.GetOpenDunningCase(order.ID)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	inv, msg, err := payConf.RetryInvoice(c.StripeInvoiceID)
+	if err != nil {
+		app.errorJSON(w, r, app.paymentError(msg, err))
+		return
+	}
+	// an invoice still unpaid, like one whose payment is processing, stays dunned until
+	// its invoice.paid event or the next retry
+	if !inv.Paid {
+		resp.Message = "Your card has been updated, but your payment has not gone through yet"
+		app.writeJSON(w, resp, http.StatusCreated)
+		return
+	}
+	err = app.DB.CloseDunning(order.ID, models.DunningRecovered, models.SubscriptionEvent{
+		Kind:    models.EventPaymentRecovered,
+		Attempt: c.Attempt,
+		Note:    "invoice " + c.StripeInvoiceID + " paid with the new card",
+	})
+	if err != nil {
+		app.errorJSON(w, r, apierror.Internal(err).WithMessage("the invoice has been paid but could not update in database"))
+		return
+	}
+
+	resp.Message = "Your card has been updated and your payment has gone through"
+	app.writeJSON(w, resp, http.StatusCreated)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go-commerce/internal/dbtest"
+	"go-commerce/internal/encryption"
+	"go-commerce/internal/models"
+)
+
+func TestParseSchedule(t *testing.T) {
+	got, err := parseSchedule("72h, 120h,168h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Duration{72 * time.Hour, 120 * time.Hour, 168 * time.Hour}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, s := range []string{"", "72h,24h", "72h,72h", "0s", "-1h", "three days"} {
+		if _, err := parseSchedule(s); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+}
+
+func TestCreateSubscriptionCardRetriesInvoice(t *testing.T) {
+	tests := []struct {
+		paid    bool
+		message string
+	}{
+		{true, "Your card has been updated and your payment has gone through"},
+		{false, "Your card has been updated, but your payment has not gone through yet"},
+	}
+	for _, tt := range tests {
+		fakeStripe(t, func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v1/subscriptions/sub_7":
+				fmt.Fprint(w, `{"id": "sub_7", "object": "subscription", "customer": "cus_4"}`)
+			case "/v1/setup_intents/seti_1":
+				fmt.Fprint(w, setupIntentJSON("cus_4", "succeeded"))
+			case "/v1/customers/cus_4":
+				fmt.Fprint(w, `{"id": "cus_4", "object": "customer"}`)
+			case "/v1/invoices/in_2/pay":
+				fmt.Fprintf(w, `{"id": "in_2", "object": "invoice", "paid": %t}`, tt.paid)
+			default:
+				t.Errorf("got request for %s", r.URL.Path)
+			}
+		})
+		app, db := newDBApp(t)
+		app.config.secretKey = "abcdefghijklmnopqrstuvwxyz012345"
+		token, err := encryption.NewEncryptor([]byte(app.config.secretKey)).Encrypt("7")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expectSubscription(db, models.OrderPastDue, false)
+		db.Expect("insert into subscription_events").WithArgs(7, models.EventCardUpdated, 0, "visa ending in 4242", dbtest.Any, dbtest.Any)
+		now := time.Now()
+		db.Expect("from dunning_cases where order_id = ? and status = ?").WithArgs(7, models.DunningOpen).
+			Rows([]interface{}{2, 7, "in_2", 900, 1, now, models.DunningOpen, now, now})
+		if tt.paid {
+			db.Expect("update dunning_cases set status = ?").WithArgs(models.DunningRecovered, dbtest.Any, 7, models.DunningOpen)
+			db.Expect("update orders set status_id = ?").WithArgs(models.OrderCleared, dbtest.Any, 7)
+			db.Expect("insert into subscription_events").WithArgs(7, models.EventPaymentRecovered, 1, dbtest.Any, dbtest.Any, dbtest.Any)
+		}
+
+		body := fmt.Sprintf(`{"token": %q, "setup_intent": "seti_1"}`, token)
+		rec := httptest.NewRecorder()
+		app.CreateSubscriptionCard(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		if rec.Code != http.StatusCreated || !strings.Contains(rec.Body.String(), tt.message) {
+			t.Errorf("paid %v: got %d %s", tt.paid, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-commerce/internal/export"
+	"go-commerce/internal/models"
+	"go-commerce/internal/money"
+	"go-commerce/internal/validator"
+)
+
+var orderStatusNames = map[int]string{
+	models.OrderCleared:   "Cleared",
+	models.OrderRefunded:  "Refunded",
+	models.OrderCancelled: "Cancelled",
+}
+
+var orderExportHeader = []interface{}{
+	"Order ID", "Date", "Status", "Product", "Quantity", "Amount", "Currency",
+	"First Name", "Last Name", "Email", "Last Four", "Payment Intent",
+}
+
+var customerExportHeader = []interface{}{
+	"Customer ID", "First Name", "Last Name", "Email", "Created",
+}
+
+var invoiceExportHeader = []interface{}{
+	"Number", "Kind", "Issued", "Credits Invoice", "Order ID", "Legal Entity", "Email", "Amount", "Currency", "Reason",
+}
+
+var invoiceKindNames = map[string]string{
+	models.InvoiceKindInvoice:    "Invoice",
+	models.InvoiceKindCreditNote: "Credit note",
+}
+
+// orderIterator streams orders from the database, like models.DBWrapper.EachSale
+type orderIterator func(ctx context.Context, f models.OrderFilter, sort string, fn func(*models.Order) error) error
+
+// ExportSales streams the sales matching the list filters as CSV or XLSX
+func (app *application) ExportSales(w http.ResponseWriter, r *http.Request) {
+	app.exportOrders(w, r, "sales", app.DB.EachSale)
+}
+
+// ExportSubscriptions streams the subscriptions matching the list filters as CSV or XLSX
+func (app *application) ExportSubscriptions(w http.ResponseWriter, r *http.Request) {
+	app.exportOrders(w, r, "subscriptions", app.DB.EachSubscription)
+}
+
+// ExportRefunds streams the refunded sales matching the list filters as CSV or XLSX
+func (app *application) ExportRefunds(w http.ResponseWriter, r *http.Request) {
+	app.exportOrders(w, r, "refunds", app.DB.EachRefund)
+}
+
+func (app *application) exportOrders(w http.ResponseWriter, r *http.Request, name string, each orderIterator) {
+	v := validator.New()
+	format := app.readExportFormat(r, v)
+	filter := app.readOrderFilter(r, v)
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	app.streamExport(w, r, name, format, func(ew export.Writer) error {
+		if err := ew.Write(orderExportHeader); err != nil {
+			return err
+		}
+		return each(r.Context(), filter, r.URL.Query().Get("sort"), func(o *models.Order) error {
+			return ew.Write([]interface{}{
+				o.ID,
+				o.CreatedAt,
+				orderStatusNames[o.StatusID],
+				o.Widget.Name,
+				o.Quantity,
+				money.New(int64(o.Amount), o.Transaction.Currency).Float64(),
+				strings.ToUpper(o.Transaction.Currency),
+				o.Customer.FirstName,
+				o.Customer.LastName,
+				o.Customer.Email,
+				o.Transaction.LastFour,
+				o.Transaction.PaymentIntent,
+			})
+		})
+	})
+}
+
+// ExportCustomers streams customers as CSV or XLSX, filtered by the from, to and email query parameters
+func (app *application) ExportCustomers(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	format := app.readExportFormat(r, v)
+	qs := r.URL.Query()
+	filter := models.CustomerFilter{
+		From:  app.readQueryDate(qs, "from", v),
+		To:    app.readQueryDate(qs, "to", v),
+		Email: strings.TrimSpace(qs.Get("email")),
+	}
+	if !filter.To.IsZero() {
+		filter.To = filter.To.AddDate(0, 0, 1)
+	}
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	app.streamExport(w, r, "customers", format, func(ew export.Writer) error {
+		if err := ew.Write(customerExportHeader); err != nil {
+			return err
+		}
+		return app.DB.EachCustomer(r.Context(), filter, qs.Get("sort"), func(c *models.Customer) error {
+			return ew.Write([]interface{}{c.ID, c.FirstName, c.LastName, c.Email, c.CreatedAt})
+		})
+	})
+}
+
+// ExportInvoices streams the invoices and credit notes issued in a period as CSV or XLSX,
+// for accounting. Credit notes have negative amounts, so that the amounts add up to what
+// was invoiced net of refunds.
+func (app *application) ExportInvoices(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	format := app.readExportFormat(r, v)
+	qs := r.URL.Query()
+	filter := models.InvoiceFilter{
+		From:     app.readQueryDate(qs, "from", v),
+		To:       app.readQueryDate(qs, "to", v),
+		Kind:     strings.ToLower(qs.Get("kind")),
+		Currency: strings.ToLower(qs.Get("currency")),
+	}
+	if filter.Kind != "" {
+		v.Check("kind", filter.Kind, validator.In(models.InvoiceKindInvoice, models.InvoiceKindCreditNote))
+	}
+	if !filter.To.IsZero() {
+		filter.To = filter.To.AddDate(0, 0, 1)
+	}
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	app.streamExport(w, r, "invoices", format, func(ew export.Writer) error {
+		if err := ew.Write(invoiceExportHeader); err != nil {
+			return err
+		}
+		return app.DB.EachInvoice(r.Context(), filter, func(inv *models.Invoice) error {
+			amount := int64(inv.Amount)
+			if inv.Kind == models.InvoiceKindCreditNote {
+				amount = -amount
+			}
+			var orderID interface{}
+			if inv.OrderID != 0 {
+				orderID = inv.OrderID
+			}
+			return ew.Write([]interface{}{
+				inv.Number,
+				invoiceKindNames[inv.Kind],
+				inv.IssuedAt,
+				inv.CreditedNumber,
+				orderID,
+				inv.LegalEntity,
+				inv.Email,
+				money.New(amount, inv.Currency).Float64(),
+				strings.ToUpper(inv.Currency),
+				inv.Reason,
+			})
+		})
+	})
+}
+
+// readExportFormat reads the required format query parameter
+func (app *application) readExportFormat(r *http.Request, v *validator.Validator) string {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	v.Check("format", format, validator.Required, validator.In(export.CSV, export.XLSX))
+	return format
+}
+
+// streamExport writes the rows produced by write to the client as a file download. Until
+// the first bytes are sent, errors are reported as JSON errors; after that the download
+// is cut short and the error is logged.
+func (app *application) streamExport(w http.ResponseWriter, r *http.Request, name, format string, write func(export.Writer) error) {
+	dw := &downloadWriter{
+		w:           w,
+		contentType: export.ContentType(format),
+		filename:    fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102"), format),
+	}
+
+	ew, err := export.New(format, dw, name)
+	if err == nil {
+		err = write(ew)
+		if err == nil {
+			err = ew.Close()
+		}
+	}
+
+	if err != nil {
+		if dw.started {
+			app.errorLog.Printf("export of %s failed after the download started: %v", name, err)
+			return
+		}
+		app.errorJSON(w, r, app.listError(err))
+	}
+}
+
+// downloadWriter sets the download headers on the first write
+type downloadWriter struct {
+	w           http.ResponseWriter
+	contentType string
+	filename    string
+	started     bool
+}
+
+func (d *downloadWriter) Write(p []byte) (int, error) {
+	if !d.started {
+		d.started = true
+		d.w.Header().Set("Content-Type", d.contentType)
+		d.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", d.filename))
+		d.w.WriteHeader(http.StatusOK)
+	}
+	return d.w.Write(p)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-commerce/internal/export"
+	"go-commerce/internal/models"
+	"go-commerce/internal/validator"
+)
+
+func TestReadExportFormat(t *testing.T) {
+	app := newTestApp()
+	for target, valid := range map[string]bool{
+		"/?format=csv":  true,
+		"/?format=XLSX": true,
+		"/?format=pdf":  false,
+		"/":             false,
+	} {
+		v := validator.New()
+		app.readExportFormat(httptest.NewRequest(http.MethodGet, target, nil), v)
+		if v.Valid() != valid {
+			t.Errorf("%s: got valid %v, errors %v", target, v.Valid(), v.Errors)
+		}
+	}
+}
+
+func TestStreamExport(t *testing.T) {
+	app := newTestApp()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/sales/export?format=csv", nil)
+
+	rec := httptest.NewRecorder()
+	app.streamExport(rec, req, "sales", export.CSV, func(ew export.Writer) error {
+		return ew.Write([]interface{}{"Order ID", 1})
+	})
+	if rec.Code != http.StatusOK || rec.Body.String() != "Order ID,1\n" {
+		t.Errorf("got %d %q", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+		t.Errorf("got Content-Type %q", got)
+	}
+	if got := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(got, `attachment; filename="sales-`) || !strings.HasSuffix(got, `.csv"`) {
+		t.Errorf("got Content-Disposition %q", got)
+	}
+
+	// Errors before the first row reach the client as JSON
+	rec = httptest.NewRecorder()
+	app.streamExport(rec, req, "sales", export.CSV, func(ew export.Writer) error {
+		return models.ErrInvalidSort
+	})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d", rec.Code)
+	}
+	if e := decodeError(t, rec); e.Error.Fields["sort"] == "" {
+		t.Errorf("got %+v", e)
+	}
+
+	// Once the download has started the status can no longer change
+	rec = httptest.NewRecorder()
+	app.streamExport(rec, req, "sales", export.CSV, func(ew export.Writer) error {
+		ew.Write([]interface{}{"Order ID"})
+		ew.Close()
+		return errors.New("connection lost")
+	})
+	if rec.Code != http.StatusOK || rec.Body.String() != "Order ID\n" {
+		t.Errorf("got %d %q", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-commerce/internal/apierror"
+	"go-commerce/internal/apispec"
+	"go-commerce/internal/models"
+	"go-commerce/internal/validator"
+)
+
+// maxShipmentUpload is the largest shipment CSV accepted, in bytes
+const maxShipmentUpload = 4 << 20
+
+// shipmentColumns are the columns a shipment CSV must have, in any order
+var shipmentColumns = []string{"order_id", "carrier", "tracking_number"}
+
+// moveOrder moves an order to another fulfillment status and emails the customer
+func (app *application) moveOrder(e models.FulfillmentEvent) (models.FulfillmentEvent, error) {
+	e, err := app.DB.MoveOrder(e)
+	switch {
+	case errors.Is(err, models.ErrFulfillmentTransition):
+		return e, apierror.Conflict(fmt.Sprintf("a %s order cannot be moved to %s",
+			models.FulfillmentStatusName(e.FromStatusID), models.FulfillmentStatusName(e.ToStatusID)))
+	case errors.Is(err, models.ErrNotShippable):
+		return e, apierror.Conflict(err.Error())
+	case err != nil:
+		return e, err
+	}
+
+	// a bulk upload should not wait on the mail server
+	go app.sendFulfillmentEmail(e)
+	return e, nil
+}
+
+// sendFulfillmentEmail tells the customer that their order moved to another fulfillment
+// status. It runs in the background, so errors are only logged.
+func (app *application) sendFulfillmentEmail(e models.FulfillmentEvent) {
+	order, err := app.DB.GetSaleByID(e.OrderID)
+	if err != nil {
+		app.errorLog.Println(err)
+		return
+	}
+
+	data := struct {
+		Order models.Order
+		Event models.FulfillmentEvent
+	}{order, e}
+	subject := fmt.Sprintf("Your order %d is %s", order.ID, e.ToStatus)
+
+	// SendMail logs its own errors
+	app.SendMail("info@widgets.com", order.Customer.Email, subject, "fulfillment", data)
+}
+
+// ListFulfillmentEvents returns the fulfillment history of the sale identified in the URL
+func (app *application) ListFulfillmentEvents(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if _, err := app.DB.GetSaleByID(id); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	events, err := app.DB.GetFulfillmentEvents(id)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, apispec.FulfillmentEventList{Events: events}, http.StatusOK)
+}
+
+// CreateFulfillmentEvent moves the sale identified in the URL to another fulfillment status
+func (app *application) CreateFulfillmentEvent(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	var payload apispec.FulfillmentRequest
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	status := validateFulfillment(v, payload.Status, strings.TrimSpace(payload.Carrier), strings.TrimSpace(payload.TrackingNumber))
+	v.Check("note", payload.Note, validator.MaxLength(512))
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	user, err := app.authenticateToken(r)
+	if err != nil {
+		app.invalidCredentials(w, r)
+		return
+	}
+
+	event, err := app.moveOrder(models.FulfillmentEvent{
+		OrderID:        id,
+		ToStatusID:     status,
+		Carrier:        strings.TrimSpace(payload.Carrier),
+		TrackingNumber: strings.TrimSpace(payload.TrackingNumber),
+		Note:           payload.Note,
+		UserID:         user.ID,
+	})
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, event, http.StatusCreated)
+}
+
+// CreateShipments ships the sales listed in an uploaded CSV file. The first row names
+// the columns order_id, carrier and tracking_number. Every other row is shipped on its
+// own: rows that cannot be shipped are reported and do not stop the others.
+func (app *application) CreateShipments(w http.ResponseWriter, r *http.Request) {
+	user, err := app.authenticateToken(r)
+	if err != nil {
+		app.invalidCredentials(w, r)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxShipmentUpload)
+	cr := csv.NewReader(r.Body)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		app.errorJSON(w, r, apierror.BadRequest("body must not be empty"))
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, r, apierror.BadRequest("body is not a CSV file"))
+		return
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range shipmentColumns {
+		if _, ok := columns[name]; !ok {
+			app.errorJSON(w, r, apierror.BadRequest(fmt.Sprintf("the header has no %s column", name)))
+			return
+		}
+	}
+
+	resp := apispec.ShipmentImport{Errors: []apispec.ShipmentError{}}
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			resp.Errors = append(resp.Errors, apispec.ShipmentError{Line: line, Message: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			app.errorJSON(w, r, apierror.BadRequest(fmt.Sprintf("body must not be larger than %d bytes", maxShipmentUpload)))
+			return
+		}
+
+		orderID, err := app.shipRow(record, columns, user.ID)
+		if err != nil {
+			apiErr := apierror.From(err)
+			if apiErr.Err != nil {
+				app.errorLog.Printf("shipment line %d: %v", line, apiErr.Err)
+			}
+			resp.Errors = append(resp.Errors, apispec.ShipmentError{Line: line, OrderID: orderID, Message: apiErr.Message})
+			continue
+		}
+		resp.Shipped++
+	}
+
+	app.writeJSON(w, resp, http.StatusOK)
+}
+
+// shipRow ships the order of one row of a shipment CSV and returns its ID
+func (app *application) shipRow(record []string, columns map[string]int, userID int) (int, error) {
+	field := func(name string) string {
+		return strings.TrimSpace(record[columns[name]])
+	}
+
+	orderID, err := strconv.Atoi(field("order_id"))
+	if err != nil || orderID < 1 {
+		return 0, apierror.BadRequest("order_id must be a positive integer")
+	}
+
+	v := validator.New()
+	validateFulfillment(v, "shipped", field("carrier"), field("tracking_number"))
+	for _, name := range shipmentColumns {
+		if msg, ok := v.Errors[name]; ok {
+			return orderID, apierror.BadRequest(name + " " + msg)
+		}
+	}
+
+	_, err = app.moveOrder(models.FulfillmentEvent{
+		OrderID:        orderID,
+		ToStatusID:     models.FulfillmentShipped,
+		Carrier:        field("carrier"),
+		TrackingNumber: field("tracking_number"),
+		Note:           "bulk shipment",
+		UserID:         userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return orderID, apierror.NotFound("there is no sale with this order_id")
+	}
+	return orderID, err
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-commerce/internal/apispec"
+	"go-commerce/internal/models"
+	"go-commerce/internal/validator"
+)
+
+func TestValidateFulfillment(t *testing.T) {
+	v := validator.New()
+	if id := validateFulfillment(v, "picking", "", ""); id != models.FulfillmentPicking || !v.Valid() {
+		t.Errorf("got %d, %v", id, v.Errors)
+	}
+
+	v = validator.New()
+	validateFulfillment(v, "shipped", "", "")
+	if v.Errors["carrier"] == "" || v.Errors["tracking_number"] == "" {
+		t.Errorf("shipping without tracking: got %v", v.Errors)
+	}
+
+	v = validator.New()
+	validateFulfillment(v, "lost", "", "")
+	if v.Errors["status"] == "" {
+		t.Errorf("got %v", v.Errors)
+	}
+}
+
+func TestCreateShipmentsReportsBadRows(t *testing.T) {
+	app, db := newDBApp(t)
+	expectUser(db, 1)
+	db.Expect("for update").WithArgs(404).NoRows()
+
+	body := "Tracking_Number,order_id,carrier\n" +
+		"JJD1,abc,DHL\n" +
+		"JJD2,7,\n" +
+		"JJD3,404,DHL\n" +
+		"\"JJD4,8,DHL\n"
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/shipments", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	app.CreateShipments(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	var resp apispec.ShipmentImport
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	var lines []int
+	for _, e := range resp.Errors {
+		lines = append(lines, e.Line)
+	}
+	if resp.Shipped != 0 || !reflect.DeepEqual(lines, []int{2, 3, 4, 5}) {
+		t.Errorf("got %+v", resp)
+	}
+	if resp.Errors[1].OrderID != 7 || resp.Errors[1].Message != "carrier must be provided" {
+		t.Errorf("got %+v", resp.Errors[1])
+	}
+	if resp.Errors[2].Message != "there is no sale with this order_id" {
+		t.Errorf("got %+v", resp.Errors[2])
+	}
+}
+
+func TestCreateShipmentsNeedsColumns(t *testing.T) {
+	app, db := newDBApp(t)
+	expectUser(db, 1)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/shipments", strings.NewReader("order_id,carrier\n1,DHL\n"))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	app.CreateShipments(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d", rec.Code)
+	}
+	if e := decodeError(t, rec); e.Error.Message != "the header has no tracking_number column" {
+		t.Errorf("got %+v", e)
+	}
+}
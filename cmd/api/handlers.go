@@ -1,107 +1,173 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
+	"strings"
 	"time"
 
+	"go-commerce/internal/apierror"
+	"go-commerce/internal/apispec"
 	"go-commerce/internal/encryption"
 	"go-commerce/internal/models"
 	"go-commerce/internal/payment"
+	"go-commerce/internal/shipping"
+	"go-commerce/internal/tax"
 	"go-commerce/internal/urlsigner"
+	"go-commerce/internal/validator"
 
-	"github.com/go-chi/chi/v5"
 	"github.com/stripe/stripe-go/v72"
 )
 
-type ChargeRequestPayload struct {
-	Currency      string `json:"currency"`
-	Amount        string `json:"amount"`
-	PaymentMethod string `json:"payment_method"`
-	Email         string `json:"email"`
-	LastFour      string `json:"last_four"`
-	Plan          string `json:"plan"`
-	CardBrand     string `json:"card_brand"`
-	ExpiryMonth   int    `json:"exp_month"`
-	ExpiryYear    int    `json:"exp_year"`
-	ProductID     string `json:"product_id"`
-	FirstName     string `json:"first_name"`
-	LastName      string `json:"last_name"`
-}
-
 func (app *application) GetPaymentIntent(w http.ResponseWriter, r *http.Request) {
-	var payload ChargeRequestPayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		app.errorLog.Println(err)
+	var payload apispec.ChargeRequest
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
 		return
 	}
 
-	amount, err := strconv.Atoi(payload.Amount)
-	if err != nil {
-		app.errorLog.Println(err)
+	v := validator.New()
+	if validatePaymentIntentRequest(v, payload); !v.Valid() {
+		app.failedValidation(w, r, v)
 		return
 	}
+	payload.Currency = strings.ToLower(payload.Currency)
 
-	payConf := payment.Config{
-		Secret:   app.config.stripe.secret,
-		Key:      app.config.stripe.key,
-		Currency: payload.Currency,
-	}
-	okay := true
-	paymentIntent, msg, err := payConf.Charge(amount)
-	if err != nil {
-		okay = false
-	}
-
-	var out []byte
-	if okay {
-		out, err = json.MarshalIndent(paymentIntent, "", "    ")
+	// products are charged at their price in the buyer's currency, less the coupon,
+	// plus tax and shipping, whatever the client sent
+	var quote *tax.Quote
+	var shippingQuote *shipping.Quote
+	var discount, reservationID int
+	var captureMethod string
+	if payload.ProductID != 0 {
+		widget, err := app.DB.GetWidget(payload.ProductID)
 		if err != nil {
-			app.errorLog.Println(err)
+			app.errorJSON(w, r, err)
+			return
+		}
+		var coupon *models.Coupon
+		if payload.Coupon != "" {
+			// a redemption of the coupon is held for the checkout until its order is saved
+			c, id, err := app.reserveCoupon("coupon", payload.Coupon, widget, payload.Currency, payload.Email)
+			if err != nil {
+				app.errorJSON(w, r, err)
+				return
+			}
+			coupon, reservationID = &c, id
+		}
+		q, err := app.quoteWidget(widget, coupon, payload.Currency, payload.Country, payload.Region, payload.TaxID)
+		if err != nil {
+			app.releaseCoupon(reservationID)
+			app.errorJSON(w, r, err)
 			return
 		}
-	} else {
-		errorResponse := APIResponse{
-			HasError: true,
-			Message:  msg,
+		if coupon != nil {
+			price, _ := widget.PriceIn(payload.Currency)
+			discount = coupon.Discount(price)
 		}
-		out, err = json.MarshalIndent(errorResponse, "", "    ")
+		field, country, region := shippingDestination(payload)
+		shippingQuote, err = app.quoteShipping(field, widget, payload.Currency, country, region)
 		if err != nil {
+			app.releaseCoupon(reservationID)
+			app.errorJSON(w, r, err)
+			return
+		}
+		payload.Amount, quote = q.Total, &q
+		if shippingQuote != nil {
+			payload.Amount += shippingQuote.Amount
+		}
+		// widgets made to order are only authorized now and captured when they ship
+		captureMethod = widget.CaptureMethod
+	}
+
+	payConf := payment.Config{
+		Secret:        app.config.stripe.secret,
+		Key:           app.config.stripe.key,
+		Currency:      payload.Currency,
+		CaptureMethod: captureMethod,
+	}
+	paymentIntent, msg, err := payConf.Charge(payload.Amount)
+	if err != nil {
+		app.releaseCoupon(reservationID)
+		app.errorJSON(w, r, app.paymentError(msg, err))
+		return
+	}
+	if reservationID != 0 {
+		if err := app.DB.SetCouponReservationIntent(reservationID, paymentIntent.ID); err != nil {
 			app.errorLog.Println(err)
 		}
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(out)
+
+	resp := apispec.PaymentIntent{
+		ID:            paymentIntent.ID,
+		ClientSecret:  paymentIntent.ClientSecret,
+		Amount:        int(paymentIntent.Amount),
+		Currency:      string(paymentIntent.Currency),
+		Status:        string(paymentIntent.Status),
+		CaptureMethod: string(paymentIntent.CaptureMethod),
+		Discount:      discount,
+		Tax:           quote,
+		Shipping:      shippingQuote,
+	}
+	app.writeJSON(w, resp, http.StatusOK)
 }
 
 func (app *application) GetWidgetById(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	widgetID, _ := strconv.Atoi(id)
-
-	widget, err := app.DB.GetWidget(widgetID)
+	widgetID, err := app.readIDParam(r)
 	if err != nil {
-		app.errorLog.Println(err)
+		app.errorJSON(w, r, err)
 		return
 	}
-	out, err := json.MarshalIndent(widget, "", "	")
+
+	widget, err := app.DB.GetWidget(widgetID)
 	if err != nil {
-		app.errorLog.Println(err)
+		app.errorJSON(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(out)
+	app.writeJSON(w, widget, http.StatusOK)
 }
 
 func (app *application) CreateCustomerAndSubscribeToPlan(w http.ResponseWriter, r *http.Request) {
-	var payload ChargeRequestPayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		app.errorLog.Println(err)
+	var payload apispec.ChargeRequest
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if validateSubscriptionRequest(v, payload); !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	widget, err := app.DB.GetWidget(payload.ProductID)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	// metered plans are billed by usage rather than by seat, and trials only go without
+	// a card when the plan allows it
+	seats := payload.Seats
+	if seats == 0 {
+		seats = 1
+	}
+	if widget.Metered && seats > 1 {
+		v.AddError("seats", "cannot be set for a metered plan")
+	}
+	if payload.PaymentMethod == "" && (widget.TrialDays == 0 || widget.TrialRequiresCard) {
+		v.AddError("payment_method", "must be provided")
+	}
+	// the plan comes from the widget, whatever the client sent
+	if !widget.IsRecurring || widget.PlanID == "" {
+		v.AddError("product_id", "is not a plan")
+	}
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
 		return
 	}
+	payload.Currency = strings.ToLower(payload.Currency)
 
 	payConf := payment.Config{
 		Secret:   app.config.stripe.secret,
@@ -109,172 +175,254 @@ func (app *application) CreateCustomerAndSubscribeToPlan(w http.ResponseWriter,
 		Currency: payload.Currency,
 	}
 
-	var subscription *stripe.Subscription
-
-	hasError := false
-	transactionMsg := "Transaction Successful"
-
-	stripeCustomer, msg, err := payConf.CreateCustomer(payload.PaymentMethod, payload.Email)
+	// the gateway bills a plan in the one currency of its price, so other currencies
+	// are refused
+	planPrice, err := payConf.GetPrice(widget.PlanID)
 	if err != nil {
-		app.errorLog.Println(err)
-		hasError = true
-		transactionMsg = msg
+		app.errorJSON(w, r, apierror.Gateway("Error subscribing customer to plan", err))
+		return
 	}
-
-	if !hasError {
-		subscription, err = payConf.SubscribeToPlan(stripeCustomer, payload.Plan, payload.Email, payload.LastFour, "")
-		if err != nil {
-			app.errorLog.Println(err)
-			hasError = true
-			transactionMsg = "Error subscribing customer to plan"
-		}
+	if string(planPrice.Currency) != payload.Currency {
+		v.AddError("currency", "this plan is billed in "+strings.ToUpper(string(planPrice.Currency)))
+		app.failedValidation(w, r, v)
+		return
 	}
 
-	if !hasError {
-		app.infoLog.Println("New subscriber with ID: ", subscription.ID)
-		// store customer, order, transaction
-		customerID, err := app.SaveCustomer(payload.FirstName, payload.LastName, payload.Email)
+	// coupons are checked before the card is saved, and passed to the gateway which
+	// discounts the invoices of the subscription for the coupon's duration. The
+	// redemption is held until the order is saved, which then counts it, or the
+	// subscription fails.
+	var coupon models.Coupon
+	var stripeCouponID string
+	if payload.Coupon != "" {
+		var reservationID int
+		coupon, reservationID, err = app.reserveCoupon("coupon", payload.Coupon, widget, payload.Currency, payload.Email)
 		if err != nil {
-			app.errorLog.Println(err)
+			app.errorJSON(w, r, err)
 			return
 		}
-
-		amount, _ := strconv.Atoi(payload.Amount)
-		transaction := models.Transaction{
-			Amount:              amount,
-			Currency:            payload.Currency,
-			LastFour:            payload.LastFour,
-			CardExpiryMonth:     payload.ExpiryMonth,
-			CardExpiryYear:      payload.ExpiryYear,
-			PaymentMethod:       payload.PaymentMethod,
-			PaymentIntent:       subscription.ID,
-			TransactionStatusID: models.TransactionCleared,
-			CreatedAt:           time.Now(),
-			UpdatedAt:           time.Now(),
-		}
-		transactionID, err := app.SaveTransaction(transaction)
+		defer app.releaseCoupon(reservationID)
+		stripeCouponID, err = app.stripeCoupon(coupon, payConf)
 		if err != nil {
-			app.errorLog.Println(err)
+			app.errorJSON(w, r, apierror.Gateway("Error creating coupon", err))
 			return
 		}
+	}
+	var subscription *stripe.Subscription
 
-		productID, _ := strconv.Atoi(payload.ProductID)
-		order := models.Order{
-			WidgetID:      productID,
-			CustomerID:    customerID,
-			TransactionID: transactionID,
-			Quantity:      1,
-			Amount:        amount,
-			StatusID:      models.OrderCleared,
-			CreatedAt:     time.Now(),
-			UpdatedAt:     time.Now(),
-		}
-		_, err = app.SaveOrder(order)
-		if err != nil {
-			app.errorLog.Println(err)
+	stripeCustomer, msg, err := payConf.CreateCustomer(payload.PaymentMethod, payload.Email)
+	if err != nil {
+		app.errorJSON(w, r, app.paymentError(msg, err))
+		return
+	}
+
+	planSeats := seats
+	if widget.Metered {
+		planSeats = 0
+	}
+	subscription, err = payConf.SubscribeToPlan(stripeCustomer, widget.PlanID, planSeats, widget.TrialDays, stripeCouponID, payload.Email, payload.LastFour, "")
+	if err != nil {
+		app.errorJSON(w, r, apierror.Gateway("Error subscribing customer to plan", err))
+		return
+	}
+
+	// the subscription is billed the price of its plan per seat, which is what the order
+	// records
+	amount := int(planPrice.UnitAmount) * seats
+	if subscription.Items != nil && len(subscription.Items.Data) > 0 && subscription.Items.Data[0].Price != nil {
+		p := subscription.Items.Data[0].Price
+		amount, payload.Currency = int(p.UnitAmount)*seats, string(p.Currency)
+	}
+	discount := coupon.Discount(amount)
+
+	// the order clears with its first payment; one that needs the card holder to
+	// authenticate leaves it pending until the invoice is paid
+	resp := apispec.SubscriptionResult{
+		Message:        "Transaction Successful",
+		SubscriptionID: subscription.ID,
+		Status:         string(subscription.Status),
+	}
+	transactionStatus, orderStatus := models.TransactionCleared, models.OrderCleared
+	// nothing is charged during a trial; the first payment is a renewal, which is dunned
+	// like any other when it fails
+	charged := amount - discount
+	var trialEndsAt *time.Time
+	if subscription.TrialEnd > 0 {
+		end := time.Unix(subscription.TrialEnd, 0)
+		trialEndsAt, charged = &end, 0
+		resp.Message = "Your trial has started"
+		resp.TrialEndsAt = trialEndsAt
+	}
+	if pi := payment.FirstPayment(subscription); pi != nil {
+		err := payment.CheckPaymentIntent(pi)
+		switch {
+		case errors.Is(err, payment.ErrRequiresAction):
+			resp.Message = "The payment needs to be authenticated"
+			resp.RequiresAction = true
+			resp.ClientSecret = pi.ClientSecret
+			transactionStatus, orderStatus = models.TransactionPending, models.OrderPending
+		case err != nil:
+			app.errorJSON(w, r, app.paymentIntentError(err))
 			return
+		case !payment.Succeeded(pi):
+			transactionStatus, orderStatus = models.TransactionPending, models.OrderPending
 		}
 	}
 
-	resp := APIResponse{
-		HasError: hasError,
-		Message:  transactionMsg,
+	app.infoLog.Println("New subscriber with ID: ", subscription.ID)
+	// store customer, order, transaction
+	customerID, err := app.SaveCustomer(payload.FirstName, payload.LastName, payload.Email)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	transaction := models.Transaction{
+		Amount:              charged,
+		Currency:            payload.Currency,
+		LastFour:            payload.LastFour,
+		CardExpiryMonth:     payload.ExpiryMonth,
+		CardExpiryYear:      payload.ExpiryYear,
+		PaymentMethod:       payload.PaymentMethod,
+		PaymentIntent:       subscription.ID,
+		TransactionStatusID: transactionStatus,
+		CreatedAt:           time.Now(),
+		UpdatedAt:           time.Now(),
+	}
+	transactionID, err := app.SaveTransaction(transaction)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
 	}
 
-	out, err := json.MarshalIndent(resp, "", "	")
+	order := models.Order{
+		WidgetID:      payload.ProductID,
+		CustomerID:    customerID,
+		TransactionID: transactionID,
+		Quantity:      seats,
+		Amount:        amount - discount,
+		CouponID:      coupon.ID,
+		Discount:      discount,
+		StatusID:      orderStatus,
+		TrialEndsAt:   trialEndsAt,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	if payload.BillingAddress != nil {
+		address := *payload.BillingAddress
+		address.CustomerID, address.Kind = customerID, models.AddressBilling
+		if address.ID, err = app.DB.InsertAddress(address); err != nil {
+			app.errorJSON(w, r, err)
+			return
+		}
+		order.BillingAddress = &address
+	}
+	_, err = app.SaveOrder(order)
 	if err != nil {
-		app.errorLog.Println(err)
+		app.errorJSON(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(out)
+	app.writeJSON(w, resp, http.StatusCreated)
 }
 
 func (app *application) CreateAuthToken(w http.ResponseWriter, r *http.Request) {
-	var userInput struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+	var userInput apispec.Credentials
 
 	err := app.readJSON(w, r, &userInput)
 
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check("email", userInput.Email, validator.Required, validator.Email)
+	v.Check("password", userInput.Password, validator.Required)
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
 		return
 	}
 
 	user, err := app.DB.GetUserByEmail(userInput.Email)
 	if err != nil {
-		app.invalidCredentials(w)
+		app.invalidCredentials(w, r)
 		return
 	}
 
 	isValidPassword, err := app.passwordMatches(user.Password, userInput.Password)
 	if err != nil {
-		app.invalidCredentials(w)
+		app.invalidCredentials(w, r)
 		return
 	}
 
 	if !isValidPassword {
-		app.invalidCredentials(w)
+		app.invalidCredentials(w, r)
 		return
 	}
 
 	token, err := models.GenerateToken(user.ID, 24*time.Hour, models.ScopeAuthentication)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
 
 	err = app.DB.InsertToken(token, user)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
 
-	var payload struct {
-		HasError bool          `json:"has_error"`
-		Message  string        `json:"message"`
-		Token    *models.Token `json:"authentication_token"`
+	payload := apispec.AuthTokenResponse{
+		HasError: false,
+		Message:  fmt.Sprintf("Token for %s created", user.Email),
+		Token:    token,
 	}
-
-	payload.HasError = false
-	payload.Message = fmt.Sprintf("Token for %s created", user.Email)
-	payload.Token = token
-	app.writeJSON(w, payload, http.StatusOK)
+	app.writeJSON(w, payload, http.StatusCreated)
 }
 
 func (app *application) CheckAuthentication(w http.ResponseWriter, r *http.Request) {
 	user, err := app.authenticateToken(r)
 	if err != nil {
-		app.invalidCredentials(w)
+		app.invalidCredentials(w, r)
 		return
 	}
-	payload := APIResponse{
+	payload := apispec.Response{
 		HasError: false,
 		Message:  fmt.Sprintf("authenticated user - %s", user.Email),
 	}
 	app.writeJSON(w, payload, http.StatusOK)
 }
 
+// TerminalPaymentSuccessful records a payment confirmed at the virtual terminal as an
+// order of the customer it names, or of a new customer
 func (app *application) TerminalPaymentSuccessful(w http.ResponseWriter, r *http.Request) {
-	var transactionData struct {
-		FirstName       string `json:"first_name"`
-		LastName        string `json:"last_name"`
-		Email           string `json:"email"`
-		PaymentIntentID string `json:"payment_intent"`
-		PaymentMethodID string `json:"payment_method"`
-		Amount          int    `json:"amount"`
-		Currency        string `json:"currency"`
-		LastFour        string `json:"last_four"`
-		ExpiryMonth     int    `json:"expiry_month"`
-		ExpiryYear      int    `json:"expiry_year"`
-		BankReturnCode  string `json:"bank_return_code"`
-	}
+	var transactionData apispec.TerminalPayment
 	err := app.readJSON(w, r, &transactionData)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check("payment_intent", transactionData.PaymentIntentID, validator.Required)
+	v.Check("payment_method", transactionData.PaymentMethodID, validator.Required)
+	v.CheckInt("amount", transactionData.Amount, validator.Positive)
+	v.Check("currency", transactionData.Currency, validator.Required, validator.Currency)
+	v.CheckInt("customer_id", transactionData.CustomerID, validator.Min(0))
+	if transactionData.CustomerID == 0 {
+		v.Check("email", transactionData.Email, validator.Required, validator.Email)
+	}
+	v.Check("note", transactionData.Note, validator.MaxLength(1024))
+	validateOrderItems(v, transactionData.Items, transactionData.Amount)
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	items, err := app.orderItems(transactionData.Items)
+	if err != nil {
+		app.errorJSON(w, r, err)
 		return
 	}
 
@@ -284,37 +432,38 @@ func (app *application) TerminalPaymentSuccessful(w http.ResponseWriter, r *http
 	}
 	paymentIntent, err := payConf.RetrievePaymentIntent(transactionData.PaymentIntentID)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, apierror.Gateway("could not retrieve payment intent", err))
 		return
 	}
 	paymentMethod, err := payConf.GetPaymentMethod(transactionData.PaymentMethodID)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, apierror.Gateway("could not retrieve payment method", err))
+		return
+	}
+	if err := payment.CheckPaymentIntent(paymentIntent); err != nil {
+		app.errorJSON(w, r, app.paymentIntentError(err))
 		return
 	}
 
+	customer, err := app.terminalCustomer(transactionData)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	transactionData.FirstName = customer.FirstName
+	transactionData.LastName = customer.LastName
+	transactionData.Email = customer.Email
+	transactionData.CustomerID = customer.ID
 	transactionData.LastFour = paymentMethod.Card.Last4
 	transactionData.ExpiryMonth = int(paymentMethod.Card.ExpMonth)
 	transactionData.ExpiryYear = int(paymentMethod.Card.ExpYear)
-	transactionData.BankReturnCode = paymentIntent.Charges.Data[0].ID
+	transactionData.BankReturnCode = payment.ChargeID(paymentIntent)
+	transactionData.Status = string(paymentIntent.Status)
 
-	// create new transaction
-	transaction := models.Transaction{
-		Amount:              transactionData.Amount,
-		Currency:            transactionData.Currency,
-		LastFour:            transactionData.LastFour,
-		BankReturnCode:      transactionData.BankReturnCode,
-		PaymentIntent:       transactionData.PaymentIntentID,
-		PaymentMethod:       transactionData.PaymentMethodID,
-		CardExpiryMonth:     transactionData.ExpiryMonth,
-		CardExpiryYear:      transactionData.ExpiryYear,
-		TransactionStatusID: 2,
-		CreatedAt:           time.Now(),
-		UpdatedAt:           time.Now(),
-	}
-	_, err = app.SaveTransaction(transaction)
+	transactionData.OrderID, err = app.saveTerminalOrder(transactionData, items)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
 
@@ -322,17 +471,21 @@ func (app *application) TerminalPaymentSuccessful(w http.ResponseWriter, r *http
 }
 
 func (app *application) SendPasswordResetEmail(w http.ResponseWriter, r *http.Request) {
-	var payload struct {
-		Email string `json:"email"`
-	}
+	var payload apispec.PasswordResetRequest
 
 	if err := app.readJSON(w, r, &payload); err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check("email", payload.Email, validator.Required, validator.Email); !v.Valid() {
+		app.failedValidation(w, r, v)
 		return
 	}
 
 	if _, err := app.DB.GetUserByEmail(payload.Email); err != nil {
-		app.badRequest(w, errors.New("no matching email found"))
+		app.errorJSON(w, r, apierror.From(err).WithMessage("no matching email found"))
 		return
 	}
 
@@ -347,47 +500,51 @@ func (app *application) SendPasswordResetEmail(w http.ResponseWriter, r *http.Re
 	// send mail
 	err := app.SendMail("info@widgets.com", payload.Email, "Password Reset Email", "password_reset", data)
 	if err != nil {
-		app.errorLog.Println(err)
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
 
-	resp := APIResponse{
+	resp := apispec.Response{
 		HasError: false,
 	}
 	app.writeJSON(w, resp, http.StatusCreated)
 }
 
 func (app *application) ResetPassword(w http.ResponseWriter, r *http.Request) {
-	var payload struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+	var payload apispec.PasswordReset
 
 	if err := app.readJSON(w, r, &payload); err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check("email", payload.Email, validator.Required)
+	v.Check("password", payload.Password, validator.Required, validator.MinLength(minPasswordLength), validator.MaxLength(72))
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
 		return
 	}
 
 	encryptor := encryption.NewEncryptor([]byte(app.config.secretKey))
 	realEmail, err := encryptor.Decrypt(payload.Email)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, apierror.BadRequest("invalid password reset link"))
 		return
 	}
 
 	user, err := app.DB.GetUserByEmail(realEmail)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
 
 	if err = app.DB.UpdatePasswordForUser(user, payload.Password); err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
 
-	resp := APIResponse{
+	resp := apispec.Response{
 		HasError: false,
 		Message:  "password changed",
 	}
@@ -395,29 +552,32 @@ func (app *application) ResetPassword(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) AllSales(w http.ResponseWriter, r *http.Request) {
-	var payload struct {
-		Page int `json:"page"`
-		PageSize    int `json:"page_size"`
-	}
+	var payload apispec.PageRequest
 
 	if err := app.readJSON(w, r, &payload); err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
+
+	v := validator.New()
+	v.CheckInt("page", payload.Page, validator.Positive)
+	v.CheckInt("page_size", payload.PageSize, validator.Positive, validator.Max(100))
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
 	allSales, totalSales, lastPage, err := app.DB.GetAllSalesPaginated(payload.PageSize, payload.Page)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
-	var paginatedSalesData struct {
-		TotalSales int             `json:"total_sales"`
-		LastPage   int             `json:"last_page"`
-		Sales      []*models.Order `json:"sales"`
-	}
 
-	paginatedSalesData.TotalSales = totalSales
-	paginatedSalesData.LastPage = lastPage
-	paginatedSalesData.Sales = allSales
+	paginatedSalesData := apispec.PaginatedSales{
+		TotalSales: totalSales,
+		LastPage:   lastPage,
+		Sales:      allSales,
+	}
 
 	app.writeJSON(w, paginatedSalesData, http.StatusOK)
 }
@@ -425,76 +585,64 @@ func (app *application) AllSales(w http.ResponseWriter, r *http.Request) {
 func (app *application) AllSubscriptions(w http.ResponseWriter, r *http.Request) {
 	allSales, err := app.DB.GetAllSubscriptions()
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
 	app.writeJSON(w, allSales, http.StatusOK)
 }
 
 func (app *application) GetSale(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(idParam)
+	id, err := app.readIDParam(r)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
 	order, err := app.DB.GetSaleByID(id)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
 	app.writeJSON(w, order, http.StatusOK)
 }
 
 func (app *application) GetSubscription(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(idParam)
+	id, err := app.readIDParam(r)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
 	order, err := app.DB.GetSubscriptionByID(id)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
 	app.writeJSON(w, order, http.StatusOK)
 }
 
+// RefundCharge refunds what is left of the charge of a sale. Only the id of the payload is
+// read; the amount and payment intent come from the sale, as in CreateRefund.
 func (app *application) RefundCharge(w http.ResponseWriter, r *http.Request) {
-	var chargeToRefund struct {
-		ID            int    `json:"id"`
-		PaymentIntent string `json:"payment_intent"`
-		Amount        int    `json:"amount"`
-		Currency      string `json:"currency"`
-	}
+	var chargeToRefund apispec.LegacyRefund
 
 	err := app.readJSON(w, r, &chargeToRefund)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
 
-	payConf := payment.Config{
-		Secret:   app.config.stripe.secret,
-		Key:      app.config.stripe.key,
-		Currency: chargeToRefund.Currency,
-	}
-
-	err = payConf.Refund(chargeToRefund.PaymentIntent, chargeToRefund.Amount)
-	if err != nil {
-		app.badRequest(w, err)
+	v := validator.New()
+	v.CheckInt("id", chargeToRefund.ID, validator.Positive)
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
 		return
 	}
 
-	err = app.DB.UpdateOrderStatus(chargeToRefund.ID, models.OrderRefunded)
-	if err != nil {
-		app.badRequest(w, errors.New("charge has been refunded but could not update in database"))
-		app.errorLog.Println(err)
+	if err := app.refundSale(r, chargeToRefund.ID); err != nil {
+		app.errorJSON(w, r, err)
 		return
 	}
 
-	response := APIResponse{
+	response := apispec.Response{
 		HasError: false,
 		Message:  "Charge refunded",
 	}
@@ -502,15 +650,19 @@ func (app *application) RefundCharge(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) CancelSubscription(w http.ResponseWriter, r *http.Request) {
-	var subToCancel struct {
-		ID            int    `json:"id"`
-		PaymentIntent string `json:"payment_intent"`
-		Currency      string `json:"currency"`
-	}
+	var subToCancel apispec.LegacyCancellation
 
 	err := app.readJSON(w, r, &subToCancel)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.CheckInt("id", subToCancel.ID, validator.Positive)
+	v.Check("payment_intent", subToCancel.PaymentIntent, validator.Required)
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
 		return
 	}
 
@@ -522,18 +674,17 @@ func (app *application) CancelSubscription(w http.ResponseWriter, r *http.Reques
 
 	err = payConf.CancelSubscription(subToCancel.PaymentIntent)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, apierror.Gateway("could not cancel subscription", err))
 		return
 	}
 
 	err = app.DB.UpdateOrderStatus(subToCancel.ID, models.OrderCancelled)
 	if err != nil {
-		app.badRequest(w, errors.New("subscription has been canceled but could not update in database"))
-		app.errorLog.Println(err)
+		app.errorJSON(w, r, apierror.Internal(err).WithMessage("subscription has been canceled but could not update in database"))
 		return
 	}
 
-	response := APIResponse{
+	response := apispec.Response{
 		HasError: false,
 		Message:  "Subscription Cancelled",
 	}
@@ -543,7 +694,7 @@ func (app *application) CancelSubscription(w http.ResponseWriter, r *http.Reques
 func (app *application) AllUsers(w http.ResponseWriter, r *http.Request) {
 	allUsers, err := app.DB.GetAllUsers()
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
 
@@ -551,16 +702,15 @@ func (app *application) AllUsers(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) OneUser(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(idParam)
+	id, err := app.readIDParam(r)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
 
 	user, err := app.DB.GetUserById(id)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
 
@@ -572,19 +722,26 @@ func (app *application) EditUser(w http.ResponseWriter, r *http.Request) {
 
 	err := app.readJSON(w, r, &user)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.CheckInt("id", user.ID, validator.Positive)
+	if validateUser(v, user, false); !v.Valid() {
+		app.failedValidation(w, r, v)
 		return
 	}
 
 	err = app.DB.EditUser(user)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, app.userError(err))
 		return
 	}
 
-	response := APIResponse{
+	response := apispec.Response{
 		HasError: false,
-		Message: "user successfully updated",
+		Message:  "user successfully updated",
 	}
 	app.writeJSON(w, response, http.StatusOK)
 }
@@ -594,40 +751,409 @@ func (app *application) AddUser(w http.ResponseWriter, r *http.Request) {
 
 	err := app.readJSON(w, r, &user)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if validateUser(v, user, true); !v.Valid() {
+		app.failedValidation(w, r, v)
 		return
 	}
 
 	err = app.DB.AddUser(user)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, app.userError(err))
 		return
 	}
 
-	response := APIResponse{
+	response := apispec.Response{
 		HasError: false,
-		Message: "user successfully added",
+		Message:  "user successfully added",
 	}
 	app.writeJSON(w, response, http.StatusOK)
 }
 
 func (app *application) DeleteUser(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(idParam)
+	id, err := app.readIDParam(r)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
 
 	err = app.DB.DeleteUser(id)
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, r, err)
 		return
 	}
 
-	response := APIResponse{
+	response := apispec.Response{
 		HasError: false,
-		Message: "user successfully deleted",
+		Message:  "user successfully deleted",
 	}
 	app.writeJSON(w, response, http.StatusOK)
-}
\ No newline at end of file
+}
+
+// ListSales lists one-off sales. The query string filters and sorts the sales and selects
+// the page: page and page_size for numbered pages, or cursor for cursor pagination.
+func (app *application) ListSales(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	filter := app.readOrderFilter(r, v)
+	params := app.readListParams(r, v)
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	sales, pageInfo, err := app.DB.SearchSales(filter, params)
+	if err != nil {
+		app.errorJSON(w, r, app.listError(err))
+		return
+	}
+
+	resp := apispec.PaginatedSales{
+		TotalSales: pageInfo.Total,
+		LastPage:   pageInfo.LastPage,
+		NextCursor: pageInfo.NextCursor,
+		Sales:      sales,
+	}
+	app.writeJSON(w, resp, http.StatusOK)
+}
+
+// refundSale refunds what is left of the charge of a cleared sale after any refunded
+// returns and marks the sale refunded
+func (app *application) refundSale(r *http.Request, id int) error {
+	order, err := app.DB.GetSaleByID(id)
+	if err != nil {
+		return err
+	}
+
+	if order.StatusID != models.OrderCleared {
+		return apierror.Conflict("only cleared sales can be refunded")
+	}
+
+	// returns may already have refunded part of the charge
+	refunded, err := app.DB.GetRefundedAmount(order.ID)
+	if err != nil {
+		return err
+	}
+	remaining := order.Transaction.Amount - refunded
+	if remaining <= 0 {
+		return apierror.Conflict("the returns of this sale have already refunded it in full")
+	}
+
+	payConf := payment.Config{
+		Secret:   app.config.stripe.secret,
+		Key:      app.config.stripe.key,
+		Currency: order.Transaction.Currency,
+	}
+
+	refundID, err := payConf.Refund(order.Transaction.PaymentIntent, remaining, fmt.Sprintf("order:%d:refund", order.ID))
+	if err != nil {
+		return apierror.Gateway("could not refund charge", err)
+	}
+
+	err = app.DB.MarkOrderRefunded(order.ID)
+	if err != nil {
+		return apierror.Internal(err).WithMessage("charge has been refunded but could not update in database")
+	}
+	go app.sendCreditNote(r.Header.Get("Authorization"), order.ID, remaining, refundID, "Refund", "")
+
+	return nil
+}
+
+// CreateRefund refunds what is left of the charge of the sale identified in the URL after
+// any refunded returns
+func (app *application) CreateRefund(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if err := app.refundSale(r, id); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	response := apispec.Response{
+		HasError: false,
+		Message:  "Charge refunded",
+	}
+	app.writeJSON(w, response, http.StatusCreated)
+}
+
+// DeleteSubscription cancels the subscription identified in the URL at the end of its period
+func (app *application) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	order, err := app.DB.GetSubscriptionByID(id)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if order.StatusID == models.OrderCancelled {
+		app.errorJSON(w, r, apierror.Conflict("subscription is already cancelled"))
+		return
+	}
+
+	payConf := payment.Config{
+		Secret:   app.config.stripe.secret,
+		Key:      app.config.stripe.key,
+		Currency: order.Transaction.Currency,
+	}
+
+	err = payConf.CancelSubscription(order.Transaction.PaymentIntent)
+	if err != nil {
+		app.errorJSON(w, r, apierror.Gateway("could not cancel subscription", err))
+		return
+	}
+
+	// a past due subscription stops being dunned
+	err = app.DB.CloseDunning(order.ID, models.DunningCancelled, models.SubscriptionEvent{
+		Kind: models.EventCancelled,
+		Note: "cancelled by an admin at the end of its period",
+	})
+	if err != nil {
+		app.errorJSON(w, r, apierror.Internal(err).WithMessage("subscription has been canceled but could not update in database"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateUser adds a new admin user
+func (app *application) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var user models.User
+
+	err := app.readJSON(w, r, &user)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if validateUser(v, user, true); !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	err = app.DB.AddUser(user)
+	if err != nil {
+		app.errorJSON(w, r, app.userError(err))
+		return
+	}
+
+	response := apispec.Response{
+		HasError: false,
+		Message:  "user successfully added",
+	}
+	app.writeJSON(w, response, http.StatusCreated)
+}
+
+// UpdateUser replaces the user identified in the URL. An empty password leaves the password unchanged.
+func (app *application) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	var user models.User
+	err = app.readJSON(w, r, &user)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if validateUser(v, user, false); !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	if _, err := app.DB.GetUserById(id); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	user.ID = id
+	err = app.DB.EditUser(user)
+	if err != nil {
+		app.errorJSON(w, r, app.userError(err))
+		return
+	}
+
+	response := apispec.Response{
+		HasError: false,
+		Message:  "user successfully updated",
+	}
+	app.writeJSON(w, response, http.StatusOK)
+}
+
+// PatchUser updates only the fields present in the request body
+func (app *application) PatchUser(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	var payload apispec.UserPatch
+	err = app.readJSON(w, r, &payload)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	user, err := app.DB.GetUserById(id)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if payload.FirstName != nil {
+		user.FirstName = *payload.FirstName
+	}
+	if payload.LastName != nil {
+		user.LastName = *payload.LastName
+	}
+	if payload.Email != nil {
+		user.Email = *payload.Email
+	}
+	if payload.Password != nil {
+		user.Password = *payload.Password
+	}
+
+	v := validator.New()
+	if validateUser(v, user, false); !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	err = app.DB.EditUser(user)
+	if err != nil {
+		app.errorJSON(w, r, app.userError(err))
+		return
+	}
+
+	response := apispec.Response{
+		HasError: false,
+		Message:  "user successfully updated",
+	}
+	app.writeJSON(w, response, http.StatusOK)
+}
+
+// RemoveUser deletes the user identified in the URL
+func (app *application) RemoveUser(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if _, err := app.DB.GetUserById(id); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	err = app.DB.DeleteUser(id)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListSubscriptions lists subscriptions, with the same query parameters as ListSales
+func (app *application) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	filter := app.readOrderFilter(r, v)
+	params := app.readListParams(r, v)
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	subscriptions, pageInfo, err := app.DB.SearchSubscriptions(filter, params)
+	if err != nil {
+		app.errorJSON(w, r, app.listError(err))
+		return
+	}
+
+	resp := apispec.PaginatedSubscriptions{
+		Total:         pageInfo.Total,
+		LastPage:      pageInfo.LastPage,
+		NextCursor:    pageInfo.NextCursor,
+		Subscriptions: subscriptions,
+	}
+	app.writeJSON(w, resp, http.StatusOK)
+}
+
+// ListUsers lists admin users, optionally matching the q query parameter against their name or email
+func (app *application) ListUsers(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	filter := models.UserFilter{Search: strings.TrimSpace(r.URL.Query().Get("q"))}
+	params := app.readListParams(r, v)
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	users, pageInfo, err := app.DB.SearchUsers(filter, params)
+	if err != nil {
+		app.errorJSON(w, r, app.listError(err))
+		return
+	}
+
+	resp := apispec.PaginatedUsers{
+		Total:      pageInfo.Total,
+		LastPage:   pageInfo.LastPage,
+		NextCursor: pageInfo.NextCursor,
+		Users:      users,
+	}
+	app.writeJSON(w, resp, http.StatusOK)
+}
+
+// paymentError maps a payment package error to an API error. A non-empty msg means
+// the gateway declined the card and msg is safe to show the buyer.
+func (app *application) paymentError(msg string, err error) *apierror.Error {
+	if msg != "" {
+		return apierror.PaymentDeclined(msg, err)
+	}
+	return apierror.Gateway("the payment gateway could not process the request", err)
+}
+
+// paymentIntentError maps an error of payment.CheckPaymentIntent to an API error. A
+// declined card is reported like a card error; other payments are not finished yet.
+func (app *application) paymentIntentError(err error) *apierror.Error {
+	if errors.Is(err, payment.ErrRequiresPaymentMethod) {
+		return apierror.PaymentDeclined(err.Error(), err)
+	}
+	return apierror.Conflict(err.Error())
+}
+
+// userError maps errors from the user models to API errors
+func (app *application) userError(err error) error {
+	if errors.Is(err, models.ErrDuplicateEmail) {
+		return apierror.Conflict("a user with this email address already exists")
+	}
+	return err
+}
+
+// listError maps errors from list queries to API errors
+func (app *application) listError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrInvalidSort):
+		return apierror.Validation(map[string]string{"sort": "is not a sortable column"})
+	case errors.Is(err, models.ErrInvalidCursor):
+		return apierror.Validation(map[string]string{"cursor": "is invalid or was issued for another sort"})
+	}
+	return err
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-commerce/internal/dbtest"
+	"go-commerce/internal/models"
+)
+
+func TestCreateRefundGuards(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		refunded []interface{}
+		message  string
+	}{
+		{"pending sale", models.OrderPending, nil, "only cleared sales can be refunded"},
+		{"refunded by returns", models.OrderCleared, []interface{}{1000}, "the returns of this sale have already refunded it in full"},
+	}
+	for _, tt := range tests {
+		fakeStripe(t, func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("%s: got request for %s", tt.name, r.URL.Path)
+		})
+		app, db := newDBApp(t)
+		expectSale(db, tt.status, models.TransactionCleared)
+		if tt.refunded != nil {
+			db.Expect("from returns where order_id = ? and status = ?").WithArgs(5, models.ReturnRefunded).Rows(tt.refunded)
+		}
+
+		rec := httptest.NewRecorder()
+		app.CreateRefund(rec, withID(httptest.NewRequest(http.MethodPost, "/", nil), 5))
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("%s: got status %d: %s", tt.name, rec.Code, rec.Body)
+		}
+		if e := decodeError(t, rec); e.Message != tt.message {
+			t.Errorf("%s: got %q", tt.name, e.Message)
+		}
+	}
+}
+
+func TestRefundChargeRefundsTheSale(t *testing.T) {
+	fakeStripe(t, func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Header.Get("Idempotency-Key"); key != "order:5:refund" {
+			t.Errorf("refunded with idempotency key %q", key)
+		}
+		r.ParseForm()
+		if got := r.PostForm.Get("payment_intent"); got != "pi_1" {
+			t.Errorf("refunded payment intent %q, want the sale's", got)
+		}
+		if got := r.PostForm.Get("amount"); got != "750" {
+			t.Errorf("refunded %q, want what the returns left", got)
+		}
+		fmt.Fprint(w, `{"id": "re_1", "object": "refund"}`)
+	})
+	notes := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		close(notes)
+	}))
+	defer srv.Close()
+
+	app, db := newDBApp(t)
+	app.config.invoiceService = srv.URL
+	expectSale(db, models.OrderCleared, models.TransactionCleared)
+	db.Expect("from returns where order_id = ? and status = ?").WithArgs(5, models.ReturnRefunded).Rows([]interface{}{250})
+	db.Expect("update orders set status_id = ?, refunded_at = ?").WithArgs(models.OrderRefunded, dbtest.Any, dbtest.Any, 5)
+	expectSale(db, models.OrderRefunded, models.TransactionCleared)
+
+	body := `{"id": 5, "payment_intent": "pi_other", "amount": 100000, "currency": "usd"}`
+	rec := httptest.NewRecorder()
+	app.RefundCharge(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	select {
+	case <-notes:
+	case <-time.After(time.Second):
+		t.Error("no credit note was issued")
+	}
+}
+
+// expectWidget makes the next statements find widget 2, priced 900 in usd only
+func expectWidget(db *dbtest.DB, recurring bool, planID string) {
+	now := time.Now()
+	db.Expect("from widgets where id = ?").WithArgs(2).Rows([]interface{}{
+		2, "Bronze Plan", "", 0, 900, "", recurring, planID, 0, models.CaptureAutomatic, 0, false, false, now, now,
+	})
+	db.Expect("from widget_prices where widget_id = ?").WithArgs(2).Rows([]interface{}{"usd", 900})
+}
+
+func TestCreateCustomerAndSubscribeToPlanChecksPlan(t *testing.T) {
+	tests := []struct {
+		name      string
+		recurring bool
+		planID    string
+		currency  string
+		field     string
+	}{
+		{"not a plan", false, "", "usd", "product_id"},
+		{"not billed in currency", true, "price_bronze", "eur", "currency"},
+	}
+	for _, tt := range tests {
+		fakeStripe(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v1/prices/price_bronze" {
+				t.Errorf("%s: got request for %s", tt.name, r.URL.Path)
+			}
+			fmt.Fprint(w, `{"id": "price_bronze", "object": "price", "currency": "usd", "unit_amount": 1200}`)
+		})
+		app, db := newDBApp(t)
+		expectWidget(db, tt.recurring, tt.planID)
+
+		body := fmt.Sprintf(`{"product_id": 2, "currency": %q, "payment_method": "pm_1", "plan": "price_other",
+			"first_name": "Ada", "last_name": "Lovelace", "email": "ada@example.com"}`, tt.currency)
+		rec := httptest.NewRecorder()
+		app.CreateCustomerAndSubscribeToPlan(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("%s: got status %d: %s", tt.name, rec.Code, rec.Body)
+		}
+		if fields := decodeError(t, rec).Error.Fields; fields[tt.field] == "" {
+			t.Errorf("%s: no error for %s: %v", tt.name, tt.field, fields)
+		}
+	}
+}
+
+func TestCreateCustomerAndSubscribeToPlanRecordsPlanPrice(t *testing.T) {
+	price := `{"id": "price_bronze", "object": "price", "currency": "usd", "unit_amount": 1200}`
+	fakeStripe(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/prices/price_bronze":
+			fmt.Fprint(w, price)
+		case "/v1/customers":
+			fmt.Fprint(w, `{"id": "cus_1", "object": "customer"}`)
+		case "/v1/subscriptions":
+			fmt.Fprintf(w, `{"id": "sub_1", "object": "subscription", "status": "active",
+				"items": {"object": "list", "data": [{"id": "si_1", "object": "subscription_item", "price": %s}]}}`, price)
+		default:
+			t.Errorf("got request for %s", r.URL.Path)
+		}
+	})
+	app, db := newDBApp(t)
+	// the widget lists the plan at 900, but the gateway bills 1200 a seat
+	expectWidget(db, true, "price_bronze")
+	db.Expect("insert into customers").Result(4, 1)
+	txn := db.Expect("insert into transactions").Result(3, 1)
+	// plans are not taxed, so the order has no tax lines
+	order := db.Expect("insert into orders").Result(5, 1)
+
+	body := `{"product_id": 2, "currency": "USD", "payment_method": "pm_1", "seats": 2,
+		"first_name": "Ada", "last_name": "Lovelace", "email": "ada@example.com"}`
+	rec := httptest.NewRecorder()
+	app.CreateCustomerAndSubscribeToPlan(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	if txn.Args[0] != int64(2400) || txn.Args[1] != "usd" {
+		t.Errorf("recorded a transaction of %v %v", txn.Args[0], txn.Args[1])
+	}
+	if order.Args[5] != int64(2400) {
+		t.Errorf("recorded an order of %v", order.Args[5])
+	}
+}
@@ -6,19 +6,22 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
+	"go-commerce/internal/apierror"
+	"go-commerce/internal/apispec"
 	"go-commerce/internal/models"
+	"go-commerce/internal/validator"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-type APIResponse struct {
-	HasError bool `json:"has_error"`
-	Message string `json:"message,omitempty"`
-}
-
 // SaveCustomer saves customer and returns customer's id
 func (app *application) SaveCustomer(firstName, lastName, email string) (int, error) {
 	customer := models.Customer{
@@ -53,20 +56,44 @@ func (app *application) SaveOrder(order models.Order) (int, error) {
 	return order_id, nil
 }
 
+// readJSON decodes a single JSON value of at most 1MB from the request body into data.
+// Decoding errors are turned into client-safe bad request errors.
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, data interface{}) error {
-	var maxBytes int64 = 1048576
+	return app.readJSONLimit(w, r, data, 1048576)
+}
+
+// readJSONLimit is readJSON for bodies of up to maxBytes, like uploads sent as base64
+func (app *application) readJSONLimit(w http.ResponseWriter, r *http.Request, data interface{}, maxBytes int64) error {
 	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
 
 	decoder := json.NewDecoder(r.Body)
 	err := decoder.Decode(data)
 	if err != nil {
-		return err
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return apierror.BadRequest(fmt.Sprintf("body contains badly-formed JSON (at character %d)", syntaxError.Offset))
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return apierror.BadRequest("body contains badly-formed JSON")
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return apierror.Validation(map[string]string{unmarshalTypeError.Field: "has the wrong type"})
+			}
+			return apierror.BadRequest(fmt.Sprintf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset))
+		case errors.Is(err, io.EOF):
+			return apierror.BadRequest("body must not be empty")
+		case err.Error() == "http: request body too large":
+			return apierror.BadRequest(fmt.Sprintf("body must not be larger than %d bytes", maxBytes))
+		default:
+			return apierror.BadRequest("body could not be decoded")
+		}
 	}
 
 	err = decoder.Decode(&struct{}{})
 	if err != io.EOF {
-		fmt.Println(err.Error())
-		return errors.New("request body must only have one single JSON value")
+		return apierror.BadRequest("request body must only have one single JSON value")
 	}
 
 	return nil
@@ -85,21 +112,14 @@ func (app *application) writeJSON(w http.ResponseWriter, data interface{}, statu
 			}
 		}
 	}
-	w.WriteHeader(statuscode)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statuscode)
 	w.Write(out)
 	return nil
 }
 
-func (app *application) invalidCredentials(w http.ResponseWriter) error {
-	payload := APIResponse{
-		HasError: true,
-		Message: "invalid authentication credentials",
-	}
-	if err := app.writeJSON(w, payload, http.StatusUnauthorized); err != nil {
-		return err
-	}
-	return nil
+func (app *application) invalidCredentials(w http.ResponseWriter, r *http.Request) error {
+	return app.errorJSON(w, r, apierror.Unauthorized("invalid authentication credentials"))
 }
 
 func (app *application) passwordMatches(hash, password string) (bool, error) {
@@ -116,15 +136,111 @@ func (app *application) passwordMatches(hash, password string) (bool, error) {
 	return true, nil
 }
 
-func (app *application) badRequest(w http.ResponseWriter, err error) error {
-	payload := APIResponse{
+// errorJSON writes err to the client as a JSON error envelope. Errors that are not
+// an *apierror.Error are logged and reported as internal errors, so their text is
+// never sent to the client.
+func (app *application) errorJSON(w http.ResponseWriter, r *http.Request, err error) error {
+	apiErr := apierror.From(err)
+	if apiErr.Err != nil {
+		app.errorLog.Printf("request %s: %v", middleware.GetReqID(r.Context()), apiErr.Err)
+	}
+
+	payload := apispec.ErrorResponse{
 		HasError: true,
-		Message: err.Error(),
+		Message:  apiErr.Message,
+		Error:    apiErr.WithMessage(apiErr.Message),
 	}
-	if err := app.writeJSON(w, payload, http.StatusBadRequest); err != nil {
-		return err
+	payload.Error.RequestID = middleware.GetReqID(r.Context())
+
+	w.Header().Set("X-Request-Id", payload.Error.RequestID)
+	return app.writeJSON(w, payload, apiErr.Status)
+}
+
+// readIDParam reads the {id} URL parameter as an int
+func (app *application) readIDParam(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id < 1 {
+		return 0, apierror.BadRequest("invalid id parameter")
 	}
-	return nil
+	return id, nil
+}
+
+// readListParams reads the sort, page, page_size and cursor query parameters
+func (app *application) readListParams(r *http.Request, v *validator.Validator) models.ListParams {
+	qs := r.URL.Query()
+	p := models.ListParams{
+		Sort:     qs.Get("sort"),
+		Page:     app.readQueryInt(qs, "page", v),
+		PageSize: app.readQueryInt(qs, "page_size", v),
+		Cursor:   qs.Get("cursor"),
+	}
+	v.CheckInt("page", p.Page, validator.Min(0))
+	v.CheckInt("page_size", p.PageSize, validator.Min(0), validator.Max(100))
+	return p
+}
+
+// readOrderFilter reads the query parameters that filter sales and subscriptions.
+// Dates are YYYY-MM-DD and the to date is inclusive.
+func (app *application) readOrderFilter(r *http.Request, v *validator.Validator) models.OrderFilter {
+	qs := r.URL.Query()
+	f := models.OrderFilter{
+		From:      app.readQueryDate(qs, "from", v),
+		To:        app.readQueryDate(qs, "to", v),
+		StatusID:  app.readQueryInt(qs, "status", v),
+		WidgetID:  app.readQueryInt(qs, "widget_id", v),
+		Email:     strings.TrimSpace(qs.Get("email")),
+		LastFour:  qs.Get("last_four"),
+		MinAmount: app.readQueryInt(qs, "min_amount", v),
+		MaxAmount: app.readQueryInt(qs, "max_amount", v),
+		Currency:  strings.ToLower(qs.Get("currency")),
+	}
+	if !f.To.IsZero() {
+		f.To = f.To.AddDate(0, 0, 1)
+	}
+	if s := qs.Get("fulfillment_status"); s != "" {
+		id, ok := models.FulfillmentStatusID(s)
+		if !ok {
+			v.AddError("fulfillment_status", "must be pending, picking, shipped, delivered or returned")
+		}
+		f.FulfillmentStatusID = id
+	}
+
+	v.Check("last_four", f.LastFour, validator.Optional(validator.Length(4), validator.Digits))
+	v.Check("currency", f.Currency, validator.Optional(validator.Currency))
+	v.CheckInt("min_amount", f.MinAmount, validator.Min(0))
+	v.CheckInt("max_amount", f.MaxAmount, validator.Min(0))
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		v.AddError("to", "must not be before from")
+	}
+	return f
+}
+
+// readQueryInt reads an optional integer query parameter, returning 0 when it is absent
+func (app *application) readQueryInt(qs url.Values, key string, v *validator.Validator) int {
+	s := qs.Get(key)
+	if s == "" {
+		return 0
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer")
+		return 0
+	}
+	return i
+}
+
+// readQueryDate reads an optional YYYY-MM-DD query parameter, returning the zero time when it is absent
+func (app *application) readQueryDate(qs url.Values, key string, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		v.AddError(key, "must be a date in the format YYYY-MM-DD")
+		return time.Time{}
+	}
+	return t
 }
 
 func (app *application) authenticateToken(r *http.Request) (*models.User, error) {
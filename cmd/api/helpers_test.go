@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-commerce/internal/validator"
+)
+
+// errorEnvelope is the body of error responses
+type errorEnvelope struct {
+	HasError bool   `json:"has_error"`
+	Message  string `json:"message"`
+	Error    struct {
+		Code      string            `json:"code"`
+		Message   string            `json:"message"`
+		Fields    map[string]string `json:"fields"`
+		RequestID string            `json:"request_id"`
+	} `json:"error"`
+}
+
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) errorEnvelope {
+	t.Helper()
+	var e errorEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &e); err != nil {
+		t.Fatalf("error response is not JSON: %v: %s", err, rec.Body)
+	}
+	return e
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	rec := serve(newTestApp(), http.MethodPost, "/api/v1/tokens", "{")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	e := decodeError(t, rec)
+	if !e.HasError || e.Error.Code != "bad_request" || e.Message != e.Error.Message {
+		t.Errorf("got %+v", e)
+	}
+	if e.Error.RequestID == "" || e.Error.RequestID != rec.Header().Get("X-Request-Id") {
+		t.Errorf("request ID %q does not match the X-Request-Id header %q", e.Error.RequestID, rec.Header().Get("X-Request-Id"))
+	}
+}
+
+func TestErrorJSONHidesInternalErrors(t *testing.T) {
+	var logged strings.Builder
+	app := newTestApp()
+	app.errorLog.SetOutput(&logged)
+
+	rec := httptest.NewRecorder()
+	app.errorJSON(rec, httptest.NewRequest(http.MethodGet, "/", nil), errors.New("Error 1045: access denied for user shop"))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if e := decodeError(t, rec); e.Error.Code != "internal_error" || strings.Contains(rec.Body.String(), "1045") {
+		t.Errorf("internal error leaked to the client: %s", rec.Body)
+	}
+	if !strings.Contains(logged.String(), "access denied") {
+		t.Errorf("internal error was not logged: %q", logged.String())
+	}
+}
+
+func TestReadListParams(t *testing.T) {
+	app := newTestApp()
+
+	v := validator.New()
+	p := app.readListParams(httptest.NewRequest(http.MethodGet, "/api/v1/sales?sort=-amount&page=2&page_size=50", nil), v)
+	if !v.Valid() || p.Sort != "-amount" || p.Page != 2 || p.PageSize != 50 {
+		t.Errorf("got %+v, %v", p, v.Errors)
+	}
+
+	v = validator.New()
+	app.readListParams(httptest.NewRequest(http.MethodGet, "/api/v1/sales?page=two&page_size=500", nil), v)
+	if v.Errors["page"] == "" || v.Errors["page_size"] == "" {
+		t.Errorf("got errors %v", v.Errors)
+	}
+}
+
+func TestReadOrderFilter(t *testing.T) {
+	app := newTestApp()
+
+	v := validator.New()
+	f := app.readOrderFilter(httptest.NewRequest(http.MethodGet, "/api/v1/sales?from=2026-10-01&to=2026-10-19&currency=EUR&email=+ada+", nil), v)
+	if !v.Valid() {
+		t.Fatalf("got errors %v", v.Errors)
+	}
+	if !f.From.Equal(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)) || !f.To.Equal(time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("the to date is not inclusive: from %s to %s", f.From, f.To)
+	}
+	if f.Currency != "eur" || f.Email != "ada" {
+		t.Errorf("got currency %q and email %q", f.Currency, f.Email)
+	}
+
+	v = validator.New()
+	app.readOrderFilter(httptest.NewRequest(http.MethodGet, "/api/v1/sales?from=2026-10-19&to=2026-10-01&last_four=42a&min_amount=-1&status=x", nil), v)
+	for _, field := range []string{"to", "last_four", "min_amount", "status"} {
+		if v.Errors[field] == "" {
+			t.Errorf("no error for %s in %v", field, v.Errors)
+		}
+	}
+}
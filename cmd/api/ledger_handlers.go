@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-commerce/internal/validator"
+)
+
+// ledgerUnpostedAfter is how long a money movement can go without a journal entry before
+// the ledger check reports it
+const ledgerUnpostedAfter = time.Hour
+
+// postLedger posts every interval the money movements made since the last run to the
+// ledger
+func (app *application) postLedger(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		n, err := app.DB.PostLedger(ctx, time.Now())
+		if err != nil {
+			app.errorLog.Printf("posting the ledger: %v", err)
+		}
+		if n > 0 {
+			app.infoLog.Printf("%d journal entries posted", n)
+		}
+		cancel()
+
+		<-ticker.C
+	}
+}
+
+// GetTrialBalance returns the balance of every ledger account at the end of a day, today
+// by default, in one currency, the base currency by default
+func (app *application) GetTrialBalance(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+	to := app.readQueryDate(qs, "to", v)
+	currency := strings.ToLower(qs.Get("currency"))
+	if currency == "" {
+		currency = app.config.baseCurrency
+	}
+	v.Check("currency", currency, validator.Currency)
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+	if to.IsZero() {
+		to = time.Now().UTC().Truncate(24 * time.Hour)
+	}
+
+	tb, err := app.DB.GetTrialBalance(to.AddDate(0, 0, 1), currency)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, tb, http.StatusOK)
+}
+
+// GetLedgerCheck checks the ledger and returns what is wrong with it
+func (app *application) GetLedgerCheck(w http.ResponseWriter, r *http.Request) {
+	check, err := app.DB.CheckLedger(ledgerUnpostedAfter)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, check, http.StatusOK)
+}
@@ -1,14 +1,28 @@
 package main
 
-import "net/http"
+import (
+	"fmt"
+	"net/http"
+)
 
 func (app *application) Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		_, err := app.authenticateToken(r)
 		if err != nil {
-			app.invalidCredentials(w)
+			app.invalidCredentials(w, r)
 			return
 		}
 		next.ServeHTTP(w,r)
 	})
 }
+
+// deprecated marks a legacy route as deprecated and points clients at its successor
+func (app *application) deprecated(successor string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"go-commerce/internal/apispec"
+
+	"github.com/go-chi/chi/v5"
+)
+
+//go:embed docs/index.html
+var apiDocsPage []byte
+
+// docRoutes serve the documentation itself and are not part of the specification
+var docRoutes = map[string]bool{
+	"GET /api/openapi.json": true,
+	"GET /api/docs":         true,
+}
+
+// OpenAPISpec serves the OpenAPI document of the API
+func (app *application) OpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	out, err := apispec.JSON()
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// APIDocs serves the API reference page, rendered from the OpenAPI document
+func (app *application) APIDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(apiDocsPage)
+}
+
+// checkRoutesDocumented compares the routes registered on routes with apispec.Operations
+// and returns an error listing every route that is undocumented or documented but not served
+func checkRoutesDocumented(routes chi.Routes) error {
+	served := make(map[string]bool)
+	var problems []string
+
+	err := chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		key := method + " " + route
+		if docRoutes[key] {
+			return nil
+		}
+		served[key] = true
+		if _, ok := apispec.Find(method, route); !ok {
+			problems = append(problems, "undocumented route "+key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, op := range apispec.Operations {
+		if !served[op.Method+" "+op.Path] {
+			problems = append(problems, "documented route "+op.Method+" "+op.Path+" is not served")
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("API routes and OpenAPI specification are out of sync:\n\t%s", strings.Join(problems, "\n\t"))
+	}
+	return nil
+}
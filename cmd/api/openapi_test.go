@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRoutesDocumented(t *testing.T) {
+	app := &application{}
+	if err := checkRoutesDocumented(app.routes().(chi.Routes)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRoutesDocumentedFindsUndocumented(t *testing.T) {
+	app := &application{}
+	mux := app.routes().(*chi.Mux)
+	mux.Get("/api/v1/not-documented", func(w http.ResponseWriter, r *http.Request) {})
+
+	err := checkRoutesDocumented(mux)
+	if err == nil || !strings.Contains(err.Error(), "undocumented route GET /api/v1/not-documented") {
+		t.Fatalf("got %v, want the undocumented route reported", err)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go-commerce/internal/apierror"
+	"go-commerce/internal/apispec"
+	"go-commerce/internal/models"
+	"go-commerce/internal/payment"
+	"go-commerce/internal/validator"
+
+	"github.com/stripe/stripe-go/v72"
+)
+
+const (
+	defaultPayoutDays = 30
+	maxPayoutDays     = 366
+	maxImportDays     = 92
+)
+
+// syncPayout imports the payout of a payout.* webhook event
+func (app *application) syncPayout(event stripe.Event) (string, error) {
+	var po stripe.Payout
+	if err := json.Unmarshal(event.Data.Raw, &po); err != nil {
+		return "", apierror.BadRequest("the event does not hold a payout")
+	}
+
+	n, err := app.importPayout(&po)
+	if err != nil {
+		return "", err
+	}
+	app.infoLog.Printf("payout %s is %s, %d balance transactions imported", po.ID, po.Status, n)
+
+	return "payout imported", nil
+}
+
+// importPayout saves a payout and, once it is paid, the balance transactions it paid
+// out, and returns how many balance transactions were imported. Stripe only lists the
+// balance transactions of automatic payouts, so manual payouts are saved alone.
+func (app *application) importPayout(po *stripe.Payout) (int, error) {
+	var txns []models.BalanceTransaction
+	if string(po.Status) == models.PayoutPaid && po.Automatic {
+		payConf := app.payConfig()
+		bts, err := payConf.PayoutBalanceTransactions(po.ID)
+		if err != nil {
+			return 0, apierror.Gateway("could not list the balance transactions of payout "+po.ID, err)
+		}
+		for _, bt := range bts {
+			txns = append(txns, balanceTransactionFromStripe(bt))
+		}
+	}
+
+	if _, err := app.DB.ImportPayout(payoutFromStripe(po), txns); err != nil {
+		return 0, err
+	}
+	return len(txns), nil
+}
+
+// payoutFromStripe converts a Stripe payout
+func payoutFromStripe(po *stripe.Payout) models.Payout {
+	return models.Payout{
+		StripePayoutID: po.ID,
+		Amount:         int(po.Amount),
+		Currency:       string(po.Currency),
+		Status:         string(po.Status),
+		Automatic:      po.Automatic,
+		ArrivalDate:    time.Unix(po.ArrivalDate, 0),
+		InitiatedAt:    time.Unix(po.Created, 0),
+	}
+}
+
+// balanceTransactionFromStripe converts a Stripe balance transaction listed with its
+// source
+func balanceTransactionFromStripe(bt *stripe.BalanceTransaction) models.BalanceTransaction {
+	t := models.BalanceTransaction{
+		StripeBalanceTransactionID: bt.ID,
+		Type:                       string(bt.Type),
+		ChargeID:                   payment.SourceChargeID(bt),
+		Amount:                     int(bt.Amount),
+		Fee:                        int(bt.Fee),
+		Net:                        int(bt.Net),
+		Currency:                   string(bt.Currency),
+		Description:                bt.Description,
+		AvailableOn:                time.Unix(bt.AvailableOn, 0),
+		OccurredAt:                 time.Unix(bt.Created, 0),
+	}
+	if bt.Source != nil {
+		t.SourceID = bt.Source.ID
+	}
+	return t
+}
+
+// ListPayouts returns the payouts that arrive in a period, 30 days up to today by
+// default, with their gross, refunds, fees and net
+func (app *application) ListPayouts(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+	from := app.readQueryDate(qs, "from", v)
+	to := app.readQueryDate(qs, "to", v)
+	if to.IsZero() {
+		to = time.Now().UTC().Truncate(24 * time.Hour)
+	}
+	to = to.AddDate(0, 0, 1)
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -defaultPayoutDays)
+	}
+	if !from.Before(to) {
+		v.AddError("to", "must not be before from")
+	} else if to.Sub(from) > maxPayoutDays*24*time.Hour {
+		v.AddError("from", "period must not be longer than a year")
+	}
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	payouts, err := app.DB.GetPayouts(from, to)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	resp := apispec.PayoutList{
+		From:    from.Format("2006-01-02"),
+		To:      to.AddDate(0, 0, -1).Format("2006-01-02"),
+		Payouts: payouts,
+	}
+	app.writeJSON(w, resp, http.StatusOK)
+}
+
+// GetPayout returns the payout identified in the URL with its balance transactions
+func (app *application) GetPayout(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	payout, err := app.DB.GetPayout(id)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, payout, http.StatusOK)
+}
+
+// CreatePayoutImport imports the payouts created in a period from Stripe, to catch up
+// on payouts made before the webhook was set up or whose events were missed. Payouts
+// already imported are updated.
+func (app *application) CreatePayoutImport(w http.ResponseWriter, r *http.Request) {
+	var payload apispec.PayoutImportRequest
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check("from", payload.From, validator.Required)
+	v.Check("to", payload.To, validator.Required)
+	from, err := time.Parse("2006-01-02", payload.From)
+	if payload.From != "" && err != nil {
+		v.AddError("from", "must be a date in the format YYYY-MM-DD")
+	}
+	to, err := time.Parse("2006-01-02", payload.To)
+	if payload.To != "" && err != nil {
+		v.AddError("to", "must be a date in the format YYYY-MM-DD")
+	}
+	to = to.AddDate(0, 0, 1)
+	if v.Valid() {
+		if !from.Before(to) {
+			v.AddError("to", "must not be before from")
+		} else if to.Sub(from) > maxImportDays*24*time.Hour {
+			v.AddError("from", "at most 92 days can be imported at once")
+		}
+	}
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	payConf := app.payConfig()
+	payouts, err := payConf.ListPayouts(from, to)
+	if err != nil {
+		app.errorJSON(w, r, apierror.Gateway("could not list payouts", err))
+		return
+	}
+
+	var resp apispec.PayoutImport
+	for _, po := range payouts {
+		n, err := app.importPayout(po)
+		if err != nil {
+			app.errorJSON(w, r, err)
+			return
+		}
+		resp.Payouts++
+		resp.BalanceTransactions += n
+	}
+
+	app.writeJSON(w, resp, http.StatusCreated)
+}
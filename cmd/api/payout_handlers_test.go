@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-commerce/internal/dbtest"
+
+	"github.com/stripe/stripe-go/v72"
+)
+
+func TestBalanceTransactionFromStripe(t *testing.T) {
+	bt := balanceTransactionFromStripe(&stripe.BalanceTransaction{
+		ID:     "txn_1",
+		Type:   stripe.BalanceTransactionTypeRefund,
+		Amount: -500,
+		Net:    -500,
+		Source: &stripe.BalanceTransactionSource{ID: "re_1", Refund: &stripe.Refund{Charge: &stripe.Charge{ID: "ch_1"}}},
+	})
+	if bt.StripeBalanceTransactionID != "txn_1" || bt.Type != "refund" || bt.SourceID != "re_1" || bt.ChargeID != "ch_1" || bt.Amount != -500 {
+		t.Errorf("got %+v", bt)
+	}
+}
+
+func TestCreateStripeEventImportsPayouts(t *testing.T) {
+	fakeStripe(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/balance_transactions" || r.URL.Query().Get("payout") != "po_1" {
+			t.Errorf("got request for %s", r.URL)
+		}
+		fmt.Fprint(w, `{"object": "list", "has_more": false, "data": [
+			{"id": "txn_po", "object": "balance_transaction", "type": "payout", "amount": -2412},
+			{"id": "txn_1", "object": "balance_transaction", "type": "charge", "amount": 2500, "fee": 88, "net": 2412,
+				"source": {"id": "ch_1", "object": "charge"}}]}`)
+	})
+	app, db := newDBApp(t)
+	app.config.stripe.webhookSecret = testWebhookSecret
+	db.Expect("insert into payouts").WithArgs("po_1", 2412, "usd", "paid", true, dbtest.Any, dbtest.Any, dbtest.Any, dbtest.Any).Result(4, 1)
+	db.Expect("where bank_return_code = ?").WithArgs("ch_1").Rows([]interface{}{3})
+	db.Expect("insert into balance_transactions").WithArgs("txn_1", 4, 3, "charge", "ch_1", "ch_1", 2500, 88, 2412,
+		dbtest.Any, dbtest.Any, dbtest.Any, dbtest.Any, dbtest.Any, dbtest.Any)
+	db.Expect("update transactions set fee = ?").WithArgs(88, dbtest.Any, 3)
+
+	payout := map[string]interface{}{"id": "po_1", "object": "payout", "amount": 2412, "currency": "usd", "status": "paid", "automatic": true}
+	rec := httptest.NewRecorder()
+	app.CreateStripeEvent(rec, stripeEvent(t, "payout.paid", payout))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "payout imported") {
+		t.Errorf("got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCreateStripeEventSavesPendingPayouts(t *testing.T) {
+	fakeStripe(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("got request for %s", r.URL)
+	})
+	app, db := newDBApp(t)
+	app.config.stripe.webhookSecret = testWebhookSecret
+	db.Expect("insert into payouts").WithArgs("po_1", 2412, "usd", "in_transit", true, dbtest.Any, dbtest.Any, dbtest.Any, dbtest.Any).Result(4, 1)
+
+	payout := map[string]interface{}{"id": "po_1", "object": "payout", "amount": 2412, "currency": "usd", "status": "in_transit", "automatic": true}
+	rec := httptest.NewRecorder()
+	app.CreateStripeEvent(rec, stripeEvent(t, "payout.updated", payout))
+	if rec.Code != http.StatusOK {
+		t.Errorf("got %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-commerce/internal/apierror"
+	"go-commerce/internal/apispec"
+	"go-commerce/internal/models"
+	"go-commerce/internal/money"
+	"go-commerce/internal/validator"
+)
+
+const (
+	defaultReportDays = 30
+	maxReportDays     = 731
+	maxRebuildDays    = 366
+)
+
+// reportPeriod is the period and currency of a report. To is exclusive.
+type reportPeriod struct {
+	from     time.Time
+	to       time.Time
+	currency models.ReportCurrency
+}
+
+// fromDay and toDay return the first and last day of the period as YYYY-MM-DD
+func (p reportPeriod) fromDay() string { return p.from.Format("2006-01-02") }
+func (p reportPeriod) toDay() string   { return p.to.AddDate(0, 0, -1).Format("2006-01-02") }
+
+// readReportPeriod reads the from, to and currency query parameters. Both dates are
+// inclusive and the period defaults to the last 30 days. Without a currency, the report
+// covers every currency, converted into the base currency.
+func (app *application) readReportPeriod(r *http.Request, v *validator.Validator) reportPeriod {
+	qs := r.URL.Query()
+	p := reportPeriod{
+		from: app.readQueryDate(qs, "from", v),
+		to:   app.readQueryDate(qs, "to", v),
+		currency: models.ReportCurrency{
+			Code: strings.ToLower(qs.Get("currency")),
+		},
+	}
+
+	if p.to.IsZero() {
+		p.to = time.Now().UTC().Truncate(24 * time.Hour)
+	}
+	p.to = p.to.AddDate(0, 0, 1)
+	if p.from.IsZero() {
+		p.from = p.to.AddDate(0, 0, -defaultReportDays)
+	}
+	if p.currency.Code == "" {
+		p.currency = models.ReportCurrency{Code: app.config.baseCurrency, Convert: true}
+	}
+
+	v.Check("currency", p.currency.Code, validator.Currency)
+	if !p.from.Before(p.to) {
+		v.AddError("to", "must not be before from")
+	} else if p.to.Sub(p.from) > maxReportDays*24*time.Hour {
+		v.AddError("from", "period must not be longer than two years")
+	}
+	return p
+}
+
+// reportError explains a report that cannot be converted for lack of an exchange rate
+func (app *application) reportError(err error) error {
+	if errors.Is(err, money.ErrNoRate) {
+		return apierror.Conflict(err.Error() + "; add the rate under /api/v1/fx-rates or report in a single currency")
+	}
+	return err
+}
+
+// GetReportSummary returns the headline figures of a period
+func (app *application) GetReportSummary(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	p := app.readReportPeriod(r, v)
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	summary, err := app.DB.GetReportSummary(p.from, p.to, p.currency)
+	if err != nil {
+		app.errorJSON(w, r, app.reportError(err))
+		return
+	}
+
+	app.writeJSON(w, summary, http.StatusOK)
+}
+
+// GetRevenueReport returns the daily sales of a period
+func (app *application) GetRevenueReport(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	p := app.readReportPeriod(r, v)
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	days, err := app.DB.GetRevenueByDay(p.from, p.to, p.currency)
+	if err != nil {
+		app.errorJSON(w, r, app.reportError(err))
+		return
+	}
+
+	resp := apispec.RevenueReport{
+		From:      p.fromDay(),
+		To:        p.toDay(),
+		Currency:  p.currency.Code,
+		Converted: p.currency.Convert,
+		Days:      days,
+	}
+	app.writeJSON(w, resp, http.StatusOK)
+}
+
+// GetSubscriptionReport returns the daily subscription snapshots of a period
+func (app *application) GetSubscriptionReport(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	p := app.readReportPeriod(r, v)
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	days, err := app.DB.GetSubscriptionsByDay(p.from, p.to, p.currency)
+	if err != nil {
+		app.errorJSON(w, r, app.reportError(err))
+		return
+	}
+
+	resp := apispec.SubscriptionReport{
+		From:      p.fromDay(),
+		To:        p.toDay(),
+		Currency:  p.currency.Code,
+		Converted: p.currency.Convert,
+		Days:      days,
+	}
+	app.writeJSON(w, resp, http.StatusOK)
+}
+
+// GetDisputeReport returns the disputes opened in a period and the dispute rate
+func (app *application) GetDisputeReport(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	p := app.readReportPeriod(r, v)
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	report, err := app.DB.GetDisputeReport(p.from, p.to, p.currency)
+	if err != nil {
+		app.errorJSON(w, r, app.reportError(err))
+		return
+	}
+
+	app.writeJSON(w, report, http.StatusOK)
+}
+
+// GetTopWidgetsReport returns the best selling widgets of a period
+func (app *application) GetTopWidgetsReport(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	p := app.readReportPeriod(r, v)
+	limit := app.readQueryInt(r.URL.Query(), "limit", v)
+	if limit == 0 {
+		limit = 5
+	}
+	v.CheckInt("limit", limit, validator.Min(1), validator.Max(50))
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	widgets, err := app.DB.GetTopWidgets(p.from, p.to, p.currency, limit)
+	if err != nil {
+		app.errorJSON(w, r, app.reportError(err))
+		return
+	}
+
+	resp := apispec.TopWidgetsReport{
+		From:      p.fromDay(),
+		To:        p.toDay(),
+		Currency:  p.currency.Code,
+		Converted: p.currency.Convert,
+		Widgets:   widgets,
+	}
+	app.writeJSON(w, resp, http.StatusOK)
+}
+
+// RebuildReportRollups recomputes the rollups of a range of days, e.g. after importing
+// orders or to backfill the tables for orders placed before they existed
+func (app *application) RebuildReportRollups(w http.ResponseWriter, r *http.Request) {
+	var payload apispec.RollupRebuild
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check("from", payload.From, validator.Required)
+	v.Check("to", payload.To, validator.Required)
+	from, err := time.Parse("2006-01-02", payload.From)
+	if payload.From != "" && err != nil {
+		v.AddError("from", "must be a date in the format YYYY-MM-DD")
+	}
+	to, err := time.Parse("2006-01-02", payload.To)
+	if payload.To != "" && err != nil {
+		v.AddError("to", "must be a date in the format YYYY-MM-DD")
+	}
+	to = to.AddDate(0, 0, 1)
+	if v.Valid() {
+		if !from.Before(to) {
+			v.AddError("to", "must not be before from")
+		} else if to.Sub(from) > maxRebuildDays*24*time.Hour {
+			v.AddError("from", "at most 366 days can be rebuilt at once")
+		}
+	}
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+	defer cancel()
+
+	if err := app.DB.RefreshRollups(ctx, from, to); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	resp := apispec.Response{
+		Message: "report rollups rebuilt from " + payload.From + " to " + payload.To,
+	}
+	app.writeJSON(w, resp, http.StatusOK)
+}
+
+// refreshRollups recomputes the rollups of yesterday and today every interval, so
+// reports lag behind new orders, refunds and cancellations by at most interval.
+// Yesterday is included so changes made just before midnight are not missed.
+func (app *application) refreshRollups(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if err := app.DB.RefreshRollups(ctx, today.AddDate(0, 0, -1), today.AddDate(0, 0, 1)); err != nil {
+			app.errorLog.Printf("refreshing report rollups: %v", err)
+		}
+		cancel()
+
+		<-ticker.C
+	}
+}
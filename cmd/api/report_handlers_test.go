@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-commerce/internal/models"
+	"go-commerce/internal/validator"
+)
+
+func TestReadReportPeriod(t *testing.T) {
+	app := newTestApp()
+	app.config.baseCurrency = "usd"
+
+	v := validator.New()
+	p := app.readReportPeriod(httptest.NewRequest(http.MethodGet, "/?from=2026-10-01&to=2026-10-31&currency=EUR", nil), v)
+	if !v.Valid() {
+		t.Fatalf("got errors %v", v.Errors)
+	}
+	if p.fromDay() != "2026-10-01" || p.toDay() != "2026-10-31" || p.currency != (models.ReportCurrency{Code: "eur"}) {
+		t.Errorf("got %s to %s in %+v", p.fromDay(), p.toDay(), p.currency)
+	}
+	if !p.to.Equal(time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("to is not exclusive: %s", p.to)
+	}
+
+	v = validator.New()
+	p = app.readReportPeriod(httptest.NewRequest(http.MethodGet, "/", nil), v)
+	if !v.Valid() || p.currency != (models.ReportCurrency{Code: "usd", Convert: true}) || p.to.Sub(p.from) != defaultReportDays*24*time.Hour {
+		t.Errorf("got defaults %+v, errors %v", p, v.Errors)
+	}
+
+	for target, field := range map[string]string{
+		"/?from=2026-10-31&to=2026-10-01": "to",
+		"/?from=2023-01-01&to=2026-10-01": "from",
+		"/?currency=euro":                 "currency",
+	} {
+		v = validator.New()
+		app.readReportPeriod(httptest.NewRequest(http.MethodGet, target, nil), v)
+		if v.Errors[field] == "" {
+			t.Errorf("%s: no error for %s in %v", target, field, v.Errors)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go-commerce/internal/apierror"
+	"go-commerce/internal/apispec"
+	"go-commerce/internal/models"
+	"go-commerce/internal/payment"
+	"go-commerce/internal/validator"
+)
+
+// openReturn opens a return of items of order and returns it with its items and history
+func (app *application) openReturn(order models.Order, p apispec.ReturnRequest, userID int) (models.Return, error) {
+	ret := models.Return{
+		OrderID: order.ID,
+		Reason:  strings.TrimSpace(p.Reason),
+		UserID:  userID,
+	}
+	for _, item := range p.Items {
+		if item.WidgetID == 0 {
+			item.WidgetID = order.WidgetID
+		}
+		ret.Items = append(ret.Items, &models.ReturnItem{WidgetID: item.WidgetID, Quantity: item.Quantity})
+	}
+
+	id, err := app.DB.InsertReturn(ret)
+	switch {
+	case errors.Is(err, models.ErrNotReturnable):
+		return ret, apierror.Conflict(err.Error())
+	case errors.Is(err, models.ErrReturnItem), errors.Is(err, models.ErrReturnQuantity):
+		return ret, apierror.Validation(map[string]string{"items": err.Error()})
+	case err != nil:
+		return ret, err
+	}
+
+	return app.DB.GetReturn(id)
+}
+
+// CreateReturn opens a return for a customer. The customer proves the sale is theirs
+// with the email it was bought with; a sale bought with another email is not found.
+func (app *application) CreateReturn(w http.ResponseWriter, r *http.Request) {
+	var payload apispec.ReturnRequest
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	validateReturnRequest(v, payload, true)
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	order, err := app.DB.GetSaleByID(payload.OrderID)
+	if err == nil && !strings.EqualFold(order.Customer.Email, strings.TrimSpace(payload.Email)) {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	ret, err := app.openReturn(order, payload, 0)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, ret, http.StatusCreated)
+}
+
+// ListSaleReturns returns the returns of the sale identified in the URL
+func (app *application) ListSaleReturns(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if _, err := app.DB.GetSaleByID(id); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	returns, err := app.DB.GetReturnsForOrder(id)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, apispec.ReturnList{Returns: returns}, http.StatusOK)
+}
+
+// CreateSaleReturn opens a return of items of the sale identified in the URL
+func (app *application) CreateSaleReturn(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	var payload apispec.ReturnRequest
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	validateReturnRequest(v, payload, false)
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	user, err := app.authenticateToken(r)
+	if err != nil {
+		app.invalidCredentials(w, r)
+		return
+	}
+
+	order, err := app.DB.GetSaleByID(id)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	ret, err := app.openReturn(order, payload, user.ID)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, ret, http.StatusCreated)
+}
+
+// GetReturn returns the return identified in the URL
+func (app *application) GetReturn(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	ret, err := app.DB.GetReturn(id)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, ret, http.StatusOK)
+}
+
+// CreateReturnEvent moves the return identified in the URL to another status. A return
+// is claimed by moving it to refunding, then refunded through Stripe before it is marked
+// refunded. A return left refunding by a failed refund is refunded again with the same
+// idempotency key, so Stripe refunds it only once.
+func (app *application) CreateReturnEvent(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	var payload apispec.ReturnStatusChange
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	status := strings.ToLower(strings.TrimSpace(payload.Status))
+	v := validator.New()
+	v.Check("status", status, validator.Required, validator.In(
+		models.ReturnApproved, models.ReturnRejected, models.ReturnReceived, models.ReturnRefunded, models.ReturnCancelled))
+	v.Check("note", payload.Note, validator.MaxLength(512))
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	user, err := app.authenticateToken(r)
+	if err != nil {
+		app.invalidCredentials(w, r)
+		return
+	}
+
+	ret, err := app.DB.GetReturn(id)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	next := status
+	if status == models.ReturnRefunded && ret.Status != models.ReturnRefunding {
+		next = models.ReturnRefunding
+	}
+	if !models.CanMoveReturn(ret.Status, next) {
+		app.errorJSON(w, r, apierror.Conflict(fmt.Sprintf("a %s return cannot be moved to %s", ret.Status, status)))
+		return
+	}
+
+	var refundID string
+	if status == models.ReturnRefunded {
+		if next == models.ReturnRefunding {
+			// only the request that moves the return to refunding issues its refund
+			err = app.DB.MoveReturn(models.ReturnEvent{
+				ReturnID: id,
+				ToStatus: models.ReturnRefunding,
+				Note:     payload.Note,
+				UserID:   user.ID,
+			})
+			if errors.Is(err, models.ErrReturnTransition) {
+				err = apierror.Conflict(fmt.Sprintf("a %s return cannot be moved to %s", ret.Status, status))
+			}
+			if err != nil {
+				app.errorJSON(w, r, err)
+				return
+			}
+		}
+
+		order, err := app.DB.GetSaleByID(ret.OrderID)
+		if err != nil {
+			app.errorJSON(w, r, err)
+			return
+		}
+
+		payConf := payment.Config{
+			Secret:   app.config.stripe.secret,
+			Key:      app.config.stripe.key,
+			Currency: order.Transaction.Currency,
+		}
+		refundID, err = payConf.Refund(order.Transaction.PaymentIntent, ret.Amount, fmt.Sprintf("return:%d:refund", id))
+		if err != nil {
+			app.errorJSON(w, r, apierror.Gateway("could not refund charge", err))
+			return
+		}
+	}
+
+	err = app.DB.MoveReturn(models.ReturnEvent{
+		ReturnID: id,
+		ToStatus: status,
+		Note:     payload.Note,
+		UserID:   user.ID,
+	})
+	switch {
+	case errors.Is(err, models.ErrReturnTransition):
+		app.errorJSON(w, r, apierror.Conflict(fmt.Sprintf("a %s return cannot be moved to %s", ret.Status, status)))
+		return
+	case err != nil && status == models.ReturnRefunded:
+		app.errorJSON(w, r, apierror.Internal(err).WithMessage("charge has been refunded but could not update in database"))
+		return
+	case err != nil:
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	ret, err = app.DB.GetReturn(id)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	if status == models.ReturnRefunded {
+		reason := "Return"
+		if ret.Reason != "" {
+			reason += ": " + ret.Reason
+		}
+		go app.sendCreditNote(r.Header.Get("Authorization"), ret.OrderID, ret.Amount, refundID, reason, returnedItems(ret))
+	}
+
+	app.writeJSON(w, ret, http.StatusCreated)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-commerce/internal/dbtest"
+	"go-commerce/internal/models"
+)
+
+// expectReturn makes the next statements find return 4 of sale 5 in status, one widget
+// priced 250
+func expectReturn(db *dbtest.DB, status string) {
+	now := time.Now()
+	db.Expect("from returns r where r.id = ?").WithArgs(4).Rows([]interface{}{4, 5, status, "", 250, 0, now, now})
+	db.Expect("from return_items ri").WithArgs(4).Rows([]interface{}{1, 4, 1, "Widget", 1, 250, now, now})
+	db.Expect("from return_events e").WithArgs(4).NoRows()
+}
+
+// returnEvent returns a request moving return 4 to status
+func returnEvent(status string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(fmt.Sprintf(`{"status": %q}`, status)))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	return withID(req, 4)
+}
+
+func TestCreateReturnEventRefundsOnce(t *testing.T) {
+	// a return left refunding by a failed refund is refunded again without a new claim
+	for _, from := range []string{models.ReturnReceived, models.ReturnRefunding} {
+		fakeStripe(t, func(w http.ResponseWriter, r *http.Request) {
+			if key := r.Header.Get("Idempotency-Key"); key != "return:4:refund" {
+				t.Errorf("from %s: refunded with idempotency key %q", from, key)
+			}
+			r.ParseForm()
+			if got := r.PostForm.Get("amount"); got != "250" {
+				t.Errorf("from %s: refunded %q, want 250", from, got)
+			}
+			fmt.Fprint(w, `{"id": "re_1", "object": "refund"}`)
+		})
+		notes := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			close(notes)
+		}))
+		defer srv.Close()
+
+		app, db := newDBApp(t)
+		app.config.invoiceService = srv.URL
+		expectUser(db, 2)
+		expectReturn(db, from)
+		if from == models.ReturnReceived {
+			db.Expect("for update").WithArgs(4).Rows([]interface{}{5, models.ReturnReceived})
+			db.Expect("update returns set status = ?").WithArgs(models.ReturnRefunding, dbtest.Any, 4)
+			db.Expect("insert into return_events").WithArgs(4, models.ReturnReceived, models.ReturnRefunding, "", int64(2), dbtest.Any, dbtest.Any)
+		}
+		expectSale(db, models.OrderCleared, models.TransactionCleared)
+		db.Expect("for update").WithArgs(4).Rows([]interface{}{5, models.ReturnRefunding})
+		db.Expect("update returns set status = ?").WithArgs(models.ReturnRefunded, dbtest.Any, 4)
+		db.Expect("select sum(r.amount) from returns r").Rows([]interface{}{3, 1000, 250})
+		db.Expect("update transactions set transaction_status_id = ?").WithArgs(models.TransactionPartiallyRefunded, dbtest.Any, 3)
+		db.Expect("insert into return_events").WithArgs(4, models.ReturnRefunding, models.ReturnRefunded, "", int64(2), dbtest.Any, dbtest.Any)
+		expectReturn(db, models.ReturnRefunded)
+		expectSale(db, models.OrderCleared, models.TransactionPartiallyRefunded)
+
+		rec := httptest.NewRecorder()
+		app.CreateReturnEvent(rec, returnEvent(models.ReturnRefunded))
+
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("from %s: got status %d: %s", from, rec.Code, rec.Body)
+		}
+		select {
+		case <-notes:
+		case <-time.After(time.Second):
+			t.Errorf("from %s: no credit note was issued", from)
+		}
+	}
+}
+
+func TestCreateReturnEventLosesClaim(t *testing.T) {
+	fakeStripe(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("got request for %s", r.URL.Path)
+	})
+	app, db := newDBApp(t)
+	expectUser(db, 2)
+	expectReturn(db, models.ReturnReceived)
+	// another request claimed the refund since the return was read
+	db.Expect("for update").WithArgs(4).Rows([]interface{}{5, models.ReturnRefunding})
+
+	rec := httptest.NewRecorder()
+	app.CreateReturnEvent(rec, returnEvent(models.ReturnRefunded))
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	if db.Rollbacks != 1 {
+		t.Errorf("got %d rollbacks", db.Rollbacks)
+	}
+}
@@ -12,38 +12,152 @@ func (app *application) routes() http.Handler {
 	mux := chi.NewRouter()
 	mux.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		ExposedHeaders:   []string{"Deprecation", "Link", "X-Request-Id"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
+	mux.Use(middleware.RequestID)
 	mux.Use(middleware.Logger)
 
-	mux.Post("/api/payment-intent", app.GetPaymentIntent)
-	mux.Get("/api/widget/{id}", app.GetWidgetById)
-	mux.Post("/api/create-customer-and-subscribe-to-plan", app.CreateCustomerAndSubscribeToPlan)
-	mux.Post("/api/authenticate", app.CreateAuthToken)
-	mux.Post("/api/is-authenticated", app.CheckAuthentication)
-	mux.Post("/api/forgot-password", app.SendPasswordResetEmail)
-	mux.Post("/api/reset-password", app.ResetPassword)
+	mux.Get("/api/openapi.json", app.OpenAPISpec)
+	mux.Get("/api/docs", app.APIDocs)
+
+	mux.Route("/api/v1", func(r chi.Router) {
+		r.Post("/payment-intents", app.GetPaymentIntent)
+		r.Get("/widgets/{id}", app.GetWidgetById)
+		r.Get("/currencies", app.ListCurrencies)
+		r.Post("/tax-quotes", app.CreateTaxQuote)
+		r.Post("/shipping-quotes", app.CreateShippingQuote)
+		r.Post("/coupon-checks", app.CreateCouponCheck)
+		r.Post("/returns", app.CreateReturn)
+		r.Post("/stripe-events", app.CreateStripeEvent)
+		r.Post("/subscriptions", app.CreateCustomerAndSubscribeToPlan)
+		r.Post("/tokens", app.CreateAuthToken)
+		r.Get("/tokens/current", app.CheckAuthentication)
+		r.Post("/password-reset-requests", app.SendPasswordResetEmail)
+		r.Post("/password-resets", app.ResetPassword)
+		r.Post("/subscription-card-setups", app.CreateSubscriptionCardSetup)
+		r.Post("/subscription-cards", app.CreateSubscriptionCard)
+		r.Post("/portal-links", app.CreatePortalLink)
+		r.Post("/usage-summaries", app.CreateUsageSummary)
+
+		r.Group(func(r chi.Router) {
+			r.Use(app.Auth)
+			r.Post("/terminal-payments", app.TerminalPaymentSuccessful)
+			r.Get("/customers", app.ListCustomers)
+			r.Post("/customers", app.CreateCustomer)
+			r.Get("/customers/{id}", app.GetCustomer)
+			r.Post("/customers/{id}/setup-intents", app.CreateSetupIntent)
+			r.Post("/customers/{id}/payment-methods", app.CreatePaymentMethod)
+			r.Post("/customers/{id}/charges", app.CreateCustomerCharge)
+			r.Delete("/payment-methods/{id}", app.DeletePaymentMethod)
+
+			r.Get("/sales", app.ListSales)
+			r.Get("/sales/{id}", app.GetSale)
+			r.Post("/sales/{id}/refunds", app.CreateRefund)
+			r.Post("/sales/{id}/captures", app.CreateCapture)
+			r.Post("/sales/{id}/voids", app.CreateVoid)
+			r.Get("/sales/{id}/fulfillment-events", app.ListFulfillmentEvents)
+			r.Post("/sales/{id}/fulfillment-events", app.CreateFulfillmentEvent)
+			r.Post("/shipments", app.CreateShipments)
+			r.Get("/sales/{id}/returns", app.ListSaleReturns)
+			r.Post("/sales/{id}/returns", app.CreateSaleReturn)
+			r.Get("/returns/{id}", app.GetReturn)
+			r.Post("/returns/{id}/events", app.CreateReturnEvent)
+
+			r.Get("/disputes", app.ListDisputes)
+			r.Get("/disputes/{id}", app.GetDispute)
+			r.Put("/disputes/{id}/evidence", app.UpdateDisputeEvidence)
+			r.Post("/disputes/{id}/files", app.CreateDisputeFile)
+			r.Post("/disputes/{id}/submissions", app.CreateDisputeSubmission)
+
+			r.Get("/payouts", app.ListPayouts)
+			r.Get("/payouts/{id}", app.GetPayout)
+			r.Post("/payout-imports", app.CreatePayoutImport)
+
+			r.Get("/subscriptions", app.ListSubscriptions)
+			r.Get("/subscriptions/{id}", app.GetSubscription)
+			r.Delete("/subscriptions/{id}", app.DeleteSubscription)
+			r.Get("/subscriptions/{id}/events", app.ListSubscriptionEvents)
+			r.Get("/subscriptions/{id}/usage", app.GetSubscriptionUsage)
+			r.Post("/usage", app.CreateUsageRecord)
+
+			r.Put("/widgets/{id}/prices/{currency}", app.SetWidgetPrice)
+			r.Delete("/widgets/{id}/prices/{currency}", app.DeleteWidgetPrice)
+			r.Put("/widgets/{id}/weight", app.SetWidgetWeight)
+			r.Put("/widgets/{id}/capture-method", app.SetWidgetCaptureMethod)
+			r.Put("/widgets/{id}/billing", app.SetWidgetBilling)
+
+			r.Get("/fx-rates", app.ListFXRates)
+			r.Post("/fx-rates", app.CreateFXRate)
+
+			r.Get("/tax-rules", app.ListTaxRules)
+			r.Post("/tax-rules", app.CreateTaxRule)
+			r.Delete("/tax-rules/{id}", app.DeleteTaxRule)
+			r.Get("/tax-exemptions", app.ListTaxExemptions)
+			r.Post("/tax-exemptions", app.CreateTaxExemption)
+			r.Delete("/tax-exemptions/{id}", app.DeleteTaxExemption)
+
+			r.Get("/shipping-zones", app.ListShippingZones)
+			r.Post("/shipping-zones", app.CreateShippingZone)
+			r.Delete("/shipping-zones/{id}", app.DeleteShippingZone)
+			r.Get("/shipping-rates", app.ListShippingRates)
+			r.Post("/shipping-rates", app.CreateShippingRate)
+			r.Delete("/shipping-rates/{id}", app.DeleteShippingRate)
+
+			r.Get("/coupons", app.ListCoupons)
+			r.Post("/coupons", app.CreateCoupon)
+			r.Delete("/coupons/{id}", app.DeleteCoupon)
+
+			r.Get("/users", app.ListUsers)
+			r.Post("/users", app.CreateUser)
+			r.Get("/users/{id}", app.OneUser)
+			r.Put("/users/{id}", app.UpdateUser)
+			r.Patch("/users/{id}", app.PatchUser)
+			r.Delete("/users/{id}", app.RemoveUser)
+		})
+	})
+
+	// Deprecated routes, kept as aliases of the /api/v1 surface.
+	mux.With(app.deprecated("/api/v1/payment-intents")).Post("/api/payment-intent", app.GetPaymentIntent)
+	mux.With(app.deprecated("/api/v1/widgets/{id}")).Get("/api/widget/{id}", app.GetWidgetById)
+	mux.With(app.deprecated("/api/v1/subscriptions")).Post("/api/create-customer-and-subscribe-to-plan", app.CreateCustomerAndSubscribeToPlan)
+	mux.With(app.deprecated("/api/v1/tokens")).Post("/api/authenticate", app.CreateAuthToken)
+	mux.With(app.deprecated("/api/v1/tokens/current")).Post("/api/is-authenticated", app.CheckAuthentication)
+	mux.With(app.deprecated("/api/v1/password-reset-requests")).Post("/api/forgot-password", app.SendPasswordResetEmail)
+	mux.With(app.deprecated("/api/v1/password-resets")).Post("/api/reset-password", app.ResetPassword)
 
 	mux.Route("/api/admin", func(r chi.Router) {
 		r.Use(app.Auth)
-		r.Get("/test", func(w http.ResponseWriter, r *http.Request) {
-			w.Write([]byte("right here"))
-		})
-		r.Post("/terminal-payment-successful", app.TerminalPaymentSuccessful)
-		r.Post("/all-sales", app.AllSales)
-		r.Post("/all-subscriptions", app.AllSubscriptions)
-		r.Post("/get-sale/{id}", app.GetSale)
-		r.Post("/get-subscription/{id}", app.GetSubscription)
-		r.Post("/refund", app.RefundCharge)
-		r.Post("/cancel-subscription", app.CancelSubscription)
-		r.Post("/all-users", app.AllUsers)
-		r.Post("/all-users/{id}", app.OneUser)
-		r.Post("/all-users/edit", app.EditUser)
-		r.Post("/all-users/add", app.AddUser)
-		r.Post("/all-users/delete/{id}", app.DeleteUser)
+		r.Get("/sales/export", app.ExportSales)
+		r.Get("/subscriptions/export", app.ExportSubscriptions)
+		r.Get("/refunds/export", app.ExportRefunds)
+		r.Get("/customers/export", app.ExportCustomers)
+		r.Get("/invoices/export", app.ExportInvoices)
+
+		r.Get("/reports/summary", app.GetReportSummary)
+		r.Get("/reports/revenue", app.GetRevenueReport)
+		r.Get("/reports/subscriptions", app.GetSubscriptionReport)
+		r.Get("/reports/top-widgets", app.GetTopWidgetsReport)
+		r.Get("/reports/disputes", app.GetDisputeReport)
+		r.Get("/reports/trial-balance", app.GetTrialBalance)
+		r.Get("/reports/ledger-check", app.GetLedgerCheck)
+		r.Post("/reports/rollups", app.RebuildReportRollups)
+
+		r.With(app.deprecated("/api/v1/terminal-payments")).Post("/terminal-payment-successful", app.TerminalPaymentSuccessful)
+		r.With(app.deprecated("/api/v1/sales")).Post("/all-sales", app.AllSales)
+		r.With(app.deprecated("/api/v1/subscriptions")).Post("/all-subscriptions", app.AllSubscriptions)
+		r.With(app.deprecated("/api/v1/sales/{id}")).Post("/get-sale/{id}", app.GetSale)
+		r.With(app.deprecated("/api/v1/subscriptions/{id}")).Post("/get-subscription/{id}", app.GetSubscription)
+		r.With(app.deprecated("/api/v1/sales/{id}/refunds")).Post("/refund", app.RefundCharge)
+		r.With(app.deprecated("/api/v1/subscriptions/{id}")).Post("/cancel-subscription", app.CancelSubscription)
+		r.With(app.deprecated("/api/v1/users")).Post("/all-users", app.AllUsers)
+		r.With(app.deprecated("/api/v1/users/{id}")).Post("/all-users/{id}", app.OneUser)
+		r.With(app.deprecated("/api/v1/users/{id}")).Post("/all-users/edit", app.EditUser)
+		r.With(app.deprecated("/api/v1/users")).Post("/all-users/add", app.AddUser)
+		r.With(app.deprecated("/api/v1/users/{id}")).Post("/all-users/delete/{id}", app.DeleteUser)
 	})
 	return mux
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-commerce/internal/dbtest"
+	"go-commerce/internal/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// newTestApp returns an application that logs nowhere
+func newTestApp() *application {
+	return &application{
+		infoLog:  log.New(io.Discard, "", 0),
+		errorLog: log.New(io.Discard, "", 0),
+	}
+}
+
+// testToken is an api token of the right length for authenticateToken
+const testToken = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// newDBApp returns an application that logs nowhere with a test database
+func newDBApp(t *testing.T) (*application, *dbtest.DB) {
+	db := dbtest.New(t)
+	app := newTestApp()
+	app.DB = models.DBWrapper{DB: db.SQL}
+	return app, db
+}
+
+// expectUser makes the next statement find the admin user with id for testToken
+func expectUser(db *dbtest.DB, id int) {
+	db.Expect("from users u inner join tokens t").Rows([]interface{}{id, "Ada", "Lovelace", "ada@example.com"})
+}
+
+// serve sends a request to the routes of app and returns the response
+func serve(app *application, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	app.routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLegacyRoutesAreDeprecated(t *testing.T) {
+	app := newTestApp()
+
+	rec := serve(app, http.MethodPost, "/api/authenticate", "{")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if got := rec.Header().Get("Deprecation"); got != "true" {
+		t.Errorf("got Deprecation %q, want true", got)
+	}
+	if got, want := rec.Header().Get("Link"), `</api/v1/tokens>; rel="successor-version"`; got != want {
+		t.Errorf("got Link %q, want %q", got, want)
+	}
+
+	rec = serve(app, http.MethodPost, "/api/v1/tokens", "{")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if got := rec.Header().Get("Deprecation"); got != "" {
+		t.Errorf("versioned route answered with Deprecation %q", got)
+	}
+}
+
+func TestAdminRoutesNeedToken(t *testing.T) {
+	app := newTestApp()
+	for _, route := range []struct{ method, target string }{
+		{http.MethodGet, "/api/v1/sales"},
+		{http.MethodPost, "/api/v1/sales/1/refunds"},
+		{http.MethodDelete, "/api/v1/users/1"},
+		{http.MethodPost, "/api/admin/all-sales"},
+	} {
+		rec := serve(app, route.method, route.target, "")
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s: got status %d, want %d", route.method, route.target, rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestReadIDParam(t *testing.T) {
+	app := newTestApp()
+	for param, want := range map[string]int{"12": 12, "0": 0, "-3": 0, "abc": 0} {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", param)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		id, err := app.readIDParam(req)
+		if id != want || (err == nil) != (want != 0) {
+			t.Errorf("%q: got %d, %v", param, id, err)
+		}
+	}
+}
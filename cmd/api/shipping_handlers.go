@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go-commerce/internal/apierror"
+	"go-commerce/internal/apispec"
+	"go-commerce/internal/models"
+	"go-commerce/internal/money"
+	"go-commerce/internal/shipping"
+	"go-commerce/internal/tax"
+	"go-commerce/internal/validator"
+)
+
+// shippingCalculator returns the calculator that prices the shipping of sales. It reads
+// the zones and rates kept in the database; swap it to use a carrier's rates instead.
+func (app *application) shippingCalculator() (shipping.Calculator, error) {
+	return app.DB.GetShippingTable()
+}
+
+// quoteShipping quotes the shipping of one widget bought in currency to a buyer in
+// country and region. Plans are not shipped and return nil. Destinations nothing ships
+// to fail validation on field.
+func (app *application) quoteShipping(field string, widget models.Widget, currency, country, region string) (*shipping.Quote, error) {
+	if widget.IsRecurring {
+		return nil, nil
+	}
+
+	calc, err := app.shippingCalculator()
+	if err != nil {
+		return nil, err
+	}
+	quote, err := calc.Quote(shipping.Request{
+		Country:  country,
+		Region:   region,
+		Currency: currency,
+		Weight:   widget.Weight,
+	})
+	if errors.Is(err, shipping.ErrNoRate) {
+		return nil, apierror.Validation(map[string]string{
+			field: "we do not ship this product there in " + strings.ToUpper(currency),
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &quote, nil
+}
+
+// shippingDestination returns where a checkout ships to and the field to report it
+// on: the shipping address, or else the billing address, or else the buyer's country
+func shippingDestination(p apispec.ChargeRequest) (field, country, region string) {
+	switch {
+	case p.ShippingAddress != nil:
+		return "shipping_address.country", p.ShippingAddress.Country, p.ShippingAddress.Region
+	case p.BillingAddress != nil:
+		return "billing_address.country", p.BillingAddress.Country, p.BillingAddress.Region
+	}
+	return "country", p.Country, p.Region
+}
+
+// CreateShippingQuote returns the cost of shipping a product to a buyer, so the
+// storefront can show it before the card is charged
+func (app *application) CreateShippingQuote(w http.ResponseWriter, r *http.Request) {
+	var payload apispec.ShippingQuoteRequest
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.CheckInt("product_id", payload.ProductID, validator.Positive)
+	v.Check("currency", payload.Currency, validator.Required, validator.Currency)
+	v.Check("country", payload.Country, validator.Required, validator.Matches(countryRX, "must be a two letter ISO 3166 country code"))
+	v.Check("region", payload.Region, validator.Optional(validator.Matches(regionRX, "must be an ISO 3166-2 subdivision code, like CA for California")))
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	widget, err := app.DB.GetWidget(payload.ProductID)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	currency := strings.ToLower(payload.Currency)
+
+	quote, err := app.quoteShipping("country", widget, currency, payload.Country, payload.Region)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	if quote == nil {
+		quote = &shipping.Quote{Currency: currency}
+	}
+
+	app.writeJSON(w, quote, http.StatusOK)
+}
+
+// ListShippingZones returns every jurisdiction in a shipping zone
+func (app *application) ListShippingZones(w http.ResponseWriter, r *http.Request) {
+	zones, err := app.DB.GetShippingZones()
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, apispec.ShippingZoneList{Zones: zones}, http.StatusOK)
+}
+
+// CreateShippingZone puts a jurisdiction in a shipping zone
+func (app *application) CreateShippingZone(w http.ResponseWriter, r *http.Request) {
+	var zone models.ShippingZone
+	if err := app.readJSON(w, r, &zone); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check("zone", zone.Zone, validator.Required, validator.MaxLength(64))
+	v.Check("jurisdiction", zone.Jurisdiction, validator.Required)
+	if zone.Jurisdiction != "" && zone.Jurisdiction != shipping.RestOfWorld {
+		j, err := tax.NormalizeJurisdiction(zone.Jurisdiction)
+		if err != nil {
+			v.AddError("jurisdiction", "must be an ISO 3166 country code, optionally followed by a subdivision, like US or US-AK, or * for the rest of the world")
+		}
+		zone.Jurisdiction = j
+	}
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	if err := app.DB.SaveShippingZone(zone); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	resp := apispec.Response{
+		Message: zone.Jurisdiction + " is in shipping zone " + zone.Zone,
+	}
+	app.writeJSON(w, resp, http.StatusCreated)
+}
+
+// DeleteShippingZone takes a jurisdiction out of its shipping zone
+func (app *application) DeleteShippingZone(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if err := app.DB.DeleteShippingZone(id); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListShippingRates returns every shipping rate
+func (app *application) ListShippingRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := app.DB.GetShippingRates()
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, apispec.ShippingRateList{Rates: rates}, http.StatusOK)
+}
+
+// CreateShippingRate adds a shipping rate to a zone
+func (app *application) CreateShippingRate(w http.ResponseWriter, r *http.Request) {
+	var rate models.ShippingRate
+	if err := app.readJSON(w, r, &rate); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check("zone", rate.Zone, validator.Required, validator.MaxLength(64))
+	v.Check("method", rate.Method, validator.Required, validator.MaxLength(64))
+	v.Check("currency", rate.Currency, validator.Required, validator.Currency)
+	v.CheckInt("min_weight", rate.MinWeight, validator.Min(0))
+	v.CheckInt("max_weight", rate.MaxWeight, validator.Min(0))
+	if rate.MaxWeight != 0 && rate.MaxWeight <= rate.MinWeight {
+		v.AddError("max_weight", "must be more than min_weight, or 0 for no limit")
+	}
+	v.CheckInt("flat", rate.Flat, validator.Min(0))
+	v.CheckInt("per_kg", rate.PerKg, validator.Min(0))
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	if _, err := app.DB.InsertShippingRate(rate); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	price := money.New(int64(rate.Flat), rate.Currency).String()
+	if rate.PerKg > 0 {
+		price += " plus " + money.New(int64(rate.PerKg), rate.Currency).String() + " per kg"
+	}
+	resp := apispec.Response{
+		Message: fmt.Sprintf("%s to zone %s costs %s", rate.Method, rate.Zone, price),
+	}
+	app.writeJSON(w, resp, http.StatusCreated)
+}
+
+// DeleteShippingRate deletes a shipping rate
+func (app *application) DeleteShippingRate(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if err := app.DB.DeleteShippingRate(id); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetWidgetWeight sets the shipping weight of a widget
+func (app *application) SetWidgetWeight(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	var payload apispec.WidgetWeight
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.CheckInt("weight", payload.Weight, validator.Min(0))
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	if err := app.DB.SetWidgetWeight(id, payload.Weight); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	resp := apispec.Response{
+		Message: fmt.Sprintf("weight set to %d g", payload.Weight),
+	}
+	app.writeJSON(w, resp, http.StatusOK)
+}
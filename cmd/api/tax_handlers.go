@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"go-commerce/internal/apierror"
+	"go-commerce/internal/apispec"
+	"go-commerce/internal/models"
+	"go-commerce/internal/tax"
+	"go-commerce/internal/validator"
+)
+
+// taxCalculator returns the calculator that quotes the tax on sales. It reads the tax
+// rules kept in the database; swap it to use an external tax service instead.
+func (app *application) taxCalculator() (tax.Calculator, error) {
+	return app.DB.GetTaxTable()
+}
+
+// quoteWidget quotes the tax on one widget bought in currency by a buyer in country
+// and region, less the discount of coupon unless it is nil. Widgets that are not sold
+// in currency fail validation. Plans are quoted without tax.
+func (app *application) quoteWidget(widget models.Widget, coupon *models.Coupon, currency, country, region, taxID string) (tax.Quote, error) {
+	price, err := widget.PriceIn(currency)
+	if err != nil {
+		return tax.Quote{}, apierror.Validation(map[string]string{
+			"currency": "this product is not sold in " + strings.ToUpper(currency),
+		})
+	}
+	if coupon != nil {
+		price -= coupon.Discount(price)
+	}
+	// Stripe bills plans their price without our taxes, so plans are sold tax-exempt
+	if widget.IsRecurring {
+		return tax.Quote{
+			Jurisdiction: strings.ToUpper(tax.Jurisdiction(country, region)),
+			Currency:     currency,
+			Subtotal:     price,
+			Total:        price,
+			Exempt:       "Plans are not taxed",
+			Lines:        []tax.Line{},
+		}, nil
+	}
+
+	calc, err := app.taxCalculator()
+	if err != nil {
+		return tax.Quote{}, err
+	}
+	quote, err := calc.Calculate(tax.Request{
+		Jurisdiction: tax.Jurisdiction(country, region),
+		TaxID:        taxID,
+		Currency:     currency,
+		Items:        []tax.Item{{Description: widget.Name, Amount: price}},
+	})
+	if errors.Is(err, tax.ErrInvalidJurisdiction) {
+		return tax.Quote{}, apierror.Validation(map[string]string{"region": "is not a valid subdivision of the country"})
+	}
+	return quote, err
+}
+
+// CreateTaxQuote returns the tax a buyer would pay on a product, less any coupon, so
+// the storefront can show it before the card is charged
+func (app *application) CreateTaxQuote(w http.ResponseWriter, r *http.Request) {
+	var payload apispec.TaxQuoteRequest
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if validateTaxQuoteRequest(v, payload); !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	widget, err := app.DB.GetWidget(payload.ProductID)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	currency := strings.ToLower(payload.Currency)
+	var coupon *models.Coupon
+	if payload.Coupon != "" {
+		c, err := app.redeemableCoupon("coupon", payload.Coupon, widget, currency, payload.Email)
+		if err != nil {
+			app.errorJSON(w, r, err)
+			return
+		}
+		coupon = &c
+	}
+
+	quote, err := app.quoteWidget(widget, coupon, currency, payload.Country, payload.Region, payload.TaxID)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, quote, http.StatusOK)
+}
+
+// ListTaxRules returns every tax rule
+func (app *application) ListTaxRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := app.DB.GetTaxRules()
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, apispec.TaxRuleList{Rules: rules}, http.StatusOK)
+}
+
+// CreateTaxRule stores a tax rule
+func (app *application) CreateTaxRule(w http.ResponseWriter, r *http.Request) {
+	var rule models.TaxRule
+	if err := app.readJSON(w, r, &rule); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check("jurisdiction", rule.Jurisdiction, validator.Required)
+	if rule.Jurisdiction != "" {
+		j, err := tax.NormalizeJurisdiction(rule.Jurisdiction)
+		if err != nil {
+			v.AddError("jurisdiction", "must be an ISO 3166 country code, optionally followed by a subdivision, like DE or US-CA")
+		}
+		rule.Jurisdiction = j
+	}
+	v.Check("name", rule.Name, validator.Required, validator.MaxLength(64))
+	v.Check("rate", rule.Rate, validator.Required)
+	if rule.Rate != "" {
+		rate, err := tax.ParseRate(rule.Rate)
+		if err != nil {
+			v.AddError("rate", "must be a percentage between 0 and 100")
+		} else {
+			rule.Rate = rate.String()
+		}
+	}
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	if err := app.DB.SaveTaxRule(rule); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	pricing := "exclusive"
+	if rule.Inclusive {
+		pricing = "inclusive"
+	}
+	resp := apispec.Response{
+		Message: rule.Name + " of " + rule.Rate + "% (" + pricing + ") saved for " + rule.Jurisdiction,
+	}
+	app.writeJSON(w, resp, http.StatusCreated)
+}
+
+// DeleteTaxRule deletes a tax rule
+func (app *application) DeleteTaxRule(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if err := app.DB.DeleteTaxRule(id); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListTaxExemptions returns every tax exemption
+func (app *application) ListTaxExemptions(w http.ResponseWriter, r *http.Request) {
+	exemptions, err := app.DB.GetTaxExemptions()
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, apispec.TaxExemptionList{Exemptions: exemptions}, http.StatusOK)
+}
+
+// CreateTaxExemption exempts a buyer from tax by their tax ID, everywhere or in one
+// jurisdiction
+func (app *application) CreateTaxExemption(w http.ResponseWriter, r *http.Request) {
+	var exemption models.TaxExemption
+	if err := app.readJSON(w, r, &exemption); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	exemption.TaxID = tax.NormalizeTaxID(exemption.TaxID)
+
+	v := validator.New()
+	v.Check("tax_id", exemption.TaxID, validator.Required, validator.MaxLength(64))
+	if exemption.Jurisdiction != "" {
+		j, err := tax.NormalizeJurisdiction(exemption.Jurisdiction)
+		if err != nil {
+			v.AddError("jurisdiction", "must be an ISO 3166 country code, optionally followed by a subdivision, like DE or US-CA")
+		}
+		exemption.Jurisdiction = j
+	}
+	v.Check("reason", exemption.Reason, validator.MaxLength(255))
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	if err := app.DB.SaveTaxExemption(exemption); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	where := "everywhere"
+	if exemption.Jurisdiction != "" {
+		where = "in " + exemption.Jurisdiction
+	}
+	resp := apispec.Response{
+		Message: exemption.TaxID + " is exempt from tax " + where,
+	}
+	app.writeJSON(w, resp, http.StatusCreated)
+}
+
+// DeleteTaxExemption deletes a tax exemption
+func (app *application) DeleteTaxExemption(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	if err := app.DB.DeleteTaxExemption(id); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
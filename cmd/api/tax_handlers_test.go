@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-commerce/internal/tax"
+)
+
+func TestCreateTaxQuoteDoesNotTaxPlans(t *testing.T) {
+	// the tax rules are not even read for a plan
+	app, db := newDBApp(t)
+	expectWidget(db, true, "price_bronze")
+
+	body := `{"product_id": 2, "currency": "usd", "country": "DE"}`
+	rec := httptest.NewRecorder()
+	app.CreateTaxQuote(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	var q tax.Quote
+	if err := json.NewDecoder(rec.Body).Decode(&q); err != nil {
+		t.Fatal(err)
+	}
+	if q.Tax != 0 || q.Subtotal != 900 || q.Total != 900 || q.Exempt == "" || len(q.Lines) != 0 {
+		t.Errorf("got %+v", q)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-commerce/internal/apierror"
+	"go-commerce/internal/apispec"
+	"go-commerce/internal/models"
+	"go-commerce/internal/urlsigner"
+	"go-commerce/internal/validator"
+)
+
+// SetWidgetBilling sets the trial and metering of the plan of a recurring widget. They
+// apply to new subscriptions only.
+func (app *application) SetWidgetBilling(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	var payload apispec.WidgetBilling
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.CheckInt("trial_days", payload.TrialDays, validator.Min(0), validator.Max(730))
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	if err := app.DB.SetWidgetBilling(id, payload.TrialDays, payload.TrialRequiresCard, payload.Metered); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	resp := apispec.Response{
+		Message: "billing updated",
+	}
+	app.writeJSON(w, resp, http.StatusOK)
+}
+
+// CreateUsageRecord records usage of a metered subscription reported by one of our
+// services. Usage is pushed to the gateway by reportUsage; a record repeated with the
+// same idempotency key returns the first one with 200 OK.
+func (app *application) CreateUsageRecord(w http.ResponseWriter, r *http.Request) {
+	var payload apispec.UsageRequest
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.CheckInt("subscription_id", payload.SubscriptionID, validator.Positive)
+	v.CheckInt("quantity", payload.Quantity, validator.Positive)
+	v.Check("idempotency_key", payload.IdempotencyKey, validator.MaxLength(255))
+	if payload.Timestamp != nil && payload.Timestamp.After(time.Now()) {
+		v.AddError("timestamp", "must not be in the future")
+	}
+	if !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	order, err := app.DB.GetSubscriptionByID(payload.SubscriptionID)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	if !order.Widget.Metered {
+		app.errorJSON(w, r, apierror.Conflict("the plan of this subscription is not metered"))
+		return
+	}
+	if order.StatusID == models.OrderCancelled {
+		app.errorJSON(w, r, apierror.Conflict("the subscription has been cancelled"))
+		return
+	}
+
+	recordedAt := time.Now()
+	if payload.Timestamp != nil {
+		recordedAt = *payload.Timestamp
+	}
+	record, created, err := app.DB.InsertUsageRecord(models.UsageRecord{
+		OrderID:        order.ID,
+		Quantity:       payload.Quantity,
+		RecordedAt:     recordedAt,
+		IdempotencyKey: payload.IdempotencyKey,
+	})
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if !created {
+		status = http.StatusOK
+	}
+	app.writeJSON(w, record, status)
+}
+
+// reportUsage pushes every interval the usage recorded since the last push to the
+// gateway, record by record and as used when it was recorded. Usage that could not be
+// pushed is tried again on the next run.
+func (app *application) reportUsage(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		app.pushUsage()
+
+		<-ticker.C
+	}
+}
+
+// pushUsage pushes the usage records not pushed yet to the gateway. Records are pushed
+// one at a time, in order, each under an idempotency key of its own, so that a record
+// pushed but not marked is not billed twice when it is pushed again on the next run. A
+// subscription whose record fails waits for the next run, so its later records are not
+// marked with it.
+func (app *application) pushUsage() {
+	usage, err := app.DB.GetUnreportedUsage()
+	if err != nil {
+		app.errorLog.Printf("checking unreported usage: %v", err)
+		return
+	}
+
+	payConf := app.payConfig()
+	failed := make(map[int]bool)
+	for _, u := range usage {
+		if failed[u.OrderID] {
+			continue
+		}
+		key := fmt.Sprintf("usage-%d-%d", u.OrderID, u.RecordID)
+		if _, err := payConf.ReportUsage(u.SubscriptionID, u.Quantity, u.RecordedAt, key); err != nil {
+			app.errorLog.Printf("reporting usage record %d of subscription %d: %v", u.RecordID, u.OrderID, err)
+			failed[u.OrderID] = true
+			continue
+		}
+		if err := app.DB.MarkUsageReported(u.OrderID, u.RecordID); err != nil {
+			app.errorLog.Printf("usage record %d of subscription %d was reported but could not update in database: %v",
+				u.RecordID, u.OrderID, err)
+			failed[u.OrderID] = true
+		}
+	}
+}
+
+// usageSummary gets the seats, trial and current period usage of a subscription. The
+// period is the one the gateway bills.
+func (app *application) usageSummary(order models.Order) (apispec.UsageSummary, error) {
+	summary := apispec.UsageSummary{
+		SubscriptionID: order.ID,
+		Plan:           order.Widget.Name,
+		StatusID:       order.StatusID,
+		Seats:          order.Quantity,
+		Metered:        order.Widget.Metered,
+		TrialEndsAt:    order.TrialEndsAt,
+	}
+
+	payConf := app.payConfig()
+	s, err := payConf.GetSubscription(order.Transaction.PaymentIntent)
+	if err != nil {
+		return summary, apierror.Gateway("could not retrieve subscription", err)
+	}
+	summary.PeriodStart = time.Unix(s.CurrentPeriodStart, 0)
+	summary.PeriodEnd = time.Unix(s.CurrentPeriodEnd, 0)
+
+	if order.Widget.Metered {
+		summary.Usage, summary.Unreported, err = app.DB.GetPeriodUsage(order.ID, summary.PeriodStart, summary.PeriodEnd)
+		if err != nil {
+			return summary, err
+		}
+	}
+	return summary, nil
+}
+
+// GetSubscriptionUsage returns the seats, trial and current period usage of the
+// subscription identified in the URL
+func (app *application) GetSubscriptionUsage(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	order, err := app.DB.GetSubscriptionByID(id)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	summary, err := app.usageSummary(order)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	app.writeJSON(w, summary, http.StatusOK)
+}
+
+// CreatePortalLink emails a customer signed links to the portal pages of their
+// subscriptions. It answers the same whether or not the email has subscriptions, so it
+// does not tell who our customers are.
+func (app *application) CreatePortalLink(w http.ResponseWriter, r *http.Request) {
+	var payload apispec.PortalLinkRequest
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check("email", payload.Email, validator.Required, validator.Email); !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	orders, err := app.DB.GetCustomerSubscriptions(payload.Email)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	resp := apispec.Response{
+		Message: "If you have subscriptions with us, we have emailed you a link to each of them",
+	}
+	if len(orders) == 0 {
+		app.writeJSON(w, resp, http.StatusCreated)
+		return
+	}
+
+	type portalLink struct {
+		Plan string
+		Link string
+	}
+	var data struct {
+		Links []portalLink
+	}
+	signer := urlsigner.NewSigner([]byte(app.config.secretKey))
+	for _, o := range orders {
+		link := fmt.Sprintf("%s/portal/subscription?subscription=%d", app.config.frontend, o.ID)
+		data.Links = append(data.Links, portalLink{o.Widget.Name, signer.GenerateTokenFromString(link)})
+	}
+
+	if err := app.SendMail("info@widgets.com", payload.Email, "Your subscriptions", "portal_links", data); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	app.writeJSON(w, resp, http.StatusCreated)
+}
+
+// CreateUsageSummary returns the seats, trial and current period usage of the
+// subscription of a portal page
+func (app *application) CreateUsageSummary(w http.ResponseWriter, r *http.Request) {
+	var payload apispec.PortalRequest
+	if err := app.readJSON(w, r, &payload); err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check("token", payload.Token, validator.Required); !v.Valid() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	order, err := app.tokenSubscription(payload.Token, "portal")
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	summary, err := app.usageSummary(order)
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+	app.writeJSON(w, summary, http.StatusOK)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go-commerce/internal/dbtest"
+	"go-commerce/internal/models"
+)
+
+// expectSubscription makes the next statement find subscription 7, paid by sub_7
+func expectSubscription(db *dbtest.DB, status int, metered bool) {
+	now := time.Now()
+	db.Expect("where o.id = ? and w.is_recurring = 1").WithArgs(7).Rows([]interface{}{
+		7, 2, 3, 4, status, 1, 900, 0, "", 0, 0, nil, now, now, 2, "Bronze Plan", metered,
+		3, 900, "usd", "4242", 12, 2030, "sub_7", "", 4, "Ada", "Lovelace", "ada@example.com",
+	})
+}
+
+func TestCreateUsageRecord(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		result int64
+		want   int
+	}{
+		{"new record", models.OrderCleared, 1, http.StatusCreated},
+		{"repeated record", models.OrderCleared, 0, http.StatusOK},
+	}
+	for _, tt := range tests {
+		app, db := newDBApp(t)
+		expectSubscription(db, tt.status, true)
+		db.Expect("insert ignore into usage_records").WithArgs(7, 3, dbtest.Any, "job-1", dbtest.Any, dbtest.Any).Result(11, tt.result)
+		if tt.result == 0 {
+			db.Expect("where order_id = ? and idempotency_key = ?").Rows([]interface{}{11, 7, 3, time.Now(), "job-1", nil})
+		}
+
+		rec := httptest.NewRecorder()
+		body := `{"subscription_id": 7, "quantity": 3, "idempotency_key": "job-1"}`
+		app.CreateUsageRecord(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		if rec.Code != tt.want {
+			t.Errorf("%s: got status %d: %s", tt.name, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestCreateUsageRecordRefusesSubscriptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		metered bool
+		message string
+	}{
+		{"licensed plan", models.OrderCleared, false, "the plan of this subscription is not metered"},
+		{"cancelled", models.OrderCancelled, true, "the subscription has been cancelled"},
+	}
+	for _, tt := range tests {
+		app, db := newDBApp(t)
+		expectSubscription(db, tt.status, tt.metered)
+
+		rec := httptest.NewRecorder()
+		app.CreateUsageRecord(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"subscription_id": 7, "quantity": 3}`)))
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("%s: got status %d: %s", tt.name, rec.Code, rec.Body)
+		}
+		if e := decodeError(t, rec); e.Message != tt.message {
+			t.Errorf("%s: got %q", tt.name, e.Message)
+		}
+	}
+}
+
+func TestValidateUsageRecord(t *testing.T) {
+	app := newTestApp()
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+	body := `{"subscription_id": 0, "quantity": -1, "timestamp": "` + future + `"}`
+
+	rec := httptest.NewRecorder()
+	app.CreateUsageRecord(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	fields := decodeError(t, rec).Error.Fields
+	for _, field := range []string{"subscription_id", "quantity", "timestamp"} {
+		if fields[field] == "" {
+			t.Errorf("no error for %s: %v", field, fields)
+		}
+	}
+}
+
+func TestPushUsage(t *testing.T) {
+	at := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	var pushed []string
+	fakeStripe(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/v1/subscriptions/"):
+			fmt.Fprintf(w, `{"id": %q, "object": "subscription", "items": {"object": "list", "data": [
+				{"id": "si_1", "object": "subscription_item", "plan": {"id": "plan_1", "usage_type": "metered"}}]}}`,
+				strings.TrimPrefix(r.URL.Path, "/v1/subscriptions/"))
+		case r.URL.Path == "/v1/subscription_items/si_1/usage_records":
+			r.ParseForm()
+			key := r.Header.Get("Idempotency-Key")
+			if key == "usage-7-12" {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, `{"error": {"type": "api_error", "message": "try again"}}`)
+				return
+			}
+			if ts := r.PostForm.Get("timestamp"); ts != fmt.Sprint(at.Unix()) {
+				t.Errorf("%s pushed at %s, want when it was recorded", key, ts)
+			}
+			pushed = append(pushed, key)
+			fmt.Fprint(w, `{"id": "mbur_1", "object": "usage_record"}`)
+		default:
+			t.Errorf("got request for %s", r.URL.Path)
+		}
+	})
+	app, db := newDBApp(t)
+	db.Expect("where u.reported_at is null").Rows(
+		[]interface{}{7, "sub_7", 12, 5, at},
+		[]interface{}{7, "sub_7", 13, 1, at},
+		[]interface{}{8, "sub_8", 14, 2, at},
+		[]interface{}{8, "sub_8", 15, 3, at},
+	)
+	db.Expect("update usage_records set reported_at = ?").WithArgs(dbtest.Any, dbtest.Any, 8, 14)
+	db.Expect("update usage_records set reported_at = ?").WithArgs(dbtest.Any, dbtest.Any, 8, 15)
+
+	app.pushUsage()
+
+	// record 13 waits for record 12, which failed, so it is not marked with it
+	if want := []string{"usage-8-14", "usage-8-15"}; !reflect.DeepEqual(pushed, want) {
+		t.Errorf("pushed %v, want %v", pushed, want)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"go-commerce/internal/apierror"
+	"go-commerce/internal/apispec"
+	"go-commerce/internal/models"
+	"go-commerce/internal/validator"
+)
+
+const (
+	minPasswordLength = 8
+	maxSeats          = 10000
+)
+
+var (
+	countryRX = regexp.MustCompile(`^[A-Za-z]{2}$`)
+	regionRX  = regexp.MustCompile(`^[A-Za-z0-9]{1,3}$`)
+)
+
+// failedValidation writes the validator's field errors as a validation_failed error
+func (app *application) failedValidation(w http.ResponseWriter, r *http.Request, v *validator.Validator) {
+	app.errorJSON(w, r, apierror.Validation(v.Errors))
+}
+
+// validatePaymentIntentRequest validates a request for a one-off payment intent.
+// Storefront checkouts name a product, which sets the amount, and must also identify
+// the buyer. Other payments, like those of the virtual terminal, give the amount.
+func validatePaymentIntentRequest(v *validator.Validator, p apispec.ChargeRequest) {
+	v.Check("currency", p.Currency, validator.Required, validator.Currency)
+	if p.ProductID == 0 {
+		v.CheckInt("amount", p.Amount, validator.Positive)
+	} else {
+		v.CheckInt("product_id", p.ProductID, validator.Positive)
+		v.Check("first_name", p.FirstName, validator.Required, validator.MaxLength(255))
+		v.Check("last_name", p.LastName, validator.Required, validator.MaxLength(255))
+		v.Check("email", p.Email, validator.Required, validator.Email)
+		validateTaxLocation(v, p.Country, p.Region, p.TaxID)
+		v.Check("coupon", p.Coupon, validator.MaxLength(64))
+		validateAddress(v, "billing_address.", p.BillingAddress)
+		validateAddress(v, "shipping_address.", p.ShippingAddress)
+	}
+}
+
+// validateAddress validates a postal address, if there is one, reporting its fields
+// under prefix
+func validateAddress(v *validator.Validator, prefix string, a *models.Address) {
+	if a == nil {
+		return
+	}
+	v.Check(prefix+"name", a.Name, validator.MaxLength(255))
+	v.Check(prefix+"line1", a.Line1, validator.Required, validator.MaxLength(255))
+	v.Check(prefix+"line2", a.Line2, validator.MaxLength(255))
+	v.Check(prefix+"city", a.City, validator.Required, validator.MaxLength(255))
+	v.Check(prefix+"region", a.Region, validator.Optional(validator.Matches(regionRX, "must be an ISO 3166-2 subdivision code, like CA for California")))
+	v.Check(prefix+"postcode", a.Postcode, validator.MaxLength(16))
+	v.Check(prefix+"country", a.Country, validator.Required, validator.Matches(countryRX, "must be a two letter ISO 3166 country code"))
+}
+
+// validateTaxLocation validates where a buyer is taxed: their country, the state or
+// province for countries that tax by region, and their tax ID if they have one
+func validateTaxLocation(v *validator.Validator, country, region, taxID string) {
+	v.Check("country", country, validator.Required, validator.Matches(countryRX, "must be a two letter ISO 3166 country code"))
+	v.Check("region", region, validator.Optional(validator.Matches(regionRX, "must be an ISO 3166-2 subdivision code, like CA for California")))
+	v.Check("tax_id", taxID, validator.MaxLength(64))
+}
+
+// validateTaxQuoteRequest validates a request for the tax on a product
+func validateTaxQuoteRequest(v *validator.Validator, p apispec.TaxQuoteRequest) {
+	v.CheckInt("product_id", p.ProductID, validator.Positive)
+	v.Check("currency", p.Currency, validator.Required, validator.Currency)
+	validateTaxLocation(v, p.Country, p.Region, p.TaxID)
+	v.Check("coupon", p.Coupon, validator.MaxLength(64))
+	v.Check("email", p.Email, validator.Optional(validator.Email))
+}
+
+// validateSubscriptionRequest validates a request to create a customer and subscribe them to a plan.
+// Whether it needs a payment method and seats depends on the plan, which the handler checks.
+func validateSubscriptionRequest(v *validator.Validator, p apispec.ChargeRequest) {
+	v.Check("currency", p.Currency, validator.Required, validator.Currency)
+	v.CheckInt("product_id", p.ProductID, validator.Positive)
+	v.Check("first_name", p.FirstName, validator.Required, validator.MaxLength(255))
+	v.Check("last_name", p.LastName, validator.Required, validator.MaxLength(255))
+	v.Check("email", p.Email, validator.Required, validator.Email)
+	v.Check("last_four", p.LastFour, validator.Optional(validator.Length(4), validator.Digits))
+	v.CheckInt("exp_month", p.ExpiryMonth, validator.Min(0), validator.Max(12))
+	v.Check("coupon", p.Coupon, validator.MaxLength(64))
+	v.CheckInt("seats", p.Seats, validator.Min(0), validator.Max(maxSeats))
+	validateAddress(v, "billing_address.", p.BillingAddress)
+}
+
+// validateCoupon validates a new coupon, which takes either a percentage or an amount
+// in one currency off the price
+func validateCoupon(v *validator.Validator, c models.Coupon) {
+	v.Check("code", c.Code, validator.Required, validator.MaxLength(64),
+		validator.Matches(couponCodeRX, "must only contain letters, digits, dashes and underscores"))
+	switch {
+	case c.PercentOff == 0 && c.AmountOff == 0:
+		v.AddError("percent_off", "either percent_off or amount_off is required")
+	case c.PercentOff != 0 && c.AmountOff != 0:
+		v.AddError("percent_off", "cannot be combined with amount_off")
+	case c.PercentOff != 0:
+		v.CheckInt("percent_off", c.PercentOff, validator.Positive, validator.Max(100))
+	default:
+		v.CheckInt("amount_off", c.AmountOff, validator.Positive)
+		v.Check("currency", c.Currency, validator.Required, validator.Currency)
+	}
+	v.CheckInt("widget_id", c.WidgetID, validator.Min(0))
+	v.CheckInt("max_redemptions", c.MaxRedemptions, validator.Min(0))
+	v.Check("duration", c.Duration, validator.In(models.CouponOnce, models.CouponRepeating, models.CouponForever))
+	if c.Duration == models.CouponRepeating {
+		v.CheckInt("duration_in_months", c.DurationInMonths, validator.Positive)
+	} else {
+		v.CheckInt("duration_in_months", c.DurationInMonths, validator.Max(0))
+	}
+}
+
+// validateUser validates an admin user. The password is only checked when it is
+// required or has been given.
+func validateUser(v *validator.Validator, u models.User, passwordRequired bool) {
+	v.Check("first_name", u.FirstName, validator.Required, validator.MaxLength(255))
+	v.Check("last_name", u.LastName, validator.Required, validator.MaxLength(255))
+	v.Check("email", u.Email, validator.Required, validator.Email)
+	if passwordRequired {
+		v.Check("password", u.Password, validator.Required, validator.MinLength(minPasswordLength), validator.MaxLength(72))
+	} else {
+		v.Check("password", u.Password, validator.Optional(validator.MinLength(minPasswordLength), validator.MaxLength(72)))
+	}
+}
+
+// validateFulfillment validates a move of an order to the fulfillment status called
+// status, returning the ID of the status. Shipped orders need a carrier and a tracking
+// number.
+func validateFulfillment(v *validator.Validator, status, carrier, trackingNumber string) int {
+	id, ok := models.FulfillmentStatusID(status)
+	if !ok {
+		v.AddError("status", "must be pending, picking, shipped, delivered or returned")
+	}
+	if id == models.FulfillmentShipped {
+		v.Check("carrier", carrier, validator.Required)
+		v.Check("tracking_number", trackingNumber, validator.Required)
+	}
+	v.Check("carrier", carrier, validator.MaxLength(64))
+	v.Check("tracking_number", trackingNumber, validator.MaxLength(128))
+	return id
+}
+
+// validateReturnRequest validates a request to open a return. Customers must also name
+// the sale and the email it was bought with.
+func validateReturnRequest(v *validator.Validator, p apispec.ReturnRequest, customer bool) {
+	if customer {
+		v.CheckInt("order_id", p.OrderID, validator.Positive)
+		v.Check("email", p.Email, validator.Required, validator.Email)
+	}
+	v.Check("reason", p.Reason, validator.Required, validator.MaxLength(512))
+	if len(p.Items) == 0 {
+		v.AddError("items", "must list at least one item")
+	}
+	for i, item := range p.Items {
+		v.CheckInt(fmt.Sprintf("items.%d.widget_id", i), item.WidgetID, validator.Min(0))
+		v.CheckInt(fmt.Sprintf("items.%d.quantity", i), item.Quantity, validator.Positive)
+	}
+}
+
+// validateOrderItems validates the items of a terminal order, which must add up to amount
+func validateOrderItems(v *validator.Validator, items []apispec.OrderItemRequest, amount int) {
+	total := 0
+	for i, item := range items {
+		v.CheckInt(fmt.Sprintf("items.%d.widget_id", i), item.WidgetID, validator.Min(0))
+		if item.WidgetID == 0 {
+			v.Check(fmt.Sprintf("items.%d.description", i), item.Description, validator.Required)
+		}
+		v.Check(fmt.Sprintf("items.%d.description", i), item.Description, validator.MaxLength(255))
+		v.CheckInt(fmt.Sprintf("items.%d.quantity", i), item.Quantity, validator.Positive)
+		v.CheckInt(fmt.Sprintf("items.%d.unit_amount", i), item.UnitAmount, validator.Min(0))
+		total += item.Quantity * item.UnitAmount
+	}
+	if len(items) > 0 && total != amount {
+		v.AddError("items", "must add up to the amount")
+	}
+}
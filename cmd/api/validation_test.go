@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"go-commerce/internal/apispec"
+	"go-commerce/internal/models"
+	"go-commerce/internal/validator"
+)
+
+func TestPaymentIntentValidation(t *testing.T) {
+	rec := serve(newTestApp(), http.MethodPost, "/api/v1/payment-intents",
+		`{"amount": 0, "currency": "eu", "product_id": 1, "email": "not an email"}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusUnprocessableEntity, rec.Body)
+	}
+
+	e := decodeError(t, rec)
+	if e.Error.Code != "validation_failed" {
+		t.Errorf("got code %s", e.Error.Code)
+	}
+	for _, field := range []string{"currency", "first_name", "last_name", "email"} {
+		if e.Error.Fields[field] == "" {
+			t.Errorf("no error for %s in %v", field, e.Error.Fields)
+		}
+	}
+}
+
+func TestValidateUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     userInput
+		required bool
+		fields   []string
+	}{
+		{"valid", userInput{"Ada", "Lovelace", "ada@example.com", "correct horse"}, true, nil},
+		{"password kept", userInput{"Ada", "Lovelace", "ada@example.com", ""}, false, nil},
+		{"password missing", userInput{"Ada", "Lovelace", "ada@example.com", ""}, true, []string{"password"}},
+		{"password short", userInput{"Ada", "Lovelace", "ada@example.com", "short"}, false, []string{"password"}},
+		{"no name or email", userInput{"", "", "ada", "correct horse"}, true, []string{"first_name", "last_name", "email"}},
+	}
+	for _, tt := range tests {
+		v := validator.New()
+		validateUser(v, models.User{FirstName: tt.user.first, LastName: tt.user.last, Email: tt.user.email, Password: tt.user.password}, tt.required)
+		if len(v.Errors) != len(tt.fields) {
+			t.Errorf("%s: got errors %v, want errors for %v", tt.name, v.Errors, tt.fields)
+			continue
+		}
+		for _, f := range tt.fields {
+			if v.Errors[f] == "" {
+				t.Errorf("%s: no error for %s in %v", tt.name, f, v.Errors)
+			}
+		}
+	}
+}
+
+type userInput struct {
+	first, last, email, password string
+}
+
+func TestValidateCoupon(t *testing.T) {
+	tests := []struct {
+		coupon models.Coupon
+		field  string
+	}{
+		{models.Coupon{Code: "TEN", PercentOff: 10, Duration: models.CouponOnce}, ""},
+		{models.Coupon{Code: "FIVE-EUR", AmountOff: 500, Currency: "eur", Duration: models.CouponForever}, ""},
+		{models.Coupon{Code: "THREE_MONTHS", PercentOff: 20, Duration: models.CouponRepeating, DurationInMonths: 3}, ""},
+		{models.Coupon{Code: "ten off", PercentOff: 10, Duration: models.CouponOnce}, "code"},
+		{models.Coupon{Code: "NONE", Duration: models.CouponOnce}, "percent_off"},
+		{models.Coupon{Code: "BOTH", PercentOff: 10, AmountOff: 100, Currency: "eur", Duration: models.CouponOnce}, "percent_off"},
+		{models.Coupon{Code: "MORE", PercentOff: 101, Duration: models.CouponOnce}, "percent_off"},
+		{models.Coupon{Code: "NOCURRENCY", AmountOff: 100, Duration: models.CouponOnce}, "currency"},
+		{models.Coupon{Code: "REPEAT", PercentOff: 10, Duration: models.CouponRepeating}, "duration_in_months"},
+		{models.Coupon{Code: "ONCE", PercentOff: 10, Duration: models.CouponOnce, DurationInMonths: 2}, "duration_in_months"},
+		{models.Coupon{Code: "WEEKLY", PercentOff: 10, Duration: "weekly"}, "duration"},
+	}
+	for _, tt := range tests {
+		v := validator.New()
+		validateCoupon(v, tt.coupon)
+		if tt.field == "" && !v.Valid() {
+			t.Errorf("%s: got errors %v", tt.coupon.Code, v.Errors)
+		}
+		if tt.field != "" && v.Errors[tt.field] == "" {
+			t.Errorf("%s: no error for %s in %v", tt.coupon.Code, tt.field, v.Errors)
+		}
+	}
+}
+
+func TestValidateReturnRequest(t *testing.T) {
+	v := validator.New()
+	validateReturnRequest(v, apispec.ReturnRequest{
+		Reason: "too small",
+		Items:  []apispec.ReturnItemRequest{{Quantity: 1}},
+	}, false)
+	if !v.Valid() {
+		t.Errorf("admin return: got %v", v.Errors)
+	}
+
+	v = validator.New()
+	validateReturnRequest(v, apispec.ReturnRequest{
+		Reason: "too small",
+		Items:  []apispec.ReturnItemRequest{{Quantity: 1}},
+	}, true)
+	if v.Errors["order_id"] == "" || v.Errors["email"] == "" {
+		t.Errorf("customer return without a sale: got %v", v.Errors)
+	}
+
+	v = validator.New()
+	validateReturnRequest(v, apispec.ReturnRequest{Items: []apispec.ReturnItemRequest{{WidgetID: -1}}}, false)
+	for _, field := range []string{"reason", "items.0.widget_id", "items.0.quantity"} {
+		if v.Errors[field] == "" {
+			t.Errorf("no error for %s in %v", field, v.Errors)
+		}
+	}
+
+	v = validator.New()
+	validateReturnRequest(v, apispec.ReturnRequest{Reason: "nothing"}, false)
+	if v.Errors["items"] == "" {
+		t.Errorf("return without items: got %v", v.Errors)
+	}
+}
+
+func TestValidateOrderItems(t *testing.T) {
+	v := validator.New()
+	validateOrderItems(v, []apispec.OrderItemRequest{
+		{WidgetID: 1, Quantity: 2, UnitAmount: 500},
+		{Description: "Engraving", Quantity: 1, UnitAmount: 250},
+	}, 1250)
+	if !v.Valid() {
+		t.Errorf("got %v", v.Errors)
+	}
+
+	v = validator.New()
+	validateOrderItems(v, nil, 1250)
+	if !v.Valid() {
+		t.Errorf("an order without items: got %v", v.Errors)
+	}
+
+	v = validator.New()
+	validateOrderItems(v, []apispec.OrderItemRequest{
+		{Quantity: 0, UnitAmount: -1},
+		{WidgetID: 1, Quantity: 1, UnitAmount: 100},
+	}, 1250)
+	for _, field := range []string{"items", "items.0.description", "items.0.quantity", "items.0.unit_amount"} {
+		if v.Errors[field] == "" {
+			t.Errorf("no error for %s in %v", field, v.Errors)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"go-commerce/internal/apierror"
+	"go-commerce/internal/apispec"
+	"go-commerce/internal/payment"
+
+	"github.com/stripe/stripe-go/v72"
+)
+
+// maxStripeEvent is the largest webhook event accepted, in bytes
+const maxStripeEvent = 1 << 20
+
+// CreateStripeEvent receives a webhook event from Stripe. Dispute events create or
+// update the dispute, payout events import the payout, and payment intent and invoice
+// events settle pending payments; other events are acknowledged and ignored.
+func (app *application) CreateStripeEvent(w http.ResponseWriter, r *http.Request) {
+	if app.config.stripe.webhookSecret == "" {
+		app.errorJSON(w, r, errors.New("STRIPE_WEBHOOK_SECRET is not set"))
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxStripeEvent))
+	if err != nil {
+		app.errorJSON(w, r, apierror.BadRequest("body must not be larger than 1MB"))
+		return
+	}
+
+	payConf := app.payConfig()
+	event, err := payConf.ReadEvent(payload, r.Header.Get("Stripe-Signature"), app.config.stripe.webhookSecret)
+	if err != nil {
+		app.errorJSON(w, r, apierror.BadRequest("the event signature is not valid"))
+		return
+	}
+
+	var message string
+	switch {
+	case strings.HasPrefix(event.Type, "charge.dispute."):
+		message, err = app.syncDispute(event)
+	case strings.HasPrefix(event.Type, "payout."):
+		message, err = app.syncPayout(event)
+	case event.Type == "payment_intent.succeeded", event.Type == "payment_intent.payment_failed",
+		event.Type == "payment_intent.canceled", event.Type == "invoice.paid", event.Type == "invoice.payment_failed":
+		message, err = app.settlePayment(event)
+	default:
+		message = "event ignored"
+	}
+	if err != nil {
+		app.errorJSON(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, apispec.Response{Message: message}, http.StatusOK)
+}
+
+// settlePayment records the outcome of a pending payment: a payment intent, or the
+// first invoice of a subscription, that succeeded or failed after it was recorded. A
+// canceled payment intent is an authorization that expired before it was captured.
+// Renewal invoices of subscriptions are dunned instead.
+func (app *application) settlePayment(event stripe.Event) (string, error) {
+	var ref, chargeID string
+	succeeded := event.Type == "payment_intent.succeeded" || event.Type == "invoice.paid"
+
+	if strings.HasPrefix(event.Type, "invoice.") {
+		var inv stripe.Invoice
+		if err := json.Unmarshal(event.Data.Raw, &inv); err != nil {
+			return "", apierror.BadRequest("the event does not hold an invoice")
+		}
+		if inv.Subscription == nil {
+			return "event ignored", nil
+		}
+		if payment.IsRenewal(&inv) {
+			return app.dunRenewal(&inv, succeeded)
+		}
+		// subscriptions are recorded with the subscription as their payment intent
+		ref = inv.Subscription.ID
+		if inv.Charge != nil {
+			chargeID = inv.Charge.ID
+		}
+	} else {
+		var pi stripe.PaymentIntent
+		if err := json.Unmarshal(event.Data.Raw, &pi); err != nil {
+			return "", apierror.BadRequest("the event does not hold a payment intent")
+		}
+		ref, chargeID = pi.ID, payment.ChargeID(&pi)
+		// a failed or canceled payment gives back the redemption its coupon held
+		if !succeeded {
+			if err := app.DB.ReleaseCouponReservationForIntent(pi.ID); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	settled, err := app.DB.SettlePayment(ref, chargeID, succeeded)
+	if err != nil {
+		return "", err
+	}
+	if !settled {
+		return "nothing to settle", nil
+	}
+	app.infoLog.Printf("payment %s settled, succeeded: %t", ref, succeeded)
+
+	return "payment settled", nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-commerce/internal/dbtest"
+	"go-commerce/internal/models"
+	"go-commerce/internal/payment"
+
+	"github.com/stripe/stripe-go/v72/webhook"
+)
+
+const testWebhookSecret = "whsec_test"
+
+// stripeEvent returns a webhook request for an event of type typ holding object,
+// signed with testWebhookSecret
+func stripeEvent(t *testing.T, typ string, object interface{}) *http.Request {
+	t.Helper()
+	raw, err := json.Marshal(object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := fmt.Sprintf(`{"id": "evt_1", "object": "event", "type": %q, "data": {"object": %s}}`, typ, raw)
+
+	now := time.Now()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/stripe-events", strings.NewReader(payload))
+	req.Header.Set("Stripe-Signature", fmt.Sprintf("t=%d,v1=%x", now.Unix(), webhook.ComputeSignature(now, []byte(payload), testWebhookSecret)))
+	return req
+}
+
+func TestCreateStripeEventChecksSignature(t *testing.T) {
+	app, _ := newDBApp(t)
+	app.config.stripe.webhookSecret = "whsec_other"
+
+	rec := httptest.NewRecorder()
+	app.CreateStripeEvent(rec, stripeEvent(t, "charge.dispute.created", map[string]interface{}{"id": "dp_1"}))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got status %d", rec.Code)
+	}
+}
+
+func TestCreateStripeEventIgnoresOtherEvents(t *testing.T) {
+	app, _ := newDBApp(t)
+	app.config.stripe.webhookSecret = testWebhookSecret
+
+	rec := httptest.NewRecorder()
+	app.CreateStripeEvent(rec, stripeEvent(t, "customer.created", map[string]interface{}{"id": "cus_1"}))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "event ignored") {
+		t.Errorf("got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCreateStripeEventSettlesPayments(t *testing.T) {
+	tests := []struct {
+		typ       string
+		object    map[string]interface{}
+		ref       string
+		charge    string
+		succeeded bool
+	}{
+		{"payment_intent.succeeded", map[string]interface{}{"id": "pi_1", "object": "payment_intent",
+			"charges": map[string]interface{}{"object": "list", "data": []map[string]interface{}{{"id": "ch_1"}}}}, "pi_1", "ch_1", true},
+		{"payment_intent.payment_failed", map[string]interface{}{"id": "pi_1", "object": "payment_intent"}, "pi_1", "", false},
+		{"invoice.paid", map[string]interface{}{"id": "in_1", "object": "invoice", "subscription": "sub_1",
+			"billing_reason": "subscription_create", "charge": "ch_2"}, "sub_1", "ch_2", true},
+		{"invoice.payment_failed", map[string]interface{}{"id": "in_1", "object": "invoice", "subscription": "sub_1",
+			"billing_reason": "subscription_create"}, "sub_1", "", false},
+	}
+	for _, tt := range tests {
+		app, db := newDBApp(t)
+		app.config.stripe.webhookSecret = testWebhookSecret
+
+		if tt.typ == "payment_intent.payment_failed" {
+			// the coupon redemption held by the checkout is given back
+			db.Expect("delete from coupon_reservations where payment_intent = ?").WithArgs("pi_1")
+		}
+		db.Expect("from transactions where payment_intent = ?").WithArgs(tt.ref).Rows([]interface{}{3, models.TransactionPending})
+		db.Expect("update transactions").WithArgs(dbtest.Any, tt.charge, dbtest.Any, 3)
+		db.Expect("update orders")
+
+		rec := httptest.NewRecorder()
+		app.CreateStripeEvent(rec, stripeEvent(t, tt.typ, tt.object))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "payment settled") {
+			t.Errorf("%s: got %d %s", tt.typ, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestCreateStripeEventIgnoresOneOffInvoices(t *testing.T) {
+	app, _ := newDBApp(t)
+	app.config.stripe.webhookSecret = testWebhookSecret
+
+	rec := httptest.NewRecorder()
+	app.CreateStripeEvent(rec, stripeEvent(t, "invoice.paid", map[string]interface{}{"id": "in_1", "object": "invoice"}))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "event ignored") {
+		t.Errorf("got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCreateStripeEventDunsRenewals(t *testing.T) {
+	renewal := map[string]interface{}{"id": "in_2", "object": "invoice", "subscription": "sub_1", "billing_reason": "subscription_cycle", "amount_due": 900}
+	tests := []struct {
+		typ     string
+		expect  func(db *dbtest.DB)
+		message string
+	}{
+		{"invoice.payment_failed", func(db *dbtest.DB) {
+			db.Expect("where t.payment_intent = ? and w.is_recurring = 1").WithArgs("sub_1").NoRows()
+		}, "event ignored"},
+		{"invoice.payment_failed", func(db *dbtest.DB) {
+			db.Expect("where t.payment_intent = ? and w.is_recurring = 1").WithArgs("sub_1").Rows([]interface{}{7})
+			db.Expect("insert ignore into dunning_cases").WithArgs(7, "in_2", 900, dbtest.Any, models.DunningOpen, dbtest.Any, dbtest.Any).Result(0, 0)
+		}, "dunning already started"},
+		{"invoice.paid", func(db *dbtest.DB) {
+			db.Expect("where t.payment_intent = ? and w.is_recurring = 1").WithArgs("sub_1").Rows([]interface{}{7})
+			db.Expect("from dunning_cases").NoRows()
+		}, "nothing to settle"},
+	}
+	for _, tt := range tests {
+		app, db := newDBApp(t)
+		app.config.stripe.webhookSecret = testWebhookSecret
+		app.config.dunningSchedule = []time.Duration{72 * time.Hour}
+		tt.expect(db)
+
+		rec := httptest.NewRecorder()
+		app.CreateStripeEvent(rec, stripeEvent(t, tt.typ, renewal))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), tt.message) {
+			t.Errorf("%s: got %d %s, want %s", tt.typ, rec.Code, rec.Body, tt.message)
+		}
+	}
+}
+
+func TestPaymentIntentError(t *testing.T) {
+	app := newTestApp()
+	if e := app.paymentIntentError(payment.ErrRequiresPaymentMethod); e.Status != http.StatusPaymentRequired {
+		t.Errorf("declined card: got %+v", e)
+	}
+	e := app.paymentIntentError(payment.ErrRequiresAction)
+	if e.Status != http.StatusConflict || e.Message != payment.ErrRequiresAction.Error() {
+		t.Errorf("authentication: got %+v", e)
+	}
+}
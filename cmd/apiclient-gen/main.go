@@ -0,0 +1,363 @@
+// Command apiclient-gen generates the typed Go client in internal/apiclient from the
+// OpenAPI document of the API. Deprecated operations are skipped.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"go-commerce/internal/apispec"
+)
+
+var (
+	initialisms = map[string]string{"id": "ID", "url": "URL", "api": "API", "json": "JSON", "mrr": "MRR", "arr": "ARR", "fx": "FX"}
+	methods     = []string{"get", "post", "put", "patch", "delete"}
+)
+
+func main() {
+	var specFile, out, pkg string
+	flag.StringVar(&specFile, "spec", "", "OpenAPI document to read (default: the document built from internal/apispec)")
+	flag.StringVar(&out, "o", "generated.go", "Output file")
+	flag.StringVar(&pkg, "package", "apiclient", "Package name of the generated code")
+	flag.Parse()
+
+	raw, err := readSpec(specFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var doc apispec.Document
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		log.Fatalf("could not parse OpenAPI document: %v", err)
+	}
+
+	src, err := generate(&doc, pkg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile(out, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readSpec(file string) ([]byte, error) {
+	if file == "" {
+		return apispec.JSON()
+	}
+	return os.ReadFile(file)
+}
+
+func generate(doc *apispec.Document, pkg string) ([]byte, error) {
+	var b bytes.Buffer
+
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := writeType(&b, name, doc.Components.Schemas[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	type operation struct {
+		method, path string
+		op           *apispec.OperationObject
+	}
+	var ops []operation
+	for path, item := range doc.Paths {
+		for _, method := range methods {
+			if op, ok := item[method]; ok && !op.Deprecated {
+				ops = append(ops, operation{strings.ToUpper(method), path, op})
+			}
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].op.OperationID < ops[j].op.OperationID })
+
+	for _, o := range ops {
+		if err := writeOperation(&b, o.method, o.path, o.op); err != nil {
+			return nil, err
+		}
+	}
+
+	var head bytes.Buffer
+	fmt.Fprintf(&head, "// Code generated by apiclient-gen from the OpenAPI document, version %s. DO NOT EDIT.\n\n", doc.Info.Version)
+	fmt.Fprintf(&head, "package %s\n\nimport (\n", pkg)
+	for _, imp := range []string{"context", "fmt", "io", "net/http", "net/url", "strconv", "time"} {
+		if bytes.Contains(b.Bytes(), []byte(imp[strings.LastIndex(imp, "/")+1:]+".")) {
+			fmt.Fprintf(&head, "%q\n", imp)
+		}
+	}
+	head.WriteString(")\n\n")
+	head.Write(b.Bytes())
+
+	src, err := format.Source(head.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated code is not valid Go: %w", err)
+	}
+	return src, nil
+}
+
+// writeType writes the struct type for an object schema
+func writeType(b *bytes.Buffer, name string, s *apispec.Schema) error {
+	if s.Type != "object" {
+		return fmt.Errorf("schema %s: only object schemas are supported", name)
+	}
+	required := make(map[string]bool)
+	for _, r := range s.Required {
+		required[r] = true
+	}
+
+	fmt.Fprintf(b, "// %s is the %s schema of the API\n", name, name)
+	fmt.Fprintf(b, "type %s struct {\n", name)
+	for _, field := range propertyOrder(s) {
+		prop := s.Properties[field]
+		typ, err := goType(prop)
+		if err != nil {
+			return fmt.Errorf("schema %s, property %s: %w", name, field, err)
+		}
+		tag := field
+		if !required[field] {
+			tag += ",omitempty"
+			if prop.Ref != "" {
+				typ = "*" + typ
+			}
+		}
+		fmt.Fprintf(b, "%s %s `json:\"%s\"`\n", exportedName(field), typ, tag)
+	}
+	b.WriteString("}\n\n")
+	return nil
+}
+
+// propertyOrder returns the properties in x-order, falling back to alphabetical order
+func propertyOrder(s *apispec.Schema) []string {
+	if len(s.Order) == len(s.Properties) {
+		return s.Order
+	}
+	fields := make([]string, 0, len(s.Properties))
+	for field := range s.Properties {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func goType(s *apispec.Schema) (string, error) {
+	if s.Ref != "" {
+		return strings.TrimPrefix(s.Ref, "#/components/schemas/"), nil
+	}
+
+	var typ string
+	switch s.Type {
+	case "string":
+		switch s.Format {
+		case "date-time":
+			typ = "time.Time"
+		case "byte":
+			typ = "[]byte"
+		default:
+			typ = "string"
+		}
+	case "integer":
+		typ = "int"
+		if s.Format == "int64" {
+			typ = "int64"
+		}
+	case "number":
+		typ = "float64"
+	case "boolean":
+		typ = "bool"
+	case "array":
+		elem, err := goType(s.Items)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + elem, nil
+	case "object":
+		if s.AdditionalProperties == nil {
+			return "map[string]interface{}", nil
+		}
+		elem, err := goType(s.AdditionalProperties)
+		if err != nil {
+			return "", err
+		}
+		return "map[string]" + elem, nil
+	default:
+		return "", fmt.Errorf("unsupported schema type %q", s.Type)
+	}
+
+	if s.Nullable {
+		typ = "*" + typ
+	}
+	return typ, nil
+}
+
+// writeOperation writes the client method for op
+func writeOperation(b *bytes.Buffer, method, path string, op *apispec.OperationObject) error {
+	name := op.OperationID
+	args := []string{"ctx context.Context"}
+	var query []apispec.Parameter
+
+	pathExpr := fmt.Sprintf("%q", path)
+	pathFormat := path
+	var pathArgs []string
+	for _, p := range op.Parameters {
+		switch p.In {
+		case "path":
+			placeholder := "{" + p.Name + "}"
+			if p.Schema != nil && p.Schema.Type == "string" {
+				args = append(args, fmt.Sprintf("%s string", p.Name))
+				pathArgs = append(pathArgs, fmt.Sprintf("url.PathEscape(%s)", p.Name))
+				pathFormat = strings.Replace(pathFormat, placeholder, "%s", 1)
+			} else {
+				args = append(args, fmt.Sprintf("%s int", p.Name))
+				pathArgs = append(pathArgs, p.Name)
+				pathFormat = strings.Replace(pathFormat, placeholder, "%d", 1)
+			}
+		case "query":
+			query = append(query, p)
+		}
+	}
+	if len(pathArgs) > 0 {
+		pathExpr = fmt.Sprintf("fmt.Sprintf(%q, %s)", pathFormat, strings.Join(pathArgs, ", "))
+	}
+
+	if len(query) > 0 {
+		fmt.Fprintf(b, "// %sParams are the query parameters of %s\n", name, name)
+		fmt.Fprintf(b, "type %sParams struct {\n", name)
+		for _, q := range query {
+			typ, err := goType(q.Schema)
+			if err != nil {
+				return fmt.Errorf("operation %s, parameter %s: %w", name, q.Name, err)
+			}
+			if q.Description != "" {
+				fmt.Fprintf(b, "// %s\n", q.Description)
+			}
+			fmt.Fprintf(b, "%s %s\n", exportedName(q.Name), typ)
+		}
+		b.WriteString("}\n\n")
+		args = append(args, fmt.Sprintf("params *%sParams", name))
+	}
+
+	if op.RequestBody != nil {
+		if mt, ok := op.RequestBody.Content["application/json"]; ok {
+			typ, err := goType(mt.Schema)
+			if err != nil {
+				return fmt.Errorf("operation %s, request body: %w", name, err)
+			}
+			args = append(args, "body *"+typ)
+		} else {
+			// uploads send a file as it is
+			args = append(args, "body io.Reader")
+		}
+	}
+
+	var result string
+	download := false
+	for code, resp := range op.Responses {
+		if code == "default" || code[0] != '2' {
+			continue
+		}
+		if mt, ok := resp.Content["application/json"]; ok {
+			typ, err := goType(mt.Schema)
+			if err != nil {
+				return fmt.Errorf("operation %s, response: %w", name, err)
+			}
+			result = typ
+		} else if len(resp.Content) > 0 {
+			download = true
+		}
+	}
+
+	if op.Summary != "" {
+		fmt.Fprintf(b, "// %s calls %s %s. %s\n", name, method, path, strings.TrimSuffix(op.Summary, ".")+".")
+	} else {
+		fmt.Fprintf(b, "// %s calls %s %s.\n", name, method, path)
+	}
+
+	returns := "error"
+	if download {
+		returns = "(io.ReadCloser, error)"
+	} else if result != "" {
+		if strings.HasPrefix(result, "[]") {
+			returns = fmt.Sprintf("(%s, error)", result)
+		} else {
+			returns = fmt.Sprintf("(*%s, error)", result)
+		}
+	}
+	fmt.Fprintf(b, "func (c *Client) %s(%s) %s {\n", name, strings.Join(args, ", "), returns)
+
+	queryExpr := "nil"
+	if len(query) > 0 {
+		b.WriteString("query := url.Values{}\nif params != nil {\n")
+		for _, q := range query {
+			field := "params." + exportedName(q.Name)
+			switch q.Schema.Type {
+			case "integer":
+				fmt.Fprintf(b, "if %s != 0 {\nquery.Set(%q, strconv.Itoa(%s))\n}\n", field, q.Name, field)
+			default:
+				fmt.Fprintf(b, "if %s != \"\" {\nquery.Set(%q, %s)\n}\n", field, q.Name, field)
+			}
+		}
+		b.WriteString("}\n")
+		queryExpr = "query"
+	}
+
+	bodyExpr := "nil"
+	if op.RequestBody != nil {
+		bodyExpr = "body"
+	}
+
+	switch {
+	case download:
+		fmt.Fprintf(b, "return c.download(ctx, http.Method%s, %s, %s)\n", methodConst(method), pathExpr, queryExpr)
+	case result == "":
+		fmt.Fprintf(b, "return c.do(ctx, http.Method%s, %s, %s, %s, nil)\n", methodConst(method), pathExpr, queryExpr, bodyExpr)
+	case strings.HasPrefix(result, "[]"):
+		fmt.Fprintf(b, "var out %s\nif err := c.do(ctx, http.Method%s, %s, %s, %s, &out); err != nil {\nreturn nil, err\n}\nreturn out, nil\n",
+			result, methodConst(method), pathExpr, queryExpr, bodyExpr)
+	default:
+		fmt.Fprintf(b, "var out %s\nif err := c.do(ctx, http.Method%s, %s, %s, %s, &out); err != nil {\nreturn nil, err\n}\nreturn &out, nil\n",
+			result, methodConst(method), pathExpr, queryExpr, bodyExpr)
+	}
+	b.WriteString("}\n\n")
+	return nil
+}
+
+func methodConst(method string) string {
+	switch method {
+	case http.MethodGet:
+		return "Get"
+	case http.MethodPost:
+		return "Post"
+	case http.MethodPut:
+		return "Put"
+	case http.MethodPatch:
+		return "Patch"
+	default:
+		return "Delete"
+	}
+}
+
+// exportedName turns a snake_case JSON name into an exported Go identifier
+func exportedName(s string) string {
+	parts := strings.Split(s, "_")
+	for i, p := range parts {
+		if up, ok := initialisms[p]; ok {
+			parts[i] = up
+		} else if p != "" {
+			parts[i] = strings.ToUpper(p[:1]) + p[1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
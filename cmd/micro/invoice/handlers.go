@@ -1,52 +1,362 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
+
+	"go-commerce/internal/invoicepdf"
+	"go-commerce/internal/models"
+	"go-commerce/internal/money"
+	"go-commerce/internal/tax"
+	"go-commerce/internal/urlsigner"
+
+	"github.com/go-chi/chi/v5"
+	mail "github.com/xhit/go-simple-mail/v2"
 )
 
 type InvoiceData struct {
-	ID        int       `json:"id"`
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	Email     string    `json:"email"`
-	Quantity  int       `json:"quantity"`
-	Amount    int       `json:"amount"`
-	Product   string    `json:"product"`
-	CreatedAt time.Time `json:"created_at"`
+	ID              int               `json:"id"`
+	FirstName       string            `json:"first_name"`
+	LastName        string            `json:"last_name"`
+	Email           string            `json:"email"`
+	Quantity        int               `json:"quantity"`
+	Amount          int               `json:"amount"`
+	Currency        string            `json:"currency"`
+	Subtotal        int               `json:"subtotal"`
+	TaxLines        []tax.Line        `json:"tax_lines"`
+	Coupon          string            `json:"coupon"`
+	Discount        int               `json:"discount"`
+	Shipping        int               `json:"shipping"`
+	ShippingMethod  string            `json:"shipping_method"`
+	BillingAddress  []string          `json:"billing_address"`
+	ShippingAddress []string          `json:"shipping_address"`
+	Product         string            `json:"product"`
+	CreatedAt       time.Time         `json:"created_at"`
+	LegalEntity     string            `json:"legal_entity,omitempty"`
+	Brand           string            `json:"brand,omitempty"`
+	TaxID           string            `json:"tax_id,omitempty"`
+	Status          string            `json:"status,omitempty"`
+	Items           []invoicepdf.Item `json:"items,omitempty"`
 }
 
+// invoiceLinkDays is how long the signed links to invoices are valid
+const invoiceLinkDays = 30
+
+// CreateAndSendInvoice issues the invoice of an order with the next number of its legal
+// entity, stores its PDF and emails it to the customer with a signed link to download it
+// again. An order that was invoiced already has its invoice sent again, to the address
+// it was issued to. Callers authenticate with an API bearer token or sign the request.
 func (app *application) CreateAndSendInvoice(w http.ResponseWriter, r *http.Request) {
+	if err := app.authenticateRequest(r); err != nil {
+		app.errorJSON(w, err, http.StatusUnauthorized)
+		return
+	}
+
 	var data InvoiceData
 
 	err := app.readJSON(w, r, &data)
 	if err != nil {
 		app.badRequest(w, err)
+		return
+	}
+	if data.LegalEntity == "" {
+		data.LegalEntity = app.config.legalEntity
 	}
 
-	err = app.GenerateInvoicePDF(data)
+	var pdf []byte
+	inv, err := app.DB.GetInvoiceForOrder(data.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		inv = models.Invoice{
+			Kind:        models.InvoiceKindInvoice,
+			LegalEntity: data.LegalEntity,
+			OrderID:     data.ID,
+			Email:       data.Email,
+			Amount:      data.Amount,
+			Currency:    data.Currency,
+		}
+		inv, err = app.DB.IssueInvoice(inv, func(inv *models.Invoice) error {
+			pdf, err = app.GenerateInvoicePDF(data, *inv)
+			if err != nil {
+				return err
+			}
+			inv.BlobKey = invoiceKey(*inv)
+			inv.Size = len(pdf)
+			return app.store.Put(r.Context(), inv.BlobKey, "application/pdf", pdf)
+		})
+		if errors.Is(err, models.ErrUnknownLegalEntity) {
+			app.badRequest(w, err)
+			return
+		}
+		// a request for the same order got there first
+		if errors.Is(err, models.ErrInvoiced) {
+			pdf, err = nil, nil
+		}
+	}
 	if err != nil {
-		app.badRequest(w, err)
+		app.errorJSON(w, err, http.StatusInternalServerError)
 		return
 	}
+	if pdf == nil {
+		pdf, err = app.store.Get(r.Context(), inv.BlobKey)
+		if err != nil {
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
 
-	attachments := []string{
-		fmt.Sprintf("./invoices/%d.pdf", data.ID),
+	link := app.invoiceLink(inv.Number)
+	attachments := []*mail.File{
+		{Name: inv.Number + ".pdf", Data: pdf, MimeType: "application/pdf"},
 	}
-	err = app.SendMail("info@widgets.com", data.Email, "Your Invoice", "invoice", attachments, nil)
+	mailData := struct {
+		Number string
+		Link   string
+		Days   int
+	}{inv.Number, link, invoiceLinkDays}
+	err = app.SendMail("info@widgets.com", inv.Email, "Your Invoice "+inv.Number, "invoice", attachments, mailData)
 	if err != nil {
 		app.badRequest(w, err)
 		return
 	}
 
-	// send invoice
-
 	var resp struct {
-		Error   bool `json:"error"`
+		Error   bool   `json:"error"`
 		Message string `json:"message"`
+		Number  string `json:"number"`
 	}
 	resp.Error = false
-	resp.Message = fmt.Sprintf("Invoice %d.pdf created and sent to %s", data.ID, data.Email)
+	resp.Message = fmt.Sprintf("Invoice %s created and sent to %s", inv.Number, inv.Email)
+	resp.Number = inv.Number
+	app.writeJSON(w, resp, http.StatusCreated)
+}
+
+// CreditNoteData is a refund of an invoiced order to issue a credit note for. Reference
+// identifies the refund, so that it is only credited once; TaxLines are the taxes it
+// gives back and Description what it is for, like the items returned.
+type CreditNoteData struct {
+	OrderID        int        `json:"order_id"`
+	Reference      string     `json:"reference"`
+	Amount         int        `json:"amount"`
+	Reason         string     `json:"reason"`
+	Description    string     `json:"description"`
+	FirstName      string     `json:"first_name"`
+	LastName       string     `json:"last_name"`
+	Email          string     `json:"email"`
+	BillingAddress []string   `json:"billing_address"`
+	TaxID          string     `json:"tax_id,omitempty"`
+	TaxLines       []tax.Line `json:"tax_lines"`
+	Brand          string     `json:"brand,omitempty"`
+}
+
+// CreateAndSendCreditNote issues a credit note for a full or partial refund of an
+// invoiced order. It is numbered in the credit note sequence of the invoice's legal
+// entity, names the invoice it credits, is stored with it and emailed to the customer
+// with a signed link. A refund that was credited already is not credited again. Only
+// the api, with a bearer token, issues credit notes.
+func (app *application) CreateAndSendCreditNote(w http.ResponseWriter, r *http.Request) {
+	if _, err := app.authenticateToken(r); err != nil {
+		app.errorJSON(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	var data CreditNoteData
+
+	err := app.readJSON(w, r, &data)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+	switch {
+	case data.OrderID <= 0:
+		app.badRequest(w, errors.New("order_id must be a positive number"))
+		return
+	case data.Amount <= 0:
+		app.badRequest(w, errors.New("amount must be a positive number"))
+		return
+	case data.Reference == "":
+		app.badRequest(w, errors.New("reference must be provided"))
+		return
+	}
+
+	var resp struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+		Number  string `json:"number"`
+		Link    string `json:"link"`
+	}
+
+	note, err := app.DB.GetInvoiceByReference(data.Reference)
+	if err == nil {
+		resp.Message = fmt.Sprintf("Refund %s was credited by %s already", data.Reference, note.Number)
+		resp.Number = note.Number
+		resp.Link = app.invoiceLink(note.Number)
+		app.writeJSON(w, resp, http.StatusOK)
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	inv, err := app.DB.GetInvoiceForOrder(data.OrderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("the order has not been invoiced"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if data.Email == "" {
+		data.Email = inv.Email
+	}
+
+	var pdf []byte
+	note = models.Invoice{
+		Kind:              models.InvoiceKindCreditNote,
+		LegalEntity:       inv.LegalEntity,
+		OrderID:           inv.OrderID,
+		CreditedInvoiceID: inv.ID,
+		CreditedNumber:    inv.Number,
+		Reference:         data.Reference,
+		Reason:            data.Reason,
+		Email:             data.Email,
+		Amount:            data.Amount,
+		Currency:          inv.Currency,
+	}
+	note, err = app.DB.IssueInvoice(note, func(note *models.Invoice) error {
+		pdf, err = app.GenerateCreditNotePDF(data, *note)
+		if err != nil {
+			return err
+		}
+		note.BlobKey = invoiceKey(*note)
+		note.Size = len(pdf)
+		return app.store.Put(r.Context(), note.BlobKey, "application/pdf", pdf)
+	})
+	switch {
+	case errors.Is(err, models.ErrOverCredited):
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	case errors.Is(err, models.ErrUnknownLegalEntity):
+		app.badRequest(w, errors.New("no credit note sequence for the legal entity of the invoice"))
+		return
+	case err != nil:
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	link := app.invoiceLink(note.Number)
+	attachments := []*mail.File{
+		{Name: note.Number + ".pdf", Data: pdf, MimeType: "application/pdf"},
+	}
+	mailData := struct {
+		Number  string
+		Invoice string
+		Amount  string
+		Link    string
+		Days    int
+	}{note.Number, inv.Number, money.New(int64(note.Amount), note.Currency).String(), link, invoiceLinkDays}
+	subject := fmt.Sprintf("Your Credit Note %s for Invoice %s", note.Number, inv.Number)
+	err = app.SendMail("info@widgets.com", data.Email, subject, "credit_note", attachments, mailData)
+	if err != nil {
+		app.badRequest(w, err)
+		return
+	}
+
+	resp.Message = fmt.Sprintf("Credit note %s for invoice %s created and sent to %s", note.Number, inv.Number, data.Email)
+	resp.Number = note.Number
+	resp.Link = link
 	app.writeJSON(w, resp, http.StatusCreated)
 }
+
+// invoiceKey is the key the PDF of an invoice is stored under
+func invoiceKey(inv models.Invoice) string {
+	return inv.LegalEntity + "/" + inv.Number + ".pdf"
+}
+
+// invoiceLink returns a signed link to download an invoice without logging in
+func (app *application) invoiceLink(number string) string {
+	link := fmt.Sprintf("%s/invoices/%s", app.config.publicURL, url.PathEscape(number))
+	signer := urlsigner.NewSigner([]byte(app.config.secretKey))
+	return signer.GenerateTokenFromString(link)
+}
+
+// GetInvoice downloads the PDF of the invoice numbered in the URL. Admins authenticate
+// with the bearer token of the api; customers follow the signed link of their invoice
+// email, which is valid for 30 days.
+func (app *application) GetInvoice(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("hash") != "" {
+		fullURL := fmt.Sprintf("%s%s", app.config.publicURL, r.RequestURI)
+		signer := urlsigner.NewSigner([]byte(app.config.secretKey))
+		if !signer.VerifyToken(fullURL) {
+			app.errorJSON(w, errors.New("invalid link"), http.StatusForbidden)
+			return
+		}
+		if signer.Expired(fullURL, invoiceLinkDays*24*60) {
+			app.errorJSON(w, errors.New("this link has expired"), http.StatusForbidden)
+			return
+		}
+	} else if _, err := app.authenticateToken(r); err != nil {
+		app.errorJSON(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	inv, ok := app.readInvoice(w, r)
+	if !ok {
+		return
+	}
+
+	pdf, err := app.store.Get(r.Context(), inv.BlobKey)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", inv.Number+".pdf"))
+	w.Header().Set("Content-Length", strconv.Itoa(len(pdf)))
+	w.Write(pdf)
+}
+
+// GetInvoiceLink returns a new signed link to the invoice numbered in the URL, to send
+// to the customer again
+func (app *application) GetInvoiceLink(w http.ResponseWriter, r *http.Request) {
+	if _, err := app.authenticateToken(r); err != nil {
+		app.errorJSON(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	inv, ok := app.readInvoice(w, r)
+	if !ok {
+		return
+	}
+
+	var resp struct {
+		models.Invoice
+		Link    string    `json:"link"`
+		Expires time.Time `json:"expires"`
+	}
+	resp.Invoice = inv
+	resp.Link = app.invoiceLink(inv.Number)
+	resp.Expires = time.Now().Add(invoiceLinkDays * 24 * time.Hour)
+	app.writeJSON(w, resp, http.StatusOK)
+}
+
+// readInvoice reads the invoice numbered in the URL, writing the error when there is none
+func (app *application) readInvoice(w http.ResponseWriter, r *http.Request) (models.Invoice, bool) {
+	inv, err := app.DB.GetInvoice(chi.URLParam(r, "number"))
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("no such invoice"), http.StatusNotFound)
+		return inv, false
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return inv, false
+	}
+	return inv, true
+}
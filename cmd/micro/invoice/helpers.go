@@ -1,15 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"strings"
 
-	"github.com/phpdave11/gofpdf"
-	"github.com/phpdave11/gofpdf/contrib/gofpdi"
+	"go-commerce/internal/invoicepdf"
+	"go-commerce/internal/models"
+	"go-commerce/internal/urlsigner"
 )
 
 type APIResponse struct {
@@ -29,7 +33,6 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, data in
 
 	err = decoder.Decode(&struct{}{})
 	if err != io.EOF {
-		fmt.Println(err.Error())
 		return errors.New("request body must only have one single JSON value")
 	}
 
@@ -49,66 +52,208 @@ func (app *application) writeJSON(w http.ResponseWriter, data interface{}, statu
 			}
 		}
 	}
-	w.WriteHeader(statuscode)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statuscode)
 	w.Write(out)
 	return nil
 }
 
 func (app *application) badRequest(w http.ResponseWriter, err error) error {
+	return app.errorJSON(w, err, http.StatusBadRequest)
+}
+
+// errorJSON writes an error out as JSON with a status code. The messages of server
+// errors are logged and not shown.
+func (app *application) errorJSON(w http.ResponseWriter, err error, statuscode int) error {
+	message := err.Error()
+	if statuscode >= http.StatusInternalServerError {
+		app.errorLog.Println(err)
+		message = http.StatusText(statuscode)
+	}
 	payload := APIResponse{
 		HasError: true,
-		Message:  err.Error(),
-	}
-	if err := app.writeJSON(w, payload, http.StatusBadRequest); err != nil {
-		return err
+		Message:  message,
 	}
-	return nil
+	return app.writeJSON(w, payload, statuscode)
 }
 
-func (app *application) GenerateInvoicePDF(data InvoiceData) error {
-	pdf := gofpdf.New("P", "mm", "Letter", "")
-	pdf.SetMargins(10, 13, 10)
-	pdf.SetAutoPageBreak(true, 0)
+// authenticateToken returns the user of the bearer token of a request, a token issued
+// by the api
+func (app *application) authenticateToken(r *http.Request) (*models.User, error) {
+	authorizationHeader := r.Header.Get("Authorization")
+	if authorizationHeader == "" {
+		return nil, errors.New("no authorization header received")
+	}
 
-	importer := gofpdi.NewImporter()
-	t := importer.ImportPage(pdf, "./pdf_templates/invoice.pdf", 1, "/MediaBox")
+	headerParts := strings.Split(authorizationHeader, " ")
+	if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		return nil, errors.New("no authorization header received")
+	}
 
-	pdf.AddPage()
-	importer.UseImportedTemplate(pdf, t, 0, 0, 215.9, 0)
+	token := headerParts[1]
+	if len(token) != 26 {
+		return nil, errors.New("authentication token is wrong")
+	}
 
-	pdf.SetY(50)
-	pdf.SetX(10)
-	pdf.SetFont("Times", "", 11)
+	user, err := app.DB.GetUserForToken(token)
+	if err != nil {
+		return nil, errors.New("no matching user found")
+	}
 
-	pdf.CellFormat(97, 8, fmt.Sprintf("Attention: %s %s", data.FirstName, data.LastName), "", 0, "L", false, 0, "")
-	pdf.Ln(5)
-	pdf.CellFormat(97, 8, data.CreatedAt.Format("2006-01-02"), "", 0, "L", false, 0, "")
+	return user, nil
+}
 
-	pdf.SetX(58)
-	pdf.SetY(93)
-	pdf.CellFormat(155, 8, data.Product, "", 0, "L", false, 0, "")
-	pdf.SetX(166)
-	pdf.CellFormat(20, 8, fmt.Sprintf("%d", data.Quantity), "", 0, "C", false, 0, "")
-	pdf.SetX(185)
-	pdf.CellFormat(20, 8, fmt.Sprintf("$%.2f", float32(data.Amount/100.0)), "", 0, "R", false, 0, "")
+// signedRequestMinutes is how long a request signed by the web front end is valid
+const signedRequestMinutes = 5
 
-	invoicePath := fmt.Sprintf("./invoices/%d.pdf", data.ID)
-	if err := pdf.OutputFileAndClose(invoicePath); err != nil {
+// authenticateRequest lets through requests with an API bearer token, and requests the
+// web front end signed with the secret key it shares with this service: their URL holds
+// the SHA-256 digest of their body and is signed like the invoice links, but is only
+// valid for a few minutes, so a signature cannot be used for another body or replayed
+// much later.
+func (app *application) authenticateRequest(r *http.Request) error {
+	if r.URL.Query().Get("hash") == "" {
+		_, err := app.authenticateToken(r)
 		return err
 	}
+
+	signer := urlsigner.NewSigner([]byte(app.config.secretKey))
+	if !signer.VerifyToken(r.RequestURI) {
+		return errors.New("invalid signature")
+	}
+	if signer.Expired(r.RequestURI, signedRequestMinutes) {
+		return errors.New("the signature has expired")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1048576))
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	digest := sha256.Sum256(body)
+	if r.URL.Query().Get("digest") != hex.EncodeToString(digest[:]) {
+		return errors.New("the signature is not for this request")
+	}
 	return nil
 }
 
-func (app *application) CreateDirIfNotExist(path string) error {
-	const mode = 0755
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		err = os.Mkdir(path, mode)
-		if err != nil {
-			app.errorLog.Println(err)
-			return err
+// GenerateInvoicePDF renders an invoice of an order, for the brand the order names or
+// else the brand of its legal entity
+func (app *application) GenerateInvoicePDF(data InvoiceData, inv models.Invoice) ([]byte, error) {
+	brand, err := app.brand(data.Brand, data.LegalEntity)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := invoiceDocument(data)
+	doc.Number = inv.Number
+	doc.IssuedAt = inv.IssuedAt
+	if total := doc.Total(); total != data.Amount {
+		app.errorLog.Printf("invoice %s totals %d but order %d was charged %d", inv.Number, total, data.ID, data.Amount)
+	}
+	return invoicepdf.Render(doc, brand)
+}
+
+// brand returns the brand to render documents for: the brand named, or else the brand
+// of their legal entity
+func (app *application) brand(name, legalEntity string) (invoicepdf.Brand, error) {
+	if name != "" {
+		brand, ok := app.brands[name]
+		if !ok {
+			return brand, fmt.Errorf("unknown brand %q", name)
 		}
+		return brand, nil
+	}
+	if brand, ok := app.brands[legalEntity]; ok {
+		return brand, nil
 	}
+	return invoicepdf.DefaultBrand, nil
+}
 
-	return nil
-}
\ No newline at end of file
+// invoiceDocument lays out the items, discount, tax and shipping of an order. An order
+// sent without items has a single item, the product, whose price is worked back from
+// the amount charged.
+func invoiceDocument(data InvoiceData) invoicepdf.Document {
+	doc := invoicepdf.Document{
+		Currency: data.Currency,
+		Buyer: invoicepdf.Party{
+			Name:    strings.TrimSpace(data.FirstName + " " + data.LastName),
+			Address: data.BillingAddress,
+			TaxID:   data.TaxID,
+			Email:   data.Email,
+		},
+		Items:    data.Items,
+		TaxLines: data.TaxLines,
+		Status:   data.Status,
+	}
+	if data.ID != 0 {
+		doc.Reference = fmt.Sprintf("Order %d of %s", data.ID, data.CreatedAt.Format("2006-01-02"))
+	}
+	if len(data.ShippingAddress) > 0 && strings.Join(data.ShippingAddress, "\n") != strings.Join(data.BillingAddress, "\n") {
+		doc.ShipTo = data.ShippingAddress
+	}
+	if data.Discount != 0 {
+		doc.Discounts = []invoicepdf.Adjustment{{Label: "Coupon " + data.Coupon, Amount: data.Discount}}
+	}
+	if data.ShippingMethod != "" {
+		doc.Shipping = &invoicepdf.Adjustment{Label: "Shipping (" + data.ShippingMethod + ")", Amount: data.Shipping}
+	}
+
+	if len(doc.Items) == 0 {
+		price := data.Amount - data.Shipping + data.Discount
+		for _, l := range data.TaxLines {
+			if !l.Inclusive {
+				price -= l.Amount
+			}
+		}
+		quantity := data.Quantity
+		if quantity < 1 {
+			quantity = 1
+		}
+		doc.Items = []invoicepdf.Item{{Description: data.Product, Quantity: quantity, UnitAmount: price / quantity, Amount: price}}
+	}
+	return doc
+}
+
+// GenerateCreditNotePDF renders a credit note, for the brand the refund names or else
+// the brand of its legal entity
+func (app *application) GenerateCreditNotePDF(data CreditNoteData, note models.Invoice) ([]byte, error) {
+	brand, err := app.brand(data.Brand, note.LegalEntity)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := invoicepdf.Document{
+		Title:     "Credit note",
+		Number:    note.Number,
+		Reference: "Credits invoice " + note.CreditedNumber,
+		IssuedAt:  note.IssuedAt,
+		Currency:  note.Currency,
+		Buyer: invoicepdf.Party{
+			Name:    strings.TrimSpace(data.FirstName + " " + data.LastName),
+			Address: data.BillingAddress,
+			TaxID:   data.TaxID,
+			Email:   note.Email,
+		},
+		TaxLines: data.TaxLines,
+		Status:   invoicepdf.StatusRefunded,
+	}
+	if data.Reason != "" {
+		doc.Notes = []string{"Reason: " + data.Reason}
+	}
+
+	// the credited amount is a single line, net of the exclusive taxes given back
+	description := data.Description
+	if description == "" {
+		description = "Refund of invoice " + note.CreditedNumber
+	}
+	net := note.Amount
+	for _, l := range data.TaxLines {
+		if !l.Inclusive {
+			net -= l.Amount
+		}
+	}
+	doc.Items = []invoicepdf.Item{{Description: description, Quantity: 1, UnitAmount: net, Amount: net}}
+
+	return invoicepdf.Render(doc, brand)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-commerce/internal/urlsigner"
+)
+
+// signedRequest returns a request to /create-and-send signed like the web front end signs it, over
+// the digest of signedBody, with body as its body
+func signedRequest(secret, signedBody, body string) *http.Request {
+	digest := sha256.Sum256([]byte(signedBody))
+	signer := urlsigner.NewSigner([]byte(secret))
+	path := signer.GenerateTokenFromString("/create-and-send?digest=" + hex.EncodeToString(digest[:]))
+	return httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+}
+
+func TestAuthenticateRequest(t *testing.T) {
+	app := &application{errorLog: log.New(io.Discard, "", 0)}
+	app.config.secretKey = "abcdefghijklmnopqrstuvwxyz012345"
+	body := `{"id": 5, "email": "ada@example.com"}`
+
+	r := signedRequest(app.config.secretKey, body, body)
+	if err := app.authenticateRequest(r); err != nil {
+		t.Fatalf("signed request refused: %v", err)
+	}
+	if got, _ := io.ReadAll(r.Body); string(got) != body {
+		t.Errorf("handler reads %q, want the body", got)
+	}
+
+	tests := []struct {
+		name string
+		r    *http.Request
+	}{
+		{"other body", signedRequest(app.config.secretKey, body, `{"id": 6, "email": "eve@example.com"}`)},
+		{"other key", signedRequest("0123456789abcdefghijklmnopqrstuv", body, body)},
+	}
+	for _, tt := range tests {
+		if err := app.authenticateRequest(tt.r); err == nil {
+			t.Errorf("%s: request let through", tt.name)
+		}
+	}
+}
+
+func TestCreateAndSendCreditNoteNeedsToken(t *testing.T) {
+	app := &application{errorLog: log.New(io.Discard, "", 0)}
+	app.config.secretKey = "abcdefghijklmnopqrstuvwxyz012345"
+	body := `{"order_id": 5, "reference": "re_1", "amount": 250}`
+
+	// the front end signs invoice requests, but only the api issues credit notes
+	for name, r := range map[string]*http.Request{
+		"no token":       httptest.NewRequest(http.MethodPost, "/credit-notes", strings.NewReader(body)),
+		"signed request": signedRequest(app.config.secretKey, body, body),
+	} {
+		rec := httptest.NewRecorder()
+		app.CreateAndSendCreditNote(rec, r)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got status %d", name, rec.Code)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -8,19 +9,42 @@ import (
 	"os"
 	"strconv"
 	"time"
+
+	"go-commerce/internal/blobstore"
+	"go-commerce/internal/driver"
+	"go-commerce/internal/invoicepdf"
+	"go-commerce/internal/models"
 )
 
 const version = "1.0.0"
 
 type config struct {
-	port   int
+	port int
 	smtp struct {
 		host     string
 		port     int
 		username string
 		password string
 	}
-	frontend  string
+	db struct {
+		dsn string
+	}
+	s3 struct {
+		endpoint  string
+		bucket    string
+		region    string
+		accessKey string
+		secretKey string
+	}
+	frontend      string
+	secretKey     string
+	publicURL     string
+	legalEntity   string
+	invoicePrefix string
+	creditPrefix  string
+	store         string
+	storeDir      string
+	brandsDir     string
 }
 
 type application struct {
@@ -28,6 +52,9 @@ type application struct {
 	infoLog  *log.Logger
 	errorLog *log.Logger
 	version  string
+	DB       models.DBWrapper
+	store    blobstore.Store
+	brands   map[string]invoicepdf.Brand
 }
 
 func (app *application) serve() error {
@@ -37,7 +64,8 @@ func (app *application) serve() error {
 		IdleTimeout:       30 * time.Second,
 		ReadTimeout:       10 * time.Second,
 		ReadHeaderTimeout: 5 * time.Second,
-		WriteTimeout:      5 * time.Second,
+		// long enough to store an invoice in the blob store and email it
+		WriteTimeout: time.Minute,
 	}
 
 	app.infoLog.Printf(fmt.Sprintf("Starting invoice microservice on port %d", app.config.port))
@@ -49,6 +77,14 @@ func main() {
 
 	flag.IntVar(&conf.port, "port", 5000, "Server port to listen to (default: 9000)")
 	flag.StringVar(&conf.frontend, "frontend", "http://localhost:8000", "Frontend URL")
+	flag.StringVar(&conf.secretKey, "secretkey", "qsdhytewnbc8rlopwe904hg7epqzas21", "Secret Key")
+	flag.StringVar(&conf.publicURL, "public-url", "http://localhost:5000", "URL customers reach the invoice microservice at, for the signed links to their invoices")
+	flag.StringVar(&conf.legalEntity, "entity", "widgets", "Legal entity invoices are issued by when the request does not name one")
+	flag.StringVar(&conf.invoicePrefix, "invoice-prefix", "INV-", "Prefix of the invoice numbers of the default legal entity")
+	flag.StringVar(&conf.creditPrefix, "credit-note-prefix", "CN-", "Prefix of the credit note numbers of the default legal entity")
+	flag.StringVar(&conf.store, "store", "file", "Where invoice PDFs are stored {file|s3}")
+	flag.StringVar(&conf.storeDir, "store-dir", "./invoices", "Directory invoice PDFs are stored in by the file store")
+	flag.StringVar(&conf.brandsDir, "brands", "./brands", "Directory of the brand files invoices are rendered with, one JSON file per brand")
 
 	flag.Parse()
 
@@ -56,20 +92,71 @@ func main() {
 	conf.smtp.port, _ = strconv.Atoi(os.Getenv("SMTP_PORT"))
 	conf.smtp.username = os.Getenv("SMTP_USERNAME")
 	conf.smtp.password = os.Getenv("SMTP_PASSWORD")
+	conf.db.dsn = os.Getenv("DB_DSN")
+	conf.s3.endpoint = os.Getenv("S3_ENDPOINT")
+	conf.s3.bucket = os.Getenv("S3_BUCKET")
+	conf.s3.region = os.Getenv("S3_REGION")
+	conf.s3.accessKey = os.Getenv("S3_ACCESS_KEY")
+	conf.s3.secretKey = os.Getenv("S3_SECRET_KEY")
 
 	infoLog := log.New(os.Stdout, "INFO:\t", log.Ldate|log.Ltime)
 	errorLog := log.New(os.Stdout, "ERROR:\t", log.Ldate|log.Ltime|log.Lshortfile)
 
+	conn, err := driver.OpenDB(conf.db.dsn)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	defer conn.Close()
+
+	store, err := openStore(conf)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	brands, err := invoicepdf.LoadBrands(conf.brandsDir)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
 	app := &application{
 		config:   conf,
 		infoLog:  infoLog,
 		errorLog: errorLog,
 		version:  version,
+		DB:       models.DBWrapper{DB: conn},
+		store:    store,
+		brands:   brands,
 	}
 
-	app.CreateDirIfNotExist("./invoices")
+	if err := app.DB.SaveInvoiceSequence(conf.legalEntity, models.InvoiceKindInvoice, conf.invoicePrefix); err != nil {
+		errorLog.Fatal(err)
+	}
+	if err := app.DB.SaveInvoiceSequence(conf.legalEntity, models.InvoiceKindCreditNote, conf.creditPrefix); err != nil {
+		errorLog.Fatal(err)
+	}
 
 	if err := app.serve(); err != nil {
 		log.Fatalln(err)
 	}
+}
+
+// openStore opens the blob store invoice PDFs are kept in: a directory, or a bucket of
+// an S3-compatible store like MinIO, which is created when missing
+func openStore(conf config) (blobstore.Store, error) {
+	switch conf.store {
+	case "file":
+		return blobstore.NewFileStore(conf.storeDir)
+	case "s3":
+		s3, err := blobstore.NewS3Store(conf.s3.endpoint, conf.s3.bucket, conf.s3.region, conf.s3.accessKey, conf.s3.secretKey)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		if err := s3.CreateBucket(ctx); err != nil {
+			return nil, err
+		}
+		return s3, nil
+	}
+	return nil, fmt.Errorf("unknown store %q", conf.store)
 }
\ No newline at end of file
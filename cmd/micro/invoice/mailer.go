@@ -13,7 +13,7 @@ import (
 //go:embed email_templates
 var emailTemplateFS embed.FS
 
-func (app *application) SendMail(from, to, subject, tmpl string, attachments []string, data interface{}) error {
+func (app *application) SendMail(from, to, subject, tmpl string, attachments []*mail.File, data interface{}) error {
 	templateToRender := fmt.Sprintf("email_templates/%s.html.tmpl", tmpl)
 	t, err := template.New("email-html").ParseFS(emailTemplateFS, templateToRender)
 	if err != nil {
@@ -65,7 +65,7 @@ func (app *application) SendMail(from, to, subject, tmpl string, attachments []s
 	
 	if len(attachments) > 0 {
 		for _, x := range attachments {
-			email.Attach(&mail.File{Name: "", FilePath: x})
+			email.Attach(x)
 		}
 	}
 
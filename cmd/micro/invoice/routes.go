@@ -20,6 +20,9 @@ func (app *application) routes() http.Handler {
 	mux.Use(middleware.Logger)
 
 	mux.Post("/create-and-send", app.CreateAndSendInvoice)
+	mux.Post("/credit-notes", app.CreateAndSendCreditNote)
+	mux.Get("/invoices/{number}", app.GetInvoice)
+	mux.Get("/invoices/{number}/link", app.GetInvoiceLink)
 
 	return mux
 }
@@ -0,0 +1,114 @@
+// Command reconcile compares the payments recorded in the database with the charges,
+// refunds and subscriptions of the gateway over a range of days, reports what is
+// missing, mismatched or orphaned and, with -repair, repairs what it can. It exits with
+// status 1 when findings are left unrepaired, so it can run from cron.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"go-commerce/internal/driver"
+	"go-commerce/internal/models"
+	"go-commerce/internal/payment"
+	"go-commerce/internal/reconcile"
+)
+
+const dateLayout = "2006-01-02"
+
+func main() {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	var fromDate, toDate, fakeGateway string
+	var repair, asJSON bool
+	var margin time.Duration
+	flag.StringVar(&fromDate, "from", today.AddDate(0, 0, -1).Format(dateLayout), "First day to reconcile, in UTC")
+	flag.StringVar(&toDate, "to", today.Format(dateLayout), "Day to reconcile until, not included")
+	flag.BoolVar(&repair, "repair", false, "Repair missing and mismatched records from the gateway")
+	flag.BoolVar(&asJSON, "json", false, "Write the report as JSON")
+	flag.DurationVar(&margin, "margin", time.Hour, "How far outside the range gateway records are matched")
+	flag.StringVar(&fakeGateway, "fake-gateway", "", "JSON file of gateway records to reconcile against instead of Stripe")
+	flag.Parse()
+
+	from, err := time.Parse(dateLayout, fromDate)
+	if err != nil {
+		log.Fatalf("invalid -from: %v", err)
+	}
+	to, err := time.Parse(dateLayout, toDate)
+	if err != nil {
+		log.Fatalf("invalid -to: %v", err)
+	}
+	if !from.Before(to) {
+		log.Fatal("-from must be before -to")
+	}
+
+	var gateway reconcile.Gateway = reconcile.StripeGateway{
+		Config: &payment.Config{Secret: os.Getenv("STRIPE_SECRET")},
+	}
+	if fakeGateway != "" {
+		if gateway, err = reconcile.LoadFakeGateway(fakeGateway); err != nil {
+			log.Fatalf("could not load fake gateway: %v", err)
+		}
+	}
+
+	conn, err := driver.OpenDB(os.Getenv("DB_DSN"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	rc := reconcile.Reconciler{
+		DB:      &models.DBWrapper{DB: conn},
+		Gateway: gateway,
+		Repair:  repair,
+		Margin:  margin,
+	}
+	report, err := rc.Run(from, to)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		printReport(report)
+	}
+
+	if report.Unresolved() > 0 {
+		os.Exit(1)
+	}
+}
+
+func printReport(r reconcile.Report) {
+	fmt.Printf("Reconciled %s to %s: %d charges, %d refunds, %d subscriptions, %d transactions\n",
+		r.From.Format(dateLayout), r.To.Format(dateLayout), r.Charges, r.Refunds, r.Subscriptions, r.Transactions)
+	if len(r.Findings) == 0 {
+		fmt.Println("No differences found")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tOBJECT\tGATEWAY ID\tTRANSACTION\tORDER\tDETAIL\tREPAIRED")
+	for _, f := range r.Findings {
+		repaired := "no"
+		switch {
+		case f.Repaired:
+			repaired = "yes"
+		case f.RepairError != "":
+			repaired = "no: " + f.RepairError
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+			f.Kind, f.Object, f.GatewayID, f.TransactionID, f.OrderID, f.Detail, repaired)
+	}
+	w.Flush()
+	fmt.Printf("%d differences, %d unresolved\n", len(r.Findings), r.Unresolved())
+}
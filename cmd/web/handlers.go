@@ -5,9 +5,13 @@ import (
 	"go-commerce/internal/encryption"
 	"go-commerce/internal/models"
 	"go-commerce/internal/payment"
+	"go-commerce/internal/shipping"
+	"go-commerce/internal/tax"
 	"go-commerce/internal/urlsigner"
+	"go-commerce/internal/validator"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -25,8 +29,21 @@ type TransactionData struct {
 	ExpiryMonth     int
 	ExpiryYear      int
 	BankReturnCode  string
+	Pending         bool
+	Authorized      bool
+	CaptureBefore   time.Time
+	Coupon          string
+	Discount        int
+	Tax             tax.Quote
+	Shipping        shipping.Quote
+	BillingAddress  models.Address
+	ShippingAddress models.Address
 }
 
+// GetTransactionData reads the payment posted by a payment form and checks it with the
+// gateway. A payment that has not succeeded, is not processing and is not an
+// authorization waiting to be captured returns one of the errors of
+// payment.CheckPaymentIntent.
 func (app *application) GetTransactionData(r *http.Request) (TransactionData, error) {
 	var transactionData TransactionData
 	if err := r.ParseForm(); err != nil {
@@ -37,10 +54,8 @@ func (app *application) GetTransactionData(r *http.Request) (TransactionData, er
 	lastName := r.Form.Get("last_name")
 	email := r.Form.Get("email")
 
-	amount, _ := strconv.Atoi(r.Form.Get("payment_amount"))
 	paymentMethodId := r.Form.Get("payment_method")
 	paymentIntentId := r.Form.Get("payment_intent")
-	currency := r.Form.Get("payment_currency")
 
 	payConf := payment.Config{
 		Secret: app.config.stripe.secret,
@@ -50,15 +65,21 @@ func (app *application) GetTransactionData(r *http.Request) (TransactionData, er
 	if err != nil {
 		return transactionData, err
 	}
+	if err := payment.CheckPaymentIntent(paymentIntent); err != nil {
+		return transactionData, err
+	}
 	paymentMethod, err := payConf.GetPaymentMethod(paymentMethodId)
 	if err != nil {
 		return transactionData, err
 	}
 
+	// what was charged comes from the gateway, not from the form
+	amount := int(paymentIntent.Amount)
+	currency := string(paymentIntent.Currency)
 	lastFour := paymentMethod.Card.Last4
 	expiryMonth := paymentMethod.Card.ExpMonth
 	expiryYear := paymentMethod.Card.ExpYear
-	bankReturnCode := paymentIntent.Charges.Data[0].ID
+	bankReturnCode := payment.ChargeID(paymentIntent)
 
 	transactionData = TransactionData{
 		FirstName:       firstName,
@@ -72,6 +93,11 @@ func (app *application) GetTransactionData(r *http.Request) (TransactionData, er
 		ExpiryMonth:     int(expiryMonth),
 		ExpiryYear:      int(expiryYear),
 		BankReturnCode:  bankReturnCode,
+		Pending:         !payment.Succeeded(paymentIntent) && !payment.Authorized(paymentIntent),
+		Authorized:      payment.Authorized(paymentIntent),
+	}
+	if transactionData.Authorized {
+		transactionData.CaptureBefore = payment.CaptureBefore(paymentIntent)
 	}
 	return transactionData, nil
 }
@@ -110,19 +136,125 @@ func (app *application) ChargeOnce(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// renderBuyPage re-renders the buy page for the posted product with the submitted
+// values and field errors
+func (app *application) renderBuyPage(w http.ResponseWriter, r *http.Request, errors map[string]string) {
+	widgetID, _ := strconv.Atoi(r.Form.Get("product_id"))
+	widget, err := app.DB.GetWidget(widgetID)
+	if err != nil {
+		app.errorLog.Println(err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	stringMap := map[string]string{
+		"publishable_key": app.config.stripe.key,
+		"first_name":      r.Form.Get("first_name"),
+		"last_name":       r.Form.Get("last_name"),
+		"email":           r.Form.Get("email"),
+		"cardholder_name": r.Form.Get("cardholder_name"),
+		"currency":        r.Form.Get("currency"),
+		"country":         r.Form.Get("country"),
+		"region":          r.Form.Get("region"),
+		"tax_id":          r.Form.Get("tax_id"),
+		"coupon":          r.Form.Get("coupon"),
+		"ship_to_billing": r.Form.Get("ship_to_billing"),
+	}
+	for _, prefix := range []string{"billing_address.", "shipping_address."} {
+		for _, field := range []string{"name", "line1", "line2", "city", "region", "postcode", "country"} {
+			stringMap[prefix+field] = r.Form.Get(prefix + field)
+		}
+	}
+	data := map[string]interface{}{"widget": widget}
+
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	if err := app.renderTemplate(w, r, "buy", &templateData{StringMap: stringMap, Data: data, Errors: errors}, "stripe-js"); err != nil {
+		app.errorLog.Println(err)
+	}
+}
+
 func (app *application) PaymentSuccessful(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
 		app.errorLog.Println(err)
 		return
 	}
 
+	v := validator.New()
+	v.Check("product_id", r.Form.Get("product_id"), validator.Required, validator.Integer)
+	v.Check("first_name", r.Form.Get("first_name"), validator.Required, validator.MaxLength(255))
+	v.Check("last_name", r.Form.Get("last_name"), validator.Required, validator.MaxLength(255))
+	v.Check("email", r.Form.Get("email"), validator.Required, validator.Email)
+	v.Check("payment_intent", r.Form.Get("payment_intent"), validator.Required)
+	v.Check("payment_method", r.Form.Get("payment_method"), validator.Required)
+	v.Check("country", r.Form.Get("country"), validator.Required, validator.Length(2))
+	v.Check("region", r.Form.Get("region"), validator.MaxLength(3))
+	v.Check("tax_id", r.Form.Get("tax_id"), validator.MaxLength(64))
+	v.Check("coupon", r.Form.Get("coupon"), validator.MaxLength(64))
+
+	// the billing address is in the buyer's country and region; parcels go to it
+	// unless the buyer gave a separate shipping address
+	billing := addressFromForm(r, "billing_address.")
+	billing.Name = strings.TrimSpace(r.Form.Get("first_name") + " " + r.Form.Get("last_name"))
+	billing.Country, billing.Region = r.Form.Get("country"), r.Form.Get("region")
+	checkAddress(v, "billing_address.", billing)
+	shippingAddress := billing
+	if r.Form.Get("ship_to_billing") == "" {
+		shippingAddress = addressFromForm(r, "shipping_address.")
+		checkAddress(v, "shipping_address.", shippingAddress)
+	}
+	if !v.Valid() {
+		app.renderBuyPage(w, r, v.Errors)
+		return
+	}
+
 	product_id, _ := strconv.Atoi(r.Form.Get("product_id"))
 	trxnData, err := app.GetTransactionData(r)
+	if payment.IsIncomplete(err) {
+		app.renderBuyPage(w, r, map[string]string{"payment": "Your payment was not completed: " + err.Error()})
+		return
+	}
 	if err != nil {
 		app.errorLog.Println(err)
 		return
 	}
 
+	// the api charged the price less the coupon plus the tax and shipping it quoted;
+	// quote again to record the discount, the tax lines and the shipping
+	widget, err := app.DB.GetWidget(product_id)
+	if err != nil {
+		app.errorLog.Println(err)
+		return
+	}
+	var coupon models.Coupon
+	if code := r.Form.Get("coupon"); code != "" {
+		// the api checked the coupon before the card was charged, so the order records
+		// it even if it has since run out
+		coupon, err = app.DB.GetCouponByCode(code)
+		if err != nil {
+			app.errorLog.Println(err)
+			return
+		}
+		price, _ := widget.PriceIn(trxnData.Currency)
+		trxnData.Coupon, trxnData.Discount = coupon.Code, coupon.Discount(price)
+	}
+	trxnData.Tax, err = app.quoteTax(r, widget, trxnData.Currency, trxnData.Discount)
+	if err != nil {
+		app.errorLog.Println(err)
+		return
+	}
+	trxnData.Shipping, err = app.quoteShipping(widget, trxnData.Currency, shippingAddress)
+	if err != nil {
+		app.errorLog.Println(err)
+		return
+	}
+	// a payment intent that was not charged at the quoted total, or was charged for
+	// another widget or coupon than the form names, is not recorded
+	if total := trxnData.Tax.Total + trxnData.Shipping.Amount; total != trxnData.Amount {
+		app.errorLog.Printf("payment intent %s charged %d but the quotes total %d", trxnData.PaymentIntentID, trxnData.Amount, total)
+		app.renderBuyPage(w, r, map[string]string{"payment": "Your payment does not match the price of your order, so it was not recorded. Please contact us."})
+		return
+	}
+
 	// create new customer
 	customer_id, err := app.SaveCustomer(trxnData.FirstName, trxnData.LastName, trxnData.Email)
 	if err != nil {
@@ -130,6 +262,35 @@ func (app *application) PaymentSuccessful(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// save the addresses, once when the parcel goes to the billing address
+	billing.CustomerID, billing.Kind = customer_id, models.AddressBilling
+	if billing.ID, err = app.DB.InsertAddress(billing); err != nil {
+		app.errorLog.Println(err)
+		return
+	}
+	if r.Form.Get("ship_to_billing") == "" {
+		shippingAddress.CustomerID, shippingAddress.Kind = customer_id, models.AddressShipping
+		if shippingAddress.ID, err = app.DB.InsertAddress(shippingAddress); err != nil {
+			app.errorLog.Println(err)
+			return
+		}
+	} else {
+		shippingAddress = billing
+	}
+	trxnData.BillingAddress, trxnData.ShippingAddress = billing, shippingAddress
+
+	// a payment still processing is recorded pending, and settled by its webhook event;
+	// an authorization keeps the order pending until it is captured or voided
+	transactionStatus, orderStatus := models.TransactionCleared, models.OrderCleared
+	var captureBefore *time.Time
+	switch {
+	case trxnData.Pending:
+		transactionStatus, orderStatus = models.TransactionPending, models.OrderPending
+	case trxnData.Authorized:
+		transactionStatus, orderStatus = models.TransactionAuthorized, models.OrderPending
+		captureBefore = &trxnData.CaptureBefore
+	}
+
 	// create new transaction
 	transaction := models.Transaction{
 		Amount:              trxnData.Amount,
@@ -140,7 +301,8 @@ func (app *application) PaymentSuccessful(w http.ResponseWriter, r *http.Request
 		PaymentMethod:       trxnData.PaymentMethodID,
 		CardExpiryMonth:     trxnData.ExpiryMonth,
 		CardExpiryYear:      trxnData.ExpiryYear,
-		TransactionStatusID: 2,
+		TransactionStatusID: transactionStatus,
+		CaptureBefore:       captureBefore,
 		CreatedAt:           time.Now(),
 		UpdatedAt:           time.Now(),
 	}
@@ -155,9 +317,18 @@ func (app *application) PaymentSuccessful(w http.ResponseWriter, r *http.Request
 		WidgetID:      product_id,
 		TransactionID: transaction_id,
 		CustomerID:    customer_id,
-		StatusID:      1,
+		StatusID:      orderStatus,
 		Quantity:      1,
 		Amount:        trxnData.Amount,
+		TaxJurisdiction: trxnData.Tax.Jurisdiction,
+		TaxID:         tax.NormalizeTaxID(r.Form.Get("tax_id")),
+		TaxLines:      trxnData.Tax.Lines,
+		CouponID:      coupon.ID,
+		Discount:      trxnData.Discount,
+		Shipping:      trxnData.Shipping.Amount,
+		ShippingMethod: trxnData.Shipping.Method,
+		BillingAddress: &billing,
+		ShippingAddress: &shippingAddress,
 		CreatedAt:     time.Now(),
 		UpdatedAt:     time.Now(),
 	}
@@ -166,6 +337,12 @@ func (app *application) PaymentSuccessful(w http.ResponseWriter, r *http.Request
 		app.errorLog.Println(err)
 		return
 	}
+	// the order now counts as the redemption its coupon held for the checkout
+	if coupon.ID != 0 {
+		if err := app.DB.ReleaseCouponReservationForIntent(trxnData.PaymentIntentID); err != nil {
+			app.errorLog.Println(err)
+		}
+	}
 
 	invoiceData := InvoiceData{
 		ID: orderID,
@@ -174,9 +351,23 @@ func (app *application) PaymentSuccessful(w http.ResponseWriter, r *http.Request
 		Email: trxnData.Email,
 		Quantity: order.Quantity,
 		Amount: trxnData.Amount,
-		Product: "Widget",
+		Currency: trxnData.Currency,
+		Subtotal: trxnData.Tax.Subtotal,
+		TaxLines: trxnData.Tax.Lines,
+		Coupon: trxnData.Coupon,
+		Discount: trxnData.Discount,
+		Shipping: trxnData.Shipping.Amount,
+		ShippingMethod: trxnData.Shipping.Method,
+		BillingAddress: billing.Lines(),
+		ShippingAddress: shippingAddress.Lines(),
+		Product: widget.Name,
+		TaxID: order.TaxID,
+		Status: "paid",
 		CreatedAt: order.CreatedAt,
 	}
+	if orderStatus == models.OrderPending {
+		invoiceData.Status = "pending"
+	}
 
 	err = app.CallInvoiceMicroService(invoiceData)
 	if err != nil {
@@ -208,6 +399,11 @@ func (app *application) TerminalPaymentSuccessful(w http.ResponseWriter, r *http
 		return
 	}
 
+	transactionStatus := models.TransactionCleared
+	if trxnData.Pending {
+		transactionStatus = models.TransactionPending
+	}
+
 	// create new transaction
 	transaction := models.Transaction{
 		Amount:              trxnData.Amount,
@@ -218,7 +414,7 @@ func (app *application) TerminalPaymentSuccessful(w http.ResponseWriter, r *http
 		PaymentMethod:       trxnData.PaymentMethodID,
 		CardExpiryMonth:     trxnData.ExpiryMonth,
 		CardExpiryYear:      trxnData.ExpiryYear,
-		TransactionStatusID: 2,
+		TransactionStatusID: transactionStatus,
 		CreatedAt:           time.Now(),
 		UpdatedAt:           time.Now(),
 	}
@@ -322,6 +518,18 @@ func (app *application) PostLoginPage(w http.ResponseWriter, r *http.Request) {
 	email := r.Form.Get("email")
 	password := r.Form.Get("password")
 
+	v := validator.New()
+	v.Check("email", email, validator.Required, validator.Email)
+	v.Check("password", password, validator.Required)
+	if !v.Valid() {
+		stringMap := map[string]string{"email": email}
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		if err := app.renderTemplate(w, r, "login", &templateData{StringMap: stringMap, Errors: v.Errors}); err != nil {
+			app.errorLog.Println(err)
+		}
+		return
+	}
+
 	id, err := app.DB.Authenticate(email, password)
 	if err != nil {
 		app.errorLog.Println(err)
@@ -375,6 +583,78 @@ func (app *application) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// UpdateCard shows the page a customer updates the card of a past due subscription on,
+// from the signed link of a dunning email. Links are valid for a week.
+func (app *application) UpdateCard(w http.ResponseWriter, r *http.Request) {
+	fullURL := fmt.Sprintf("%s%s", app.config.frontend, r.RequestURI)
+	signer := urlsigner.NewSigner([]byte(app.config.secretKey))
+
+	if !signer.VerifyToken(fullURL) {
+		app.errorLog.Println("invalid url: tampering detected")
+		return
+	}
+
+	if signer.Expired(fullURL, 7*24*60) {
+		app.errorLog.Println("Link expired")
+		return
+	}
+
+	encryptor := encryption.NewEncryptor([]byte(app.config.secretKey))
+	token, err := encryptor.Encrypt(r.URL.Query().Get("subscription"))
+	if err != nil {
+		app.errorLog.Println("Encryption failed")
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["token"] = token
+
+	stringMap := make(map[string]string)
+	stringMap["publishable_key"] = app.config.stripe.key
+
+	if err := app.renderTemplate(w, r, "update-card", &templateData{Data: data, StringMap: stringMap}); err != nil {
+		app.errorLog.Println(err)
+	}
+}
+
+// Portal shows the page customers ask for the links to their subscriptions on
+func (app *application) Portal(w http.ResponseWriter, r *http.Request) {
+	if err := app.renderTemplate(w, r, "portal", &templateData{}); err != nil {
+		app.errorLog.Println(err)
+	}
+}
+
+// PortalSubscription shows a customer their subscription, its trial and its usage in the
+// current period, from the signed link of a portal email. Links are valid for a day.
+func (app *application) PortalSubscription(w http.ResponseWriter, r *http.Request) {
+	fullURL := fmt.Sprintf("%s%s", app.config.frontend, r.RequestURI)
+	signer := urlsigner.NewSigner([]byte(app.config.secretKey))
+
+	if !signer.VerifyToken(fullURL) {
+		app.errorLog.Println("invalid url: tampering detected")
+		return
+	}
+
+	if signer.Expired(fullURL, 24*60) {
+		app.errorLog.Println("Link expired")
+		return
+	}
+
+	encryptor := encryption.NewEncryptor([]byte(app.config.secretKey))
+	token, err := encryptor.Encrypt(r.URL.Query().Get("subscription"))
+	if err != nil {
+		app.errorLog.Println("Encryption failed")
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["token"] = token
+
+	if err := app.renderTemplate(w, r, "portal-subscription", &templateData{Data: data}); err != nil {
+		app.errorLog.Println(err)
+	}
+}
+
 func (app *application) AllSales(w http.ResponseWriter, r *http.Request) {
 	if err := app.renderTemplate(w, r, "all_sales", &templateData{}); err != nil {
 		app.errorLog.Println(err)
@@ -388,7 +668,49 @@ func (app *application) AllSubscriptions(w http.ResponseWriter, r *http.Request)
 }
 
 func (app *application) ShowSale(w http.ResponseWriter, r *http.Request) {
-	if err := app.renderTemplate(w, r, "sale", &templateData{}); err != nil {
+	if err := app.renderTemplate(w, r, "sale", &templateData{}, "fulfillment-js"); err != nil {
+		app.errorLog.Println(err)
+	}
+}
+
+// Returns shows the form customers open returns with
+func (app *application) Returns(w http.ResponseWriter, r *http.Request) {
+	if err := app.renderTemplate(w, r, "returns", &templateData{}); err != nil {
+		app.errorLog.Println(err)
+	}
+}
+
+// Fulfillment shows the sales to pick and ship and takes bulk shipment uploads
+func (app *application) Fulfillment(w http.ResponseWriter, r *http.Request) {
+	if err := app.renderTemplate(w, r, "fulfillment", &templateData{}, "fulfillment-js"); err != nil {
+		app.errorLog.Println(err)
+	}
+}
+
+// Disputes lists the chargebacks and inquiries synced from Stripe
+func (app *application) Disputes(w http.ResponseWriter, r *http.Request) {
+	if err := app.renderTemplate(w, r, "disputes", &templateData{}, "dispute-js"); err != nil {
+		app.errorLog.Println(err)
+	}
+}
+
+// ShowDispute shows a dispute and takes its evidence
+func (app *application) ShowDispute(w http.ResponseWriter, r *http.Request) {
+	if err := app.renderTemplate(w, r, "dispute", &templateData{}, "dispute-js"); err != nil {
+		app.errorLog.Println(err)
+	}
+}
+
+// Payouts shows the payouts with their gross, refunds, fees and net
+func (app *application) Payouts(w http.ResponseWriter, r *http.Request) {
+	if err := app.renderTemplate(w, r, "payouts", &templateData{}); err != nil {
+		app.errorLog.Println(err)
+	}
+}
+
+// ShowPayout shows a payout and the orders it paid out
+func (app *application) ShowPayout(w http.ResponseWriter, r *http.Request) {
+	if err := app.renderTemplate(w, r, "payout", &templateData{}); err != nil {
 		app.errorLog.Println(err)
 	}
 }
@@ -2,30 +2,56 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
+
+	"go-commerce/internal/models"
+	"go-commerce/internal/shipping"
+	"go-commerce/internal/tax"
+	"go-commerce/internal/urlsigner"
+	"go-commerce/internal/validator"
 )
 
 type InvoiceData struct {
-	ID        int       `json:"id"`
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	Email     string    `json:"email"`
-	Quantity  int       `json:"quantity"`
-	Amount    int       `json:"amount"`
-	Product   string    `json:"product"`
-	CreatedAt time.Time `json:"created_at"`
+	ID              int        `json:"id"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	Email           string     `json:"email"`
+	Quantity        int        `json:"quantity"`
+	Amount          int        `json:"amount"`
+	Currency        string     `json:"currency"`
+	Subtotal        int        `json:"subtotal"`
+	TaxLines        []tax.Line `json:"tax_lines"`
+	Coupon          string     `json:"coupon"`
+	Discount        int        `json:"discount"`
+	Shipping        int        `json:"shipping"`
+	ShippingMethod  string     `json:"shipping_method"`
+	BillingAddress  []string   `json:"billing_address"`
+	ShippingAddress []string   `json:"shipping_address"`
+	Product         string     `json:"product"`
+	TaxID           string     `json:"tax_id,omitempty"`
+	Status          string     `json:"status,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
 }
 
+// CallInvoiceMicroService asks the invoice microservice to issue and send the invoice of
+// an order. The request is signed with the secret key the two share, over a digest of its
+// body, since the front end has no API token of its own.
 func (app *application) CallInvoiceMicroService(data InvoiceData) error {
-	url := "http://localhost:5000/create-and-send"
 	out, err := json.MarshalIndent(data, "", "\t")
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(out))
+	digest := sha256.Sum256(out)
+	signer := urlsigner.NewSigner([]byte(app.config.secretKey))
+	path := signer.GenerateTokenFromString("/create-and-send?digest=" + hex.EncodeToString(digest[:]))
+
+	req, err := http.NewRequest("POST", "http://localhost:5000"+path, bytes.NewBuffer(out))
 	if err != nil {
 		return err
 	}
@@ -37,6 +63,71 @@ func (app *application) CallInvoiceMicroService(data InvoiceData) error {
 		return err
 	}
 	defer resp.Body.Close()
-	app.infoLog.Println(resp.Body)
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("invoice service answered %s", resp.Status)
+	}
 	return nil
-}
\ No newline at end of file
+}
+
+// quoteTax works out the tax on a widget bought in currency, less discount, from the
+// country, region and tax ID of the posted checkout form, the same way the api quoted it
+func (app *application) quoteTax(r *http.Request, widget models.Widget, currency string, discount int) (tax.Quote, error) {
+	price, err := widget.PriceIn(currency)
+	if err != nil {
+		return tax.Quote{}, err
+	}
+	price -= discount
+	table, err := app.DB.GetTaxTable()
+	if err != nil {
+		return tax.Quote{}, err
+	}
+	return table.Calculate(tax.Request{
+		Jurisdiction: tax.Jurisdiction(r.Form.Get("country"), r.Form.Get("region")),
+		TaxID:        r.Form.Get("tax_id"),
+		Currency:     currency,
+		Items:        []tax.Item{{Description: widget.Name, Amount: price}},
+	})
+}
+
+// addressFromForm reads the address posted in the form fields under prefix, like
+// "billing_address.line1"
+func addressFromForm(r *http.Request, prefix string) models.Address {
+	return models.Address{
+		Name:     r.Form.Get(prefix + "name"),
+		Line1:    r.Form.Get(prefix + "line1"),
+		Line2:    r.Form.Get(prefix + "line2"),
+		City:     r.Form.Get(prefix + "city"),
+		Region:   r.Form.Get(prefix + "region"),
+		Postcode: r.Form.Get(prefix + "postcode"),
+		Country:  r.Form.Get(prefix + "country"),
+	}
+}
+
+// checkAddress validates an address read by addressFromForm
+func checkAddress(v *validator.Validator, prefix string, a models.Address) {
+	v.Check(prefix+"name", a.Name, validator.MaxLength(255))
+	v.Check(prefix+"line1", a.Line1, validator.Required, validator.MaxLength(255))
+	v.Check(prefix+"line2", a.Line2, validator.MaxLength(255))
+	v.Check(prefix+"city", a.City, validator.Required, validator.MaxLength(255))
+	v.Check(prefix+"region", a.Region, validator.MaxLength(3))
+	v.Check(prefix+"postcode", a.Postcode, validator.MaxLength(16))
+	v.Check(prefix+"country", a.Country, validator.Required, validator.Length(2))
+}
+
+// quoteShipping prices the shipping of a widget bought in currency to address, the
+// same way the api priced it. Plans are not shipped.
+func (app *application) quoteShipping(widget models.Widget, currency string, address models.Address) (shipping.Quote, error) {
+	if widget.IsRecurring {
+		return shipping.Quote{Currency: currency}, nil
+	}
+	table, err := app.DB.GetShippingTable()
+	if err != nil {
+		return shipping.Quote{}, err
+	}
+	return table.Quote(shipping.Request{
+		Country:  address.Country,
+		Region:   address.Region,
+		Currency: currency,
+		Weight:   widget.Weight,
+	})
+}
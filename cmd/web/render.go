@@ -6,6 +6,8 @@ import (
 	"html/template"
 	"net/http"
 	"strings"
+
+	"go-commerce/internal/money"
 )
 
 type templateData struct {
@@ -13,6 +15,7 @@ type templateData struct {
 	IntMap          map[string]int
 	FloatMap        map[string]float32
 	Data            map[string]interface{}
+	Errors          map[string]string
 	CSRFToken       string
 	Flash           string
 	Warning         string
@@ -23,13 +26,18 @@ type templateData struct {
 	CSSVersion      string
 }
 
-func formatCurrency(value int) string {
-	formattedValue := float32(value) / float32(100)
-	return fmt.Sprintf("$%.2f", formattedValue)
+// formatCurrency formats an amount in minor units of currency, which defaults to usd
+func formatCurrency(value int, currency ...string) string {
+	code := "usd"
+	if len(currency) > 0 && currency[0] != "" {
+		code = currency[0]
+	}
+	return money.New(int64(value), code).String()
 }
 
 var functions = template.FuncMap{
 	"formatCurrency": formatCurrency,
+	"upper":          strings.ToUpper,
 }
 
 //go:embed templates
@@ -19,6 +19,11 @@ func (app *application) routes() http.Handler {
 		r.Get("/all-sales", app.AllSales)
 		r.Get("/all-subscriptions", app.AllSubscriptions)
 		r.Get("/sales/{id}", app.ShowSale)
+		r.Get("/fulfillment", app.Fulfillment)
+		r.Get("/disputes", app.Disputes)
+		r.Get("/disputes/{id}", app.ShowDispute)
+		r.Get("/payouts", app.Payouts)
+		r.Get("/payouts/{id}", app.ShowPayout)
 		r.Get("/subscriptions/{id}", app.ShowSubscription)
 		r.Get("/all-users", app.AllUsers)
 		r.Get("/all-users/{id}", app.OneUser)
@@ -31,6 +36,7 @@ func (app *application) routes() http.Handler {
 	mux.Get("/widget/{id}", app.ChargeOnce)
 	mux.Post("/payment-successful", app.PaymentSuccessful)
 	mux.Get("/receipt", app.Receipt)
+	mux.Get("/returns", app.Returns)
 
 	mux.Get("/plan/bronze", app.BronzePlan)
 	mux.Get("/receipt/bronze", app.BronzePlanReceipt)
@@ -42,6 +48,9 @@ func (app *application) routes() http.Handler {
 
 	mux.Get("/forgot-password", app.ForgotPassword)
 	mux.Get("/reset-password", app.ResetPassword)
+	mux.Get("/update-card", app.UpdateCard)
+	mux.Get("/portal", app.Portal)
+	mux.Get("/portal/subscription", app.PortalSubscription)
 
 	fileServer := http.FileServer(http.Dir("./static"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
@@ -5,22 +5,22 @@ go 1.17
 require (
 	github.com/alexedwards/scs/mysqlstore v0.0.0-20220528130143-d93ace5be94b
 	github.com/alexedwards/scs/v2 v2.5.0
+	github.com/bwmarrin/go-alone v0.0.0-20190806015146-742bb55d1631
 	github.com/go-chi/chi/v5 v5.0.7
 	github.com/go-chi/cors v1.2.1
 	github.com/go-sql-driver/mysql v1.6.0
+	github.com/gorilla/websocket v1.5.0
+	github.com/phpdave11/gofpdf v1.4.2
 	github.com/stripe/stripe-go/v72 v72.117.0
+	github.com/xhit/go-simple-mail/v2 v2.13.0
 	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
 )
 
 require (
-	github.com/bwmarrin/go-alone v0.0.0-20190806015146-742bb55d1631 // indirect
-	github.com/gorilla/websocket v1.5.0 // indirect
-	github.com/phpdave11/gofpdf v1.4.2 // indirect
 	github.com/phpdave11/gofpdi v1.0.12 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/stretchr/testify v1.8.0 // indirect
 	github.com/toorop/go-dkim v0.0.0-20201103131630-e1cd1a0a5208 // indirect
-	github.com/xhit/go-simple-mail/v2 v2.13.0 // indirect
 	golang.org/x/net v0.0.0-20211015210444-4f30a5c0130f // indirect
 	golang.org/x/sys v0.0.0-20210423082822-04245dca01da // indirect
 )
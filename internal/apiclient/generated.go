@@ -0,0 +1,2367 @@
+// Code generated by apiclient-gen from the OpenAPI document, version 1.0.0. DO NOT EDIT.
+
+package apiclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Address is the Address schema of the API
+type Address struct {
+	ID         int    `json:"id"`
+	CustomerID int    `json:"customer_id"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2"`
+	City       string `json:"city"`
+	Region     string `json:"region"`
+	Postcode   string `json:"postcode"`
+	Country    string `json:"country"`
+}
+
+// AuthTokenResponse is the AuthTokenResponse schema of the API
+type AuthTokenResponse struct {
+	HasError            bool   `json:"has_error"`
+	Message             string `json:"message"`
+	AuthenticationToken *Token `json:"authentication_token,omitempty"`
+}
+
+// BalanceTransaction is the BalanceTransaction schema of the API
+type BalanceTransaction struct {
+	ID                         int       `json:"id"`
+	StripeBalanceTransactionID string    `json:"stripe_balance_transaction_id"`
+	PayoutID                   int       `json:"payout_id"`
+	TransactionID              int       `json:"transaction_id"`
+	OrderID                    int       `json:"order_id"`
+	Recurring                  bool      `json:"recurring"`
+	Type                       string    `json:"type"`
+	SourceID                   string    `json:"source_id"`
+	ChargeID                   string    `json:"charge_id"`
+	Amount                     int       `json:"amount"`
+	Fee                        int       `json:"fee"`
+	Net                        int       `json:"net"`
+	Currency                   string    `json:"currency"`
+	Description                string    `json:"description"`
+	AvailableOn                time.Time `json:"available_on"`
+	OccurredAt                 time.Time `json:"occurred_at"`
+}
+
+// CaptureRequest is the CaptureRequest schema of the API
+type CaptureRequest struct {
+	Amount int `json:"amount"`
+}
+
+// CardUpdateRequest is the CardUpdateRequest schema of the API
+type CardUpdateRequest struct {
+	Token       string `json:"token"`
+	SetupIntent string `json:"setup_intent,omitempty"`
+}
+
+// ChargeRequest is the ChargeRequest schema of the API
+type ChargeRequest struct {
+	Currency        string   `json:"currency"`
+	Amount          int      `json:"amount"`
+	PaymentMethod   string   `json:"payment_method"`
+	Email           string   `json:"email"`
+	LastFour        string   `json:"last_four"`
+	Plan            string   `json:"plan"`
+	CardBrand       string   `json:"card_brand"`
+	ExpMonth        int      `json:"exp_month"`
+	ExpYear         int      `json:"exp_year"`
+	ProductID       int      `json:"product_id"`
+	FirstName       string   `json:"first_name"`
+	LastName        string   `json:"last_name"`
+	Country         string   `json:"country"`
+	Region          string   `json:"region"`
+	TaxID           string   `json:"tax_id"`
+	Coupon          string   `json:"coupon"`
+	Seats           int      `json:"seats,omitempty"`
+	BillingAddress  *Address `json:"billing_address,omitempty"`
+	ShippingAddress *Address `json:"shipping_address,omitempty"`
+}
+
+// Coupon is the Coupon schema of the API
+type Coupon struct {
+	ID               int        `json:"id"`
+	Code             string     `json:"code"`
+	PercentOff       int        `json:"percent_off"`
+	AmountOff        int        `json:"amount_off"`
+	Currency         string     `json:"currency"`
+	WidgetID         int        `json:"widget_id"`
+	MaxRedemptions   int        `json:"max_redemptions"`
+	Redemptions      int        `json:"redemptions"`
+	Reserved         int        `json:"reserved"`
+	OncePerCustomer  bool       `json:"once_per_customer"`
+	Duration         string     `json:"duration"`
+	DurationInMonths int        `json:"duration_in_months"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+}
+
+// CouponCheck is the CouponCheck schema of the API
+type CouponCheck struct {
+	Code             string `json:"code"`
+	Currency         string `json:"currency"`
+	Price            int    `json:"price"`
+	Discount         int    `json:"discount"`
+	Duration         string `json:"duration"`
+	DurationInMonths int    `json:"duration_in_months"`
+}
+
+// CouponCheckRequest is the CouponCheckRequest schema of the API
+type CouponCheckRequest struct {
+	Code      string `json:"code"`
+	ProductID int    `json:"product_id"`
+	Currency  string `json:"currency"`
+	Email     string `json:"email"`
+}
+
+// CouponList is the CouponList schema of the API
+type CouponList struct {
+	Coupons []Coupon `json:"coupons"`
+}
+
+// Credentials is the Credentials schema of the API
+type Credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// Currency is the Currency schema of the API
+type Currency struct {
+	Code     string `json:"code"`
+	Exponent int    `json:"exponent"`
+	Symbol   string `json:"symbol"`
+}
+
+// CurrencyList is the CurrencyList schema of the API
+type CurrencyList struct {
+	Base       string     `json:"base"`
+	Currencies []Currency `json:"currencies"`
+}
+
+// Customer is the Customer schema of the API
+type Customer struct {
+	ID               int             `json:"id"`
+	FirstName        string          `json:"first_name"`
+	LastName         string          `json:"last_name"`
+	Email            string          `json:"email"`
+	StripeCustomerID string          `json:"stripe_customer_id"`
+	PaymentMethods   []PaymentMethod `json:"payment_methods,omitempty"`
+}
+
+// CustomerList is the CustomerList schema of the API
+type CustomerList struct {
+	Customers []Customer `json:"customers"`
+}
+
+// Dispute is the Dispute schema of the API
+type Dispute struct {
+	ID                 int           `json:"id"`
+	StripeDisputeID    string        `json:"stripe_dispute_id"`
+	PaymentIntent      string        `json:"payment_intent"`
+	TransactionID      int           `json:"transaction_id"`
+	OrderID            int           `json:"order_id"`
+	Amount             int           `json:"amount"`
+	Currency           string        `json:"currency"`
+	Reason             string        `json:"reason"`
+	Status             string        `json:"status"`
+	EvidenceDueBy      *time.Time    `json:"evidence_due_by,omitempty"`
+	ProductDescription string        `json:"product_description"`
+	UncategorizedText  string        `json:"uncategorized_text"`
+	SubmittedAt        *time.Time    `json:"submitted_at,omitempty"`
+	OpenedAt           time.Time     `json:"opened_at"`
+	Files              []DisputeFile `json:"files"`
+}
+
+// DisputeEvidenceRequest is the DisputeEvidenceRequest schema of the API
+type DisputeEvidenceRequest struct {
+	ProductDescription string `json:"product_description"`
+	UncategorizedText  string `json:"uncategorized_text"`
+}
+
+// DisputeFile is the DisputeFile schema of the API
+type DisputeFile struct {
+	ID           int       `json:"id"`
+	DisputeID    int       `json:"dispute_id"`
+	Purpose      string    `json:"purpose"`
+	Filename     string    `json:"filename"`
+	Size         int       `json:"size"`
+	StripeFileID string    `json:"stripe_file_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// DisputeFileUpload is the DisputeFileUpload schema of the API
+type DisputeFileUpload struct {
+	Purpose  string `json:"purpose"`
+	Filename string `json:"filename"`
+	Content  []byte `json:"content"`
+}
+
+// DisputeList is the DisputeList schema of the API
+type DisputeList struct {
+	Disputes []Dispute `json:"disputes"`
+}
+
+// DisputeReport is the DisputeReport schema of the API
+type DisputeReport struct {
+	From           string  `json:"from"`
+	To             string  `json:"to"`
+	Currency       string  `json:"currency"`
+	Converted      bool    `json:"converted"`
+	Orders         int     `json:"orders"`
+	Disputes       int     `json:"disputes"`
+	DisputeRate    float64 `json:"dispute_rate"`
+	Open           int     `json:"open"`
+	Closed         int     `json:"closed"`
+	Won            int     `json:"won"`
+	Lost           int     `json:"lost"`
+	DisputedAmount int     `json:"disputed_amount"`
+	LostAmount     int     `json:"lost_amount"`
+}
+
+// DunningCase is the DunningCase schema of the API
+type DunningCase struct {
+	ID              int        `json:"id"`
+	OrderID         int        `json:"order_id"`
+	StripeInvoiceID string     `json:"stripe_invoice_id"`
+	AmountDue       int        `json:"amount_due"`
+	Attempt         int        `json:"attempt"`
+	NextAttemptAt   *time.Time `json:"next_attempt_at,omitempty"`
+	Status          string     `json:"status"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// ErrorDetail is the ErrorDetail schema of the API
+type ErrorDetail struct {
+	Code      string            `json:"code"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
+// ErrorResponse is the ErrorResponse schema of the API
+type ErrorResponse struct {
+	HasError bool         `json:"has_error"`
+	Message  string       `json:"message"`
+	Error    *ErrorDetail `json:"error,omitempty"`
+}
+
+// FXRate is the FXRate schema of the API
+type FXRate struct {
+	ID           int    `json:"id"`
+	BaseCurrency string `json:"base_currency"`
+	Currency     string `json:"currency"`
+	Rate         string `json:"rate"`
+	EffectiveOn  string `json:"effective_on"`
+}
+
+// FXRateList is the FXRateList schema of the API
+type FXRateList struct {
+	Base  string   `json:"base"`
+	Rates []FXRate `json:"rates"`
+}
+
+// FulfillmentEvent is the FulfillmentEvent schema of the API
+type FulfillmentEvent struct {
+	ID             int       `json:"id"`
+	OrderID        int       `json:"order_id"`
+	FromStatusID   int       `json:"from_status_id"`
+	FromStatus     string    `json:"from_status"`
+	ToStatusID     int       `json:"to_status_id"`
+	ToStatus       string    `json:"to_status"`
+	Carrier        string    `json:"carrier"`
+	TrackingNumber string    `json:"tracking_number"`
+	Note           string    `json:"note"`
+	UserID         int       `json:"user_id"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// FulfillmentEventList is the FulfillmentEventList schema of the API
+type FulfillmentEventList struct {
+	Events []FulfillmentEvent `json:"events"`
+}
+
+// FulfillmentRequest is the FulfillmentRequest schema of the API
+type FulfillmentRequest struct {
+	Status         string `json:"status"`
+	Carrier        string `json:"carrier"`
+	TrackingNumber string `json:"tracking_number"`
+	Note           string `json:"note"`
+}
+
+// LedgerCheck is the LedgerCheck schema of the API
+type LedgerCheck struct {
+	Entries  int             `json:"entries"`
+	Problems []LedgerProblem `json:"problems"`
+}
+
+// LedgerProblem is the LedgerProblem schema of the API
+type LedgerProblem struct {
+	Check     string `json:"check"`
+	Reference string `json:"reference"`
+	Detail    string `json:"detail"`
+}
+
+// LegacyCancellation is the LegacyCancellation schema of the API
+type LegacyCancellation struct {
+	ID            int    `json:"id"`
+	PaymentIntent string `json:"payment_intent"`
+	Currency      string `json:"currency"`
+}
+
+// LegacyRefund is the LegacyRefund schema of the API
+type LegacyRefund struct {
+	ID            int    `json:"id"`
+	PaymentIntent string `json:"payment_intent"`
+	Amount        int    `json:"amount"`
+	Currency      string `json:"currency"`
+}
+
+// NewCustomer is the NewCustomer schema of the API
+type NewCustomer struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+}
+
+// OffSessionCharge is the OffSessionCharge schema of the API
+type OffSessionCharge struct {
+	PaymentMethodID int                `json:"payment_method_id"`
+	Amount          int                `json:"amount"`
+	Currency        string             `json:"currency"`
+	Items           []OrderItemRequest `json:"items,omitempty"`
+	Note            string             `json:"note"`
+}
+
+// Order is the Order schema of the API
+type Order struct {
+	ID                  int         `json:"id"`
+	WidgetID            int         `json:"widget_id"`
+	TransactionID       int         `json:"transaction_id"`
+	CustomerID          int         `json:"customer_id"`
+	StatusID            int         `json:"status_id"`
+	Quantity            int         `json:"quantity"`
+	Amount              int         `json:"amount"`
+	TaxJurisdiction     string      `json:"tax_jurisdiction"`
+	TaxID               string      `json:"tax_id"`
+	TaxLines            []TaxLine   `json:"tax_lines,omitempty"`
+	CouponID            int         `json:"coupon_id"`
+	CouponCode          string      `json:"coupon_code"`
+	Discount            int         `json:"discount"`
+	Shipping            int         `json:"shipping"`
+	ShippingMethod      string      `json:"shipping_method"`
+	BillingAddress      *Address    `json:"billing_address,omitempty"`
+	ShippingAddress     *Address    `json:"shipping_address,omitempty"`
+	FulfillmentStatusID int         `json:"fulfillment_status_id"`
+	FulfillmentStatus   string      `json:"fulfillment_status"`
+	Carrier             string      `json:"carrier"`
+	TrackingNumber      string      `json:"tracking_number"`
+	Note                string      `json:"note"`
+	Items               []OrderItem `json:"items,omitempty"`
+	TrialEndsAt         *time.Time  `json:"trial_ends_at,omitempty"`
+	Widget              Widget      `json:"widget"`
+	Transaction         Transaction `json:"transaction"`
+	Customer            Customer    `json:"customer"`
+}
+
+// OrderItem is the OrderItem schema of the API
+type OrderItem struct {
+	ID          int    `json:"id"`
+	WidgetID    int    `json:"widget_id"`
+	Description string `json:"description"`
+	Quantity    int    `json:"quantity"`
+	UnitAmount  int    `json:"unit_amount"`
+	Amount      int    `json:"amount"`
+}
+
+// OrderItemRequest is the OrderItemRequest schema of the API
+type OrderItemRequest struct {
+	WidgetID    int    `json:"widget_id"`
+	Description string `json:"description"`
+	Quantity    int    `json:"quantity"`
+	UnitAmount  int    `json:"unit_amount"`
+}
+
+// PageRequest is the PageRequest schema of the API
+type PageRequest struct {
+	Page     int `json:"page"`
+	PageSize int `json:"page_size"`
+}
+
+// PaginatedSales is the PaginatedSales schema of the API
+type PaginatedSales struct {
+	TotalSales int     `json:"total_sales"`
+	LastPage   int     `json:"last_page"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	Sales      []Order `json:"sales"`
+}
+
+// PaginatedSubscriptions is the PaginatedSubscriptions schema of the API
+type PaginatedSubscriptions struct {
+	Total         int     `json:"total,omitempty"`
+	LastPage      int     `json:"last_page,omitempty"`
+	NextCursor    string  `json:"next_cursor,omitempty"`
+	Subscriptions []Order `json:"subscriptions"`
+}
+
+// PaginatedUsers is the PaginatedUsers schema of the API
+type PaginatedUsers struct {
+	Total      int    `json:"total,omitempty"`
+	LastPage   int    `json:"last_page,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Users      []User `json:"users"`
+}
+
+// PasswordReset is the PasswordReset schema of the API
+type PasswordReset struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// PasswordResetRequest is the PasswordResetRequest schema of the API
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+// PaymentIntent is the PaymentIntent schema of the API
+type PaymentIntent struct {
+	ID            string         `json:"id"`
+	ClientSecret  string         `json:"client_secret"`
+	Amount        int            `json:"amount"`
+	Currency      string         `json:"currency"`
+	Status        string         `json:"status"`
+	CaptureMethod string         `json:"capture_method"`
+	Discount      int            `json:"discount,omitempty"`
+	Tax           *TaxQuote      `json:"tax,omitempty"`
+	Shipping      *ShippingQuote `json:"shipping,omitempty"`
+}
+
+// PaymentMethod is the PaymentMethod schema of the API
+type PaymentMethod struct {
+	ID                    int       `json:"id"`
+	CustomerID            int       `json:"customer_id"`
+	StripePaymentMethodID string    `json:"stripe_payment_method_id"`
+	Brand                 string    `json:"brand"`
+	LastFour              string    `json:"last_four"`
+	ExpiryMonth           int       `json:"expiry_month"`
+	ExpiryYear            int       `json:"expiry_year"`
+	CreatedAt             time.Time `json:"created_at"`
+}
+
+// PaymentMethodRequest is the PaymentMethodRequest schema of the API
+type PaymentMethodRequest struct {
+	SetupIntent string `json:"setup_intent"`
+}
+
+// Payout is the Payout schema of the API
+type Payout struct {
+	ID                  int                  `json:"id"`
+	StripePayoutID      string               `json:"stripe_payout_id"`
+	Amount              int                  `json:"amount"`
+	Currency            string               `json:"currency"`
+	Status              string               `json:"status"`
+	Automatic           bool                 `json:"automatic"`
+	ArrivalDate         time.Time            `json:"arrival_date"`
+	InitiatedAt         time.Time            `json:"initiated_at"`
+	Transactions        int                  `json:"transactions"`
+	Gross               int                  `json:"gross"`
+	Refunds             int                  `json:"refunds"`
+	Fees                int                  `json:"fees"`
+	Other               int                  `json:"other"`
+	Net                 int                  `json:"net"`
+	BalanceTransactions []BalanceTransaction `json:"balance_transactions,omitempty"`
+}
+
+// PayoutImport is the PayoutImport schema of the API
+type PayoutImport struct {
+	Payouts             int `json:"payouts"`
+	BalanceTransactions int `json:"balance_transactions"`
+}
+
+// PayoutImportRequest is the PayoutImportRequest schema of the API
+type PayoutImportRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// PayoutList is the PayoutList schema of the API
+type PayoutList struct {
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Payouts []Payout `json:"payouts"`
+}
+
+// PortalLinkRequest is the PortalLinkRequest schema of the API
+type PortalLinkRequest struct {
+	Email string `json:"email"`
+}
+
+// PortalRequest is the PortalRequest schema of the API
+type PortalRequest struct {
+	Token string `json:"token"`
+}
+
+// ReportSummary is the ReportSummary schema of the API
+type ReportSummary struct {
+	From                string  `json:"from"`
+	To                  string  `json:"to"`
+	Currency            string  `json:"currency"`
+	Converted           bool    `json:"converted"`
+	Orders              int     `json:"orders"`
+	Gross               int     `json:"gross"`
+	Refunds             int     `json:"refunds"`
+	Tax                 int     `json:"tax"`
+	Net                 int     `json:"net"`
+	AverageOrderValue   int     `json:"average_order_value"`
+	ActiveSubscriptions int     `json:"active_subscriptions"`
+	MRR                 int     `json:"mrr"`
+	ARR                 int     `json:"arr"`
+	NewSubscriptions    int     `json:"new_subscriptions"`
+	Cancellations       int     `json:"cancellations"`
+	ChurnRate           float64 `json:"churn_rate"`
+}
+
+// Response is the Response schema of the API
+type Response struct {
+	HasError bool   `json:"has_error"`
+	Message  string `json:"message,omitempty"`
+}
+
+// Return is the Return schema of the API
+type Return struct {
+	ID        int           `json:"id"`
+	OrderID   int           `json:"order_id"`
+	Status    string        `json:"status"`
+	Reason    string        `json:"reason"`
+	Amount    int           `json:"amount"`
+	UserID    int           `json:"user_id"`
+	Items     []ReturnItem  `json:"items"`
+	Events    []ReturnEvent `json:"events"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// ReturnEvent is the ReturnEvent schema of the API
+type ReturnEvent struct {
+	ID         int       `json:"id"`
+	ReturnID   int       `json:"return_id"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Note       string    `json:"note"`
+	UserID     int       `json:"user_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ReturnItem is the ReturnItem schema of the API
+type ReturnItem struct {
+	ID         int    `json:"id"`
+	ReturnID   int    `json:"return_id"`
+	WidgetID   int    `json:"widget_id"`
+	WidgetName string `json:"widget_name"`
+	Quantity   int    `json:"quantity"`
+	Amount     int    `json:"amount"`
+}
+
+// ReturnItemRequest is the ReturnItemRequest schema of the API
+type ReturnItemRequest struct {
+	WidgetID int `json:"widget_id"`
+	Quantity int `json:"quantity"`
+}
+
+// ReturnList is the ReturnList schema of the API
+type ReturnList struct {
+	Returns []Return `json:"returns"`
+}
+
+// ReturnRequest is the ReturnRequest schema of the API
+type ReturnRequest struct {
+	OrderID int                 `json:"order_id"`
+	Email   string              `json:"email"`
+	Reason  string              `json:"reason"`
+	Items   []ReturnItemRequest `json:"items"`
+}
+
+// ReturnStatusChange is the ReturnStatusChange schema of the API
+type ReturnStatusChange struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+}
+
+// RevenueDay is the RevenueDay schema of the API
+type RevenueDay struct {
+	Day         string `json:"day"`
+	Orders      int    `json:"orders"`
+	Gross       int    `json:"gross"`
+	RefundCount int    `json:"refund_count"`
+	Refunds     int    `json:"refunds"`
+	Tax         int    `json:"tax"`
+	Net         int    `json:"net"`
+}
+
+// RevenueReport is the RevenueReport schema of the API
+type RevenueReport struct {
+	From      string       `json:"from"`
+	To        string       `json:"to"`
+	Currency  string       `json:"currency"`
+	Converted bool         `json:"converted"`
+	Days      []RevenueDay `json:"days"`
+}
+
+// RollupRebuild is the RollupRebuild schema of the API
+type RollupRebuild struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// SetupIntent is the SetupIntent schema of the API
+type SetupIntent struct {
+	ID           string `json:"id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// ShipmentError is the ShipmentError schema of the API
+type ShipmentError struct {
+	Line    int    `json:"line"`
+	OrderID int    `json:"order_id"`
+	Message string `json:"message"`
+}
+
+// ShipmentImport is the ShipmentImport schema of the API
+type ShipmentImport struct {
+	Shipped int             `json:"shipped"`
+	Errors  []ShipmentError `json:"errors"`
+}
+
+// ShippingQuote is the ShippingQuote schema of the API
+type ShippingQuote struct {
+	Zone     string `json:"zone"`
+	Method   string `json:"method"`
+	Currency string `json:"currency"`
+	Weight   int    `json:"weight"`
+	Amount   int    `json:"amount"`
+}
+
+// ShippingQuoteRequest is the ShippingQuoteRequest schema of the API
+type ShippingQuoteRequest struct {
+	ProductID int    `json:"product_id"`
+	Currency  string `json:"currency"`
+	Country   string `json:"country"`
+	Region    string `json:"region"`
+}
+
+// ShippingRate is the ShippingRate schema of the API
+type ShippingRate struct {
+	ID        int    `json:"id"`
+	Zone      string `json:"zone"`
+	Method    string `json:"method"`
+	Currency  string `json:"currency"`
+	MinWeight int    `json:"min_weight"`
+	MaxWeight int    `json:"max_weight"`
+	Flat      int    `json:"flat"`
+	PerKg     int    `json:"per_kg"`
+}
+
+// ShippingRateList is the ShippingRateList schema of the API
+type ShippingRateList struct {
+	Rates []ShippingRate `json:"rates"`
+}
+
+// ShippingZone is the ShippingZone schema of the API
+type ShippingZone struct {
+	ID           int    `json:"id"`
+	Zone         string `json:"zone"`
+	Jurisdiction string `json:"jurisdiction"`
+}
+
+// ShippingZoneList is the ShippingZoneList schema of the API
+type ShippingZoneList struct {
+	Zones []ShippingZone `json:"zones"`
+}
+
+// SubscriptionDay is the SubscriptionDay schema of the API
+type SubscriptionDay struct {
+	Day       string `json:"day"`
+	Active    int    `json:"active"`
+	MRR       int    `json:"mrr"`
+	Started   int    `json:"started"`
+	Cancelled int    `json:"cancelled"`
+}
+
+// SubscriptionEvent is the SubscriptionEvent schema of the API
+type SubscriptionEvent struct {
+	ID        int       `json:"id"`
+	OrderID   int       `json:"order_id"`
+	Kind      string    `json:"kind"`
+	Attempt   int       `json:"attempt"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SubscriptionEventList is the SubscriptionEventList schema of the API
+type SubscriptionEventList struct {
+	Events  []SubscriptionEvent `json:"events"`
+	Dunning *DunningCase        `json:"dunning,omitempty"`
+}
+
+// SubscriptionReport is the SubscriptionReport schema of the API
+type SubscriptionReport struct {
+	From      string            `json:"from"`
+	To        string            `json:"to"`
+	Currency  string            `json:"currency"`
+	Converted bool              `json:"converted"`
+	Days      []SubscriptionDay `json:"days"`
+}
+
+// SubscriptionResult is the SubscriptionResult schema of the API
+type SubscriptionResult struct {
+	HasError       bool       `json:"has_error"`
+	Message        string     `json:"message,omitempty"`
+	SubscriptionID string     `json:"subscription_id"`
+	Status         string     `json:"status"`
+	RequiresAction bool       `json:"requires_action"`
+	ClientSecret   string     `json:"client_secret,omitempty"`
+	TrialEndsAt    *time.Time `json:"trial_ends_at,omitempty"`
+}
+
+// TaxExemption is the TaxExemption schema of the API
+type TaxExemption struct {
+	ID           int    `json:"id"`
+	TaxID        string `json:"tax_id"`
+	Jurisdiction string `json:"jurisdiction"`
+	Reason       string `json:"reason"`
+}
+
+// TaxExemptionList is the TaxExemptionList schema of the API
+type TaxExemptionList struct {
+	Exemptions []TaxExemption `json:"exemptions"`
+}
+
+// TaxLine is the TaxLine schema of the API
+type TaxLine struct {
+	Jurisdiction string `json:"jurisdiction"`
+	Name         string `json:"name"`
+	Rate         string `json:"rate"`
+	Inclusive    bool   `json:"inclusive"`
+	Taxable      int    `json:"taxable"`
+	Amount       int    `json:"amount"`
+}
+
+// TaxQuote is the TaxQuote schema of the API
+type TaxQuote struct {
+	Jurisdiction string    `json:"jurisdiction"`
+	Currency     string    `json:"currency"`
+	Subtotal     int       `json:"subtotal"`
+	Tax          int       `json:"tax"`
+	Total        int       `json:"total"`
+	Exempt       string    `json:"exempt,omitempty"`
+	Lines        []TaxLine `json:"lines"`
+}
+
+// TaxQuoteRequest is the TaxQuoteRequest schema of the API
+type TaxQuoteRequest struct {
+	ProductID int    `json:"product_id"`
+	Currency  string `json:"currency"`
+	Country   string `json:"country"`
+	Region    string `json:"region"`
+	TaxID     string `json:"tax_id"`
+	Coupon    string `json:"coupon"`
+	Email     string `json:"email"`
+}
+
+// TaxRule is the TaxRule schema of the API
+type TaxRule struct {
+	ID           int    `json:"id"`
+	Jurisdiction string `json:"jurisdiction"`
+	Name         string `json:"name"`
+	Rate         string `json:"rate"`
+	Inclusive    bool   `json:"inclusive"`
+}
+
+// TaxRuleList is the TaxRuleList schema of the API
+type TaxRuleList struct {
+	Rules []TaxRule `json:"rules"`
+}
+
+// TerminalPayment is the TerminalPayment schema of the API
+type TerminalPayment struct {
+	FirstName      string             `json:"first_name"`
+	LastName       string             `json:"last_name"`
+	Email          string             `json:"email"`
+	CustomerID     int                `json:"customer_id"`
+	PaymentIntent  string             `json:"payment_intent"`
+	PaymentMethod  string             `json:"payment_method"`
+	Amount         int                `json:"amount"`
+	Currency       string             `json:"currency"`
+	Items          []OrderItemRequest `json:"items,omitempty"`
+	Note           string             `json:"note"`
+	OrderID        int                `json:"order_id"`
+	Status         string             `json:"status"`
+	LastFour       string             `json:"last_four"`
+	ExpiryMonth    int                `json:"expiry_month"`
+	ExpiryYear     int                `json:"expiry_year"`
+	BankReturnCode string             `json:"bank_return_code"`
+}
+
+// Token is the Token schema of the API
+type Token struct {
+	Token  string    `json:"token"`
+	Expiry time.Time `json:"expiry"`
+}
+
+// TopWidgetsReport is the TopWidgetsReport schema of the API
+type TopWidgetsReport struct {
+	From      string        `json:"from"`
+	To        string        `json:"to"`
+	Currency  string        `json:"currency"`
+	Converted bool          `json:"converted"`
+	Widgets   []WidgetSales `json:"widgets"`
+}
+
+// Transaction is the Transaction schema of the API
+type Transaction struct {
+	ID                  int        `json:"id"`
+	Amount              int        `json:"amount"`
+	Currency            string     `json:"currency"`
+	LastFour            string     `json:"last_four"`
+	BankReturnCode      string     `json:"bank_return_code"`
+	ExpiryMonth         int        `json:"expiry_month"`
+	ExpiryYear          int        `json:"expiry_year"`
+	PaymentIntent       string     `json:"payment_intent"`
+	PaymentMethod       string     `json:"payment_method"`
+	TransactionStatusID int        `json:"transaction_status_id"`
+	CaptureBefore       *time.Time `json:"capture_before,omitempty"`
+	Fee                 int        `json:"fee"`
+	PayoutID            int        `json:"payout_id,omitempty"`
+}
+
+// TrialBalance is the TrialBalance schema of the API
+type TrialBalance struct {
+	AsOf     string             `json:"as_of"`
+	Currency string             `json:"currency"`
+	Accounts []TrialBalanceLine `json:"accounts"`
+	Debits   int                `json:"debits"`
+	Credits  int                `json:"credits"`
+	Balanced bool               `json:"balanced"`
+}
+
+// TrialBalanceLine is the TrialBalanceLine schema of the API
+type TrialBalanceLine struct {
+	Account string `json:"account"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Debits  int    `json:"debits"`
+	Credits int    `json:"credits"`
+	Balance int    `json:"balance"`
+}
+
+// UsageRecord is the UsageRecord schema of the API
+type UsageRecord struct {
+	ID             int        `json:"id"`
+	SubscriptionID int        `json:"subscription_id"`
+	Quantity       int        `json:"quantity"`
+	RecordedAt     time.Time  `json:"recorded_at"`
+	IdempotencyKey string     `json:"idempotency_key,omitempty"`
+	ReportedAt     *time.Time `json:"reported_at,omitempty"`
+}
+
+// UsageRequest is the UsageRequest schema of the API
+type UsageRequest struct {
+	SubscriptionID int        `json:"subscription_id"`
+	Quantity       int        `json:"quantity"`
+	Timestamp      *time.Time `json:"timestamp,omitempty"`
+	IdempotencyKey string     `json:"idempotency_key,omitempty"`
+}
+
+// UsageSummary is the UsageSummary schema of the API
+type UsageSummary struct {
+	SubscriptionID int        `json:"subscription_id"`
+	Plan           string     `json:"plan"`
+	StatusID       int        `json:"status_id"`
+	Seats          int        `json:"seats"`
+	Metered        bool       `json:"metered"`
+	TrialEndsAt    *time.Time `json:"trial_ends_at,omitempty"`
+	PeriodStart    time.Time  `json:"period_start"`
+	PeriodEnd      time.Time  `json:"period_end"`
+	Usage          int        `json:"usage"`
+	Unreported     int        `json:"unreported"`
+}
+
+// User is the User schema of the API
+type User struct {
+	ID        int    `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Password  string `json:"password"`
+	Email     string `json:"email"`
+}
+
+// UserPatch is the UserPatch schema of the API
+type UserPatch struct {
+	FirstName *string `json:"first_name,omitempty"`
+	LastName  *string `json:"last_name,omitempty"`
+	Email     *string `json:"email,omitempty"`
+	Password  *string `json:"password,omitempty"`
+}
+
+// Widget is the Widget schema of the API
+type Widget struct {
+	ID                int            `json:"id"`
+	Name              string         `json:"name"`
+	Description       string         `json:"description"`
+	InventoryLevel    int            `json:"inventory_level"`
+	Price             int            `json:"price"`
+	Image             string         `json:"image"`
+	IsRecurring       bool           `json:"is_recurring"`
+	PlanID            string         `json:"plan_id"`
+	Weight            int            `json:"weight"`
+	CaptureMethod     string         `json:"capture_method"`
+	TrialDays         int            `json:"trial_days"`
+	TrialRequiresCard bool           `json:"trial_requires_card"`
+	Metered           bool           `json:"metered"`
+	Prices            map[string]int `json:"prices"`
+}
+
+// WidgetBilling is the WidgetBilling schema of the API
+type WidgetBilling struct {
+	TrialDays         int  `json:"trial_days"`
+	TrialRequiresCard bool `json:"trial_requires_card"`
+	Metered           bool `json:"metered"`
+}
+
+// WidgetCaptureMethod is the WidgetCaptureMethod schema of the API
+type WidgetCaptureMethod struct {
+	CaptureMethod string `json:"capture_method"`
+}
+
+// WidgetPrice is the WidgetPrice schema of the API
+type WidgetPrice struct {
+	Amount int `json:"amount"`
+}
+
+// WidgetSales is the WidgetSales schema of the API
+type WidgetSales struct {
+	WidgetID int    `json:"widget_id"`
+	Name     string `json:"name"`
+	Orders   int    `json:"orders"`
+	Quantity int    `json:"quantity"`
+	Gross    int    `json:"gross"`
+}
+
+// WidgetWeight is the WidgetWeight schema of the API
+type WidgetWeight struct {
+	Weight int `json:"weight"`
+}
+
+// CreateCapture calls POST /api/v1/sales/{id}/captures. Capture all or part of the card authorization of a sale made to order. The rest of the authorization is released.
+func (c *Client) CreateCapture(ctx context.Context, id int, body *CaptureRequest) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/v1/sales/%d/captures", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateCoupon calls POST /api/v1/coupons. Add a coupon.
+func (c *Client) CreateCoupon(ctx context.Context, body *Coupon) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPost, "/api/v1/coupons", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateCouponCheck calls POST /api/v1/coupon-checks. Check a coupon code and get the discount it gives on a product.
+func (c *Client) CreateCouponCheck(ctx context.Context, body *CouponCheckRequest) (*CouponCheck, error) {
+	var out CouponCheck
+	if err := c.do(ctx, http.MethodPost, "/api/v1/coupon-checks", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateCustomer calls POST /api/v1/customers. Create a customer.
+func (c *Client) CreateCustomer(ctx context.Context, body *NewCustomer) (*Customer, error) {
+	var out Customer
+	if err := c.do(ctx, http.MethodPost, "/api/v1/customers", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateCustomerCharge calls POST /api/v1/customers/{id}/charges. Charge a saved card of a customer off-session and record the order. Cards that need the customer to authenticate are declined.
+func (c *Client) CreateCustomerCharge(ctx context.Context, id int, body *OffSessionCharge) (*TerminalPayment, error) {
+	var out TerminalPayment
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/v1/customers/%d/charges", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateDisputeFile calls POST /api/v1/disputes/{id}/files. Upload a file of at most 4MB to Stripe as evidence for a dispute, replacing the file with the same purpose.
+func (c *Client) CreateDisputeFile(ctx context.Context, id int, body *DisputeFileUpload) (*DisputeFile, error) {
+	var out DisputeFile
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/v1/disputes/%d/files", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateDisputeSubmission calls POST /api/v1/disputes/{id}/submissions. Submit the evidence of a dispute to the card issuer, with the customer and shipment of the sale. Evidence can only be submitted once.
+func (c *Client) CreateDisputeSubmission(ctx context.Context, id int) (*Dispute, error) {
+	var out Dispute
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/v1/disputes/%d/submissions", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateFXRate calls POST /api/v1/fx-rates. Add an exchange rate, effective from a day until the next rate of the currency.
+func (c *Client) CreateFXRate(ctx context.Context, body *FXRate) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPost, "/api/v1/fx-rates", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateFulfillmentEvent calls POST /api/v1/sales/{id}/fulfillment-events. Move a sale to the next fulfillment status and email the customer.
+func (c *Client) CreateFulfillmentEvent(ctx context.Context, id int, body *FulfillmentRequest) (*FulfillmentEvent, error) {
+	var out FulfillmentEvent
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/v1/sales/%d/fulfillment-events", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreatePasswordReset calls POST /api/v1/password-resets. Set a new password from a password reset link.
+func (c *Client) CreatePasswordReset(ctx context.Context, body *PasswordReset) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPost, "/api/v1/password-resets", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreatePasswordResetRequest calls POST /api/v1/password-reset-requests. Email a signed password reset link.
+func (c *Client) CreatePasswordResetRequest(ctx context.Context, body *PasswordResetRequest) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPost, "/api/v1/password-reset-requests", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreatePaymentIntent calls POST /api/v1/payment-intents. Create a payment intent for a one-off card payment.
+func (c *Client) CreatePaymentIntent(ctx context.Context, body *ChargeRequest) (*PaymentIntent, error) {
+	var out PaymentIntent
+	if err := c.do(ctx, http.MethodPost, "/api/v1/payment-intents", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreatePaymentMethod calls POST /api/v1/customers/{id}/payment-methods. Save the card of a confirmed setup intent of a customer.
+func (c *Client) CreatePaymentMethod(ctx context.Context, id int, body *PaymentMethodRequest) (*PaymentMethod, error) {
+	var out PaymentMethod
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/v1/customers/%d/payment-methods", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreatePayoutImport calls POST /api/v1/payout-imports. Import the payouts created in a period of at most 92 days, and the balance transactions they paid out, from Stripe.
+func (c *Client) CreatePayoutImport(ctx context.Context, body *PayoutImportRequest) (*PayoutImport, error) {
+	var out PayoutImport
+	if err := c.do(ctx, http.MethodPost, "/api/v1/payout-imports", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreatePortalLink calls POST /api/v1/portal-links. Email a customer signed links to the portal pages of their subscriptions.
+func (c *Client) CreatePortalLink(ctx context.Context, body *PortalLinkRequest) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPost, "/api/v1/portal-links", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateRefund calls POST /api/v1/sales/{id}/refunds. Refund a sale in full.
+func (c *Client) CreateRefund(ctx context.Context, id int) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/v1/sales/%d/refunds", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateReturn calls POST /api/v1/returns. Open a return of items of a sale as the customer who bought them.
+func (c *Client) CreateReturn(ctx context.Context, body *ReturnRequest) (*Return, error) {
+	var out Return
+	if err := c.do(ctx, http.MethodPost, "/api/v1/returns", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateReturnEvent calls POST /api/v1/returns/{id}/events. Move a return to another status. Received returns go back into inventory and refunded ones refund the card.
+func (c *Client) CreateReturnEvent(ctx context.Context, id int, body *ReturnStatusChange) (*Return, error) {
+	var out Return
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/v1/returns/%d/events", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateSaleReturn calls POST /api/v1/sales/{id}/returns. Open a return of items of a sale.
+func (c *Client) CreateSaleReturn(ctx context.Context, id int, body *ReturnRequest) (*Return, error) {
+	var out Return
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/v1/sales/%d/returns", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateSetupIntent calls POST /api/v1/customers/{id}/setup-intents. Start collecting a card of a customer to charge off-session later.
+func (c *Client) CreateSetupIntent(ctx context.Context, id int) (*SetupIntent, error) {
+	var out SetupIntent
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/v1/customers/%d/setup-intents", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateShipments calls POST /api/v1/shipments. Ship sales in bulk from a CSV file with the columns order_id, carrier and tracking_number.
+func (c *Client) CreateShipments(ctx context.Context, body io.Reader) (*ShipmentImport, error) {
+	var out ShipmentImport
+	if err := c.do(ctx, http.MethodPost, "/api/v1/shipments", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateShippingQuote calls POST /api/v1/shipping-quotes. Quote the cheapest shipping of a product to a buyer.
+func (c *Client) CreateShippingQuote(ctx context.Context, body *ShippingQuoteRequest) (*ShippingQuote, error) {
+	var out ShippingQuote
+	if err := c.do(ctx, http.MethodPost, "/api/v1/shipping-quotes", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateShippingRate calls POST /api/v1/shipping-rates. Add a shipping rate to a zone.
+func (c *Client) CreateShippingRate(ctx context.Context, body *ShippingRate) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPost, "/api/v1/shipping-rates", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateShippingZone calls POST /api/v1/shipping-zones. Put a country, a subdivision or * for the rest of the world in a shipping zone.
+func (c *Client) CreateShippingZone(ctx context.Context, body *ShippingZone) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPost, "/api/v1/shipping-zones", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateStripeEvent calls POST /api/v1/stripe-events. Receive a Stripe webhook event signed with the endpoint secret. Dispute events are synced into the disputes, payout events import the payout, and payment intent and invoice events settle pending payments.
+func (c *Client) CreateStripeEvent(ctx context.Context) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPost, "/api/v1/stripe-events", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateSubscription calls POST /api/v1/subscriptions. Create a customer and subscribe them to a plan. A first payment that needs 3-D Secure returns a client secret to confirm.
+func (c *Client) CreateSubscription(ctx context.Context, body *ChargeRequest) (*SubscriptionResult, error) {
+	var out SubscriptionResult
+	if err := c.do(ctx, http.MethodPost, "/api/v1/subscriptions", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateSubscriptionCard calls POST /api/v1/subscription-cards. Set the card of a subscription from the signed link of a dunning email. A past due subscription is charged again with it.
+func (c *Client) CreateSubscriptionCard(ctx context.Context, body *CardUpdateRequest) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPost, "/api/v1/subscription-cards", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateSubscriptionCardSetup calls POST /api/v1/subscription-card-setups. Start collecting a new card for a subscription from the signed link of a dunning email.
+func (c *Client) CreateSubscriptionCardSetup(ctx context.Context, body *CardUpdateRequest) (*SetupIntent, error) {
+	var out SetupIntent
+	if err := c.do(ctx, http.MethodPost, "/api/v1/subscription-card-setups", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateTaxExemption calls POST /api/v1/tax-exemptions. Exempt a buyer from tax by their tax ID.
+func (c *Client) CreateTaxExemption(ctx context.Context, body *TaxExemption) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPost, "/api/v1/tax-exemptions", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateTaxQuote calls POST /api/v1/tax-quotes. Quote the tax on a product for a buyer.
+func (c *Client) CreateTaxQuote(ctx context.Context, body *TaxQuoteRequest) (*TaxQuote, error) {
+	var out TaxQuote
+	if err := c.do(ctx, http.MethodPost, "/api/v1/tax-quotes", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateTaxRule calls POST /api/v1/tax-rules. Add a tax rule, or change the rate of the rule of the same name in the jurisdiction.
+func (c *Client) CreateTaxRule(ctx context.Context, body *TaxRule) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPost, "/api/v1/tax-rules", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateTerminalPayment calls POST /api/v1/terminal-payments. Record a confirmed virtual terminal payment as an order with optional items and a note.
+func (c *Client) CreateTerminalPayment(ctx context.Context, body *TerminalPayment) (*TerminalPayment, error) {
+	var out TerminalPayment
+	if err := c.do(ctx, http.MethodPost, "/api/v1/terminal-payments", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateToken calls POST /api/v1/tokens. Issue a bearer token for an admin user.
+func (c *Client) CreateToken(ctx context.Context, body *Credentials) (*AuthTokenResponse, error) {
+	var out AuthTokenResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/tokens", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateUsageRecord calls POST /api/v1/usage. Report usage of a metered subscription. Usage is summed up and pushed to the gateway in batches.
+func (c *Client) CreateUsageRecord(ctx context.Context, body *UsageRequest) (*UsageRecord, error) {
+	var out UsageRecord
+	if err := c.do(ctx, http.MethodPost, "/api/v1/usage", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateUsageSummary calls POST /api/v1/usage-summaries. Get the seats, trial and current period usage of a subscription from the signed link of its portal page.
+func (c *Client) CreateUsageSummary(ctx context.Context, body *PortalRequest) (*UsageSummary, error) {
+	var out UsageSummary
+	if err := c.do(ctx, http.MethodPost, "/api/v1/usage-summaries", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateUser calls POST /api/v1/users. Add an admin user.
+func (c *Client) CreateUser(ctx context.Context, body *User) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPost, "/api/v1/users", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateVoid calls POST /api/v1/sales/{id}/voids. Void the card authorization of a sale made to order and cancel the sale.
+func (c *Client) CreateVoid(ctx context.Context, id int) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/api/v1/sales/%d/voids", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteCoupon calls DELETE /api/v1/coupons/{id}. Delete a coupon. Orders that used it keep their discount.
+func (c *Client) DeleteCoupon(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/v1/coupons/%d", id), nil, nil, nil)
+}
+
+// DeletePaymentMethod calls DELETE /api/v1/payment-methods/{id}. Remove a saved card.
+func (c *Client) DeletePaymentMethod(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/v1/payment-methods/%d", id), nil, nil, nil)
+}
+
+// DeleteShippingRate calls DELETE /api/v1/shipping-rates/{id}. Delete a shipping rate.
+func (c *Client) DeleteShippingRate(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/v1/shipping-rates/%d", id), nil, nil, nil)
+}
+
+// DeleteShippingZone calls DELETE /api/v1/shipping-zones/{id}. Take a jurisdiction out of its shipping zone.
+func (c *Client) DeleteShippingZone(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/v1/shipping-zones/%d", id), nil, nil, nil)
+}
+
+// DeleteSubscription calls DELETE /api/v1/subscriptions/{id}. Cancel a subscription.
+func (c *Client) DeleteSubscription(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/v1/subscriptions/%d", id), nil, nil, nil)
+}
+
+// DeleteTaxExemption calls DELETE /api/v1/tax-exemptions/{id}. Delete a tax exemption.
+func (c *Client) DeleteTaxExemption(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/v1/tax-exemptions/%d", id), nil, nil, nil)
+}
+
+// DeleteTaxRule calls DELETE /api/v1/tax-rules/{id}. Delete a tax rule.
+func (c *Client) DeleteTaxRule(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/v1/tax-rules/%d", id), nil, nil, nil)
+}
+
+// DeleteUser calls DELETE /api/v1/users/{id}. Delete an admin user.
+func (c *Client) DeleteUser(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/v1/users/%d", id), nil, nil, nil)
+}
+
+// DeleteWidgetPrice calls DELETE /api/v1/widgets/{id}/prices/{currency}. Stop selling a widget in a currency.
+func (c *Client) DeleteWidgetPrice(ctx context.Context, id int, currency string) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/v1/widgets/%d/prices/%s", id, url.PathEscape(currency)), nil, nil, nil)
+}
+
+// ExportCustomersParams are the query parameters of ExportCustomers
+type ExportCustomersParams struct {
+	// csv or xlsx
+	Format string
+	// Created on or after this date, YYYY-MM-DD
+	From string
+	// Created on or before this date, YYYY-MM-DD
+	To string
+	// Partial match on email
+	Email string
+	// Sort key, prefixed with - for descending order
+	Sort string
+}
+
+// ExportCustomers calls GET /api/admin/customers/export. Download customers. Sort keys: id, first_name, last_name, email, created_at.
+func (c *Client) ExportCustomers(ctx context.Context, params *ExportCustomersParams) (io.ReadCloser, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Format != "" {
+			query.Set("format", params.Format)
+		}
+		if params.From != "" {
+			query.Set("from", params.From)
+		}
+		if params.To != "" {
+			query.Set("to", params.To)
+		}
+		if params.Email != "" {
+			query.Set("email", params.Email)
+		}
+		if params.Sort != "" {
+			query.Set("sort", params.Sort)
+		}
+	}
+	return c.download(ctx, http.MethodGet, "/api/admin/customers/export", query)
+}
+
+// ExportInvoicesParams are the query parameters of ExportInvoices
+type ExportInvoicesParams struct {
+	// csv or xlsx
+	Format string
+	// Issued on or after this date, YYYY-MM-DD
+	From string
+	// Issued on or before this date, YYYY-MM-DD
+	To string
+	// invoice or credit_note
+	Kind string
+	// Three-letter currency code
+	Currency string
+}
+
+// ExportInvoices calls GET /api/admin/invoices/export. Download the invoices and credit notes issued in a period, credit notes with negative amounts.
+func (c *Client) ExportInvoices(ctx context.Context, params *ExportInvoicesParams) (io.ReadCloser, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Format != "" {
+			query.Set("format", params.Format)
+		}
+		if params.From != "" {
+			query.Set("from", params.From)
+		}
+		if params.To != "" {
+			query.Set("to", params.To)
+		}
+		if params.Kind != "" {
+			query.Set("kind", params.Kind)
+		}
+		if params.Currency != "" {
+			query.Set("currency", params.Currency)
+		}
+	}
+	return c.download(ctx, http.MethodGet, "/api/admin/invoices/export", query)
+}
+
+// ExportRefundsParams are the query parameters of ExportRefunds
+type ExportRefundsParams struct {
+	// csv or xlsx
+	Format string
+	// Created on or after this date, YYYY-MM-DD
+	From string
+	// Created on or before this date, YYYY-MM-DD
+	To string
+	// Order status ID
+	Status int
+	// Widget ID
+	WidgetID int
+	// Partial match on the customer's email
+	Email string
+	// Last four digits of the card
+	LastFour string
+	// Minimum amount in cents
+	MinAmount int
+	// Maximum amount in cents
+	MaxAmount int
+	// Three letter currency code
+	Currency string
+	// pending, picking, shipped, delivered or returned
+	FulfillmentStatus string
+	// Sort key, prefixed with - for descending order
+	Sort string
+}
+
+// ExportRefunds calls GET /api/admin/refunds/export. Download the refunded sales matching the list filters.
+func (c *Client) ExportRefunds(ctx context.Context, params *ExportRefundsParams) (io.ReadCloser, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Format != "" {
+			query.Set("format", params.Format)
+		}
+		if params.From != "" {
+			query.Set("from", params.From)
+		}
+		if params.To != "" {
+			query.Set("to", params.To)
+		}
+		if params.Status != 0 {
+			query.Set("status", strconv.Itoa(params.Status))
+		}
+		if params.WidgetID != 0 {
+			query.Set("widget_id", strconv.Itoa(params.WidgetID))
+		}
+		if params.Email != "" {
+			query.Set("email", params.Email)
+		}
+		if params.LastFour != "" {
+			query.Set("last_four", params.LastFour)
+		}
+		if params.MinAmount != 0 {
+			query.Set("min_amount", strconv.Itoa(params.MinAmount))
+		}
+		if params.MaxAmount != 0 {
+			query.Set("max_amount", strconv.Itoa(params.MaxAmount))
+		}
+		if params.Currency != "" {
+			query.Set("currency", params.Currency)
+		}
+		if params.FulfillmentStatus != "" {
+			query.Set("fulfillment_status", params.FulfillmentStatus)
+		}
+		if params.Sort != "" {
+			query.Set("sort", params.Sort)
+		}
+	}
+	return c.download(ctx, http.MethodGet, "/api/admin/refunds/export", query)
+}
+
+// ExportSalesParams are the query parameters of ExportSales
+type ExportSalesParams struct {
+	// csv or xlsx
+	Format string
+	// Created on or after this date, YYYY-MM-DD
+	From string
+	// Created on or before this date, YYYY-MM-DD
+	To string
+	// Order status ID
+	Status int
+	// Widget ID
+	WidgetID int
+	// Partial match on the customer's email
+	Email string
+	// Last four digits of the card
+	LastFour string
+	// Minimum amount in cents
+	MinAmount int
+	// Maximum amount in cents
+	MaxAmount int
+	// Three letter currency code
+	Currency string
+	// pending, picking, shipped, delivered or returned
+	FulfillmentStatus string
+	// Sort key, prefixed with - for descending order
+	Sort string
+}
+
+// ExportSales calls GET /api/admin/sales/export. Download the sales matching the list filters.
+func (c *Client) ExportSales(ctx context.Context, params *ExportSalesParams) (io.ReadCloser, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Format != "" {
+			query.Set("format", params.Format)
+		}
+		if params.From != "" {
+			query.Set("from", params.From)
+		}
+		if params.To != "" {
+			query.Set("to", params.To)
+		}
+		if params.Status != 0 {
+			query.Set("status", strconv.Itoa(params.Status))
+		}
+		if params.WidgetID != 0 {
+			query.Set("widget_id", strconv.Itoa(params.WidgetID))
+		}
+		if params.Email != "" {
+			query.Set("email", params.Email)
+		}
+		if params.LastFour != "" {
+			query.Set("last_four", params.LastFour)
+		}
+		if params.MinAmount != 0 {
+			query.Set("min_amount", strconv.Itoa(params.MinAmount))
+		}
+		if params.MaxAmount != 0 {
+			query.Set("max_amount", strconv.Itoa(params.MaxAmount))
+		}
+		if params.Currency != "" {
+			query.Set("currency", params.Currency)
+		}
+		if params.FulfillmentStatus != "" {
+			query.Set("fulfillment_status", params.FulfillmentStatus)
+		}
+		if params.Sort != "" {
+			query.Set("sort", params.Sort)
+		}
+	}
+	return c.download(ctx, http.MethodGet, "/api/admin/sales/export", query)
+}
+
+// ExportSubscriptionsParams are the query parameters of ExportSubscriptions
+type ExportSubscriptionsParams struct {
+	// csv or xlsx
+	Format string
+	// Created on or after this date, YYYY-MM-DD
+	From string
+	// Created on or before this date, YYYY-MM-DD
+	To string
+	// Order status ID
+	Status int
+	// Widget ID
+	WidgetID int
+	// Partial match on the customer's email
+	Email string
+	// Last four digits of the card
+	LastFour string
+	// Minimum amount in cents
+	MinAmount int
+	// Maximum amount in cents
+	MaxAmount int
+	// Three letter currency code
+	Currency string
+	// pending, picking, shipped, delivered or returned
+	FulfillmentStatus string
+	// Sort key, prefixed with - for descending order
+	Sort string
+}
+
+// ExportSubscriptions calls GET /api/admin/subscriptions/export. Download the subscriptions matching the list filters.
+func (c *Client) ExportSubscriptions(ctx context.Context, params *ExportSubscriptionsParams) (io.ReadCloser, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Format != "" {
+			query.Set("format", params.Format)
+		}
+		if params.From != "" {
+			query.Set("from", params.From)
+		}
+		if params.To != "" {
+			query.Set("to", params.To)
+		}
+		if params.Status != 0 {
+			query.Set("status", strconv.Itoa(params.Status))
+		}
+		if params.WidgetID != 0 {
+			query.Set("widget_id", strconv.Itoa(params.WidgetID))
+		}
+		if params.Email != "" {
+			query.Set("email", params.Email)
+		}
+		if params.LastFour != "" {
+			query.Set("last_four", params.LastFour)
+		}
+		if params.MinAmount != 0 {
+			query.Set("min_amount", strconv.Itoa(params.MinAmount))
+		}
+		if params.MaxAmount != 0 {
+			query.Set("max_amount", strconv.Itoa(params.MaxAmount))
+		}
+		if params.Currency != "" {
+			query.Set("currency", params.Currency)
+		}
+		if params.FulfillmentStatus != "" {
+			query.Set("fulfillment_status", params.FulfillmentStatus)
+		}
+		if params.Sort != "" {
+			query.Set("sort", params.Sort)
+		}
+	}
+	return c.download(ctx, http.MethodGet, "/api/admin/subscriptions/export", query)
+}
+
+// GetCurrentToken calls GET /api/v1/tokens/current. Check the bearer token sent with the request.
+func (c *Client) GetCurrentToken(ctx context.Context) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodGet, "/api/v1/tokens/current", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetCustomer calls GET /api/v1/customers/{id}. Get a customer with their saved cards.
+func (c *Client) GetCustomer(ctx context.Context, id int) (*Customer, error) {
+	var out Customer
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/customers/%d", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetDispute calls GET /api/v1/disputes/{id}. Get a dispute with its evidence.
+func (c *Client) GetDispute(ctx context.Context, id int) (*Dispute, error) {
+	var out Dispute
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/disputes/%d", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetDisputeReportParams are the query parameters of GetDisputeReport
+type GetDisputeReportParams struct {
+	// First day of the period, YYYY-MM-DD. Defaults to 29 days before to.
+	From string
+	// Last day of the period, YYYY-MM-DD. Defaults to today.
+	To string
+	// Report only the sales in this currency. Without it, every currency is converted into the base currency.
+	Currency string
+}
+
+// GetDisputeReport calls GET /api/admin/reports/disputes. Disputes opened in a period, their outcomes and the dispute rate against the orders of the period.
+func (c *Client) GetDisputeReport(ctx context.Context, params *GetDisputeReportParams) (*DisputeReport, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.From != "" {
+			query.Set("from", params.From)
+		}
+		if params.To != "" {
+			query.Set("to", params.To)
+		}
+		if params.Currency != "" {
+			query.Set("currency", params.Currency)
+		}
+	}
+	var out DisputeReport
+	if err := c.do(ctx, http.MethodGet, "/api/admin/reports/disputes", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetLedgerCheck calls GET /api/admin/reports/ledger-check. Check that the ledger balances and agrees with the charges, refunds, disputes and payouts it records.
+func (c *Client) GetLedgerCheck(ctx context.Context) (*LedgerCheck, error) {
+	var out LedgerCheck
+	if err := c.do(ctx, http.MethodGet, "/api/admin/reports/ledger-check", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetPayout calls GET /api/v1/payouts/{id}. Get a payout with the balance transactions it paid out and their orders.
+func (c *Client) GetPayout(ctx context.Context, id int) (*Payout, error) {
+	var out Payout
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/payouts/%d", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetReportSummaryParams are the query parameters of GetReportSummary
+type GetReportSummaryParams struct {
+	// First day of the period, YYYY-MM-DD. Defaults to 29 days before to.
+	From string
+	// Last day of the period, YYYY-MM-DD. Defaults to today.
+	To string
+	// Report only the sales in this currency. Without it, every currency is converted into the base currency.
+	Currency string
+}
+
+// GetReportSummary calls GET /api/admin/reports/summary. Gross sales, refunds, net revenue, average order value, MRR, ARR and churn of a period.
+func (c *Client) GetReportSummary(ctx context.Context, params *GetReportSummaryParams) (*ReportSummary, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.From != "" {
+			query.Set("from", params.From)
+		}
+		if params.To != "" {
+			query.Set("to", params.To)
+		}
+		if params.Currency != "" {
+			query.Set("currency", params.Currency)
+		}
+	}
+	var out ReportSummary
+	if err := c.do(ctx, http.MethodGet, "/api/admin/reports/summary", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetReturn calls GET /api/v1/returns/{id}. Get a return with its items and history.
+func (c *Client) GetReturn(ctx context.Context, id int) (*Return, error) {
+	var out Return
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/returns/%d", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetRevenueReportParams are the query parameters of GetRevenueReport
+type GetRevenueReportParams struct {
+	// First day of the period, YYYY-MM-DD. Defaults to 29 days before to.
+	From string
+	// Last day of the period, YYYY-MM-DD. Defaults to today.
+	To string
+	// Report only the sales in this currency. Without it, every currency is converted into the base currency.
+	Currency string
+}
+
+// GetRevenueReport calls GET /api/admin/reports/revenue. Daily gross sales, refunds and net revenue of a period.
+func (c *Client) GetRevenueReport(ctx context.Context, params *GetRevenueReportParams) (*RevenueReport, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.From != "" {
+			query.Set("from", params.From)
+		}
+		if params.To != "" {
+			query.Set("to", params.To)
+		}
+		if params.Currency != "" {
+			query.Set("currency", params.Currency)
+		}
+	}
+	var out RevenueReport
+	if err := c.do(ctx, http.MethodGet, "/api/admin/reports/revenue", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetSale calls GET /api/v1/sales/{id}. Get a sale.
+func (c *Client) GetSale(ctx context.Context, id int) (*Order, error) {
+	var out Order
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/sales/%d", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetSubscription calls GET /api/v1/subscriptions/{id}. Get a subscription.
+func (c *Client) GetSubscription(ctx context.Context, id int) (*Order, error) {
+	var out Order
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/subscriptions/%d", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetSubscriptionReportParams are the query parameters of GetSubscriptionReport
+type GetSubscriptionReportParams struct {
+	// First day of the period, YYYY-MM-DD. Defaults to 29 days before to.
+	From string
+	// Last day of the period, YYYY-MM-DD. Defaults to today.
+	To string
+	// Report only the sales in this currency. Without it, every currency is converted into the base currency.
+	Currency string
+}
+
+// GetSubscriptionReport calls GET /api/admin/reports/subscriptions. Daily active subscriptions, MRR, new subscriptions and cancellations of a period.
+func (c *Client) GetSubscriptionReport(ctx context.Context, params *GetSubscriptionReportParams) (*SubscriptionReport, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.From != "" {
+			query.Set("from", params.From)
+		}
+		if params.To != "" {
+			query.Set("to", params.To)
+		}
+		if params.Currency != "" {
+			query.Set("currency", params.Currency)
+		}
+	}
+	var out SubscriptionReport
+	if err := c.do(ctx, http.MethodGet, "/api/admin/reports/subscriptions", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetSubscriptionUsage calls GET /api/v1/subscriptions/{id}/usage. Get the seats, trial and current period usage of a subscription.
+func (c *Client) GetSubscriptionUsage(ctx context.Context, id int) (*UsageSummary, error) {
+	var out UsageSummary
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/subscriptions/%d/usage", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetTopWidgetsReportParams are the query parameters of GetTopWidgetsReport
+type GetTopWidgetsReportParams struct {
+	// First day of the period, YYYY-MM-DD. Defaults to 29 days before to.
+	From string
+	// Last day of the period, YYYY-MM-DD. Defaults to today.
+	To string
+	// Report only the sales in this currency. Without it, every currency is converted into the base currency.
+	Currency string
+	// Number of widgets, at most 50. Defaults to 5.
+	Limit int
+}
+
+// GetTopWidgetsReport calls GET /api/admin/reports/top-widgets. The widgets with the highest gross sales in a period.
+func (c *Client) GetTopWidgetsReport(ctx context.Context, params *GetTopWidgetsReportParams) (*TopWidgetsReport, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.From != "" {
+			query.Set("from", params.From)
+		}
+		if params.To != "" {
+			query.Set("to", params.To)
+		}
+		if params.Currency != "" {
+			query.Set("currency", params.Currency)
+		}
+		if params.Limit != 0 {
+			query.Set("limit", strconv.Itoa(params.Limit))
+		}
+	}
+	var out TopWidgetsReport
+	if err := c.do(ctx, http.MethodGet, "/api/admin/reports/top-widgets", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetTrialBalanceParams are the query parameters of GetTrialBalance
+type GetTrialBalanceParams struct {
+	// Last day posted, YYYY-MM-DD. Defaults to today.
+	To string
+	// Currency of the entries. Defaults to the base currency.
+	Currency string
+}
+
+// GetTrialBalance calls GET /api/admin/reports/trial-balance. The debits, credits and balance of every ledger account in one currency at the end of a day.
+func (c *Client) GetTrialBalance(ctx context.Context, params *GetTrialBalanceParams) (*TrialBalance, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.To != "" {
+			query.Set("to", params.To)
+		}
+		if params.Currency != "" {
+			query.Set("currency", params.Currency)
+		}
+	}
+	var out TrialBalance
+	if err := c.do(ctx, http.MethodGet, "/api/admin/reports/trial-balance", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetUser calls GET /api/v1/users/{id}. Get an admin user.
+func (c *Client) GetUser(ctx context.Context, id int) (*User, error) {
+	var out User
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/users/%d", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetWidget calls GET /api/v1/widgets/{id}. Get a widget.
+func (c *Client) GetWidget(ctx context.Context, id int) (*Widget, error) {
+	var out Widget
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/widgets/%d", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListCoupons calls GET /api/v1/coupons. List the coupons and how often they were redeemed.
+func (c *Client) ListCoupons(ctx context.Context) (*CouponList, error) {
+	var out CouponList
+	if err := c.do(ctx, http.MethodGet, "/api/v1/coupons", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListCurrencies calls GET /api/v1/currencies. List the supported currencies and their minor units.
+func (c *Client) ListCurrencies(ctx context.Context) (*CurrencyList, error) {
+	var out CurrencyList
+	if err := c.do(ctx, http.MethodGet, "/api/v1/currencies", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListCustomersParams are the query parameters of ListCustomers
+type ListCustomersParams struct {
+	// Part of the name or email of the customer
+	Q string
+}
+
+// ListCustomers calls GET /api/v1/customers. Search customers by name or email, at most 20 by last name.
+func (c *Client) ListCustomers(ctx context.Context, params *ListCustomersParams) (*CustomerList, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Q != "" {
+			query.Set("q", params.Q)
+		}
+	}
+	var out CustomerList
+	if err := c.do(ctx, http.MethodGet, "/api/v1/customers", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListDisputesParams are the query parameters of ListDisputes
+type ListDisputesParams struct {
+	// Only the disputes in this Stripe status, like needs_response
+	Status string
+}
+
+// ListDisputes calls GET /api/v1/disputes. List disputes, those that need a response first, by deadline.
+func (c *Client) ListDisputes(ctx context.Context, params *ListDisputesParams) (*DisputeList, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Status != "" {
+			query.Set("status", params.Status)
+		}
+	}
+	var out DisputeList
+	if err := c.do(ctx, http.MethodGet, "/api/v1/disputes", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListFXRatesParams are the query parameters of ListFXRates
+type ListFXRatesParams struct {
+	// Base currency. Defaults to the configured base currency.
+	Base string
+}
+
+// ListFXRates calls GET /api/v1/fx-rates. List the exchange rates into a base currency.
+func (c *Client) ListFXRates(ctx context.Context, params *ListFXRatesParams) (*FXRateList, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Base != "" {
+			query.Set("base", params.Base)
+		}
+	}
+	var out FXRateList
+	if err := c.do(ctx, http.MethodGet, "/api/v1/fx-rates", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListFulfillmentEvents calls GET /api/v1/sales/{id}/fulfillment-events. List the fulfillment history of a sale.
+func (c *Client) ListFulfillmentEvents(ctx context.Context, id int) (*FulfillmentEventList, error) {
+	var out FulfillmentEventList
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/sales/%d/fulfillment-events", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListPayoutsParams are the query parameters of ListPayouts
+type ListPayoutsParams struct {
+	// First arrival date, YYYY-MM-DD. Defaults to 29 days before to.
+	From string
+	// Last arrival date, YYYY-MM-DD. Defaults to today.
+	To string
+}
+
+// ListPayouts calls GET /api/v1/payouts. List the payouts that arrive in a period with their gross, refunds, fees and net.
+func (c *Client) ListPayouts(ctx context.Context, params *ListPayoutsParams) (*PayoutList, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.From != "" {
+			query.Set("from", params.From)
+		}
+		if params.To != "" {
+			query.Set("to", params.To)
+		}
+	}
+	var out PayoutList
+	if err := c.do(ctx, http.MethodGet, "/api/v1/payouts", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListSaleReturns calls GET /api/v1/sales/{id}/returns. List the returns of a sale with their items and history.
+func (c *Client) ListSaleReturns(ctx context.Context, id int) (*ReturnList, error) {
+	var out ReturnList
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/sales/%d/returns", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListSalesParams are the query parameters of ListSales
+type ListSalesParams struct {
+	// Created on or after this date, YYYY-MM-DD
+	From string
+	// Created on or before this date, YYYY-MM-DD
+	To string
+	// Order status ID
+	Status int
+	// Widget ID
+	WidgetID int
+	// Partial match on the customer's email
+	Email string
+	// Last four digits of the card
+	LastFour string
+	// Minimum amount in cents
+	MinAmount int
+	// Maximum amount in cents
+	MaxAmount int
+	// Three letter currency code
+	Currency string
+	// pending, picking, shipped, delivered or returned
+	FulfillmentStatus string
+	// Sort key, prefixed with - for descending order
+	Sort string
+	// Page number, starting at 1. Selects numbered pages with a total count.
+	Page int
+	// Rows per page, at most 100
+	PageSize int
+	// next_cursor of the previous page. Used when page is not given.
+	Cursor string
+}
+
+// ListSales calls GET /api/v1/sales. List one-off sales. Sort keys: id, created_at, amount, quantity, status, widget, customer, email, currency, last_four, fulfillment_status.
+func (c *Client) ListSales(ctx context.Context, params *ListSalesParams) (*PaginatedSales, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.From != "" {
+			query.Set("from", params.From)
+		}
+		if params.To != "" {
+			query.Set("to", params.To)
+		}
+		if params.Status != 0 {
+			query.Set("status", strconv.Itoa(params.Status))
+		}
+		if params.WidgetID != 0 {
+			query.Set("widget_id", strconv.Itoa(params.WidgetID))
+		}
+		if params.Email != "" {
+			query.Set("email", params.Email)
+		}
+		if params.LastFour != "" {
+			query.Set("last_four", params.LastFour)
+		}
+		if params.MinAmount != 0 {
+			query.Set("min_amount", strconv.Itoa(params.MinAmount))
+		}
+		if params.MaxAmount != 0 {
+			query.Set("max_amount", strconv.Itoa(params.MaxAmount))
+		}
+		if params.Currency != "" {
+			query.Set("currency", params.Currency)
+		}
+		if params.FulfillmentStatus != "" {
+			query.Set("fulfillment_status", params.FulfillmentStatus)
+		}
+		if params.Sort != "" {
+			query.Set("sort", params.Sort)
+		}
+		if params.Page != 0 {
+			query.Set("page", strconv.Itoa(params.Page))
+		}
+		if params.PageSize != 0 {
+			query.Set("page_size", strconv.Itoa(params.PageSize))
+		}
+		if params.Cursor != "" {
+			query.Set("cursor", params.Cursor)
+		}
+	}
+	var out PaginatedSales
+	if err := c.do(ctx, http.MethodGet, "/api/v1/sales", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListShippingRates calls GET /api/v1/shipping-rates. List the shipping rates.
+func (c *Client) ListShippingRates(ctx context.Context) (*ShippingRateList, error) {
+	var out ShippingRateList
+	if err := c.do(ctx, http.MethodGet, "/api/v1/shipping-rates", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListShippingZones calls GET /api/v1/shipping-zones. List the jurisdictions of the shipping zones.
+func (c *Client) ListShippingZones(ctx context.Context) (*ShippingZoneList, error) {
+	var out ShippingZoneList
+	if err := c.do(ctx, http.MethodGet, "/api/v1/shipping-zones", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListSubscriptionEvents calls GET /api/v1/subscriptions/{id}/events. List the timeline of a subscription: failed renewals, retries, reminders, card updates and cancellation.
+func (c *Client) ListSubscriptionEvents(ctx context.Context, id int) (*SubscriptionEventList, error) {
+	var out SubscriptionEventList
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/subscriptions/%d/events", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListSubscriptionsParams are the query parameters of ListSubscriptions
+type ListSubscriptionsParams struct {
+	// Created on or after this date, YYYY-MM-DD
+	From string
+	// Created on or before this date, YYYY-MM-DD
+	To string
+	// Order status ID
+	Status int
+	// Widget ID
+	WidgetID int
+	// Partial match on the customer's email
+	Email string
+	// Last four digits of the card
+	LastFour string
+	// Minimum amount in cents
+	MinAmount int
+	// Maximum amount in cents
+	MaxAmount int
+	// Three letter currency code
+	Currency string
+	// pending, picking, shipped, delivered or returned
+	FulfillmentStatus string
+	// Sort key, prefixed with - for descending order
+	Sort string
+	// Page number, starting at 1. Selects numbered pages with a total count.
+	Page int
+	// Rows per page, at most 100
+	PageSize int
+	// next_cursor of the previous page. Used when page is not given.
+	Cursor string
+}
+
+// ListSubscriptions calls GET /api/v1/subscriptions. List subscriptions. Sort keys are the same as for sales.
+func (c *Client) ListSubscriptions(ctx context.Context, params *ListSubscriptionsParams) (*PaginatedSubscriptions, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.From != "" {
+			query.Set("from", params.From)
+		}
+		if params.To != "" {
+			query.Set("to", params.To)
+		}
+		if params.Status != 0 {
+			query.Set("status", strconv.Itoa(params.Status))
+		}
+		if params.WidgetID != 0 {
+			query.Set("widget_id", strconv.Itoa(params.WidgetID))
+		}
+		if params.Email != "" {
+			query.Set("email", params.Email)
+		}
+		if params.LastFour != "" {
+			query.Set("last_four", params.LastFour)
+		}
+		if params.MinAmount != 0 {
+			query.Set("min_amount", strconv.Itoa(params.MinAmount))
+		}
+		if params.MaxAmount != 0 {
+			query.Set("max_amount", strconv.Itoa(params.MaxAmount))
+		}
+		if params.Currency != "" {
+			query.Set("currency", params.Currency)
+		}
+		if params.FulfillmentStatus != "" {
+			query.Set("fulfillment_status", params.FulfillmentStatus)
+		}
+		if params.Sort != "" {
+			query.Set("sort", params.Sort)
+		}
+		if params.Page != 0 {
+			query.Set("page", strconv.Itoa(params.Page))
+		}
+		if params.PageSize != 0 {
+			query.Set("page_size", strconv.Itoa(params.PageSize))
+		}
+		if params.Cursor != "" {
+			query.Set("cursor", params.Cursor)
+		}
+	}
+	var out PaginatedSubscriptions
+	if err := c.do(ctx, http.MethodGet, "/api/v1/subscriptions", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListTaxExemptions calls GET /api/v1/tax-exemptions. List the tax exemptions.
+func (c *Client) ListTaxExemptions(ctx context.Context) (*TaxExemptionList, error) {
+	var out TaxExemptionList
+	if err := c.do(ctx, http.MethodGet, "/api/v1/tax-exemptions", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListTaxRules calls GET /api/v1/tax-rules. List the tax rules.
+func (c *Client) ListTaxRules(ctx context.Context) (*TaxRuleList, error) {
+	var out TaxRuleList
+	if err := c.do(ctx, http.MethodGet, "/api/v1/tax-rules", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListUsersParams are the query parameters of ListUsers
+type ListUsersParams struct {
+	// Partial match on name or email
+	Q string
+	// Sort key, prefixed with - for descending order
+	Sort string
+	// Page number, starting at 1. Selects numbered pages with a total count.
+	Page int
+	// Rows per page, at most 100
+	PageSize int
+	// next_cursor of the previous page. Used when page is not given.
+	Cursor string
+}
+
+// ListUsers calls GET /api/v1/users. List admin users. Sort keys: id, first_name, last_name, email, created_at.
+func (c *Client) ListUsers(ctx context.Context, params *ListUsersParams) (*PaginatedUsers, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Q != "" {
+			query.Set("q", params.Q)
+		}
+		if params.Sort != "" {
+			query.Set("sort", params.Sort)
+		}
+		if params.Page != 0 {
+			query.Set("page", strconv.Itoa(params.Page))
+		}
+		if params.PageSize != 0 {
+			query.Set("page_size", strconv.Itoa(params.PageSize))
+		}
+		if params.Cursor != "" {
+			query.Set("cursor", params.Cursor)
+		}
+	}
+	var out PaginatedUsers
+	if err := c.do(ctx, http.MethodGet, "/api/v1/users", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PatchUser calls PATCH /api/v1/users/{id}. Update the given fields of an admin user.
+func (c *Client) PatchUser(ctx context.Context, id int, body *UserPatch) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPatch, fmt.Sprintf("/api/v1/users/%d", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RebuildReportRollups calls POST /api/admin/reports/rollups. Recompute the daily report rollups from the orders of a range of days, at most 366.
+func (c *Client) RebuildReportRollups(ctx context.Context, body *RollupRebuild) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPost, "/api/admin/reports/rollups", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetWidgetBilling calls PUT /api/v1/widgets/{id}/billing. Set the trial and metering of the plan of a recurring widget.
+func (c *Client) SetWidgetBilling(ctx context.Context, id int, body *WidgetBilling) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/api/v1/widgets/%d/billing", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetWidgetCaptureMethod calls PUT /api/v1/widgets/{id}/capture-method. Set whether a widget is charged at checkout (automatic) or authorized at checkout and captured later (manual).
+func (c *Client) SetWidgetCaptureMethod(ctx context.Context, id int, body *WidgetCaptureMethod) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/api/v1/widgets/%d/capture-method", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetWidgetPrice calls PUT /api/v1/widgets/{id}/prices/{currency}. Set the price of a widget in a currency.
+func (c *Client) SetWidgetPrice(ctx context.Context, id int, currency string, body *WidgetPrice) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/api/v1/widgets/%d/prices/%s", id, url.PathEscape(currency)), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetWidgetWeight calls PUT /api/v1/widgets/{id}/weight. Set the shipping weight of a widget in grams.
+func (c *Client) SetWidgetWeight(ctx context.Context, id int, body *WidgetWeight) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/api/v1/widgets/%d/weight", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateDisputeEvidence calls PUT /api/v1/disputes/{id}/evidence. Save the evidence text of a dispute that needs a response.
+func (c *Client) UpdateDisputeEvidence(ctx context.Context, id int, body *DisputeEvidenceRequest) (*Dispute, error) {
+	var out Dispute
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/api/v1/disputes/%d/evidence", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateUser calls PUT /api/v1/users/{id}. Replace an admin user. An empty password leaves it unchanged.
+func (c *Client) UpdateUser(ctx context.Context, id int, body *User) (*Response, error) {
+	var out Response
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/api/v1/users/%d", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
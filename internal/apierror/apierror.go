@@ -0,0 +1,109 @@
+package apierror
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+)
+
+// Code is a machine-readable error code sent to API clients
+type Code string
+
+const (
+	CodeBadRequest       Code = "bad_request"
+	CodeNotFound         Code = "not_found"
+	CodeValidationFailed Code = "validation_failed"
+	CodePaymentDeclined  Code = "payment_declined"
+	CodeGateway          Code = "payment_gateway_error"
+	CodeConflict         Code = "conflict"
+	CodeUnauthorized     Code = "unauthorized"
+	CodeInternal         Code = "internal_error"
+)
+
+const internalMessage = "the server encountered a problem and could not process your request"
+
+// Error is the type for errors returned to API clients. Err holds the underlying
+// cause for logging and is never serialized.
+type Error struct {
+	Code      Code              `json:"code"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+	Status    int               `json:"-"`
+	Err       error             `json:"-"`
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return string(e.Code) + ": " + e.Message + ": " + e.Err.Error()
+	}
+	return string(e.Code) + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithMessage returns a copy of e with a different client-facing message
+func (e *Error) WithMessage(message string) *Error {
+	copied := *e
+	copied.Message = message
+	return &copied
+}
+
+func BadRequest(message string) *Error {
+	return &Error{Code: CodeBadRequest, Message: message, Status: http.StatusBadRequest}
+}
+
+func NotFound(message string) *Error {
+	if message == "" {
+		message = "the requested resource could not be found"
+	}
+	return &Error{Code: CodeNotFound, Message: message, Status: http.StatusNotFound}
+}
+
+// Validation reports per-field validation errors
+func Validation(fields map[string]string) *Error {
+	return &Error{
+		Code:    CodeValidationFailed,
+		Message: "the request payload failed validation",
+		Fields:  fields,
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
+// PaymentDeclined reports a card error with a message that is safe to show the buyer
+func PaymentDeclined(message string, err error) *Error {
+	return &Error{Code: CodePaymentDeclined, Message: message, Status: http.StatusPaymentRequired, Err: err}
+}
+
+// Gateway reports a payment gateway failure that is not the buyer's fault
+func Gateway(message string, err error) *Error {
+	return &Error{Code: CodeGateway, Message: message, Status: http.StatusBadGateway, Err: err}
+}
+
+func Conflict(message string) *Error {
+	return &Error{Code: CodeConflict, Message: message, Status: http.StatusConflict}
+}
+
+func Unauthorized(message string) *Error {
+	return &Error{Code: CodeUnauthorized, Message: message, Status: http.StatusUnauthorized}
+}
+
+// Internal wraps an unexpected error. Its text is logged but never sent to clients.
+func Internal(err error) *Error {
+	return &Error{Code: CodeInternal, Message: internalMessage, Status: http.StatusInternalServerError, Err: err}
+}
+
+// From converts any error into an *Error. Unknown errors become internal errors.
+func From(err error) *Error {
+	var apiErr *Error
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.Is(err, sql.ErrNoRows):
+		return NotFound("")
+	default:
+		return Internal(err)
+	}
+}
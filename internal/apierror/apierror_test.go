@@ -0,0 +1,72 @@
+package apierror
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFrom(t *testing.T) {
+	conflict := Conflict("the sale has already been refunded")
+	cause := errors.New("dial tcp: connection refused")
+
+	tests := []struct {
+		name   string
+		err    error
+		code   Code
+		status int
+	}{
+		{"api error", conflict, CodeConflict, http.StatusConflict},
+		{"wrapped api error", fmt.Errorf("refund: %w", conflict), CodeConflict, http.StatusConflict},
+		{"no rows", sql.ErrNoRows, CodeNotFound, http.StatusNotFound},
+		{"wrapped no rows", fmt.Errorf("get sale: %w", sql.ErrNoRows), CodeNotFound, http.StatusNotFound},
+		{"unknown", cause, CodeInternal, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		e := From(tt.err)
+		if e.Code != tt.code || e.Status != tt.status {
+			t.Errorf("%s: got %s %d, want %s %d", tt.name, e.Code, e.Status, tt.code, tt.status)
+		}
+	}
+
+	if e := From(cause); e.Message != internalMessage || !errors.Is(e, cause) {
+		t.Errorf("internal error: got message %q and cause %v", e.Message, e.Err)
+	}
+}
+
+func TestJSONHidesCause(t *testing.T) {
+	e := Internal(errors.New("password authentication failed for user shop"))
+	e.RequestID = "host/abc-000001"
+
+	out, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "password") || strings.Contains(string(out), "500") {
+		t.Errorf("the cause or status leaked to clients: %s", out)
+	}
+	want := `{"code":"internal_error","message":"` + internalMessage + `","request_id":"host/abc-000001"}`
+	if string(out) != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+
+	out, _ = json.Marshal(Validation(map[string]string{"email": "must be provided"}))
+	if !strings.Contains(string(out), `"fields":{"email":"must be provided"}`) {
+		t.Errorf("validation error without its fields: %s", out)
+	}
+}
+
+func TestWithMessage(t *testing.T) {
+	e := NotFound("")
+	changed := e.WithMessage("no sale with this id")
+	if e.Message != "the requested resource could not be found" {
+		t.Errorf("WithMessage changed the original: %q", e.Message)
+	}
+	if changed.Message != "no sale with this id" || changed.Code != CodeNotFound || changed.Status != http.StatusNotFound {
+		t.Errorf("got %+v", changed)
+	}
+}
@@ -0,0 +1,283 @@
+package apispec
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-commerce/internal/apierror"
+	"go-commerce/internal/shipping"
+	"go-commerce/internal/tax"
+)
+
+// Version is the version of the API described by the document
+const Version = "1.0.0"
+
+// Document is an OpenAPI 3 document. Only the parts of the specification the API uses are modelled.
+type Document struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Info       Info                                   `json:"info"`
+	Paths      map[string]map[string]*OperationObject `json:"paths"`
+	Components Components                             `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type OperationObject struct {
+	OperationID string                    `json:"operationId"`
+	Summary     string                    `json:"summary,omitempty"`
+	Tags        []string                  `json:"tags,omitempty"`
+	Deprecated  bool                      `json:"deprecated,omitempty"`
+	Successor   string                    `json:"x-successor,omitempty"`
+	Parameters  []Parameter               `json:"parameters,omitempty"`
+	RequestBody *RequestBody              `json:"requestBody,omitempty"`
+	Responses   map[string]ResponseObject `json:"responses"`
+	Security    []map[string][]string     `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type ResponseObject struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme"`
+}
+
+// Schema is a JSON schema. Object schemas list their properties in Go field order in x-order.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Order                []string           `json:"x-order,omitempty"`
+}
+
+const (
+	jsonContent = "application/json"
+	csvContent  = "text/csv"
+	xlsxContent = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	bearerAuth  = "bearerAuth"
+)
+
+var (
+	timeType   = reflect.TypeOf(time.Time{})
+	pathParams = regexp.MustCompile(`\{([^}]+)\}`)
+
+	// schemaNames renames types whose Go name would be ambiguous in the document
+	schemaNames = map[reflect.Type]string{
+		reflect.TypeOf(apierror.Error{}): "ErrorDetail",
+		reflect.TypeOf(tax.Quote{}):      "TaxQuote",
+		reflect.TypeOf(tax.Line{}):       "TaxLine",
+		reflect.TypeOf(shipping.Quote{}): "ShippingQuote",
+	}
+)
+
+// Build returns the OpenAPI document for Operations
+func Build() *Document {
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:       "go-commerce API",
+			Description: "JSON API for the widget store and its admin back office. Failed requests return an ErrorResponse.",
+			Version:     Version,
+		},
+		Paths: make(map[string]map[string]*OperationObject),
+		Components: Components{
+			Schemas: make(map[string]*Schema),
+			SecuritySchemes: map[string]SecurityScheme{
+				bearerAuth: {Type: "http", Scheme: "bearer"},
+			},
+		},
+	}
+
+	errorSchema := doc.schemaFor(reflect.TypeOf(ErrorResponse{}))
+
+	for _, op := range Operations {
+		o := &OperationObject{
+			OperationID: op.ID,
+			Summary:     op.Summary,
+			Deprecated:  op.Deprecated,
+			Successor:   op.Successor,
+			Responses: map[string]ResponseObject{
+				"default": {
+					Description: "Error",
+					Content:     map[string]MediaType{jsonContent: {Schema: errorSchema}},
+				},
+			},
+		}
+		if op.Tag != "" {
+			o.Tags = []string{op.Tag}
+		}
+		if op.Auth {
+			o.Security = []map[string][]string{{bearerAuth: {}}}
+		}
+
+		for _, m := range pathParams.FindAllStringSubmatch(op.Path, -1) {
+			// {id} is a database ID; other path parameters, like {currency}, are codes
+			typ := "string"
+			if m[1] == "id" {
+				typ = "integer"
+			}
+			o.Parameters = append(o.Parameters, Parameter{
+				Name:     m[1],
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: typ},
+			})
+		}
+		for _, q := range op.Query {
+			o.Parameters = append(o.Parameters, Parameter{
+				Name:        q.Name,
+				In:          "query",
+				Description: q.Description,
+				Required:    q.Required,
+				Schema:      &Schema{Type: q.Type},
+			})
+		}
+
+		if op.Request != nil {
+			o.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]MediaType{jsonContent: {Schema: doc.schemaFor(reflect.TypeOf(op.Request))}},
+			}
+		}
+		if op.Upload {
+			o.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]MediaType{csvContent: {Schema: &Schema{Type: "string", Format: "binary"}}},
+			}
+		}
+
+		success := ResponseObject{Description: http.StatusText(op.Status)}
+		if op.Response != nil {
+			success.Content = map[string]MediaType{jsonContent: {Schema: doc.schemaFor(reflect.TypeOf(op.Response))}}
+		}
+		if op.Download {
+			file := &Schema{Type: "string", Format: "binary"}
+			success.Content = map[string]MediaType{csvContent: {Schema: file}, xlsxContent: {Schema: file}}
+		}
+		o.Responses[strconv.Itoa(op.Status)] = success
+
+		if doc.Paths[op.Path] == nil {
+			doc.Paths[op.Path] = make(map[string]*OperationObject)
+		}
+		doc.Paths[op.Path][strings.ToLower(op.Method)] = o
+	}
+
+	return doc
+}
+
+// JSON returns the OpenAPI document for Operations as indented JSON
+func JSON() ([]byte, error) {
+	return json.MarshalIndent(Build(), "", "  ")
+}
+
+// schemaFor returns the schema of t. Named structs are added to the components and referenced.
+func (doc *Document) schemaFor(t reflect.Type) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time", Nullable: nullable}
+	case t.Kind() == reflect.Struct:
+		return doc.structSchema(t)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return &Schema{Type: "string", Format: "byte", Nullable: nullable}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return &Schema{Type: "array", Items: doc.schemaFor(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: doc.schemaFor(t.Elem())}
+	case t.Kind() == reflect.Bool:
+		return &Schema{Type: "boolean", Nullable: nullable}
+	case t.Kind() == reflect.String:
+		return &Schema{Type: "string", Nullable: nullable}
+	case t.Kind() == reflect.Int64 || t.Kind() == reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64", Nullable: nullable}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint32:
+		return &Schema{Type: "integer", Nullable: nullable}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return &Schema{Type: "number", Nullable: nullable}
+	}
+	panic(fmt.Sprintf("apispec: no schema for %s", t))
+}
+
+func (doc *Document) structSchema(t reflect.Type) *Schema {
+	name, ok := schemaNames[t]
+	if !ok {
+		name = t.Name()
+	}
+	ref := &Schema{Ref: "#/components/schemas/" + name}
+	if _, exists := doc.Components.Schemas[name]; exists {
+		return ref
+	}
+
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	// register before walking the fields so recursive types terminate
+	doc.Components.Schemas[name] = s
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		field, opts := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			field, opts = tag[:i], tag[i+1:]
+		}
+		if field == "" {
+			field = f.Name
+		}
+
+		s.Properties[field] = doc.schemaFor(f.Type)
+		s.Order = append(s.Order, field)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Ptr {
+			s.Required = append(s.Required, field)
+		}
+	}
+	return ref
+}
@@ -0,0 +1,90 @@
+package apispec
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestOperationsAreUnique(t *testing.T) {
+	ids := make(map[string]bool)
+	routes := make(map[string]bool)
+	for _, op := range Operations {
+		route := op.Method + " " + op.Path
+		if ids[op.ID] || routes[route] {
+			t.Errorf("operation %s (%s) is documented twice", op.ID, route)
+		}
+		ids[op.ID], routes[route] = true, true
+		if op.Status == 0 {
+			t.Errorf("operation %s has no status", op.ID)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	doc := Build()
+
+	for _, op := range Operations {
+		o := doc.Paths[op.Path][strings.ToLower(op.Method)]
+		if o == nil {
+			t.Errorf("%s %s is not in the document", op.Method, op.Path)
+			continue
+		}
+		if _, ok := o.Responses["default"]; !ok {
+			t.Errorf("%s has no error response", op.ID)
+		}
+		if op.Auth != (len(o.Security) > 0) {
+			t.Errorf("%s: auth is %v but security is %v", op.ID, op.Auth, o.Security)
+		}
+		for _, m := range pathParams.FindAllStringSubmatch(op.Path, -1) {
+			found := false
+			for _, p := range o.Parameters {
+				found = found || p.In == "path" && p.Name == m[1]
+			}
+			if !found {
+				t.Errorf("%s: path parameter %s is not documented", op.ID, m[1])
+			}
+		}
+	}
+
+	// every reference points to a schema of the components
+	out, err := JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var refs []string
+	collectRefs(t, out, &refs)
+	if len(refs) == 0 {
+		t.Fatal("the document references no schemas")
+	}
+	for _, ref := range refs {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("dangling reference %s", ref)
+		}
+	}
+}
+
+func collectRefs(t *testing.T, out []byte, refs *[]string) {
+	var v interface{}
+	if err := json.Unmarshal(out, &v); err != nil {
+		t.Fatal(err)
+	}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, child := range v {
+				if ref, ok := child.(string); ok && k == "$ref" {
+					*refs = append(*refs, ref)
+				}
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(v)
+}
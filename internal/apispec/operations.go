@@ -0,0 +1,476 @@
+package apispec
+
+import (
+	"net/http"
+
+	"go-commerce/internal/models"
+	"go-commerce/internal/shipping"
+	"go-commerce/internal/tax"
+)
+
+// Param is a query parameter of an operation
+type Param struct {
+	Name        string
+	Type        string // OpenAPI primitive type, e.g. "integer"
+	Description string
+	Required    bool
+}
+
+// Operation documents one route of the API. Request and Response hold zero values of the
+// body types and are read by reflection; nil means the operation has no body. Download
+// operations respond with a CSV or XLSX file instead of JSON, and upload operations take
+// a CSV file as the request body.
+type Operation struct {
+	ID         string
+	Method     string
+	Path       string
+	Summary    string
+	Tag        string
+	Auth       bool
+	Deprecated bool
+	Successor  string
+	Query      []Param
+	Request    interface{}
+	Response   interface{}
+	Download   bool
+	Upload     bool
+	Status     int
+}
+
+var sortParam = Param{Name: "sort", Type: "string", Description: "Sort key, prefixed with - for descending order"}
+
+// listParams are the query parameters of every paginated list
+var listParams = []Param{
+	sortParam,
+	{Name: "page", Type: "integer", Description: "Page number, starting at 1. Selects numbered pages with a total count."},
+	{Name: "page_size", Type: "integer", Description: "Rows per page, at most 100"},
+	{Name: "cursor", Type: "string", Description: "next_cursor of the previous page. Used when page is not given."},
+}
+
+// orderFilterParams filter sales and subscriptions
+var orderFilterParams = []Param{
+	{Name: "from", Type: "string", Description: "Created on or after this date, YYYY-MM-DD"},
+	{Name: "to", Type: "string", Description: "Created on or before this date, YYYY-MM-DD"},
+	{Name: "status", Type: "integer", Description: "Order status ID"},
+	{Name: "widget_id", Type: "integer", Description: "Widget ID"},
+	{Name: "email", Type: "string", Description: "Partial match on the customer's email"},
+	{Name: "last_four", Type: "string", Description: "Last four digits of the card"},
+	{Name: "min_amount", Type: "integer", Description: "Minimum amount in cents"},
+	{Name: "max_amount", Type: "integer", Description: "Maximum amount in cents"},
+	{Name: "currency", Type: "string", Description: "Three letter currency code"},
+	{Name: "fulfillment_status", Type: "string", Description: "pending, picking, shipped, delivered or returned"},
+}
+
+// reportParams select the period and currency of a report
+var reportParams = []Param{
+	{Name: "from", Type: "string", Description: "First day of the period, YYYY-MM-DD. Defaults to 29 days before to."},
+	{Name: "to", Type: "string", Description: "Last day of the period, YYYY-MM-DD. Defaults to today."},
+	{Name: "currency", Type: "string", Description: "Report only the sales in this currency. Without it, every currency is converted into the base currency."},
+}
+
+var formatParam = Param{Name: "format", Type: "string", Description: "csv or xlsx", Required: true}
+
+// params joins parameter lists
+func params(lists ...[]Param) []Param {
+	var all []Param
+	for _, l := range lists {
+		all = append(all, l...)
+	}
+	return all
+}
+
+// Operations lists every route served by cmd/api. The API refuses to start when a
+// route is missing from this table.
+var Operations = []Operation{
+	// public
+	{ID: "CreatePaymentIntent", Method: http.MethodPost, Path: "/api/v1/payment-intents", Tag: "payments",
+		Summary: "Create a payment intent for a one-off card payment",
+		Request: ChargeRequest{}, Response: PaymentIntent{}, Status: http.StatusOK},
+	{ID: "GetWidget", Method: http.MethodGet, Path: "/api/v1/widgets/{id}", Tag: "widgets",
+		Summary:  "Get a widget",
+		Response: models.Widget{}, Status: http.StatusOK},
+	{ID: "ListCurrencies", Method: http.MethodGet, Path: "/api/v1/currencies", Tag: "currencies",
+		Summary:  "List the supported currencies and their minor units",
+		Response: CurrencyList{}, Status: http.StatusOK},
+	{ID: "CreateTaxQuote", Method: http.MethodPost, Path: "/api/v1/tax-quotes", Tag: "taxes",
+		Summary: "Quote the tax on a product for a buyer",
+		Request: TaxQuoteRequest{}, Response: tax.Quote{}, Status: http.StatusOK},
+	{ID: "CreateShippingQuote", Method: http.MethodPost, Path: "/api/v1/shipping-quotes", Tag: "shipping",
+		Summary: "Quote the cheapest shipping of a product to a buyer",
+		Request: ShippingQuoteRequest{}, Response: shipping.Quote{}, Status: http.StatusOK},
+	{ID: "CreateCouponCheck", Method: http.MethodPost, Path: "/api/v1/coupon-checks", Tag: "coupons",
+		Summary: "Check a coupon code and get the discount it gives on a product",
+		Request: CouponCheckRequest{}, Response: CouponCheck{}, Status: http.StatusOK},
+	{ID: "CreateReturn", Method: http.MethodPost, Path: "/api/v1/returns", Tag: "returns",
+		Summary: "Open a return of items of a sale as the customer who bought them",
+		Request: ReturnRequest{}, Response: models.Return{}, Status: http.StatusCreated},
+	{ID: "CreateStripeEvent", Method: http.MethodPost, Path: "/api/v1/stripe-events", Tag: "payments",
+		Summary:  "Receive a Stripe webhook event signed with the endpoint secret. Dispute events are synced into the disputes, payout events import the payout, and payment intent and invoice events settle pending payments.",
+		Response: Response{}, Status: http.StatusOK},
+	{ID: "CreateSubscription", Method: http.MethodPost, Path: "/api/v1/subscriptions", Tag: "subscriptions",
+		Summary: "Create a customer and subscribe them to a plan. A first payment that needs 3-D Secure returns a client secret to confirm.",
+		Request: ChargeRequest{}, Response: SubscriptionResult{}, Status: http.StatusCreated},
+	{ID: "CreateToken", Method: http.MethodPost, Path: "/api/v1/tokens", Tag: "auth",
+		Summary: "Issue a bearer token for an admin user",
+		Request: Credentials{}, Response: AuthTokenResponse{}, Status: http.StatusCreated},
+	{ID: "GetCurrentToken", Method: http.MethodGet, Path: "/api/v1/tokens/current", Tag: "auth",
+		Summary: "Check the bearer token sent with the request", Auth: true,
+		Response: Response{}, Status: http.StatusOK},
+	{ID: "CreatePasswordResetRequest", Method: http.MethodPost, Path: "/api/v1/password-reset-requests", Tag: "auth",
+		Summary: "Email a signed password reset link",
+		Request: PasswordResetRequest{}, Response: Response{}, Status: http.StatusCreated},
+	{ID: "CreatePasswordReset", Method: http.MethodPost, Path: "/api/v1/password-resets", Tag: "auth",
+		Summary: "Set a new password from a password reset link",
+		Request: PasswordReset{}, Response: Response{}, Status: http.StatusCreated},
+
+	// admin
+	{ID: "CreateTerminalPayment", Method: http.MethodPost, Path: "/api/v1/terminal-payments", Tag: "payments",
+		Summary: "Record a confirmed virtual terminal payment as an order with optional items and a note", Auth: true,
+		Request: TerminalPayment{}, Response: TerminalPayment{}, Status: http.StatusOK},
+	{ID: "ListCustomers", Method: http.MethodGet, Path: "/api/v1/customers", Tag: "customers",
+		Summary: "Search customers by name or email, at most 20 by last name", Auth: true,
+		Query: []Param{
+			{Name: "q", Type: "string", Description: "Part of the name or email of the customer"},
+		},
+		Response: CustomerList{}, Status: http.StatusOK},
+	{ID: "CreateCustomer", Method: http.MethodPost, Path: "/api/v1/customers", Tag: "customers",
+		Summary: "Create a customer", Auth: true,
+		Request: NewCustomer{}, Response: models.Customer{}, Status: http.StatusCreated},
+	{ID: "GetCustomer", Method: http.MethodGet, Path: "/api/v1/customers/{id}", Tag: "customers",
+		Summary: "Get a customer with their saved cards", Auth: true,
+		Response: models.Customer{}, Status: http.StatusOK},
+	{ID: "CreateSetupIntent", Method: http.MethodPost, Path: "/api/v1/customers/{id}/setup-intents", Tag: "customers",
+		Summary: "Start collecting a card of a customer to charge off-session later", Auth: true,
+		Response: SetupIntent{}, Status: http.StatusCreated},
+	{ID: "CreatePaymentMethod", Method: http.MethodPost, Path: "/api/v1/customers/{id}/payment-methods", Tag: "customers",
+		Summary: "Save the card of a confirmed setup intent of a customer", Auth: true,
+		Request: PaymentMethodRequest{}, Response: models.PaymentMethod{}, Status: http.StatusCreated},
+	{ID: "DeletePaymentMethod", Method: http.MethodDelete, Path: "/api/v1/payment-methods/{id}", Tag: "customers",
+		Summary: "Remove a saved card", Auth: true,
+		Status: http.StatusNoContent},
+	{ID: "CreateCustomerCharge", Method: http.MethodPost, Path: "/api/v1/customers/{id}/charges", Tag: "payments",
+		Summary: "Charge a saved card of a customer off-session and record the order. Cards that need the customer to authenticate are declined.", Auth: true,
+		Request: OffSessionCharge{}, Response: TerminalPayment{}, Status: http.StatusCreated},
+	{ID: "ListSales", Method: http.MethodGet, Path: "/api/v1/sales", Tag: "sales",
+		Summary: "List one-off sales. Sort keys: id, created_at, amount, quantity, status, widget, customer, email, currency, last_four, fulfillment_status.", Auth: true,
+		Query:    params(orderFilterParams, listParams),
+		Response: PaginatedSales{}, Status: http.StatusOK},
+	{ID: "GetSale", Method: http.MethodGet, Path: "/api/v1/sales/{id}", Tag: "sales",
+		Summary: "Get a sale", Auth: true,
+		Response: models.Order{}, Status: http.StatusOK},
+	{ID: "CreateRefund", Method: http.MethodPost, Path: "/api/v1/sales/{id}/refunds", Tag: "sales",
+		Summary: "Refund a sale in full", Auth: true,
+		Response: Response{}, Status: http.StatusCreated},
+	{ID: "CreateCapture", Method: http.MethodPost, Path: "/api/v1/sales/{id}/captures", Tag: "sales",
+		Summary: "Capture all or part of the card authorization of a sale made to order. The rest of the authorization is released.", Auth: true,
+		Request: CaptureRequest{}, Response: Response{}, Status: http.StatusCreated},
+	{ID: "CreateVoid", Method: http.MethodPost, Path: "/api/v1/sales/{id}/voids", Tag: "sales",
+		Summary: "Void the card authorization of a sale made to order and cancel the sale", Auth: true,
+		Response: Response{}, Status: http.StatusCreated},
+	{ID: "ListFulfillmentEvents", Method: http.MethodGet, Path: "/api/v1/sales/{id}/fulfillment-events", Tag: "fulfillment",
+		Summary: "List the fulfillment history of a sale", Auth: true,
+		Response: FulfillmentEventList{}, Status: http.StatusOK},
+	{ID: "CreateFulfillmentEvent", Method: http.MethodPost, Path: "/api/v1/sales/{id}/fulfillment-events", Tag: "fulfillment",
+		Summary: "Move a sale to the next fulfillment status and email the customer", Auth: true,
+		Request: FulfillmentRequest{}, Response: models.FulfillmentEvent{}, Status: http.StatusCreated},
+	{ID: "ListSaleReturns", Method: http.MethodGet, Path: "/api/v1/sales/{id}/returns", Tag: "returns",
+		Summary: "List the returns of a sale with their items and history", Auth: true,
+		Response: ReturnList{}, Status: http.StatusOK},
+	{ID: "CreateSaleReturn", Method: http.MethodPost, Path: "/api/v1/sales/{id}/returns", Tag: "returns",
+		Summary: "Open a return of items of a sale", Auth: true,
+		Request: ReturnRequest{}, Response: models.Return{}, Status: http.StatusCreated},
+	{ID: "GetReturn", Method: http.MethodGet, Path: "/api/v1/returns/{id}", Tag: "returns",
+		Summary: "Get a return with its items and history", Auth: true,
+		Response: models.Return{}, Status: http.StatusOK},
+	{ID: "CreateReturnEvent", Method: http.MethodPost, Path: "/api/v1/returns/{id}/events", Tag: "returns",
+		Summary: "Move a return to another status. Received returns go back into inventory and refunded ones refund the card.", Auth: true,
+		Request: ReturnStatusChange{}, Response: models.Return{}, Status: http.StatusCreated},
+	{ID: "CreateShipments", Method: http.MethodPost, Path: "/api/v1/shipments", Tag: "fulfillment",
+		Summary: "Ship sales in bulk from a CSV file with the columns order_id, carrier and tracking_number", Auth: true,
+		Upload: true, Response: ShipmentImport{}, Status: http.StatusOK},
+	{ID: "ListDisputes", Method: http.MethodGet, Path: "/api/v1/disputes", Tag: "disputes",
+		Summary: "List disputes, those that need a response first, by deadline", Auth: true,
+		Query: []Param{
+			{Name: "status", Type: "string", Description: "Only the disputes in this Stripe status, like needs_response"},
+		},
+		Response: DisputeList{}, Status: http.StatusOK},
+	{ID: "GetDispute", Method: http.MethodGet, Path: "/api/v1/disputes/{id}", Tag: "disputes",
+		Summary: "Get a dispute with its evidence", Auth: true,
+		Response: models.Dispute{}, Status: http.StatusOK},
+	{ID: "UpdateDisputeEvidence", Method: http.MethodPut, Path: "/api/v1/disputes/{id}/evidence", Tag: "disputes",
+		Summary: "Save the evidence text of a dispute that needs a response", Auth: true,
+		Request: DisputeEvidenceRequest{}, Response: models.Dispute{}, Status: http.StatusOK},
+	{ID: "CreateDisputeFile", Method: http.MethodPost, Path: "/api/v1/disputes/{id}/files", Tag: "disputes",
+		Summary: "Upload a file of at most 4MB to Stripe as evidence for a dispute, replacing the file with the same purpose", Auth: true,
+		Request: DisputeFileUpload{}, Response: models.DisputeFile{}, Status: http.StatusCreated},
+	{ID: "CreateDisputeSubmission", Method: http.MethodPost, Path: "/api/v1/disputes/{id}/submissions", Tag: "disputes",
+		Summary: "Submit the evidence of a dispute to the card issuer, with the customer and shipment of the sale. Evidence can only be submitted once.", Auth: true,
+		Response: models.Dispute{}, Status: http.StatusCreated},
+	{ID: "ListPayouts", Method: http.MethodGet, Path: "/api/v1/payouts", Tag: "payouts",
+		Summary: "List the payouts that arrive in a period with their gross, refunds, fees and net", Auth: true,
+		Query: []Param{
+			{Name: "from", Type: "string", Description: "First arrival date, YYYY-MM-DD. Defaults to 29 days before to."},
+			{Name: "to", Type: "string", Description: "Last arrival date, YYYY-MM-DD. Defaults to today."},
+		},
+		Response: PayoutList{}, Status: http.StatusOK},
+	{ID: "GetPayout", Method: http.MethodGet, Path: "/api/v1/payouts/{id}", Tag: "payouts",
+		Summary: "Get a payout with the balance transactions it paid out and their orders", Auth: true,
+		Response: models.Payout{}, Status: http.StatusOK},
+	{ID: "CreatePayoutImport", Method: http.MethodPost, Path: "/api/v1/payout-imports", Tag: "payouts",
+		Summary: "Import the payouts created in a period of at most 92 days, and the balance transactions they paid out, from Stripe", Auth: true,
+		Request: PayoutImportRequest{}, Response: PayoutImport{}, Status: http.StatusCreated},
+	{ID: "ListSubscriptions", Method: http.MethodGet, Path: "/api/v1/subscriptions", Tag: "subscriptions",
+		Summary: "List subscriptions. Sort keys are the same as for sales.", Auth: true,
+		Query:    params(orderFilterParams, listParams),
+		Response: PaginatedSubscriptions{}, Status: http.StatusOK},
+	{ID: "GetSubscription", Method: http.MethodGet, Path: "/api/v1/subscriptions/{id}", Tag: "subscriptions",
+		Summary: "Get a subscription", Auth: true,
+		Response: models.Order{}, Status: http.StatusOK},
+	{ID: "DeleteSubscription", Method: http.MethodDelete, Path: "/api/v1/subscriptions/{id}", Tag: "subscriptions",
+		Summary: "Cancel a subscription", Auth: true,
+		Status: http.StatusNoContent},
+	{ID: "ListSubscriptionEvents", Method: http.MethodGet, Path: "/api/v1/subscriptions/{id}/events", Tag: "subscriptions",
+		Summary: "List the timeline of a subscription: failed renewals, retries, reminders, card updates and cancellation", Auth: true,
+		Response: SubscriptionEventList{}, Status: http.StatusOK},
+	{ID: "CreateSubscriptionCardSetup", Method: http.MethodPost, Path: "/api/v1/subscription-card-setups", Tag: "subscriptions",
+		Summary: "Start collecting a new card for a subscription from the signed link of a dunning email",
+		Request: CardUpdateRequest{}, Response: SetupIntent{}, Status: http.StatusCreated},
+	{ID: "CreateSubscriptionCard", Method: http.MethodPost, Path: "/api/v1/subscription-cards", Tag: "subscriptions",
+		Summary: "Set the card of a subscription from the signed link of a dunning email. A past due subscription is charged again with it.",
+		Request: CardUpdateRequest{}, Response: Response{}, Status: http.StatusCreated},
+	{ID: "GetSubscriptionUsage", Method: http.MethodGet, Path: "/api/v1/subscriptions/{id}/usage", Tag: "subscriptions",
+		Summary: "Get the seats, trial and current period usage of a subscription", Auth: true,
+		Response: UsageSummary{}, Status: http.StatusOK},
+	{ID: "CreateUsageRecord", Method: http.MethodPost, Path: "/api/v1/usage", Tag: "subscriptions",
+		Summary: "Report usage of a metered subscription. Usage is summed up and pushed to the gateway in batches.", Auth: true,
+		Request: UsageRequest{}, Response: models.UsageRecord{}, Status: http.StatusCreated},
+	{ID: "CreatePortalLink", Method: http.MethodPost, Path: "/api/v1/portal-links", Tag: "subscriptions",
+		Summary: "Email a customer signed links to the portal pages of their subscriptions",
+		Request: PortalLinkRequest{}, Response: Response{}, Status: http.StatusCreated},
+	{ID: "CreateUsageSummary", Method: http.MethodPost, Path: "/api/v1/usage-summaries", Tag: "subscriptions",
+		Summary: "Get the seats, trial and current period usage of a subscription from the signed link of its portal page",
+		Request: PortalRequest{}, Response: UsageSummary{}, Status: http.StatusOK},
+	{ID: "SetWidgetPrice", Method: http.MethodPut, Path: "/api/v1/widgets/{id}/prices/{currency}", Tag: "widgets",
+		Summary: "Set the price of a widget in a currency", Auth: true,
+		Request: WidgetPrice{}, Response: Response{}, Status: http.StatusOK},
+	{ID: "DeleteWidgetPrice", Method: http.MethodDelete, Path: "/api/v1/widgets/{id}/prices/{currency}", Tag: "widgets",
+		Summary: "Stop selling a widget in a currency", Auth: true,
+		Status: http.StatusNoContent},
+	{ID: "SetWidgetWeight", Method: http.MethodPut, Path: "/api/v1/widgets/{id}/weight", Tag: "widgets",
+		Summary: "Set the shipping weight of a widget in grams", Auth: true,
+		Request: WidgetWeight{}, Response: Response{}, Status: http.StatusOK},
+	{ID: "SetWidgetCaptureMethod", Method: http.MethodPut, Path: "/api/v1/widgets/{id}/capture-method", Tag: "widgets",
+		Summary: "Set whether a widget is charged at checkout (automatic) or authorized at checkout and captured later (manual)", Auth: true,
+		Request: WidgetCaptureMethod{}, Response: Response{}, Status: http.StatusOK},
+	{ID: "SetWidgetBilling", Method: http.MethodPut, Path: "/api/v1/widgets/{id}/billing", Tag: "widgets",
+		Summary: "Set the trial and metering of the plan of a recurring widget", Auth: true,
+		Request: WidgetBilling{}, Response: Response{}, Status: http.StatusOK},
+	{ID: "ListFXRates", Method: http.MethodGet, Path: "/api/v1/fx-rates", Tag: "currencies",
+		Summary: "List the exchange rates into a base currency", Auth: true,
+		Query: []Param{
+			{Name: "base", Type: "string", Description: "Base currency. Defaults to the configured base currency."},
+		},
+		Response: FXRateList{}, Status: http.StatusOK},
+	{ID: "CreateFXRate", Method: http.MethodPost, Path: "/api/v1/fx-rates", Tag: "currencies",
+		Summary: "Add an exchange rate, effective from a day until the next rate of the currency", Auth: true,
+		Request: models.FXRate{}, Response: Response{}, Status: http.StatusCreated},
+	{ID: "ListTaxRules", Method: http.MethodGet, Path: "/api/v1/tax-rules", Tag: "taxes",
+		Summary: "List the tax rules", Auth: true,
+		Response: TaxRuleList{}, Status: http.StatusOK},
+	{ID: "CreateTaxRule", Method: http.MethodPost, Path: "/api/v1/tax-rules", Tag: "taxes",
+		Summary: "Add a tax rule, or change the rate of the rule of the same name in the jurisdiction", Auth: true,
+		Request: models.TaxRule{}, Response: Response{}, Status: http.StatusCreated},
+	{ID: "DeleteTaxRule", Method: http.MethodDelete, Path: "/api/v1/tax-rules/{id}", Tag: "taxes",
+		Summary: "Delete a tax rule", Auth: true,
+		Status: http.StatusNoContent},
+	{ID: "ListTaxExemptions", Method: http.MethodGet, Path: "/api/v1/tax-exemptions", Tag: "taxes",
+		Summary: "List the tax exemptions", Auth: true,
+		Response: TaxExemptionList{}, Status: http.StatusOK},
+	{ID: "CreateTaxExemption", Method: http.MethodPost, Path: "/api/v1/tax-exemptions", Tag: "taxes",
+		Summary: "Exempt a buyer from tax by their tax ID", Auth: true,
+		Request: models.TaxExemption{}, Response: Response{}, Status: http.StatusCreated},
+	{ID: "DeleteTaxExemption", Method: http.MethodDelete, Path: "/api/v1/tax-exemptions/{id}", Tag: "taxes",
+		Summary: "Delete a tax exemption", Auth: true,
+		Status: http.StatusNoContent},
+	{ID: "ListShippingZones", Method: http.MethodGet, Path: "/api/v1/shipping-zones", Tag: "shipping",
+		Summary: "List the jurisdictions of the shipping zones", Auth: true,
+		Response: ShippingZoneList{}, Status: http.StatusOK},
+	{ID: "CreateShippingZone", Method: http.MethodPost, Path: "/api/v1/shipping-zones", Tag: "shipping",
+		Summary: "Put a country, a subdivision or * for the rest of the world in a shipping zone", Auth: true,
+		Request: models.ShippingZone{}, Response: Response{}, Status: http.StatusCreated},
+	{ID: "DeleteShippingZone", Method: http.MethodDelete, Path: "/api/v1/shipping-zones/{id}", Tag: "shipping",
+		Summary: "Take a jurisdiction out of its shipping zone", Auth: true,
+		Status: http.StatusNoContent},
+	{ID: "ListShippingRates", Method: http.MethodGet, Path: "/api/v1/shipping-rates", Tag: "shipping",
+		Summary: "List the shipping rates", Auth: true,
+		Response: ShippingRateList{}, Status: http.StatusOK},
+	{ID: "CreateShippingRate", Method: http.MethodPost, Path: "/api/v1/shipping-rates", Tag: "shipping",
+		Summary: "Add a shipping rate to a zone", Auth: true,
+		Request: models.ShippingRate{}, Response: Response{}, Status: http.StatusCreated},
+	{ID: "DeleteShippingRate", Method: http.MethodDelete, Path: "/api/v1/shipping-rates/{id}", Tag: "shipping",
+		Summary: "Delete a shipping rate", Auth: true,
+		Status: http.StatusNoContent},
+	{ID: "ListCoupons", Method: http.MethodGet, Path: "/api/v1/coupons", Tag: "coupons",
+		Summary: "List the coupons and how often they were redeemed", Auth: true,
+		Response: CouponList{}, Status: http.StatusOK},
+	{ID: "CreateCoupon", Method: http.MethodPost, Path: "/api/v1/coupons", Tag: "coupons",
+		Summary: "Add a coupon", Auth: true,
+		Request: models.Coupon{}, Response: Response{}, Status: http.StatusCreated},
+	{ID: "DeleteCoupon", Method: http.MethodDelete, Path: "/api/v1/coupons/{id}", Tag: "coupons",
+		Summary: "Delete a coupon. Orders that used it keep their discount.", Auth: true,
+		Status: http.StatusNoContent},
+	{ID: "ListUsers", Method: http.MethodGet, Path: "/api/v1/users", Tag: "users",
+		Summary: "List admin users. Sort keys: id, first_name, last_name, email, created_at.", Auth: true,
+		Query: params([]Param{
+			{Name: "q", Type: "string", Description: "Partial match on name or email"},
+		}, listParams),
+		Response: PaginatedUsers{}, Status: http.StatusOK},
+	{ID: "CreateUser", Method: http.MethodPost, Path: "/api/v1/users", Tag: "users",
+		Summary: "Add an admin user", Auth: true,
+		Request: models.User{}, Response: Response{}, Status: http.StatusCreated},
+	{ID: "GetUser", Method: http.MethodGet, Path: "/api/v1/users/{id}", Tag: "users",
+		Summary: "Get an admin user", Auth: true,
+		Response: models.User{}, Status: http.StatusOK},
+	{ID: "UpdateUser", Method: http.MethodPut, Path: "/api/v1/users/{id}", Tag: "users",
+		Summary: "Replace an admin user. An empty password leaves it unchanged.", Auth: true,
+		Request: models.User{}, Response: Response{}, Status: http.StatusOK},
+	{ID: "PatchUser", Method: http.MethodPatch, Path: "/api/v1/users/{id}", Tag: "users",
+		Summary: "Update the given fields of an admin user", Auth: true,
+		Request: UserPatch{}, Response: Response{}, Status: http.StatusOK},
+	{ID: "DeleteUser", Method: http.MethodDelete, Path: "/api/v1/users/{id}", Tag: "users",
+		Summary: "Delete an admin user", Auth: true,
+		Status: http.StatusNoContent},
+
+	// exports
+	{ID: "ExportSales", Method: http.MethodGet, Path: "/api/admin/sales/export", Tag: "exports",
+		Summary: "Download the sales matching the list filters", Auth: true,
+		Query: params([]Param{formatParam}, orderFilterParams, []Param{sortParam}), Download: true, Status: http.StatusOK},
+	{ID: "ExportSubscriptions", Method: http.MethodGet, Path: "/api/admin/subscriptions/export", Tag: "exports",
+		Summary: "Download the subscriptions matching the list filters", Auth: true,
+		Query: params([]Param{formatParam}, orderFilterParams, []Param{sortParam}), Download: true, Status: http.StatusOK},
+	{ID: "ExportRefunds", Method: http.MethodGet, Path: "/api/admin/refunds/export", Tag: "exports",
+		Summary: "Download the refunded sales matching the list filters", Auth: true,
+		Query: params([]Param{formatParam}, orderFilterParams, []Param{sortParam}), Download: true, Status: http.StatusOK},
+	{ID: "ExportCustomers", Method: http.MethodGet, Path: "/api/admin/customers/export", Tag: "exports",
+		Summary: "Download customers. Sort keys: id, first_name, last_name, email, created_at.", Auth: true,
+		Query: []Param{
+			formatParam,
+			{Name: "from", Type: "string", Description: "Created on or after this date, YYYY-MM-DD"},
+			{Name: "to", Type: "string", Description: "Created on or before this date, YYYY-MM-DD"},
+			{Name: "email", Type: "string", Description: "Partial match on email"},
+			sortParam,
+		},
+		Download: true, Status: http.StatusOK},
+	{ID: "ExportInvoices", Method: http.MethodGet, Path: "/api/admin/invoices/export", Tag: "exports",
+		Summary: "Download the invoices and credit notes issued in a period, credit notes with negative amounts", Auth: true,
+		Query: []Param{
+			formatParam,
+			{Name: "from", Type: "string", Description: "Issued on or after this date, YYYY-MM-DD"},
+			{Name: "to", Type: "string", Description: "Issued on or before this date, YYYY-MM-DD"},
+			{Name: "kind", Type: "string", Description: "invoice or credit_note"},
+			{Name: "currency", Type: "string", Description: "Three-letter currency code"},
+		},
+		Download: true, Status: http.StatusOK},
+
+	// reports
+	{ID: "GetReportSummary", Method: http.MethodGet, Path: "/api/admin/reports/summary", Tag: "reports",
+		Summary: "Gross sales, refunds, net revenue, average order value, MRR, ARR and churn of a period", Auth: true,
+		Query: reportParams, Response: models.ReportSummary{}, Status: http.StatusOK},
+	{ID: "GetRevenueReport", Method: http.MethodGet, Path: "/api/admin/reports/revenue", Tag: "reports",
+		Summary: "Daily gross sales, refunds and net revenue of a period", Auth: true,
+		Query: reportParams, Response: RevenueReport{}, Status: http.StatusOK},
+	{ID: "GetSubscriptionReport", Method: http.MethodGet, Path: "/api/admin/reports/subscriptions", Tag: "reports",
+		Summary: "Daily active subscriptions, MRR, new subscriptions and cancellations of a period", Auth: true,
+		Query: reportParams, Response: SubscriptionReport{}, Status: http.StatusOK},
+	{ID: "GetTopWidgetsReport", Method: http.MethodGet, Path: "/api/admin/reports/top-widgets", Tag: "reports",
+		Summary: "The widgets with the highest gross sales in a period", Auth: true,
+		Query: params(reportParams, []Param{
+			{Name: "limit", Type: "integer", Description: "Number of widgets, at most 50. Defaults to 5."},
+		}),
+		Response: TopWidgetsReport{}, Status: http.StatusOK},
+	{ID: "GetDisputeReport", Method: http.MethodGet, Path: "/api/admin/reports/disputes", Tag: "reports",
+		Summary: "Disputes opened in a period, their outcomes and the dispute rate against the orders of the period", Auth: true,
+		Query: reportParams, Response: models.DisputeReport{}, Status: http.StatusOK},
+	{ID: "GetTrialBalance", Method: http.MethodGet, Path: "/api/admin/reports/trial-balance", Tag: "reports",
+		Summary: "The debits, credits and balance of every ledger account in one currency at the end of a day", Auth: true,
+		Query: []Param{
+			{Name: "to", Type: "string", Description: "Last day posted, YYYY-MM-DD. Defaults to today."},
+			{Name: "currency", Type: "string", Description: "Currency of the entries. Defaults to the base currency."},
+		},
+		Response: models.TrialBalance{}, Status: http.StatusOK},
+	{ID: "GetLedgerCheck", Method: http.MethodGet, Path: "/api/admin/reports/ledger-check", Tag: "reports",
+		Summary: "Check that the ledger balances and agrees with the charges, refunds, disputes and payouts it records", Auth: true,
+		Response: models.LedgerCheck{}, Status: http.StatusOK},
+	{ID: "RebuildReportRollups", Method: http.MethodPost, Path: "/api/admin/reports/rollups", Tag: "reports",
+		Summary: "Recompute the daily report rollups from the orders of a range of days, at most 366", Auth: true,
+		Request: RollupRebuild{}, Response: Response{}, Status: http.StatusOK},
+
+	// deprecated aliases
+	{ID: "LegacyPaymentIntent", Method: http.MethodPost, Path: "/api/payment-intent", Tag: "legacy",
+		Deprecated: true, Successor: "/api/v1/payment-intents",
+		Request: ChargeRequest{}, Response: PaymentIntent{}, Status: http.StatusOK},
+	{ID: "LegacyWidget", Method: http.MethodGet, Path: "/api/widget/{id}", Tag: "legacy",
+		Deprecated: true, Successor: "/api/v1/widgets/{id}",
+		Response: models.Widget{}, Status: http.StatusOK},
+	{ID: "LegacySubscribe", Method: http.MethodPost, Path: "/api/create-customer-and-subscribe-to-plan", Tag: "legacy",
+		Deprecated: true, Successor: "/api/v1/subscriptions",
+		Request: ChargeRequest{}, Response: Response{}, Status: http.StatusCreated},
+	{ID: "LegacyAuthenticate", Method: http.MethodPost, Path: "/api/authenticate", Tag: "legacy",
+		Deprecated: true, Successor: "/api/v1/tokens",
+		Request: Credentials{}, Response: AuthTokenResponse{}, Status: http.StatusCreated},
+	{ID: "LegacyIsAuthenticated", Method: http.MethodPost, Path: "/api/is-authenticated", Tag: "legacy",
+		Deprecated: true, Successor: "/api/v1/tokens/current", Auth: true,
+		Response: Response{}, Status: http.StatusOK},
+	{ID: "LegacyForgotPassword", Method: http.MethodPost, Path: "/api/forgot-password", Tag: "legacy",
+		Deprecated: true, Successor: "/api/v1/password-reset-requests",
+		Request: PasswordResetRequest{}, Response: Response{}, Status: http.StatusCreated},
+	{ID: "LegacyResetPassword", Method: http.MethodPost, Path: "/api/reset-password", Tag: "legacy",
+		Deprecated: true, Successor: "/api/v1/password-resets",
+		Request: PasswordReset{}, Response: Response{}, Status: http.StatusCreated},
+	{ID: "LegacyTerminalPayment", Method: http.MethodPost, Path: "/api/admin/terminal-payment-successful", Tag: "legacy",
+		Deprecated: true, Successor: "/api/v1/terminal-payments", Auth: true,
+		Request: TerminalPayment{}, Response: TerminalPayment{}, Status: http.StatusOK},
+	{ID: "LegacyAllSales", Method: http.MethodPost, Path: "/api/admin/all-sales", Tag: "legacy",
+		Deprecated: true, Successor: "/api/v1/sales", Auth: true,
+		Request: PageRequest{}, Response: PaginatedSales{}, Status: http.StatusOK},
+	{ID: "LegacyAllSubscriptions", Method: http.MethodPost, Path: "/api/admin/all-subscriptions", Tag: "legacy",
+		Deprecated: true, Successor: "/api/v1/subscriptions", Auth: true,
+		Response: []*models.Order{}, Status: http.StatusOK},
+	{ID: "LegacyGetSale", Method: http.MethodPost, Path: "/api/admin/get-sale/{id}", Tag: "legacy",
+		Deprecated: true, Successor: "/api/v1/sales/{id}", Auth: true,
+		Response: models.Order{}, Status: http.StatusOK},
+	{ID: "LegacyGetSubscription", Method: http.MethodPost, Path: "/api/admin/get-subscription/{id}", Tag: "legacy",
+		Deprecated: true, Successor: "/api/v1/subscriptions/{id}", Auth: true,
+		Response: models.Order{}, Status: http.StatusOK},
+	{ID: "LegacyRefund", Method: http.MethodPost, Path: "/api/admin/refund", Tag: "legacy",
+		Deprecated: true, Successor: "/api/v1/sales/{id}/refunds", Auth: true,
+		Request: LegacyRefund{}, Response: Response{}, Status: http.StatusOK},
+	{ID: "LegacyCancelSubscription", Method: http.MethodPost, Path: "/api/admin/cancel-subscription", Tag: "legacy",
+		Deprecated: true, Successor: "/api/v1/subscriptions/{id}", Auth: true,
+		Request: LegacyCancellation{}, Response: Response{}, Status: http.StatusOK},
+	{ID: "LegacyAllUsers", Method: http.MethodPost, Path: "/api/admin/all-users", Tag: "legacy",
+		Deprecated: true, Successor: "/api/v1/users", Auth: true,
+		Response: []*models.User{}, Status: http.StatusOK},
+	{ID: "LegacyOneUser", Method: http.MethodPost, Path: "/api/admin/all-users/{id}", Tag: "legacy",
+		Deprecated: true, Successor: "/api/v1/users/{id}", Auth: true,
+		Response: models.User{}, Status: http.StatusOK},
+	{ID: "LegacyEditUser", Method: http.MethodPost, Path: "/api/admin/all-users/edit", Tag: "legacy",
+		Deprecated: true, Successor: "/api/v1/users/{id}", Auth: true,
+		Request: models.User{}, Response: Response{}, Status: http.StatusOK},
+	{ID: "LegacyAddUser", Method: http.MethodPost, Path: "/api/admin/all-users/add", Tag: "legacy",
+		Deprecated: true, Successor: "/api/v1/users", Auth: true,
+		Request: models.User{}, Response: Response{}, Status: http.StatusOK},
+	{ID: "LegacyDeleteUser", Method: http.MethodPost, Path: "/api/admin/all-users/delete/{id}", Tag: "legacy",
+		Deprecated: true, Successor: "/api/v1/users/{id}", Auth: true,
+		Response: Response{}, Status: http.StatusOK},
+}
+
+// Find returns the operation documented for method and path
+func Find(method, path string) (Operation, bool) {
+	for _, op := range Operations {
+		if op.Method == method && op.Path == path {
+			return op, true
+		}
+	}
+	return Operation{}, false
+}
@@ -0,0 +1,519 @@
+package apispec
+
+import (
+	"time"
+
+	"go-commerce/internal/apierror"
+	"go-commerce/internal/models"
+	"go-commerce/internal/shipping"
+	"go-commerce/internal/tax"
+)
+
+// Response is the generic success response
+type Response struct {
+	HasError bool   `json:"has_error"`
+	Message  string `json:"message,omitempty"`
+}
+
+// ErrorResponse is the envelope for every API error
+type ErrorResponse struct {
+	HasError bool            `json:"has_error"`
+	Message  string          `json:"message"`
+	Error    *apierror.Error `json:"error"`
+}
+
+// ChargeRequest is the payload for payment intents and plan subscriptions
+type ChargeRequest struct {
+	Currency      string `json:"currency"`
+	Amount        int    `json:"amount"`
+	PaymentMethod string `json:"payment_method"`
+	Email         string `json:"email"`
+	LastFour      string `json:"last_four"`
+	Plan          string `json:"plan"`
+	CardBrand     string `json:"card_brand"`
+	ExpiryMonth   int    `json:"exp_month"`
+	ExpiryYear    int    `json:"exp_year"`
+	ProductID     int    `json:"product_id"`
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+	Country       string `json:"country"`
+	Region        string `json:"region"`
+	TaxID         string `json:"tax_id"`
+	Coupon        string `json:"coupon"`
+	Seats         int    `json:"seats,omitempty"`
+
+	BillingAddress  *models.Address `json:"billing_address,omitempty"`
+	ShippingAddress *models.Address `json:"shipping_address,omitempty"`
+}
+
+// SubscriptionResult is the outcome of subscribing to a plan. When the first invoice
+// needs the card holder to authenticate, RequiresAction is set and the client confirms
+// ClientSecret; the order stays pending until the invoice is paid. A plan with a trial
+// is not charged until TrialEndsAt.
+type SubscriptionResult struct {
+	HasError       bool       `json:"has_error"`
+	Message        string     `json:"message,omitempty"`
+	SubscriptionID string     `json:"subscription_id"`
+	Status         string     `json:"status"`
+	RequiresAction bool       `json:"requires_action"`
+	ClientSecret   string     `json:"client_secret,omitempty"`
+	TrialEndsAt    *time.Time `json:"trial_ends_at,omitempty"`
+}
+
+// PaymentIntent is the part of a gateway payment intent the client needs to confirm a card payment
+type PaymentIntent struct {
+	ID            string          `json:"id"`
+	ClientSecret  string          `json:"client_secret"`
+	Amount        int             `json:"amount"`
+	Currency      string          `json:"currency"`
+	Status        string          `json:"status"`
+	CaptureMethod string          `json:"capture_method"`
+	Discount      int             `json:"discount,omitempty"`
+	Tax           *tax.Quote      `json:"tax,omitempty"`
+	Shipping      *shipping.Quote `json:"shipping,omitempty"`
+}
+
+// Credentials is the payload to authenticate an admin user
+type Credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// AuthTokenResponse carries a newly issued bearer token
+type AuthTokenResponse struct {
+	HasError bool          `json:"has_error"`
+	Message  string        `json:"message"`
+	Token    *models.Token `json:"authentication_token"`
+}
+
+// TerminalPayment records a virtual terminal payment as an order of CustomerID, or of a
+// new customer with Email when it is zero. Items are optional and must add up to Amount.
+// Card details, CustomerID and OrderID are filled in from the gateway and the order, and
+// Status is the status of the payment intent: succeeded, or processing while the order
+// is pending.
+type TerminalPayment struct {
+	FirstName       string             `json:"first_name"`
+	LastName        string             `json:"last_name"`
+	Email           string             `json:"email"`
+	CustomerID      int                `json:"customer_id"`
+	PaymentIntentID string             `json:"payment_intent"`
+	PaymentMethodID string             `json:"payment_method"`
+	Amount          int                `json:"amount"`
+	Currency        string             `json:"currency"`
+	Items           []OrderItemRequest `json:"items,omitempty"`
+	Note            string             `json:"note"`
+	OrderID         int                `json:"order_id"`
+	Status          string             `json:"status"`
+	LastFour        string             `json:"last_four"`
+	ExpiryMonth     int                `json:"expiry_month"`
+	ExpiryYear      int                `json:"expiry_year"`
+	BankReturnCode  string             `json:"bank_return_code"`
+}
+
+// OrderItemRequest is a line of a terminal order. A line of a widget is described by
+// the widget name unless Description is set.
+type OrderItemRequest struct {
+	WidgetID    int    `json:"widget_id"`
+	Description string `json:"description"`
+	Quantity    int    `json:"quantity"`
+	UnitAmount  int    `json:"unit_amount"`
+}
+
+// OffSessionCharge charges a saved card of a customer while the customer is not present.
+// PaymentMethodID is the id of the saved card, not the Stripe payment method.
+type OffSessionCharge struct {
+	PaymentMethodID int                `json:"payment_method_id"`
+	Amount          int                `json:"amount"`
+	Currency        string             `json:"currency"`
+	Items           []OrderItemRequest `json:"items,omitempty"`
+	Note            string             `json:"note"`
+}
+
+// CustomerList is a list of customers
+type CustomerList struct {
+	Customers []*models.Customer `json:"customers"`
+}
+
+// NewCustomer creates a customer from the virtual terminal
+type NewCustomer struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+}
+
+// SetupIntent is the part of a gateway setup intent the client needs to confirm a card
+// to save
+type SetupIntent struct {
+	ID           string `json:"id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// PaymentMethodRequest saves the card of a confirmed setup intent
+type PaymentMethodRequest struct {
+	SetupIntentID string `json:"setup_intent"`
+}
+
+// PasswordResetRequest asks for a password reset email
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+// PasswordReset sets a new password. Email is the encrypted email from the signed reset link.
+type PasswordReset struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// PageRequest selects a page of results
+type PageRequest struct {
+	Page     int `json:"page"`
+	PageSize int `json:"page_size"`
+}
+
+// PaginatedSales is a page of one-off sales. TotalSales and LastPage are only set for numbered
+// pages and NextCursor only for cursor pages that are followed by another page.
+type PaginatedSales struct {
+	TotalSales int             `json:"total_sales"`
+	LastPage   int             `json:"last_page"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+	Sales      []*models.Order `json:"sales"`
+}
+
+// PaginatedSubscriptions is a page of subscriptions
+type PaginatedSubscriptions struct {
+	Total         int             `json:"total,omitempty"`
+	LastPage      int             `json:"last_page,omitempty"`
+	NextCursor    string          `json:"next_cursor,omitempty"`
+	Subscriptions []*models.Order `json:"subscriptions"`
+}
+
+// PaginatedUsers is a page of admin users
+type PaginatedUsers struct {
+	Total      int            `json:"total,omitempty"`
+	LastPage   int            `json:"last_page,omitempty"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	Users      []*models.User `json:"users"`
+}
+
+// LegacyRefund is the payload of the deprecated refund route. Only the ID is read: the
+// sale is refunded what is left of its charge, whatever amount is sent.
+type LegacyRefund struct {
+	ID            int    `json:"id"`
+	PaymentIntent string `json:"payment_intent"`
+	Amount        int    `json:"amount"`
+	Currency      string `json:"currency"`
+}
+
+// LegacyCancellation is the payload of the deprecated cancel subscription route
+type LegacyCancellation struct {
+	ID            int    `json:"id"`
+	PaymentIntent string `json:"payment_intent"`
+	Currency      string `json:"currency"`
+}
+
+// UserPatch updates only the fields that are present
+type UserPatch struct {
+	FirstName *string `json:"first_name"`
+	LastName  *string `json:"last_name"`
+	Email     *string `json:"email"`
+	Password  *string `json:"password"`
+}
+
+// RevenueReport is the daily sales of a period. Converted reports cover every currency,
+// converted into Currency.
+type RevenueReport struct {
+	From      string              `json:"from"`
+	To        string              `json:"to"`
+	Currency  string              `json:"currency"`
+	Converted bool                `json:"converted"`
+	Days      []models.RevenueDay `json:"days"`
+}
+
+// SubscriptionReport is the daily subscription snapshots of a period
+type SubscriptionReport struct {
+	From      string                   `json:"from"`
+	To        string                   `json:"to"`
+	Currency  string                   `json:"currency"`
+	Converted bool                     `json:"converted"`
+	Days      []models.SubscriptionDay `json:"days"`
+}
+
+// TopWidgetsReport is the best selling widgets of a period
+type TopWidgetsReport struct {
+	From      string               `json:"from"`
+	To        string               `json:"to"`
+	Currency  string               `json:"currency"`
+	Converted bool                 `json:"converted"`
+	Widgets   []models.WidgetSales `json:"widgets"`
+}
+
+// RollupRebuild asks for the report rollups of a range of days to be recomputed
+type RollupRebuild struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Currency is an ISO 4217 currency. Amounts are sent in minor units, of which there are
+// 10^exponent in a major unit.
+type Currency struct {
+	Code     string `json:"code"`
+	Exponent int    `json:"exponent"`
+	Symbol   string `json:"symbol"`
+}
+
+// CurrencyList is the supported currencies and the base currency reports are converted into
+type CurrencyList struct {
+	Base       string     `json:"base"`
+	Currencies []Currency `json:"currencies"`
+}
+
+// WidgetPrice is the price of a widget in minor units of the currency named in the URL
+type WidgetPrice struct {
+	Amount int `json:"amount"`
+}
+
+// FXRateList is the exchange rates into a base currency, newest first
+type FXRateList struct {
+	Base  string           `json:"base"`
+	Rates []*models.FXRate `json:"rates"`
+}
+
+// TaxQuoteRequest asks for the tax on a product bought by a buyer in Country and,
+// for countries that tax by state or province, Region. With a Coupon the tax is on
+// the discounted price.
+type TaxQuoteRequest struct {
+	ProductID int    `json:"product_id"`
+	Currency  string `json:"currency"`
+	Country   string `json:"country"`
+	Region    string `json:"region"`
+	TaxID     string `json:"tax_id"`
+	Coupon    string `json:"coupon"`
+	Email     string `json:"email"`
+}
+
+// TaxRuleList is every tax rule, by jurisdiction
+type TaxRuleList struct {
+	Rules []*models.TaxRule `json:"rules"`
+}
+
+// TaxExemptionList is every tax exemption, by tax ID
+type TaxExemptionList struct {
+	Exemptions []*models.TaxExemption `json:"exemptions"`
+}
+
+// CouponCheckRequest asks whether the buyer with Email can use coupon Code on a product
+type CouponCheckRequest struct {
+	Code      string `json:"code"`
+	ProductID int    `json:"product_id"`
+	Currency  string `json:"currency"`
+	Email     string `json:"email"`
+}
+
+// CouponCheck is the discount a coupon gives on the Price of a product. Duration says
+// how long it discounts a subscription.
+type CouponCheck struct {
+	Code             string `json:"code"`
+	Currency         string `json:"currency"`
+	Price            int    `json:"price"`
+	Discount         int    `json:"discount"`
+	Duration         string `json:"duration"`
+	DurationInMonths int    `json:"duration_in_months"`
+}
+
+// CouponList is every coupon, newest first
+type CouponList struct {
+	Coupons []*models.Coupon `json:"coupons"`
+}
+
+// ShippingQuoteRequest asks for the cost of shipping a product to a buyer in Country
+// and, for countries split into zones by state or province, Region
+type ShippingQuoteRequest struct {
+	ProductID int    `json:"product_id"`
+	Currency  string `json:"currency"`
+	Country   string `json:"country"`
+	Region    string `json:"region"`
+}
+
+// ShippingZoneList is every jurisdiction in a shipping zone, by zone
+type ShippingZoneList struct {
+	Zones []*models.ShippingZone `json:"zones"`
+}
+
+// ShippingRateList is every shipping rate, by zone and weight
+type ShippingRateList struct {
+	Rates []*models.ShippingRate `json:"rates"`
+}
+
+// WidgetWeight is the shipping weight of a widget in grams
+type WidgetWeight struct {
+	Weight int `json:"weight"`
+}
+
+// WidgetCaptureMethod is how a widget is charged: "automatic" at checkout, or "manual"
+// to only authorize the card at checkout and capture it later
+type WidgetCaptureMethod struct {
+	CaptureMethod string `json:"capture_method"`
+}
+
+// CaptureRequest captures Amount of the authorization of a sale and releases the rest.
+// An Amount of zero captures the whole authorization.
+type CaptureRequest struct {
+	Amount int `json:"amount"`
+}
+
+// FulfillmentRequest moves an order to the fulfillment status Status, like "shipped".
+// Orders are shipped with a Carrier and a TrackingNumber.
+type FulfillmentRequest struct {
+	Status         string `json:"status"`
+	Carrier        string `json:"carrier"`
+	TrackingNumber string `json:"tracking_number"`
+	Note           string `json:"note"`
+}
+
+// SubscriptionEventList is the timeline of a subscription, oldest first, with its open
+// dunning case while it is past due
+type SubscriptionEventList struct {
+	Events  []*models.SubscriptionEvent `json:"events"`
+	Dunning *models.DunningCase         `json:"dunning,omitempty"`
+}
+
+// CardUpdateRequest sets the card of a subscription from the signed link emailed to its
+// customer. Token is the encrypted subscription of the link; SetupIntentID is the
+// confirmed setup intent of the new card.
+type CardUpdateRequest struct {
+	Token         string `json:"token"`
+	SetupIntentID string `json:"setup_intent,omitempty"`
+}
+
+// WidgetBilling is how the plan of a widget bills: a free trial of TrialDays, with or
+// without collecting a card up front, and whether it is billed by usage
+type WidgetBilling struct {
+	TrialDays         int  `json:"trial_days"`
+	TrialRequiresCard bool `json:"trial_requires_card"`
+	Metered           bool `json:"metered"`
+}
+
+// UsageRequest reports usage of a metered subscription. Timestamp defaults to now; a
+// request repeated with the same IdempotencyKey is only counted once.
+type UsageRequest struct {
+	SubscriptionID int        `json:"subscription_id"`
+	Quantity       int        `json:"quantity"`
+	Timestamp      *time.Time `json:"timestamp,omitempty"`
+	IdempotencyKey string     `json:"idempotency_key,omitempty"`
+}
+
+// UsageSummary is a subscription and its usage in the current period. Unreported is the
+// part of Usage that has not been pushed to the gateway yet.
+type UsageSummary struct {
+	SubscriptionID int        `json:"subscription_id"`
+	Plan           string     `json:"plan"`
+	StatusID       int        `json:"status_id"`
+	Seats          int        `json:"seats"`
+	Metered        bool       `json:"metered"`
+	TrialEndsAt    *time.Time `json:"trial_ends_at,omitempty"`
+	PeriodStart    time.Time  `json:"period_start"`
+	PeriodEnd      time.Time  `json:"period_end"`
+	Usage          int        `json:"usage"`
+	Unreported     int        `json:"unreported"`
+}
+
+// PortalLinkRequest asks for the links to the portal pages of the subscriptions of a
+// customer to be emailed to them
+type PortalLinkRequest struct {
+	Email string `json:"email"`
+}
+
+// PortalRequest identifies the subscription of a portal page by the encrypted token of
+// its signed link
+type PortalRequest struct {
+	Token string `json:"token"`
+}
+
+// FulfillmentEventList is the fulfillment history of an order, oldest first
+type FulfillmentEventList struct {
+	Events []*models.FulfillmentEvent `json:"events"`
+}
+
+// ShipmentImport is the outcome of a bulk shipment upload: the number of orders shipped
+// and the rows that could not be
+type ShipmentImport struct {
+	Shipped int             `json:"shipped"`
+	Errors  []ShipmentError `json:"errors"`
+}
+
+// ShipmentError is a row of a shipment upload that was not shipped. Line counts from 1,
+// the header.
+type ShipmentError struct {
+	Line    int    `json:"line"`
+	OrderID int    `json:"order_id"`
+	Message string `json:"message"`
+}
+
+// ReturnRequest opens a return of items of a sale. Customers name the sale by OrderID
+// and prove it is theirs with the Email it was bought with; admins open returns on the
+// sale in the URL and leave both empty.
+type ReturnRequest struct {
+	OrderID int                 `json:"order_id"`
+	Email   string              `json:"email"`
+	Reason  string              `json:"reason"`
+	Items   []ReturnItemRequest `json:"items"`
+}
+
+// ReturnItemRequest is a quantity of a widget to send back. WidgetID defaults to the
+// widget of the sale.
+type ReturnItemRequest struct {
+	WidgetID int `json:"widget_id"`
+	Quantity int `json:"quantity"`
+}
+
+// ReturnList is every return of a sale, oldest first
+type ReturnList struct {
+	Returns []*models.Return `json:"returns"`
+}
+
+// ReturnStatusChange moves a return to Status: approved, rejected, received, refunded
+// or cancelled
+type ReturnStatusChange struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+}
+
+// DisputeList is a list of disputes, those that need a response first
+type DisputeList struct {
+	Disputes []*models.Dispute `json:"disputes"`
+}
+
+// DisputeEvidenceRequest is the evidence text drafted for a dispute
+type DisputeEvidenceRequest struct {
+	ProductDescription string `json:"product_description"`
+	UncategorizedText  string `json:"uncategorized_text"`
+}
+
+// DisputeFileUpload is a file to send as evidence for a dispute. Purpose is receipt,
+// shipping_documentation, customer_communication or uncategorized_file, and Content is
+// the file, base64 encoded.
+type DisputeFileUpload struct {
+	Purpose  string `json:"purpose"`
+	Filename string `json:"filename"`
+	Content  []byte `json:"content"`
+}
+
+// PayoutList is a list of payouts, the latest first
+type PayoutList struct {
+	From    string           `json:"from"`
+	To      string           `json:"to"`
+	Payouts []*models.Payout `json:"payouts"`
+}
+
+// PayoutImportRequest asks for the payouts created from From to To, both inclusive
+// dates in the format YYYY-MM-DD, to be imported from Stripe
+type PayoutImportRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// PayoutImport is what an import of payouts brought in
+type PayoutImport struct {
+	Payouts             int `json:"payouts"`
+	BalanceTransactions int `json:"balance_transactions"`
+}
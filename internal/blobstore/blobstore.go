@@ -0,0 +1,35 @@
+// Package blobstore keeps documents, like invoice PDFs, by key, on the local file system
+// or in an S3-compatible object store such as MinIO. Keys are slash separated paths like
+// "invoices/widgets/INV-000001.pdf".
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrNotFound is returned by Get for a key that holds nothing
+var ErrNotFound = errors.New("blobstore: no blob under this key")
+
+// ErrKey is returned for a key that is empty, absolute or climbs out of the store
+var ErrKey = errors.New("blobstore: invalid key")
+
+// Store keeps blobs by key. Putting a blob under a key that holds one replaces it.
+type Store interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// checkKey rejects the keys that would escape the directory or bucket of a store
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return ErrKey
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckKey(t *testing.T) {
+	for _, key := range []string{"invoices/widgets/INV-000001.pdf", "a", "a/b c.pdf"} {
+		if err := checkKey(key); err != nil {
+			t.Errorf("%q: %v", key, err)
+		}
+	}
+	for _, key := range []string{"", "/etc/passwd", "../x", "a/../../x", "a//b", "a/./b", "a\\b", "a/"} {
+		if err := checkKey(key); !errors.Is(err, ErrKey) {
+			t.Errorf("%q: got %v, want %v", key, err, ErrKey)
+		}
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "invoices")
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := s.Put(ctx, "widgets/INV-000001.pdf", "application/pdf", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, "widgets/INV-000001.pdf", "application/pdf", []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := s.Get(ctx, "widgets/INV-000001.pdf")
+	if err != nil || string(data) != "second" {
+		t.Fatalf("got %q, %v", data, err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "widgets"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temporary files were left behind: %v", entries)
+	}
+
+	if _, err := s.Get(ctx, "widgets/INV-000002.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing blob: got %v, want %v", err, ErrNotFound)
+	}
+	if err := s.Put(ctx, "../outside.pdf", "application/pdf", nil); !errors.Is(err, ErrKey) {
+		t.Errorf("key outside the store: got %v, want %v", err, ErrKey)
+	}
+	if _, err := s.Get(ctx, "/etc/passwd"); !errors.Is(err, ErrKey) {
+		t.Errorf("absolute key: got %v, want %v", err, ErrKey)
+	}
+}
@@ -0,0 +1,290 @@
+// Package dbtest is a database/sql driver for tests. A DB answers the statements a test
+// expects, in the order it expects them, and fails the test on any other statement or
+// on expected statements that never ran.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Any matches any argument, like the times statements are stamped with
+var Any = anyArg{}
+
+type anyArg struct{}
+
+// Statement is a statement a test expects. It matches a statement whose text contains
+// its fragment, compared with runs of white space collapsed.
+type Statement struct {
+	fragment string
+	args     []interface{}
+	columns  int
+	rows     [][]driver.Value
+	lastID   int64
+	affected int64
+	err      error
+
+	// Args holds the arguments the statement ran with
+	Args []interface{}
+}
+
+// WithArgs makes the statement only match when it runs with args
+func (s *Statement) WithArgs(args ...interface{}) *Statement {
+	s.args = args
+	return s
+}
+
+// Rows makes a query return rows. Every row has the same number of columns.
+func (s *Statement) Rows(rows ...[]interface{}) *Statement {
+	for _, row := range rows {
+		s.columns = len(row)
+		values := make([]driver.Value, len(row))
+		for i, v := range row {
+			values[i] = value(v)
+		}
+		s.rows = append(s.rows, values)
+	}
+	return s
+}
+
+// NoRows makes a query return no rows, so scanning a single row gives sql.ErrNoRows
+func (s *Statement) NoRows() *Statement {
+	s.columns = 1
+	s.rows = nil
+	return s
+}
+
+// Result makes an exec report the ID it inserted and the number of rows it changed
+func (s *Statement) Result(lastID, affected int64) *Statement {
+	s.lastID, s.affected = lastID, affected
+	return s
+}
+
+// Fails makes the statement return err
+func (s *Statement) Fails(err error) *Statement {
+	s.err = err
+	return s
+}
+
+// DB is a database that answers expected statements
+type DB struct {
+	// SQL is the database to hand to the code under test
+	SQL *sql.DB
+
+	// Commits and Rollbacks count the transactions committed and rolled back
+	Commits   int
+	Rollbacks int
+
+	t        testing.TB
+	mu       sync.Mutex
+	expected []*Statement
+}
+
+// New returns a database that fails t on unexpected statements. It checks that every
+// expected statement ran when the test ends.
+func New(t testing.TB) *DB {
+	db := &DB{t: t}
+	db.SQL = sql.OpenDB(connector{db})
+	t.Cleanup(func() {
+		db.SQL.Close()
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		for _, s := range db.expected {
+			t.Errorf("dbtest: expected statement did not run: %s", s.fragment)
+		}
+	})
+	return db
+}
+
+// Expect expects a statement containing fragment after the statements already expected
+func (db *DB) Expect(fragment string) *Statement {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	s := &Statement{fragment: collapse(fragment)}
+	db.expected = append(db.expected, s)
+	return s
+}
+
+// next returns the expected statement that query must be
+func (db *DB) next(query string, args []driver.NamedValue) (*Statement, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	query = collapse(query)
+	if len(db.expected) == 0 {
+		db.t.Errorf("dbtest: unexpected statement: %s", query)
+		return nil, fmt.Errorf("dbtest: unexpected statement")
+	}
+	s := db.expected[0]
+	if !strings.Contains(query, s.fragment) {
+		db.t.Errorf("dbtest: got statement %s\nwant one containing %s", query, s.fragment)
+		return nil, fmt.Errorf("dbtest: unexpected statement")
+	}
+	db.expected = db.expected[1:]
+
+	for _, a := range args {
+		s.Args = append(s.Args, a.Value)
+	}
+	if s.args != nil && !matchArgs(s.args, s.Args) {
+		db.t.Errorf("dbtest: statement %s\nran with %v, want %v", s.fragment, s.Args, s.args)
+		return nil, fmt.Errorf("dbtest: unexpected arguments")
+	}
+	return s, s.err
+}
+
+func matchArgs(want, got []interface{}) bool {
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if want[i] == Any {
+			continue
+		}
+		if !reflect.DeepEqual(value(want[i]), got[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// value converts v the way database/sql converts arguments
+func value(v interface{}) driver.Value {
+	if v == nil {
+		return nil
+	}
+	if valuer, ok := v.(driver.Valuer); ok {
+		dv, _ := valuer.Value()
+		return dv
+	}
+	dv, err := driver.DefaultParameterConverter.ConvertValue(v)
+	if err != nil {
+		return v
+	}
+	return dv
+}
+
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+type connector struct{ db *DB }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return &conn{db: c.db}, nil }
+func (c connector) Driver() driver.Driver                        { return drv{} }
+
+type drv struct{}
+
+func (drv) Open(string) (driver.Conn, error) { return nil, fmt.Errorf("dbtest: use dbtest.New") }
+
+type conn struct{ db *DB }
+
+// Prepare returns a statement that is matched against the expected statements every
+// time it runs
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+func (c *conn) Close() error { return nil }
+
+func (c *conn) Begin() (driver.Tx, error) { return tx{c.db}, nil }
+
+func (c *conn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) { return tx{c.db}, nil }
+
+func (c *conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	s, err := c.db.next(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{columns: s.columns, values: s.rows}, nil
+}
+
+func (c *conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	s, err := c.db.next(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return result{s.lastID, s.affected}, nil
+}
+
+// CheckNamedValue accepts the arguments the default converter accepts as they are, so
+// tests see the values the code passed
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	nv.Value = value(nv.Value)
+	return nil
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Close() error  { return nil }
+func (s *stmt) NumInput() int { return -1 }
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, fmt.Errorf("dbtest: use ExecContext")
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, fmt.Errorf("dbtest: use QueryContext")
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+type tx struct{ db *DB }
+
+func (t tx) Commit() error {
+	t.db.mu.Lock()
+	t.db.Commits++
+	t.db.mu.Unlock()
+	return nil
+}
+
+func (t tx) Rollback() error {
+	t.db.mu.Lock()
+	t.db.Rollbacks++
+	t.db.mu.Unlock()
+	return nil
+}
+
+type result struct{ lastID, affected int64 }
+
+func (r result) LastInsertId() (int64, error) { return r.lastID, nil }
+func (r result) RowsAffected() (int64, error) { return r.affected, nil }
+
+type rows struct {
+	columns int
+	values  [][]driver.Value
+}
+
+func (r *rows) Columns() []string {
+	cols := make([]string, r.columns)
+	for i := range cols {
+		cols[i] = fmt.Sprintf("c%d", i)
+	}
+	return cols
+}
+
+func (r *rows) Close() error { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
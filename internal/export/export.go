@@ -0,0 +1,46 @@
+// Package export writes tabular data as CSV or XLSX, one row at a time, so large
+// exports can be streamed to the client without being held in memory.
+package export
+
+import (
+	"errors"
+	"io"
+)
+
+const (
+	CSV  = "csv"
+	XLSX = "xlsx"
+)
+
+// ErrUnknownFormat is returned by New for formats other than CSV and XLSX
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Writer writes rows of a table. Cells may be strings, integers, floats or time.Time
+// values; anything else is written with fmt.Sprint.
+type Writer interface {
+	Write(row []interface{}) error
+	// Close flushes buffered rows and finishes the file. It does not close the underlying writer.
+	Close() error
+}
+
+// New returns a Writer for format that writes to w. sheet names the XLSX worksheet.
+func New(format string, w io.Writer, sheet string) (Writer, error) {
+	switch format {
+	case CSV:
+		return NewCSV(w), nil
+	case XLSX:
+		return NewXLSX(w, sheet)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// ContentType returns the MIME type of format
+func ContentType(format string) string {
+	switch format {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case XLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,126 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSV(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := New(CSV, &buf, "Sales")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := [][]interface{}{
+		{"ID", "Customer", "Amount", "Date"},
+		{1, "Ada, Countess", int64(1250), time.Date(2026, 10, 19, 8, 30, 0, 0, time.UTC)},
+		{2, "=HYPERLINK(\"x\")", 0.5, time.Time{}},
+		{3, nil, "-", true},
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "ID,Customer,Amount,Date\n" +
+		"1,\"Ada, Countess\",1250,2026-10-19 08:30:00\n" +
+		"2,\"'=HYPERLINK(\"\"x\"\")\",0.5,\n" +
+		"3,,'-,true\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestEscapeFormula(t *testing.T) {
+	tests := map[string]string{
+		"":       "",
+		"plain":  "plain",
+		"=1+1":   "'=1+1",
+		"+1":     "'+1",
+		"-1":     "'-1",
+		"@SUM":   "'@SUM",
+		"\tcell": "'\tcell",
+		"a=b":    "a=b",
+	}
+	for in, want := range tests {
+		if got := escapeFormula(in); got != want {
+			t.Errorf("escapeFormula(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := New(XLSX, &buf, "Sales & Refunds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]interface{}{"Customer", "Amount", "Date"})
+	w.Write([]interface{}{"<Ada>", 1250, time.Date(1900, 1, 1, 12, 0, 0, 0, time.UTC)})
+	w.Write([]interface{}{"Bob", 0.25, time.Time{}})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string]string{}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(body)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/_rels/workbook.xml.rels", "xl/styles.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("missing part %s", name)
+		}
+	}
+	if !strings.Contains(parts["xl/workbook.xml"], `<sheet name="Sales &amp; Refunds"`) {
+		t.Errorf("sheet name not escaped: %s", parts["xl/workbook.xml"])
+	}
+
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<t xml:space="preserve">&lt;Ada&gt;</t>`,
+		`<c><v>1250</v></c>`,
+		`<c s="1"><v>2.5</v></c>`,
+		`<c><v>0.25</v></c><c/></row>`,
+		`</sheetData></worksheet>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet does not contain %s:\n%s", want, sheet)
+		}
+	}
+	if n := strings.Count(sheet, "<row>"); n != 3 {
+		t.Errorf("got %d rows, want 3", n)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := New("pdf", io.Discard, ""); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("got %v", err)
+	}
+	if got := ContentType("pdf"); got != "application/octet-stream" {
+		t.Errorf("got %s", got)
+	}
+	if got := ContentType(CSV); got != "text/csv; charset=utf-8" {
+		t.Errorf("got %s", got)
+	}
+}
@@ -0,0 +1,110 @@
+package invoicepdf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go-commerce/internal/money"
+)
+
+// Brand is the look of the documents of a brand, and the seller they are issued by.
+// Logo is a PNG or JPEG drawn in the top left corner and Template a PDF whose first
+// page is drawn under every page, like a letterhead; both are optional. Color, like
+// "#2c3e50", colors the title and the header of the items table. Amounts are formatted
+// for Locale.
+type Brand struct {
+	Name     string `json:"name"`
+	Seller   Party  `json:"seller"`
+	Color    string `json:"color"`
+	Logo     string `json:"logo"`
+	Template string `json:"template"`
+	Footer   string `json:"footer"`
+	PageSize string `json:"page_size"`
+	Font     string `json:"font"`
+	Locale   string `json:"locale"`
+}
+
+// DefaultBrand is used for the documents of brands that have no brand file
+var DefaultBrand = Brand{
+	Name:     "default",
+	Seller:   Party{Name: "Widgets Co."},
+	Color:    "#2c3e50",
+	Footer:   "Thank you for your business.",
+	PageSize: "Letter",
+	Font:     "Helvetica",
+	Locale:   money.DefaultLocale,
+}
+
+// LoadBrands reads the brands of a directory, one JSON file per brand, keyed by their
+// name, which defaults to the name of their file. The paths of logos and templates are
+// relative to the directory. A directory that does not exist holds no brands.
+func LoadBrands(dir string) (map[string]Brand, error) {
+	brands := make(map[string]Brand)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		brand := DefaultBrand
+		brand.Name = strings.TrimSuffix(filepath.Base(file), ".json")
+		brand.Seller = Party{}
+		if err := json.Unmarshal(b, &brand); err != nil {
+			return nil, fmt.Errorf("brand %s: %w", file, err)
+		}
+		for _, path := range []*string{&brand.Logo, &brand.Template} {
+			if *path != "" && !filepath.IsAbs(*path) {
+				*path = filepath.Join(dir, *path)
+			}
+		}
+		if err := brand.validate(); err != nil {
+			return nil, fmt.Errorf("brand %s: %w", file, err)
+		}
+		brands[brand.Name] = brand
+	}
+	return brands, nil
+}
+
+// validate checks the settings of a brand and that its files exist
+func (b Brand) validate() error {
+	if _, _, _, err := parseColor(b.Color); err != nil {
+		return err
+	}
+	switch b.PageSize {
+	case "Letter", "A4":
+	default:
+		return fmt.Errorf("page size %q is not Letter or A4", b.PageSize)
+	}
+	switch b.Font {
+	case "Helvetica", "Times", "Courier":
+	default:
+		return fmt.Errorf("font %q is not Helvetica, Times or Courier", b.Font)
+	}
+	for _, path := range []string{b.Logo, b.Template} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseColor parses a color like "#2c3e50"
+func parseColor(s string) (r, g, b int, err error) {
+	n, err := strconv.ParseUint(strings.TrimPrefix(s, "#"), 16, 32)
+	if err != nil || len(s) != 7 || s[0] != '#' {
+		return 0, 0, 0, fmt.Errorf("color %q is not like #2c3e50", s)
+	}
+	return int(n >> 16), int(n >> 8 & 0xff), int(n & 0xff), nil
+}
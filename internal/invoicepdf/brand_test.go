@@ -0,0 +1,82 @@
+package invoicepdf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadBrands(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "logo.png"), "not really a png")
+	writeFile(t, filepath.Join(dir, "widgets.json"), `{"seller": {"name": "Widgets GmbH"}, "logo": "logo.png", "page_size": "A4", "locale": "de-DE"}`)
+	writeFile(t, filepath.Join(dir, "other.json"), `{"name": "gadgets", "color": "#ff0000"}`)
+	writeFile(t, filepath.Join(dir, "notes.txt"), "not a brand")
+
+	brands, err := LoadBrands(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(brands) != 2 {
+		t.Fatalf("got brands %v", brands)
+	}
+
+	b := brands["widgets"]
+	if b.Seller.Name != "Widgets GmbH" || b.PageSize != "A4" || b.Locale != "de-DE" {
+		t.Errorf("widgets: got %+v", b)
+	}
+	if b.Logo != filepath.Join(dir, "logo.png") {
+		t.Errorf("logo is not relative to the directory: %s", b.Logo)
+	}
+	if b.Color != DefaultBrand.Color || b.Font != DefaultBrand.Font || b.Footer != DefaultBrand.Footer {
+		t.Errorf("widgets does not default to the default brand: %+v", b)
+	}
+
+	g := brands["gadgets"]
+	if g.Color != "#ff0000" || g.Seller.Name != "" {
+		t.Errorf("gadgets: got %+v", g)
+	}
+}
+
+func TestLoadBrandsMissingDirectory(t *testing.T) {
+	brands, err := LoadBrands(filepath.Join(t.TempDir(), "none"))
+	if err != nil || len(brands) != 0 {
+		t.Errorf("got %v, %v", brands, err)
+	}
+}
+
+func TestLoadBrandsRejects(t *testing.T) {
+	tests := map[string]string{
+		"invalid json": `{"name": `,
+		"color":        `{"color": "red"}`,
+		"page size":    `{"page_size": "A5"}`,
+		"font":         `{"font": "Comic Sans"}`,
+		"missing logo": `{"logo": "missing.png"}`,
+	}
+	for name, content := range tests {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "brand.json"), content)
+		if _, err := LoadBrands(dir); err == nil {
+			t.Errorf("%s: brand accepted", name)
+		}
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	r, g, b, err := parseColor("#2c3e50")
+	if err != nil || r != 0x2c || g != 0x3e || b != 0x50 {
+		t.Errorf("got %d %d %d, %v", r, g, b, err)
+	}
+	for _, s := range []string{"2c3e50", "#2c3e5", "#2c3e500", "#zzzzzz"} {
+		if _, _, _, err := parseColor(s); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+}
@@ -0,0 +1,467 @@
+// Package invoicepdf lays out invoices as PDF documents: the seller and the buyer, any
+// number of line items over as many pages as they take, discounts, tax, shipping and
+// the total in the currency of the sale, stamped with the state of the payment. The
+// look of a document comes from the Brand it is rendered for. Amounts are in minor
+// units of the currency.
+package invoicepdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-commerce/internal/money"
+	"go-commerce/internal/tax"
+
+	"github.com/phpdave11/gofpdf"
+	"github.com/phpdave11/gofpdf/contrib/gofpdi"
+)
+
+// Payment statuses stamped on documents
+const (
+	StatusPaid     = "paid"
+	StatusPending  = "pending"
+	StatusRefunded = "refunded"
+)
+
+// Party is the seller or the buyer of a document
+type Party struct {
+	Name    string   `json:"name"`
+	Address []string `json:"address"`
+	TaxID   string   `json:"tax_id"`
+	Email   string   `json:"email"`
+}
+
+// Item is a line of a document. Amount is the price of the item times its quantity,
+// as shown to the buyer, before discounts.
+type Item struct {
+	Description string `json:"description"`
+	Quantity    int    `json:"quantity"`
+	UnitAmount  int    `json:"unit_amount"`
+	Amount      int    `json:"amount"`
+}
+
+// Adjustment is an amount added to or taken off the items, like a discount or shipping
+type Adjustment struct {
+	Label  string `json:"label"`
+	Amount int    `json:"amount"`
+}
+
+// Document is an invoice to render. Discounts are taken off the items to make the
+// subtotal, on which TaxLines were worked out; inclusive taxes are part of the subtotal
+// and only shown, exclusive taxes and Shipping are added to it to make the total.
+// Reference names what the document is about, like an order. Status, one of the
+// Status constants, is stamped on the first page when set.
+type Document struct {
+	Title     string
+	Number    string
+	Reference string
+	IssuedAt  time.Time
+	Currency  string
+	Seller    Party
+	Buyer     Party
+	ShipTo    []string
+	Items     []Item
+	Discounts []Adjustment
+	TaxLines  []tax.Line
+	Shipping  *Adjustment
+	Status    string
+	Notes     []string
+}
+
+// Subtotal returns the amount of the items less the discounts
+func (d Document) Subtotal() int {
+	var n int
+	for _, it := range d.Items {
+		n += it.Amount
+	}
+	for _, a := range d.Discounts {
+		n -= a.Amount
+	}
+	return n
+}
+
+// Total returns what the buyer pays: the subtotal, the exclusive taxes and shipping
+func (d Document) Total() int {
+	n := d.Subtotal()
+	for _, l := range d.TaxLines {
+		if !l.Inclusive {
+			n += l.Amount
+		}
+	}
+	if d.Shipping != nil {
+		n += d.Shipping.Amount
+	}
+	return n
+}
+
+// layout, in millimetres
+const (
+	margin    = 15.0
+	bottom    = 22.0
+	lineH     = 5.0
+	rowH      = 6.0
+	qtyW      = 18.0
+	unitW     = 32.0
+	amountW   = 32.0
+	totalsW   = 70.0
+	cellInset = 1.5
+)
+
+// renderer holds the state of a document being rendered
+type renderer struct {
+	pdf    *gofpdf.Fpdf
+	doc    Document
+	brand  Brand
+	tr     func(string) string
+	width  float64
+	height float64
+	color  [3]int
+}
+
+// Render lays out a document for a brand and returns the PDF
+func Render(doc Document, brand Brand) (out []byte, err error) {
+	if doc.Title == "" {
+		doc.Title = "Invoice"
+	}
+	if doc.Seller.Name == "" {
+		doc.Seller = brand.Seller
+	}
+	if err := brand.validate(); err != nil {
+		return nil, err
+	}
+	r, g, b, _ := parseColor(brand.Color)
+
+	pdf := gofpdf.New("P", "mm", brand.PageSize, "")
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(false, bottom)
+	pdf.AliasNbPages("")
+	pdf.SetTitle(doc.Title+" "+doc.Number, true)
+	pdf.SetAuthor(doc.Seller.Name, true)
+
+	rd := &renderer{pdf: pdf, doc: doc, brand: brand, tr: pdf.UnicodeTranslatorFromDescriptor(""), color: [3]int{r, g, b}}
+	rd.width, rd.height = pdf.GetPageSize()
+
+	// the importer panics on a template it cannot read
+	defer func() {
+		if p := recover(); p != nil {
+			out, err = nil, fmt.Errorf("invoicepdf: template %s: %v", brand.Template, p)
+		}
+	}()
+	if brand.Template != "" {
+		importer := gofpdi.NewImporter()
+		tpl := importer.ImportPage(pdf, brand.Template, 1, "/MediaBox")
+		pdf.SetHeaderFunc(func() {
+			importer.UseImportedTemplate(pdf, tpl, 0, 0, rd.width, 0)
+		})
+	}
+	pdf.SetFooterFunc(rd.footer)
+
+	pdf.AddPage()
+	rd.header()
+	rd.stamp()
+	rd.parties()
+	rd.items()
+	rd.totals()
+	rd.notes()
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// money formats an amount in the currency of the document
+func (rd *renderer) money(amount int) string {
+	// the core PDF fonts cannot draw most currency symbols, so amounts carry the ISO code
+	return rd.tr(money.New(int64(amount), rd.doc.Currency).FormatCode(rd.brand.Locale))
+}
+
+// font sets the font of the brand in a style and size
+func (rd *renderer) font(style string, size float64) {
+	rd.pdf.SetFont(rd.brand.Font, style, size)
+}
+
+// text writes a line of text in a cell of width w
+func (rd *renderer) text(w float64, s, align string) {
+	rd.pdf.CellFormat(w, lineH, rd.tr(s), "", 2, align, false, 0, "")
+}
+
+// split translates text for the core fonts and wraps it into lines of width w
+func (rd *renderer) split(s string, w float64) []string {
+	var lines []string
+	for _, l := range rd.pdf.SplitLines([]byte(rd.tr(s)), w) {
+		lines = append(lines, string(l))
+	}
+	return lines
+}
+
+// contentWidth is the width between the margins
+func (rd *renderer) contentWidth() float64 {
+	return rd.width - 2*margin
+}
+
+// header draws the logo, the title, number and dates of the first page
+func (rd *renderer) header() {
+	pdf := rd.pdf
+	top := margin
+	if rd.brand.Logo != "" {
+		pdf.ImageOptions(rd.brand.Logo, margin, top, 0, 16, false, gofpdf.ImageOptions{ReadDpi: true}, 0, "")
+	}
+
+	right := rd.width - margin - 80
+	pdf.SetXY(right, top)
+	pdf.SetTextColor(rd.color[0], rd.color[1], rd.color[2])
+	rd.font("B", 20)
+	pdf.CellFormat(80, 9, rd.tr(strings.ToUpper(rd.doc.Title)), "", 2, "R", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+	rd.font("", 10)
+	pdf.SetX(right)
+	rd.text(80, "No. "+rd.doc.Number, "R")
+	pdf.SetX(right)
+	rd.text(80, "Date "+rd.doc.IssuedAt.Format("2006-01-02"), "R")
+	if rd.doc.Reference != "" {
+		pdf.SetX(right)
+		rd.text(80, rd.doc.Reference, "R")
+	}
+	pdf.SetY(top + 30)
+}
+
+// stamp stamps the payment status across the top of the first page
+func (rd *renderer) stamp() {
+	var label string
+	var r, g, b int
+	switch rd.doc.Status {
+	case StatusPaid:
+		label, r, g, b = "PAID", 39, 174, 96
+	case StatusPending:
+		label, r, g, b = "PAYMENT PENDING", 230, 126, 34
+	case StatusRefunded:
+		label, r, g, b = "REFUNDED", 192, 57, 43
+	default:
+		return
+	}
+
+	pdf := rd.pdf
+	x, y := pdf.GetXY()
+	rd.font("B", 22)
+	w := pdf.GetStringWidth(label) + 8
+	cx, cy := rd.width/2, margin+14
+
+	pdf.SetAlpha(0.45, "Normal")
+	pdf.TransformBegin()
+	pdf.TransformRotate(12, cx, cy)
+	pdf.SetDrawColor(r, g, b)
+	pdf.SetTextColor(r, g, b)
+	pdf.SetLineWidth(1)
+	pdf.SetXY(cx-w/2, cy-6)
+	pdf.CellFormat(w, 12, label, "1", 0, "C", false, 0, "")
+	pdf.TransformEnd()
+	pdf.SetAlpha(1, "Normal")
+
+	pdf.SetLineWidth(0.2)
+	pdf.SetDrawColor(0, 0, 0)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetXY(x, y)
+}
+
+// parties draws the seller, the buyer and the address the order ships to side by side
+func (rd *renderer) parties() {
+	pdf := rd.pdf
+	colW := rd.contentWidth() / 3
+	top := pdf.GetY()
+
+	var blocks [][]string
+	blocks = append(blocks, append([]string{"From", rd.doc.Seller.Name}, partyLines(rd.doc.Seller)...))
+	blocks = append(blocks, append([]string{"Bill to", rd.doc.Buyer.Name}, partyLines(rd.doc.Buyer)...))
+	if len(rd.doc.ShipTo) > 0 {
+		blocks = append(blocks, append([]string{"Ship to", rd.doc.Buyer.Name}, rd.doc.ShipTo...))
+	}
+
+	lowest := top
+	for i, lines := range blocks {
+		pdf.SetXY(margin+float64(i)*colW, top)
+		for j, l := range lines {
+			switch j {
+			case 0:
+				rd.font("B", 9)
+				pdf.SetTextColor(rd.color[0], rd.color[1], rd.color[2])
+			case 1:
+				rd.font("B", 10)
+				pdf.SetTextColor(0, 0, 0)
+			default:
+				rd.font("", 10)
+			}
+			pdf.SetX(margin + float64(i)*colW)
+			for _, part := range rd.split(l, colW-4) {
+				pdf.CellFormat(colW-4, lineH, part, "", 2, "L", false, 0, "")
+			}
+		}
+		if y := pdf.GetY(); y > lowest {
+			lowest = y
+		}
+	}
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetY(lowest + 8)
+}
+
+// partyLines lists the address, tax ID and email of a party
+func partyLines(p Party) []string {
+	lines := append([]string{}, p.Address...)
+	if p.TaxID != "" {
+		lines = append(lines, "Tax ID "+p.TaxID)
+	}
+	if p.Email != "" {
+		lines = append(lines, p.Email)
+	}
+	return lines
+}
+
+// descriptionWidth is the width of the description column of the items table
+func (rd *renderer) descriptionWidth() float64 {
+	return rd.contentWidth() - qtyW - unitW - amountW
+}
+
+// tableHeader draws the header of the items table
+func (rd *renderer) tableHeader() {
+	pdf := rd.pdf
+	pdf.SetFillColor(rd.color[0], rd.color[1], rd.color[2])
+	pdf.SetTextColor(255, 255, 255)
+	rd.font("B", 10)
+	pdf.SetX(margin)
+	pdf.CellFormat(rd.descriptionWidth(), rowH+1, "Description", "", 0, "L", true, 0, "")
+	pdf.CellFormat(qtyW, rowH+1, "Qty", "", 0, "R", true, 0, "")
+	pdf.CellFormat(unitW, rowH+1, "Unit price", "", 0, "R", true, 0, "")
+	pdf.CellFormat(amountW, rowH+1, "Amount", "", 1, "R", true, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+	rd.font("", 10)
+}
+
+// ensureSpace moves on to a new page, continuing the items table when asked, unless h
+// millimetres fit above the footer
+func (rd *renderer) ensureSpace(h float64, table bool) {
+	if rd.pdf.GetY()+h <= rd.height-bottom {
+		return
+	}
+	rd.pdf.AddPage()
+	rd.font("B", 10)
+	rd.pdf.SetX(margin)
+	rd.text(rd.contentWidth(), fmt.Sprintf("%s %s (continued)", rd.doc.Title, rd.doc.Number), "L")
+	rd.pdf.Ln(2)
+	if table {
+		rd.tableHeader()
+	}
+	rd.font("", 10)
+}
+
+// items draws the items table, over as many pages as it takes. Long descriptions wrap.
+func (rd *renderer) items() {
+	pdf := rd.pdf
+	rd.ensureSpace(2*rowH+1, false)
+	rd.tableHeader()
+
+	descW := rd.descriptionWidth()
+	for i, it := range rd.doc.Items {
+		lines := rd.split(it.Description, descW-2*cellInset)
+		if len(lines) == 0 {
+			lines = []string{""}
+		}
+		h := float64(len(lines)) * lineH
+		if h < rowH {
+			h = rowH
+		}
+		rd.ensureSpace(h, true)
+
+		if i%2 == 1 {
+			pdf.SetFillColor(245, 245, 245)
+			pdf.Rect(margin, pdf.GetY(), rd.contentWidth(), h, "F")
+		}
+		y := pdf.GetY()
+		for j, l := range lines {
+			pdf.SetXY(margin, y+float64(j)*lineH+(rowH-lineH)/2)
+			pdf.CellFormat(descW, lineH, l, "", 0, "L", false, 0, "")
+		}
+		pdf.SetXY(margin+descW, y)
+		pdf.CellFormat(qtyW, rowH, fmt.Sprintf("%d", it.Quantity), "", 0, "R", false, 0, "")
+		pdf.CellFormat(unitW, rowH, rd.money(it.UnitAmount), "", 0, "R", false, 0, "")
+		pdf.CellFormat(amountW, rowH, rd.money(it.Amount), "", 0, "R", false, 0, "")
+		pdf.SetXY(margin, y+h)
+	}
+	pdf.Line(margin, pdf.GetY(), rd.width-margin, pdf.GetY())
+	pdf.Ln(2)
+}
+
+// totalLine is a line of the totals block
+type totalLine struct {
+	label  string
+	amount int
+	bold   bool
+}
+
+// totals draws the discounts, subtotal, taxes, shipping and total, kept together on
+// one page
+func (rd *renderer) totals() {
+	var lines []totalLine
+	for _, d := range rd.doc.Discounts {
+		lines = append(lines, totalLine{label: d.Label, amount: -d.Amount})
+	}
+	lines = append(lines, totalLine{label: "Subtotal", amount: rd.doc.Subtotal()})
+	for _, l := range rd.doc.TaxLines {
+		label := fmt.Sprintf("%s %s%%", l.Name, l.Rate)
+		if l.Inclusive {
+			label += " (included)"
+		}
+		lines = append(lines, totalLine{label: label, amount: l.Amount})
+	}
+	if rd.doc.Shipping != nil {
+		lines = append(lines, totalLine{label: rd.doc.Shipping.Label, amount: rd.doc.Shipping.Amount})
+	}
+	lines = append(lines, totalLine{label: "Total", amount: rd.doc.Total(), bold: true})
+
+	rd.ensureSpace(float64(len(lines))*rowH+2, false)
+	pdf := rd.pdf
+	x := rd.width - margin - totalsW - amountW
+	for _, l := range lines {
+		style := ""
+		if l.bold {
+			style = "B"
+			pdf.Line(x, pdf.GetY(), rd.width-margin, pdf.GetY())
+		}
+		rd.font(style, 10)
+		pdf.SetX(x)
+		pdf.CellFormat(totalsW, rowH, rd.tr(l.label), "", 0, "R", false, 0, "")
+		pdf.CellFormat(amountW, rowH, rd.money(l.amount), "", 1, "R", false, 0, "")
+	}
+	rd.font("", 10)
+	pdf.Ln(4)
+}
+
+// notes writes the notes of the document under the totals
+func (rd *renderer) notes() {
+	rd.font("", 9)
+	for _, n := range rd.doc.Notes {
+		lines := rd.split(n, rd.contentWidth())
+		rd.ensureSpace(float64(len(lines))*lineH, false)
+		for _, l := range lines {
+			rd.pdf.SetX(margin)
+			rd.pdf.CellFormat(rd.contentWidth(), lineH, l, "", 2, "L", false, 0, "")
+		}
+	}
+}
+
+// footer writes the footer of the brand and the page number on every page
+func (rd *renderer) footer() {
+	pdf := rd.pdf
+	pdf.SetY(rd.height - bottom + 6)
+	rd.font("", 8)
+	pdf.SetTextColor(120, 120, 120)
+	if rd.brand.Footer != "" {
+		pdf.SetX(margin)
+		rd.text(rd.contentWidth(), rd.brand.Footer, "C")
+	}
+	pdf.SetX(margin)
+	rd.text(rd.contentWidth(), fmt.Sprintf("%s %s - page %d of {nb}", rd.doc.Title, rd.doc.Number, pdf.PageNo()), "C")
+	pdf.SetTextColor(0, 0, 0)
+}
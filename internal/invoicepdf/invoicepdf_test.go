@@ -0,0 +1,96 @@
+package invoicepdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"go-commerce/internal/tax"
+)
+
+var pageRX = regexp.MustCompile(`/Type /Page\b[^s]`)
+
+func testDocument(items int) Document {
+	doc := Document{
+		Number:    "INV-000042",
+		Reference: "Order 17",
+		IssuedAt:  time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		Currency:  "eur",
+		Buyer: Party{
+			Name:    "Jörg Müller",
+			Address: []string{"Hauptstraße 1", "10115 Berlin", "DE"},
+			Email:   "jorg@example.com",
+			TaxID:   "DE123456789",
+		},
+		ShipTo:    []string{"Marienplatz 2", "80331 München", "DE"},
+		Discounts: []Adjustment{{Label: "Coupon SAVE10", Amount: 1000}},
+		TaxLines: []tax.Line{
+			{Name: "VAT", Rate: "19", Inclusive: true, Amount: 1900},
+			{Name: "Levy", Rate: "1", Amount: 100},
+		},
+		Shipping: &Adjustment{Label: "Shipping (Ground)", Amount: 495},
+		Status:   StatusPaid,
+		Notes:    []string{"Paid by card ending in 4242."},
+	}
+	for i := 0; i < items; i++ {
+		doc.Items = append(doc.Items, Item{
+			Description: fmt.Sprintf("Widget %d with a description long enough to wrap onto a second line of the table", i),
+			Quantity:    2,
+			UnitAmount:  5500,
+			Amount:      11000,
+		})
+	}
+	return doc
+}
+
+func TestTotals(t *testing.T) {
+	doc := testDocument(1)
+	if got := doc.Subtotal(); got != 10000 {
+		t.Errorf("subtotal: got %d, want 10000", got)
+	}
+	// the inclusive VAT is part of the subtotal; the levy and shipping are added
+	if got := doc.Total(); got != 10595 {
+		t.Errorf("total: got %d, want 10595", got)
+	}
+
+	doc.Shipping = nil
+	doc.TaxLines = nil
+	if got := doc.Total(); got != 10000 {
+		t.Errorf("total without tax and shipping: got %d, want 10000", got)
+	}
+}
+
+func TestRender(t *testing.T) {
+	out, err := Render(testDocument(1), DefaultBrand)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(out, []byte("%PDF-")) {
+		t.Fatalf("not a PDF: %q", out[:16])
+	}
+	if n := len(pageRX.FindAll(out, -1)); n != 1 {
+		t.Errorf("one item takes %d pages", n)
+	}
+}
+
+func TestRenderManyItemsOverPages(t *testing.T) {
+	brand := DefaultBrand
+	brand.PageSize = "A4"
+	out, err := Render(testDocument(80), brand)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(pageRX.FindAll(out, -1)); n < 3 {
+		t.Errorf("80 items take %d pages", n)
+	}
+}
+
+func TestRenderMissingTemplate(t *testing.T) {
+	brand := DefaultBrand
+	brand.Template = "/nonexistent/letterhead.pdf"
+	if _, err := Render(testDocument(1), brand); err == nil {
+		t.Error("rendered with a template that does not exist")
+	}
+}
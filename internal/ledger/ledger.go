@@ -0,0 +1,195 @@
+// Package ledger holds the chart of accounts of the double-entry ledger and the rules
+// for posting money movements to it. Every journal entry debits and credits the same
+// total in a single currency; amounts are in the minor unit of that currency.
+//
+// Charges are taken into cash in transit, the money held by the gateway, and paid out
+// from it into the bank. Revenue is what the customer paid less the tax collected on
+// it, which is owed to the tax authorities until it is filed.
+package ledger
+
+import (
+	"errors"
+	"time"
+)
+
+// Account codes
+const (
+	CashInTransit = "cash_in_transit"
+	Bank          = "bank"
+	Revenue       = "revenue"
+	TaxPayable    = "tax_payable"
+	Refunds       = "refunds"
+	Fees          = "fees"
+	Disputes      = "disputes"
+)
+
+// Account types
+const (
+	Asset     = "asset"
+	Liability = "liability"
+	Income    = "income"
+	Expense   = "expense"
+)
+
+// Account is an account of the ledger
+type Account struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Accounts is the chart of accounts
+var Accounts = []Account{
+	{CashInTransit, "Cash in transit", Asset},
+	{Bank, "Bank", Asset},
+	{Revenue, "Revenue", Income},
+	{TaxPayable, "Tax payable", Liability},
+	{Refunds, "Refunds", Expense},
+	{Fees, "Payment fees", Expense},
+	{Disputes, "Disputes", Expense},
+}
+
+// DebitNormal reports whether accounts of a type are increased by debits. Their balance
+// is their debits less their credits; the balance of the other accounts is their
+// credits less their debits.
+func DebitNormal(accountType string) bool {
+	return accountType == Asset || accountType == Expense
+}
+
+// Entry kinds
+const (
+	KindCharge         = "charge"
+	KindRefund         = "refund"
+	KindFee            = "fee"
+	KindDispute        = "dispute"
+	KindDisputeWon     = "dispute_won"
+	KindPayout         = "payout"
+	KindPayoutReversal = "payout_reversal"
+)
+
+var (
+	// ErrUnbalanced is returned for an entry whose debits and credits differ
+	ErrUnbalanced = errors.New("ledger: debits and credits of the entry differ")
+	// ErrEmptyEntry is returned for an entry without two lines of money
+	ErrEmptyEntry = errors.New("ledger: the entry moves no money")
+	// ErrLine is returned for a line that is not a positive debit or credit of a known account
+	ErrLine = errors.New("ledger: each line must debit or credit a positive amount to a known account")
+)
+
+// Line debits or credits an account
+type Line struct {
+	Account string `json:"account"`
+	Debit   int    `json:"debit"`
+	Credit  int    `json:"credit"`
+}
+
+// Entry is a journal entry. Reference identifies the money movement it records, so that
+// a movement is only ever posted once. Entries are never changed once posted; mistakes
+// are corrected by posting another entry.
+type Entry struct {
+	Reference     string    `json:"reference"`
+	Kind          string    `json:"kind"`
+	Currency      string    `json:"currency"`
+	Memo          string    `json:"memo"`
+	TransactionID int       `json:"transaction_id"`
+	OrderID       int       `json:"order_id"`
+	DisputeID     int       `json:"dispute_id"`
+	PayoutID      int       `json:"payout_id"`
+	OccurredAt    time.Time `json:"occurred_at"`
+	Lines         []Line    `json:"lines"`
+}
+
+// Validate checks that an entry moves money between known accounts and balances
+func (e Entry) Validate() error {
+	if len(e.Lines) < 2 {
+		return ErrEmptyEntry
+	}
+	var debits, credits int
+	for _, l := range e.Lines {
+		if !known(l.Account) || l.Debit < 0 || l.Credit < 0 || (l.Debit == 0) == (l.Credit == 0) {
+			return ErrLine
+		}
+		debits += l.Debit
+		credits += l.Credit
+	}
+	if debits != credits {
+		return ErrUnbalanced
+	}
+	return nil
+}
+
+func known(code string) bool {
+	for _, a := range Accounts {
+		if a.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// lines drops the lines of nothing, so that an entry only lists the accounts it moves
+func lines(ls ...Line) []Line {
+	var out []Line
+	for _, l := range ls {
+		if l.Debit != 0 || l.Credit != 0 {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// Charge takes in amount, of which tax is owed to the tax authorities
+func Charge(amount, tax int) []Line {
+	return lines(
+		Line{Account: CashInTransit, Debit: amount},
+		Line{Account: Revenue, Credit: amount - tax},
+		Line{Account: TaxPayable, Credit: tax},
+	)
+}
+
+// Refund gives back amount, of which tax is no longer owed
+func Refund(amount, tax int) []Line {
+	return lines(
+		Line{Account: Refunds, Debit: amount - tax},
+		Line{Account: TaxPayable, Debit: tax},
+		Line{Account: CashInTransit, Credit: amount},
+	)
+}
+
+// RefundTax returns the part of the tax on a charge of amount that a refund gives back,
+// in proportion to the part of the charge refunded
+func RefundTax(refunded, amount, tax int) int {
+	if amount == 0 {
+		return 0
+	}
+	return int(int64(tax) * int64(refunded) / int64(amount))
+}
+
+// Fee pays a gateway fee out of cash in transit. A negative fee is a fee given back.
+func Fee(fee int) []Line {
+	if fee < 0 {
+		return lines(Line{Account: CashInTransit, Debit: -fee}, Line{Account: Fees, Credit: -fee})
+	}
+	return lines(Line{Account: Fees, Debit: fee}, Line{Account: CashInTransit, Credit: fee})
+}
+
+// DisputeOpened takes a disputed amount out of cash in transit, as the card issuer does
+// when it opens a chargeback
+func DisputeOpened(amount int) []Line {
+	return lines(Line{Account: Disputes, Debit: amount}, Line{Account: CashInTransit, Credit: amount})
+}
+
+// DisputeWon puts back the amount of a dispute decided in our favour
+func DisputeWon(amount int) []Line {
+	return lines(Line{Account: CashInTransit, Debit: amount}, Line{Account: Disputes, Credit: amount})
+}
+
+// Payout moves a payout from cash in transit into the bank
+func Payout(amount int) []Line {
+	return lines(Line{Account: Bank, Debit: amount}, Line{Account: CashInTransit, Credit: amount})
+}
+
+// PayoutReversed puts back a payout that failed or was canceled after it was paid
+func PayoutReversed(amount int) []Line {
+	return lines(Line{Account: CashInTransit, Debit: amount}, Line{Account: Bank, Credit: amount})
+}
@@ -0,0 +1,106 @@
+package ledger
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPostingRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []Line
+		want  []Line
+	}{
+		{"charge", Charge(1190, 190), []Line{
+			{Account: CashInTransit, Debit: 1190},
+			{Account: Revenue, Credit: 1000},
+			{Account: TaxPayable, Credit: 190},
+		}},
+		{"untaxed charge", Charge(1000, 0), []Line{
+			{Account: CashInTransit, Debit: 1000},
+			{Account: Revenue, Credit: 1000},
+		}},
+		{"refund", Refund(595, 95), []Line{
+			{Account: Refunds, Debit: 500},
+			{Account: TaxPayable, Debit: 95},
+			{Account: CashInTransit, Credit: 595},
+		}},
+		{"fee", Fee(30), []Line{
+			{Account: Fees, Debit: 30},
+			{Account: CashInTransit, Credit: 30},
+		}},
+		{"fee given back", Fee(-30), []Line{
+			{Account: CashInTransit, Debit: 30},
+			{Account: Fees, Credit: 30},
+		}},
+		{"dispute opened", DisputeOpened(1000), []Line{
+			{Account: Disputes, Debit: 1000},
+			{Account: CashInTransit, Credit: 1000},
+		}},
+		{"dispute won", DisputeWon(1000), []Line{
+			{Account: CashInTransit, Debit: 1000},
+			{Account: Disputes, Credit: 1000},
+		}},
+		{"payout", Payout(5000), []Line{
+			{Account: Bank, Debit: 5000},
+			{Account: CashInTransit, Credit: 5000},
+		}},
+		{"payout reversed", PayoutReversed(5000), []Line{
+			{Account: CashInTransit, Debit: 5000},
+			{Account: Bank, Credit: 5000},
+		}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.lines, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, tt.lines, tt.want)
+		}
+		if err := (Entry{Lines: tt.lines}).Validate(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []Line
+		want  error
+	}{
+		{"no lines", nil, ErrEmptyEntry},
+		{"fee of nothing", Fee(0), ErrEmptyEntry},
+		{"tax over the amount", Charge(100, 200), ErrLine},
+		{"unknown account", []Line{{Account: "cash", Debit: 10}, {Account: Bank, Credit: 10}}, ErrLine},
+		{"debit and credit", []Line{{Account: Bank, Debit: 10, Credit: 10}, {Account: Fees, Credit: 10}}, ErrLine},
+		{"unbalanced", []Line{{Account: Bank, Debit: 10}, {Account: Fees, Credit: 9}}, ErrUnbalanced},
+	}
+	for _, tt := range tests {
+		if err := (Entry{Lines: tt.lines}).Validate(); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestRefundTax(t *testing.T) {
+	tests := []struct {
+		refunded, amount, tax, want int
+	}{
+		{1190, 1190, 190, 190},
+		{595, 1190, 190, 95},
+		{500, 1000, 101, 50},
+		{100, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := RefundTax(tt.refunded, tt.amount, tt.tax); got != tt.want {
+			t.Errorf("refund of %d of %d with %d tax: got %d, want %d", tt.refunded, tt.amount, tt.tax, got, tt.want)
+		}
+	}
+}
+
+func TestDebitNormal(t *testing.T) {
+	for typ, want := range map[string]bool{Asset: true, Expense: true, Liability: false, Income: false} {
+		if DebitNormal(typ) != want {
+			t.Errorf("%s: got debit normal %v, want %v", typ, !want, want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Kinds of address
+const (
+	AddressBilling  = "billing"
+	AddressShipping = "shipping"
+)
+
+// Address is a postal address of a customer. Country is an ISO 3166-1 code and Region
+// the ISO 3166-2 subdivision, like "CA" for California, where the country has them.
+type Address struct {
+	ID         int       `json:"id"`
+	CustomerID int       `json:"customer_id"`
+	Kind       string    `json:"kind"`
+	Name       string    `json:"name"`
+	Line1      string    `json:"line1"`
+	Line2      string    `json:"line2"`
+	City       string    `json:"city"`
+	Region     string    `json:"region"`
+	Postcode   string    `json:"postcode"`
+	Country    string    `json:"country"`
+	CreatedAt  time.Time `json:"-"`
+	UpdatedAt  time.Time `json:"-"`
+}
+
+// Lines returns the address as it is written on a parcel
+func (a Address) Lines() []string {
+	var lines []string
+	for _, l := range []string{a.Name, a.Line1, a.Line2, strings.TrimSpace(a.City + " " + a.Region + " " + a.Postcode), a.Country} {
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// InsertAddress inserts a new address of a customer and returns its ID
+func (m *DBWrapper) InsertAddress(a Address) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		insert into addresses
+			(customer_id, kind, name, line1, line2, city, region, postcode, country, created_at, updated_at)
+			values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := m.DB.ExecContext(ctx, stmt,
+		a.CustomerID,
+		a.Kind,
+		a.Name,
+		a.Line1,
+		a.Line2,
+		a.City,
+		strings.ToUpper(a.Region),
+		strings.ToUpper(a.Postcode),
+		strings.ToUpper(a.Country),
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (m *DBWrapper) getAddress(ctx context.Context, id int) (*Address, error) {
+	query := `
+		select id, customer_id, kind, name, line1, line2, city, region, postcode, country, created_at, updated_at
+		from addresses
+		where id = ?`
+
+	var a Address
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&a.ID,
+		&a.CustomerID,
+		&a.Kind,
+		&a.Name,
+		&a.Line1,
+		&a.Line2,
+		&a.City,
+		&a.Region,
+		&a.Postcode,
+		&a.Country,
+		&a.CreatedAt,
+		&a.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Capture methods of widgets
+const (
+	CaptureAutomatic = "automatic"
+	CaptureManual    = "manual"
+)
+
+// ExpiringAuthorization is a card authorization of a sale that must be captured before
+// CaptureBefore, or the money is released back to the card holder
+type ExpiringAuthorization struct {
+	OrderID       int       `json:"order_id"`
+	TransactionID int       `json:"transaction_id"`
+	Amount        int       `json:"amount"`
+	Currency      string    `json:"currency"`
+	PaymentIntent string    `json:"payment_intent"`
+	Email         string    `json:"email"`
+	CaptureBefore time.Time `json:"capture_before"`
+}
+
+// SetWidgetCaptureMethod sets whether a widget is charged at checkout (CaptureAutomatic)
+// or only authorized then and captured later (CaptureManual)
+func (m *DBWrapper) SetWidgetCaptureMethod(id int, method string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, "update widgets set capture_method = ?, updated_at = ? where id = ?", method, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CapturePayment records that amount of the authorized transaction of an order was
+// captured. The transaction is cleared for that amount, so later refunds are limited to
+// it, and the order is cleared. A partial capture scales the amount, discount, shipping
+// and tax lines of the order down to what was captured, so that revenue, tax and credit
+// notes follow the capture.
+func (m *DBWrapper) CapturePayment(order Order, amount int) error {
+	return m.closeAuthorization(order, amount, TransactionCleared, OrderCleared)
+}
+
+// VoidPayment records that the authorized transaction of an order was voided and
+// cancels the order
+func (m *DBWrapper) VoidPayment(order Order) error {
+	return m.closeAuthorization(order, order.Transaction.Amount, TransactionVoided, OrderCancelled)
+}
+
+func (m *DBWrapper) closeAuthorization(order Order, amount, txnStatus, orderStatus int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		update transactions set amount = ?, transaction_status_id = ?, updated_at = ? where id = ?`,
+		amount, txnStatus, time.Now(), order.TransactionID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "update orders set status_id = ?, updated_at = ? where id = ?", orderStatus, time.Now(), order.ID)
+	if err != nil {
+		return err
+	}
+
+	authorized := order.Transaction.Amount
+	if orderStatus == OrderCleared && amount < authorized && authorized > 0 {
+		_, err = tx.ExecContext(ctx, `
+			update orders
+			set amount = amount * ? div ?, discount = discount * ? div ?, shipping = shipping * ? div ?, updated_at = ?
+			where id = ?`,
+			amount, authorized, amount, authorized, amount, authorized, time.Now(), order.ID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			update order_tax_lines
+			set taxable = taxable * ? div ?, amount = amount * ? div ?, updated_at = ?
+			where order_id = ?`,
+			amount, authorized, amount, authorized, time.Now(), order.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetExpiringAuthorizations returns the authorized sales whose authorization expires
+// before before and that nobody has been warned about yet, the soonest first
+func (m *DBWrapper) GetExpiringAuthorizations(before time.Time) ([]ExpiringAuthorization, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select o.id, t.id, t.amount, t.currency, t.payment_intent, c.email, t.capture_before
+		from transactions t
+			join orders o on (o.transaction_id = t.id)
+			join customers c on (o.customer_id = c.id)
+		where t.transaction_status_id = ? and t.capture_before < ? and t.expiry_warned_at is null
+		order by t.capture_before, o.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, TransactionAuthorized, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var auths []ExpiringAuthorization
+	for rows.Next() {
+		var a ExpiringAuthorization
+		err := rows.Scan(&a.OrderID, &a.TransactionID, &a.Amount, &a.Currency, &a.PaymentIntent, &a.Email, &a.CaptureBefore)
+		if err != nil {
+			return nil, err
+		}
+		auths = append(auths, a)
+	}
+	return auths, rows.Err()
+}
+
+// MarkExpiryWarned records that a warning was sent about the authorization of a
+// transaction, so it is only sent once
+func (m *DBWrapper) MarkExpiryWarned(transactionID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `
+		update transactions set expiry_warned_at = ?, updated_at = ? where id = ?`,
+		time.Now(), time.Now(), transactionID)
+	return err
+}
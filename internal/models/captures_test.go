@@ -0,0 +1,87 @@
+package models
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"go-commerce/internal/dbtest"
+)
+
+func TestCapturePayment(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	db.Expect("update transactions set amount = ?, transaction_status_id = ?").WithArgs(700, TransactionCleared, dbtest.Any, 3)
+	db.Expect("update orders set status_id = ?").WithArgs(OrderCleared, dbtest.Any, 5)
+	// 700 of 1000 was captured, so the order and its taxes keep 70% of their amounts
+	db.Expect("set amount = amount * ? div ?, discount = discount * ? div ?, shipping = shipping * ? div ?").
+		WithArgs(700, 1000, 700, 1000, 700, 1000, dbtest.Any, 5)
+	db.Expect("update order_tax_lines set taxable = taxable * ? div ?, amount = amount * ? div ?").
+		WithArgs(700, 1000, 700, 1000, dbtest.Any, 5)
+
+	order := Order{ID: 5, TransactionID: 3, Transaction: Transaction{Amount: 1000}}
+	if err := m.CapturePayment(order, 700); err != nil {
+		t.Fatal(err)
+	}
+	if db.Commits != 1 {
+		t.Errorf("got %d commits", db.Commits)
+	}
+}
+
+func TestCapturePaymentInFull(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	db.Expect("update transactions set amount = ?, transaction_status_id = ?").WithArgs(1000, TransactionCleared, dbtest.Any, 3)
+	db.Expect("update orders set status_id = ?").WithArgs(OrderCleared, dbtest.Any, 5)
+
+	order := Order{ID: 5, TransactionID: 3, Transaction: Transaction{Amount: 1000}}
+	if err := m.CapturePayment(order, 1000); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVoidPayment(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	db.Expect("update transactions set amount = ?, transaction_status_id = ?").WithArgs(1000, TransactionVoided, dbtest.Any, 3)
+	db.Expect("update orders set status_id = ?").WithArgs(OrderCancelled, dbtest.Any, 5)
+
+	order := Order{ID: 5, TransactionID: 3, Transaction: Transaction{Amount: 1000}}
+	if err := m.VoidPayment(order); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetWidgetCaptureMethodUnknownWidget(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	db.Expect("update widgets set capture_method = ?").WithArgs(CaptureManual, dbtest.Any, 9).Result(0, 0)
+
+	if err := m.SetWidgetCaptureMethod(9, CaptureManual); err != sql.ErrNoRows {
+		t.Errorf("got %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestGetExpiringAuthorizations(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	before := time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)
+	expires := before.Add(-time.Hour)
+	db.Expect("where t.transaction_status_id = ? and t.capture_before < ? and t.expiry_warned_at is null").
+		WithArgs(TransactionAuthorized, before).
+		Rows([]interface{}{5, 3, 1000, "usd", "pi_1", "ada@example.com", expires})
+
+	auths, err := m.GetExpiringAuthorizations(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ExpiringAuthorization{5, 3, 1000, "usd", "pi_1", "ada@example.com", expires}
+	if len(auths) != 1 || auths[0] != want {
+		t.Errorf("got %+v, want %+v", auths, want)
+	}
+}
@@ -0,0 +1,363 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Coupon durations, which say how long a coupon discounts a subscription. One-off
+// purchases are discounted once whatever the duration.
+const (
+	CouponOnce      = "once"
+	CouponRepeating = "repeating"
+	CouponForever   = "forever"
+)
+
+// Errors returned by CheckCoupon, worded for the buyer
+var (
+	ErrDuplicateCoupon    = errors.New("duplicate coupon code")
+	ErrCouponExpired      = errors.New("this coupon has expired")
+	ErrCouponNotForWidget = errors.New("this coupon does not apply to this product")
+	ErrCouponCurrency     = errors.New("this coupon is for another currency")
+	ErrCouponUsedUp       = errors.New("this coupon has been fully redeemed")
+	ErrCouponRedeemed     = errors.New("this coupon has already been used with this email address")
+)
+
+// CouponHold is how long a checkout holds a redemption of its coupon while the buyer
+// pays. The hold is given back once the order is saved or the payment fails.
+const CouponHold = time.Hour
+
+// Coupon is a promotion code. It takes PercentOff percent or AmountOff minor units of
+// Currency off the price, of any widget or only of WidgetID. MaxRedemptions caps the
+// number of orders that can use it, unless it is 0, and Redemptions counts them.
+// Reserved counts the redemptions held by checkouts that are still being paid.
+type Coupon struct {
+	ID               int        `json:"id"`
+	Code             string     `json:"code"`
+	PercentOff       int        `json:"percent_off"`
+	AmountOff        int        `json:"amount_off"`
+	Currency         string     `json:"currency"`
+	WidgetID         int        `json:"widget_id"`
+	MaxRedemptions   int        `json:"max_redemptions"`
+	Redemptions      int        `json:"redemptions"`
+	Reserved         int        `json:"reserved"`
+	OncePerCustomer  bool       `json:"once_per_customer"`
+	Duration         string     `json:"duration"`
+	DurationInMonths int        `json:"duration_in_months"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	StripeCouponID   string     `json:"-"`
+	CreatedAt        time.Time  `json:"-"`
+	UpdatedAt        time.Time  `json:"-"`
+}
+
+// Discount returns the discount the coupon gives on price, which is never more than price
+func (c Coupon) Discount(price int) int {
+	discount := c.AmountOff
+	if c.PercentOff > 0 {
+		discount = (price*c.PercentOff + 50) / 100
+	}
+	if discount > price {
+		discount = price
+	}
+	return discount
+}
+
+// Check returns why the coupon cannot be used on widget in currency at now, or nil
+func (c Coupon) Check(widgetID int, currency string, now time.Time) error {
+	switch {
+	case c.ExpiresAt != nil && !now.Before(*c.ExpiresAt):
+		return ErrCouponExpired
+	case c.WidgetID != 0 && c.WidgetID != widgetID:
+		return ErrCouponNotForWidget
+	case c.AmountOff > 0 && !strings.EqualFold(c.Currency, currency):
+		return ErrCouponCurrency
+	case c.MaxRedemptions > 0 && c.Redemptions+c.Reserved >= c.MaxRedemptions:
+		return ErrCouponUsedUp
+	}
+	return nil
+}
+
+// couponColumns are the columns scanned by scanCoupon
+const couponColumns = `
+	c.id, c.code, c.percent_off, c.amount_off, c.currency, coalesce(c.widget_id, 0),
+	c.max_redemptions, (select count(*) from orders o where o.coupon_id = c.id),
+	c.once_per_customer, c.duration, c.duration_in_months, c.expires_at,
+	c.stripe_coupon_id, c.created_at, c.updated_at`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func scanCoupon(row scanner) (Coupon, error) {
+	var c Coupon
+	var expiresAt sql.NullTime
+	err := row.Scan(
+		&c.ID,
+		&c.Code,
+		&c.PercentOff,
+		&c.AmountOff,
+		&c.Currency,
+		&c.WidgetID,
+		&c.MaxRedemptions,
+		&c.Redemptions,
+		&c.OncePerCustomer,
+		&c.Duration,
+		&c.DurationInMonths,
+		&expiresAt,
+		&c.StripeCouponID,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+	)
+	if expiresAt.Valid {
+		c.ExpiresAt = &expiresAt.Time
+	}
+	return c, err
+}
+
+// GetCoupons returns every coupon, newest first
+func (m *DBWrapper) GetCoupons() ([]*Coupon, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, "select "+couponColumns+" from coupons c order by c.id desc")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	coupons := []*Coupon{}
+	for rows.Next() {
+		c, err := scanCoupon(rows)
+		if err != nil {
+			return nil, err
+		}
+		coupons = append(coupons, &c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return coupons, nil
+}
+
+// GetCouponByCode returns the coupon with code, which is not case sensitive
+func (m *DBWrapper) GetCouponByCode(code string) (Coupon, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, "select "+couponColumns+" from coupons c where c.code = ?", strings.ToUpper(code))
+	return scanCoupon(row)
+}
+
+// CheckCoupon returns the coupon with code if the buyer with email can use it on widget
+// in currency now. Redemptions held by checkouts count as used. Unknown codes return
+// sql.ErrNoRows.
+func (m *DBWrapper) CheckCoupon(code string, widgetID int, currency, email string) (Coupon, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return checkCoupon(ctx, m.DB, code, widgetID, currency, email, false)
+}
+
+// checkCoupon checks the coupon with code for CheckCoupon and ReserveCoupon, locking it
+// until the end of the transaction of q when lock is set
+func checkCoupon(ctx context.Context, q querier, code string, widgetID int, currency, email string, lock bool) (Coupon, error) {
+	query := "select " + couponColumns + " from coupons c where c.code = ?"
+	if lock {
+		query += " for update"
+	}
+	c, err := scanCoupon(q.QueryRowContext(ctx, query, strings.ToUpper(code)))
+	if err != nil {
+		return c, err
+	}
+
+	now := time.Now()
+	query = "select count(*) from coupon_reservations where coupon_id = ? and expires_at > ?"
+	if err = q.QueryRowContext(ctx, query, c.ID, now).Scan(&c.Reserved); err != nil {
+		return c, err
+	}
+	if err := c.Check(widgetID, currency, now); err != nil {
+		return c, err
+	}
+
+	if c.OncePerCustomer {
+		query := `
+			select
+				(select count(o.id)
+				from orders o join customers cu on (o.customer_id = cu.id)
+				where o.coupon_id = ? and lower(cu.email) = ?) +
+				(select count(r.id)
+				from coupon_reservations r
+				where r.coupon_id = ? and r.email = ? and r.expires_at > ?)`
+
+		var used int
+		email = strings.ToLower(email)
+		err = q.QueryRowContext(ctx, query, c.ID, email, c.ID, email, now).Scan(&used)
+		if err != nil {
+			return c, err
+		}
+		if used > 0 {
+			return c, ErrCouponRedeemed
+		}
+	}
+
+	return c, nil
+}
+
+// ReserveCoupon checks the coupon with code like CheckCoupon and holds one of its
+// redemptions for the checkout of the buyer with email for CouponHold. It returns the
+// coupon and the ID of the reservation. The coupon stays locked until the reservation
+// is saved, so that concurrent checkouts cannot take it over its limits.
+func (m *DBWrapper) ReserveCoupon(code string, widgetID int, currency, email string) (Coupon, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Coupon{}, 0, err
+	}
+	defer tx.Rollback()
+
+	c, err := checkCoupon(ctx, tx, code, widgetID, currency, email, true)
+	if err != nil {
+		return c, 0, err
+	}
+
+	// expired holds are cleared while the coupon is locked
+	now := time.Now()
+	_, err = tx.ExecContext(ctx, "delete from coupon_reservations where coupon_id = ? and expires_at <= ?", c.ID, now)
+	if err != nil {
+		return c, 0, err
+	}
+
+	stmt := `
+		insert into coupon_reservations (coupon_id, email, expires_at, created_at, updated_at)
+			values (?, ?, ?, ?, ?)`
+	result, err := tx.ExecContext(ctx, stmt, c.ID, strings.ToLower(email), now.Add(CouponHold), now, now)
+	if err != nil {
+		return c, 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return c, 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return c, 0, err
+	}
+	c.Reserved++
+	return c, int(id), nil
+}
+
+// SetCouponReservationIntent records the payment intent a coupon reservation is held for
+func (m *DBWrapper) SetCouponReservationIntent(id int, paymentIntent string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := "update coupon_reservations set payment_intent = ?, updated_at = ? where id = ?"
+	_, err := m.DB.ExecContext(ctx, stmt, paymentIntent, time.Now(), id)
+	return err
+}
+
+// ReleaseCouponReservation gives back a redemption held for a checkout that was not paid
+func (m *DBWrapper) ReleaseCouponReservation(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, "delete from coupon_reservations where id = ?", id)
+	return err
+}
+
+// ReleaseCouponReservationForIntent gives back the redemption held for a payment intent,
+// once its order is saved, which then counts as the redemption, or its payment failed
+func (m *DBWrapper) ReleaseCouponReservationForIntent(paymentIntent string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, "delete from coupon_reservations where payment_intent = ?", paymentIntent)
+	return err
+}
+
+// InsertCoupon inserts a new coupon and returns its ID
+func (m *DBWrapper) InsertCoupon(c Coupon) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists int
+	err := m.DB.QueryRowContext(ctx, "select count(id) from coupons where code = ?", strings.ToUpper(c.Code)).Scan(&exists)
+	if err != nil {
+		return 0, err
+	}
+	if exists > 0 {
+		return 0, ErrDuplicateCoupon
+	}
+
+	stmt := `
+		insert into coupons
+			(code, percent_off, amount_off, currency, widget_id, max_redemptions, once_per_customer,
+			duration, duration_in_months, expires_at, created_at, updated_at)
+			values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	var widgetID, expiresAt interface{}
+	if c.WidgetID != 0 {
+		widgetID = c.WidgetID
+	}
+	if c.ExpiresAt != nil {
+		expiresAt = *c.ExpiresAt
+	}
+
+	result, err := m.DB.ExecContext(ctx, stmt,
+		strings.ToUpper(c.Code),
+		c.PercentOff,
+		c.AmountOff,
+		strings.ToLower(c.Currency),
+		widgetID,
+		c.MaxRedemptions,
+		c.OncePerCustomer,
+		c.Duration,
+		c.DurationInMonths,
+		expiresAt,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// SetCouponStripeID records the id of the gateway coupon created for a coupon
+func (m *DBWrapper) SetCouponStripeID(id int, stripeCouponID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, "update coupons set stripe_coupon_id = ?, updated_at = ? where id = ?",
+		stripeCouponID, time.Now(), id)
+	return err
+}
+
+// DeleteCoupon deletes a coupon. Orders that used it keep their discount.
+func (m *DBWrapper) DeleteCoupon(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, "delete from coupons where id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go-commerce/internal/dbtest"
+)
+
+func TestCouponDiscount(t *testing.T) {
+	tests := []struct {
+		coupon Coupon
+		price  int
+		want   int
+	}{
+		{Coupon{PercentOff: 10}, 1000, 100},
+		{Coupon{PercentOff: 15}, 999, 150},
+		{Coupon{PercentOff: 15}, 990, 149},
+		{Coupon{PercentOff: 100}, 1000, 1000},
+		{Coupon{AmountOff: 250}, 1000, 250},
+		{Coupon{AmountOff: 2500}, 1000, 1000},
+	}
+	for _, tt := range tests {
+		if got := tt.coupon.Discount(tt.price); got != tt.want {
+			t.Errorf("%+v.Discount(%d) = %d, want %d", tt.coupon, tt.price, got, tt.want)
+		}
+	}
+}
+
+func TestCouponCheck(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	expires := now
+
+	tests := []struct {
+		name   string
+		coupon Coupon
+		want   error
+	}{
+		{"any widget", Coupon{PercentOff: 10}, nil},
+		{"expired", Coupon{PercentOff: 10, ExpiresAt: &expires}, ErrCouponExpired},
+		{"other widget", Coupon{PercentOff: 10, WidgetID: 2}, ErrCouponNotForWidget},
+		{"this widget", Coupon{PercentOff: 10, WidgetID: 1}, nil},
+		{"amount in other currency", Coupon{AmountOff: 100, Currency: "usd"}, ErrCouponCurrency},
+		{"amount in currency", Coupon{AmountOff: 100, Currency: "EUR"}, nil},
+		{"used up", Coupon{PercentOff: 10, MaxRedemptions: 3, Redemptions: 3}, ErrCouponUsedUp},
+		{"not used up", Coupon{PercentOff: 10, MaxRedemptions: 3, Redemptions: 2}, nil},
+		{"held by checkouts", Coupon{PercentOff: 10, MaxRedemptions: 3, Redemptions: 2, Reserved: 1}, ErrCouponUsedUp},
+	}
+	for _, tt := range tests {
+		if got := tt.coupon.Check(1, "eur", now); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// couponRow returns the columns scanned by scanCoupon
+func couponRow(c Coupon) []interface{} {
+	var expiresAt interface{}
+	if c.ExpiresAt != nil {
+		expiresAt = *c.ExpiresAt
+	}
+	return []interface{}{
+		c.ID, c.Code, c.PercentOff, c.AmountOff, c.Currency, c.WidgetID,
+		c.MaxRedemptions, c.Redemptions, c.OncePerCustomer, c.Duration, c.DurationInMonths,
+		expiresAt, c.StripeCouponID, c.CreatedAt, c.UpdatedAt,
+	}
+}
+
+func TestCheckCouponOncePerCustomer(t *testing.T) {
+	coupon := Coupon{ID: 7, Code: "WELCOME", PercentOff: 10, OncePerCustomer: true, Duration: CouponOnce}
+
+	for used, want := range map[int]error{0: nil, 1: ErrCouponRedeemed} {
+		db := dbtest.New(t)
+		m := DBWrapper{DB: db.SQL}
+
+		db.Expect("from coupons c where c.code = ?").WithArgs("WELCOME").Rows(couponRow(coupon))
+		db.Expect("from coupon_reservations where coupon_id = ? and expires_at > ?").WithArgs(7, dbtest.Any).Rows([]interface{}{0})
+		db.Expect("where o.coupon_id = ? and lower(cu.email) = ?").
+			WithArgs(7, "ada@example.com", 7, "ada@example.com", dbtest.Any).
+			Rows([]interface{}{used})
+
+		c, err := m.CheckCoupon("welcome", 1, "usd", "Ada@Example.com")
+		if err != want {
+			t.Errorf("used %d times: got %v, want %v", used, err, want)
+		}
+		if c.ID != 7 {
+			t.Errorf("got coupon %+v", c)
+		}
+	}
+}
+
+func TestCheckCouponStopsAtFirstProblem(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	coupon := Coupon{ID: 7, Code: "TEN", PercentOff: 10, OncePerCustomer: true, WidgetID: 2}
+	db.Expect("from coupons c where c.code = ?").Rows(couponRow(coupon))
+	db.Expect("from coupon_reservations").Rows([]interface{}{0})
+
+	if _, err := m.CheckCoupon("ten", 1, "usd", "ada@example.com"); err != ErrCouponNotForWidget {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestCheckCouponCountsReservations(t *testing.T) {
+	coupon := Coupon{ID: 7, Code: "FIVE", PercentOff: 10, MaxRedemptions: 5, Redemptions: 3}
+
+	for reserved, want := range map[int]error{1: nil, 2: ErrCouponUsedUp} {
+		db := dbtest.New(t)
+		m := DBWrapper{DB: db.SQL}
+
+		db.Expect("from coupons c where c.code = ?").Rows(couponRow(coupon))
+		db.Expect("from coupon_reservations where coupon_id = ?").Rows([]interface{}{reserved})
+
+		if _, err := m.CheckCoupon("five", 1, "usd", "ada@example.com"); err != want {
+			t.Errorf("%d reserved: got %v, want %v", reserved, err, want)
+		}
+	}
+}
+
+func TestReserveCoupon(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	coupon := Coupon{ID: 7, Code: "FIVE", PercentOff: 10, MaxRedemptions: 5, Redemptions: 3}
+	db.Expect("from coupons c where c.code = ? for update").WithArgs("FIVE").Rows(couponRow(coupon))
+	db.Expect("from coupon_reservations where coupon_id = ?").Rows([]interface{}{1})
+	db.Expect("delete from coupon_reservations where coupon_id = ? and expires_at <= ?").WithArgs(7, dbtest.Any)
+	hold := db.Expect("insert into coupon_reservations").Result(21, 1)
+
+	c, id, err := m.ReserveCoupon("five", 1, "usd", "Ada@Example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 21 || c.Reserved != 2 {
+		t.Errorf("got reservation %d with %d reserved", id, c.Reserved)
+	}
+	if hold.Args[0] != int64(7) || hold.Args[1] != "ada@example.com" {
+		t.Errorf("held %v", hold.Args)
+	}
+	if expires, created := hold.Args[2].(time.Time), hold.Args[3].(time.Time); expires.Sub(created) != CouponHold {
+		t.Errorf("held for %v", expires.Sub(created))
+	}
+	if db.Commits != 1 {
+		t.Errorf("got %d commits", db.Commits)
+	}
+}
+
+func TestReserveCouponUsedUp(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	// the last redemption is held by another checkout
+	coupon := Coupon{ID: 7, Code: "FIVE", PercentOff: 10, MaxRedemptions: 5, Redemptions: 4}
+	db.Expect("from coupons c where c.code = ? for update").Rows(couponRow(coupon))
+	db.Expect("from coupon_reservations where coupon_id = ?").Rows([]interface{}{1})
+
+	if _, id, err := m.ReserveCoupon("five", 1, "usd", "ada@example.com"); err != ErrCouponUsedUp || id != 0 {
+		t.Errorf("got reservation %d, %v", id, err)
+	}
+	if db.Commits != 0 {
+		t.Error("a used up coupon was reserved")
+	}
+}
+
+func TestInsertCoupon(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	db.Expect("select count(id) from coupons where code = ?").WithArgs("SPRING").Rows([]interface{}{0})
+	insert := db.Expect("insert into coupons").Result(12, 1)
+
+	id, err := m.InsertCoupon(Coupon{Code: "spring", AmountOff: 500, Currency: "EUR", Duration: CouponOnce})
+	if err != nil || id != 12 {
+		t.Fatalf("got %d, %v", id, err)
+	}
+	if insert.Args[0] != "SPRING" || insert.Args[3] != "eur" || insert.Args[4] != nil || insert.Args[9] != nil {
+		t.Errorf("inserted %v", insert.Args)
+	}
+
+	db.Expect("select count(id) from coupons where code = ?").WithArgs("SPRING").Rows([]interface{}{1})
+	if _, err := m.InsertCoupon(Coupon{Code: "Spring", PercentOff: 5}); !errors.Is(err, ErrDuplicateCoupon) {
+		t.Errorf("got %v, want ErrDuplicateCoupon", err)
+	}
+}
@@ -0,0 +1,201 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// PaymentMethod is a card saved with Stripe for a customer, to be charged off-session
+type PaymentMethod struct {
+	ID                    int       `json:"id"`
+	CustomerID            int       `json:"customer_id"`
+	StripePaymentMethodID string    `json:"stripe_payment_method_id"`
+	Brand                 string    `json:"brand"`
+	LastFour              string    `json:"last_four"`
+	ExpiryMonth           int       `json:"expiry_month"`
+	ExpiryYear            int       `json:"expiry_year"`
+	CreatedAt             time.Time `json:"created_at"`
+	UpdatedAt             time.Time `json:"-"`
+}
+
+// SearchCustomers returns up to limit customers whose name or email contains q, by
+// last name
+func (m *DBWrapper) SearchCustomers(q string, limit int) ([]*Customer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select id, first_name, last_name, email, stripe_customer_id, created_at, updated_at
+		from customers
+		where email like ? or concat(first_name, ' ', last_name) like ?
+		order by last_name, first_name, id
+		limit ?`
+
+	pattern := likePattern(strings.TrimSpace(q))
+	rows, err := m.DB.QueryContext(ctx, query, pattern, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var customers []*Customer
+	for rows.Next() {
+		var c Customer
+		err := rows.Scan(&c.ID, &c.FirstName, &c.LastName, &c.Email, &c.StripeCustomerID, &c.CreatedAt, &c.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		customers = append(customers, &c)
+	}
+	return customers, rows.Err()
+}
+
+// GetCustomer gets a customer with its saved payment methods
+func (m *DBWrapper) GetCustomer(id int) (Customer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select id, first_name, last_name, email, stripe_customer_id, created_at, updated_at
+		from customers
+		where id = ?`
+
+	var c Customer
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&c.ID,
+		&c.FirstName,
+		&c.LastName,
+		&c.Email,
+		&c.StripeCustomerID,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+	)
+	if err != nil {
+		return c, err
+	}
+
+	c.PaymentMethods, err = m.getPaymentMethods(ctx, c.ID)
+	if err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// SetStripeCustomerID links a customer to the Stripe customer its cards are saved with
+func (m *DBWrapper) SetStripeCustomerID(id int, stripeCustomerID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `
+		update customers set stripe_customer_id = ?, updated_at = ? where id = ?`,
+		stripeCustomerID, time.Now(), id)
+	return err
+}
+
+// SavePaymentMethod saves a card of a customer and returns its ID. Saving a card twice
+// updates its details.
+func (m *DBWrapper) SavePaymentMethod(pm PaymentMethod) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		insert into payment_methods
+			(customer_id, stripe_payment_method_id, brand, last_four, expiry_month, expiry_year,
+			created_at, updated_at)
+			values (?, ?, ?, ?, ?, ?, ?, ?)
+		on duplicate key update
+			id = last_insert_id(id), brand = values(brand), last_four = values(last_four),
+			expiry_month = values(expiry_month), expiry_year = values(expiry_year),
+			updated_at = values(updated_at)`
+
+	result, err := m.DB.ExecContext(ctx, stmt,
+		pm.CustomerID,
+		pm.StripePaymentMethodID,
+		pm.Brand,
+		pm.LastFour,
+		pm.ExpiryMonth,
+		pm.ExpiryYear,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// GetPaymentMethod gets a saved card by id
+func (m *DBWrapper) GetPaymentMethod(id int) (PaymentMethod, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select id, customer_id, stripe_payment_method_id, brand, last_four, expiry_month,
+			expiry_year, created_at, updated_at
+		from payment_methods
+		where id = ?`
+
+	var pm PaymentMethod
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&pm.ID,
+		&pm.CustomerID,
+		&pm.StripePaymentMethodID,
+		&pm.Brand,
+		&pm.LastFour,
+		&pm.ExpiryMonth,
+		&pm.ExpiryYear,
+		&pm.CreatedAt,
+		&pm.UpdatedAt,
+	)
+	return pm, err
+}
+
+// DeletePaymentMethod deletes a saved card
+func (m *DBWrapper) DeletePaymentMethod(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, "delete from payment_methods where id = ?", id)
+	return err
+}
+
+func (m *DBWrapper) getPaymentMethods(ctx context.Context, customerID int) ([]*PaymentMethod, error) {
+	query := `
+		select id, customer_id, stripe_payment_method_id, brand, last_four, expiry_month,
+			expiry_year, created_at, updated_at
+		from payment_methods
+		where customer_id = ?
+		order by id desc`
+
+	rows, err := m.DB.QueryContext(ctx, query, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var methods []*PaymentMethod
+	for rows.Next() {
+		var pm PaymentMethod
+		err := rows.Scan(
+			&pm.ID,
+			&pm.CustomerID,
+			&pm.StripePaymentMethodID,
+			&pm.Brand,
+			&pm.LastFour,
+			&pm.ExpiryMonth,
+			&pm.ExpiryYear,
+			&pm.CreatedAt,
+			&pm.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, &pm)
+	}
+	return methods, rows.Err()
+}
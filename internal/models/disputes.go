@@ -0,0 +1,377 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Dispute statuses, as reported by Stripe
+const (
+	DisputeWarningNeedsResponse = "warning_needs_response"
+	DisputeWarningUnderReview   = "warning_under_review"
+	DisputeWarningClosed        = "warning_closed"
+	DisputeNeedsResponse        = "needs_response"
+	DisputeUnderReview          = "under_review"
+	DisputeChargeRefunded       = "charge_refunded"
+	DisputeWon                  = "won"
+	DisputeLost                 = "lost"
+)
+
+// Dispute is a chargeback, or an inquiry that can turn into one, raised by a customer's
+// card issuer. It is synced from Stripe and linked to the transaction and order of the
+// disputed payment intent, or of the disputed charge ChargeID, when they are ours. Evidence is drafted in ProductDescription,
+// UncategorizedText and Files, and sent once, before EvidenceDueBy.
+type Dispute struct {
+	ID                 int            `json:"id"`
+	StripeDisputeID    string         `json:"stripe_dispute_id"`
+	PaymentIntent      string         `json:"payment_intent"`
+	ChargeID           string         `json:"-"`
+	TransactionID      int            `json:"transaction_id"`
+	OrderID            int            `json:"order_id"`
+	Amount             int            `json:"amount"`
+	Currency           string         `json:"currency"`
+	Reason             string         `json:"reason"`
+	Status             string         `json:"status"`
+	EvidenceDueBy      *time.Time     `json:"evidence_due_by"`
+	ProductDescription string         `json:"product_description"`
+	UncategorizedText  string         `json:"uncategorized_text"`
+	SubmittedAt        *time.Time     `json:"submitted_at"`
+	OpenedAt           time.Time      `json:"opened_at"`
+	Files              []*DisputeFile `json:"files"`
+	CreatedAt          time.Time      `json:"-"`
+	UpdatedAt          time.Time      `json:"-"`
+}
+
+// NeedsResponse reports whether the dispute still takes evidence
+func (d Dispute) NeedsResponse() bool {
+	return (d.Status == DisputeNeedsResponse || d.Status == DisputeWarningNeedsResponse) && d.SubmittedAt == nil
+}
+
+// DisputeFile is a file uploaded to Stripe as evidence for a dispute. Purpose is the
+// evidence field it is sent as; a dispute has at most one file per purpose.
+type DisputeFile struct {
+	ID           int       `json:"id"`
+	DisputeID    int       `json:"dispute_id"`
+	Purpose      string    `json:"purpose"`
+	Filename     string    `json:"filename"`
+	Size         int       `json:"size"`
+	StripeFileID string    `json:"stripe_file_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"-"`
+}
+
+// DisputeReport is the disputes opened in a period against the sales of the period.
+// DisputeRate is Disputes divided by Orders. Closed counts the inquiries closed without
+// a chargeback and the disputes settled by refunding the charge.
+type DisputeReport struct {
+	From           string  `json:"from"`
+	To             string  `json:"to"`
+	Currency       string  `json:"currency"`
+	Converted      bool    `json:"converted"`
+	Orders         int     `json:"orders"`
+	Disputes       int     `json:"disputes"`
+	DisputeRate    float64 `json:"dispute_rate"`
+	Open           int     `json:"open"`
+	Closed         int     `json:"closed"`
+	Won            int     `json:"won"`
+	Lost           int     `json:"lost"`
+	DisputedAmount int     `json:"disputed_amount"`
+	LostAmount     int     `json:"lost_amount"`
+}
+
+// SaveDispute inserts a dispute synced from Stripe, or updates its amount, reason,
+// status and deadline when it is already known, and returns its ID. New disputes are
+// linked to the transaction and order of their payment intent or, for transactions
+// recorded without one, of their charge, the bank return code.
+func (m *DBWrapper) SaveDispute(d Dispute) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select t.id, coalesce(o.id, 0)
+		from transactions t
+			left join orders o on (o.transaction_id = t.id)
+		where (t.payment_intent = ? and t.payment_intent <> '')
+			or (t.bank_return_code = ? and t.bank_return_code <> '')
+		limit 1`
+	err := m.DB.QueryRowContext(ctx, query, d.PaymentIntent, d.ChargeID).Scan(&d.TransactionID, &d.OrderID)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	var dueBy sql.NullTime
+	if d.EvidenceDueBy != nil {
+		dueBy = sql.NullTime{Time: *d.EvidenceDueBy, Valid: true}
+	}
+
+	stmt := `
+		insert into disputes
+			(stripe_dispute_id, payment_intent, transaction_id, order_id, amount, currency, reason, status,
+			evidence_due_by, opened_at, created_at, updated_at)
+			values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		on duplicate key update id = last_insert_id(id), amount = values(amount), reason = values(reason),
+			status = values(status), evidence_due_by = values(evidence_due_by), updated_at = values(updated_at)`
+	result, err := m.DB.ExecContext(ctx, stmt,
+		d.StripeDisputeID,
+		d.PaymentIntent,
+		nullID(d.TransactionID),
+		nullID(d.OrderID),
+		d.Amount,
+		d.Currency,
+		d.Reason,
+		d.Status,
+		dueBy,
+		d.OpenedAt,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+const disputeColumns = `
+	d.id, d.stripe_dispute_id, d.payment_intent, coalesce(d.transaction_id, 0), coalesce(d.order_id, 0),
+	d.amount, d.currency, d.reason, d.status, d.evidence_due_by, coalesce(d.product_description, ''),
+	coalesce(d.uncategorized_text, ''), d.submitted_at, d.opened_at, d.created_at, d.updated_at`
+
+func scanDispute(row scanner) (Dispute, error) {
+	var d Dispute
+	var dueBy, submittedAt sql.NullTime
+	err := row.Scan(
+		&d.ID,
+		&d.StripeDisputeID,
+		&d.PaymentIntent,
+		&d.TransactionID,
+		&d.OrderID,
+		&d.Amount,
+		&d.Currency,
+		&d.Reason,
+		&d.Status,
+		&dueBy,
+		&d.ProductDescription,
+		&d.UncategorizedText,
+		&submittedAt,
+		&d.OpenedAt,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+	)
+	if dueBy.Valid {
+		d.EvidenceDueBy = &dueBy.Time
+	}
+	if submittedAt.Valid {
+		d.SubmittedAt = &submittedAt.Time
+	}
+	return d, err
+}
+
+// GetDisputes returns the disputes in status, or every dispute when status is empty.
+// Disputes that need a response come first, the most urgent first, then the newest.
+func (m *DBWrapper) GetDisputes(status string) ([]*Dispute, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select " + disputeColumns + " from disputes d"
+	var args []interface{}
+	if status != "" {
+		query += " where d.status = ?"
+		args = append(args, status)
+	}
+	query += `
+		order by (d.status in (?, ?) and d.submitted_at is null) desc,
+			d.evidence_due_by is null, d.evidence_due_by, d.opened_at desc`
+	args = append(args, DisputeNeedsResponse, DisputeWarningNeedsResponse)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	disputes := []*Dispute{}
+	for rows.Next() {
+		d, err := scanDispute(rows)
+		if err != nil {
+			return nil, err
+		}
+		d.Files = []*DisputeFile{}
+		disputes = append(disputes, &d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return disputes, nil
+}
+
+// GetDispute returns a dispute with its evidence files
+func (m *DBWrapper) GetDispute(id int) (Dispute, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	d, err := scanDispute(m.DB.QueryRowContext(ctx, "select "+disputeColumns+" from disputes d where d.id = ?", id))
+	if err != nil {
+		return d, err
+	}
+
+	query := `
+		select id, dispute_id, purpose, filename, size, stripe_file_id, created_at, updated_at
+		from dispute_files
+		where dispute_id = ?
+		order by purpose`
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return d, err
+	}
+	defer rows.Close()
+
+	d.Files = []*DisputeFile{}
+	for rows.Next() {
+		var f DisputeFile
+		err = rows.Scan(&f.ID, &f.DisputeID, &f.Purpose, &f.Filename, &f.Size, &f.StripeFileID, &f.CreatedAt, &f.UpdatedAt)
+		if err != nil {
+			return d, err
+		}
+		d.Files = append(d.Files, &f)
+	}
+	if err = rows.Err(); err != nil {
+		return d, err
+	}
+
+	return d, nil
+}
+
+// UpdateDisputeEvidence saves the evidence text drafted for a dispute
+func (m *DBWrapper) UpdateDisputeEvidence(id int, productDescription, uncategorizedText string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := "update disputes set product_description = ?, uncategorized_text = ?, updated_at = ? where id = ?"
+	result, err := m.DB.ExecContext(ctx, stmt, productDescription, uncategorizedText, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SaveDisputeFile records a file uploaded as evidence for a dispute, replacing the file
+// uploaded before for the same purpose, and returns its ID
+func (m *DBWrapper) SaveDisputeFile(f DisputeFile) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		insert into dispute_files (dispute_id, purpose, filename, size, stripe_file_id, created_at, updated_at)
+		values (?, ?, ?, ?, ?, ?, ?)
+		on duplicate key update id = last_insert_id(id), filename = values(filename), size = values(size),
+			stripe_file_id = values(stripe_file_id), created_at = values(created_at), updated_at = values(updated_at)`
+	result, err := m.DB.ExecContext(ctx, stmt, f.DisputeID, f.Purpose, f.Filename, f.Size, f.StripeFileID, time.Now(), time.Now())
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// MarkDisputeSubmitted records that the evidence of a dispute was sent, and the status
+// Stripe reported for it afterwards
+func (m *DBWrapper) MarkDisputeSubmitted(id int, status string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := "update disputes set status = ?, submitted_at = ?, updated_at = ? where id = ?"
+	_, err := m.DB.ExecContext(ctx, stmt, status, time.Now(), time.Now(), id)
+	return err
+}
+
+// GetDisputeReport returns the disputes opened from from up to, but not including, to,
+// against the orders placed in the same period
+func (m *DBWrapper) GetDisputeReport(from, to time.Time, rc ReportCurrency) (DisputeReport, error) {
+	from, to = truncateDay(from), truncateDay(to)
+	r := DisputeReport{
+		From:      from.Format(dayLayout),
+		To:        to.AddDate(0, 0, -1).Format(dayLayout),
+		Currency:  rc.Code,
+		Converted: rc.Convert,
+	}
+
+	revenue, err := m.GetRevenueByDay(from, to, rc)
+	if err != nil {
+		return r, err
+	}
+	for _, d := range revenue {
+		r.Orders += d.Orders
+	}
+
+	c, err := m.newReportConverter(rc)
+	if err != nil {
+		return r, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := "select opened_at, amount, currency, status from disputes where opened_at >= ? and opened_at < ?"
+	args := []interface{}{from, to}
+	if !rc.Convert {
+		query += " and currency = ?"
+		args = append(args, rc.Code)
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return r, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var openedAt time.Time
+		var amount int
+		var currency, status string
+		if err = rows.Scan(&openedAt, &amount, &currency, &status); err != nil {
+			return r, err
+		}
+		if amount, err = c.convert(amount, currency, truncateDay(openedAt)); err != nil {
+			return r, err
+		}
+
+		r.Disputes++
+		r.DisputedAmount += amount
+		switch status {
+		case DisputeWarningClosed, DisputeChargeRefunded:
+			r.Closed++
+		case DisputeWon:
+			r.Won++
+		case DisputeLost:
+			r.Lost++
+			r.LostAmount += amount
+		default:
+			r.Open++
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return r, err
+	}
+
+	if r.Orders > 0 {
+		r.DisputeRate = float64(r.Disputes) / float64(r.Orders)
+	}
+	return r, nil
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"go-commerce/internal/dbtest"
+)
+
+func TestDisputeNeedsResponse(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		dispute Dispute
+		want    bool
+	}{
+		{Dispute{Status: DisputeNeedsResponse}, true},
+		{Dispute{Status: DisputeWarningNeedsResponse}, true},
+		{Dispute{Status: DisputeNeedsResponse, SubmittedAt: &now}, false},
+		{Dispute{Status: DisputeUnderReview}, false},
+		{Dispute{Status: DisputeLost}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.dispute.NeedsResponse(); got != tt.want {
+			t.Errorf("%s submitted %v: got %v", tt.dispute.Status, tt.dispute.SubmittedAt != nil, got)
+		}
+	}
+}
+
+func TestSaveDisputeOfUnknownCharge(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	db.Expect("where (t.payment_intent = ?").WithArgs("pi_other", "").NoRows()
+	save := db.Expect("on duplicate key update id = last_insert_id(id)").Result(6, 1)
+
+	id, err := m.SaveDispute(Dispute{StripeDisputeID: "dp_1", PaymentIntent: "pi_other", Status: DisputeNeedsResponse})
+	if err != nil || id != 6 {
+		t.Fatalf("got %d, %v", id, err)
+	}
+	if save.Args[2] != nil || save.Args[3] != nil || save.Args[8] != nil {
+		t.Errorf("linked a dispute of an unknown charge: %v", save.Args)
+	}
+}
+
+func TestSaveDisputeMatchesCharge(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	// a dispute of a charge without a payment intent is found by the charge ID
+	db.Expect("or (t.bank_return_code = ?").WithArgs("", "ch_1").Rows([]interface{}{3, 5})
+	save := db.Expect("on duplicate key update id = last_insert_id(id)").Result(6, 1)
+
+	if _, err := m.SaveDispute(Dispute{StripeDisputeID: "dp_1", ChargeID: "ch_1", Status: DisputeNeedsResponse}); err != nil {
+		t.Fatal(err)
+	}
+	if save.Args[2] != int64(3) || save.Args[3] != int64(5) {
+		t.Errorf("linked the dispute to transaction %v and order %v", save.Args[2], save.Args[3])
+	}
+}
+
+func TestGetDisputeReport(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	from, to := day("2026-10-01"), day("2026-10-03")
+	db.Expect("from daily_sales").Rows(
+		[]interface{}{day("2026-10-01"), "usd", 30, 30000, 0, 0, 0},
+		[]interface{}{day("2026-10-02"), "usd", 10, 10000, 0, 0, 0},
+	)
+	db.Expect("from disputes where opened_at >= ? and opened_at < ? and currency = ?").
+		WithArgs(from, to, "usd").
+		Rows(
+			[]interface{}{day("2026-10-01"), 1000, "usd", DisputeNeedsResponse},
+			[]interface{}{day("2026-10-01"), 2000, "usd", DisputeLost},
+			[]interface{}{day("2026-10-02"), 500, "usd", DisputeWon},
+			[]interface{}{day("2026-10-02"), 700, "usd", DisputeWarningClosed},
+		)
+
+	r, err := m.GetDisputeReport(from, to, ReportCurrency{Code: "usd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DisputeReport{
+		From:           "2026-10-01",
+		To:             "2026-10-02",
+		Currency:       "usd",
+		Orders:         40,
+		Disputes:       4,
+		DisputeRate:    0.1,
+		Open:           1,
+		Closed:         1,
+		Won:            1,
+		Lost:           1,
+		DisputedAmount: 4200,
+		LostAmount:     2000,
+	}
+	if r != want {
+		t.Errorf("got  %+v\nwant %+v", r, want)
+	}
+}
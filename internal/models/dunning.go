@@ -0,0 +1,292 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Statuses of dunning cases
+const (
+	DunningOpen      = "open"
+	DunningRecovered = "recovered"
+	DunningCancelled = "cancelled"
+)
+
+// Kinds of subscription events, the steps of the timeline of a subscription
+const (
+	EventPaymentFailed    = "payment_failed"
+	EventRetryFailed      = "retry_failed"
+	EventReminderSent     = "reminder_sent"
+	EventCardUpdated      = "card_updated"
+	EventPaymentRecovered = "payment_recovered"
+	EventCancelled        = "cancelled"
+)
+
+// DunningCase follows a subscription whose renewal invoice could not be paid. The
+// invoice is retried and the customer reminded on a schedule until it is paid, which
+// recovers the subscription, or the final attempt fails, which cancels it.
+type DunningCase struct {
+	ID              int        `json:"id"`
+	OrderID         int        `json:"order_id"`
+	StripeInvoiceID string     `json:"stripe_invoice_id"`
+	AmountDue       int        `json:"amount_due"`
+	Attempt         int        `json:"attempt"`
+	NextAttemptAt   *time.Time `json:"next_attempt_at"`
+	Status          string     `json:"status"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"-"`
+}
+
+// SubscriptionEvent is a step of the timeline of a subscription, like a failed renewal
+// or a reminder sent to the customer. Attempt is the dunning attempt it belongs to, or 0.
+type SubscriptionEvent struct {
+	ID        int       `json:"id"`
+	OrderID   int       `json:"order_id"`
+	Kind      string    `json:"kind"`
+	Attempt   int       `json:"attempt"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// GetSubscriptionOrderID returns the ID of the order of a gateway subscription, which
+// subscriptions are recorded with as their payment intent
+func (m *DBWrapper) GetSubscriptionOrderID(subscriptionID string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select o.id
+		from orders o
+			join transactions t on (o.transaction_id = t.id)
+			join widgets w on (o.widget_id = w.id)
+		where t.payment_intent = ? and w.is_recurring = 1
+		order by o.id desc
+		limit 1`
+
+	var id int
+	err := m.DB.QueryRowContext(ctx, query, subscriptionID).Scan(&id)
+	return id, err
+}
+
+// StartDunning opens a dunning case for an unpaid renewal invoice, marks its subscription
+// past due and records the failure on its timeline. It reports whether a case was
+// opened; an invoice that already has one is left alone.
+func (m *DBWrapper) StartDunning(c DunningCase) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	stmt := `
+		insert ignore into dunning_cases
+			(order_id, stripe_invoice_id, amount_due, attempt, next_attempt_at, status, created_at, updated_at)
+			values (?, ?, ?, 0, ?, ?, ?, ?)`
+
+	res, err := tx.ExecContext(ctx, stmt,
+		c.OrderID, c.StripeInvoiceID, c.AmountDue, c.NextAttemptAt, DunningOpen, time.Now(), time.Now())
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	_, err = tx.ExecContext(ctx, "update orders set status_id = ?, updated_at = ? where id = ?", OrderPastDue, time.Now(), c.OrderID)
+	if err != nil {
+		return false, err
+	}
+	err = insertSubscriptionEvent(ctx, tx, SubscriptionEvent{
+		OrderID: c.OrderID,
+		Kind:    EventPaymentFailed,
+		Note:    "renewal invoice " + c.StripeInvoiceID + " could not be paid",
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// GetDueDunningCases returns the open dunning cases of past due subscriptions whose next
+// attempt is due at now
+func (m *DBWrapper) GetDueDunningCases(now time.Time) ([]DunningCase, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select d.id, d.order_id, d.stripe_invoice_id, d.amount_due, d.attempt, d.next_attempt_at,
+			d.status, d.created_at, d.updated_at
+		from dunning_cases d
+			join orders o on (d.order_id = o.id)
+		where d.status = ? and d.next_attempt_at <= ? and o.status_id = ?
+		order by d.next_attempt_at, d.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, DunningOpen, now, OrderPastDue)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cases []DunningCase
+	for rows.Next() {
+		c, err := scanDunningCase(rows)
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, c)
+	}
+	return cases, rows.Err()
+}
+
+// GetOpenDunningCase gets the open dunning case of a subscription
+func (m *DBWrapper) GetOpenDunningCase(orderID int) (DunningCase, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select id, order_id, stripe_invoice_id, amount_due, attempt, next_attempt_at, status,
+			created_at, updated_at
+		from dunning_cases
+		where order_id = ? and status = ?
+		order by id desc
+		limit 1`
+
+	return scanDunningCase(m.DB.QueryRowContext(ctx, query, orderID, DunningOpen))
+}
+
+func scanDunningCase(row scanner) (DunningCase, error) {
+	var c DunningCase
+	var next sql.NullTime
+	err := row.Scan(
+		&c.ID,
+		&c.OrderID,
+		&c.StripeInvoiceID,
+		&c.AmountDue,
+		&c.Attempt,
+		&next,
+		&c.Status,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+	)
+	if next.Valid {
+		c.NextAttemptAt = &next.Time
+	}
+	return c, err
+}
+
+// AdvanceDunning records a failed attempt of a dunning case: its attempt number, when
+// the next attempt is due, and the event e on the timeline of the subscription
+func (m *DBWrapper) AdvanceDunning(c DunningCase, e SubscriptionEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		update dunning_cases set attempt = ?, next_attempt_at = ?, updated_at = ? where id = ?`,
+		c.Attempt, c.NextAttemptAt, time.Now(), c.ID)
+	if err != nil {
+		return err
+	}
+	if err := insertSubscriptionEvent(ctx, tx, e); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CloseDunning ends the open dunning case of a subscription, if it has one, with status
+// DunningRecovered, which clears the subscription, or DunningCancelled, which cancels
+// it, and records the event e on its timeline
+func (m *DBWrapper) CloseDunning(orderID int, status string, e SubscriptionEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		update dunning_cases set status = ?, next_attempt_at = null, updated_at = ?
+		where order_id = ? and status = ?`,
+		status, time.Now(), orderID, DunningOpen)
+	if err != nil {
+		return err
+	}
+
+	orderStatus := OrderCleared
+	if status == DunningCancelled {
+		orderStatus = OrderCancelled
+	}
+	_, err = tx.ExecContext(ctx, "update orders set status_id = ?, updated_at = ? where id = ?", orderStatus, time.Now(), orderID)
+	if err != nil {
+		return err
+	}
+	e.OrderID = orderID
+	if err := insertSubscriptionEvent(ctx, tx, e); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddSubscriptionEvent records an event on the timeline of a subscription
+func (m *DBWrapper) AddSubscriptionEvent(e SubscriptionEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertSubscriptionEvent(ctx, m.DB, e)
+}
+
+func insertSubscriptionEvent(ctx context.Context, db execer, e SubscriptionEvent) error {
+	stmt := `
+		insert into subscription_events
+			(order_id, kind, attempt, note, created_at, updated_at)
+			values (?, ?, ?, ?, ?, ?)`
+
+	_, err := db.ExecContext(ctx, stmt, e.OrderID, e.Kind, e.Attempt, e.Note, time.Now(), time.Now())
+	return err
+}
+
+// GetSubscriptionEvents returns the timeline of a subscription, the oldest event first
+func (m *DBWrapper) GetSubscriptionEvents(orderID int) ([]*SubscriptionEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select id, order_id, kind, attempt, note, created_at
+		from subscription_events
+		where order_id = ?
+		order by created_at, id`
+
+	rows, err := m.DB.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*SubscriptionEvent
+	for rows.Next() {
+		var e SubscriptionEvent
+		if err := rows.Scan(&e.ID, &e.OrderID, &e.Kind, &e.Attempt, &e.Note, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, &e)
+	}
+	return events, rows.Err()
+}
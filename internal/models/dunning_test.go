@@ -0,0 +1,41 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"go-commerce/internal/dbtest"
+)
+
+func TestStartDunning(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	next := time.Date(2026, 10, 22, 0, 0, 0, 0, time.UTC)
+	db.Expect("insert ignore into dunning_cases").WithArgs(7, "in_1", 900, next, DunningOpen, dbtest.Any, dbtest.Any).Result(1, 1)
+	db.Expect("update orders set status_id = ?").WithArgs(OrderPastDue, dbtest.Any, 7)
+	db.Expect("insert into subscription_events").WithArgs(7, EventPaymentFailed, 0, dbtest.Any, dbtest.Any, dbtest.Any)
+
+	opened, err := m.StartDunning(DunningCase{OrderID: 7, StripeInvoiceID: "in_1", AmountDue: 900, NextAttemptAt: &next})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opened || db.Commits != 1 {
+		t.Errorf("got opened %v with %d commits", opened, db.Commits)
+	}
+}
+
+func TestStartDunningTwice(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	db.Expect("insert ignore into dunning_cases").Result(0, 0)
+
+	opened, err := m.StartDunning(DunningCase{OrderID: 7, StripeInvoiceID: "in_1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened || db.Commits != 0 {
+		t.Errorf("got opened %v with %d commits for an invoice already dunned", opened, db.Commits)
+	}
+}
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Fulfillment statuses, the IDs of fulfillment_statuses
+const (
+	FulfillmentPending   = 1
+	FulfillmentPicking   = 2
+	FulfillmentShipped   = 3
+	FulfillmentDelivered = 4
+	FulfillmentReturned  = 5
+)
+
+var (
+	// ErrFulfillmentTransition is returned when an order cannot move to a status from its current one
+	ErrFulfillmentTransition = errors.New("the order cannot move to this status")
+	// ErrNotShippable is returned when moving a subscription, which has nothing to ship
+	ErrNotShippable = errors.New("subscriptions are not shipped")
+)
+
+var fulfillmentStatusNames = map[int]string{
+	FulfillmentPending:   "pending",
+	FulfillmentPicking:   "picking",
+	FulfillmentShipped:   "shipped",
+	FulfillmentDelivered: "delivered",
+	FulfillmentReturned:  "returned",
+}
+
+// fulfillmentTransitions lists the statuses an order can move to from each status.
+// Picking can be undone while the parcel is still in the warehouse.
+var fulfillmentTransitions = map[int][]int{
+	FulfillmentPending:   {FulfillmentPicking, FulfillmentShipped},
+	FulfillmentPicking:   {FulfillmentPending, FulfillmentShipped},
+	FulfillmentShipped:   {FulfillmentDelivered, FulfillmentReturned},
+	FulfillmentDelivered: {FulfillmentReturned},
+}
+
+// FulfillmentStatusName returns the name of a fulfillment status, like "shipped"
+func FulfillmentStatusName(id int) string {
+	return fulfillmentStatusNames[id]
+}
+
+// FulfillmentStatusID returns the ID of the fulfillment status called name
+func FulfillmentStatusID(name string) (int, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for id, n := range fulfillmentStatusNames {
+		if n == name {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// CanFulfil reports whether an order can move from one fulfillment status to another
+func CanFulfil(from, to int) bool {
+	for _, next := range fulfillmentTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// FulfillmentEvent is a timestamped move of an order from one fulfillment status to
+// another. UserID is the admin user who moved it, or 0.
+type FulfillmentEvent struct {
+	ID             int       `json:"id"`
+	OrderID        int       `json:"order_id"`
+	FromStatusID   int       `json:"from_status_id"`
+	FromStatus     string    `json:"from_status"`
+	ToStatusID     int       `json:"to_status_id"`
+	ToStatus       string    `json:"to_status"`
+	Carrier        string    `json:"carrier"`
+	TrackingNumber string    `json:"tracking_number"`
+	Note           string    `json:"note"`
+	UserID         int       `json:"user_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"-"`
+}
+
+// MoveOrder moves a sale to the fulfillment status e.ToStatusID and records the move.
+// The carrier and tracking number of the order are kept unless e sets them. It returns
+// ErrFulfillmentTransition when the move is not allowed from the order's current status.
+func (m *DBWrapper) MoveOrder(e FulfillmentEvent) (FulfillmentEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return e, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		select o.fulfillment_status_id, o.carrier, o.tracking_number, coalesce(w.is_recurring, 0)
+		from orders o
+			left join widgets w on (o.widget_id = w.id)
+		where o.id = ?
+		for update`
+
+	var carrier, trackingNumber string
+	var recurring bool
+	err = tx.QueryRowContext(ctx, query, e.OrderID).Scan(&e.FromStatusID, &carrier, &trackingNumber, &recurring)
+	if err != nil {
+		return e, err
+	}
+	if recurring {
+		return e, ErrNotShippable
+	}
+	if !CanFulfil(e.FromStatusID, e.ToStatusID) {
+		return e, ErrFulfillmentTransition
+	}
+	if e.Carrier == "" {
+		e.Carrier = carrier
+	}
+	if e.TrackingNumber == "" {
+		e.TrackingNumber = trackingNumber
+	}
+	e.CreatedAt, e.UpdatedAt = time.Now(), time.Now()
+
+	stmt := `
+		update orders
+		set fulfillment_status_id = ?, carrier = ?, tracking_number = ?, updated_at = ?
+		where id = ?`
+	_, err = tx.ExecContext(ctx, stmt, e.ToStatusID, e.Carrier, e.TrackingNumber, e.UpdatedAt, e.OrderID)
+	if err != nil {
+		return e, err
+	}
+
+	stmt = `
+		insert into fulfillment_events
+			(order_id, from_status_id, to_status_id, carrier, tracking_number, note, user_id, created_at, updated_at)
+			values (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.ExecContext(ctx, stmt,
+		e.OrderID,
+		e.FromStatusID,
+		e.ToStatusID,
+		e.Carrier,
+		e.TrackingNumber,
+		e.Note,
+		nullID(e.UserID),
+		e.CreatedAt,
+		e.UpdatedAt,
+	)
+	if err != nil {
+		return e, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return e, err
+	}
+	e.ID = int(id)
+	e.FromStatus, e.ToStatus = FulfillmentStatusName(e.FromStatusID), FulfillmentStatusName(e.ToStatusID)
+
+	return e, tx.Commit()
+}
+
+// GetFulfillmentEvents returns the fulfillment history of an order, oldest first
+func (m *DBWrapper) GetFulfillmentEvents(orderID int) ([]*FulfillmentEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select id, order_id, from_status_id, to_status_id, carrier, tracking_number, note,
+			coalesce(user_id, 0), created_at, updated_at
+		from fulfillment_events
+		where order_id = ?
+		order by created_at, id`
+
+	rows, err := m.DB.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*FulfillmentEvent{}
+	for rows.Next() {
+		var e FulfillmentEvent
+		err = rows.Scan(&e.ID, &e.OrderID, &e.FromStatusID, &e.ToStatusID, &e.Carrier, &e.TrackingNumber,
+			&e.Note, &e.UserID, &e.CreatedAt, &e.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		e.FromStatus, e.ToStatus = FulfillmentStatusName(e.FromStatusID), FulfillmentStatusName(e.ToStatusID)
+		events = append(events, &e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"testing"
+
+	"go-commerce/internal/dbtest"
+)
+
+func TestCanFulfil(t *testing.T) {
+	allowed := map[[2]int]bool{
+		{FulfillmentPending, FulfillmentPicking}:    true,
+		{FulfillmentPending, FulfillmentShipped}:    true,
+		{FulfillmentPicking, FulfillmentPending}:    true,
+		{FulfillmentPicking, FulfillmentShipped}:    true,
+		{FulfillmentShipped, FulfillmentDelivered}:  true,
+		{FulfillmentShipped, FulfillmentReturned}:   true,
+		{FulfillmentDelivered, FulfillmentReturned}: true,
+	}
+	for from := FulfillmentPending; from <= FulfillmentReturned; from++ {
+		for to := FulfillmentPending; to <= FulfillmentReturned; to++ {
+			if got := CanFulfil(from, to); got != allowed[[2]int{from, to}] {
+				t.Errorf("CanFulfil(%s, %s) = %v", FulfillmentStatusName(from), FulfillmentStatusName(to), got)
+			}
+		}
+	}
+}
+
+func TestFulfillmentStatusID(t *testing.T) {
+	if id, ok := FulfillmentStatusID(" Shipped "); !ok || id != FulfillmentShipped {
+		t.Errorf("got %d, %v", id, ok)
+	}
+	if _, ok := FulfillmentStatusID("lost"); ok {
+		t.Error("found a status called lost")
+	}
+}
+
+func TestMoveOrder(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	db.Expect("from orders o left join widgets w on (o.widget_id = w.id) where o.id = ? for update").
+		WithArgs(5).
+		Rows([]interface{}{FulfillmentPicking, "DHL", "", false})
+	update := db.Expect("update orders set fulfillment_status_id = ?")
+	insert := db.Expect("insert into fulfillment_events").Result(9, 1)
+
+	e, err := m.MoveOrder(FulfillmentEvent{OrderID: 5, ToStatusID: FulfillmentShipped, TrackingNumber: "JJD0001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != 9 || e.FromStatus != "picking" || e.ToStatus != "shipped" || e.Carrier != "DHL" {
+		t.Errorf("got %+v", e)
+	}
+	if update.Args[0] != int64(FulfillmentShipped) || update.Args[1] != "DHL" || update.Args[2] != "JJD0001" {
+		t.Errorf("updated with %v", update.Args)
+	}
+	if insert.Args[6] != nil {
+		t.Errorf("recorded user %v for a move without a user", insert.Args[6])
+	}
+	if db.Commits != 1 {
+		t.Errorf("got %d commits", db.Commits)
+	}
+}
+
+func TestMoveOrderRefusesMoves(t *testing.T) {
+	tests := []struct {
+		status    int
+		recurring bool
+		want      error
+	}{
+		{FulfillmentDelivered, false, ErrFulfillmentTransition},
+		{FulfillmentPending, true, ErrNotShippable},
+	}
+	for _, tt := range tests {
+		db := dbtest.New(t)
+		m := DBWrapper{DB: db.SQL}
+
+		db.Expect("for update").Rows([]interface{}{tt.status, "", "", tt.recurring})
+
+		e, err := m.MoveOrder(FulfillmentEvent{OrderID: 5, ToStatusID: FulfillmentPicking})
+		if err != tt.want {
+			t.Errorf("got %v, want %v", err, tt.want)
+		}
+		if e.FromStatusID != tt.status {
+			t.Errorf("got from status %d", e.FromStatusID)
+		}
+		if db.Commits != 0 || db.Rollbacks != 1 {
+			t.Errorf("got %d commits and %d rollbacks", db.Commits, db.Rollbacks)
+		}
+	}
+}
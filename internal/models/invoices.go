@@ -0,0 +1,325 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Invoice kinds. Credit notes are numbered in a sequence of their own.
+const (
+	InvoiceKindInvoice    = "invoice"
+	InvoiceKindCreditNote = "credit_note"
+)
+
+var (
+	// ErrUnknownLegalEntity is returned when an invoice is issued for a legal entity that
+	// has no invoice sequence
+	ErrUnknownLegalEntity = errors.New("no invoice sequence for this legal entity")
+	// ErrOverCredited is returned for a credit note that would credit more than is left
+	// of its invoice
+	ErrOverCredited = errors.New("the credit notes of an invoice cannot credit more than its amount")
+	// ErrInvoiced is returned with the invoice of an order that was invoiced already
+	ErrInvoiced = errors.New("the order has been invoiced already")
+)
+
+// Invoice is an invoice, or a credit note, issued by a legal entity. Number is the
+// prefix of the entity followed by Sequence, its place in the gap-free sequence of the
+// entity's invoices or credit notes. A credit note credits Amount of the invoice
+// CreditedInvoiceID, numbered CreditedNumber, for a refund identified by Reference;
+// Credited is how much the credit notes of an invoice credit it. The PDF is kept in the
+// blob store under BlobKey.
+type Invoice struct {
+	ID                int        `json:"id"`
+	Number            string     `json:"number"`
+	Kind              string     `json:"kind"`
+	LegalEntity       string     `json:"legal_entity"`
+	Sequence          int        `json:"sequence"`
+	OrderID           int        `json:"order_id,omitempty"`
+	CreditedInvoiceID int        `json:"credited_invoice_id,omitempty"`
+	CreditedNumber    string     `json:"credited_number,omitempty"`
+	Reference         string     `json:"reference,omitempty"`
+	Reason            string     `json:"reason,omitempty"`
+	Email             string     `json:"email"`
+	Amount            int        `json:"amount"`
+	Credited          int        `json:"credited"`
+	Currency          string     `json:"currency"`
+	BlobKey           string     `json:"blob_key"`
+	Size              int        `json:"size"`
+	IssuedAt          time.Time  `json:"issued_at"`
+	CreditNotes       []*Invoice `json:"credit_notes,omitempty"`
+	CreatedAt         time.Time  `json:"-"`
+	UpdatedAt         time.Time  `json:"-"`
+}
+
+// InvoiceNumber formats the number of an invoice from the prefix of its legal entity
+// and its place in their sequence
+func InvoiceNumber(prefix string, sequence int) string {
+	return fmt.Sprintf("%s%06d", prefix, sequence)
+}
+
+// SaveInvoiceSequence creates the sequence of a legal entity's invoices or credit notes,
+// starting at 1, or changes the prefix of its next numbers when it exists
+func (m *DBWrapper) SaveInvoiceSequence(legalEntity, kind, prefix string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		insert into invoice_sequences (legal_entity, kind, prefix, next_number, created_at, updated_at)
+			values (?, ?, ?, 1, ?, ?)
+		on duplicate key update prefix = values(prefix), updated_at = values(updated_at)`
+	_, err := m.DB.ExecContext(ctx, stmt, legalEntity, kind, prefix, time.Now(), time.Now())
+	return err
+}
+
+// IssueInvoice numbers an invoice or credit note with the next number of its kind for
+// its legal entity and saves it. store is called with the numbered invoice to render
+// and store its PDF, and sets its BlobKey and Size. The sequence stays locked until the
+// invoice is saved, and is only moved on when store and the save succeed, so numbers
+// are never skipped or used twice. An order is only invoiced once: issuing the invoice
+// of an order that has one returns that invoice and ErrInvoiced. A credit note must not
+// take the credit notes of its invoice over the invoice's amount.
+func (m *DBWrapper) IssueInvoice(inv Invoice, store func(inv *Invoice) error) (Invoice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return inv, err
+	}
+	defer tx.Rollback()
+
+	if inv.Kind == "" {
+		inv.Kind = InvoiceKindInvoice
+	}
+	if inv.Kind == InvoiceKindInvoice && inv.OrderID != 0 {
+		// the order is locked so that an order invoiced twice at once, like by a retry,
+		// only takes one number
+		var orderID int
+		if err = tx.QueryRowContext(ctx, "select id from orders where id = ? for update", inv.OrderID).Scan(&orderID); err != nil {
+			return inv, err
+		}
+		query := invoiceQuery + " where i.order_id = ? and i.kind = ? order by i.id limit 1"
+		existing, err := scanInvoice(tx.QueryRowContext(ctx, query, inv.OrderID, InvoiceKindInvoice))
+		if err == nil {
+			return existing, ErrInvoiced
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return inv, err
+		}
+	}
+	if inv.Kind == InvoiceKindCreditNote {
+		// the invoice is locked so that credit notes issued at once see each other
+		var amount, credited int
+		query := "select amount from invoices where id = ? and kind = ? for update"
+		if err = tx.QueryRowContext(ctx, query, inv.CreditedInvoiceID, InvoiceKindInvoice).Scan(&amount); err != nil {
+			return inv, err
+		}
+		query = "select coalesce(sum(amount), 0) from invoices where credited_invoice_id = ?"
+		if err = tx.QueryRowContext(ctx, query, inv.CreditedInvoiceID).Scan(&credited); err != nil {
+			return inv, err
+		}
+		if credited+inv.Amount > amount {
+			return inv, ErrOverCredited
+		}
+	}
+
+	var seqID int
+	var prefix string
+	query := "select id, prefix, next_number from invoice_sequences where legal_entity = ? and kind = ? for update"
+	err = tx.QueryRowContext(ctx, query, inv.LegalEntity, inv.Kind).Scan(&seqID, &prefix, &inv.Sequence)
+	if err == sql.ErrNoRows {
+		return inv, ErrUnknownLegalEntity
+	}
+	if err != nil {
+		return inv, err
+	}
+	inv.Number = InvoiceNumber(prefix, inv.Sequence)
+	inv.IssuedAt = time.Now()
+
+	if err = store(&inv); err != nil {
+		return inv, err
+	}
+
+	var reference interface{}
+	if inv.Reference != "" {
+		reference = inv.Reference
+	}
+	stmt := `
+		insert into invoices
+			(number, kind, legal_entity, sequence, order_id, credited_invoice_id, reference, reason, email, amount,
+			currency, blob_key, size, issued_at, created_at, updated_at)
+			values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.ExecContext(ctx, stmt,
+		inv.Number,
+		inv.Kind,
+		inv.LegalEntity,
+		inv.Sequence,
+		nullID(inv.OrderID),
+		nullID(inv.CreditedInvoiceID),
+		reference,
+		inv.Reason,
+		inv.Email,
+		inv.Amount,
+		inv.Currency,
+		inv.BlobKey,
+		inv.Size,
+		inv.IssuedAt,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return inv, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return inv, err
+	}
+	inv.ID = int(id)
+
+	_, err = tx.ExecContext(ctx, "update invoice_sequences set next_number = next_number + 1, updated_at = ? where id = ?",
+		time.Now(), seqID)
+	if err != nil {
+		return inv, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return inv, err
+	}
+	return inv, nil
+}
+
+const invoiceQuery = `
+	select i.id, i.number, i.kind, i.legal_entity, i.sequence, coalesce(i.order_id, 0),
+		coalesce(i.credited_invoice_id, 0), coalesce(c.number, ''), coalesce(i.reference, ''), i.reason, i.email,
+		i.amount, (select coalesce(sum(n.amount), 0) from invoices n where n.credited_invoice_id = i.id),
+		i.currency, i.blob_key, i.size, i.issued_at, i.created_at, i.updated_at
+	from invoices i
+		left join invoices c on (c.id = i.credited_invoice_id)`
+
+func scanInvoice(row scanner) (Invoice, error) {
+	var inv Invoice
+	err := row.Scan(
+		&inv.ID,
+		&inv.Number,
+		&inv.Kind,
+		&inv.LegalEntity,
+		&inv.Sequence,
+		&inv.OrderID,
+		&inv.CreditedInvoiceID,
+		&inv.CreditedNumber,
+		&inv.Reference,
+		&inv.Reason,
+		&inv.Email,
+		&inv.Amount,
+		&inv.Credited,
+		&inv.Currency,
+		&inv.BlobKey,
+		&inv.Size,
+		&inv.IssuedAt,
+		&inv.CreatedAt,
+		&inv.UpdatedAt,
+	)
+	return inv, err
+}
+
+// GetInvoice returns an invoice or credit note by number. Invoices come with their
+// credit notes, the oldest first.
+func (m *DBWrapper) GetInvoice(number string) (Invoice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	inv, err := scanInvoice(m.DB.QueryRowContext(ctx, invoiceQuery+" where i.number = ?", number))
+	if err != nil || inv.Kind != InvoiceKindInvoice {
+		return inv, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, invoiceQuery+" where i.credited_invoice_id = ? order by i.id", inv.ID)
+	if err != nil {
+		return inv, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		note, err := scanInvoice(rows)
+		if err != nil {
+			return inv, err
+		}
+		inv.CreditNotes = append(inv.CreditNotes, &note)
+	}
+	return inv, rows.Err()
+}
+
+// GetInvoiceForOrder returns the invoice issued for an order
+func (m *DBWrapper) GetInvoiceForOrder(orderID int) (Invoice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := invoiceQuery + " where i.order_id = ? and i.kind = ? order by i.id limit 1"
+	return scanInvoice(m.DB.QueryRowContext(ctx, query, orderID, InvoiceKindInvoice))
+}
+
+// GetInvoiceByReference returns the credit note issued for a refund
+func (m *DBWrapper) GetInvoiceByReference(reference string) (Invoice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanInvoice(m.DB.QueryRowContext(ctx, invoiceQuery+" where i.reference = ?", reference))
+}
+
+// InvoiceFilter filters invoices and credit notes. Zero values do not filter.
+type InvoiceFilter struct {
+	From     time.Time // issued at or after
+	To       time.Time // issued before
+	Kind     string
+	Currency string
+}
+
+// EachInvoice calls fn for every invoice and credit note matching f, in the order they
+// were issued
+func (m *DBWrapper) EachInvoice(ctx context.Context, f InvoiceFilter, fn func(*Invoice) error) error {
+	var where []string
+	var args []interface{}
+	if !f.From.IsZero() {
+		where = append(where, "i.issued_at >= ?")
+		args = append(args, f.From)
+	}
+	if !f.To.IsZero() {
+		where = append(where, "i.issued_at < ?")
+		args = append(args, f.To)
+	}
+	if f.Kind != "" {
+		where = append(where, "i.kind = ?")
+		args = append(args, f.Kind)
+	}
+	if f.Currency != "" {
+		where = append(where, "i.currency = ?")
+		args = append(args, f.Currency)
+	}
+
+	query := invoiceQuery
+	if len(where) > 0 {
+		query += " where " + strings.Join(where, " and ")
+	}
+	query += " order by i.issued_at, i.id"
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(&inv); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go-commerce/internal/dbtest"
+)
+
+// storePDF pretends to store the PDF of an invoice
+func storePDF(inv *Invoice) error {
+	inv.BlobKey = inv.LegalEntity + "/" + inv.Number + ".pdf"
+	inv.Size = 1024
+	return nil
+}
+
+func TestIssueCreditNote(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	db.Expect("select amount from invoices where id = ? and kind = ? for update").WithArgs(8, InvoiceKindInvoice).Rows([]interface{}{2500})
+	db.Expect("where credited_invoice_id = ?").WithArgs(8).Rows([]interface{}{1000})
+	db.Expect("from invoice_sequences where legal_entity = ? and kind = ? for update").
+		WithArgs("widgets-ltd", InvoiceKindCreditNote).
+		Rows([]interface{}{2, "CN", 3})
+	save := db.Expect("insert into invoices").Result(12, 1)
+	db.Expect("update invoice_sequences set next_number = next_number + 1").WithArgs(dbtest.Any, 2)
+
+	note := Invoice{
+		Kind:              InvoiceKindCreditNote,
+		LegalEntity:       "widgets-ltd",
+		CreditedInvoiceID: 8,
+		Reference:         "re_1",
+		Amount:            1500,
+	}
+	note, err := m.IssueInvoice(note, storePDF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note.ID != 12 || note.Number != "CN000003" || note.BlobKey != "widgets-ltd/CN000003.pdf" {
+		t.Errorf("got %+v", note)
+	}
+	// number, kind, legal entity, sequence, order, credited invoice, reference
+	if save.Args[1] != InvoiceKindCreditNote || save.Args[5] != int64(8) || save.Args[6] != "re_1" {
+		t.Errorf("saved %v", save.Args)
+	}
+	if db.Commits != 1 {
+		t.Errorf("got %d commits", db.Commits)
+	}
+}
+
+func TestIssueCreditNoteOverCredited(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	db.Expect("select amount from invoices where id = ? and kind = ? for update").Rows([]interface{}{2500})
+	db.Expect("where credited_invoice_id = ?").Rows([]interface{}{1000})
+
+	note := Invoice{Kind: InvoiceKindCreditNote, LegalEntity: "widgets-ltd", CreditedInvoiceID: 8, Amount: 1501}
+	stored := false
+	_, err := m.IssueInvoice(note, func(*Invoice) error {
+		stored = true
+		return nil
+	})
+	if !errors.Is(err, ErrOverCredited) {
+		t.Errorf("got %v, want ErrOverCredited", err)
+	}
+	if stored || db.Commits != 0 {
+		t.Error("an over credited credit note was issued")
+	}
+}
+
+func TestIssueInvoiceKeepsNumberWhenStoreFails(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	db.Expect("select id from orders where id = ? for update").WithArgs(5).Rows([]interface{}{5})
+	db.Expect("where i.order_id = ? and i.kind = ?").WithArgs(5, InvoiceKindInvoice).NoRows()
+	db.Expect("from invoice_sequences where legal_entity = ? and kind = ? for update").
+		WithArgs("widgets-ltd", InvoiceKindInvoice).
+		Rows([]interface{}{1, "INV", 41})
+
+	failed := errors.New("bucket unavailable")
+	_, err := m.IssueInvoice(Invoice{LegalEntity: "widgets-ltd", OrderID: 5}, func(*Invoice) error { return failed })
+	if !errors.Is(err, failed) {
+		t.Errorf("got %v", err)
+	}
+	if db.Commits != 0 || db.Rollbacks != 1 {
+		t.Errorf("got %d commits and %d rollbacks; number 41 must not be used", db.Commits, db.Rollbacks)
+	}
+}
+
+func TestIssueInvoiceOncePerOrder(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	// a retry of the same order was invoiced while this one waited for the lock
+	now := time.Now()
+	db.Expect("select id from orders where id = ? for update").WithArgs(5).Rows([]interface{}{5})
+	db.Expect("where i.order_id = ? and i.kind = ?").WithArgs(5, InvoiceKindInvoice).Rows([]interface{}{
+		7, "INV000041", InvoiceKindInvoice, "widgets-ltd", 41, 5, 0, "", "", "", "ada@example.com",
+		1000, 0, "usd", "widgets-ltd/INV000041.pdf", 1024, now, now, now,
+	})
+
+	stored := false
+	inv, err := m.IssueInvoice(Invoice{LegalEntity: "widgets-ltd", OrderID: 5}, func(*Invoice) error {
+		stored = true
+		return nil
+	})
+	if !errors.Is(err, ErrInvoiced) {
+		t.Fatalf("got %v, want ErrInvoiced", err)
+	}
+	if inv.ID != 7 || inv.Number != "INV000041" {
+		t.Errorf("got %+v, want the order's invoice", inv)
+	}
+	if stored || db.Commits != 0 {
+		t.Error("the order was invoiced twice")
+	}
+}
+
+func TestIssueInvoiceUnknownLegalEntity(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	db.Expect("from invoice_sequences").NoRows()
+
+	if _, err := m.IssueInvoice(Invoice{LegalEntity: "other"}, storePDF); !errors.Is(err, ErrUnknownLegalEntity) {
+		t.Errorf("got %v, want ErrUnknownLegalEntity", err)
+	}
+}
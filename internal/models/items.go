@@ -0,0 +1,58 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// OrderItem is a line of an order. WidgetID is zero for a custom line, like a service
+// charged at the virtual terminal.
+type OrderItem struct {
+	ID          int    `json:"id"`
+	WidgetID    int    `json:"widget_id"`
+	Description string `json:"description"`
+	Quantity    int    `json:"quantity"`
+	UnitAmount  int    `json:"unit_amount"`
+	Amount      int    `json:"amount"`
+}
+
+func insertOrderItems(ctx context.Context, tx *sql.Tx, orderID int, items []OrderItem) error {
+	stmt := `
+		insert into order_items
+			(order_id, widget_id, description, quantity, unit_amount, amount, created_at, updated_at)
+			values (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	for _, it := range items {
+		_, err := tx.ExecContext(ctx, stmt,
+			orderID, nullID(it.WidgetID), it.Description, it.Quantity, it.UnitAmount, it.Amount, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *DBWrapper) getOrderItems(ctx context.Context, orderID int) ([]OrderItem, error) {
+	query := `
+		select id, coalesce(widget_id, 0), description, quantity, unit_amount, amount
+		from order_items
+		where order_id = ?
+		order by id`
+
+	rows, err := m.DB.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []OrderItem
+	for rows.Next() {
+		var it OrderItem
+		if err := rows.Scan(&it.ID, &it.WidgetID, &it.Description, &it.Quantity, &it.UnitAmount, &it.Amount); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
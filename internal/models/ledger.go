@@ -0,0 +1,580 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go-commerce/internal/ledger"
+)
+
+// The ledger is posted from the payments, refunds, disputes, fees and payouts recorded
+// elsewhere: PostLedger finds the money movements that have no journal entry yet and
+// posts one for each. Each entry has the reference of the movement it records, so a
+// movement is posted once however often PostLedger runs. The database refuses to change
+// or delete journal entries and their lines.
+
+// postBatch is how many movements of each kind PostLedger posts at most in a run
+const postBatch = 500
+
+// Ledger consistency checks
+const (
+	CheckUnbalanced   = "unbalanced"
+	CheckUnposted     = "unposted"
+	CheckMismatch     = "mismatch"
+	CheckOverRefunded = "over_refunded"
+	CheckDoublePosted = "double_posted"
+)
+
+// TrialBalanceLine is the debits, credits and balance of an account. The balance is
+// positive on the normal side of the account: debits less credits for assets and
+// expenses, credits less debits for liabilities and income.
+type TrialBalanceLine struct {
+	Account string `json:"account"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Debits  int    `json:"debits"`
+	Credits int    `json:"credits"`
+	Balance int    `json:"balance"`
+}
+
+// TrialBalance lists the accounts of the ledger in one currency at the end of a day.
+// The ledger balances when the debits of all accounts add up to their credits.
+type TrialBalance struct {
+	AsOf     string             `json:"as_of"`
+	Currency string             `json:"currency"`
+	Accounts []TrialBalanceLine `json:"accounts"`
+	Debits   int                `json:"debits"`
+	Credits  int                `json:"credits"`
+	Balanced bool               `json:"balanced"`
+}
+
+// LedgerProblem is something CheckLedger found wrong with the ledger
+type LedgerProblem struct {
+	Check     string `json:"check"`
+	Reference string `json:"reference"`
+	Detail    string `json:"detail"`
+}
+
+// LedgerCheck is the outcome of CheckLedger
+type LedgerCheck struct {
+	Entries  int             `json:"entries"`
+	Problems []LedgerProblem `json:"problems"`
+}
+
+// PostLedger posts a journal entry for each money movement made before before that has
+// none yet, and returns how many were posted. A movement that cannot be posted does not
+// hold up the others; the first error is returned once they are posted.
+func (m *DBWrapper) PostLedger(ctx context.Context, before time.Time) (int, error) {
+	accounts, err := m.ledgerAccounts(ctx)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := m.unpostedEntries(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	var firstErr error
+	for _, e := range entries {
+		ok, err := m.postEntry(ctx, accounts, e)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("posting %s: %w", e.Reference, err)
+		}
+		if ok {
+			n++
+		}
+	}
+	return n, firstErr
+}
+
+// ledgerAccounts returns the IDs of the accounts by code
+func (m *DBWrapper) ledgerAccounts(ctx context.Context) (map[string]int, error) {
+	rows, err := m.DB.QueryContext(ctx, "select id, code from ledger_accounts")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := make(map[string]int)
+	for rows.Next() {
+		var id int
+		var code string
+		if err = rows.Scan(&id, &code); err != nil {
+			return nil, err
+		}
+		accounts[code] = id
+	}
+	return accounts, rows.Err()
+}
+
+// postEntry posts a journal entry with its lines and reports whether it was posted; an
+// entry whose reference was already posted is left out
+func (m *DBWrapper) postEntry(ctx context.Context, accounts map[string]int, e ledger.Entry) (bool, error) {
+	if err := e.Validate(); err != nil {
+		return false, err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	stmt := `
+		insert ignore into journal_entries
+			(reference, kind, currency, memo, transaction_id, order_id, dispute_id, payout_id, occurred_at, created_at, updated_at)
+			values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.ExecContext(ctx, stmt,
+		e.Reference,
+		e.Kind,
+		e.Currency,
+		e.Memo,
+		nullID(e.TransactionID),
+		nullID(e.OrderID),
+		nullID(e.DisputeID),
+		nullID(e.PayoutID),
+		e.OccurredAt,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return false, err
+	}
+
+	for _, l := range e.Lines {
+		_, err = tx.ExecContext(ctx, `
+			insert into journal_lines (entry_id, account_id, debit, credit, created_at, updated_at)
+			values (?, ?, ?, ?, ?, ?)`,
+			id, accounts[l.Account], l.Debit, l.Credit, time.Now(), time.Now())
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+// notPosted is the condition that no journal entry has the reference prefix followed by
+// the ID in column
+func notPosted(prefix, column string) string {
+	return fmt.Sprintf("not exists (select 1 from journal_entries j where j.reference = concat('%s', %s))", prefix, column)
+}
+
+// posted is the condition that a journal entry has the reference prefix followed by the
+// ID in column
+func posted(prefix, column string) string {
+	return fmt.Sprintf("exists (select 1 from journal_entries j where j.reference = concat('%s', %s))", prefix, column)
+}
+
+// orderTax is the tax collected on the order o
+const orderTax = "coalesce((select sum(l.amount) from order_tax_lines l where l.order_id = o.id), 0)"
+
+// returnsRefunded is what the refunded returns of the order o gave back. It takes
+// ReturnRefunded as its argument.
+const returnsRefunded = "coalesce((select sum(r.amount) from returns r where r.order_id = o.id and r.status = ?), 0)"
+
+// collectEntries runs a query for unposted movements and builds an entry from each row
+func (m *DBWrapper) collectEntries(ctx context.Context, query string, args []interface{}, build func(scanner) (ledger.Entry, error)) ([]ledger.Entry, error) {
+	rows, err := m.DB.QueryContext(ctx, query+fmt.Sprintf(" limit %d", postBatch), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []ledger.Entry
+	for rows.Next() {
+		e, err := build(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// unpostedEntries builds the journal entries of the money movements made before before
+// that have not been posted: charges first, then refunds, fees, disputes and payouts
+func (m *DBWrapper) unpostedEntries(ctx context.Context, before time.Time) ([]ledger.Entry, error) {
+	sources := []struct {
+		query string
+		args  []interface{}
+		build func(scanner) (ledger.Entry, error)
+	}{
+		{
+			// charges of our sales and subscriptions, once cleared
+			query: `
+				select t.id, coalesce(o.id, 0), t.amount, t.currency, t.created_at, ` + orderTax + `
+				from transactions t
+					left join orders o on (o.transaction_id = t.id)
+				where t.transaction_status_id in (?, ?, ?) and t.amount > 0 and t.created_at < ?
+					and ` + notPosted("charge:txn:", "t.id") + `
+				order by t.id`,
+			args: []interface{}{TransactionCleared, TransactionRefunded, TransactionPartiallyRefunded, before},
+			build: func(row scanner) (ledger.Entry, error) {
+				e := ledger.Entry{Kind: ledger.KindCharge}
+				var amount, tax int
+				err := row.Scan(&e.TransactionID, &e.OrderID, &amount, &e.Currency, &e.OccurredAt, &tax)
+				e.Reference = fmt.Sprintf("charge:txn:%d", e.TransactionID)
+				e.Memo = fmt.Sprintf("Order %d", e.OrderID)
+				if e.OrderID == 0 {
+					e.Memo = fmt.Sprintf("Transaction %d", e.TransactionID)
+				}
+				e.Lines = ledger.Charge(amount, tax)
+				return e, err
+			},
+		},
+		{
+			// charges paid out that are not ours, like subscription renewals
+			query: `
+				select bt.id, bt.payout_id, bt.charge_id, bt.amount, bt.currency, bt.occurred_at
+				from balance_transactions bt
+				where bt.type in (?, ?) and bt.transaction_id is null and bt.occurred_at < ?
+					and ` + notPosted("charge:bt:", "bt.id") + `
+				order by bt.id`,
+			args: []interface{}{BalanceCharge, BalancePayment, before},
+			build: func(row scanner) (ledger.Entry, error) {
+				e := ledger.Entry{Kind: ledger.KindCharge}
+				var id, amount int
+				var chargeID string
+				err := row.Scan(&id, &e.PayoutID, &chargeID, &amount, &e.Currency, &e.OccurredAt)
+				e.Reference = fmt.Sprintf("charge:bt:%d", id)
+				e.Memo = "Charge " + chargeID
+				e.Lines = ledger.Charge(amount, 0)
+				return e, err
+			},
+		},
+		{
+			// refunded returns
+			query: `
+				select r.id, o.id, t.id, r.amount, t.amount, t.currency, r.updated_at, ` + orderTax + `
+				from returns r
+					join orders o on (r.order_id = o.id)
+					join transactions t on (o.transaction_id = t.id)
+				where r.status = ? and r.amount > 0 and r.updated_at < ?
+					and ` + notPosted("refund:return:", "r.id") + `
+				order by r.id`,
+			args: []interface{}{ReturnRefunded, before},
+			build: func(row scanner) (ledger.Entry, error) {
+				e := ledger.Entry{Kind: ledger.KindRefund}
+				var id, refunded, amount, tax int
+				err := row.Scan(&id, &e.OrderID, &e.TransactionID, &refunded, &amount, &e.Currency, &e.OccurredAt, &tax)
+				e.Reference = fmt.Sprintf("refund:return:%d", id)
+				e.Memo = fmt.Sprintf("Return %d of order %d", id, e.OrderID)
+				e.Lines = ledger.Refund(refunded, ledger.RefundTax(refunded, amount, tax))
+				return e, err
+			},
+		},
+		{
+			// refunded sales, less what their refunded returns already gave back
+			query: `
+				select o.id, t.id, t.amount - ` + returnsRefunded + `, t.amount, t.currency, o.refunded_at, ` + orderTax + `
+				from orders o
+					join transactions t on (o.transaction_id = t.id)
+				where o.status_id = ? and t.amount > ` + returnsRefunded + ` and o.refunded_at < ?
+					and ` + notPosted("refund:order:", "o.id") + `
+				order by o.id`,
+			args: []interface{}{ReturnRefunded, OrderRefunded, ReturnRefunded, before},
+			build: func(row scanner) (ledger.Entry, error) {
+				e := ledger.Entry{Kind: ledger.KindRefund}
+				var refunded, amount, tax int
+				err := row.Scan(&e.OrderID, &e.TransactionID, &refunded, &amount, &e.Currency, &e.OccurredAt, &tax)
+				e.Reference = fmt.Sprintf("refund:order:%d", e.OrderID)
+				e.Memo = fmt.Sprintf("Refund of order %d", e.OrderID)
+				e.Lines = ledger.Refund(refunded, ledger.RefundTax(refunded, amount, tax))
+				return e, err
+			},
+		},
+		{
+			// refunds paid out of charges that are not ours
+			query: `
+				select bt.id, bt.payout_id, bt.charge_id, -bt.amount, bt.currency, bt.occurred_at
+				from balance_transactions bt
+				where bt.type in (?, ?) and bt.transaction_id is null and bt.occurred_at < ?
+					and ` + notPosted("refund:bt:", "bt.id") + `
+				order by bt.id`,
+			args: []interface{}{BalanceRefund, BalancePaymentRefund, before},
+			build: func(row scanner) (ledger.Entry, error) {
+				e := ledger.Entry{Kind: ledger.KindRefund}
+				var id, amount int
+				var chargeID string
+				err := row.Scan(&id, &e.PayoutID, &chargeID, &amount, &e.Currency, &e.OccurredAt)
+				e.Reference = fmt.Sprintf("refund:bt:%d", id)
+				e.Memo = "Refund of charge " + chargeID
+				e.Lines = ledger.Refund(amount, 0)
+				return e, err
+			},
+		},
+		{
+			// gateway fees
+			query: `
+				select bt.id, bt.payout_id, coalesce(bt.transaction_id, 0), bt.type, bt.source_id, bt.fee, bt.currency, bt.occurred_at
+				from balance_transactions bt
+				where bt.fee <> 0 and bt.occurred_at < ?
+					and ` + notPosted("fee:bt:", "bt.id") + `
+				order by bt.id`,
+			args: []interface{}{before},
+			build: func(row scanner) (ledger.Entry, error) {
+				e := ledger.Entry{Kind: ledger.KindFee}
+				var id, fee int
+				var btType, sourceID string
+				err := row.Scan(&id, &e.PayoutID, &e.TransactionID, &btType, &sourceID, &fee, &e.Currency, &e.OccurredAt)
+				e.Reference = fmt.Sprintf("fee:bt:%d", id)
+				e.Memo = fmt.Sprintf("Fee on %s %s", btType, sourceID)
+				e.Lines = ledger.Fee(fee)
+				return e, err
+			},
+		},
+		{
+			// chargebacks; inquiries take no money until they become one
+			query: `
+				select d.id, coalesce(d.transaction_id, 0), coalesce(d.order_id, 0), d.stripe_dispute_id, d.amount,
+					d.currency, d.opened_at
+				from disputes d
+				where d.status not in (?, ?, ?) and d.opened_at < ?
+					and ` + notPosted("dispute:", "d.id") + `
+				order by d.id`,
+			args: []interface{}{DisputeWarningNeedsResponse, DisputeWarningUnderReview, DisputeWarningClosed, before},
+			build: func(row scanner) (ledger.Entry, error) {
+				e := ledger.Entry{Kind: ledger.KindDispute}
+				var amount int
+				var stripeID string
+				err := row.Scan(&e.DisputeID, &e.TransactionID, &e.OrderID, &stripeID, &amount, &e.Currency, &e.OccurredAt)
+				e.Reference = fmt.Sprintf("dispute:%d", e.DisputeID)
+				e.Memo = "Dispute " + stripeID
+				e.Lines = ledger.DisputeOpened(amount)
+				return e, err
+			},
+		},
+		{
+			// chargebacks won, once the chargeback was posted
+			query: `
+				select d.id, coalesce(d.transaction_id, 0), coalesce(d.order_id, 0), d.stripe_dispute_id, d.amount,
+					d.currency, d.updated_at
+				from disputes d
+				where d.status = ? and d.updated_at < ?
+					and ` + posted("dispute:", "d.id") + ` and ` + notPosted("dispute_won:", "d.id") + `
+				order by d.id`,
+			args: []interface{}{DisputeWon, before},
+			build: func(row scanner) (ledger.Entry, error) {
+				e := ledger.Entry{Kind: ledger.KindDisputeWon}
+				var amount int
+				var stripeID string
+				err := row.Scan(&e.DisputeID, &e.TransactionID, &e.OrderID, &stripeID, &amount, &e.Currency, &e.OccurredAt)
+				e.Reference = fmt.Sprintf("dispute_won:%d", e.DisputeID)
+				e.Memo = "Dispute " + stripeID + " won"
+				e.Lines = ledger.DisputeWon(amount)
+				return e, err
+			},
+		},
+		{
+			// payouts paid into the bank
+			query: `
+				select p.id, p.stripe_payout_id, p.amount, p.currency, p.arrival_date
+				from payouts p
+				where p.status = ? and p.arrival_date < ?
+					and ` + notPosted("payout:", "p.id") + `
+				order by p.id`,
+			args: []interface{}{PayoutPaid, before},
+			build: func(row scanner) (ledger.Entry, error) {
+				e := ledger.Entry{Kind: ledger.KindPayout}
+				var amount int
+				var stripeID string
+				err := row.Scan(&e.PayoutID, &stripeID, &amount, &e.Currency, &e.OccurredAt)
+				e.Reference = fmt.Sprintf("payout:%d", e.PayoutID)
+				e.Memo = "Payout " + stripeID
+				e.Lines = ledger.Payout(amount)
+				return e, err
+			},
+		},
+		{
+			// payouts that failed or were canceled after they were posted as paid
+			query: `
+				select p.id, p.stripe_payout_id, p.amount, p.currency, p.updated_at
+				from payouts p
+				where p.status in (?, ?) and p.updated_at < ?
+					and ` + posted("payout:", "p.id") + ` and ` + notPosted("payout_reversal:", "p.id") + `
+				order by p.id`,
+			args: []interface{}{PayoutFailed, PayoutCanceled, before},
+			build: func(row scanner) (ledger.Entry, error) {
+				e := ledger.Entry{Kind: ledger.KindPayoutReversal}
+				var amount int
+				var stripeID string
+				err := row.Scan(&e.PayoutID, &stripeID, &amount, &e.Currency, &e.OccurredAt)
+				e.Reference = fmt.Sprintf("payout_reversal:%d", e.PayoutID)
+				e.Memo = "Payout " + stripeID + " reversed"
+				e.Lines = ledger.PayoutReversed(amount)
+				return e, err
+			},
+		},
+	}
+
+	var entries []ledger.Entry
+	for _, s := range sources {
+		found, err := m.collectEntries(ctx, s.query, s.args, s.build)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, found...)
+	}
+	return entries, nil
+}
+
+// GetTrialBalance returns the balance of every account in currency at the start of to
+func (m *DBWrapper) GetTrialBalance(to time.Time, currency string) (TrialBalance, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	to = truncateDay(to)
+	tb := TrialBalance{
+		AsOf:     to.AddDate(0, 0, -1).Format(dayLayout),
+		Currency: currency,
+		Accounts: []TrialBalanceLine{},
+	}
+
+	query := `
+		select a.code, a.name, a.type, coalesce(s.debits, 0), coalesce(s.credits, 0)
+		from ledger_accounts a
+			left join (
+				select l.account_id, sum(l.debit) as debits, sum(l.credit) as credits
+				from journal_lines l
+					join journal_entries e on (l.entry_id = e.id)
+				where e.currency = ? and e.occurred_at < ?
+				group by l.account_id
+			) s on (s.account_id = a.id)
+		order by a.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, currency, to)
+	if err != nil {
+		return tb, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l TrialBalanceLine
+		if err = rows.Scan(&l.Account, &l.Name, &l.Type, &l.Debits, &l.Credits); err != nil {
+			return tb, err
+		}
+		l.Balance = l.Credits - l.Debits
+		if ledger.DebitNormal(l.Type) {
+			l.Balance = -l.Balance
+		}
+		tb.Debits += l.Debits
+		tb.Credits += l.Credits
+		tb.Accounts = append(tb.Accounts, l)
+	}
+	if err = rows.Err(); err != nil {
+		return tb, err
+	}
+
+	tb.Balanced = tb.Debits == tb.Credits
+	return tb, nil
+}
+
+// CheckLedger checks the ledger against itself and against the movements it records. It
+// finds entries that do not balance, movements made more than unpostedAfter ago that
+// were never posted, charges posted for another amount or currency than their
+// transaction, transactions refunded for more than they were charged, and charges
+// posted both from our records and from a payout.
+func (m *DBWrapper) CheckLedger(unpostedAfter time.Duration) (LedgerCheck, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	check := LedgerCheck{Problems: []LedgerProblem{}}
+	if err := m.DB.QueryRowContext(ctx, "select count(*) from journal_entries").Scan(&check.Entries); err != nil {
+		return check, err
+	}
+
+	unposted, err := m.unpostedEntries(ctx, time.Now().Add(-unpostedAfter))
+	if err != nil {
+		return check, err
+	}
+	for _, e := range unposted {
+		check.Problems = append(check.Problems, LedgerProblem{
+			Check:     CheckUnposted,
+			Reference: e.Reference,
+			Detail:    e.Memo + " has no journal entry",
+		})
+	}
+
+	checks := []struct {
+		check string
+		query string
+		args  []interface{}
+	}{
+		{
+			CheckUnbalanced, `
+				select e.reference, concat('debits ', sum(l.debit), ' and credits ', sum(l.credit), ' differ')
+				from journal_entries e
+					left join journal_lines l on (l.entry_id = e.id)
+				group by e.id, e.reference
+				having coalesce(sum(l.debit), 0) <> coalesce(sum(l.credit), 0) or count(l.id) < 2`,
+			nil,
+		},
+		{
+			CheckMismatch, `
+				select e.reference, concat('posted ', sum(l.debit), ' ', e.currency, ' for a transaction of ', t.amount, ' ', t.currency)
+				from journal_entries e
+					join transactions t on (e.transaction_id = t.id)
+					join journal_lines l on (l.entry_id = e.id)
+					join ledger_accounts a on (l.account_id = a.id)
+				where e.kind = ? and a.code = ?
+				group by e.id, e.reference, e.currency, t.amount, t.currency
+				having sum(l.debit) <> t.amount or e.currency <> t.currency`,
+			[]interface{}{ledger.KindCharge, ledger.CashInTransit},
+		},
+		{
+			CheckOverRefunded, `
+				select concat('charge:txn:', t.id), concat('refunded ', sum(l.credit), ' of a charge of ', t.amount)
+				from journal_entries e
+					join transactions t on (e.transaction_id = t.id)
+					join journal_lines l on (l.entry_id = e.id)
+					join ledger_accounts a on (l.account_id = a.id)
+				where e.kind = ? and a.code = ?
+				group by t.id, t.amount
+				having sum(l.credit) > t.amount`,
+			[]interface{}{ledger.KindRefund, ledger.CashInTransit},
+		},
+		{
+			CheckDoublePosted, `
+				select concat('charge:bt:', bt.id), concat('also posted as charge:txn:', bt.transaction_id)
+				from balance_transactions bt
+				where bt.transaction_id is not null
+					and ` + posted("charge:bt:", "bt.id") + ` and ` + posted("charge:txn:", "bt.transaction_id"),
+			nil,
+		},
+	}
+
+	for _, c := range checks {
+		rows, err := m.DB.QueryContext(ctx, c.query, c.args...)
+		if err != nil {
+			return check, err
+		}
+		for rows.Next() {
+			p := LedgerProblem{Check: c.check}
+			var detail sql.NullString
+			if err = rows.Scan(&p.Reference, &detail); err != nil {
+				rows.Close()
+				return check, err
+			}
+			p.Detail = detail.String
+			check.Problems = append(check.Problems, p)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return check, err
+		}
+	}
+
+	return check, nil
+}
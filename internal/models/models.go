@@ -8,9 +8,14 @@ import (
 	"strings"
 	"time"
 
+	"go-commerce/internal/tax"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrDuplicateEmail is returned when a user's email address is already taken
+var ErrDuplicateEmail = errors.New("duplicate email")
+
 // DBWrapper is the type for database connection
 type DBWrapper struct {
 	DB *sql.DB
@@ -27,40 +32,73 @@ func NewModels(db *sql.DB) Models {
 	}
 }
 
-// Widget is the type for widgets
+// Widget is the type for widgets. Price is the price in usd; Prices holds the price in
+// minor units for every currency the widget is sold in, keyed by lower case currency code.
+// Widgets made to order have a CaptureMethod of "manual": the card is only authorized at
+// checkout and captured when the order ships. Plans may start with a trial of TrialDays,
+// which collects no card up front unless TrialRequiresCard, and Metered plans are billed
+// by the usage reported for them rather than by seat.
 type Widget struct {
-	ID             int       `json:"id"`
-	Name           string    `json:"name"`
-	Description    string    `json:"description"`
-	InventoryLevel int       `json:"inventory_level"`
-	Price          int       `json:"price"`
-	Image          string    `json:"image"`
-	IsRecurring    bool      `json:"is_recurring"`
-	PlanID         string    `json:"plan_id"`
-	CreatedAt      time.Time `json:"-"`
-	UpdatedAt      time.Time `json:"-"`
+	ID                int            `json:"id"`
+	Name              string         `json:"name"`
+	Description       string         `json:"description"`
+	InventoryLevel    int            `json:"inventory_level"`
+	Price             int            `json:"price"`
+	Image             string         `json:"image"`
+	IsRecurring       bool           `json:"is_recurring"`
+	PlanID            string         `json:"plan_id"`
+	Weight            int            `json:"weight"`
+	CaptureMethod     string         `json:"capture_method"`
+	TrialDays         int            `json:"trial_days"`
+	TrialRequiresCard bool           `json:"trial_requires_card"`
+	Metered           bool           `json:"metered"`
+	Prices            map[string]int `json:"prices"`
+	CreatedAt         time.Time      `json:"-"`
+	UpdatedAt         time.Time      `json:"-"`
 }
 
+// Order statuses. A pending order waits for its payment to succeed; a past due
+// subscription failed to renew and is being dunned.
 const (
 	OrderCleared   = 1
 	OrderRefunded  = 2
 	OrderCancelled = 3
+	OrderPending   = 4
+	OrderPastDue   = 5
 )
 
-// Order is the type for orders
+// Order is the type for orders. The Quantity of a subscription is its number of seats;
+// one that started with a trial has a TrialEndsAt.
 type Order struct {
-	ID            int         `json:"id"`
-	WidgetID      int         `json:"widget_id"`
-	TransactionID int         `json:"transaction_id"`
-	CustomerID    int         `json:"customer_id"`
-	StatusID      int         `json:"status_id"`
-	Quantity      int         `json:"quantity"`
-	Amount        int         `json:"amount"`
-	CreatedAt     time.Time   `json:"-"`
-	UpdatedAt     time.Time   `json:"-"`
-	Widget        Widget      `json:"widget"`
-	Transaction   Transaction `json:"transaction"`
-	Customer      Customer    `json:"customer"`
+	ID                  int         `json:"id"`
+	WidgetID            int         `json:"widget_id"`
+	TransactionID       int         `json:"transaction_id"`
+	CustomerID          int         `json:"customer_id"`
+	StatusID            int         `json:"status_id"`
+	Quantity            int         `json:"quantity"`
+	Amount              int         `json:"amount"`
+	TaxJurisdiction     string      `json:"tax_jurisdiction"`
+	TaxID               string      `json:"tax_id"`
+	TaxLines            []tax.Line  `json:"tax_lines,omitempty"`
+	CouponID            int         `json:"coupon_id"`
+	CouponCode          string      `json:"coupon_code"`
+	Discount            int         `json:"discount"`
+	Shipping            int         `json:"shipping"`
+	ShippingMethod      string      `json:"shipping_method"`
+	BillingAddress      *Address    `json:"billing_address,omitempty"`
+	ShippingAddress     *Address    `json:"shipping_address,omitempty"`
+	FulfillmentStatusID int         `json:"fulfillment_status_id"`
+	FulfillmentStatus   string      `json:"fulfillment_status"`
+	Carrier             string      `json:"carrier"`
+	TrackingNumber      string      `json:"tracking_number"`
+	Note                string      `json:"note"`
+	Items               []OrderItem `json:"items,omitempty"`
+	TrialEndsAt         *time.Time  `json:"trial_ends_at,omitempty"`
+	CreatedAt           time.Time   `json:"-"`
+	UpdatedAt           time.Time   `json:"-"`
+	Widget              Widget      `json:"widget"`
+	Transaction         Transaction `json:"transaction"`
+	Customer            Customer    `json:"customer"`
 }
 
 // Status is the type for statuses
@@ -86,6 +124,8 @@ const (
 	TransactionDeclined          = 3
 	TransactionRefunded          = 4
 	TransactionPartiallyRefunded = 5
+	TransactionAuthorized        = 6
+	TransactionVoided            = 7
 )
 
 // Transaction is the type for transactions
@@ -99,9 +139,12 @@ type Transaction struct {
 	CardExpiryYear      int       `json:"expiry_year"`
 	PaymentIntent       string    `json:"payment_intent"`
 	PaymentMethod       string    `json:"payment_method"`
-	TransactionStatusID int       `json:"transaction_status_id"`
-	CreatedAt           time.Time `json:"-"`
-	UpdatedAt           time.Time `json:"-"`
+	TransactionStatusID int        `json:"transaction_status_id"`
+	CaptureBefore       *time.Time `json:"capture_before,omitempty"`
+	Fee                 int        `json:"fee"`
+	PayoutID            int        `json:"payout_id,omitempty"`
+	CreatedAt           time.Time  `json:"-"`
+	UpdatedAt           time.Time  `json:"-"`
 }
 
 // User is the type for users
@@ -115,14 +158,17 @@ type User struct {
 	UpdatedAt time.Time `json:"-"`
 }
 
-// Customer is the type for customers
+// Customer is the type for customers. StripeCustomerID is empty until a card is saved
+// for the customer.
 type Customer struct {
-	ID        int       `json:"id"`
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"-"`
-	UpdatedAt time.Time `json:"-"`
+	ID               int              `json:"id"`
+	FirstName        string           `json:"first_name"`
+	LastName         string           `json:"last_name"`
+	Email            string           `json:"email"`
+	StripeCustomerID string           `json:"stripe_customer_id"`
+	PaymentMethods   []*PaymentMethod `json:"payment_methods,omitempty"`
+	CreatedAt        time.Time        `json:"-"`
+	UpdatedAt        time.Time        `json:"-"`
 }
 
 func (w *DBWrapper) GetWidget(id int) (Widget, error) {
@@ -133,7 +179,8 @@ func (w *DBWrapper) GetWidget(id int) (Widget, error) {
 	row := w.DB.QueryRowContext(ctx, `
 		select
 			id, name, description, inventory_level, price,
-			coalesce(image, ''), is_recurring, plan_id, created_at, updated_at
+			coalesce(image, ''), is_recurring, plan_id, weight, capture_method,
+			trial_days, trial_requires_card, metered, created_at, updated_at
 		from widgets
 		where id = ?`, id)
 	if err := row.Scan(
@@ -145,25 +192,42 @@ func (w *DBWrapper) GetWidget(id int) (Widget, error) {
 		&widget.Image,
 		&widget.IsRecurring,
 		&widget.PlanID,
+		&widget.Weight,
+		&widget.CaptureMethod,
+		&widget.TrialDays,
+		&widget.TrialRequiresCard,
+		&widget.Metered,
 		&widget.CreatedAt,
 		&widget.UpdatedAt,
 	); err != nil {
 		return widget, err
 	}
+
+	prices, err := w.getWidgetPrices(ctx, widget.ID)
+	if err != nil {
+		return widget, err
+	}
+	widget.Prices = prices
 	return widget, nil
 }
 
-// InsertTransaction inserts a new transaction and returns its ID.
+// InsertTransaction inserts a new transaction and returns its ID. An authorized
+// transaction has a CaptureBefore.
 func (w *DBWrapper) InsertTransaction(txn Transaction) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	statement := `
 		insert into transactions
-			(amount, currency, last_four, bank_return_code, payment_intent, payment_method, transaction_status_id, expiry_month, expiry_year, created_at, updated_at)
-			values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			(amount, currency, last_four, bank_return_code, payment_intent, payment_method, transaction_status_id, expiry_month, expiry_year, capture_before, created_at, updated_at)
+			values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
+	var captureBefore sql.NullTime
+	if txn.CaptureBefore != nil {
+		captureBefore = sql.NullTime{Time: *txn.CaptureBefore, Valid: true}
+	}
+
 	result, err := w.DB.ExecContext(ctx, statement,
 		txn.Amount,
 		txn.Currency,
@@ -174,6 +238,7 @@ func (w *DBWrapper) InsertTransaction(txn Transaction) (int, error) {
 		txn.TransactionStatusID,
 		txn.CardExpiryMonth,
 		txn.CardExpiryYear,
+		captureBefore,
 		txn.CreatedAt,
 		txn.UpdatedAt,
 	)
@@ -187,24 +252,121 @@ func (w *DBWrapper) InsertTransaction(txn Transaction) (int, error) {
 	return int(id), nil
 }
 
-// InsertOrder inserts a new order and returns its ID.
+// SettlePayment records the outcome of a pending or declined payment, identified by its
+// payment intent or, for the first invoice of a subscription, by its subscription. A
+// payment that succeeded clears its transaction and orders; a payment that failed
+// declines its transaction and cancels its orders. Only pending payments, declined
+// payments that succeed later, and authorizations that are canceled without being
+// captured, which void their transaction, are settled; it reports whether the payment was.
+// chargeID, the charge of the payment when it has one, is recorded as the bank return
+// code of the transaction, which payouts and disputes find it by.
+func (w *DBWrapper) SettlePayment(paymentIntent, chargeID string, succeeded bool) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := w.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var id, statusID int
+	err = tx.QueryRowContext(ctx, `
+		select id, transaction_status_id from transactions where payment_intent = ? order by id desc limit 1 for update`,
+		paymentIntent).Scan(&id, &statusID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	txnStatus, orderStatus := TransactionDeclined, OrderCancelled
+	if succeeded {
+		txnStatus, orderStatus = TransactionCleared, OrderCleared
+	}
+	switch {
+	case statusID == TransactionPending, succeeded && statusID == TransactionDeclined:
+	case !succeeded && statusID == TransactionAuthorized:
+		txnStatus = TransactionVoided
+	default:
+		return false, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		update transactions
+		set transaction_status_id = ?, bank_return_code = coalesce(nullif(?, ''), bank_return_code), updated_at = ?
+		where id = ?`,
+		txnStatus, chargeID, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		update orders set status_id = ?, updated_at = ? where transaction_id = ? and status_id in (?, ?)`,
+		orderStatus, time.Now(), id, OrderPending, OrderCancelled)
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// InsertOrder inserts a new order with its tax lines and items and returns its ID. An
+// order with a CouponID redeems that coupon. The addresses must have been inserted
+// already. An order without a WidgetID, like a terminal sale, is priced by its items.
 func (w *DBWrapper) InsertOrder(order Order) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	tx, err := w.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
 	statement := `
 		insert into orders
-			(widget_id, customer_id, transaction_id, status_id, quantity, amount, created_at, updated_at)
-			values (?, ?, ?, ?, ?, ?, ?, ?)
+			(widget_id, customer_id, transaction_id, status_id, quantity, amount,
+			tax_jurisdiction, tax_id, coupon_id, discount, shipping, shipping_method,
+			billing_address_id, shipping_address_id, note, trial_ends_at, created_at, updated_at)
+			values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	result, err := w.DB.ExecContext(ctx, statement,
-		order.WidgetID,
+	var couponID, billingAddressID, shippingAddressID interface{}
+	var trialEndsAt sql.NullTime
+	if order.CouponID != 0 {
+		couponID = order.CouponID
+	}
+	if order.BillingAddress != nil {
+		billingAddressID = order.BillingAddress.ID
+	}
+	if order.ShippingAddress != nil {
+		shippingAddressID = order.ShippingAddress.ID
+	}
+	if order.TrialEndsAt != nil {
+		trialEndsAt = sql.NullTime{Time: *order.TrialEndsAt, Valid: true}
+	}
+
+	result, err := tx.ExecContext(ctx, statement,
+		nullID(order.WidgetID),
 		order.CustomerID,
 		order.TransactionID,
 		order.StatusID,
 		order.Quantity,
 		order.Amount,
+		order.TaxJurisdiction,
+		order.TaxID,
+		couponID,
+		order.Discount,
+		order.Shipping,
+		order.ShippingMethod,
+		billingAddressID,
+		shippingAddressID,
+		order.Note,
+		trialEndsAt,
 		order.CreatedAt,
 		order.UpdatedAt,
 	)
@@ -215,6 +377,17 @@ func (w *DBWrapper) InsertOrder(order Order) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+
+	if err := insertOrderTaxLines(ctx, tx, int(id), order.TaxLines); err != nil {
+		return 0, err
+	}
+	if err := insertOrderItems(ctx, tx, int(id), order.Items); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
 	return int(id), nil
 }
 
@@ -318,9 +491,9 @@ func (m *DBWrapper) GetAllSales() ([]*Order, error) {
 
 	query := `
 	select
-		o.id, o.widget_id, o.transaction_id, o.customer_id, 
+		o.id, coalesce(o.widget_id, 0), o.transaction_id, o.customer_id, 
 		o.status_id, o.quantity, o.amount, o.created_at,
-		o.updated_at, w.id, w.name, t.id, t.amount, t.currency,
+		o.updated_at, coalesce(w.id, 0), coalesce(w.name, ''), t.id, t.amount, t.currency,
 		t.last_four, t.expiry_month, t.expiry_year, t.payment_intent,
 		t.bank_return_code, c.id, c.first_name, c.last_name, c.email
 		
@@ -330,7 +503,7 @@ func (m *DBWrapper) GetAllSales() ([]*Order, error) {
 		left join transactions t on (o.transaction_id = t.id)
 		left join customers c on (o.customer_id = c.id)
 	where
-		w.is_recurring = 0
+		coalesce(w.is_recurring, 0) = 0
 	order by
 		o.created_at desc
 	`
@@ -387,9 +560,9 @@ func (m *DBWrapper) GetAllSalesPaginated(pageSize, page int) ([]*Order, int, int
 
 	query := `
 	select
-		o.id, o.widget_id, o.transaction_id, o.customer_id, 
+		o.id, coalesce(o.widget_id, 0), o.transaction_id, o.customer_id, 
 		o.status_id, o.quantity, o.amount, o.created_at,
-		o.updated_at, w.id, w.name, t.id, t.amount, t.currency,
+		o.updated_at, coalesce(w.id, 0), coalesce(w.name, ''), t.id, t.amount, t.currency,
 		t.last_four, t.expiry_month, t.expiry_year, t.payment_intent,
 		t.bank_return_code, c.id, c.first_name, c.last_name, c.email
 		
@@ -399,7 +572,7 @@ func (m *DBWrapper) GetAllSalesPaginated(pageSize, page int) ([]*Order, int, int
 		left join transactions t on (o.transaction_id = t.id)
 		left join customers c on (o.customer_id = c.id)
 	where
-		w.is_recurring = 0
+		coalesce(w.is_recurring, 0) = 0
 	order by
 		o.created_at desc
 	limit ? offset ?
@@ -447,7 +620,7 @@ func (m *DBWrapper) GetAllSalesPaginated(pageSize, page int) ([]*Order, int, int
 	query = `
 		select count(o.id) from orders o
 		left join widgets w on (o.widget_id = w.id)
-		where w.is_recurring = 0
+		where coalesce(w.is_recurring, 0) = 0
 	`
 
 	var totalSales int
@@ -470,9 +643,9 @@ func (m *DBWrapper) GetAllSubscriptions() ([]*Order, error) {
 
 	query := `
 	select
-		o.id, o.widget_id, o.transaction_id, o.customer_id, 
+		o.id, coalesce(o.widget_id, 0), o.transaction_id, o.customer_id, 
 		o.status_id, o.quantity, o.amount, o.created_at,
-		o.updated_at, w.id, w.name, t.id, t.amount, t.currency,
+		o.updated_at, coalesce(w.id, 0), coalesce(w.name, ''), t.id, t.amount, t.currency,
 		t.last_four, t.expiry_month, t.expiry_year, t.payment_intent,
 		t.bank_return_code, c.id, c.first_name, c.last_name, c.email
 		
@@ -535,24 +708,32 @@ func (m *DBWrapper) GetSaleByID(id int) (Order, error) {
 
 	query := `
 	select
-		o.id, o.widget_id, o.transaction_id, o.customer_id, 
-		o.status_id, o.quantity, o.amount, o.created_at,
-		o.updated_at, w.id, w.name, t.id, t.amount, t.currency,
+		o.id, coalesce(o.widget_id, 0), o.transaction_id, o.customer_id, 
+		o.status_id, o.quantity, o.amount, o.tax_jurisdiction, o.tax_id,
+		coalesce(o.coupon_id, 0), coalesce(cp.code, ''), o.discount, o.shipping,
+		o.shipping_method, coalesce(o.billing_address_id, 0), coalesce(o.shipping_address_id, 0),
+		o.fulfillment_status_id, o.carrier, o.tracking_number, coalesce(o.note, ''),
+		o.created_at, o.updated_at, coalesce(w.id, 0), coalesce(w.name, ''), t.id, t.amount, t.currency,
 		t.last_four, t.expiry_month, t.expiry_year, t.payment_intent,
-		t.bank_return_code, c.id, c.first_name, c.last_name, c.email
+		t.bank_return_code, t.transaction_status_id, t.capture_before, t.fee, coalesce((
+			select bt.payout_id from balance_transactions bt where bt.transaction_id = t.id and bt.type in (?, ?) limit 1
+		), 0), c.id, c.first_name, c.last_name, c.email
 		
 	from
 		orders o
 		left join widgets w on (o.widget_id = w.id)
 		left join transactions t on (o.transaction_id = t.id)
 		left join customers c on (o.customer_id = c.id)
+		left join coupons cp on (o.coupon_id = cp.id)
 	where
-		o.id = ? and w.is_recurring = 0
+		o.id = ? and coalesce(w.is_recurring, 0) = 0
 	`
 
-	row := m.DB.QueryRowContext(ctx, query, id)
+	row := m.DB.QueryRowContext(ctx, query, BalanceCharge, BalancePayment, id)
 
 	var o Order
+	var billingAddressID, shippingAddressID int
+	var captureBefore sql.NullTime
 	err := row.Scan(
 		&o.ID,
 		&o.WidgetID,
@@ -561,6 +742,19 @@ func (m *DBWrapper) GetSaleByID(id int) (Order, error) {
 		&o.StatusID,
 		&o.Quantity,
 		&o.Amount,
+		&o.TaxJurisdiction,
+		&o.TaxID,
+		&o.CouponID,
+		&o.CouponCode,
+		&o.Discount,
+		&o.Shipping,
+		&o.ShippingMethod,
+		&billingAddressID,
+		&shippingAddressID,
+		&o.FulfillmentStatusID,
+		&o.Carrier,
+		&o.TrackingNumber,
+		&o.Note,
 		&o.CreatedAt,
 		&o.UpdatedAt,
 		&o.Widget.ID,
@@ -573,6 +767,10 @@ func (m *DBWrapper) GetSaleByID(id int) (Order, error) {
 		&o.Transaction.CardExpiryYear,
 		&o.Transaction.PaymentIntent,
 		&o.Transaction.BankReturnCode,
+		&o.Transaction.TransactionStatusID,
+		&captureBefore,
+		&o.Transaction.Fee,
+		&o.Transaction.PayoutID,
 		&o.Customer.ID,
 		&o.Customer.FirstName,
 		&o.Customer.LastName,
@@ -582,6 +780,30 @@ func (m *DBWrapper) GetSaleByID(id int) (Order, error) {
 		return o, err
 	}
 
+	o.FulfillmentStatus = FulfillmentStatusName(o.FulfillmentStatusID)
+	if captureBefore.Valid {
+		o.Transaction.CaptureBefore = &captureBefore.Time
+	}
+
+	o.TaxLines, err = m.getOrderTaxLines(ctx, o.ID)
+	if err != nil {
+		return o, err
+	}
+	o.Items, err = m.getOrderItems(ctx, o.ID)
+	if err != nil {
+		return o, err
+	}
+	if billingAddressID != 0 {
+		if o.BillingAddress, err = m.getAddress(ctx, billingAddressID); err != nil {
+			return o, err
+		}
+	}
+	if shippingAddressID != 0 {
+		if o.ShippingAddress, err = m.getAddress(ctx, shippingAddressID); err != nil {
+			return o, err
+		}
+	}
+
 	return o, nil
 }
 
@@ -591,9 +813,11 @@ func (m *DBWrapper) GetSubscriptionByID(id int) (Order, error) {
 
 	query := `
 	select
-		o.id, o.widget_id, o.transaction_id, o.customer_id, 
-		o.status_id, o.quantity, o.amount, o.created_at,
-		o.updated_at, w.id, w.name, t.id, t.amount, t.currency,
+		o.id, coalesce(o.widget_id, 0), o.transaction_id, o.customer_id, 
+		o.status_id, o.quantity, o.amount, coalesce(o.coupon_id, 0),
+		coalesce(cp.code, ''), o.discount, coalesce(o.billing_address_id, 0),
+		o.trial_ends_at, o.created_at, o.updated_at, coalesce(w.id, 0), coalesce(w.name, ''),
+		coalesce(w.metered, 0), t.id, t.amount, t.currency,
 		t.last_four, t.expiry_month, t.expiry_year, t.payment_intent,
 		t.bank_return_code, c.id, c.first_name, c.last_name, c.email
 		
@@ -602,6 +826,7 @@ func (m *DBWrapper) GetSubscriptionByID(id int) (Order, error) {
 		left join widgets w on (o.widget_id = w.id)
 		left join transactions t on (o.transaction_id = t.id)
 		left join customers c on (o.customer_id = c.id)
+		left join coupons cp on (o.coupon_id = cp.id)
 	where
 		o.id = ? and w.is_recurring = 1
 	`
@@ -609,6 +834,8 @@ func (m *DBWrapper) GetSubscriptionByID(id int) (Order, error) {
 	row := m.DB.QueryRowContext(ctx, query, id)
 
 	var o Order
+	var billingAddressID int
+	var trialEndsAt sql.NullTime
 	err := row.Scan(
 		&o.ID,
 		&o.WidgetID,
@@ -617,10 +844,16 @@ func (m *DBWrapper) GetSubscriptionByID(id int) (Order, error) {
 		&o.StatusID,
 		&o.Quantity,
 		&o.Amount,
+		&o.CouponID,
+		&o.CouponCode,
+		&o.Discount,
+		&billingAddressID,
+		&trialEndsAt,
 		&o.CreatedAt,
 		&o.UpdatedAt,
 		&o.Widget.ID,
 		&o.Widget.Name,
+		&o.Widget.Metered,
 		&o.Transaction.ID,
 		&o.Transaction.Amount,
 		&o.Transaction.Currency,
@@ -637,16 +870,34 @@ func (m *DBWrapper) GetSubscriptionByID(id int) (Order, error) {
 	if err != nil {
 		return o, err
 	}
+	if trialEndsAt.Valid {
+		o.TrialEndsAt = &trialEndsAt.Time
+	}
+	if billingAddressID != 0 {
+		if o.BillingAddress, err = m.getAddress(ctx, billingAddressID); err != nil {
+			return o, err
+		}
+	}
 
 	return o, nil
 }
 
+// MarkOrderRefunded marks an order refunded as of now
+func (m *DBWrapper) MarkOrderRefunded(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	statement := "update orders set status_id = ?, refunded_at = ?, updated_at = ? where id = ?"
+	_, err := m.DB.ExecContext(ctx, statement, OrderRefunded, time.Now(), time.Now(), id)
+	return err
+}
+
 func (m *DBWrapper) UpdateOrderStatus(id, statusID int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	statement := "update orders set status_id = ? where id = ?"
-	_, err := m.DB.ExecContext(ctx, statement, statusID, id)
+	statement := "update orders set status_id = ?, updated_at = ? where id = ?"
+	_, err := m.DB.ExecContext(ctx, statement, statusID, time.Now(), id)
 	if err != nil {
 		return err
 	}
@@ -706,6 +957,10 @@ func (m *DBWrapper) EditUser(u User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	if err := m.checkEmailAvailable(ctx, u.Email, u.ID); err != nil {
+		return err
+	}
+
 	if (u.Password == "") {
 		statement := `
 			update users set
@@ -765,6 +1020,10 @@ func (m *DBWrapper) AddUser(u User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	if err := m.checkEmailAvailable(ctx, u.Email, 0); err != nil {
+		return err
+	}
+
 	statement := `
 		insert into users (first_name, last_name, email, password, created_at, updated_at)
 		values (?, ?, ?, ?, ?, ?)
@@ -785,6 +1044,19 @@ func (m *DBWrapper) AddUser(u User) error {
 	return nil
 }
 
+// checkEmailAvailable returns ErrDuplicateEmail if a user other than exceptID has the email address
+func (m *DBWrapper) checkEmailAvailable(ctx context.Context, email string, exceptID int) error {
+	var count int
+	row := m.DB.QueryRowContext(ctx, "select count(id) from users where email = ? and id <> ?", email, exceptID)
+	if err := row.Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrDuplicateEmail
+	}
+	return nil
+}
+
 func (m *DBWrapper) DeleteUser(id int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"testing"
+
+	"go-commerce/internal/dbtest"
+)
+
+func TestSettlePayment(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		succeeded bool
+		settled   bool
+		txn       int
+		order     int
+	}{
+		{"pending succeeds", TransactionPending, true, true, TransactionCleared, OrderCleared},
+		{"pending fails", TransactionPending, false, true, TransactionDeclined, OrderCancelled},
+		{"declined succeeds on retry", TransactionDeclined, true, true, TransactionCleared, OrderCleared},
+		{"declined fails again", TransactionDeclined, false, false, 0, 0},
+		{"cleared fails late", TransactionCleared, false, false, 0, 0},
+		{"cleared succeeds again", TransactionCleared, true, false, 0, 0},
+		{"authorization expires", TransactionAuthorized, false, true, TransactionVoided, OrderCancelled},
+		{"authorization captured", TransactionAuthorized, true, false, 0, 0},
+	}
+	for _, tt := range tests {
+		db := dbtest.New(t)
+		m := DBWrapper{DB: db.SQL}
+
+		db.Expect("from transactions where payment_intent = ? order by id desc limit 1 for update").
+			WithArgs("pi_1").
+			Rows([]interface{}{3, tt.status})
+		if tt.settled {
+			db.Expect("set transaction_status_id = ?, bank_return_code = coalesce(nullif(?, ''), bank_return_code)").
+				WithArgs(tt.txn, "ch_1", dbtest.Any, 3)
+			db.Expect("update orders set status_id = ?").WithArgs(tt.order, dbtest.Any, 3, OrderPending, OrderCancelled)
+		}
+
+		settled, err := m.SettlePayment("pi_1", "ch_1", tt.succeeded)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if settled != tt.settled {
+			t.Errorf("%s: got settled %v", tt.name, settled)
+		}
+		if tt.settled && db.Commits != 1 {
+			t.Errorf("%s: got %d commits", tt.name, db.Commits)
+		}
+	}
+}
+
+func TestSettleUnknownPayment(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	db.Expect("from transactions where payment_intent = ?").NoRows()
+
+	if settled, err := m.SettlePayment("pi_other", "", true); settled || err != nil {
+		t.Errorf("got %v, %v", settled, err)
+	}
+}
@@ -0,0 +1,304 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Payout statuses, as reported by Stripe
+const (
+	PayoutPending   = "pending"
+	PayoutInTransit = "in_transit"
+	PayoutPaid      = "paid"
+	PayoutFailed    = "failed"
+	PayoutCanceled  = "canceled"
+)
+
+// Balance transaction types that move money for our sales, as reported by Stripe
+const (
+	BalanceCharge        = "charge"
+	BalancePayment       = "payment"
+	BalanceRefund        = "refund"
+	BalancePaymentRefund = "payment_refund"
+)
+
+// Payout is a transfer of the Stripe balance to our bank account, imported from Stripe
+// with the balance transactions it paid out. Gross is what the charges brought in,
+// Refunds what was refunded, Fees the Stripe fees on both, and Other what the rest, like
+// disputes and adjustments, added or took away. Net adds up to Amount once every
+// balance transaction of the payout has been imported.
+type Payout struct {
+	ID                  int                   `json:"id"`
+	StripePayoutID      string                `json:"stripe_payout_id"`
+	Amount              int                   `json:"amount"`
+	Currency            string                `json:"currency"`
+	Status              string                `json:"status"`
+	Automatic           bool                  `json:"automatic"`
+	ArrivalDate         time.Time             `json:"arrival_date"`
+	InitiatedAt         time.Time             `json:"initiated_at"`
+	Transactions        int                   `json:"transactions"`
+	Gross               int                   `json:"gross"`
+	Refunds             int                   `json:"refunds"`
+	Fees                int                   `json:"fees"`
+	Other               int                   `json:"other"`
+	Net                 int                   `json:"net"`
+	BalanceTransactions []*BalanceTransaction `json:"balance_transactions,omitempty"`
+	CreatedAt           time.Time             `json:"-"`
+	UpdatedAt           time.Time             `json:"-"`
+}
+
+// BalanceTransaction is a movement of the Stripe balance paid out by a payout. ChargeID
+// is the charge it moved money for, the charge itself or the one refunded or disputed;
+// it links the balance transaction to the transaction with that bank return code, and
+// so to its order, which is a subscription when Recurring. Amount, Fee and Net are in the currency of the payout.
+type BalanceTransaction struct {
+	ID                         int       `json:"id"`
+	StripeBalanceTransactionID string    `json:"stripe_balance_transaction_id"`
+	PayoutID                   int       `json:"payout_id"`
+	TransactionID              int       `json:"transaction_id"`
+	OrderID                    int       `json:"order_id"`
+	Recurring                  bool      `json:"recurring"`
+	Type                       string    `json:"type"`
+	SourceID                   string    `json:"source_id"`
+	ChargeID                   string    `json:"charge_id"`
+	Amount                     int       `json:"amount"`
+	Fee                        int       `json:"fee"`
+	Net                        int       `json:"net"`
+	Currency                   string    `json:"currency"`
+	Description                string    `json:"description"`
+	AvailableOn                time.Time `json:"available_on"`
+	OccurredAt                 time.Time `json:"occurred_at"`
+	CreatedAt                  time.Time `json:"-"`
+	UpdatedAt                  time.Time `json:"-"`
+}
+
+// isCharge reports whether a balance transaction brought in the money of a charge
+func (bt BalanceTransaction) isCharge() bool {
+	return bt.Type == BalanceCharge || bt.Type == BalancePayment
+}
+
+// ImportPayout inserts a payout imported from Stripe, or updates its amount, status and
+// arrival date when it is already known, with the balance transactions it paid out, and
+// returns its ID. Balance transactions are linked to the transaction of their charge,
+// whose fee is set to the fee Stripe took for the charge.
+func (m *DBWrapper) ImportPayout(p Payout, txns []BalanceTransaction) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `
+		insert into payouts
+			(stripe_payout_id, amount, currency, status, automatic, arrival_date, initiated_at, created_at, updated_at)
+			values (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		on duplicate key update id = last_insert_id(id), amount = values(amount), status = values(status),
+			arrival_date = values(arrival_date), updated_at = values(updated_at)`
+	result, err := tx.ExecContext(ctx, stmt,
+		p.StripePayoutID,
+		p.Amount,
+		p.Currency,
+		p.Status,
+		p.Automatic,
+		p.ArrivalDate,
+		p.InitiatedAt,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, bt := range txns {
+		bt.TransactionID = 0
+		if bt.ChargeID != "" {
+			query := "select id from transactions where bank_return_code = ? order by id desc limit 1"
+			err = tx.QueryRowContext(ctx, query, bt.ChargeID).Scan(&bt.TransactionID)
+			if err != nil && err != sql.ErrNoRows {
+				return 0, err
+			}
+		}
+
+		stmt = `
+			insert into balance_transactions
+				(stripe_balance_transaction_id, payout_id, transaction_id, type, source_id, charge_id, amount, fee, net,
+				currency, description, available_on, occurred_at, created_at, updated_at)
+				values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			on duplicate key update payout_id = values(payout_id), transaction_id = values(transaction_id),
+				fee = values(fee), net = values(net), updated_at = values(updated_at)`
+		_, err = tx.ExecContext(ctx, stmt,
+			bt.StripeBalanceTransactionID,
+			id,
+			nullID(bt.TransactionID),
+			bt.Type,
+			bt.SourceID,
+			bt.ChargeID,
+			bt.Amount,
+			bt.Fee,
+			bt.Net,
+			bt.Currency,
+			bt.Description,
+			bt.AvailableOn,
+			bt.OccurredAt,
+			time.Now(),
+			time.Now(),
+		)
+		if err != nil {
+			return 0, err
+		}
+
+		if bt.TransactionID != 0 && bt.isCharge() {
+			_, err = tx.ExecContext(ctx, "update transactions set fee = ?, updated_at = ? where id = ?",
+				bt.Fee, time.Now(), bt.TransactionID)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+const payoutQuery = `
+	select p.id, p.stripe_payout_id, p.amount, p.currency, p.status, p.automatic, p.arrival_date, p.initiated_at,
+		count(bt.id),
+		coalesce(sum(case when bt.type in (?, ?) then bt.amount else 0 end), 0),
+		coalesce(sum(case when bt.type in (?, ?) then -bt.amount else 0 end), 0),
+		coalesce(sum(bt.fee), 0), coalesce(sum(bt.net), 0), p.created_at, p.updated_at
+	from payouts p
+		left join balance_transactions bt on (bt.payout_id = p.id)`
+
+// payoutArgs returns the arguments of payoutQuery followed by those of its where clause
+func payoutArgs(args ...interface{}) []interface{} {
+	return append([]interface{}{BalanceCharge, BalancePayment, BalanceRefund, BalancePaymentRefund}, args...)
+}
+
+func scanPayout(row scanner) (Payout, error) {
+	var p Payout
+	err := row.Scan(
+		&p.ID,
+		&p.StripePayoutID,
+		&p.Amount,
+		&p.Currency,
+		&p.Status,
+		&p.Automatic,
+		&p.ArrivalDate,
+		&p.InitiatedAt,
+		&p.Transactions,
+		&p.Gross,
+		&p.Refunds,
+		&p.Fees,
+		&p.Net,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	p.Other = p.Net - p.Gross + p.Refunds + p.Fees
+	return p, err
+}
+
+// GetPayouts returns the payouts that arrive from from up to, but not including, to,
+// with their gross, refunds, fees and net, the latest first
+func (m *DBWrapper) GetPayouts(from, to time.Time) ([]*Payout, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := payoutQuery + `
+		where p.arrival_date >= ? and p.arrival_date < ?
+		group by p.id
+		order by p.arrival_date desc, p.id desc`
+	rows, err := m.DB.QueryContext(ctx, query, payoutArgs(from, to)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payouts := []*Payout{}
+	for rows.Next() {
+		p, err := scanPayout(rows)
+		if err != nil {
+			return nil, err
+		}
+		payouts = append(payouts, &p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return payouts, nil
+}
+
+// GetPayout returns a payout with the balance transactions it paid out and the orders
+// they belong to
+func (m *DBWrapper) GetPayout(id int) (Payout, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := payoutQuery + `
+		where p.id = ?
+		group by p.id`
+	p, err := scanPayout(m.DB.QueryRowContext(ctx, query, payoutArgs(id)...))
+	if err != nil {
+		return p, err
+	}
+
+	query = `
+		select bt.id, bt.stripe_balance_transaction_id, bt.payout_id, coalesce(bt.transaction_id, 0), coalesce(o.id, 0),
+			coalesce(w.is_recurring, 0), bt.type, bt.source_id, bt.charge_id, bt.amount, bt.fee, bt.net, bt.currency, bt.description,
+			bt.available_on, bt.occurred_at, bt.created_at, bt.updated_at
+		from balance_transactions bt
+			left join orders o on (o.transaction_id = bt.transaction_id)
+			left join widgets w on (o.widget_id = w.id)
+		where bt.payout_id = ?
+		order by bt.occurred_at, bt.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return p, err
+	}
+	defer rows.Close()
+
+	p.BalanceTransactions = []*BalanceTransaction{}
+	for rows.Next() {
+		var bt BalanceTransaction
+		err = rows.Scan(
+			&bt.ID,
+			&bt.StripeBalanceTransactionID,
+			&bt.PayoutID,
+			&bt.TransactionID,
+			&bt.OrderID,
+			&bt.Recurring,
+			&bt.Type,
+			&bt.SourceID,
+			&bt.ChargeID,
+			&bt.Amount,
+			&bt.Fee,
+			&bt.Net,
+			&bt.Currency,
+			&bt.Description,
+			&bt.AvailableOn,
+			&bt.OccurredAt,
+			&bt.CreatedAt,
+			&bt.UpdatedAt,
+		)
+		if err != nil {
+			return p, err
+		}
+		p.BalanceTransactions = append(p.BalanceTransactions, &bt)
+	}
+	if err = rows.Err(); err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"go-commerce/internal/dbtest"
+)
+
+func TestImportPayout(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	db.Expect("insert into payouts").Result(4, 1)
+	db.Expect("where bank_return_code = ?").WithArgs("ch_1").Rows([]interface{}{3})
+	charge := db.Expect("insert into balance_transactions")
+	db.Expect("update transactions set fee = ?").WithArgs(88, dbtest.Any, 3)
+	db.Expect("where bank_return_code = ?").WithArgs("ch_1").Rows([]interface{}{3})
+	refund := db.Expect("insert into balance_transactions")
+	db.Expect("where bank_return_code = ?").WithArgs("ch_unknown").Fails(sql.ErrNoRows)
+	unknown := db.Expect("insert into balance_transactions")
+	other := db.Expect("insert into balance_transactions")
+
+	txns := []BalanceTransaction{
+		{StripeBalanceTransactionID: "txn_1", Type: BalanceCharge, ChargeID: "ch_1", Amount: 2500, Fee: 88, Net: 2412},
+		{StripeBalanceTransactionID: "txn_2", Type: BalanceRefund, ChargeID: "ch_1", Amount: -500, Net: -500},
+		{StripeBalanceTransactionID: "txn_3", Type: BalanceCharge, ChargeID: "ch_unknown", Amount: 1000, Fee: 59, Net: 941},
+		{StripeBalanceTransactionID: "txn_4", Type: "adjustment", Amount: -15, Net: -15},
+	}
+	id, err := m.ImportPayout(Payout{StripePayoutID: "po_1", Amount: 2838}, txns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 4 || db.Commits != 1 {
+		t.Errorf("got payout %d with %d commits", id, db.Commits)
+	}
+
+	// arguments: balance transaction, payout, transaction, ...
+	for _, tt := range []struct {
+		name string
+		s    *dbtest.Statement
+		txn  interface{}
+	}{
+		{"charge", charge, int64(3)},
+		{"refund", refund, int64(3)},
+		{"unknown charge", unknown, nil},
+		{"adjustment", other, nil},
+	} {
+		if tt.s.Args[1] != int64(4) || tt.s.Args[2] != tt.txn {
+			t.Errorf("%s: linked to payout %v and transaction %v", tt.name, tt.s.Args[1], tt.s.Args[2])
+		}
+	}
+}
+
+func TestGetPayouts(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	now := time.Now()
+	db.Expect("where p.arrival_date >= ? and p.arrival_date < ?").
+		WithArgs(BalanceCharge, BalancePayment, BalanceRefund, BalancePaymentRefund, from, to).
+		Rows([]interface{}{4, "po_1", 2838, "usd", "paid", true, to, from, 4, 3500, 500, 147, 2838, now, now})
+
+	payouts, err := m.GetPayouts(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payouts) != 1 {
+		t.Fatalf("got %d payouts", len(payouts))
+	}
+	p := payouts[0]
+	if p.Gross != 3500 || p.Refunds != 500 || p.Fees != 147 || p.Net != 2838 {
+		t.Errorf("got %+v", p)
+	}
+	// 3500 - 500 - 147 = 2853, so 15 went to something else
+	if p.Other != -15 {
+		t.Errorf("got other %d, want -15", p.Other)
+	}
+}
@@ -0,0 +1,202 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"go-commerce/internal/money"
+)
+
+// ErrNoPrice is returned when a widget is not sold in the requested currency
+var ErrNoPrice = errors.New("widget has no price in this currency")
+
+// FXRate is the rate from Currency into BaseCurrency from EffectiveOn onwards:
+// one unit of Currency buys Rate units of BaseCurrency
+type FXRate struct {
+	ID           int       `json:"id"`
+	BaseCurrency string    `json:"base_currency"`
+	Currency     string    `json:"currency"`
+	Rate         string    `json:"rate"`
+	EffectiveOn  string    `json:"effective_on"`
+	CreatedAt    time.Time `json:"-"`
+	UpdatedAt    time.Time `json:"-"`
+}
+
+// PriceIn returns the price of the widget in currency. Widgets without a usd row in
+// widget_prices fall back to Price.
+func (w Widget) PriceIn(currency string) (int, error) {
+	currency = strings.ToLower(currency)
+	if amount, ok := w.Prices[currency]; ok {
+		return amount, nil
+	}
+	if currency == "usd" && w.Price > 0 {
+		return w.Price, nil
+	}
+	return 0, ErrNoPrice
+}
+
+// Currencies returns the codes of the currencies the widget is sold in, sorted
+func (w Widget) Currencies() []string {
+	var codes []string
+	for _, code := range money.Codes() {
+		if _, err := w.PriceIn(code); err == nil {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+func (m *DBWrapper) getWidgetPrices(ctx context.Context, widgetID int) (map[string]int, error) {
+	rows, err := m.DB.QueryContext(ctx, "select currency, amount from widget_prices where widget_id = ?", widgetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prices := make(map[string]int)
+	for rows.Next() {
+		var currency string
+		var amount int
+		if err := rows.Scan(&currency, &amount); err != nil {
+			return nil, err
+		}
+		prices[currency] = amount
+	}
+	return prices, rows.Err()
+}
+
+// SetWidgetPrice sets the price of a widget in currency, in minor units. Setting the usd
+// price also updates widgets.price.
+func (m *DBWrapper) SetWidgetPrice(widgetID int, currency string, amount int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	currency = strings.ToLower(currency)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "update widgets set updated_at = ? where id = ?", time.Now(), widgetID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	stmt := `
+		insert into widget_prices (widget_id, currency, amount, created_at, updated_at)
+		values (?, ?, ?, ?, ?)
+		on duplicate key update amount = values(amount), updated_at = values(updated_at)`
+	_, err = tx.ExecContext(ctx, stmt, widgetID, currency, amount, time.Now(), time.Now())
+	if err != nil {
+		return err
+	}
+
+	if currency == "usd" {
+		_, err = tx.ExecContext(ctx, "update widgets set price = ? where id = ?", amount, widgetID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteWidgetPrice stops selling a widget in currency
+func (m *DBWrapper) DeleteWidgetPrice(widgetID int, currency string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, "delete from widget_prices where widget_id = ? and currency = ?", widgetID, strings.ToLower(currency))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetFXRates returns the rates into base, newest first
+func (m *DBWrapper) GetFXRates(base string) ([]*FXRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select id, base_currency, currency, rate, effective_on, created_at, updated_at
+		from fx_rates
+		where base_currency = ?
+		order by effective_on desc, currency`
+
+	rows, err := m.DB.QueryContext(ctx, query, strings.ToLower(base))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []*FXRate{}
+	for rows.Next() {
+		var r FXRate
+		var on time.Time
+		err = rows.Scan(&r.ID, &r.BaseCurrency, &r.Currency, &r.Rate, &on, &r.CreatedAt, &r.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		r.EffectiveOn = on.Format(dayLayout)
+		rates = append(rates, &r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rates, nil
+}
+
+// SaveFXRate stores a rate, replacing the rate of the same currencies on the same day
+func (m *DBWrapper) SaveFXRate(r FXRate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		insert into fx_rates (base_currency, currency, rate, effective_on, created_at, updated_at)
+		values (?, ?, ?, ?, ?, ?)
+		on duplicate key update rate = values(rate), updated_at = values(updated_at)`
+
+	_, err := m.DB.ExecContext(ctx, stmt,
+		strings.ToLower(r.BaseCurrency),
+		strings.ToLower(r.Currency),
+		r.Rate,
+		r.EffectiveOn,
+		time.Now(),
+		time.Now(),
+	)
+	return err
+}
+
+// GetRateTable loads every rate into base
+func (m *DBWrapper) GetRateTable(base string) (*money.RateTable, error) {
+	rates, err := m.GetFXRates(base)
+	if err != nil {
+		return nil, err
+	}
+
+	table := money.NewRateTable(base)
+	for _, r := range rates {
+		rate, err := money.ParseRate(r.Rate)
+		if err != nil {
+			return nil, err
+		}
+		on, err := time.Parse(dayLayout, r.EffectiveOn)
+		if err != nil {
+			return nil, err
+		}
+		table.Add(r.Currency, on, rate)
+	}
+	return table, nil
+}
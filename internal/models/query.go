@@ -0,0 +1,206 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidSort is returned when a list is sorted by a key it does not support
+	ErrInvalidSort = errors.New("invalid sort")
+	// ErrInvalidCursor is returned when a cursor is malformed or was issued for another sort
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+)
+
+// ListParams selects a page of a list. When Page is greater than zero the list uses
+// offset pagination and counts the matching rows. Otherwise it is paged with the opaque
+// Cursor returned in PageInfo.NextCursor, which stays fast on large tables.
+type ListParams struct {
+	Sort     string // sort key, prefixed with "-" for descending order
+	Page     int
+	PageSize int
+	Cursor   string
+}
+
+// PageInfo describes a page of a list
+type PageInfo struct {
+	Total      int    `json:"total,omitempty"`
+	LastPage   int    `json:"last_page,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// cursor is the position after the last row of a page
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// listQuery builds the where, order by and limit clauses of a list query from
+// filters, a whitelisted sort key and the requested page
+type listQuery struct {
+	params     ListParams
+	idColumn   string
+	sortColumn string
+	desc       bool
+	conditions []string
+	args       []interface{}
+	after      *cursor
+}
+
+// newListQuery validates p against sortColumns, which maps public sort keys to SQL expressions
+func newListQuery(p ListParams, idColumn string, sortColumns map[string]string, defaultSort string) (*listQuery, error) {
+	if p.PageSize < 1 {
+		p.PageSize = defaultPageSize
+	}
+	if p.PageSize > maxPageSize {
+		p.PageSize = maxPageSize
+	}
+	if p.Sort == "" {
+		p.Sort = defaultSort
+	}
+
+	q := &listQuery{params: p, idColumn: idColumn}
+	q.desc = strings.HasPrefix(p.Sort, "-")
+
+	column, ok := sortColumns[strings.TrimPrefix(p.Sort, "-")]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+	q.sortColumn = column
+
+	if p.Page < 1 && p.Cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		var c cursor
+		if err := json.Unmarshal(raw, &c); err != nil || c.Sort != p.Sort {
+			return nil, ErrInvalidCursor
+		}
+		q.after = &c
+	}
+	return q, nil
+}
+
+// where adds a condition. Conditions are joined with and.
+func (q *listQuery) where(condition string, args ...interface{}) {
+	q.conditions = append(q.conditions, condition)
+	q.args = append(q.args, args...)
+}
+
+// whereClause returns the where clause and its arguments, without the cursor position
+func (q *listQuery) whereClause() (string, []interface{}) {
+	if len(q.conditions) == 0 {
+		return "", nil
+	}
+	return " where " + strings.Join(q.conditions, " and "), q.args
+}
+
+// pageClauses returns the where, order by and limit clauses and their arguments for the requested page.
+// Cursor pages fetch one row more than the page size to find out if there is a next page.
+func (q *listQuery) pageClauses() (string, []interface{}) {
+	conditions := q.conditions
+	args := append([]interface{}{}, q.args...)
+
+	cmp := ">"
+	if q.desc {
+		cmp = "<"
+	}
+
+	if q.after != nil {
+		conditions = append(conditions[:len(conditions):len(conditions)],
+			fmt.Sprintf("(%[1]s %[2]s ? or (%[1]s = ? and %[3]s %[2]s ?))", q.sortColumn, cmp, q.idColumn))
+		args = append(args, q.after.Value, q.after.Value, q.after.ID)
+	}
+
+	var clause string
+	if len(conditions) > 0 {
+		clause = " where " + strings.Join(conditions, " and ")
+	}
+	clause += q.orderBy()
+
+	if q.offsetPaging() {
+		clause += " limit ? offset ?"
+		args = append(args, q.params.PageSize, (q.params.Page-1)*q.params.PageSize)
+	} else {
+		clause += " limit ?"
+		args = append(args, q.params.PageSize+1)
+	}
+	return clause, args
+}
+
+// streamClauses returns the where and order by clauses and their arguments for all matching rows
+func (q *listQuery) streamClauses() (string, []interface{}) {
+	where, args := q.whereClause()
+	return where + q.orderBy(), args
+}
+
+// orderBy returns the order by clause. The id breaks ties so the order is stable across pages.
+func (q *listQuery) orderBy() string {
+	dir := "asc"
+	if q.desc {
+		dir = "desc"
+	}
+	return fmt.Sprintf(" order by %s %s, %s %s", q.sortColumn, dir, q.idColumn, dir)
+}
+
+func (q *listQuery) offsetPaging() bool {
+	return q.params.Page > 0
+}
+
+// hasNextPage returns how many of the fetched rows belong to the page and whether a
+// cursor page has a next page
+func (q *listQuery) hasNextPage(rows int) (int, bool) {
+	if q.offsetPaging() || rows <= q.params.PageSize {
+		return rows, false
+	}
+	return q.params.PageSize, true
+}
+
+// nextCursor encodes the position after the row with the given sort value and id
+func (q *listQuery) nextCursor(sortValue interface{}, id int) string {
+	raw, _ := json.Marshal(cursor{Sort: q.params.Sort, Value: cursorValue(sortValue), ID: id})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// pageInfo completes PageInfo for offset pages from the number of matching rows
+func (q *listQuery) pageInfo(total int) *PageInfo {
+	return &PageInfo{
+		Total:    total,
+		LastPage: int(math.Ceil(float64(total) / float64(q.params.PageSize))),
+	}
+}
+
+// cursorValue formats a value scanned from the sort column so it compares the same way in SQL
+func cursorValue(v interface{}) string {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC().Format("2006-01-02 15:04:05.999999")
+	case []byte:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// likePattern returns a pattern for a case insensitive partial match on s
+func likePattern(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(s) + "%"
+}
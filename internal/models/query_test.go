@@ -0,0 +1,138 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testSortColumns = map[string]string{
+	"date":   "o.created_at",
+	"amount": "o.amount",
+}
+
+func TestNewListQueryDefaults(t *testing.T) {
+	q, err := newListQuery(ListParams{}, "o.id", testSortColumns, "-date")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.params.PageSize != defaultPageSize || q.sortColumn != "o.created_at" || !q.desc {
+		t.Errorf("got page size %d, sort %s, desc %v", q.params.PageSize, q.sortColumn, q.desc)
+	}
+
+	q, err = newListQuery(ListParams{PageSize: 1000, Sort: "amount"}, "o.id", testSortColumns, "-date")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.params.PageSize != maxPageSize || q.sortColumn != "o.amount" || q.desc {
+		t.Errorf("got page size %d, sort %s, desc %v", q.params.PageSize, q.sortColumn, q.desc)
+	}
+}
+
+func TestNewListQueryRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		params ListParams
+		want   error
+	}{
+		{"unknown sort", ListParams{Sort: "email"}, ErrInvalidSort},
+		{"bad cursor", ListParams{Cursor: "not base64!"}, ErrInvalidCursor},
+		{"cursor is not json", ListParams{Cursor: "bm90IGpzb24"}, ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		if _, err := newListQuery(tt.params, "o.id", testSortColumns, "-date"); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	q, _ := newListQuery(ListParams{Sort: "amount"}, "o.id", testSortColumns, "-date")
+	c := q.nextCursor(int64(500), 7)
+	if _, err := newListQuery(ListParams{Sort: "-amount", Cursor: c}, "o.id", testSortColumns, "-date"); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("cursor of another sort: got %v, want %v", err, ErrInvalidCursor)
+	}
+}
+
+func TestPageClausesOffset(t *testing.T) {
+	q, err := newListQuery(ListParams{Sort: "amount", Page: 3, PageSize: 20}, "o.id", testSortColumns, "-date")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.where("o.currency = ?", "eur")
+
+	clause, args := q.pageClauses()
+	want := " where o.currency = ? order by o.amount asc, o.id asc limit ? offset ?"
+	if clause != want {
+		t.Errorf("got clause %q, want %q", clause, want)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"eur", 20, 40}) {
+		t.Errorf("got args %v", args)
+	}
+
+	if info := q.pageInfo(41); info.Total != 41 || info.LastPage != 3 {
+		t.Errorf("got page info %+v", info)
+	}
+	if n, more := q.hasNextPage(20); n != 20 || more {
+		t.Errorf("offset page: got %d rows, next page %v", n, more)
+	}
+}
+
+func TestPageClausesCursor(t *testing.T) {
+	first, err := newListQuery(ListParams{PageSize: 2}, "o.id", testSortColumns, "-date")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.where("o.status = ?", 1)
+
+	clause, args := first.pageClauses()
+	want := " where o.status = ? order by o.created_at desc, o.id desc limit ?"
+	if clause != want {
+		t.Errorf("first page: got clause %q, want %q", clause, want)
+	}
+	if !reflect.DeepEqual(args, []interface{}{1, 3}) {
+		t.Errorf("first page: got args %v", args)
+	}
+	if n, more := first.hasNextPage(3); n != 2 || !more {
+		t.Errorf("first page: got %d rows, next page %v", n, more)
+	}
+
+	created := time.Date(2026, 10, 19, 14, 30, 0, 500000000, time.FixedZone("CEST", 2*60*60))
+	next, err := newListQuery(ListParams{PageSize: 2, Cursor: first.nextCursor(created, 42)}, "o.id", testSortColumns, "-date")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next.where("o.status = ?", 1)
+
+	clause, args = next.pageClauses()
+	want = " where o.status = ? and (o.created_at < ? or (o.created_at = ? and o.id < ?)) order by o.created_at desc, o.id desc limit ?"
+	if clause != want {
+		t.Errorf("next page: got clause %q, want %q", clause, want)
+	}
+	value := "2026-10-19 12:30:00.5"
+	if !reflect.DeepEqual(args, []interface{}{1, value, value, 42, 3}) {
+		t.Errorf("next page: got args %v", args)
+	}
+	if n, more := next.hasNextPage(1); n != 1 || more {
+		t.Errorf("last page: got %d rows, next page %v", n, more)
+	}
+
+	if where, args := next.whereClause(); where != " where o.status = ?" || len(args) != 1 {
+		t.Errorf("pageClauses changed the conditions: %q %v", where, args)
+	}
+}
+
+func TestStreamClauses(t *testing.T) {
+	q, err := newListQuery(ListParams{Sort: "amount", PageSize: 5}, "o.id", testSortColumns, "-date")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clause, args := q.streamClauses(); clause != " order by o.amount asc, o.id asc" || args != nil {
+		t.Errorf("got %q %v", clause, args)
+	}
+}
+
+func TestLikePattern(t *testing.T) {
+	if got := likePattern(`50%_off\`); got != `%50\%\_off\\%` {
+		t.Errorf("got %s", got)
+	}
+}
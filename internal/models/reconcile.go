@@ -0,0 +1,154 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// PaymentRecord is a transaction as recorded locally, with its order, for reconciling
+// it with the gateway. PaymentIntent is the gateway payment intent of a sale, or the
+// gateway subscription of a subscription. Refunded is how much of the sale has been
+// refunded: all of it once the order is refunded, otherwise what its returns refunded.
+type PaymentRecord struct {
+	TransactionID       int       `json:"transaction_id"`
+	OrderID             int       `json:"order_id"`
+	PaymentIntent       string    `json:"payment_intent"`
+	Amount              int       `json:"amount"`
+	Refunded            int       `json:"refunded"`
+	Currency            string    `json:"currency"`
+	TransactionStatusID int       `json:"transaction_status_id"`
+	OrderStatusID       int       `json:"order_status_id"`
+	Recurring           bool      `json:"recurring"`
+	Seats               int       `json:"seats"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+const paymentRecordQuery = `
+	select t.id, coalesce(o.id, 0), t.payment_intent, t.amount,
+		case when o.status_id = ? then t.amount else coalesce((
+			select sum(r.amount) from returns r where r.order_id = o.id and r.status = ?
+		), 0) end,
+		t.currency, t.transaction_status_id, coalesce(o.status_id, 0),
+		coalesce(w.is_recurring, 0), coalesce(o.quantity, 0), t.created_at
+	from transactions t
+		left join orders o on (o.transaction_id = t.id)
+		left join widgets w on (o.widget_id = w.id)`
+
+// GetPaymentRecords returns the transactions made from from until to that have a
+// gateway payment intent or subscription
+func (m *DBWrapper) GetPaymentRecords(from, to time.Time) ([]PaymentRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := paymentRecordQuery + `
+		where t.created_at >= ? and t.created_at < ? and t.payment_intent <> ''
+		order by t.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, OrderRefunded, ReturnRefunded, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []PaymentRecord
+	for rows.Next() {
+		p, err := scanPaymentRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, p)
+	}
+	return records, rows.Err()
+}
+
+// GetPaymentRecord returns the latest transaction of a gateway payment intent or
+// subscription, whenever it was made
+func (m *DBWrapper) GetPaymentRecord(paymentIntent string) (PaymentRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := paymentRecordQuery + `
+		where t.payment_intent = ?
+		order by t.id desc
+		limit 1`
+
+	return scanPaymentRecord(m.DB.QueryRowContext(ctx, query, OrderRefunded, ReturnRefunded, paymentIntent))
+}
+
+func scanPaymentRecord(row scanner) (PaymentRecord, error) {
+	var p PaymentRecord
+	err := row.Scan(
+		&p.TransactionID,
+		&p.OrderID,
+		&p.PaymentIntent,
+		&p.Amount,
+		&p.Refunded,
+		&p.Currency,
+		&p.TransactionStatusID,
+		&p.OrderStatusID,
+		&p.Recurring,
+		&p.Seats,
+		&p.CreatedAt,
+	)
+	return p, err
+}
+
+// RepairPayment sets the amount and status of a transaction, and the status of its
+// order, to what the gateway recorded. An orderStatus of 0 leaves the order alone.
+func (m *DBWrapper) RepairPayment(transactionID, amount, txnStatus, orderStatus int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		update transactions set amount = ?, transaction_status_id = ?, updated_at = ? where id = ?`,
+		amount, txnStatus, time.Now(), transactionID)
+	if err != nil {
+		return err
+	}
+	if orderStatus != 0 {
+		_, err = tx.ExecContext(ctx, `
+			update orders set status_id = ?, updated_at = ? where transaction_id = ?`,
+			orderStatus, time.Now(), transactionID)
+		if err != nil {
+			return err
+		}
+	}
+	if orderStatus == OrderRefunded {
+		_, err = tx.ExecContext(ctx, `
+			update orders set refunded_at = ? where transaction_id = ? and refunded_at is null`,
+			time.Now(), transactionID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetWidgetIDByPlan returns the ID of the recurring widget of a gateway plan
+func (m *DBWrapper) GetWidgetIDByPlan(plan string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	err := m.DB.QueryRowContext(ctx, "select id from widgets where plan_id = ? and is_recurring = 1", plan).Scan(&id)
+	return id, err
+}
+
+// RepairSubscription sets the status and seats of a subscription to what the gateway
+// recorded
+func (m *DBWrapper) RepairSubscription(orderID, statusID, seats int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `
+		update orders set status_id = ?, quantity = ?, updated_at = ? where id = ?`,
+		statusID, seats, time.Now(), orderID)
+	return err
+}
@@ -0,0 +1,460 @@
+package models
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go-commerce/internal/money"
+)
+
+// Reports read from the daily_sales, daily_widget_sales and daily_subscriptions
+// rollup tables, which RefreshRollups recomputes from orders and returns. Amounts are in the
+// minor unit of the currency. Days are calendar days of the database clock.
+
+const dayLayout = "2006-01-02"
+
+// RevenueDay is one day of sales in a currency. Sales count on the day they were
+// placed and refunds on the day they were made: a refunded return on the day it was
+// refunded, and a refunded sale, less what its returns refunded, on the day it was. Gross and Refunds include tax; Tax is
+// the tax on the sales less the tax refunded, and Net is the revenue after both.
+type RevenueDay struct {
+	Day         string `json:"day"`
+	Orders      int    `json:"orders"`
+	Gross       int    `json:"gross"`
+	RefundCount int    `json:"refund_count"`
+	Refunds     int    `json:"refunds"`
+	Tax         int    `json:"tax"`
+	Net         int    `json:"net"`
+}
+
+// SubscriptionDay is the state of subscriptions in a currency at the end of a day
+type SubscriptionDay struct {
+	Day       string `json:"day"`
+	Active    int    `json:"active"`
+	MRR       int    `json:"mrr"`
+	Started   int    `json:"started"`
+	Cancelled int    `json:"cancelled"`
+}
+
+// WidgetSales is the sales of one widget over a period
+type WidgetSales struct {
+	WidgetID int    `json:"widget_id"`
+	Name     string `json:"name"`
+	Orders   int    `json:"orders"`
+	Quantity int    `json:"quantity"`
+	Gross    int    `json:"gross"`
+}
+
+// ReportSummary holds the headline figures of a period in one currency
+type ReportSummary struct {
+	From                string  `json:"from"`
+	To                  string  `json:"to"`
+	Currency            string  `json:"currency"`
+	Converted           bool    `json:"converted"`
+	Orders              int     `json:"orders"`
+	Gross               int     `json:"gross"`
+	Refunds             int     `json:"refunds"`
+	Tax                 int     `json:"tax"`
+	Net                 int     `json:"net"`
+	AverageOrderValue   int     `json:"average_order_value"`
+	ActiveSubscriptions int     `json:"active_subscriptions"`
+	MRR                 int     `json:"mrr"`
+	ARR                 int     `json:"arr"`
+	NewSubscriptions    int     `json:"new_subscriptions"`
+	Cancellations       int     `json:"cancellations"`
+	ChurnRate           float64 `json:"churn_rate"`
+}
+
+// RefreshRollups recomputes the rollup tables for the days from from up to, but not
+// including, to. Plans are billed monthly, so the MRR of a subscription is its amount.
+func (m *DBWrapper) RefreshRollups(ctx context.Context, from, to time.Time) error {
+	from, to = truncateDay(from), truncateDay(to)
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"daily_sales", "daily_widget_sales", "daily_subscriptions"} {
+		_, err = tx.ExecContext(ctx, "delete from "+table+" where day >= ? and day < ?", from, to)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		insert into daily_sales (day, currency, orders, gross, refund_count, refunds, tax, refunded_tax)
+		select day, currency, sum(orders), sum(gross), sum(refund_count), sum(refunds), sum(tax), sum(refunded_tax)
+		from (
+			select date(o.created_at) as day, t.currency, 1 as orders, o.amount as gross, 0 as refund_count, 0 as refunds,
+				coalesce(l.tax, 0) as tax, 0 as refunded_tax
+			from
+				orders o
+				join transactions t on (o.transaction_id = t.id)
+				left join (select order_id, sum(amount) as tax from order_tax_lines group by order_id) l on (l.order_id = o.id)
+			where o.created_at >= ? and o.created_at < ?
+			union all
+			select date(e.created_at), t.currency, 0, 0, 1, r.amount, 0, coalesce(l.tax * r.amount div nullif(o.amount, 0), 0)
+			from
+				returns r
+				join return_events e on (e.return_id = r.id and e.to_status = ?)
+				join orders o on (r.order_id = o.id)
+				join transactions t on (o.transaction_id = t.id)
+				left join (select order_id, sum(amount) as tax from order_tax_lines group by order_id) l on (l.order_id = o.id)
+			where r.status = ? and e.created_at >= ? and e.created_at < ?
+			union all
+			select date(o.refunded_at), t.currency, 0, 0, 1, o.amount - coalesce(rr.amount, 0), 0,
+				coalesce(l.tax * (o.amount - coalesce(rr.amount, 0)) div nullif(o.amount, 0), 0)
+			from
+				orders o
+				join transactions t on (o.transaction_id = t.id)
+				left join (select order_id, sum(amount) as tax from order_tax_lines group by order_id) l on (l.order_id = o.id)
+				left join (select order_id, sum(amount) as amount from returns where status = ? group by order_id) rr on (rr.order_id = o.id)
+			where o.status_id = ? and o.refunded_at >= ? and o.refunded_at < ? and o.amount > coalesce(rr.amount, 0)
+		) s
+		group by day, currency`,
+		from, to, ReturnRefunded, ReturnRefunded, from, to, ReturnRefunded, OrderRefunded, from, to,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		insert into daily_widget_sales (day, currency, widget_id, orders, quantity, gross)
+		select date(o.created_at), t.currency, o.widget_id, count(o.id), sum(o.quantity), sum(o.amount)
+		from orders o join transactions t on (o.transaction_id = t.id)
+		where o.created_at >= ? and o.created_at < ? and o.widget_id is not null
+		group by date(o.created_at), t.currency, o.widget_id`,
+		from, to,
+	)
+	if err != nil {
+		return err
+	}
+
+	// A subscription is active at the end of a day unless it was cancelled by then
+	stmt, err := tx.PrepareContext(ctx, `
+		insert into daily_subscriptions (day, currency, active, mrr, started, cancelled)
+		select ?, t.currency,
+			sum(case when o.status_id <> ? or o.updated_at >= ? then 1 else 0 end),
+			sum(case when o.status_id <> ? or o.updated_at >= ? then o.amount else 0 end),
+			sum(case when o.created_at >= ? then 1 else 0 end),
+			sum(case when o.status_id = ? and o.updated_at >= ? and o.updated_at < ? then 1 else 0 end)
+		from
+			orders o
+			join widgets w on (o.widget_id = w.id)
+			join transactions t on (o.transaction_id = t.id)
+		where w.is_recurring = 1 and o.created_at < ?
+		group by t.currency`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		end := day.AddDate(0, 0, 1)
+		_, err = stmt.ExecContext(ctx,
+			day,
+			OrderCancelled, end,
+			OrderCancelled, end,
+			day,
+			OrderCancelled, day, end,
+			end,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ReportCurrency is the currency a report is in. Unless Convert is set, a report only
+// covers the sales made in Code. Converted reports cover the sales in every currency,
+// converted into Code with the FX rate in effect on each day.
+type ReportCurrency struct {
+	Code    string
+	Convert bool
+}
+
+// reportConverter converts rollup amounts into the currency of a report
+type reportConverter struct {
+	ReportCurrency
+	rates *money.RateTable
+}
+
+func (m *DBWrapper) newReportConverter(rc ReportCurrency) (*reportConverter, error) {
+	c := &reportConverter{ReportCurrency: rc}
+	if rc.Convert {
+		rates, err := m.GetRateTable(rc.Code)
+		if err != nil {
+			return nil, err
+		}
+		c.rates = rates
+	}
+	return c, nil
+}
+
+// where returns the condition that selects the rollup rows of the report between from
+// and to, with the columns of the rollup table prefixed by prefix
+func (c *reportConverter) where(prefix string, from, to time.Time) (string, []interface{}) {
+	if c.Convert {
+		return " where " + prefix + "day >= ? and " + prefix + "day < ?", []interface{}{from, to}
+	}
+	return " where " + prefix + "currency = ? and " + prefix + "day >= ? and " + prefix + "day < ?", []interface{}{c.Code, from, to}
+}
+
+// convert converts an amount in currency on day into the report currency
+func (c *reportConverter) convert(amount int, currency string, day time.Time) (int, error) {
+	if c.rates == nil || amount == 0 {
+		return amount, nil
+	}
+	a, err := c.rates.Convert(money.New(int64(amount), currency), day)
+	if err != nil {
+		return 0, err
+	}
+	return int(a.Minor), nil
+}
+
+// GetRevenueByDay returns the sales of every day from from up to, but not including, to.
+// Days without sales are included with zero amounts.
+func (m *DBWrapper) GetRevenueByDay(from, to time.Time, rc ReportCurrency) ([]RevenueDay, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	from, to = truncateDay(from), truncateDay(to)
+	c, err := m.newReportConverter(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args := c.where("", from, to)
+	query := "select day, currency, orders, gross, refund_count, refunds, tax - refunded_tax from daily_sales" + where
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make(map[string]RevenueDay)
+	for rows.Next() {
+		var day time.Time
+		var currency string
+		var orders, gross, refundCount, refunds, tax int
+		err = rows.Scan(&day, &currency, &orders, &gross, &refundCount, &refunds, &tax)
+		if err != nil {
+			return nil, err
+		}
+		if gross, err = c.convert(gross, currency, day); err != nil {
+			return nil, err
+		}
+		if refunds, err = c.convert(refunds, currency, day); err != nil {
+			return nil, err
+		}
+		if tax, err = c.convert(tax, currency, day); err != nil {
+			return nil, err
+		}
+
+		d := found[day.Format(dayLayout)]
+		d.Orders += orders
+		d.Gross += gross
+		d.RefundCount += refundCount
+		d.Refunds += refunds
+		d.Tax += tax
+		found[day.Format(dayLayout)] = d
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var days []RevenueDay
+	for _, day := range daysBetween(from, to) {
+		d := found[day]
+		d.Day = day
+		d.Net = d.Gross - d.Refunds - d.Tax
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+// GetSubscriptionsByDay returns the subscription snapshot of every day from from up to,
+// but not including, to. Days before the first subscription are included with zeros.
+func (m *DBWrapper) GetSubscriptionsByDay(from, to time.Time, rc ReportCurrency) ([]SubscriptionDay, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	from, to = truncateDay(from), truncateDay(to)
+	c, err := m.newReportConverter(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args := c.where("", from, to)
+	rows, err := m.DB.QueryContext(ctx, "select day, currency, active, mrr, started, cancelled from daily_subscriptions"+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make(map[string]SubscriptionDay)
+	for rows.Next() {
+		var day time.Time
+		var currency string
+		var active, mrr, started, cancelled int
+		err = rows.Scan(&day, &currency, &active, &mrr, &started, &cancelled)
+		if err != nil {
+			return nil, err
+		}
+		if mrr, err = c.convert(mrr, currency, day); err != nil {
+			return nil, err
+		}
+
+		d := found[day.Format(dayLayout)]
+		d.Active += active
+		d.MRR += mrr
+		d.Started += started
+		d.Cancelled += cancelled
+		found[day.Format(dayLayout)] = d
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var days []SubscriptionDay
+	for _, day := range daysBetween(from, to) {
+		d := found[day]
+		d.Day = day
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+// GetTopWidgets returns the limit widgets with the highest gross sales from from up to,
+// but not including, to
+func (m *DBWrapper) GetTopWidgets(from, to time.Time, rc ReportCurrency, limit int) ([]WidgetSales, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	from, to = truncateDay(from), truncateDay(to)
+	c, err := m.newReportConverter(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args := c.where("s.", from, to)
+	query := `
+		select s.day, s.currency, s.widget_id, coalesce(w.name, ''), s.orders, s.quantity, s.gross
+		from
+			daily_widget_sales s
+			left join widgets w on (s.widget_id = w.id)` + where
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := make(map[int]*WidgetSales)
+	for rows.Next() {
+		var day time.Time
+		var currency string
+		var s WidgetSales
+		err = rows.Scan(&day, &currency, &s.WidgetID, &s.Name, &s.Orders, &s.Quantity, &s.Gross)
+		if err != nil {
+			return nil, err
+		}
+		if s.Gross, err = c.convert(s.Gross, currency, day); err != nil {
+			return nil, err
+		}
+
+		t, ok := totals[s.WidgetID]
+		if !ok {
+			t = &WidgetSales{WidgetID: s.WidgetID, Name: s.Name}
+			totals[s.WidgetID] = t
+		}
+		t.Orders += s.Orders
+		t.Quantity += s.Quantity
+		t.Gross += s.Gross
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	widgets := []WidgetSales{}
+	for _, t := range totals {
+		widgets = append(widgets, *t)
+	}
+	sort.Slice(widgets, func(i, j int) bool {
+		if widgets[i].Gross != widgets[j].Gross {
+			return widgets[i].Gross > widgets[j].Gross
+		}
+		return widgets[i].WidgetID < widgets[j].WidgetID
+	})
+	if len(widgets) > limit {
+		widgets = widgets[:limit]
+	}
+
+	return widgets, nil
+}
+
+// GetReportSummary returns the headline figures from from up to, but not including, to.
+// Churn is the share of the subscriptions active during the period that were cancelled in it.
+func (m *DBWrapper) GetReportSummary(from, to time.Time, rc ReportCurrency) (ReportSummary, error) {
+	from, to = truncateDay(from), truncateDay(to)
+	s := ReportSummary{
+		From:      from.Format(dayLayout),
+		To:        to.AddDate(0, 0, -1).Format(dayLayout),
+		Currency:  rc.Code,
+		Converted: rc.Convert,
+	}
+
+	revenue, err := m.GetRevenueByDay(from, to, rc)
+	if err != nil {
+		return s, err
+	}
+	for _, d := range revenue {
+		s.Orders += d.Orders
+		s.Gross += d.Gross
+		s.Refunds += d.Refunds
+		s.Tax += d.Tax
+	}
+	s.Net = s.Gross - s.Refunds - s.Tax
+	if s.Orders > 0 {
+		s.AverageOrderValue = s.Gross / s.Orders
+	}
+
+	// include the day before the period for the subscriptions active when it started
+	subscriptions, err := m.GetSubscriptionsByDay(from.AddDate(0, 0, -1), to, rc)
+	if err != nil {
+		return s, err
+	}
+	for _, d := range subscriptions[1:] {
+		s.NewSubscriptions += d.Started
+		s.Cancellations += d.Cancelled
+	}
+	last := subscriptions[len(subscriptions)-1]
+	s.ActiveSubscriptions = last.Active
+	s.MRR = last.MRR
+	s.ARR = s.MRR * 12
+
+	if exposed := subscriptions[0].Active + s.NewSubscriptions; exposed > 0 {
+		s.ChurnRate = float64(s.Cancellations) / float64(exposed)
+	}
+
+	return s, nil
+}
+
+// truncateDay returns the start of the calendar day of t
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// daysBetween returns the days from from up to, but not including, to as YYYY-MM-DD
+func daysBetween(from, to time.Time) []string {
+	var days []string
+	for day := truncateDay(from); day.Before(to); day = day.AddDate(0, 0, 1) {
+		days = append(days, day.Format(dayLayout))
+	}
+	return days
+}
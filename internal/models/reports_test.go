@@ -0,0 +1,171 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go-commerce/internal/dbtest"
+	"go-commerce/internal/money"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse(dayLayout, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestRefreshRollups(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	from, to := day("2026-10-18"), day("2026-10-20")
+	for _, table := range []string{"daily_sales", "daily_widget_sales", "daily_subscriptions"} {
+		db.Expect("delete from "+table+" where day >= ? and day < ?").WithArgs(from, to)
+	}
+	// refunded returns count on the day of their refunded event, and refunded sales on
+	// the day they were refunded, less what their returns refunded
+	db.Expect("insert into daily_sales").WithArgs(from, to, ReturnRefunded, ReturnRefunded, from, to, ReturnRefunded, OrderRefunded, from, to)
+	db.Expect("insert into daily_widget_sales").WithArgs(from, to)
+	db.Expect("insert into daily_subscriptions").WithArgs(
+		from, OrderCancelled, to.AddDate(0, 0, -1), OrderCancelled, to.AddDate(0, 0, -1),
+		from, OrderCancelled, from, to.AddDate(0, 0, -1), to.AddDate(0, 0, -1),
+	)
+	db.Expect("insert into daily_subscriptions").WithArgs(
+		to.AddDate(0, 0, -1), OrderCancelled, to, OrderCancelled, to,
+		to.AddDate(0, 0, -1), OrderCancelled, to.AddDate(0, 0, -1), to, to,
+	)
+
+	// times within a day refresh the whole day
+	if err := m.RefreshRollups(context.Background(), from.Add(13*time.Hour), to.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if db.Commits != 1 {
+		t.Errorf("got %d commits, want 1", db.Commits)
+	}
+}
+
+func TestRefreshRollupsRollsBack(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	db.Expect("delete from daily_sales").Fails(context.DeadlineExceeded)
+
+	if err := m.RefreshRollups(context.Background(), day("2026-10-18"), day("2026-10-19")); err != context.DeadlineExceeded {
+		t.Fatalf("got %v", err)
+	}
+	if db.Commits != 0 || db.Rollbacks != 1 {
+		t.Errorf("got %d commits and %d rollbacks", db.Commits, db.Rollbacks)
+	}
+}
+
+func TestGetRevenueByDayFillsGaps(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	db.Expect("from daily_sales where currency = ? and day >= ? and day < ?").
+		WithArgs("eur", day("2026-10-17"), day("2026-10-20")).
+		Rows([]interface{}{day("2026-10-18"), "eur", 3, 9000, 1, 2500, 500})
+
+	days, err := m.GetRevenueByDay(day("2026-10-17"), day("2026-10-20"), ReportCurrency{Code: "eur"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RevenueDay{
+		{Day: "2026-10-17"},
+		{Day: "2026-10-18", Orders: 3, Gross: 9000, RefundCount: 1, Refunds: 2500, Tax: 500, Net: 6000},
+		{Day: "2026-10-19"},
+	}
+	if !reflect.DeepEqual(days, want) {
+		t.Errorf("got %+v", days)
+	}
+}
+
+func TestGetRevenueByDayConverts(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	created := day("2026-10-01")
+	db.Expect("from fx_rates").WithArgs("usd").Rows(
+		[]interface{}{2, "usd", "eur", "1.2", day("2026-10-18"), created, created},
+		[]interface{}{1, "usd", "eur", "1.1", day("2026-10-01"), created, created},
+	)
+	db.Expect("from daily_sales where day >= ? and day < ?").
+		WithArgs(day("2026-10-17"), day("2026-10-19")).
+		Rows(
+			[]interface{}{day("2026-10-17"), "usd", 1, 1000, 0, 0, 0},
+			[]interface{}{day("2026-10-17"), "eur", 1, 1000, 0, 0, 0},
+			[]interface{}{day("2026-10-18"), "eur", 2, 2000, 1, 500, 100},
+		)
+
+	days, err := m.GetRevenueByDay(day("2026-10-17"), day("2026-10-19"), ReportCurrency{Code: "usd", Convert: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RevenueDay{
+		{Day: "2026-10-17", Orders: 2, Gross: 2100, Net: 2100},
+		{Day: "2026-10-18", Orders: 2, Gross: 2400, RefundCount: 1, Refunds: 600, Tax: 120, Net: 1680},
+	}
+	if !reflect.DeepEqual(days, want) {
+		t.Errorf("got  %+v\nwant %+v", days, want)
+	}
+}
+
+func TestGetRevenueByDayNeedsRates(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	db.Expect("from fx_rates").WithArgs("usd").NoRows()
+	db.Expect("from daily_sales").Rows([]interface{}{day("2026-10-17"), "gbp", 1, 1000, 0, 0, 0})
+
+	_, err := m.GetRevenueByDay(day("2026-10-17"), day("2026-10-18"), ReportCurrency{Code: "usd", Convert: true})
+	if !errors.Is(err, money.ErrNoRate) {
+		t.Errorf("got %v, want ErrNoRate", err)
+	}
+}
+
+func TestGetReportSummary(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	from, to := day("2026-10-01"), day("2026-10-03")
+	db.Expect("from daily_sales").WithArgs("usd", from, to).Rows(
+		[]interface{}{day("2026-10-01"), "usd", 1, 4000, 0, 0, 300},
+		[]interface{}{day("2026-10-02"), "usd", 3, 6000, 1, 1000, 200},
+	)
+	// the day before the period gives the subscriptions active when it started
+	db.Expect("from daily_subscriptions").WithArgs("usd", day("2026-09-30"), to).Rows(
+		[]interface{}{day("2026-09-30"), "usd", 10, 5000, 1, 0},
+		[]interface{}{day("2026-10-01"), "usd", 11, 5500, 2, 1},
+		[]interface{}{day("2026-10-02"), "usd", 9, 4500, 0, 2},
+	)
+
+	s, err := m.GetReportSummary(from, to, ReportCurrency{Code: "usd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ReportSummary{
+		From:                "2026-10-01",
+		To:                  "2026-10-02",
+		Currency:            "usd",
+		Orders:              4,
+		Gross:               10000,
+		Refunds:             1000,
+		Tax:                 500,
+		Net:                 8500,
+		AverageOrderValue:   2500,
+		ActiveSubscriptions: 9,
+		MRR:                 4500,
+		ARR:                 54000,
+		NewSubscriptions:    2,
+		Cancellations:       3,
+		ChurnRate:           0.25,
+	}
+	if s != want {
+		t.Errorf("got  %+v\nwant %+v", s, want)
+	}
+}
@@ -0,0 +1,458 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Statuses of a return merchandise authorization
+const (
+	ReturnRequested = "requested"
+	ReturnApproved  = "approved"
+	ReturnRejected  = "rejected"
+	ReturnReceived  = "received"
+	ReturnRefunding = "refunding"
+	ReturnRefunded  = "refunded"
+	ReturnCancelled = "cancelled"
+)
+
+var (
+	// ErrReturnTransition is returned when a return cannot move to a status from its current one
+	ErrReturnTransition = errors.New("the return cannot move to this status")
+	// ErrNotReturnable is returned when opening a return of a subscription or of a refunded sale
+	ErrNotReturnable = errors.New("only cleared sales can be returned")
+	// ErrReturnItem is returned when a return names a widget the order did not sell
+	ErrReturnItem = errors.New("the order did not sell this widget")
+	// ErrReturnQuantity is returned when a return takes back more than was sold and not
+	// already returned
+	ErrReturnQuantity = errors.New("more items than are left to return")
+)
+
+// returnTransitions lists the statuses a return can move to from each status. A return
+// is refunded only once the goods are received, and is refunding while its refund is
+// being issued so the refund is only issued by whoever claimed it.
+var returnTransitions = map[string][]string{
+	ReturnRequested: {ReturnApproved, ReturnRejected, ReturnCancelled},
+	ReturnApproved:  {ReturnReceived, ReturnCancelled},
+	ReturnReceived:  {ReturnRefunding},
+	ReturnRefunding: {ReturnRefunded},
+}
+
+// CanMoveReturn reports whether a return can move from one status to another
+func CanMoveReturn(from, to string) bool {
+	for _, next := range returnTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Return is a return merchandise authorization: the items of a sale a customer sends
+// back, and the partial refund they get once the items are received. Amount is the
+// refund, the sum of the amounts of the items.
+type Return struct {
+	ID        int            `json:"id"`
+	OrderID   int            `json:"order_id"`
+	Status    string         `json:"status"`
+	Reason    string         `json:"reason"`
+	Amount    int            `json:"amount"`
+	UserID    int            `json:"user_id"`
+	Items     []*ReturnItem  `json:"items"`
+	Events    []*ReturnEvent `json:"events"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"-"`
+}
+
+// ReturnItem is a widget sent back. Amount is what the customer paid for Quantity of
+// it, tax included and shipping excluded.
+type ReturnItem struct {
+	ID         int       `json:"id"`
+	ReturnID   int       `json:"return_id"`
+	WidgetID   int       `json:"widget_id"`
+	WidgetName string    `json:"widget_name"`
+	Quantity   int       `json:"quantity"`
+	Amount     int       `json:"amount"`
+	CreatedAt  time.Time `json:"-"`
+	UpdatedAt  time.Time `json:"-"`
+}
+
+// ReturnEvent is a timestamped move of a return from one status to another. UserID is
+// the admin user who moved it, or 0 for the customer.
+type ReturnEvent struct {
+	ID         int       `json:"id"`
+	ReturnID   int       `json:"return_id"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Note       string    `json:"note"`
+	UserID     int       `json:"user_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"-"`
+}
+
+// nullID turns a zero ID into NULL
+func nullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// InsertReturn opens a return of items of a cleared sale and returns its ID. Each item
+// is priced at what the customer paid for it, from the order's lines when it has items. It returns ErrNotReturnable,
+// ErrReturnItem or ErrReturnQuantity when the sale cannot take the return.
+func (m *DBWrapper) InsertReturn(r Return) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// lock the order so concurrent returns cannot take back the same items twice
+	query := `
+		select coalesce(o.widget_id, 0), o.status_id, o.quantity, o.amount, o.shipping, coalesce(w.is_recurring, 0)
+		from orders o
+			left join widgets w on (o.widget_id = w.id)
+		where o.id = ?
+		for update`
+
+	var widgetID, statusID, quantity, amount, shipping int
+	var recurring bool
+	err = tx.QueryRowContext(ctx, query, r.OrderID).Scan(&widgetID, &statusID, &quantity, &amount, &shipping, &recurring)
+	if err != nil {
+		return 0, err
+	}
+	if recurring || statusID != OrderCleared {
+		return 0, ErrNotReturnable
+	}
+
+	// an order with items sold each widget at the amount of its lines; an order
+	// without sold quantity of its widget for what was paid less shipping
+	lines, err := returnLines(ctx, tx, r.OrderID)
+	if err != nil {
+		return 0, err
+	}
+	if lines == nil {
+		lines = map[int]*returnLine{widgetID: {quantity: quantity, amount: amount - shipping}}
+	}
+
+	query = `
+		select ri.widget_id, coalesce(sum(ri.quantity), 0), coalesce(sum(ri.amount), 0)
+		from return_items ri
+			left join returns r on (ri.return_id = r.id)
+		where r.order_id = ? and r.status not in (?, ?)
+		group by ri.widget_id`
+
+	rows, err := tx.QueryContext(ctx, query, r.OrderID, ReturnRejected, ReturnCancelled)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var id, returned, priced int
+		if err = rows.Scan(&id, &returned, &priced); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if l, ok := lines[id]; ok {
+			l.returned, l.priced = returned, priced
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	r.Amount = 0
+	for _, item := range r.Items {
+		l, ok := lines[item.WidgetID]
+		if !ok {
+			return 0, ErrReturnItem
+		}
+		l.returned += item.Quantity
+		if l.returned > l.quantity {
+			return 0, ErrReturnQuantity
+		}
+		item.Amount = l.amount * item.Quantity / l.quantity
+		if l.returned == l.quantity {
+			// the last items take the cents lost to rounding
+			item.Amount = l.amount - l.priced
+		}
+		l.priced += item.Amount
+		r.Amount += item.Amount
+	}
+
+	stmt := `
+		insert into returns (order_id, status, reason, amount, user_id, created_at, updated_at)
+		values (?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.ExecContext(ctx, stmt, r.OrderID, ReturnRequested, r.Reason, r.Amount, nullID(r.UserID), time.Now(), time.Now())
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `
+		insert into return_items (return_id, widget_id, quantity, amount, created_at, updated_at)
+		values (?, ?, ?, ?, ?, ?)`
+	for _, item := range r.Items {
+		_, err = tx.ExecContext(ctx, stmt, id, item.WidgetID, item.Quantity, item.Amount, time.Now(), time.Now())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = insertReturnEvent(ctx, tx, ReturnEvent{ReturnID: int(id), ToStatus: ReturnRequested, Note: r.Reason, UserID: r.UserID})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), tx.Commit()
+}
+
+// returnLine is what an order sold of a widget, and what of it is already returned
+type returnLine struct {
+	quantity, amount, returned, priced int
+}
+
+// returnLines returns the lines of the items of an order by widget, or nil when the order
+// has no items. Custom lines cannot be returned.
+func returnLines(ctx context.Context, tx *sql.Tx, orderID int) (map[int]*returnLine, error) {
+	rows, err := tx.QueryContext(ctx, "select coalesce(widget_id, 0), quantity, amount from order_items where order_id = ?", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines map[int]*returnLine
+	for rows.Next() {
+		var widgetID, quantity, amount int
+		if err := rows.Scan(&widgetID, &quantity, &amount); err != nil {
+			return nil, err
+		}
+		if lines == nil {
+			lines = make(map[int]*returnLine)
+		}
+		if widgetID == 0 {
+			continue
+		}
+		l, ok := lines[widgetID]
+		if !ok {
+			l = &returnLine{}
+			lines[widgetID] = l
+		}
+		l.quantity += quantity
+		l.amount += amount
+	}
+	return lines, rows.Err()
+}
+
+// MoveReturn moves a return to another status and records the move. Receiving a return
+// puts its items back into inventory. Refunding it marks the transaction of the sale
+// partially refunded, or the sale refunded once every cent has been refunded; the
+// refund itself must already have been issued. It returns ErrReturnTransition when the
+// move is not allowed from the return's current status.
+func (m *DBWrapper) MoveReturn(e ReturnEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var orderID int
+	err = tx.QueryRowContext(ctx, "select order_id, status from returns where id = ? for update", e.ReturnID).Scan(&orderID, &e.FromStatus)
+	if err != nil {
+		return err
+	}
+	if !CanMoveReturn(e.FromStatus, e.ToStatus) {
+		return ErrReturnTransition
+	}
+
+	_, err = tx.ExecContext(ctx, "update returns set status = ?, updated_at = ? where id = ?", e.ToStatus, time.Now(), e.ReturnID)
+	if err != nil {
+		return err
+	}
+
+	switch e.ToStatus {
+	case ReturnReceived:
+		stmt := `
+			update widgets w
+				join return_items ri on (ri.widget_id = w.id)
+			set w.inventory_level = w.inventory_level + ri.quantity, w.updated_at = ?
+			where ri.return_id = ?`
+		if _, err = tx.ExecContext(ctx, stmt, time.Now(), e.ReturnID); err != nil {
+			return err
+		}
+	case ReturnRefunded:
+		if err = refundOrder(ctx, tx, orderID); err != nil {
+			return err
+		}
+	}
+
+	if err = insertReturnEvent(ctx, tx, e); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// refundOrder updates the statuses of a sale after one of its returns was refunded
+func refundOrder(ctx context.Context, tx *sql.Tx, orderID int) error {
+	query := `
+		select t.id, t.amount, coalesce((
+			select sum(r.amount) from returns r where r.order_id = o.id and r.status = ?
+		), 0)
+		from orders o
+			left join transactions t on (o.transaction_id = t.id)
+		where o.id = ?`
+
+	var transactionID, amount, refunded int
+	if err := tx.QueryRowContext(ctx, query, ReturnRefunded, orderID).Scan(&transactionID, &amount, &refunded); err != nil {
+		return err
+	}
+
+	status := TransactionPartiallyRefunded
+	if refunded >= amount {
+		status = TransactionRefunded
+		_, err := tx.ExecContext(ctx, "update orders set status_id = ?, refunded_at = ?, updated_at = ? where id = ?", OrderRefunded, time.Now(), time.Now(), orderID)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := tx.ExecContext(ctx, "update transactions set transaction_status_id = ?, updated_at = ? where id = ?", status, time.Now(), transactionID)
+	return err
+}
+
+func insertReturnEvent(ctx context.Context, tx *sql.Tx, e ReturnEvent) error {
+	stmt := `
+		insert into return_events (return_id, from_status, to_status, note, user_id, created_at, updated_at)
+		values (?, ?, ?, ?, ?, ?, ?)`
+	_, err := tx.ExecContext(ctx, stmt, e.ReturnID, e.FromStatus, e.ToStatus, e.Note, nullID(e.UserID), time.Now(), time.Now())
+	return err
+}
+
+// GetRefundedAmount returns how much of a sale has been refunded through its returns
+func (m *DBWrapper) GetRefundedAmount(orderID int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var refunded int
+	query := "select coalesce(sum(amount), 0) from returns where order_id = ? and status = ?"
+	err := m.DB.QueryRowContext(ctx, query, orderID, ReturnRefunded).Scan(&refunded)
+	return refunded, err
+}
+
+// GetReturn returns a return with its items and history
+func (m *DBWrapper) GetReturn(id int) (Return, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	returns, err := m.getReturns(ctx, "r.id = ?", id)
+	if err != nil {
+		return Return{}, err
+	}
+	if len(returns) == 0 {
+		return Return{}, sql.ErrNoRows
+	}
+	return *returns[0], nil
+}
+
+// GetReturnsForOrder returns the returns of a sale with their items and history, oldest first
+func (m *DBWrapper) GetReturnsForOrder(orderID int) ([]*Return, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.getReturns(ctx, "r.order_id = ?", orderID)
+}
+
+func (m *DBWrapper) getReturns(ctx context.Context, where string, arg interface{}) ([]*Return, error) {
+	query := `
+		select r.id, r.order_id, r.status, r.reason, r.amount, coalesce(r.user_id, 0), r.created_at, r.updated_at
+		from returns r
+		where ` + where + `
+		order by r.created_at, r.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	returns := []*Return{}
+	byID := make(map[int]*Return)
+	for rows.Next() {
+		r := &Return{Items: []*ReturnItem{}, Events: []*ReturnEvent{}}
+		err = rows.Scan(&r.ID, &r.OrderID, &r.Status, &r.Reason, &r.Amount, &r.UserID, &r.CreatedAt, &r.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		returns = append(returns, r)
+		byID[r.ID] = r
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		select ri.id, ri.return_id, ri.widget_id, coalesce(w.name, ''), ri.quantity, ri.amount, ri.created_at, ri.updated_at
+		from return_items ri
+			left join returns r on (ri.return_id = r.id)
+			left join widgets w on (ri.widget_id = w.id)
+		where ` + where + `
+		order by ri.id`
+
+	rows, err = m.DB.QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i ReturnItem
+		err = rows.Scan(&i.ID, &i.ReturnID, &i.WidgetID, &i.WidgetName, &i.Quantity, &i.Amount, &i.CreatedAt, &i.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if r, ok := byID[i.ReturnID]; ok {
+			r.Items = append(r.Items, &i)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		select e.id, e.return_id, e.from_status, e.to_status, e.note, coalesce(e.user_id, 0), e.created_at, e.updated_at
+		from return_events e
+			left join returns r on (e.return_id = r.id)
+		where ` + where + `
+		order by e.created_at, e.id`
+
+	rows, err = m.DB.QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e ReturnEvent
+		err = rows.Scan(&e.ID, &e.ReturnID, &e.FromStatus, &e.ToStatus, &e.Note, &e.UserID, &e.CreatedAt, &e.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if r, ok := byID[e.ReturnID]; ok {
+			r.Events = append(r.Events, &e)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return returns, nil
+}
@@ -0,0 +1,205 @@
+package models
+
+import (
+	"testing"
+
+	"go-commerce/internal/dbtest"
+)
+
+func TestCanMoveReturn(t *testing.T) {
+	statuses := []string{ReturnRequested, ReturnApproved, ReturnRejected, ReturnReceived, ReturnRefunding, ReturnRefunded, ReturnCancelled}
+	allowed := map[[2]string]bool{
+		{ReturnRequested, ReturnApproved}:  true,
+		{ReturnRequested, ReturnRejected}:  true,
+		{ReturnRequested, ReturnCancelled}: true,
+		{ReturnApproved, ReturnReceived}:   true,
+		{ReturnApproved, ReturnCancelled}:  true,
+		{ReturnReceived, ReturnRefunding}:  true,
+		{ReturnRefunding, ReturnRefunded}:  true,
+	}
+	for _, from := range statuses {
+		for _, to := range statuses {
+			if got := CanMoveReturn(from, to); got != allowed[[2]string{from, to}] {
+				t.Errorf("CanMoveReturn(%s, %s) = %v", from, to, got)
+			}
+		}
+	}
+}
+
+// expectReturnableOrder expects InsertReturn to lock order 5, which sold quantity of
+// widget 1 for amount including shipping, with returned items priced at priced already
+// on other returns
+func expectReturnableOrder(db *dbtest.DB, quantity, amount, shipping, returned, priced int) {
+	db.Expect("from orders o left join widgets w on (o.widget_id = w.id) where o.id = ? for update").
+		WithArgs(5).
+		Rows([]interface{}{1, OrderCleared, quantity, amount, shipping, false})
+	db.Expect("from order_items where order_id = ?").WithArgs(5).NoRows()
+	db.Expect("from return_items ri").
+		WithArgs(5, ReturnRejected, ReturnCancelled).
+		Rows([]interface{}{1, returned, priced})
+}
+
+func TestInsertReturnPricesItems(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	// 3 widgets for 1000 plus 500 shipping, one of them already returned for 333
+	expectReturnableOrder(db, 3, 1500, 500, 1, 333)
+	ret := db.Expect("insert into returns").Result(4, 1)
+	first := db.Expect("insert into return_items")
+	last := db.Expect("insert into return_items")
+	db.Expect("insert into return_events").WithArgs(4, "", ReturnRequested, "broken", nil, dbtest.Any, dbtest.Any)
+
+	id, err := m.InsertReturn(Return{
+		OrderID: 5,
+		Reason:  "broken",
+		Items:   []*ReturnItem{{WidgetID: 1, Quantity: 1}, {WidgetID: 1, Quantity: 1}},
+	})
+	if err != nil || id != 4 {
+		t.Fatalf("got %d, %v", id, err)
+	}
+	// the last item takes the cent lost to rounding, so the order is returned for 1000
+	if first.Args[3] != int64(333) || last.Args[3] != int64(334) {
+		t.Errorf("priced the items at %v and %v", first.Args[3], last.Args[3])
+	}
+	if ret.Args[3] != int64(667) {
+		t.Errorf("priced the return at %v", ret.Args[3])
+	}
+	if db.Commits != 1 {
+		t.Errorf("got %d commits", db.Commits)
+	}
+}
+
+func TestInsertReturnPricesOrderItems(t *testing.T) {
+	// 2 of widget 1 for 600, 1 of widget 2 for 400 and a custom line for 100; one of
+	// widget 1 already returned for 300
+	expect := func(db *dbtest.DB) {
+		db.Expect("for update").WithArgs(5).Rows([]interface{}{0, OrderCleared, 4, 1100, 0, false})
+		db.Expect("from order_items where order_id = ?").WithArgs(5).Rows(
+			[]interface{}{1, 2, 600},
+			[]interface{}{2, 1, 400},
+			[]interface{}{0, 1, 100},
+		)
+		db.Expect("from return_items ri").Rows([]interface{}{1, 1, 300})
+	}
+
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+	expect(db)
+	ret := db.Expect("insert into returns").Result(4, 1)
+	first := db.Expect("insert into return_items")
+	last := db.Expect("insert into return_items")
+	db.Expect("insert into return_events")
+
+	_, err := m.InsertReturn(Return{OrderID: 5, Items: []*ReturnItem{{WidgetID: 2, Quantity: 1}, {WidgetID: 1, Quantity: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Args[3] != int64(400) || last.Args[3] != int64(300) || ret.Args[3] != int64(700) {
+		t.Errorf("priced the items at %v and %v and the return at %v", first.Args[3], last.Args[3], ret.Args[3])
+	}
+
+	tests := []struct {
+		item *ReturnItem
+		want error
+	}{
+		{&ReturnItem{WidgetID: 0, Quantity: 1}, ErrReturnItem},
+		{&ReturnItem{WidgetID: 3, Quantity: 1}, ErrReturnItem},
+		{&ReturnItem{WidgetID: 1, Quantity: 2}, ErrReturnQuantity},
+	}
+	for _, tt := range tests {
+		db := dbtest.New(t)
+		m := DBWrapper{DB: db.SQL}
+		expect(db)
+		if _, err := m.InsertReturn(Return{OrderID: 5, Items: []*ReturnItem{tt.item}}); err != tt.want {
+			t.Errorf("returning %d of widget %d: got %v, want %v", tt.item.Quantity, tt.item.WidgetID, err, tt.want)
+		}
+	}
+}
+
+func TestInsertReturnRefusesReturns(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []*ReturnItem
+		want  error
+	}{
+		{"other widget", []*ReturnItem{{WidgetID: 2, Quantity: 1}}, ErrReturnItem},
+		{"too many", []*ReturnItem{{WidgetID: 1, Quantity: 1}, {WidgetID: 1, Quantity: 1}}, ErrReturnQuantity},
+	}
+	for _, tt := range tests {
+		db := dbtest.New(t)
+		m := DBWrapper{DB: db.SQL}
+		expectReturnableOrder(db, 2, 1000, 0, 1, 500)
+
+		if _, err := m.InsertReturn(Return{OrderID: 5, Items: tt.items}); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+		if db.Rollbacks != 1 {
+			t.Errorf("%s: got %d rollbacks", tt.name, db.Rollbacks)
+		}
+	}
+
+	for _, row := range [][]interface{}{
+		{1, OrderRefunded, 1, 1000, 0, false},
+		{1, OrderCleared, 1, 1000, 0, true},
+	} {
+		db := dbtest.New(t)
+		m := DBWrapper{DB: db.SQL}
+		db.Expect("for update").Rows(row)
+
+		if _, err := m.InsertReturn(Return{OrderID: 5, Items: []*ReturnItem{{WidgetID: 1, Quantity: 1}}}); err != ErrNotReturnable {
+			t.Errorf("%v: got %v, want ErrNotReturnable", row, err)
+		}
+	}
+}
+
+func TestMoveReturn(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	db.Expect("select order_id, status from returns where id = ? for update").WithArgs(4).Rows([]interface{}{5, ReturnApproved})
+	db.Expect("update returns set status = ?").WithArgs(ReturnReceived, dbtest.Any, 4)
+	db.Expect("set w.inventory_level = w.inventory_level + ri.quantity").WithArgs(dbtest.Any, 4)
+	db.Expect("insert into return_events").WithArgs(4, ReturnApproved, ReturnReceived, "", int64(2), dbtest.Any, dbtest.Any)
+
+	if err := m.MoveReturn(ReturnEvent{ReturnID: 4, ToStatus: ReturnReceived, UserID: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if db.Commits != 1 {
+		t.Errorf("got %d commits", db.Commits)
+	}
+
+	db.Expect("for update").Rows([]interface{}{5, ReturnRequested})
+	if err := m.MoveReturn(ReturnEvent{ReturnID: 4, ToStatus: ReturnRefunded}); err != ErrReturnTransition {
+		t.Errorf("refunding a requested return: got %v", err)
+	}
+}
+
+func TestMoveReturnRefunds(t *testing.T) {
+	tests := []struct {
+		refunded int
+		full     bool
+	}{
+		{400, false},
+		{1000, true},
+	}
+	for _, tt := range tests {
+		db := dbtest.New(t)
+		m := DBWrapper{DB: db.SQL}
+
+		db.Expect("for update").Rows([]interface{}{5, ReturnRefunding})
+		db.Expect("update returns set status = ?").WithArgs(ReturnRefunded, dbtest.Any, 4)
+		db.Expect("select sum(r.amount) from returns r").WithArgs(ReturnRefunded, 5).Rows([]interface{}{8, 1000, tt.refunded})
+		status := TransactionPartiallyRefunded
+		if tt.full {
+			status = TransactionRefunded
+			db.Expect("update orders set status_id = ?, refunded_at = ?").WithArgs(OrderRefunded, dbtest.Any, dbtest.Any, 5)
+		}
+		db.Expect("update transactions set transaction_status_id = ?").WithArgs(status, dbtest.Any, 8)
+		db.Expect("insert into return_events")
+
+		if err := m.MoveReturn(ReturnEvent{ReturnID: 4, ToStatus: ReturnRefunded}); err != nil {
+			t.Errorf("refunded %d: %v", tt.refunded, err)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// OrderFilter filters sales and subscriptions. Zero values do not filter.
+type OrderFilter struct {
+	From                time.Time // created at or after
+	To                  time.Time // created before
+	StatusID            int
+	WidgetID            int
+	Email               string // partial match on the customer's email
+	LastFour            string
+	MinAmount           int
+	MaxAmount           int
+	Currency            string
+	FulfillmentStatusID int
+}
+
+// CustomerFilter filters customers. Zero values do not filter.
+type CustomerFilter struct {
+	From  time.Time // created at or after
+	To    time.Time // created before
+	Email string    // partial match
+}
+
+// UserFilter filters admin users. Zero values do not filter.
+type UserFilter struct {
+	Search string // partial match on name or email
+}
+
+// orderSortColumns are the keys sales and subscriptions can be sorted by
+var orderSortColumns = map[string]string{
+	"id":                 "o.id",
+	"created_at":         "o.created_at",
+	"amount":             "o.amount",
+	"quantity":           "o.quantity",
+	"status":             "o.status_id",
+	"widget":             "coalesce(w.name, '')",
+	"customer":           "coalesce(c.last_name, '')",
+	"email":              "coalesce(c.email, '')",
+	"currency":           "coalesce(t.currency, '')",
+	"last_four":          "coalesce(t.last_four, '')",
+	"fulfillment_status": "o.fulfillment_status_id",
+}
+
+// customerSortColumns are the keys customers can be sorted by
+var customerSortColumns = map[string]string{
+	"id":         "id",
+	"first_name": "first_name",
+	"last_name":  "last_name",
+	"email":      "email",
+	"created_at": "created_at",
+}
+
+// userSortColumns are the keys admin users can be sorted by
+var userSortColumns = map[string]string{
+	"id":         "id",
+	"first_name": "first_name",
+	"last_name":  "last_name",
+	"email":      "email",
+	"created_at": "created_at",
+}
+
+func (f OrderFilter) apply(q *listQuery) {
+	if !f.From.IsZero() {
+		q.where("o.created_at >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		q.where("o.created_at < ?", f.To)
+	}
+	if f.StatusID != 0 {
+		q.where("o.status_id = ?", f.StatusID)
+	}
+	if f.WidgetID != 0 {
+		q.where("o.widget_id = ?", f.WidgetID)
+	}
+	if f.Email != "" {
+		q.where("c.email like ?", likePattern(f.Email))
+	}
+	if f.LastFour != "" {
+		q.where("t.last_four = ?", f.LastFour)
+	}
+	if f.MinAmount != 0 {
+		q.where("o.amount >= ?", f.MinAmount)
+	}
+	if f.MaxAmount != 0 {
+		q.where("o.amount <= ?", f.MaxAmount)
+	}
+	if f.Currency != "" {
+		q.where("t.currency = ?", f.Currency)
+	}
+	if f.FulfillmentStatusID != 0 {
+		q.where("o.fulfillment_status_id = ?", f.FulfillmentStatusID)
+	}
+}
+
+func (f CustomerFilter) apply(q *listQuery) {
+	if !f.From.IsZero() {
+		q.where("created_at >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		q.where("created_at < ?", f.To)
+	}
+	if f.Email != "" {
+		q.where("email like ?", likePattern(f.Email))
+	}
+}
+
+const orderColumns = `
+		o.id, coalesce(o.widget_id, 0), o.transaction_id, o.customer_id,
+		o.status_id, o.quantity, o.amount, o.created_at,
+		o.updated_at, coalesce(w.id, 0), coalesce(w.name, ''), t.id, t.amount, t.currency,
+		t.last_four, t.expiry_month, t.expiry_year, t.payment_intent,
+		t.bank_return_code, c.id, c.first_name, c.last_name, c.email,
+		o.fulfillment_status_id, o.carrier, o.tracking_number`
+
+const orderTables = `
+	from
+		orders o
+		left join widgets w on (o.widget_id = w.id)
+		left join transactions t on (o.transaction_id = t.id)
+		left join customers c on (o.customer_id = c.id)
+	`
+
+// scanOrder scans a row selected with orderColumns, followed by extra columns
+func scanOrder(rows *sql.Rows, o *Order, extra ...interface{}) error {
+	dest := []interface{}{
+		&o.ID,
+		&o.WidgetID,
+		&o.TransactionID,
+		&o.CustomerID,
+		&o.StatusID,
+		&o.Quantity,
+		&o.Amount,
+		&o.CreatedAt,
+		&o.UpdatedAt,
+		&o.Widget.ID,
+		&o.Widget.Name,
+		&o.Transaction.ID,
+		&o.Transaction.Amount,
+		&o.Transaction.Currency,
+		&o.Transaction.LastFour,
+		&o.Transaction.CardExpiryMonth,
+		&o.Transaction.CardExpiryYear,
+		&o.Transaction.PaymentIntent,
+		&o.Transaction.BankReturnCode,
+		&o.Customer.ID,
+		&o.Customer.FirstName,
+		&o.Customer.LastName,
+		&o.Customer.Email,
+		&o.FulfillmentStatusID,
+		&o.Carrier,
+		&o.TrackingNumber,
+	}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	o.FulfillmentStatus = FulfillmentStatusName(o.FulfillmentStatusID)
+	return nil
+}
+
+// SearchSales returns a page of one-off sales matching f
+func (m *DBWrapper) SearchSales(f OrderFilter, p ListParams) ([]*Order, *PageInfo, error) {
+	return m.searchOrders(false, f, p)
+}
+
+// SearchSubscriptions returns a page of subscriptions matching f
+func (m *DBWrapper) SearchSubscriptions(f OrderFilter, p ListParams) ([]*Order, *PageInfo, error) {
+	return m.searchOrders(true, f, p)
+}
+
+func (m *DBWrapper) searchOrders(recurring bool, f OrderFilter, p ListParams) ([]*Order, *PageInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	q, err := newListQuery(p, "o.id", orderSortColumns, "-created_at")
+	if err != nil {
+		return nil, nil, err
+	}
+	q.where("coalesce(w.is_recurring, 0) = ?", recurring)
+	f.apply(q)
+
+	clauses, args := q.pageClauses()
+	query := "select" + orderColumns + ", " + q.sortColumn + orderTables + clauses
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var orders []*Order
+	var sortValues []interface{}
+	for rows.Next() {
+		var o Order
+		var sortValue interface{}
+		err = scanOrder(rows, &o, &sortValue)
+		if err != nil {
+			return nil, nil, err
+		}
+		orders = append(orders, &o)
+		sortValues = append(sortValues, sortValue)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	n, more := q.hasNextPage(len(orders))
+	orders = orders[:n]
+
+	info := &PageInfo{}
+	if more {
+		info.NextCursor = q.nextCursor(sortValues[n-1], orders[n-1].ID)
+	}
+	if q.offsetPaging() {
+		where, countArgs := q.whereClause()
+		var total int
+		err = m.DB.QueryRowContext(ctx, "select count(o.id)"+orderTables+where, countArgs...).Scan(&total)
+		if err != nil {
+			return nil, nil, err
+		}
+		info = q.pageInfo(total)
+	}
+
+	return orders, info, nil
+}
+
+// SearchUsers returns a page of admin users matching f
+func (m *DBWrapper) SearchUsers(f UserFilter, p ListParams) ([]*User, *PageInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	q, err := newListQuery(p, "id", userSortColumns, "last_name")
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.Search != "" {
+		pattern := likePattern(f.Search)
+		q.where("(first_name like ? or last_name like ? or email like ?)", pattern, pattern, pattern)
+	}
+
+	clauses, args := q.pageClauses()
+	query := `
+		select id, first_name, last_name, email, created_at, updated_at, ` + q.sortColumn + `
+		from users` + clauses
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	var sortValues []interface{}
+	for rows.Next() {
+		var u User
+		var sortValue interface{}
+		err = rows.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.CreatedAt, &u.UpdatedAt, &sortValue)
+		if err != nil {
+			return nil, nil, err
+		}
+		users = append(users, &u)
+		sortValues = append(sortValues, sortValue)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	n, more := q.hasNextPage(len(users))
+	users = users[:n]
+
+	info := &PageInfo{}
+	if more {
+		info.NextCursor = q.nextCursor(sortValues[n-1], users[n-1].ID)
+	}
+	if q.offsetPaging() {
+		where, countArgs := q.whereClause()
+		var total int
+		err = m.DB.QueryRowContext(ctx, "select count(id) from users"+where, countArgs...).Scan(&total)
+		if err != nil {
+			return nil, nil, err
+		}
+		info = q.pageInfo(total)
+	}
+
+	return users, info, nil
+}
+
+// EachSale calls fn for every one-off sale matching f, in the order given by sort. Rows are
+// streamed from the database rather than loaded into memory. EachSale stops at the first
+// error returned by fn, and when ctx is done.
+func (m *DBWrapper) EachSale(ctx context.Context, f OrderFilter, sort string, fn func(*Order) error) error {
+	return m.eachOrder(ctx, false, 0, f, sort, fn)
+}
+
+// EachSubscription calls fn for every subscription matching f, like EachSale
+func (m *DBWrapper) EachSubscription(ctx context.Context, f OrderFilter, sort string, fn func(*Order) error) error {
+	return m.eachOrder(ctx, true, 0, f, sort, fn)
+}
+
+// EachRefund calls fn for every refunded sale matching f, like EachSale
+func (m *DBWrapper) EachRefund(ctx context.Context, f OrderFilter, sort string, fn func(*Order) error) error {
+	return m.eachOrder(ctx, false, OrderRefunded, f, sort, fn)
+}
+
+func (m *DBWrapper) eachOrder(ctx context.Context, recurring bool, statusID int, f OrderFilter, sort string, fn func(*Order) error) error {
+	q, err := newListQuery(ListParams{Sort: sort}, "o.id", orderSortColumns, "-created_at")
+	if err != nil {
+		return err
+	}
+	q.where("coalesce(w.is_recurring, 0) = ?", recurring)
+	if statusID != 0 {
+		q.where("o.status_id = ?", statusID)
+	}
+	f.apply(q)
+
+	clauses, args := q.streamClauses()
+	rows, err := m.DB.QueryContext(ctx, "select"+orderColumns+orderTables+clauses, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o Order
+		if err := scanOrder(rows, &o); err != nil {
+			return err
+		}
+		if err := fn(&o); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// EachCustomer calls fn for every customer matching f, like EachSale
+func (m *DBWrapper) EachCustomer(ctx context.Context, f CustomerFilter, sort string, fn func(*Customer) error) error {
+	q, err := newListQuery(ListParams{Sort: sort}, "id", customerSortColumns, "last_name")
+	if err != nil {
+		return err
+	}
+	f.apply(q)
+
+	clauses, args := q.streamClauses()
+	query := `
+		select id, first_name, last_name, email, created_at, updated_at
+		from customers` + clauses
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Customer
+		if err := rows.Scan(&c.ID, &c.FirstName, &c.LastName, &c.Email, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return err
+		}
+		if err := fn(&c); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,219 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"go-commerce/internal/shipping"
+)
+
+// ShippingZone puts Jurisdiction, a country like "US", a subdivision like "US-AK" or
+// "*" for the rest of the world, in the shipping zone Zone
+type ShippingZone struct {
+	ID           int       `json:"id"`
+	Zone         string    `json:"zone"`
+	Jurisdiction string    `json:"jurisdiction"`
+	CreatedAt    time.Time `json:"-"`
+	UpdatedAt    time.Time `json:"-"`
+}
+
+// ShippingRate is a shipping method of a zone. Parcels from MinWeight up to MaxWeight
+// grams, or without limit when MaxWeight is 0, cost Flat plus PerKg for every started
+// kilogram, in minor units of Currency.
+type ShippingRate struct {
+	ID        int       `json:"id"`
+	Zone      string    `json:"zone"`
+	Method    string    `json:"method"`
+	Currency  string    `json:"currency"`
+	MinWeight int       `json:"min_weight"`
+	MaxWeight int       `json:"max_weight"`
+	Flat      int       `json:"flat"`
+	PerKg     int       `json:"per_kg"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+// GetShippingZones returns every shipping zone jurisdiction, by zone
+func (m *DBWrapper) GetShippingZones() ([]*ShippingZone, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select id, zone, jurisdiction, created_at, updated_at
+		from shipping_zones
+		order by zone, jurisdiction`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	zones := []*ShippingZone{}
+	for rows.Next() {
+		var z ShippingZone
+		if err := rows.Scan(&z.ID, &z.Zone, &z.Jurisdiction, &z.CreatedAt, &z.UpdatedAt); err != nil {
+			return nil, err
+		}
+		zones = append(zones, &z)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return zones, nil
+}
+
+// SaveShippingZone puts a jurisdiction in a zone, moving it out of the zone it was in
+func (m *DBWrapper) SaveShippingZone(z ShippingZone) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		insert into shipping_zones (zone, jurisdiction, created_at, updated_at)
+		values (?, ?, ?, ?)
+		on duplicate key update zone = values(zone), updated_at = values(updated_at)`
+
+	_, err := m.DB.ExecContext(ctx, stmt, z.Zone, strings.ToUpper(z.Jurisdiction), time.Now(), time.Now())
+	return err
+}
+
+// DeleteShippingZone takes a jurisdiction out of its zone
+func (m *DBWrapper) DeleteShippingZone(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, "delete from shipping_zones where id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetShippingRates returns every shipping rate, by zone and weight
+func (m *DBWrapper) GetShippingRates() ([]*ShippingRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select id, zone, method, currency, min_weight, max_weight, flat, per_kg, created_at, updated_at
+		from shipping_rates
+		order by zone, currency, min_weight, method`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []*ShippingRate{}
+	for rows.Next() {
+		var r ShippingRate
+		err = rows.Scan(&r.ID, &r.Zone, &r.Method, &r.Currency, &r.MinWeight, &r.MaxWeight,
+			&r.Flat, &r.PerKg, &r.CreatedAt, &r.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, &r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rates, nil
+}
+
+// InsertShippingRate inserts a new shipping rate and returns its ID
+func (m *DBWrapper) InsertShippingRate(r ShippingRate) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		insert into shipping_rates
+			(zone, method, currency, min_weight, max_weight, flat, per_kg, created_at, updated_at)
+			values (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := m.DB.ExecContext(ctx, stmt,
+		r.Zone,
+		r.Method,
+		strings.ToLower(r.Currency),
+		r.MinWeight,
+		r.MaxWeight,
+		r.Flat,
+		r.PerKg,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// DeleteShippingRate deletes a shipping rate
+func (m *DBWrapper) DeleteShippingRate(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, "delete from shipping_rates where id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetWidgetWeight sets the shipping weight of a widget in grams
+func (m *DBWrapper) SetWidgetWeight(id, grams int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, "update widgets set weight = ?, updated_at = ? where id = ?", grams, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetShippingTable loads every shipping zone and rate into a shipping calculator
+func (m *DBWrapper) GetShippingTable() (*shipping.Table, error) {
+	zones, err := m.GetShippingZones()
+	if err != nil {
+		return nil, err
+	}
+	rates, err := m.GetShippingRates()
+	if err != nil {
+		return nil, err
+	}
+
+	table := shipping.NewTable()
+	for _, z := range zones {
+		table.AddZone(z.Zone, z.Jurisdiction)
+	}
+	for _, r := range rates {
+		table.AddRate(shipping.Rate{
+			Zone:      r.Zone,
+			Method:    r.Method,
+			Currency:  r.Currency,
+			MinWeight: r.MinWeight,
+			MaxWeight: r.MaxWeight,
+			Flat:      r.Flat,
+			PerKg:     r.PerKg,
+		})
+	}
+	return table, nil
+}
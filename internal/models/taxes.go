@@ -0,0 +1,240 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"go-commerce/internal/tax"
+)
+
+// TaxRule is a tax of Rate percent charged in Jurisdiction, a country like "DE" or a
+// subdivision like "US-CA". Inclusive rules are for prices that already contain the tax.
+type TaxRule struct {
+	ID           int       `json:"id"`
+	Jurisdiction string    `json:"jurisdiction"`
+	Name         string    `json:"name"`
+	Rate         string    `json:"rate"`
+	Inclusive    bool      `json:"inclusive"`
+	CreatedAt    time.Time `json:"-"`
+	UpdatedAt    time.Time `json:"-"`
+}
+
+// TaxExemption exempts the buyer with TaxID from tax in Jurisdiction, or everywhere
+// when Jurisdiction is empty
+type TaxExemption struct {
+	ID           int       `json:"id"`
+	TaxID        string    `json:"tax_id"`
+	Jurisdiction string    `json:"jurisdiction"`
+	Reason       string    `json:"reason"`
+	CreatedAt    time.Time `json:"-"`
+	UpdatedAt    time.Time `json:"-"`
+}
+
+// GetTaxRules returns every tax rule, by jurisdiction
+func (m *DBWrapper) GetTaxRules() ([]*TaxRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select id, jurisdiction, name, rate, inclusive, created_at, updated_at
+		from tax_rules
+		order by jurisdiction, name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []*TaxRule{}
+	for rows.Next() {
+		var r TaxRule
+		err = rows.Scan(&r.ID, &r.Jurisdiction, &r.Name, &r.Rate, &r.Inclusive, &r.CreatedAt, &r.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if rate, err := tax.ParseRate(r.Rate); err == nil {
+			r.Rate = rate.String()
+		}
+		rules = append(rules, &r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// SaveTaxRule stores a rule, replacing the rule of the same name in the same jurisdiction
+func (m *DBWrapper) SaveTaxRule(r TaxRule) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		insert into tax_rules (jurisdiction, name, rate, inclusive, created_at, updated_at)
+		values (?, ?, ?, ?, ?, ?)
+		on duplicate key update rate = values(rate), inclusive = values(inclusive), updated_at = values(updated_at)`
+
+	_, err := m.DB.ExecContext(ctx, stmt,
+		strings.ToUpper(r.Jurisdiction),
+		r.Name,
+		r.Rate,
+		r.Inclusive,
+		time.Now(),
+		time.Now(),
+	)
+	return err
+}
+
+// DeleteTaxRule deletes a tax rule
+func (m *DBWrapper) DeleteTaxRule(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, "delete from tax_rules where id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetTaxExemptions returns every tax exemption, by tax ID
+func (m *DBWrapper) GetTaxExemptions() ([]*TaxExemption, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select id, tax_id, jurisdiction, reason, created_at, updated_at
+		from tax_exemptions
+		order by tax_id, jurisdiction`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exemptions := []*TaxExemption{}
+	for rows.Next() {
+		var e TaxExemption
+		err = rows.Scan(&e.ID, &e.TaxID, &e.Jurisdiction, &e.Reason, &e.CreatedAt, &e.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		exemptions = append(exemptions, &e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return exemptions, nil
+}
+
+// SaveTaxExemption stores an exemption, replacing the reason of an existing exemption
+// of the same tax ID in the same jurisdiction
+func (m *DBWrapper) SaveTaxExemption(e TaxExemption) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		insert into tax_exemptions (tax_id, jurisdiction, reason, created_at, updated_at)
+		values (?, ?, ?, ?, ?)
+		on duplicate key update reason = values(reason), updated_at = values(updated_at)`
+
+	_, err := m.DB.ExecContext(ctx, stmt,
+		tax.NormalizeTaxID(e.TaxID),
+		strings.ToUpper(e.Jurisdiction),
+		e.Reason,
+		time.Now(),
+		time.Now(),
+	)
+	return err
+}
+
+// DeleteTaxExemption deletes a tax exemption
+func (m *DBWrapper) DeleteTaxExemption(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, "delete from tax_exemptions where id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetTaxTable loads every tax rule and exemption into a tax calculator
+func (m *DBWrapper) GetTaxTable() (*tax.Table, error) {
+	rules, err := m.GetTaxRules()
+	if err != nil {
+		return nil, err
+	}
+	exemptions, err := m.GetTaxExemptions()
+	if err != nil {
+		return nil, err
+	}
+
+	table := tax.NewTable()
+	for _, r := range rules {
+		rate, err := tax.ParseRate(r.Rate)
+		if err != nil {
+			return nil, err
+		}
+		table.AddRule(r.Jurisdiction, r.Name, rate, r.Inclusive)
+	}
+	for _, e := range exemptions {
+		table.AddExemption(e.TaxID, e.Jurisdiction, e.Reason)
+	}
+	return table, nil
+}
+
+func insertOrderTaxLines(ctx context.Context, tx *sql.Tx, orderID int, lines []tax.Line) error {
+	stmt := `
+		insert into order_tax_lines
+			(order_id, jurisdiction, name, rate, inclusive, taxable, amount, created_at, updated_at)
+			values (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	for _, l := range lines {
+		_, err := tx.ExecContext(ctx, stmt,
+			orderID, l.Jurisdiction, l.Name, l.Rate, l.Inclusive, l.Taxable, l.Amount, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *DBWrapper) getOrderTaxLines(ctx context.Context, orderID int) ([]tax.Line, error) {
+	query := `
+		select jurisdiction, name, rate, inclusive, taxable, amount
+		from order_tax_lines
+		where order_id = ?
+		order by id`
+
+	rows, err := m.DB.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []tax.Line
+	for rows.Next() {
+		var l tax.Line
+		if err := rows.Scan(&l.Jurisdiction, &l.Name, &l.Rate, &l.Inclusive, &l.Taxable, &l.Amount); err != nil {
+			return nil, err
+		}
+		if rate, err := tax.ParseRate(l.Rate); err == nil {
+			l.Rate = rate.String()
+		}
+		lines = append(lines, l)
+	}
+	return lines, rows.Err()
+}
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// UsageRecord is a quantity of a metered subscription used at RecordedAt, as reported
+// by our services. Records are summed up and pushed to the gateway in batches; ReportedAt
+// is when the record was pushed. An IdempotencyKey makes reporting the same usage again
+// harmless.
+type UsageRecord struct {
+	ID             int        `json:"id"`
+	OrderID        int        `json:"subscription_id"`
+	Quantity       int        `json:"quantity"`
+	RecordedAt     time.Time  `json:"recorded_at"`
+	IdempotencyKey string     `json:"idempotency_key,omitempty"`
+	ReportedAt     *time.Time `json:"reported_at"`
+}
+
+// UnreportedUsage is a usage record of a subscription that has not been pushed to the
+// gateway yet
+type UnreportedUsage struct {
+	OrderID        int
+	SubscriptionID string
+	RecordID       int
+	Quantity       int
+	RecordedAt     time.Time
+}
+
+// SetWidgetBilling sets the trial and metering of the plan of a widget
+func (m *DBWrapper) SetWidgetBilling(id, trialDays int, trialRequiresCard, metered bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, `
+		update widgets set trial_days = ?, trial_requires_card = ?, metered = ?, updated_at = ?
+		where id = ? and is_recurring = 1`,
+		trialDays, trialRequiresCard, metered, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// InsertUsageRecord records usage of a subscription and returns the record. A record
+// whose IdempotencyKey was seen before for the subscription is not inserted again; the
+// first one is returned instead, and created is false.
+func (m *DBWrapper) InsertUsageRecord(u UsageRecord) (UsageRecord, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var key interface{}
+	if u.IdempotencyKey != "" {
+		key = u.IdempotencyKey
+	}
+
+	stmt := `
+		insert ignore into usage_records
+			(order_id, quantity, recorded_at, idempotency_key, created_at, updated_at)
+			values (?, ?, ?, ?, ?, ?)`
+
+	res, err := m.DB.ExecContext(ctx, stmt, u.OrderID, u.Quantity, u.RecordedAt, key, time.Now(), time.Now())
+	if err != nil {
+		return u, false, err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		id, err := res.LastInsertId()
+		u.ID = int(id)
+		return u, true, err
+	}
+
+	query := `
+		select id, order_id, quantity, recorded_at, coalesce(idempotency_key, ''), reported_at
+		from usage_records
+		where order_id = ? and idempotency_key = ?`
+
+	var reported sql.NullTime
+	err = m.DB.QueryRowContext(ctx, query, u.OrderID, key).Scan(
+		&u.ID, &u.OrderID, &u.Quantity, &u.RecordedAt, &u.IdempotencyKey, &reported)
+	if reported.Valid {
+		u.ReportedAt = &reported.Time
+	}
+	return u, false, err
+}
+
+// GetUnreportedUsage returns the usage records that have not been pushed to the gateway
+// yet, by subscription and in the order they were recorded
+func (m *DBWrapper) GetUnreportedUsage() ([]UnreportedUsage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select u.order_id, t.payment_intent, u.id, u.quantity, u.recorded_at
+		from usage_records u
+			join orders o on (u.order_id = o.id)
+			join transactions t on (o.transaction_id = t.id)
+		where u.reported_at is null
+		order by u.order_id, u.id`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []UnreportedUsage
+	for rows.Next() {
+		var u UnreportedUsage
+		if err := rows.Scan(&u.OrderID, &u.SubscriptionID, &u.RecordID, &u.Quantity, &u.RecordedAt); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// MarkUsageReported records that the usage of a subscription up to the record lastID
+// was pushed to the gateway
+func (m *DBWrapper) MarkUsageReported(orderID, lastID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `
+		update usage_records set reported_at = ?, updated_at = ?
+		where order_id = ? and id <= ? and reported_at is null`,
+		time.Now(), time.Now(), orderID, lastID)
+	return err
+}
+
+// GetPeriodUsage returns the usage of a subscription recorded from from until to, and
+// how much of it has not been pushed to the gateway yet
+func (m *DBWrapper) GetPeriodUsage(orderID int, from, to time.Time) (total, unreported int, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select
+			coalesce(sum(quantity), 0),
+			coalesce(sum(case when reported_at is null then quantity else 0 end), 0)
+		from usage_records
+		where order_id = ? and recorded_at >= ? and recorded_at < ?`
+
+	err = m.DB.QueryRowContext(ctx, query, orderID, from, to).Scan(&total, &unreported)
+	return total, unreported, err
+}
+
+// GetCustomerSubscriptions returns the subscriptions, cancelled or not, of the
+// customers with an email, the newest first
+func (m *DBWrapper) GetCustomerSubscriptions(email string) ([]Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select o.id, o.status_id, w.name
+		from orders o
+			join widgets w on (o.widget_id = w.id)
+			join customers c on (o.customer_id = c.id)
+		where c.email = ? and w.is_recurring = 1
+		order by o.id desc`
+
+	rows, err := m.DB.QueryContext(ctx, query, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []Order
+	for rows.Next() {
+		var o Order
+		if err := rows.Scan(&o.ID, &o.StatusID, &o.Widget.Name); err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"go-commerce/internal/dbtest"
+)
+
+func TestInsertUsageRecord(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	at := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	db.Expect("insert ignore into usage_records").WithArgs(7, 3, at, nil, dbtest.Any, dbtest.Any).Result(11, 1)
+
+	u, created, err := m.InsertUsageRecord(UsageRecord{OrderID: 7, Quantity: 3, RecordedAt: at})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || u.ID != 11 {
+		t.Errorf("got record %d, created %v", u.ID, created)
+	}
+}
+
+func TestInsertUsageRecordTwice(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	first := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	reported := first.Add(time.Hour)
+	db.Expect("insert ignore into usage_records").WithArgs(7, 3, dbtest.Any, "job-1", dbtest.Any, dbtest.Any).Result(0, 0)
+	db.Expect("where order_id = ? and idempotency_key = ?").WithArgs(7, "job-1").
+		Rows([]interface{}{11, 7, 3, first, "job-1", reported})
+
+	u, created, err := m.InsertUsageRecord(UsageRecord{OrderID: 7, Quantity: 3, RecordedAt: time.Now(), IdempotencyKey: "job-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created {
+		t.Error("a repeated record was created")
+	}
+	if u.ID != 11 || !u.RecordedAt.Equal(first) || u.ReportedAt == nil || !u.ReportedAt.Equal(reported) {
+		t.Errorf("got %+v, want the first record", u)
+	}
+}
+
+func TestGetUnreportedUsage(t *testing.T) {
+	db := dbtest.New(t)
+	m := DBWrapper{DB: db.SQL}
+
+	at := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	db.Expect("where u.reported_at is null order by u.order_id, u.id").
+		Rows([]interface{}{7, "sub_7", 12, 5, at}, []interface{}{7, "sub_7", 13, 1, at.Add(time.Minute)})
+
+	usage, err := m.GetUnreportedUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []UnreportedUsage{{7, "sub_7", 12, 5, at}, {7, "sub_7", 13, 1, at.Add(time.Minute)}}
+	if len(usage) != 2 || usage[0] != want[0] || usage[1] != want[1] {
+		t.Errorf("got %+v, want every record on its own: %+v", usage, want)
+	}
+}
@@ -0,0 +1,100 @@
+package money
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownCurrency is returned for codes that are not in the ISO 4217 table
+var ErrUnknownCurrency = errors.New("unknown currency")
+
+// Currency is an ISO 4217 currency. Amounts are counted in minor units, of which
+// there are 10^Exponent in a major unit: 100 cents in a dollar, 1 yen in a yen and
+// 1000 fils in a dinar.
+type Currency struct {
+	Code     string
+	Exponent int
+	Symbol   string
+}
+
+// currencies are the ISO 4217 currencies the shop can price and report in, keyed by
+// lower case code as stored on transactions. Symbols fall back to the code.
+var currencies = map[string]Currency{
+	"aed": {"AED", 2, "AED"},
+	"ars": {"ARS", 2, "$"},
+	"aud": {"AUD", 2, "A$"},
+	"bgn": {"BGN", 2, "лв"},
+	"bhd": {"BHD", 3, "BHD"},
+	"brl": {"BRL", 2, "R$"},
+	"cad": {"CAD", 2, "CA$"},
+	"chf": {"CHF", 2, "CHF"},
+	"clp": {"CLP", 0, "$"},
+	"cny": {"CNY", 2, "¥"},
+	"cop": {"COP", 2, "$"},
+	"czk": {"CZK", 2, "Kč"},
+	"dkk": {"DKK", 2, "kr"},
+	"egp": {"EGP", 2, "E£"},
+	"eur": {"EUR", 2, "€"},
+	"gbp": {"GBP", 2, "£"},
+	"hkd": {"HKD", 2, "HK$"},
+	"huf": {"HUF", 2, "Ft"},
+	"idr": {"IDR", 2, "Rp"},
+	"ils": {"ILS", 2, "₪"},
+	"inr": {"INR", 2, "₹"},
+	"iqd": {"IQD", 3, "IQD"},
+	"isk": {"ISK", 0, "kr"},
+	"jod": {"JOD", 3, "JOD"},
+	"jpy": {"JPY", 0, "¥"},
+	"krw": {"KRW", 0, "₩"},
+	"kwd": {"KWD", 3, "KWD"},
+	"lyd": {"LYD", 3, "LYD"},
+	"mxn": {"MXN", 2, "MX$"},
+	"myr": {"MYR", 2, "RM"},
+	"ngn": {"NGN", 2, "₦"},
+	"nok": {"NOK", 2, "kr"},
+	"nzd": {"NZD", 2, "NZ$"},
+	"omr": {"OMR", 3, "OMR"},
+	"php": {"PHP", 2, "₱"},
+	"pln": {"PLN", 2, "zł"},
+	"ron": {"RON", 2, "lei"},
+	"sar": {"SAR", 2, "SAR"},
+	"sek": {"SEK", 2, "kr"},
+	"sgd": {"SGD", 2, "S$"},
+	"thb": {"THB", 2, "฿"},
+	"tnd": {"TND", 3, "TND"},
+	"try": {"TRY", 2, "₺"},
+	"twd": {"TWD", 2, "NT$"},
+	"uah": {"UAH", 2, "₴"},
+	"ugx": {"UGX", 0, "USh"},
+	"usd": {"USD", 2, "$"},
+	"vnd": {"VND", 0, "₫"},
+	"xaf": {"XAF", 0, "FCFA"},
+	"xof": {"XOF", 0, "CFA"},
+	"zar": {"ZAR", 2, "R"},
+}
+
+// Lookup returns the currency with the given code, in any case
+func Lookup(code string) (Currency, error) {
+	c, ok := currencies[strings.ToLower(code)]
+	if !ok {
+		return Currency{}, ErrUnknownCurrency
+	}
+	return c, nil
+}
+
+// Known reports whether code is a supported ISO 4217 code
+func Known(code string) bool {
+	_, ok := currencies[strings.ToLower(code)]
+	return ok
+}
+
+// Codes returns the lower case codes of every supported currency, sorted
+func Codes() []string {
+	codes := make([]string, 0, len(currencies))
+	for code := range currencies {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
@@ -0,0 +1,131 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNoRate is returned when no exchange rate is known for a currency on a day
+var ErrNoRate = errors.New("no exchange rate")
+
+// Rate is an exchange rate: the number of major units of the target currency that
+// one major unit of the source currency buys. Rates are exact decimals.
+type Rate struct {
+	r *big.Rat
+}
+
+// ParseRate parses a positive decimal exchange rate such as "1.0842"
+func ParseRate(s string) (Rate, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok || r.Sign() <= 0 {
+		return Rate{}, fmt.Errorf("invalid exchange rate %q", s)
+	}
+	return Rate{r: r}, nil
+}
+
+// String returns the rate as a decimal with up to 8 decimals
+func (r Rate) String() string {
+	if r.r == nil {
+		return "0"
+	}
+	return strings.TrimRight(strings.TrimRight(r.r.FloatString(8), "0"), ".")
+}
+
+// Convert converts a into currency to at rate, rounding half away from zero to the
+// minor unit of to
+func Convert(a Amount, to string, rate Rate) (Amount, error) {
+	from, err := Lookup(a.Currency)
+	if err != nil {
+		return Amount{}, err
+	}
+	target, err := Lookup(to)
+	if err != nil {
+		return Amount{}, err
+	}
+	if rate.r == nil {
+		return Amount{}, ErrNoRate
+	}
+
+	// minor * rate * 10^(target exponent - source exponent)
+	v := new(big.Rat).SetInt64(a.Minor)
+	v.Mul(v, rate.r)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(target.Exponent-from.Exponent))), nil))
+	if target.Exponent >= from.Exponent {
+		v.Mul(v, scale)
+	} else {
+		v.Quo(v, scale)
+	}
+
+	return New(roundHalfAway(v), to), nil
+}
+
+// RateTable holds the exchange rates into one base currency over time
+type RateTable struct {
+	Base  string
+	rates map[string][]datedRate
+}
+
+type datedRate struct {
+	on   time.Time
+	rate Rate
+}
+
+// NewRateTable returns an empty table of rates into base
+func NewRateTable(base string) *RateTable {
+	return &RateTable{Base: strings.ToLower(base), rates: make(map[string][]datedRate)}
+}
+
+// Add records that from 'on' onwards one unit of currency buys rate units of the base currency
+func (t *RateTable) Add(currency string, on time.Time, rate Rate) {
+	currency = strings.ToLower(currency)
+	rates := append(t.rates[currency], datedRate{on: on, rate: rate})
+	sort.Slice(rates, func(i, j int) bool { return rates[i].on.Before(rates[j].on) })
+	t.rates[currency] = rates
+}
+
+// Rate returns the rate from currency into the base currency in effect on day
+func (t *RateTable) Rate(currency string, day time.Time) (Rate, error) {
+	currency = strings.ToLower(currency)
+	if currency == t.Base {
+		return Rate{r: big.NewRat(1, 1)}, nil
+	}
+
+	rates := t.rates[currency]
+	i := sort.Search(len(rates), func(i int) bool { return rates[i].on.After(day) })
+	if i == 0 {
+		return Rate{}, fmt.Errorf("%w from %s to %s on %s", ErrNoRate, strings.ToUpper(currency), strings.ToUpper(t.Base), day.Format("2006-01-02"))
+	}
+	return rates[i-1].rate, nil
+}
+
+// Convert converts a into the base currency with the rate in effect on day
+func (t *RateTable) Convert(a Amount, day time.Time) (Amount, error) {
+	rate, err := t.Rate(a.Currency, day)
+	if err != nil {
+		return Amount{}, err
+	}
+	return Convert(a, t.Base, rate)
+}
+
+func roundHalfAway(v *big.Rat) int64 {
+	num := new(big.Int).Abs(v.Num())
+	q, r := new(big.Int).QuoRem(num, v.Denom(), new(big.Int))
+	if r.Mul(r, big.NewInt(2)).Cmp(v.Denom()) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if v.Sign() < 0 {
+		q.Neg(q)
+	}
+	return q.Int64()
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,125 @@
+package money
+
+import "strings"
+
+// DefaultLocale is used for unknown locales
+const DefaultLocale = "en-US"
+
+// Locale describes how a locale writes amounts of money
+type Locale struct {
+	Group       string // thousands separator
+	Decimal     string
+	SymbolFirst bool
+	Space       bool // between the symbol and the number
+}
+
+// locales are keyed by BCP 47 tag
+var locales = map[string]Locale{
+	"en-US": {Group: ",", Decimal: ".", SymbolFirst: true},
+	"en-GB": {Group: ",", Decimal: ".", SymbolFirst: true},
+	"en-CA": {Group: ",", Decimal: ".", SymbolFirst: true},
+	"en-AU": {Group: ",", Decimal: ".", SymbolFirst: true},
+	"ja-JP": {Group: ",", Decimal: ".", SymbolFirst: true},
+	"zh-CN": {Group: ",", Decimal: ".", SymbolFirst: true},
+	"de-DE": {Group: ".", Decimal: ",", Space: true},
+	"es-ES": {Group: ".", Decimal: ",", Space: true},
+	"it-IT": {Group: ".", Decimal: ",", Space: true},
+	"nl-NL": {Group: ".", Decimal: ",", SymbolFirst: true, Space: true},
+	"pt-BR": {Group: ".", Decimal: ",", SymbolFirst: true, Space: true},
+	"fr-FR": {Group: " ", Decimal: ",", Space: true},
+	"sv-SE": {Group: " ", Decimal: ",", Space: true},
+	"de-CH": {Group: "’", Decimal: ".", SymbolFirst: true, Space: true},
+}
+
+// languages map a bare language to the locale used for it
+var languages = map[string]string{
+	"en": "en-US",
+	"ja": "ja-JP",
+	"zh": "zh-CN",
+	"de": "de-DE",
+	"es": "es-ES",
+	"it": "it-IT",
+	"nl": "nl-NL",
+	"pt": "pt-BR",
+	"fr": "fr-FR",
+	"sv": "sv-SE",
+}
+
+// LookupLocale returns the locale for a BCP 47 tag such as "de-DE", falling back to
+// the language alone and then to DefaultLocale
+func LookupLocale(tag string) Locale {
+	tag = strings.Replace(tag, "_", "-", 1)
+	if l, ok := locales[tag]; ok {
+		return l
+	}
+	if t, ok := languages[strings.ToLower(strings.SplitN(tag, "-", 2)[0])]; ok {
+		return locales[t]
+	}
+	return locales[DefaultLocale]
+}
+
+// Format formats the amount with the currency symbol the way locale writes it, like
+// "$1,234.50" for en-US or "1.234,50 €" for de-DE
+func (a Amount) Format(locale string) string {
+	return a.format(LookupLocale(locale), a.symbol())
+}
+
+// FormatCode formats the amount with the ISO code instead of the symbol, like "USD 1,234.50".
+// Use it where the symbol may be ambiguous or cannot be rendered, such as in PDF core fonts.
+func (a Amount) FormatCode(locale string) string {
+	l := LookupLocale(locale)
+	l.Space = true
+	return a.format(l, strings.ToUpper(a.Currency))
+}
+
+func (a Amount) format(l Locale, symbol string) string {
+	number := a.Major()
+	sign := ""
+	if strings.HasPrefix(number, "-") {
+		sign = "-"
+		number = number[1:]
+	}
+
+	whole, frac := number, ""
+	if i := strings.IndexByte(number, '.'); i >= 0 {
+		whole, frac = number[:i], number[i+1:]
+	}
+
+	var b strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(l.Group)
+		}
+		b.WriteRune(r)
+	}
+	if frac != "" {
+		b.WriteString(l.Decimal)
+		b.WriteString(frac)
+	}
+
+	// letter symbols such as CHF or KWD are always set apart from the number
+	space := ""
+	if l.Space && symbol != "" || isLetters(symbol) {
+		space = " "
+	}
+	if l.SymbolFirst {
+		return sign + symbol + space + b.String()
+	}
+	return sign + b.String() + space + symbol
+}
+
+func (a Amount) symbol() string {
+	if c, err := Lookup(a.Currency); err == nil {
+		return c.Symbol
+	}
+	return strings.ToUpper(a.Currency)
+}
+
+func isLetters(s string) bool {
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return s != ""
+}
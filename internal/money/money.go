@@ -0,0 +1,104 @@
+// Package money handles amounts of money in ISO 4217 currencies. Amounts are held
+// as integer minor units, the way they are stored in the database and sent to the
+// payment gateway, and are only turned into decimals for display.
+package money
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidAmount is returned by Parse for text that is not a decimal amount in the currency
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// Amount is an amount of money in minor units of Currency, a lower case ISO 4217 code
+type Amount struct {
+	Minor    int64
+	Currency string
+}
+
+// New returns an amount of minor units of currency
+func New(minor int64, currency string) Amount {
+	return Amount{Minor: minor, Currency: strings.ToLower(currency)}
+}
+
+// Parse parses a decimal amount in major units, like "12.50", into an Amount. It
+// fails if the text has more decimals than the currency has minor units.
+func Parse(s, currency string) (Amount, error) {
+	c, err := Lookup(currency)
+	if err != nil {
+		return Amount{}, err
+	}
+
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if whole == "" && frac == "" || len(frac) > c.Exponent || !isDigits(whole) || !isDigits(frac) {
+		return Amount{}, ErrInvalidAmount
+	}
+	frac += strings.Repeat("0", c.Exponent-len(frac))
+
+	minor, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return Amount{}, ErrInvalidAmount
+	}
+	if negative {
+		minor = -minor
+	}
+	return New(minor, currency), nil
+}
+
+// Exponent returns the number of decimals of the amount's currency, or 2 if the currency is unknown
+func (a Amount) Exponent() int {
+	if c, err := Lookup(a.Currency); err == nil {
+		return c.Exponent
+	}
+	return 2
+}
+
+// Major returns the amount in major units as a plain decimal, like "-1234.50"
+func (a Amount) Major() string {
+	exp := a.Exponent()
+	minor := a.Minor
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+
+	digits := strconv.FormatInt(minor, 10)
+	if exp == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
+
+// Float64 returns the amount in major units. It is meant for charts and spreadsheets;
+// use the integer minor units for arithmetic.
+func (a Amount) Float64() float64 {
+	return float64(a.Minor) / math.Pow10(a.Exponent())
+}
+
+// String formats the amount for the default locale, like "$1,234.50"
+func (a Amount) String() string {
+	return a.Format(DefaultLocale)
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,184 @@
+package money
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text     string
+		currency string
+		want     int64
+		err      error
+	}{
+		{"12.50", "usd", 1250, nil},
+		{"12.5", "USD", 1250, nil},
+		{"12", "eur", 1200, nil},
+		{".5", "eur", 50, nil},
+		{"-3.01", "gbp", -301, nil},
+		{"1500", "jpy", 1500, nil},
+		{"1.234", "kwd", 1234, nil},
+		{"1.5", "jpy", 0, ErrInvalidAmount},
+		{"12.345", "usd", 0, ErrInvalidAmount},
+		{"12,50", "eur", 0, ErrInvalidAmount},
+		{"", "usd", 0, ErrInvalidAmount},
+		{"1", "xyz", 0, ErrUnknownCurrency},
+	}
+	for _, tt := range tests {
+		a, err := Parse(tt.text, tt.currency)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Parse(%q, %s): got error %v, want %v", tt.text, tt.currency, err, tt.err)
+			continue
+		}
+		if err == nil && a.Minor != tt.want {
+			t.Errorf("Parse(%q, %s): got %d, want %d", tt.text, tt.currency, a.Minor, tt.want)
+		}
+	}
+}
+
+func TestMajor(t *testing.T) {
+	tests := []struct {
+		amount Amount
+		want   string
+	}{
+		{New(123450, "USD"), "1234.50"},
+		{New(5, "usd"), "0.05"},
+		{New(-5, "usd"), "-0.05"},
+		{New(1500, "jpy"), "1500"},
+		{New(1, "bhd"), "0.001"},
+		{New(1234, "xyz"), "12.34"},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.Major(); got != tt.want {
+			t.Errorf("%d %s: got %s, want %s", tt.amount.Minor, tt.amount.Currency, got, tt.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		amount Amount
+		locale string
+		want   string
+	}{
+		{New(123450, "usd"), "en-US", "$1,234.50"},
+		{New(-123450, "usd"), "en-US", "-$1,234.50"},
+		{New(123450, "eur"), "de-DE", "1.234,50\u00a0€"},
+		{New(123450, "eur"), "de", "1.234,50\u00a0€"},
+		{New(123450, "eur"), "fr_FR", "1\u202f234,50\u00a0€"},
+		{New(1234567, "jpy"), "ja-JP", "¥1,234,567"},
+		{New(1234, "chf"), "en-US", "CHF\u00a012.34"},
+		{New(1234, "usd"), "xx-YY", "$12.34"},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.Format(tt.locale); got != tt.want {
+			t.Errorf("%d %s in %s: got %q, want %q", tt.amount.Minor, tt.amount.Currency, tt.locale, got, tt.want)
+		}
+	}
+
+	if got := New(123450, "eur").FormatCode("de-DE"); got != "1.234,50\u00a0EUR" {
+		t.Errorf("FormatCode: got %q", got)
+	}
+	if got := New(123450, "usd").FormatCode("en-US"); got != "USD\u00a01,234.50" {
+		t.Errorf("FormatCode: got %q", got)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	rate, err := ParseRate("1.0842")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate.String() != "1.0842" {
+		t.Errorf("rate formats as %s", rate)
+	}
+
+	tests := []struct {
+		amount Amount
+		to     string
+		want   int64
+	}{
+		{New(10000, "eur"), "usd", 10842},
+		{New(-10000, "eur"), "usd", -10842},
+		{New(5, "eur"), "usd", 5},
+		{New(10000, "eur"), "jpy", 108},
+		{New(10000, "eur"), "kwd", 108420},
+	}
+	for _, tt := range tests {
+		got, err := Convert(tt.amount, tt.to, rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Minor != tt.want || got.Currency != tt.to {
+			t.Errorf("%v to %s: got %v, want %d", tt.amount, tt.to, got, tt.want)
+		}
+	}
+
+	half, _ := ParseRate("0.5")
+	if got, _ := Convert(New(-5, "usd"), "eur", half); got.Minor != -3 {
+		t.Errorf("-0.025 rounds to %d, want -3", got.Minor)
+	}
+	if _, err := Convert(New(1, "usd"), "eur", Rate{}); !errors.Is(err, ErrNoRate) {
+		t.Errorf("conversion without a rate: got %v", err)
+	}
+
+	for _, s := range []string{"0", "-1", "abc"} {
+		if _, err := ParseRate(s); err == nil {
+			t.Errorf("ParseRate(%q) accepted", s)
+		}
+	}
+}
+
+func TestRateTable(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 0, 0, 0, 0, time.UTC) }
+	first, _ := ParseRate("1.1")
+	second, _ := ParseRate("1.2")
+
+	table := NewRateTable("USD")
+	table.Add("EUR", day(10), second)
+	table.Add("eur", day(1), first)
+
+	tests := []struct {
+		currency string
+		on       time.Time
+		want     int64
+		err      error
+	}{
+		{"usd", day(5), 1000, nil},
+		{"eur", day(5), 1100, nil},
+		{"eur", day(10), 1200, nil},
+		{"eur", day(20), 1200, nil},
+		{"eur", time.Date(2026, 9, 30, 0, 0, 0, 0, time.UTC), 0, ErrNoRate},
+		{"gbp", day(5), 0, ErrNoRate},
+	}
+	for _, tt := range tests {
+		got, err := table.Convert(New(1000, tt.currency), tt.on)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s on %s: got error %v, want %v", tt.currency, tt.on.Format("2006-01-02"), err, tt.err)
+			continue
+		}
+		if err == nil && (got.Minor != tt.want || got.Currency != "usd") {
+			t.Errorf("%s on %s: got %v, want %d usd", tt.currency, tt.on.Format("2006-01-02"), got, tt.want)
+		}
+	}
+}
+
+func TestCurrencies(t *testing.T) {
+	if !Known("EUR") || Known("xyz") {
+		t.Error("Known does not match the currency table")
+	}
+	codes := Codes()
+	for i := 1; i < len(codes); i++ {
+		if codes[i-1] >= codes[i] {
+			t.Fatalf("codes are not sorted: %s before %s", codes[i-1], codes[i])
+		}
+	}
+	for code, c := range currencies {
+		if strings.ToLower(c.Code) != code {
+			t.Errorf("currency %s has code %q", code, c.Code)
+		}
+	}
+}
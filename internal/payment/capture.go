@@ -0,0 +1,43 @@
+package payment
+
+import (
+	"time"
+
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/paymentintent"
+)
+
+// AuthorizationWindow is how long a card authorization can be captured for; Stripe
+// cancels the payment intent once it has passed
+const AuthorizationWindow = 7 * 24 * time.Hour
+
+// Authorized reports whether a payment intent holds an authorization waiting to be
+// captured
+func Authorized(pi *stripe.PaymentIntent) bool {
+	return pi.Status == stripe.PaymentIntentStatusRequiresCapture
+}
+
+// CaptureBefore returns when the authorization of a payment intent expires
+func CaptureBefore(pi *stripe.PaymentIntent) time.Time {
+	return time.Unix(pi.Created, 0).Add(AuthorizationWindow)
+}
+
+// Capture captures amount of an authorized payment intent, releasing the rest of the
+// authorization. An amount of zero captures all of it.
+func (c *Config) Capture(paymentIntent string, amount int) (*stripe.PaymentIntent, error) {
+	stripe.Key = c.Secret
+
+	params := &stripe.PaymentIntentCaptureParams{}
+	if amount > 0 {
+		params.AmountToCapture = stripe.Int64(int64(amount))
+	}
+
+	return paymentintent.Capture(paymentIntent, params)
+}
+
+// Void cancels an authorized payment intent, releasing the whole authorization
+func (c *Config) Void(paymentIntent string) (*stripe.PaymentIntent, error) {
+	stripe.Key = c.Secret
+
+	return paymentintent.Cancel(paymentIntent, nil)
+}
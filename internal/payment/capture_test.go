@@ -0,0 +1,25 @@
+package payment
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v72"
+)
+
+func TestAuthorized(t *testing.T) {
+	if !Authorized(&stripe.PaymentIntent{Status: stripe.PaymentIntentStatusRequiresCapture}) {
+		t.Error("a payment waiting to be captured is not authorized")
+	}
+	if Authorized(&stripe.PaymentIntent{Status: stripe.PaymentIntentStatusSucceeded}) {
+		t.Error("a captured payment is authorized")
+	}
+}
+
+func TestCaptureBefore(t *testing.T) {
+	created := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	got := CaptureBefore(&stripe.PaymentIntent{Created: created.Unix()})
+	if want := created.AddDate(0, 0, 7); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
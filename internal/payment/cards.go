@@ -0,0 +1,79 @@
+package payment
+
+import (
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/customer"
+	"github.com/stripe/stripe-go/v72/paymentintent"
+	"github.com/stripe/stripe-go/v72/paymentmethod"
+	"github.com/stripe/stripe-go/v72/setupintent"
+)
+
+// NewCustomer creates a customer to save cards with
+func (c *Config) NewCustomer(name, email string) (*stripe.Customer, error) {
+	stripe.Key = c.Secret
+
+	params := &stripe.CustomerParams{
+		Name:  stripe.String(name),
+		Email: stripe.String(email),
+	}
+
+	return customer.New(params)
+}
+
+// CreateSetupIntent starts collecting a card of customer to charge off-session later.
+// The card is confirmed in the browser with the client secret of the setup intent.
+func (c *Config) CreateSetupIntent(customerID string) (*stripe.SetupIntent, error) {
+	stripe.Key = c.Secret
+
+	params := &stripe.SetupIntentParams{
+		Customer:           stripe.String(customerID),
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+		Usage:              stripe.String(string(stripe.SetupIntentUsageOffSession)),
+	}
+
+	return setupintent.New(params)
+}
+
+// GetSetupIntent gets a setup intent by id, with its payment method
+func (c *Config) GetSetupIntent(id string) (*stripe.SetupIntent, error) {
+	stripe.Key = c.Secret
+
+	params := &stripe.SetupIntentParams{}
+	params.AddExpand("payment_method")
+
+	return setupintent.Get(id, params)
+}
+
+// ChargeOffSession charges amount to a saved card of customer while the customer is not
+// present. A card that needs the customer to authenticate fails with a card error.
+func (c *Config) ChargeOffSession(customerID, paymentMethodID string, amount int) (*stripe.PaymentIntent, string, error) {
+	stripe.Key = c.Secret
+
+	params := &stripe.PaymentIntentParams{
+		Amount:        stripe.Int64(int64(amount)),
+		Currency:      stripe.String(c.Currency),
+		Customer:      stripe.String(customerID),
+		PaymentMethod: stripe.String(paymentMethodID),
+		OffSession:    stripe.Bool(true),
+		Confirm:       stripe.Bool(true),
+	}
+	params.AddExpand("payment_method")
+
+	pi, err := paymentintent.New(params)
+	if err != nil {
+		msg := ""
+		if stripeErr, ok := err.(*stripe.Error); ok {
+			msg = stripeCardErrorMessage(stripeErr.Code)
+		}
+		return nil, msg, err
+	}
+	return pi, "", nil
+}
+
+// DetachPaymentMethod removes a saved card from its customer
+func (c *Config) DetachPaymentMethod(id string) error {
+	stripe.Key = c.Secret
+
+	_, err := paymentmethod.Detach(id, nil)
+	return err
+}
@@ -0,0 +1,89 @@
+package payment
+
+import (
+	"io"
+
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/dispute"
+	"github.com/stripe/stripe-go/v72/file"
+	"github.com/stripe/stripe-go/v72/webhook"
+)
+
+// Evidence file purposes, the fields of the dispute evidence a file can be sent as
+const (
+	EvidenceReceipt               = "receipt"
+	EvidenceShippingDocumentation = "shipping_documentation"
+	EvidenceCustomerCommunication = "customer_communication"
+	EvidenceUncategorizedFile     = "uncategorized_file"
+)
+
+// DisputeEvidence is the evidence sent to the card issuer to challenge a dispute. Files
+// maps evidence file purposes to the IDs of files uploaded with UploadDisputeFile.
+type DisputeEvidence struct {
+	CustomerName           string
+	CustomerEmailAddress   string
+	ProductDescription     string
+	ShippingCarrier        string
+	ShippingTrackingNumber string
+	UncategorizedText      string
+	Files                  map[string]string
+}
+
+// ReadEvent checks the Stripe-Signature header of a webhook request against the
+// endpoint secret and returns the event in payload
+func (c *Config) ReadEvent(payload []byte, signature, endpointSecret string) (stripe.Event, error) {
+	return webhook.ConstructEvent(payload, signature, endpointSecret)
+}
+
+// GetDispute gets a dispute by id
+func (c *Config) GetDispute(id string) (*stripe.Dispute, error) {
+	stripe.Key = c.Secret
+
+	return dispute.Get(id, nil)
+}
+
+// UploadDisputeFile uploads a file to send as dispute evidence and returns it
+func (c *Config) UploadDisputeFile(filename string, content io.Reader) (*stripe.File, error) {
+	stripe.Key = c.Secret
+
+	params := &stripe.FileParams{
+		Purpose:    stripe.String(string(stripe.FilePurposeDisputeEvidence)),
+		FileReader: content,
+		Filename:   stripe.String(filename),
+	}
+
+	return file.New(params)
+}
+
+// SubmitDisputeEvidence sends evidence for a dispute to the card issuer. Evidence can
+// only be submitted once, so fields left empty are not sent.
+func (c *Config) SubmitDisputeEvidence(id string, e DisputeEvidence) (*stripe.Dispute, error) {
+	stripe.Key = c.Secret
+
+	optional := func(s string) *string {
+		if s == "" {
+			return nil
+		}
+		return stripe.String(s)
+	}
+
+	evidence := &stripe.DisputeEvidenceParams{
+		CustomerName:           optional(e.CustomerName),
+		CustomerEmailAddress:   optional(e.CustomerEmailAddress),
+		ProductDescription:     optional(e.ProductDescription),
+		ShippingCarrier:        optional(e.ShippingCarrier),
+		ShippingTrackingNumber: optional(e.ShippingTrackingNumber),
+		UncategorizedText:      optional(e.UncategorizedText),
+		Receipt:                optional(e.Files[EvidenceReceipt]),
+		ShippingDocumentation:  optional(e.Files[EvidenceShippingDocumentation]),
+		CustomerCommunication:  optional(e.Files[EvidenceCustomerCommunication]),
+		UncategorizedFile:      optional(e.Files[EvidenceUncategorizedFile]),
+	}
+
+	params := &stripe.DisputeParams{
+		Evidence: evidence,
+		Submit:   stripe.Bool(true),
+	}
+
+	return dispute.Update(id, params)
+}
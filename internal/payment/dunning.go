@@ -0,0 +1,65 @@
+package payment
+
+import (
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/customer"
+	"github.com/stripe/stripe-go/v72/invoice"
+	"github.com/stripe/stripe-go/v72/sub"
+)
+
+// IsRenewal reports whether an invoice bills a subscription after its first period
+func IsRenewal(inv *stripe.Invoice) bool {
+	return inv.Subscription != nil && inv.BillingReason != stripe.InvoiceBillingReasonSubscriptionCreate
+}
+
+// GetSubscription gets a subscription by id, with its customer
+func (c *Config) GetSubscription(id string) (*stripe.Subscription, error) {
+	stripe.Key = c.Secret
+
+	return sub.Get(id, nil)
+}
+
+// RetryInvoice tries again to charge an unpaid invoice to the default card of its
+// customer. A declined card returns an error and a message for the card holder.
+func (c *Config) RetryInvoice(id string) (*stripe.Invoice, string, error) {
+	stripe.Key = c.Secret
+
+	inv, err := invoice.Pay(id, &stripe.InvoicePayParams{OffSession: stripe.Bool(true)})
+	if err != nil {
+		msg := ""
+		if stripeErr, ok := err.(*stripe.Error); ok {
+			msg = stripeCardErrorMessage(stripeErr.Code)
+		}
+		return nil, msg, err
+	}
+	return inv, "", nil
+}
+
+// SetSubscriptionCard makes a card of customer the one a subscription and the future
+// invoices of the customer are charged to
+func (c *Config) SetSubscriptionCard(subscriptionID, customerID, paymentMethodID string) error {
+	stripe.Key = c.Secret
+
+	_, err := customer.Update(customerID, &stripe.CustomerParams{
+		InvoiceSettings: &stripe.CustomerInvoiceSettingsParams{
+			DefaultPaymentMethod: stripe.String(paymentMethodID),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = sub.Update(subscriptionID, &stripe.SubscriptionParams{
+		DefaultPaymentMethod: stripe.String(paymentMethodID),
+	})
+	return err
+}
+
+// CancelSubscriptionNow cancels a subscription immediately, rather than at the end of
+// its period like CancelSubscription
+func (c *Config) CancelSubscriptionNow(subscriptionID string) error {
+	stripe.Key = c.Secret
+
+	_, err := sub.Cancel(subscriptionID, nil)
+	return err
+}
@@ -0,0 +1,24 @@
+package payment
+
+import (
+	"testing"
+
+	"github.com/stripe/stripe-go/v72"
+)
+
+func TestIsRenewal(t *testing.T) {
+	sub := &stripe.Subscription{ID: "sub_1"}
+	tests := []struct {
+		inv  stripe.Invoice
+		want bool
+	}{
+		{stripe.Invoice{Subscription: sub, BillingReason: stripe.InvoiceBillingReasonSubscriptionCycle}, true},
+		{stripe.Invoice{Subscription: sub, BillingReason: stripe.InvoiceBillingReasonSubscriptionCreate}, false},
+		{stripe.Invoice{BillingReason: stripe.InvoiceBillingReasonManual}, false},
+	}
+	for _, tt := range tests {
+		if got := IsRenewal(&tt.inv); got != tt.want {
+			t.Errorf("%s: got %v", tt.inv.BillingReason, got)
+		}
+	}
+}
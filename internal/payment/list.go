@@ -0,0 +1,67 @@
+package payment
+
+import (
+	"time"
+
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/charge"
+	"github.com/stripe/stripe-go/v72/refund"
+	"github.com/stripe/stripe-go/v72/sub"
+)
+
+func createdRange(from, to time.Time) *stripe.RangeQueryParams {
+	return &stripe.RangeQueryParams{
+		GreaterThanOrEqual: from.Unix(),
+		LesserThan:         to.Unix(),
+	}
+}
+
+// ListCharges pages through the charges created from from until to, the newest first
+func (c *Config) ListCharges(from, to time.Time) ([]*stripe.Charge, error) {
+	stripe.Key = c.Secret
+
+	params := &stripe.ChargeListParams{CreatedRange: createdRange(from, to)}
+	params.AddExpand("data.invoice")
+
+	var charges []*stripe.Charge
+	i := charge.List(params)
+	for i.Next() {
+		charges = append(charges, i.Charge())
+	}
+	return charges, i.Err()
+}
+
+// ListRefunds pages through the refunds made from from until to, with their charges,
+// the newest first
+func (c *Config) ListRefunds(from, to time.Time) ([]*stripe.Refund, error) {
+	stripe.Key = c.Secret
+
+	params := &stripe.RefundListParams{CreatedRange: createdRange(from, to)}
+	params.AddExpand("data.charge")
+
+	var refunds []*stripe.Refund
+	i := refund.List(params)
+	for i.Next() {
+		refunds = append(refunds, i.Refund())
+	}
+	return refunds, i.Err()
+}
+
+// ListSubscriptions pages through the subscriptions, cancelled or not, created from from
+// until to, with their customers, the newest first
+func (c *Config) ListSubscriptions(from, to time.Time) ([]*stripe.Subscription, error) {
+	stripe.Key = c.Secret
+
+	params := &stripe.SubscriptionListParams{
+		CreatedRange: createdRange(from, to),
+		Status:       "all",
+	}
+	params.AddExpand("data.customer")
+
+	var subs []*stripe.Subscription
+	i := sub.List(params)
+	for i.Next() {
+		subs = append(subs, i.Subscription())
+	}
+	return subs, i.Err()
+}
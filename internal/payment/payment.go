@@ -4,17 +4,22 @@ import (
 	"fmt"
 
 	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/coupon"
 	"github.com/stripe/stripe-go/v72/customer"
 	"github.com/stripe/stripe-go/v72/paymentintent"
 	"github.com/stripe/stripe-go/v72/paymentmethod"
+	"github.com/stripe/stripe-go/v72/price"
 	"github.com/stripe/stripe-go/v72/refund"
 	"github.com/stripe/stripe-go/v72/sub"
 )
 
+// Config holds the gateway keys and the currency to charge in. A CaptureMethod of
+// "manual" only authorizes cards; the payment is captured or voided later.
 type Config struct {
-	Secret   string
-	Key      string
-	Currency string
+	Secret        string
+	Key           string
+	Currency      string
+	CaptureMethod string
 }
 
 type Transaction struct {
@@ -35,10 +40,20 @@ func (c *Config) createPaymentIntent(amount int) (*stripe.PaymentIntent, string,
 	stripe.Key = c.Secret
 	var msg string
 
-	// create payment intent
+	// create payment intent; the card is confirmed in the browser, which runs 3-D Secure
+	// when the issuer or the regulation asks for it
 	params := &stripe.PaymentIntentParams{
 		Amount: stripe.Int64(int64(amount)),
 		Currency: stripe.String(c.Currency),
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+		PaymentMethodOptions: &stripe.PaymentIntentPaymentMethodOptionsParams{
+			Card: &stripe.PaymentIntentPaymentMethodOptionsCardParams{
+				RequestThreeDSecure: stripe.String(string(stripe.PaymentIntentPaymentMethodOptionsCardRequestThreeDSecureAutomatic)),
+			},
+		},
+	}
+	if c.CaptureMethod != "" {
+		params.CaptureMethod = stripe.String(c.CaptureMethod)
 	}
 
 	pi, err := paymentintent.New(params)
@@ -77,11 +92,14 @@ func (c *Config) RetrievePaymentIntent(id string) (*stripe.PaymentIntent, error)
 func (c *Config) CreateCustomer(pm, email string) (*stripe.Customer, string, error) {
 	stripe.Key = c.Secret
 	customerParams := &stripe.CustomerParams{
-		PaymentMethod: stripe.String(pm),
 		Email: stripe.String(email),
-		InvoiceSettings: &stripe.CustomerInvoiceSettingsParams{
+	}
+	// customers starting a trial that collects no card are created without one
+	if pm != "" {
+		customerParams.PaymentMethod = stripe.String(pm)
+		customerParams.InvoiceSettings = &stripe.CustomerInvoiceSettingsParams{
 			DefaultPaymentMethod: stripe.String(pm),
-		},
+		}
 	}
 
 	customer, err := customer.New(customerParams)
@@ -96,14 +114,34 @@ func (c *Config) CreateCustomer(pm, email string) (*stripe.Customer, string, err
 	return customer, "", nil
 }
 
-func (c *Config) SubscribeToPlan(customer *stripe.Customer, plan, email, lastFour, cardType string) (*stripe.Subscription, error) {
-	items := []*stripe.SubscriptionItemsParams{
-		{Plan: stripe.String(plan)},
+// SubscribeToPlan subscribes customer to seats seats of plan, discounted by the gateway
+// coupon couponID unless it is empty. Metered plans are billed by usage and take 0 seats.
+// A plan with trialDays starts with a free trial, which needs no first payment. A first
+// invoice that needs the customer to authenticate leaves the subscription incomplete;
+// see FirstPayment.
+// GetPrice returns the gateway price of a plan
+func (c *Config) GetPrice(plan string) (*stripe.Price, error) {
+	stripe.Key = c.Secret
+	return price.Get(plan, nil)
+}
+
+func (c *Config) SubscribeToPlan(customer *stripe.Customer, plan string, seats, trialDays int, couponID, email, lastFour, cardType string) (*stripe.Subscription, error) {
+	item := &stripe.SubscriptionItemsParams{Plan: stripe.String(plan)}
+	if seats > 0 {
+		item.Quantity = stripe.Int64(int64(seats))
 	}
+	items := []*stripe.SubscriptionItemsParams{item}
 
 	params := &stripe.SubscriptionParams{
 		Customer: stripe.String(customer.ID),
 		Items: items,
+		PaymentBehavior: stripe.String(string(stripe.SubscriptionPaymentBehaviorAllowIncomplete)),
+	}
+	if couponID != "" {
+		params.Coupon = stripe.String(couponID)
+	}
+	if trialDays > 0 {
+		params.TrialPeriodDays = stripe.Int64(int64(trialDays))
 	}
 
 	params.AddMetadata("last_four", lastFour)
@@ -117,7 +155,33 @@ func (c *Config) SubscribeToPlan(customer *stripe.Customer, plan, email, lastFou
 	return subscription, nil
 }
 
-func (c *Config) Refund(paymentIntent string, amount int) error {
+// CreateCoupon creates a gateway coupon named name that takes percentOff percent, or
+// amountOff in the currency of the config, off a subscription. duration is "once",
+// "repeating" for months months, or "forever".
+func (c *Config) CreateCoupon(name string, percentOff, amountOff int, duration string, months int) (*stripe.Coupon, error) {
+	stripe.Key = c.Secret
+
+	params := &stripe.CouponParams{
+		Name:     stripe.String(name),
+		Duration: stripe.String(duration),
+	}
+	if percentOff > 0 {
+		params.PercentOff = stripe.Float64(float64(percentOff))
+	} else {
+		params.AmountOff = stripe.Int64(int64(amountOff))
+		params.Currency = stripe.String(c.Currency)
+	}
+	if duration == string(stripe.CouponDurationRepeating) {
+		params.DurationInMonths = stripe.Int64(int64(months))
+	}
+
+	return coupon.New(params)
+}
+
+// Refund refunds amount of the charge of a payment intent and returns the ID of the refund
+// Refund refunds amount of a payment intent and returns the ID of the refund. The gateway
+// refunds only once for an idempotencyKey, so a refund can be retried safely.
+func (c *Config) Refund(paymentIntent string, amount int, idempotencyKey string) (string, error) {
 	stripe.Key = c.Secret
 	amountToRefund := int64(amount)
 	
@@ -125,12 +189,13 @@ func (c *Config) Refund(paymentIntent string, amount int) error {
 		Amount: &amountToRefund,
 		PaymentIntent: &paymentIntent,
 	}
+	refundParams.SetIdempotencyKey(idempotencyKey)
 
-	_, err := refund.New(refundParams)
+	rf, err := refund.New(refundParams)
 	if err != nil {
-		return err
+		return "", err
 	}
-	return nil
+	return rf.ID, nil
 }
 
 func (c *Config) CancelSubscription(subscriptionID string) error {
@@ -168,6 +233,8 @@ func stripeCardErrorMessage(code stripe.ErrorCode) string {
 		msg = "Insufficient balance"
 	case stripe.ErrorCodePostalCodeInvalid:
 		msg = "Postal code is invalid"
+	case stripe.ErrorCodeAuthenticationRequired:
+		msg = "Your card needs you to authenticate the payment"
 	default:
 		msg = fmt.Sprintf("Your card was declined: %s", string(code))
 	}
@@ -0,0 +1,70 @@
+package payment
+
+import (
+	"time"
+
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/balancetransaction"
+	"github.com/stripe/stripe-go/v72/payout"
+)
+
+// GetPayout gets a payout by id
+func (c *Config) GetPayout(id string) (*stripe.Payout, error) {
+	stripe.Key = c.Secret
+
+	return payout.Get(id, nil)
+}
+
+// ListPayouts pages through the payouts created from from until to, the newest first
+func (c *Config) ListPayouts(from, to time.Time) ([]*stripe.Payout, error) {
+	stripe.Key = c.Secret
+
+	params := &stripe.PayoutListParams{CreatedRange: createdRange(from, to)}
+
+	var payouts []*stripe.Payout
+	i := payout.List(params)
+	for i.Next() {
+		payouts = append(payouts, i.Payout())
+	}
+	return payouts, i.Err()
+}
+
+// PayoutBalanceTransactions pages through the balance transactions paid out by an
+// automatic payout, with their sources, leaving out the payout itself
+func (c *Config) PayoutBalanceTransactions(payoutID string) ([]*stripe.BalanceTransaction, error) {
+	stripe.Key = c.Secret
+
+	params := &stripe.BalanceTransactionListParams{Payout: stripe.String(payoutID)}
+	params.AddExpand("data.source")
+
+	var txns []*stripe.BalanceTransaction
+	i := balancetransaction.List(params)
+	for i.Next() {
+		bt := i.BalanceTransaction()
+		if bt.Type == stripe.BalanceTransactionTypePayout {
+			continue
+		}
+		txns = append(txns, bt)
+	}
+	return txns, i.Err()
+}
+
+// SourceChargeID returns the ID of the charge a balance transaction moved money for:
+// the charge itself, or the charge that was refunded or disputed. It returns "" for
+// balance transactions that are not about a charge, like fees and adjustments. The
+// source must have been expanded.
+func SourceChargeID(bt *stripe.BalanceTransaction) string {
+	src := bt.Source
+	if src == nil {
+		return ""
+	}
+	switch {
+	case src.Charge != nil:
+		return src.Charge.ID
+	case src.Refund != nil && src.Refund.Charge != nil:
+		return src.Refund.Charge.ID
+	case src.Dispute != nil && src.Dispute.Charge != nil:
+		return src.Dispute.Charge.ID
+	}
+	return ""
+}
@@ -0,0 +1,27 @@
+package payment
+
+import (
+	"testing"
+
+	"github.com/stripe/stripe-go/v72"
+)
+
+func TestSourceChargeID(t *testing.T) {
+	charge := &stripe.Charge{ID: "ch_1"}
+	tests := []struct {
+		name string
+		src  *stripe.BalanceTransactionSource
+		want string
+	}{
+		{"no source", nil, ""},
+		{"charge", &stripe.BalanceTransactionSource{ID: "ch_1", Charge: charge}, "ch_1"},
+		{"refund", &stripe.BalanceTransactionSource{ID: "re_1", Refund: &stripe.Refund{Charge: charge}}, "ch_1"},
+		{"dispute", &stripe.BalanceTransactionSource{ID: "dp_1", Dispute: &stripe.Dispute{Charge: charge}}, "ch_1"},
+		{"fee", &stripe.BalanceTransactionSource{ID: "fee_1"}, ""},
+	}
+	for _, tt := range tests {
+		if got := SourceChargeID(&stripe.BalanceTransaction{Source: tt.src}); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/stripe/stripe-go/v72"
+)
+
+// Errors returned by CheckPaymentIntent for payment intents that cannot be recorded yet
+var (
+	ErrRequiresAction        = errors.New("the payment needs the card holder to authenticate it")
+	ErrRequiresConfirmation  = errors.New("the payment has not been confirmed")
+	ErrRequiresPaymentMethod = errors.New("the payment was declined, try another card")
+	ErrPaymentCanceled       = errors.New("the payment was canceled")
+)
+
+// CheckPaymentIntent returns nil if a payment can be recorded: it succeeded, it is
+// processing and will succeed or fail later, or it is authorized and waits to be
+// captured. Otherwise it returns why it cannot.
+func CheckPaymentIntent(pi *stripe.PaymentIntent) error {
+	switch pi.Status {
+	case stripe.PaymentIntentStatusSucceeded, stripe.PaymentIntentStatusProcessing,
+		stripe.PaymentIntentStatusRequiresCapture:
+		return nil
+	case stripe.PaymentIntentStatusRequiresAction:
+		return ErrRequiresAction
+	case stripe.PaymentIntentStatusRequiresConfirmation:
+		return ErrRequiresConfirmation
+	case stripe.PaymentIntentStatusRequiresPaymentMethod:
+		return ErrRequiresPaymentMethod
+	case stripe.PaymentIntentStatusCanceled:
+		return ErrPaymentCanceled
+	default:
+		return fmt.Errorf("the payment is %s", pi.Status)
+	}
+}
+
+// Succeeded reports whether the money of a payment intent has been taken
+func Succeeded(pi *stripe.PaymentIntent) bool {
+	return pi.Status == stripe.PaymentIntentStatusSucceeded
+}
+
+// ChargeID returns the ID of the latest charge of a payment intent, or "" when it has
+// none yet, like while it is processing
+func ChargeID(pi *stripe.PaymentIntent) string {
+	if pi.Charges == nil || len(pi.Charges.Data) == 0 {
+		return ""
+	}
+	return pi.Charges.Data[len(pi.Charges.Data)-1].ID
+}
+
+// FirstPayment returns the payment intent of the first invoice of a subscription, or nil
+// when the invoice had nothing to pay. The subscription must have been created or
+// retrieved with latest_invoice.payment_intent expanded.
+func FirstPayment(s *stripe.Subscription) *stripe.PaymentIntent {
+	if s.LatestInvoice == nil {
+		return nil
+	}
+	return s.LatestInvoice.PaymentIntent
+}
+
+// IsIncomplete reports whether err is one of the errors of CheckPaymentIntent, which
+// are safe to show the card holder
+func IsIncomplete(err error) bool {
+	return errors.Is(err, ErrRequiresAction) ||
+		errors.Is(err, ErrRequiresConfirmation) ||
+		errors.Is(err, ErrRequiresPaymentMethod) ||
+		errors.Is(err, ErrPaymentCanceled)
+}
@@ -0,0 +1,61 @@
+package payment
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stripe/stripe-go/v72"
+)
+
+func TestCheckPaymentIntent(t *testing.T) {
+	tests := []struct {
+		status stripe.PaymentIntentStatus
+		want   error
+	}{
+		{stripe.PaymentIntentStatusSucceeded, nil},
+		{stripe.PaymentIntentStatusProcessing, nil},
+		{stripe.PaymentIntentStatusRequiresCapture, nil},
+		{stripe.PaymentIntentStatusRequiresAction, ErrRequiresAction},
+		{stripe.PaymentIntentStatusRequiresConfirmation, ErrRequiresConfirmation},
+		{stripe.PaymentIntentStatusRequiresPaymentMethod, ErrRequiresPaymentMethod},
+		{stripe.PaymentIntentStatusCanceled, ErrPaymentCanceled},
+	}
+	for _, tt := range tests {
+		err := CheckPaymentIntent(&stripe.PaymentIntent{Status: tt.status})
+		if err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.status, err, tt.want)
+		}
+		if err != nil && !IsIncomplete(err) {
+			t.Errorf("%s: %v is not an incomplete payment", tt.status, err)
+		}
+	}
+
+	err := CheckPaymentIntent(&stripe.PaymentIntent{Status: "unknown"})
+	if err == nil || IsIncomplete(err) {
+		t.Errorf("unknown: got %v", err)
+	}
+	if IsIncomplete(errors.New("the payment is unknown")) {
+		t.Error("an unknown error is an incomplete payment")
+	}
+}
+
+func TestChargeID(t *testing.T) {
+	if id := ChargeID(&stripe.PaymentIntent{}); id != "" {
+		t.Errorf("a processing payment has charge %q", id)
+	}
+	pi := &stripe.PaymentIntent{Charges: &stripe.ChargeList{Data: []*stripe.Charge{{ID: "ch_declined"}, {ID: "ch_paid"}}}}
+	if id := ChargeID(pi); id != "ch_paid" {
+		t.Errorf("got %q, want the latest charge", id)
+	}
+}
+
+func TestFirstPayment(t *testing.T) {
+	if pi := FirstPayment(&stripe.Subscription{}); pi != nil {
+		t.Errorf("got %v for a subscription without an invoice", pi)
+	}
+	want := &stripe.PaymentIntent{ID: "pi_1"}
+	s := &stripe.Subscription{LatestInvoice: &stripe.Invoice{PaymentIntent: want}}
+	if pi := FirstPayment(s); pi != want {
+		t.Errorf("got %v", pi)
+	}
+}
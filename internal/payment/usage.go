@@ -0,0 +1,49 @@
+package payment
+
+import (
+	"errors"
+	"time"
+
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/usagerecord"
+)
+
+// ErrNotMetered is returned when usage is reported for a subscription without a
+// metered plan
+var ErrNotMetered = errors.New("subscription has no metered plan")
+
+// MeteredItem returns the item of a subscription that is billed by usage, or nil
+func MeteredItem(s *stripe.Subscription) *stripe.SubscriptionItem {
+	if s.Items == nil {
+		return nil
+	}
+	for _, item := range s.Items.Data {
+		if item.Plan != nil && item.Plan.UsageType == stripe.PlanUsageTypeMetered {
+			return item
+		}
+	}
+	return nil
+}
+
+// ReportUsage adds quantity to the usage of the metered plan of a subscription, as used
+// at at, which must fall in the current period of the subscription. The gateway adds it
+// only once for an idempotencyKey, so a report can be retried safely.
+func (c *Config) ReportUsage(subscriptionID string, quantity int, at time.Time, idempotencyKey string) (*stripe.UsageRecord, error) {
+	s, err := c.GetSubscription(subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	item := MeteredItem(s)
+	if item == nil {
+		return nil, ErrNotMetered
+	}
+
+	params := &stripe.UsageRecordParams{
+		SubscriptionItem: stripe.String(item.ID),
+		Action:           stripe.String(stripe.UsageRecordActionIncrement),
+		Quantity:         stripe.Int64(int64(quantity)),
+		Timestamp:        stripe.Int64(at.Unix()),
+	}
+	params.SetIdempotencyKey(idempotencyKey)
+	return usagerecord.New(params)
+}
@@ -0,0 +1,20 @@
+package payment
+
+import (
+	"testing"
+
+	"github.com/stripe/stripe-go/v72"
+)
+
+func TestMeteredItem(t *testing.T) {
+	if item := MeteredItem(&stripe.Subscription{}); item != nil {
+		t.Errorf("got %v for a subscription without items", item)
+	}
+
+	seats := &stripe.SubscriptionItem{ID: "si_seats", Plan: &stripe.Plan{UsageType: stripe.PlanUsageTypeLicensed}}
+	usage := &stripe.SubscriptionItem{ID: "si_usage", Plan: &stripe.Plan{UsageType: stripe.PlanUsageTypeMetered}}
+	s := &stripe.Subscription{Items: &stripe.SubscriptionItemList{Data: []*stripe.SubscriptionItem{seats, usage}}}
+	if item := MeteredItem(s); item != usage {
+		t.Errorf("got %v, want the metered item", item)
+	}
+}
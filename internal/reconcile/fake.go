@@ -0,0 +1,67 @@
+package reconcile
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// FakeGateway is a Gateway that holds its records in memory, to reconcile without
+// Stripe: in tests, or against records exported from the gateway
+type FakeGateway struct {
+	Charges       []Charge       `json:"charges"`
+	Refunds       []Refund       `json:"refunds"`
+	Subscriptions []Subscription `json:"subscriptions"`
+}
+
+// LoadFakeGateway reads the records of a fake gateway from a JSON file with the lists
+// "charges", "refunds" and "subscriptions"
+func LoadFakeGateway(path string) (*FakeGateway, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var g FakeGateway
+	if err := json.Unmarshal(b, &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func between(t, from, to time.Time) bool {
+	return !t.Before(from) && t.Before(to)
+}
+
+// ListCharges lists the charges created from from until to
+func (g *FakeGateway) ListCharges(from, to time.Time) ([]Charge, error) {
+	var charges []Charge
+	for _, c := range g.Charges {
+		if between(c.Created, from, to) {
+			charges = append(charges, c)
+		}
+	}
+	return charges, nil
+}
+
+// ListRefunds lists the refunds made from from until to
+func (g *FakeGateway) ListRefunds(from, to time.Time) ([]Refund, error) {
+	var refunds []Refund
+	for _, r := range g.Refunds {
+		if between(r.Created, from, to) {
+			refunds = append(refunds, r)
+		}
+	}
+	return refunds, nil
+}
+
+// ListSubscriptions lists the subscriptions created from from until to
+func (g *FakeGateway) ListSubscriptions(from, to time.Time) ([]Subscription, error) {
+	var subs []Subscription
+	for _, s := range g.Subscriptions {
+		if between(s.Created, from, to) {
+			subs = append(subs, s)
+		}
+	}
+	return subs, nil
+}
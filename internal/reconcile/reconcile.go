@@ -0,0 +1,553 @@
+// Package reconcile compares the payments recorded in the database with those of the
+// gateway. Orders are written by browser callbacks and webhooks, so the transactions
+// table drifts from the gateway whenever one of them is lost; a reconciliation reports
+// the payments the database is missing, those it records differently and those the
+// gateway does not know, and can repair the first two.
+package reconcile
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-commerce/internal/models"
+)
+
+// Kinds of findings
+const (
+	Missing    = "missing"    // at the gateway, not in the database
+	Mismatched = "mismatched" // in both, recorded differently
+	Orphaned   = "orphaned"   // in the database, not at the gateway
+)
+
+// Charge is a payment as the gateway recorded it. Amount is the amount captured, or
+// authorized while the charge is not captured. Invoiced charges pay subscription
+// invoices and are reconciled through their subscription.
+type Charge struct {
+	ID            string    `json:"id"`
+	PaymentIntent string    `json:"payment_intent"`
+	Amount        int       `json:"amount"`
+	Refunded      int       `json:"refunded"`
+	Currency      string    `json:"currency"`
+	Status        string    `json:"status"`
+	Captured      bool      `json:"captured"`
+	Invoiced      bool      `json:"invoiced"`
+	Email         string    `json:"email"`
+	Name          string    `json:"name"`
+	LastFour      string    `json:"last_four"`
+	Created       time.Time `json:"created"`
+}
+
+// Refund is a refund as the gateway recorded it. ChargeRefunded is how much of its
+// charge has been refunded in all.
+type Refund struct {
+	ID             string    `json:"id"`
+	PaymentIntent  string    `json:"payment_intent"`
+	Amount         int       `json:"amount"`
+	Status         string    `json:"status"`
+	ChargeRefunded int       `json:"charge_refunded"`
+	Created        time.Time `json:"created"`
+}
+
+// Subscription is a subscription as the gateway recorded it. Seats is 0 for metered plans.
+type Subscription struct {
+	ID                string    `json:"id"`
+	Status            string    `json:"status"`
+	CancelAtPeriodEnd bool      `json:"cancel_at_period_end"`
+	Plan              string    `json:"plan"`
+	Seats             int       `json:"seats"`
+	Amount            int       `json:"amount"`
+	Currency          string    `json:"currency"`
+	Email             string    `json:"email"`
+	Name              string    `json:"name"`
+	Created           time.Time `json:"created"`
+}
+
+// Gateway lists the records of a payment gateway created from from until to
+type Gateway interface {
+	ListCharges(from, to time.Time) ([]Charge, error)
+	ListRefunds(from, to time.Time) ([]Refund, error)
+	ListSubscriptions(from, to time.Time) ([]Subscription, error)
+}
+
+// Store is the database a reconciliation reads and repairs, like *models.DBWrapper
+type Store interface {
+	GetPaymentRecords(from, to time.Time) ([]models.PaymentRecord, error)
+	GetPaymentRecord(paymentIntent string) (models.PaymentRecord, error)
+	RepairPayment(transactionID, amount, txnStatus, orderStatus int) error
+	RepairSubscription(orderID, statusID, seats int) error
+	GetWidgetIDByPlan(plan string) (int, error)
+	InsertTransaction(txn models.Transaction) (int, error)
+	InsertOrder(order models.Order) (int, error)
+	InsertCustomer(customer models.Customer) (int, error)
+}
+
+// Finding is a difference between the database and the gateway. Object is "charge",
+// "refund" or "subscription".
+type Finding struct {
+	Kind          string `json:"kind"`
+	Object        string `json:"object"`
+	GatewayID     string `json:"gateway_id,omitempty"`
+	TransactionID int    `json:"transaction_id,omitempty"`
+	OrderID       int    `json:"order_id,omitempty"`
+	Detail        string `json:"detail"`
+	Repaired      bool   `json:"repaired"`
+	RepairError   string `json:"repair_error,omitempty"`
+}
+
+// Report is the outcome of a reconciliation: how many records of each side were
+// checked, and what differs
+type Report struct {
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	Charges       int       `json:"charges"`
+	Refunds       int       `json:"refunds"`
+	Subscriptions int       `json:"subscriptions"`
+	Transactions  int       `json:"transactions"`
+	Findings      []Finding `json:"findings"`
+}
+
+// Unresolved returns how many findings have not been repaired
+func (r Report) Unresolved() int {
+	n := 0
+	for _, f := range r.Findings {
+		if !f.Repaired {
+			n++
+		}
+	}
+	return n
+}
+
+// Reconciler reconciles the database with a gateway. Gateway records are listed Margin
+// either side of the range, so a payment recorded by the gateway and the database at
+// slightly different times is matched. With Repair, missing and mismatched records are
+// repaired from the gateway; orphaned records are only reported.
+type Reconciler struct {
+	DB      Store
+	Gateway Gateway
+	Repair  bool
+	Margin  time.Duration
+}
+
+// Run reconciles the payments made from from until to
+func (rc *Reconciler) Run(from, to time.Time) (Report, error) {
+	report := Report{From: from, To: to}
+
+	records, err := rc.DB.GetPaymentRecords(from, to)
+	if err != nil {
+		return report, err
+	}
+	charges, err := rc.Gateway.ListCharges(from.Add(-rc.Margin), to.Add(rc.Margin))
+	if err != nil {
+		return report, fmt.Errorf("listing charges: %w", err)
+	}
+	refunds, err := rc.Gateway.ListRefunds(from, to)
+	if err != nil {
+		return report, fmt.Errorf("listing refunds: %w", err)
+	}
+	subs, err := rc.Gateway.ListSubscriptions(from.Add(-rc.Margin), to.Add(rc.Margin))
+	if err != nil {
+		return report, fmt.Errorf("listing subscriptions: %w", err)
+	}
+	report.Transactions = len(records)
+	report.Refunds = len(refunds)
+
+	// a payment intent is charged again after a decline; its successful charge counts
+	payments := paymentCharges(charges)
+	checked := make(map[string]bool)
+	for _, c := range charges {
+		if p, ok := payments[c.PaymentIntent]; !ok || p.ID != c.ID || !between(c.Created, from, to) {
+			continue
+		}
+		report.Charges++
+		checked[c.PaymentIntent] = true
+		f, err := rc.checkCharge(c)
+		if err != nil {
+			return report, err
+		}
+		report.Findings = append(report.Findings, f...)
+	}
+
+	for _, r := range refunds {
+		if r.Status != "succeeded" || r.PaymentIntent == "" || checked[r.PaymentIntent] {
+			continue
+		}
+		checked[r.PaymentIntent] = true
+		f, err := rc.checkRefund(r)
+		if err != nil {
+			return report, err
+		}
+		report.Findings = append(report.Findings, f...)
+	}
+
+	gatewaySubs := make(map[string]bool)
+	for _, s := range subs {
+		gatewaySubs[s.ID] = true
+		if !between(s.Created, from, to) {
+			continue
+		}
+		report.Subscriptions++
+		f, err := rc.checkSubscription(s)
+		if err != nil {
+			return report, err
+		}
+		report.Findings = append(report.Findings, f...)
+	}
+
+	for _, p := range records {
+		known := gatewaySubs[p.PaymentIntent]
+		if !p.Recurring {
+			_, known = payments[p.PaymentIntent]
+		}
+		// a payment waiting for the card holder to authenticate has no charge yet
+		if known || (!p.Recurring && p.TransactionStatusID == models.TransactionPending) {
+			continue
+		}
+		object := "charge"
+		if p.Recurring {
+			object = "subscription"
+		}
+		report.Findings = append(report.Findings, Finding{
+			Kind:          Orphaned,
+			Object:        object,
+			GatewayID:     p.PaymentIntent,
+			TransactionID: p.TransactionID,
+			OrderID:       p.OrderID,
+			Detail:        fmt.Sprintf("%s %s is not known to the gateway", object, p.PaymentIntent),
+		})
+	}
+
+	return report, nil
+}
+
+// paymentCharges returns the charge of each payment intent that is not a subscription
+// invoice: its successful one if it has one, its latest one otherwise
+func paymentCharges(charges []Charge) map[string]Charge {
+	payments := make(map[string]Charge)
+	for _, c := range charges {
+		if c.PaymentIntent == "" || c.Invoiced {
+			continue
+		}
+		if prev, ok := payments[c.PaymentIntent]; ok {
+			prevSucceeded, succeeded := prev.Status == "succeeded", c.Status == "succeeded"
+			if prevSucceeded && !succeeded || prevSucceeded == succeeded && prev.Created.After(c.Created) {
+				continue
+			}
+		}
+		payments[c.PaymentIntent] = c
+	}
+	return payments
+}
+
+// chargeStatus returns the transaction status a charge should be recorded with. A
+// released authorization is refunded without having been captured.
+func chargeStatus(c Charge) int {
+	switch {
+	case c.Status == "failed":
+		return models.TransactionDeclined
+	case c.Status == "pending":
+		return models.TransactionPending
+	case !c.Captured && c.Refunded > 0:
+		return models.TransactionVoided
+	case !c.Captured:
+		return models.TransactionAuthorized
+	case c.Refunded >= c.Amount:
+		return models.TransactionRefunded
+	case c.Refunded > 0:
+		return models.TransactionPartiallyRefunded
+	}
+	return models.TransactionCleared
+}
+
+// orderStatus returns the status of the order of a transaction with status txnStatus
+func orderStatus(txnStatus int) int {
+	switch txnStatus {
+	case models.TransactionRefunded:
+		return models.OrderRefunded
+	case models.TransactionDeclined, models.TransactionVoided:
+		return models.OrderCancelled
+	case models.TransactionPending, models.TransactionAuthorized:
+		return models.OrderPending
+	}
+	return models.OrderCleared
+}
+
+// paid reports whether a transaction status is one of a captured payment, which may
+// have been refunded since. How much was refunded is compared separately.
+func paid(txnStatus int) bool {
+	return txnStatus == models.TransactionCleared || txnStatus == models.TransactionRefunded ||
+		txnStatus == models.TransactionPartiallyRefunded
+}
+
+func (rc *Reconciler) checkCharge(c Charge) ([]Finding, error) {
+	p, err := rc.DB.GetPaymentRecord(c.PaymentIntent)
+	if errors.Is(err, sql.ErrNoRows) {
+		// declined checkouts are never recorded
+		if c.Status != "succeeded" {
+			return nil, nil
+		}
+		f := Finding{
+			Kind:      Missing,
+			Object:    "charge",
+			GatewayID: c.ID,
+			Detail:    fmt.Sprintf("payment %s of %d %s has no transaction", c.PaymentIntent, c.Amount, c.Currency),
+		}
+		if rc.Repair {
+			f.TransactionID, f.OrderID, err = rc.recordCharge(c)
+			f.repaired(err)
+		}
+		return []Finding{f}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	want := chargeStatus(c)
+	var diffs []string
+	if p.Amount != c.Amount {
+		diffs = append(diffs, fmt.Sprintf("amount %d, gateway %d", p.Amount, c.Amount))
+	}
+	if !strings.EqualFold(p.Currency, c.Currency) {
+		diffs = append(diffs, fmt.Sprintf("currency %s, gateway %s", p.Currency, c.Currency))
+	}
+	if paid(want) && paid(p.TransactionStatusID) {
+		if p.Refunded != c.Refunded {
+			diffs = append(diffs, fmt.Sprintf("refunded %d, gateway %d", p.Refunded, c.Refunded))
+		}
+	} else if p.TransactionStatusID != want {
+		diffs = append(diffs, fmt.Sprintf("transaction status %d, gateway %d", p.TransactionStatusID, want))
+	}
+	if len(diffs) == 0 {
+		return nil, nil
+	}
+
+	f := Finding{
+		Kind:          Mismatched,
+		Object:        "charge",
+		GatewayID:     c.ID,
+		TransactionID: p.TransactionID,
+		OrderID:       p.OrderID,
+		Detail:        fmt.Sprintf("payment %s: %s", c.PaymentIntent, strings.Join(diffs, "; ")),
+	}
+	if rc.Repair {
+		f.repaired(rc.repairCharge(p, c.Amount, want))
+	}
+	return []Finding{f}, nil
+}
+
+func (rc *Reconciler) checkRefund(r Refund) ([]Finding, error) {
+	p, err := rc.DB.GetPaymentRecord(r.PaymentIntent)
+	if errors.Is(err, sql.ErrNoRows) {
+		return []Finding{{
+			Kind:      Missing,
+			Object:    "refund",
+			GatewayID: r.ID,
+			Detail:    fmt.Sprintf("refund of payment %s, which has no transaction", r.PaymentIntent),
+		}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.Refunded == r.ChargeRefunded {
+		return nil, nil
+	}
+
+	f := Finding{
+		Kind:          Mismatched,
+		Object:        "refund",
+		GatewayID:     r.ID,
+		TransactionID: p.TransactionID,
+		OrderID:       p.OrderID,
+		Detail:        fmt.Sprintf("payment %s: refunded %d, gateway %d", r.PaymentIntent, p.Refunded, r.ChargeRefunded),
+	}
+	if rc.Repair {
+		want := models.TransactionPartiallyRefunded
+		if r.ChargeRefunded >= p.Amount {
+			want = models.TransactionRefunded
+		}
+		f.repaired(rc.repairCharge(p, p.Amount, want))
+	}
+	return []Finding{f}, nil
+}
+
+// repairCharge records the amount and status of a charge. Partial refunds are recorded
+// through returns, which the gateway knows nothing about, so they are left for an admin.
+func (rc *Reconciler) repairCharge(p models.PaymentRecord, amount, want int) error {
+	if want == models.TransactionPartiallyRefunded {
+		return errors.New("partial refunds must be recorded as returns")
+	}
+	if p.OrderID == 0 {
+		return rc.DB.RepairPayment(p.TransactionID, amount, want, 0)
+	}
+	return rc.DB.RepairPayment(p.TransactionID, amount, want, orderStatus(want))
+}
+
+// recordCharge records a charge the database is missing as a sale without a product,
+// like a sale of the virtual terminal. The charge ID is kept as the bank return code,
+// which payouts and disputes find the transaction by.
+func (rc *Reconciler) recordCharge(c Charge) (int, int, error) {
+	customerID, err := rc.insertCustomer(c.Name, c.Email)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	status := chargeStatus(c)
+	txnID, err := rc.DB.InsertTransaction(models.Transaction{
+		Amount:              c.Amount,
+		Currency:            strings.ToLower(c.Currency),
+		LastFour:            c.LastFour,
+		BankReturnCode:      c.ID,
+		PaymentIntent:       c.PaymentIntent,
+		TransactionStatusID: status,
+		CreatedAt:           c.Created,
+		UpdatedAt:           time.Now(),
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	orderID, err := rc.DB.InsertOrder(models.Order{
+		TransactionID: txnID,
+		CustomerID:    customerID,
+		StatusID:      orderStatus(status),
+		Quantity:      1,
+		Amount:        c.Amount,
+		Note:          "recorded by reconciliation from charge " + c.ID,
+		CreatedAt:     c.Created,
+		UpdatedAt:     time.Now(),
+	})
+	return txnID, orderID, err
+}
+
+// subscriptionStatus returns the status of the order of a subscription. Subscriptions
+// are cancelled at the end of their period, so one that will be is cancelled already.
+func subscriptionStatus(s Subscription) int {
+	switch s.Status {
+	case "canceled", "incomplete_expired":
+		return models.OrderCancelled
+	case "past_due", "unpaid":
+		return models.OrderPastDue
+	case "incomplete":
+		return models.OrderPending
+	}
+	if s.CancelAtPeriodEnd {
+		return models.OrderCancelled
+	}
+	return models.OrderCleared
+}
+
+func (rc *Reconciler) checkSubscription(s Subscription) ([]Finding, error) {
+	p, err := rc.DB.GetPaymentRecord(s.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		f := Finding{
+			Kind:      Missing,
+			Object:    "subscription",
+			GatewayID: s.ID,
+			Detail:    fmt.Sprintf("subscription to %s has no order", s.Plan),
+		}
+		if rc.Repair {
+			f.TransactionID, f.OrderID, err = rc.recordSubscription(s)
+			f.repaired(err)
+		}
+		return []Finding{f}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	want := subscriptionStatus(s)
+	seats := p.Seats
+	var diffs []string
+	if p.OrderStatusID != want {
+		diffs = append(diffs, fmt.Sprintf("status %d, gateway %s", p.OrderStatusID, s.Status))
+	}
+	if s.Seats > 0 && p.Seats != s.Seats {
+		diffs = append(diffs, fmt.Sprintf("seats %d, gateway %d", p.Seats, s.Seats))
+		seats = s.Seats
+	}
+	if len(diffs) == 0 {
+		return nil, nil
+	}
+
+	f := Finding{
+		Kind:          Mismatched,
+		Object:        "subscription",
+		GatewayID:     s.ID,
+		TransactionID: p.TransactionID,
+		OrderID:       p.OrderID,
+		Detail:        fmt.Sprintf("subscription %s: %s", s.ID, strings.Join(diffs, "; ")),
+	}
+	if rc.Repair {
+		f.repaired(rc.DB.RepairSubscription(p.OrderID, want, seats))
+	}
+	return []Finding{f}, nil
+}
+
+// recordSubscription records a subscription the database is missing, as a subscription
+// to the widget of its plan
+func (rc *Reconciler) recordSubscription(s Subscription) (int, int, error) {
+	widgetID, err := rc.DB.GetWidgetIDByPlan(s.Plan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, fmt.Errorf("no widget has plan %s", s.Plan)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	customerID, err := rc.insertCustomer(s.Name, s.Email)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	txnID, err := rc.DB.InsertTransaction(models.Transaction{
+		Amount:              s.Amount,
+		Currency:            strings.ToLower(s.Currency),
+		PaymentIntent:       s.ID,
+		TransactionStatusID: models.TransactionCleared,
+		CreatedAt:           s.Created,
+		UpdatedAt:           time.Now(),
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	seats := s.Seats
+	if seats == 0 {
+		seats = 1
+	}
+	orderID, err := rc.DB.InsertOrder(models.Order{
+		WidgetID:      widgetID,
+		TransactionID: txnID,
+		CustomerID:    customerID,
+		StatusID:      subscriptionStatus(s),
+		Quantity:      seats,
+		Amount:        s.Amount,
+		Note:          "recorded by reconciliation from subscription " + s.ID,
+		CreatedAt:     s.Created,
+		UpdatedAt:     time.Now(),
+	})
+	return txnID, orderID, err
+}
+
+func (rc *Reconciler) insertCustomer(name, email string) (int, error) {
+	first, last := name, ""
+	if i := strings.LastIndex(name, " "); i > 0 {
+		first, last = name[:i], name[i+1:]
+	}
+	return rc.DB.InsertCustomer(models.Customer{
+		FirstName: first,
+		LastName:  last,
+		Email:     email,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+}
+
+func (f *Finding) repaired(err error) {
+	if err != nil {
+		f.RepairError = err.Error()
+		return
+	}
+	f.Repaired = true
+}
@@ -0,0 +1,272 @@
+package reconcile
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"go-commerce/internal/models"
+)
+
+// memStore is a Store holding payment records in memory
+type memStore struct {
+	records      map[string]models.PaymentRecord
+	plans        map[string]int
+	transactions []models.Transaction
+	orders       []models.Order
+	repaired     map[int]int // transaction ID -> status
+	subscribed   map[int]int // order ID -> status
+}
+
+func newMemStore(records ...models.PaymentRecord) *memStore {
+	s := &memStore{
+		records:    make(map[string]models.PaymentRecord),
+		plans:      map[string]int{"price_gold": 7},
+		repaired:   make(map[int]int),
+		subscribed: make(map[int]int),
+	}
+	for _, p := range records {
+		s.records[p.PaymentIntent] = p
+	}
+	return s
+}
+
+func (s *memStore) GetPaymentRecords(from, to time.Time) ([]models.PaymentRecord, error) {
+	var records []models.PaymentRecord
+	for _, p := range s.records {
+		if between(p.CreatedAt, from, to) {
+			records = append(records, p)
+		}
+	}
+	return records, nil
+}
+
+func (s *memStore) GetPaymentRecord(paymentIntent string) (models.PaymentRecord, error) {
+	p, ok := s.records[paymentIntent]
+	if !ok {
+		return p, sql.ErrNoRows
+	}
+	return p, nil
+}
+
+func (s *memStore) RepairPayment(transactionID, amount, txnStatus, orderStatus int) error {
+	s.repaired[transactionID] = txnStatus
+	return nil
+}
+
+func (s *memStore) RepairSubscription(orderID, statusID, seats int) error {
+	s.subscribed[orderID] = statusID
+	return nil
+}
+
+func (s *memStore) GetWidgetIDByPlan(plan string) (int, error) {
+	id, ok := s.plans[plan]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return id, nil
+}
+
+func (s *memStore) InsertTransaction(txn models.Transaction) (int, error) {
+	s.transactions = append(s.transactions, txn)
+	return 100 + len(s.transactions), nil
+}
+
+func (s *memStore) InsertOrder(order models.Order) (int, error) {
+	s.orders = append(s.orders, order)
+	return 200 + len(s.orders), nil
+}
+
+func (s *memStore) InsertCustomer(customer models.Customer) (int, error) {
+	return 1, nil
+}
+
+var day = time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+// fixture returns a gateway and a database that differ by one record of each kind: a
+// missing charge, a charge recorded with the wrong amount, a charge the gateway does
+// not know, and a missing subscription
+func fixture() (*FakeGateway, *memStore) {
+	at := day.Add(10 * time.Hour)
+	g := &FakeGateway{
+		Charges: []Charge{
+			{ID: "ch_ok", PaymentIntent: "pi_ok", Amount: 1000, Currency: "usd", Status: "succeeded", Captured: true, Created: at},
+			{ID: "ch_missing", PaymentIntent: "pi_missing", Amount: 2500, Currency: "usd", Status: "succeeded", Captured: true,
+				Email: "jane@example.com", Name: "Jane Doe", LastFour: "4242", Created: at},
+			{ID: "ch_amount", PaymentIntent: "pi_amount", Amount: 1200, Currency: "usd", Status: "succeeded", Captured: true, Created: at},
+			{ID: "ch_declined", PaymentIntent: "pi_declined", Amount: 900, Currency: "usd", Status: "failed", Created: at},
+		},
+		Subscriptions: []Subscription{
+			{ID: "sub_missing", Status: "active", Plan: "price_gold", Seats: 3, Amount: 3000, Currency: "usd",
+				Email: "joe@example.com", Name: "Joe Bloggs", Created: at},
+		},
+	}
+	db := newMemStore(
+		models.PaymentRecord{TransactionID: 1, OrderID: 11, PaymentIntent: "pi_ok", Amount: 1000, Currency: "usd",
+			TransactionStatusID: models.TransactionCleared, OrderStatusID: models.OrderCleared, CreatedAt: at},
+		models.PaymentRecord{TransactionID: 2, OrderID: 12, PaymentIntent: "pi_amount", Amount: 1000, Currency: "usd",
+			TransactionStatusID: models.TransactionCleared, OrderStatusID: models.OrderCleared, CreatedAt: at},
+		models.PaymentRecord{TransactionID: 3, OrderID: 13, PaymentIntent: "pi_orphan", Amount: 500, Currency: "usd",
+			TransactionStatusID: models.TransactionCleared, OrderStatusID: models.OrderCleared, CreatedAt: at},
+	)
+	return g, db
+}
+
+// findings indexes the findings of a report by gateway ID
+func findings(r Report) map[string]Finding {
+	m := make(map[string]Finding)
+	for _, f := range r.Findings {
+		m[f.GatewayID] = f
+	}
+	return m
+}
+
+func TestRunReports(t *testing.T) {
+	g, db := fixture()
+	rc := Reconciler{DB: db, Gateway: g, Margin: time.Hour}
+
+	report, err := rc.Run(day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]struct{ kind, object string }{
+		"ch_missing":  {Missing, "charge"},
+		"ch_amount":   {Mismatched, "charge"},
+		"pi_orphan":   {Orphaned, "charge"},
+		"sub_missing": {Missing, "subscription"},
+	}
+	got := findings(report)
+	if len(got) != len(want) {
+		t.Fatalf("got %d findings, want %d: %+v", len(got), len(want), report.Findings)
+	}
+	for id, w := range want {
+		f, ok := got[id]
+		if !ok {
+			t.Errorf("no finding for %s", id)
+			continue
+		}
+		if f.Kind != w.kind || f.Object != w.object {
+			t.Errorf("%s: got %s %s, want %s %s", id, f.Kind, f.Object, w.kind, w.object)
+		}
+		if f.Repaired {
+			t.Errorf("%s: repaired without Repair", id)
+		}
+	}
+	if got["ch_amount"].TransactionID != 2 {
+		t.Errorf("mismatched charge names transaction %d, want 2", got["ch_amount"].TransactionID)
+	}
+
+	if report.Charges != 4 || report.Subscriptions != 1 || report.Transactions != 3 {
+		t.Errorf("checked %d charges, %d subscriptions and %d transactions, want 4, 1 and 3",
+			report.Charges, report.Subscriptions, report.Transactions)
+	}
+	if n := report.Unresolved(); n != 4 {
+		t.Errorf("Unresolved() = %d, want 4", n)
+	}
+	if len(db.transactions) != 0 || len(db.repaired) != 0 {
+		t.Error("the database was changed without Repair")
+	}
+}
+
+func TestRunRepairs(t *testing.T) {
+	g, db := fixture()
+	rc := Reconciler{DB: db, Gateway: g, Repair: true, Margin: time.Hour}
+
+	report, err := rc.Run(day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := findings(report)
+	for _, id := range []string{"ch_missing", "ch_amount", "sub_missing"} {
+		if f := got[id]; !f.Repaired {
+			t.Errorf("%s not repaired: %s", id, f.RepairError)
+		}
+	}
+	if got["pi_orphan"].Repaired {
+		t.Error("orphaned charge repaired")
+	}
+	if n := report.Unresolved(); n != 1 {
+		t.Errorf("Unresolved() = %d, want 1", n)
+	}
+
+	if status, ok := db.repaired[2]; !ok || status != models.TransactionCleared {
+		t.Errorf("mismatched transaction repaired with status %d, %t", status, ok)
+	}
+
+	if len(db.transactions) != 2 || len(db.orders) != 2 {
+		t.Fatalf("recorded %d transactions and %d orders, want 2 and 2", len(db.transactions), len(db.orders))
+	}
+	txn, order := db.transactions[0], db.orders[0]
+	if txn.PaymentIntent != "pi_missing" || txn.BankReturnCode != "ch_missing" || txn.Amount != 2500 ||
+		txn.TransactionStatusID != models.TransactionCleared {
+		t.Errorf("missing charge recorded as %+v", txn)
+	}
+	if order.Amount != 2500 || order.StatusID != models.OrderCleared || order.WidgetID != 0 {
+		t.Errorf("missing charge ordered as %+v", order)
+	}
+	sub := db.orders[1]
+	if sub.WidgetID != 7 || sub.Quantity != 3 || db.transactions[1].PaymentIntent != "sub_missing" {
+		t.Errorf("missing subscription recorded as %+v", sub)
+	}
+}
+
+func TestRunRepairUnknownPlan(t *testing.T) {
+	g, db := fixture()
+	g.Subscriptions[0].Plan = "price_unknown"
+	rc := Reconciler{DB: db, Gateway: g, Repair: true}
+
+	report, err := rc.Run(day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := findings(report)["sub_missing"]
+	if f.Repaired || f.RepairError == "" {
+		t.Errorf("subscription to an unknown plan: repaired %t, error %q", f.Repaired, f.RepairError)
+	}
+}
+
+func TestPaymentCharges(t *testing.T) {
+	at := day.Add(time.Hour)
+	charges := []Charge{
+		{ID: "a", PaymentIntent: "pi", Status: "failed", Created: at},
+		{ID: "b", PaymentIntent: "pi", Status: "succeeded", Created: at.Add(-time.Minute)},
+		{ID: "c", PaymentIntent: "pi", Status: "failed", Created: at.Add(time.Minute)},
+		{ID: "d", PaymentIntent: "pi_declined", Status: "failed", Created: at},
+		{ID: "e", PaymentIntent: "pi_declined", Status: "failed", Created: at.Add(time.Minute)},
+		{ID: "f", PaymentIntent: "pi_invoice", Status: "succeeded", Invoiced: true, Created: at},
+	}
+
+	payments := paymentCharges(charges)
+	if payments["pi"].ID != "b" {
+		t.Errorf("payment pi has charge %s, want the successful b", payments["pi"].ID)
+	}
+	if payments["pi_declined"].ID != "e" {
+		t.Errorf("payment pi_declined has charge %s, want the latest e", payments["pi_declined"].ID)
+	}
+	if _, ok := payments["pi_invoice"]; ok {
+		t.Error("invoiced charge counted as a payment")
+	}
+}
+
+func TestChargeStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		charge Charge
+		want   int
+	}{
+		{"failed", Charge{Status: "failed"}, models.TransactionDeclined},
+		{"pending", Charge{Status: "pending"}, models.TransactionPending},
+		{"authorized", Charge{Status: "succeeded", Amount: 500}, models.TransactionAuthorized},
+		{"released", Charge{Status: "succeeded", Amount: 500, Refunded: 500}, models.TransactionVoided},
+		{"cleared", Charge{Status: "succeeded", Captured: true, Amount: 500}, models.TransactionCleared},
+		{"partly refunded", Charge{Status: "succeeded", Captured: true, Amount: 500, Refunded: 100}, models.TransactionPartiallyRefunded},
+		{"refunded", Charge{Status: "succeeded", Captured: true, Amount: 500, Refunded: 500}, models.TransactionRefunded},
+	}
+	for _, tt := range tests {
+		if got := chargeStatus(tt.charge); got != tt.want {
+			t.Errorf("%s: chargeStatus() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
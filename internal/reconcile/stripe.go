@@ -0,0 +1,110 @@
+package reconcile
+
+import (
+	"time"
+
+	"go-commerce/internal/payment"
+
+	"github.com/stripe/stripe-go/v72"
+)
+
+// StripeGateway lists the records of the Stripe account of Config
+type StripeGateway struct {
+	Config *payment.Config
+}
+
+// ListCharges lists the charges created from from until to
+func (g StripeGateway) ListCharges(from, to time.Time) ([]Charge, error) {
+	list, err := g.Config.ListCharges(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var charges []Charge
+	for _, ch := range list {
+		c := Charge{
+			ID:       ch.ID,
+			Amount:   int(ch.Amount),
+			Refunded: int(ch.AmountRefunded),
+			Currency: string(ch.Currency),
+			Status:   string(ch.Status),
+			Captured: ch.Captured,
+			Invoiced: ch.Invoice != nil,
+			Created:  time.Unix(ch.Created, 0),
+		}
+		if ch.Captured {
+			c.Amount = int(ch.AmountCaptured)
+		}
+		if ch.PaymentIntent != nil {
+			c.PaymentIntent = ch.PaymentIntent.ID
+		}
+		if ch.BillingDetails != nil {
+			c.Email, c.Name = ch.BillingDetails.Email, ch.BillingDetails.Name
+		}
+		if ch.PaymentMethodDetails != nil && ch.PaymentMethodDetails.Card != nil {
+			c.LastFour = ch.PaymentMethodDetails.Card.Last4
+		}
+		charges = append(charges, c)
+	}
+	return charges, nil
+}
+
+// ListRefunds lists the refunds made from from until to
+func (g StripeGateway) ListRefunds(from, to time.Time) ([]Refund, error) {
+	list, err := g.Config.ListRefunds(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var refunds []Refund
+	for _, re := range list {
+		r := Refund{
+			ID:      re.ID,
+			Amount:  int(re.Amount),
+			Status:  string(re.Status),
+			Created: time.Unix(re.Created, 0),
+		}
+		if re.PaymentIntent != nil {
+			r.PaymentIntent = re.PaymentIntent.ID
+		}
+		if re.Charge != nil {
+			r.ChargeRefunded = int(re.Charge.AmountRefunded)
+		}
+		refunds = append(refunds, r)
+	}
+	return refunds, nil
+}
+
+// ListSubscriptions lists the subscriptions created from from until to
+func (g StripeGateway) ListSubscriptions(from, to time.Time) ([]Subscription, error) {
+	list, err := g.Config.ListSubscriptions(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var subs []Subscription
+	for _, sub := range list {
+		s := Subscription{
+			ID:                sub.ID,
+			Status:            string(sub.Status),
+			CancelAtPeriodEnd: sub.CancelAtPeriodEnd,
+			Created:           time.Unix(sub.Created, 0),
+		}
+		if sub.Customer != nil {
+			s.Email, s.Name = sub.Customer.Email, sub.Customer.Name
+		}
+		if sub.Items != nil && len(sub.Items.Data) > 0 {
+			item := sub.Items.Data[0]
+			if item.Plan != nil {
+				s.Plan = item.Plan.ID
+				s.Amount = int(item.Plan.Amount * item.Quantity)
+				s.Currency = string(item.Plan.Currency)
+				if item.Plan.UsageType != stripe.PlanUsageTypeMetered {
+					s.Seats = int(item.Quantity)
+				}
+			}
+		}
+		subs = append(subs, s)
+	}
+	return subs, nil
+}
@@ -0,0 +1,137 @@
+// Package shipping prices the delivery of physical widgets. A Calculator quotes the
+// cheapest way to ship a parcel of a given weight to the country and region of the
+// buyer; Table is the calculator backed by the shipping zones and rates kept in the
+// database. Weights are in grams and amounts in minor units of the currency of the sale.
+package shipping
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrNoRate is returned when nothing ships the parcel to the destination in the currency
+var ErrNoRate = errors.New("no shipping rate for this destination")
+
+// RestOfWorld is the jurisdiction of a zone that covers every destination not in
+// another zone
+const RestOfWorld = "*"
+
+// Calculator quotes the shipping of a parcel
+type Calculator interface {
+	Quote(r Request) (Quote, error)
+}
+
+// Request is a parcel to ship to a buyer in Country and, for countries split into
+// zones by state or province, Region
+type Request struct {
+	Country  string
+	Region   string
+	Currency string
+	Weight   int
+}
+
+// Quote is the cheapest rate that ships a parcel, in the zone of its destination
+type Quote struct {
+	Zone     string `json:"zone"`
+	Method   string `json:"method"`
+	Currency string `json:"currency"`
+	Weight   int    `json:"weight"`
+	Amount   int    `json:"amount"`
+}
+
+// Rate is a way to ship parcels in a zone. A parcel from MinWeight up to, but not
+// including, MaxWeight costs Flat plus PerKg for every started kilogram. A MaxWeight
+// of 0 has no upper limit.
+type Rate struct {
+	Zone      string
+	Method    string
+	Currency  string
+	MinWeight int
+	MaxWeight int
+	Flat      int
+	PerKg     int
+}
+
+// Price returns the cost of shipping a parcel of weight grams at the rate
+func (r Rate) Price(weight int) int {
+	kg := (weight + 999) / 1000
+	return r.Flat + kg*r.PerKg
+}
+
+func (r Rate) ships(weight int, currency string) bool {
+	return strings.EqualFold(r.Currency, currency) &&
+		weight >= r.MinWeight &&
+		(r.MaxWeight == 0 || weight < r.MaxWeight)
+}
+
+// Table is a Calculator with zones keyed by jurisdiction. A destination is in the zone
+// of its region, like "US-AK", or else of its country, like "US", or else in the rest
+// of the world zone, if there is one.
+type Table struct {
+	zones map[string]string
+	rates map[string][]Rate
+}
+
+// NewTable returns an empty table. An empty table ships everything for free, so a
+// store that has not set up shipping charges none.
+func NewTable() *Table {
+	return &Table{zones: make(map[string]string), rates: make(map[string][]Rate)}
+}
+
+// AddZone puts jurisdiction, a country, a subdivision or RestOfWorld, in zone
+func (t *Table) AddZone(zone, jurisdiction string) {
+	t.zones[strings.ToUpper(jurisdiction)] = zone
+}
+
+// AddRate adds a rate to its zone
+func (t *Table) AddRate(r Rate) {
+	t.rates[r.Zone] = append(t.rates[r.Zone], r)
+}
+
+// Zone returns the zone of a destination, or "" if it is in none
+func (t *Table) Zone(country, region string) string {
+	country = strings.ToUpper(country)
+	if region != "" {
+		if z, ok := t.zones[country+"-"+strings.ToUpper(region)]; ok {
+			return z
+		}
+	}
+	if z, ok := t.zones[country]; ok {
+		return z
+	}
+	return t.zones[RestOfWorld]
+}
+
+// Quote returns the cheapest rate of the destination's zone that ships the parcel in
+// its currency, or ErrNoRate
+func (t *Table) Quote(r Request) (Quote, error) {
+	if len(t.zones) == 0 {
+		return Quote{Currency: strings.ToLower(r.Currency), Weight: r.Weight}, nil
+	}
+
+	zone := t.Zone(r.Country, r.Region)
+	if zone == "" {
+		return Quote{}, ErrNoRate
+	}
+
+	var best *Rate
+	for i, rate := range t.rates[zone] {
+		if !rate.ships(r.Weight, r.Currency) {
+			continue
+		}
+		if best == nil || rate.Price(r.Weight) < best.Price(r.Weight) {
+			best = &t.rates[zone][i]
+		}
+	}
+	if best == nil {
+		return Quote{}, ErrNoRate
+	}
+
+	return Quote{
+		Zone:     zone,
+		Method:   best.Method,
+		Currency: strings.ToLower(r.Currency),
+		Weight:   r.Weight,
+		Amount:   best.Price(r.Weight),
+	}, nil
+}
@@ -0,0 +1,89 @@
+package shipping
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testTable() *Table {
+	table := NewTable()
+	table.AddZone("Domestic", "us")
+	table.AddZone("Remote", "US-AK")
+	table.AddZone("Remote", "US-HI")
+	table.AddZone("World", RestOfWorld)
+
+	table.AddRate(Rate{Zone: "Domestic", Method: "Ground", Currency: "usd", MaxWeight: 5000, Flat: 500, PerKg: 100})
+	table.AddRate(Rate{Zone: "Domestic", Method: "Freight", Currency: "usd", MinWeight: 5000, Flat: 2000})
+	table.AddRate(Rate{Zone: "Domestic", Method: "Letter", Currency: "usd", MaxWeight: 100, Flat: 150})
+	table.AddRate(Rate{Zone: "Remote", Method: "Air", Currency: "usd", Flat: 1500, PerKg: 500})
+	table.AddRate(Rate{Zone: "World", Method: "Post", Currency: "usd", Flat: 2500, PerKg: 1000})
+	table.AddRate(Rate{Zone: "World", Method: "Post", Currency: "eur", Flat: 2300, PerKg: 900})
+	return table
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name    string
+		request Request
+		zone    string
+		method  string
+		amount  int
+	}{
+		{"ground", Request{Country: "US", Region: "CA", Currency: "USD", Weight: 1200}, "Domestic", "Ground", 700},
+		{"started kilogram", Request{Country: "US", Currency: "usd", Weight: 1001}, "Domestic", "Ground", 700},
+		{"cheapest rate wins", Request{Country: "US", Currency: "usd", Weight: 50}, "Domestic", "Letter", 150},
+		{"max weight is excluded", Request{Country: "US", Currency: "usd", Weight: 5000}, "Domestic", "Freight", 2000},
+		{"region zone", Request{Country: "us", Region: "ak", Currency: "usd", Weight: 2000}, "Remote", "Air", 2500},
+		{"rest of the world", Request{Country: "DE", Currency: "eur", Weight: 500}, "World", "Post", 3200},
+	}
+	table := testTable()
+	for _, tt := range tests {
+		q, err := table.Quote(tt.request)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if q.Zone != tt.zone || q.Method != tt.method || q.Amount != tt.amount {
+			t.Errorf("%s: got %+v, want %s %s %d", tt.name, q, tt.zone, tt.method, tt.amount)
+		}
+		if q.Weight != tt.request.Weight || q.Currency != strings.ToLower(tt.request.Currency) {
+			t.Errorf("%s: got weight %d and currency %q", tt.name, q.Weight, q.Currency)
+		}
+	}
+}
+
+func TestQuoteNoRate(t *testing.T) {
+	table := testTable()
+	if _, err := table.Quote(Request{Country: "US", Region: "HI", Currency: "eur", Weight: 100}); !errors.Is(err, ErrNoRate) {
+		t.Errorf("zone without a rate in the currency: got %v", err)
+	}
+
+	table = NewTable()
+	table.AddZone("Domestic", "US")
+	table.AddRate(Rate{Zone: "Domestic", Method: "Ground", Currency: "usd", MaxWeight: 5000, Flat: 500})
+	if _, err := table.Quote(Request{Country: "CA", Currency: "usd", Weight: 100}); !errors.Is(err, ErrNoRate) {
+		t.Errorf("destination in no zone: got %v", err)
+	}
+	if _, err := table.Quote(Request{Country: "US", Currency: "usd", Weight: 6000}); !errors.Is(err, ErrNoRate) {
+		t.Errorf("parcel too heavy: got %v", err)
+	}
+}
+
+func TestQuoteWithoutZonesIsFree(t *testing.T) {
+	q, err := NewTable().Quote(Request{Country: "US", Currency: "USD", Weight: 1200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Amount != 0 || q.Currency != "usd" || q.Weight != 1200 {
+		t.Errorf("got %+v", q)
+	}
+}
+
+func TestPrice(t *testing.T) {
+	r := Rate{Flat: 300, PerKg: 250}
+	for weight, want := range map[int]int{0: 300, 1: 550, 1000: 550, 1001: 800, 2500: 1050} {
+		if got := r.Price(weight); got != want {
+			t.Errorf("%dg: got %d, want %d", weight, got, want)
+		}
+	}
+}
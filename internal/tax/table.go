@@ -0,0 +1,179 @@
+package tax
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Rate is a tax rate in percent. Rates are exact decimals.
+type Rate struct {
+	r *big.Rat
+}
+
+// ParseRate parses a tax rate in percent such as "19" or "8.875"
+func ParseRate(s string) (Rate, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok || r.Sign() < 0 || r.Cmp(big.NewRat(100, 1)) > 0 {
+		return Rate{}, fmt.Errorf("invalid tax rate %q", s)
+	}
+	return Rate{r: r}, nil
+}
+
+// String returns the rate with up to 4 decimals
+func (r Rate) String() string {
+	if r.r == nil {
+		return "0"
+	}
+	return strings.TrimRight(strings.TrimRight(r.r.FloatString(4), "0"), ".")
+}
+
+// fraction returns the rate as a fraction of one
+func (r Rate) fraction() *big.Rat {
+	if r.r == nil {
+		return new(big.Rat)
+	}
+	return new(big.Rat).Quo(r.r, big.NewRat(100, 1))
+}
+
+type rule struct {
+	jurisdiction string
+	name         string
+	rate         Rate
+	inclusive    bool
+}
+
+type exemption struct {
+	taxID        string
+	jurisdiction string
+	reason       string
+}
+
+// Table is a Calculator with tax rules keyed by jurisdiction. A sale is taxed under the
+// rules of the country of the buyer and of their subdivision, so a Canadian province
+// can add its sales tax to the federal one. Prices under inclusive rules already
+// contain the tax, which is split out of them; exclusive rules add the tax on top of
+// the net price.
+type Table struct {
+	rules      map[string][]rule
+	exemptions []exemption
+}
+
+// NewTable returns an empty table, under which nothing is taxed
+func NewTable() *Table {
+	return &Table{rules: make(map[string][]rule)}
+}
+
+// AddRule adds a tax of rate percent called name in jurisdiction
+func (t *Table) AddRule(jurisdiction, name string, rate Rate, inclusive bool) {
+	jurisdiction = strings.ToUpper(jurisdiction)
+	t.rules[jurisdiction] = append(t.rules[jurisdiction], rule{
+		jurisdiction: jurisdiction,
+		name:         name,
+		rate:         rate,
+		inclusive:    inclusive,
+	})
+}
+
+// AddExemption exempts the buyer with taxID from tax in jurisdiction, which may be a
+// country, a subdivision, or empty for everywhere
+func (t *Table) AddExemption(taxID, jurisdiction, reason string) {
+	t.exemptions = append(t.exemptions, exemption{
+		taxID:        NormalizeTaxID(taxID),
+		jurisdiction: strings.ToUpper(jurisdiction),
+		reason:       reason,
+	})
+}
+
+// Calculate quotes the tax on a sale. Buyers who are exempt pay the net price, so
+// inclusive tax is still split out of the price for them.
+func (t *Table) Calculate(r Request) (Quote, error) {
+	j, err := NormalizeJurisdiction(r.Jurisdiction)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	q := Quote{Jurisdiction: j, Currency: strings.ToLower(r.Currency), Lines: []Line{}}
+	rules := t.rules[Country(j)]
+	if j != Country(j) {
+		rules = append(append([]rule{}, rules...), t.rules[j]...)
+	}
+	q.Exempt = t.exemption(r.TaxID, j)
+
+	inclusive := new(big.Rat)
+	for _, rl := range rules {
+		if rl.inclusive {
+			inclusive.Add(inclusive, rl.rate.fraction())
+		}
+	}
+	divisor := new(big.Rat).Add(big.NewRat(1, 1), inclusive)
+
+	lines := make([]Line, len(rules))
+	for i, rl := range rules {
+		lines[i] = Line{Jurisdiction: rl.jurisdiction, Name: rl.name, Rate: rl.rate.String(), Inclusive: rl.inclusive}
+	}
+
+	for _, item := range r.Items {
+		price := big.NewRat(int64(item.Amount), 1)
+		net := int(roundHalfAway(new(big.Rat).Quo(price, divisor)))
+		q.Subtotal += net
+
+		// the inclusive taxes of an item add up to the difference between its price and
+		// its net price, so the last one takes the rounding difference
+		included, last := item.Amount-net, -1
+		for i, rl := range rules {
+			amount := int(roundHalfAway(new(big.Rat).Mul(big.NewRat(int64(net), 1), rl.rate.fraction())))
+			if rl.inclusive {
+				included -= amount
+				last = i
+			}
+			lines[i].Taxable += net
+			lines[i].Amount += amount
+		}
+		if last >= 0 {
+			lines[last].Amount += included
+		}
+	}
+
+	if q.Exempt == "" {
+		for _, l := range lines {
+			q.Tax += l.Amount
+		}
+		q.Lines = lines
+	}
+	q.Total = q.Subtotal + q.Tax
+	return q, nil
+}
+
+// exemption returns the reason the buyer with taxID is exempt from tax in jurisdiction,
+// or "" if they are not
+func (t *Table) exemption(taxID, jurisdiction string) string {
+	taxID = NormalizeTaxID(taxID)
+	if taxID == "" {
+		return ""
+	}
+	for _, e := range t.exemptions {
+		if e.taxID != taxID {
+			continue
+		}
+		if e.jurisdiction == "" || e.jurisdiction == jurisdiction || e.jurisdiction == Country(jurisdiction) {
+			if e.reason == "" {
+				return "exempt"
+			}
+			return e.reason
+		}
+	}
+	return ""
+}
+
+func roundHalfAway(v *big.Rat) int64 {
+	num := new(big.Int).Abs(v.Num())
+	q, r := new(big.Int).QuoRem(num, v.Denom(), new(big.Int))
+	if r.Mul(r, big.NewInt(2)).Cmp(v.Denom()) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if v.Sign() < 0 {
+		q.Neg(q)
+	}
+	return q.Int64()
+}
@@ -0,0 +1,97 @@
+// Package tax works out the tax due on a sale. A Calculator quotes the tax on the
+// items of a sale for the jurisdiction of the buyer; Table is the calculator backed by
+// the tax rules and exemptions kept in the database. Amounts are in minor units of
+// the currency of the sale.
+package tax
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidJurisdiction is returned for a jurisdiction that is not an ISO 3166 code
+var ErrInvalidJurisdiction = errors.New("invalid tax jurisdiction")
+
+var jurisdictionRX = regexp.MustCompile(`^[A-Z]{2}(-[A-Z0-9]{1,3})?$`)
+
+// Calculator quotes the tax on a sale
+type Calculator interface {
+	Calculate(r Request) (Quote, error)
+}
+
+// Request is a sale to quote. Jurisdiction is an ISO 3166-1 country code, optionally
+// followed by an ISO 3166-2 subdivision, like "DE" or "US-CA". TaxID is the tax or
+// VAT number of the buyer, if they gave one.
+type Request struct {
+	Jurisdiction string
+	TaxID        string
+	Currency     string
+	Items        []Item
+}
+
+// Item is one item of a sale. Amount is the price of the item times its quantity,
+// as shown to the buyer.
+type Item struct {
+	Description string
+	Amount      int
+}
+
+// Line is the tax charged under one rule. Rate is a percentage, like "19" or "8.875",
+// and Taxable is the amount the rate was applied to.
+type Line struct {
+	Jurisdiction string `json:"jurisdiction"`
+	Name         string `json:"name"`
+	Rate         string `json:"rate"`
+	Inclusive    bool   `json:"inclusive"`
+	Taxable      int    `json:"taxable"`
+	Amount       int    `json:"amount"`
+}
+
+// Quote is the tax due on a sale. Subtotal is the price of the items net of tax and
+// Total is what the buyer pays. When the buyer is exempt, Exempt holds the reason and
+// there are no lines.
+type Quote struct {
+	Jurisdiction string `json:"jurisdiction"`
+	Currency     string `json:"currency"`
+	Subtotal     int    `json:"subtotal"`
+	Tax          int    `json:"tax"`
+	Total        int    `json:"total"`
+	Exempt       string `json:"exempt,omitempty"`
+	Lines        []Line `json:"lines"`
+}
+
+// NormalizeJurisdiction returns jurisdiction in upper case, or ErrInvalidJurisdiction
+func NormalizeJurisdiction(jurisdiction string) (string, error) {
+	j := strings.ToUpper(strings.TrimSpace(jurisdiction))
+	if !jurisdictionRX.MatchString(j) {
+		return "", ErrInvalidJurisdiction
+	}
+	return j, nil
+}
+
+// Jurisdiction returns the jurisdiction of a buyer in country and, for countries that
+// tax by state or province, region, like "US-CA". It does not validate either.
+func Jurisdiction(country, region string) string {
+	if region == "" {
+		return strings.ToUpper(country)
+	}
+	return strings.ToUpper(country + "-" + region)
+}
+
+// Country returns the country of a normalized jurisdiction
+func Country(jurisdiction string) string {
+	return strings.SplitN(jurisdiction, "-", 2)[0]
+}
+
+// NormalizeTaxID returns a tax ID in upper case without the spaces, dots and dashes
+// people type in them, so "de 123.456.789" and "DE123456789" are the same ID
+func NormalizeTaxID(id string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '.', '-', '/':
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(id)))
+}
@@ -0,0 +1,134 @@
+package tax
+
+import (
+	"errors"
+	"testing"
+)
+
+func mustRate(t *testing.T, s string) Rate {
+	t.Helper()
+	r, err := ParseRate(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func testTable(t *testing.T) *Table {
+	table := NewTable()
+	table.AddRule("de", "VAT", mustRate(t, "19"), true)
+	table.AddRule("CA", "GST", mustRate(t, "5"), false)
+	table.AddRule("CA-QC", "QST", mustRate(t, "9.975"), false)
+	table.AddRule("US-CA", "Sales tax", mustRate(t, "7.25"), false)
+	table.AddRule("XX", "First", mustRate(t, "10"), true)
+	table.AddRule("XX", "Second", mustRate(t, "5"), true)
+	table.AddExemption("DE123456789", "DE", "Reverse charge")
+	table.AddExemption("GB 111-222", "", "")
+	return table
+}
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		name         string
+		jurisdiction string
+		taxID        string
+		amounts      []int
+		subtotal     int
+		lines        []int
+		total        int
+		exempt       string
+	}{
+		{"inclusive", "DE", "", []int{11900}, 10000, []int{1900}, 11900, ""},
+		{"inclusive rounding", "de", "", []int{999}, 839, []int{160}, 999, ""},
+		{"several items", "DE", "", []int{11900, 999}, 10839, []int{2060}, 12899, ""},
+		{"country and province", "CA-QC", "", []int{10000}, 10000, []int{500, 998}, 11498, ""},
+		{"country only", "CA-ON", "", []int{10000}, 10000, []int{500}, 10500, ""},
+		{"subdivision only", "US-CA", "", []int{1000}, 1000, []int{73}, 1073, ""},
+		{"untaxed", "US-OR", "", []int{1000}, 1000, nil, 1000, ""},
+		{"inclusive taxes add up", "XX", "", []int{1000}, 870, []int{87, 43}, 1000, ""},
+		{"exempt", "DE", "de 123.456.789", []int{11900}, 10000, nil, 10000, "Reverse charge"},
+		{"exempt elsewhere", "CA-QC", "DE123456789", []int{10000}, 10000, []int{500, 998}, 11498, ""},
+		{"exempt everywhere", "CA-QC", "GB111222", []int{10000}, 10000, nil, 10000, "exempt"},
+	}
+	table := testTable(t)
+	for _, tt := range tests {
+		r := Request{Jurisdiction: tt.jurisdiction, TaxID: tt.taxID, Currency: "EUR"}
+		for _, a := range tt.amounts {
+			r.Items = append(r.Items, Item{Description: "Widget", Amount: a})
+		}
+		q, err := table.Calculate(r)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if q.Subtotal != tt.subtotal || q.Total != tt.total || q.Exempt != tt.exempt || q.Currency != "eur" {
+			t.Errorf("%s: got subtotal %d, total %d, exempt %q, currency %s", tt.name, q.Subtotal, q.Total, q.Exempt, q.Currency)
+		}
+		if len(q.Lines) != len(tt.lines) {
+			t.Errorf("%s: got lines %+v, want amounts %v", tt.name, q.Lines, tt.lines)
+			continue
+		}
+		tax := 0
+		for i, l := range q.Lines {
+			if l.Amount != tt.lines[i] || l.Taxable != tt.subtotal {
+				t.Errorf("%s: line %d is %+v, want amount %d of %d", tt.name, i, l, tt.lines[i], tt.subtotal)
+			}
+			tax += l.Amount
+		}
+		if q.Tax != tax {
+			t.Errorf("%s: tax %d is not the sum of the lines, %d", tt.name, q.Tax, tax)
+		}
+	}
+}
+
+func TestCalculateLines(t *testing.T) {
+	q, err := testTable(t).Calculate(Request{Jurisdiction: "CA-QC", Items: []Item{{Amount: 100}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Line{
+		{Jurisdiction: "CA", Name: "GST", Rate: "5", Taxable: 100, Amount: 5},
+		{Jurisdiction: "CA-QC", Name: "QST", Rate: "9.975", Taxable: 100, Amount: 10},
+	}
+	for i := range want {
+		if q.Lines[i] != want[i] {
+			t.Errorf("line %d: got %+v, want %+v", i, q.Lines[i], want[i])
+		}
+	}
+}
+
+func TestCalculateInvalidJurisdiction(t *testing.T) {
+	for _, j := range []string{"", "Germany", "D", "US-CALI"} {
+		if _, err := testTable(t).Calculate(Request{Jurisdiction: j}); !errors.Is(err, ErrInvalidJurisdiction) {
+			t.Errorf("%q: got %v, want %v", j, err, ErrInvalidJurisdiction)
+		}
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	for s, want := range map[string]string{"19": "19", " 8.875 ": "8.875", "0": "0", "100": "100", "7.50": "7.5"} {
+		r, err := ParseRate(s)
+		if err != nil || r.String() != want {
+			t.Errorf("ParseRate(%q): got %s, %v, want %s", s, r, err, want)
+		}
+	}
+	for _, s := range []string{"-1", "100.5", "abc", ""} {
+		if _, err := ParseRate(s); err == nil {
+			t.Errorf("ParseRate(%q) accepted", s)
+		}
+	}
+}
+
+func TestJurisdictions(t *testing.T) {
+	if j := Jurisdiction("us", "ca"); j != "US-CA" {
+		t.Errorf("got %s", j)
+	}
+	if j := Jurisdiction("de", ""); j != "DE" {
+		t.Errorf("got %s", j)
+	}
+	if c := Country("US-CA"); c != "US" {
+		t.Errorf("got %s", c)
+	}
+	if id := NormalizeTaxID(" de 123.456-789/0 "); id != "DE1234567890" {
+		t.Errorf("got %s", id)
+	}
+}
@@ -0,0 +1,201 @@
+package validator
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"go-commerce/internal/money"
+)
+
+// EmailRX is a pragmatic email address pattern
+var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)+$")
+
+// Rule validates a string value and returns an error message, or "" if the value is valid
+type Rule func(value string) string
+
+// IntRule validates an int value and returns an error message, or "" if the value is valid
+type IntRule func(value int) string
+
+// Validator collects per-field errors, keeping the first error for each field
+type Validator struct {
+	Errors map[string]string
+}
+
+func New() *Validator {
+	return &Validator{Errors: make(map[string]string)}
+}
+
+// Valid reports whether no errors have been recorded
+func (v *Validator) Valid() bool {
+	return len(v.Errors) == 0
+}
+
+// AddError records message for field unless the field already has an error
+func (v *Validator) AddError(field, message string) {
+	if _, exists := v.Errors[field]; !exists {
+		v.Errors[field] = message
+	}
+}
+
+// Check runs rules against value in order and records the first failure for field
+func (v *Validator) Check(field, value string, rules ...Rule) {
+	for _, rule := range rules {
+		if msg := rule(value); msg != "" {
+			v.AddError(field, msg)
+			return
+		}
+	}
+}
+
+// CheckInt runs rules against value in order and records the first failure for field
+func (v *Validator) CheckInt(field string, value int, rules ...IntRule) {
+	for _, rule := range rules {
+		if msg := rule(value); msg != "" {
+			v.AddError(field, msg)
+			return
+		}
+	}
+}
+
+// Optional wraps rules so they only run when the value is not blank
+func Optional(rules ...Rule) Rule {
+	return func(value string) string {
+		if strings.TrimSpace(value) == "" {
+			return ""
+		}
+		for _, rule := range rules {
+			if msg := rule(value); msg != "" {
+				return msg
+			}
+		}
+		return ""
+	}
+}
+
+func Required(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "must be provided"
+	}
+	return ""
+}
+
+func Email(value string) string {
+	if !EmailRX.MatchString(value) {
+		return "must be a valid email address"
+	}
+	return ""
+}
+
+// Integer requires a string holding a base 10 integer
+func Integer(value string) string {
+	if _, err := strconv.Atoi(value); err != nil {
+		return "must be an integer"
+	}
+	return ""
+}
+
+func MinLength(n int) Rule {
+	return func(value string) string {
+		if utf8.RuneCountInString(value) < n {
+			return fmt.Sprintf("must be at least %d characters long", n)
+		}
+		return ""
+	}
+}
+
+func MaxLength(n int) Rule {
+	return func(value string) string {
+		if utf8.RuneCountInString(value) > n {
+			return fmt.Sprintf("must not be more than %d characters long", n)
+		}
+		return ""
+	}
+}
+
+// Length requires exactly n characters
+func Length(n int) Rule {
+	return func(value string) string {
+		if utf8.RuneCountInString(value) != n {
+			return fmt.Sprintf("must be exactly %d characters long", n)
+		}
+		return ""
+	}
+}
+
+// Digits requires a string made only of the digits 0-9
+func Digits(value string) string {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return "must only contain digits"
+		}
+	}
+	return ""
+}
+
+// Currency requires a supported ISO 4217 currency code, in any case
+func Currency(value string) string {
+	if !money.Known(value) {
+		return "must be a supported ISO 4217 currency code"
+	}
+	return ""
+}
+
+// In requires the value to be one of permitted
+func In(permitted ...string) Rule {
+	return func(value string) string {
+		for _, p := range permitted {
+			if value == p {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of %s", strings.Join(permitted, ", "))
+	}
+}
+
+// Matches requires the value to match rx
+func Matches(rx *regexp.Regexp, message string) Rule {
+	return func(value string) string {
+		if !rx.MatchString(value) {
+			return message
+		}
+		return ""
+	}
+}
+
+// Equals requires the value to equal other, for confirmation fields
+func Equals(other, message string) Rule {
+	return func(value string) string {
+		if value != other {
+			return message
+		}
+		return ""
+	}
+}
+
+func Positive(value int) string {
+	if value < 1 {
+		return "must be greater than zero"
+	}
+	return ""
+}
+
+func Min(n int) IntRule {
+	return func(value int) string {
+		if value < n {
+			return fmt.Sprintf("must be at least %d", n)
+		}
+		return ""
+	}
+}
+
+func Max(n int) IntRule {
+	return func(value int) string {
+		if value > n {
+			return fmt.Sprintf("must not be more than %d", n)
+		}
+		return ""
+	}
+}
@@ -0,0 +1,94 @@
+package validator
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  Rule
+		value string
+		want  string
+	}{
+		{"required", Required, "x", ""},
+		{"required blank", Required, "  ", "must be provided"},
+		{"email", Email, "jo@example.com", ""},
+		{"email without domain", Email, "jo@", "must be a valid email address"},
+		{"integer", Integer, "-12", ""},
+		{"integer with letters", Integer, "12a", "must be an integer"},
+		{"min length", MinLength(3), "héé", ""},
+		{"min length short", MinLength(3), "hé", "must be at least 3 characters long"},
+		{"max length", MaxLength(3), "héé", ""},
+		{"max length long", MaxLength(3), "héllo", "must not be more than 3 characters long"},
+		{"length", Length(4), "4242", ""},
+		{"length wrong", Length(4), "424", "must be exactly 4 characters long"},
+		{"digits", Digits, "0123", ""},
+		{"digits with space", Digits, "01 23", "must only contain digits"},
+		{"currency", Currency, "EUR", ""},
+		{"currency unknown", Currency, "xyz", "must be a supported ISO 4217 currency code"},
+		{"in", In("a", "b"), "b", ""},
+		{"in other", In("a", "b"), "c", "must be one of a, b"},
+		{"matches", Matches(regexp.MustCompile(`^[A-Z]{2}$`), "must be a country code"), "DE", ""},
+		{"matches not", Matches(regexp.MustCompile(`^[A-Z]{2}$`), "must be a country code"), "de", "must be a country code"},
+		{"equals", Equals("secret", "passwords do not match"), "secret", ""},
+		{"equals not", Equals("secret", "passwords do not match"), "Secret", "passwords do not match"},
+		{"optional blank", Optional(Email), "", ""},
+		{"optional invalid", Optional(Email), "jo", "must be a valid email address"},
+	}
+	for _, tt := range tests {
+		if got := tt.rule(tt.value); got != tt.want {
+			t.Errorf("%s: %q gave %q, want %q", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestIntRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  IntRule
+		value int
+		want  string
+	}{
+		{"positive", Positive, 1, ""},
+		{"positive zero", Positive, 0, "must be greater than zero"},
+		{"min", Min(2), 2, ""},
+		{"min below", Min(2), 1, "must be at least 2"},
+		{"max", Max(10), 10, ""},
+		{"max above", Max(10), 11, "must not be more than 10"},
+	}
+	for _, tt := range tests {
+		if got := tt.rule(tt.value); got != tt.want {
+			t.Errorf("%s: %d gave %q, want %q", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestValidatorKeepsFirstError(t *testing.T) {
+	v := New()
+	if !v.Valid() {
+		t.Fatal("a new validator is not valid")
+	}
+
+	v.Check("email", "", Required, Email)
+	v.Check("email", "jo", Email)
+	v.CheckInt("quantity", 0, Positive, Max(10))
+	v.Check("name", "Jo", Required)
+
+	if v.Valid() {
+		t.Fatal("validator with errors is valid")
+	}
+	want := map[string]string{
+		"email":    "must be provided",
+		"quantity": "must be greater than zero",
+	}
+	if len(v.Errors) != len(want) {
+		t.Fatalf("got errors %v, want %v", v.Errors, want)
+	}
+	for field, msg := range want {
+		if v.Errors[field] != msg {
+			t.Errorf("%s: got %q, want %q", field, v.Errors[field], msg)
+		}
+	}
+}